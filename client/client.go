@@ -31,15 +31,30 @@ import (
 )
 
 const (
-	pathArtifact   = "%s/api/artifact"
-	pathArtifacts  = "%s/api/artifacts"
-	pathReleases   = "%s/api/releases"
-	pathStatus     = "%s/api/status"
-	pathRollback   = "%s/api/rollback"
-	pathDelete     = "%s/api/delete"
-	pathEvent      = "%s/api/event"
-	pathUser       = "%s/api/user"
-	pathGitopsRepo = "%s/api/gitopsRepo"
+	pathArtifact     = "%s/api/artifact"
+	pathArtifacts    = "%s/api/artifacts"
+	pathReleases     = "%s/api/releases"
+	pathReleaseDiff  = "%s/api/releases/diff"
+	pathStatus       = "%s/api/status"
+	pathRollback     = "%s/api/rollback"
+	pathDelete       = "%s/api/delete"
+	pathEvent        = "%s/api/event"
+	pathEventLogs    = "%s/api/event/logs"
+	pathUser         = "%s/api/user"
+	pathUsers        = "%s/api/users"
+	pathGitopsRepo   = "%s/api/gitopsRepo"
+	pathCompact      = "%s/api/compact"
+	pathBOM          = "%s/api/bom"
+	pathMaintenance  = "%s/api/maintenance"
+	pathFreeze       = "%s/api/freeze"
+	pathEnvSync      = "%s/api/envSync"
+	pathApps         = "%s/api/apps"
+	pathDora         = "%s/api/metrics/dora"
+	pathMe           = "%s/api/me"
+	pathDrift        = "%s/api/drift"
+	pathReleaseState = "%s/api/releaseState"
+	pathShadow       = "%s/api/shadow"
+	pathRepositories = "%s/api/repositories"
 )
 
 type client struct {
@@ -75,6 +90,14 @@ func (c *client) ArtifactPost(in *dx.Artifact) (*dx.Artifact, error) {
 	return out, err
 }
 
+// ArtifactPostAndWait creates a new artifact and waits for the deploy decision on it
+func (c *client) ArtifactPostAndWait(in *dx.Artifact, timeout time.Duration) (*dx.ArtifactIngestion, error) {
+	out := new(dx.ArtifactIngestion)
+	uri := fmt.Sprintf(pathArtifact+"?wait=%s", c.addr, timeout.String())
+	err := c.post(uri, in, out)
+	return out, err
+}
+
 // ArtifactsGet creates a new user account.
 func (c *client) ArtifactsGet(
 	repo, branch string,
@@ -86,37 +109,10 @@ func (c *client) ArtifactsGet(
 ) ([]*dx.Artifact, error) {
 	uri := fmt.Sprintf(pathArtifacts, c.addr)
 
-	var params []string
-
-	if limit != 0 {
-		params = append(params, fmt.Sprintf("limit=%d", limit))
-	}
+	params := artifactsParams(repo, branch, event, sourceBranch, sha, limit, since, until)
 	if offset != 0 {
 		params = append(params, fmt.Sprintf("offset=%d", offset))
 	}
-	if since != nil {
-		params = append(params, fmt.Sprintf("since=%s", url.QueryEscape(since.Format(time.RFC3339))))
-	}
-	if until != nil {
-		params = append(params, fmt.Sprintf("until=%s", url.QueryEscape(until.Format(time.RFC3339))))
-	}
-	if repo != "" {
-		params = append(params, fmt.Sprintf("repository=%s", repo))
-	}
-	if branch != "" {
-		params = append(params, fmt.Sprintf("branch=%s", branch))
-	}
-	if event != nil {
-		params = append(params, fmt.Sprintf("event=%s", event))
-	}
-	if sourceBranch != "" {
-		params = append(params, fmt.Sprintf("sourceBranch=%s", sourceBranch))
-	}
-	if len(sha) != 0 {
-		for _, s := range sha {
-			params = append(params, fmt.Sprintf("sha=%s", s))
-		}
-	}
 
 	var paramsStr string
 	if len(params) > 0 {
@@ -153,6 +149,81 @@ func (c *client) ArtifactsGet(
 	return out, err
 }
 
+// ArtifactsPage returns a page of artifacts within the given constraints, with the total count and the next cursor
+func (c *client) ArtifactsPage(
+	repo, branch string,
+	event *dx.GitEvent,
+	sourceBranch string,
+	sha []string,
+	limit int,
+	cursor string,
+	since, until *time.Time,
+) (*dx.ArtifactsPage, error) {
+	uri := fmt.Sprintf(pathArtifacts, c.addr)
+
+	params := artifactsParams(repo, branch, event, sourceBranch, sha, limit, since, until)
+	if cursor != "" {
+		params = append(params, fmt.Sprintf("cursor=%s", url.QueryEscape(cursor)))
+	}
+
+	var paramsStr string
+	if len(params) > 0 {
+		paramsStr = "?" + strings.Join(params, "&")
+	}
+
+	resp, err := c.request(uri+paramsStr, "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page := &dx.ArtifactsPage{
+		Artifacts:  []*dx.Artifact{},
+		NextCursor: resp.Header.Get("X-Next-Cursor"),
+	}
+	page.Total, _ = strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	err = json.NewDecoder(resp.Body).Decode(&page.Artifacts)
+	return page, err
+}
+
+// artifactsParams returns the query parameters of the artifact list
+func artifactsParams(
+	repo, branch string,
+	event *dx.GitEvent,
+	sourceBranch string,
+	sha []string,
+	limit int,
+	since, until *time.Time,
+) []string {
+	var params []string
+
+	if limit != 0 {
+		params = append(params, fmt.Sprintf("limit=%d", limit))
+	}
+	if since != nil {
+		params = append(params, fmt.Sprintf("since=%s", url.QueryEscape(since.Format(time.RFC3339))))
+	}
+	if until != nil {
+		params = append(params, fmt.Sprintf("until=%s", url.QueryEscape(until.Format(time.RFC3339))))
+	}
+	if repo != "" {
+		params = append(params, fmt.Sprintf("repository=%s", repo))
+	}
+	if branch != "" {
+		params = append(params, fmt.Sprintf("branch=%s", branch))
+	}
+	if event != nil {
+		params = append(params, fmt.Sprintf("event=%s", event))
+	}
+	if sourceBranch != "" {
+		params = append(params, fmt.Sprintf("sourceBranch=%s", sourceBranch))
+	}
+	for _, s := range sha {
+		params = append(params, fmt.Sprintf("sha=%s", s))
+	}
+	return params
+}
+
 // ReleasesGet creates a new user account.
 func (c *client) ReleasesGet(
 	app string,
@@ -222,6 +293,48 @@ func (c *client) ReleasesGet(
 	return out, err
 }
 
+// ReleaseLifecycleGet returns the deploys, rollbacks and deletes of the app, or all apps of the env, newest first
+func (c *client) ReleaseLifecycleGet(app string, env string, limit int) ([]*dx.Release, error) {
+	uri := fmt.Sprintf(pathReleases+"?lifecycle=true&env=%s&limit=%d", c.addr, url.QueryEscape(env), limit)
+	if app != "" {
+		uri = uri + "&app=" + url.QueryEscape(app)
+	}
+
+	releases := []*dx.Release{}
+	err := c.get(uri, &releases)
+	if err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+// RenderedManifestsGet returns the manifests as they were written to the gitops repo in the given commit
+func (c *client) RenderedManifestsGet(gitopsRef string) ([]*dx.RenderedManifests, error) {
+	uri := fmt.Sprintf(pathReleases+"/%s/manifests", c.addr, url.PathEscape(gitopsRef))
+
+	var manifests []*dx.RenderedManifests
+	err := c.get(uri, &manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifests, nil
+}
+
+// ShadowManifestsGet returns the manifests of the last shadow deploy of the app to the env
+func (c *client) ShadowManifestsGet(env string, app string) (*dx.RenderedManifests, error) {
+	uri := fmt.Sprintf(pathShadow+"/%s/%s", c.addr, url.PathEscape(env), url.PathEscape(app))
+
+	manifests := new(dx.RenderedManifests)
+	err := c.get(uri, manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifests, nil
+}
+
 // StatusGet returns release status for all apps in an env
 func (c *client) StatusGet(
 	app string,
@@ -272,6 +385,78 @@ func (c *client) StatusGet(
 	return out, err
 }
 
+// BOMGet returns the bill of materials of an env
+func (c *client) BOMGet(env string) (*dx.BillOfMaterials, error) {
+	uri := fmt.Sprintf(pathBOM+"?env=%s", c.addr, env)
+
+	bom := new(dx.BillOfMaterials)
+	err := c.get(uri, bom)
+	if err != nil {
+		return nil, err
+	}
+
+	return bom, nil
+}
+
+// ReleaseStateGet returns the current releases that the release state worker last found, of all envs if env is empty
+func (c *client) ReleaseStateGet(env string) (*dx.ReleaseState, error) {
+	uri := fmt.Sprintf(pathReleaseState, c.addr)
+	if env != "" {
+		uri = uri + "?env=" + url.QueryEscape(env)
+	}
+
+	releaseState := new(dx.ReleaseState)
+	err := c.get(uri, releaseState)
+	if err != nil {
+		return nil, err
+	}
+
+	return releaseState, nil
+}
+
+// DriftGet compares the configuration of an app across the given envs, or all envs if none given
+func (c *client) DriftGet(app string, envs []string) (*dx.DriftReport, error) {
+	uri := fmt.Sprintf(pathDrift+"?app=%s", c.addr, url.QueryEscape(app))
+	if len(envs) > 0 {
+		uri = uri + "&envs=" + url.QueryEscape(strings.Join(envs, ","))
+	}
+
+	report := new(dx.DriftReport)
+	err := c.get(uri, report)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// DoraMetricsGet returns the DORA metrics of the given time window
+func (c *client) DoraMetricsGet(since, until time.Time) (*dx.DoraMetrics, error) {
+	uri := fmt.Sprintf(pathDora+"?since=%s&until=%s", c.addr,
+		url.QueryEscape(since.Format(time.RFC3339)), url.QueryEscape(until.Format(time.RFC3339)))
+
+	metrics := new(dx.DoraMetrics)
+	err := c.get(uri, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// RepositoryStatsGet returns the pipeline health metrics of the given repository
+func (c *client) RepositoryStatsGet(repo string) (*dx.RepositoryStats, error) {
+	uri := fmt.Sprintf(pathRepositories+"/%s/stats", c.addr, url.PathEscape(repo))
+
+	stats := new(dx.RepositoryStats)
+	err := c.get(uri, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
 // ReleasesPost releases the given artifact to the given environment
 func (c *client) ReleasesPost(request dx.ReleaseRequest) (string, error) {
 	uri := fmt.Sprintf(pathReleases, c.addr)
@@ -284,6 +469,30 @@ func (c *client) ReleasesPost(request dx.ReleaseRequest) (string, error) {
 	return res["id"].(string), nil
 }
 
+// ReevaluatePost re-runs the deploy policies of an artifact
+func (c *client) ReevaluatePost(artifactID string) (string, error) {
+	uri := fmt.Sprintf(pathArtifacts+"/%s/reevaluate", c.addr, url.PathEscape(artifactID))
+	result := new(map[string]interface{})
+	err := c.post(uri, nil, result)
+	if err != nil {
+		return "", err
+	}
+	res := *result
+	return res["id"].(string), nil
+}
+
+// ForceReevaluatePost re-runs the deploy policies of an artifact, deploying to the apps within their rollback protection window too
+func (c *client) ForceReevaluatePost(artifactID string) (string, error) {
+	uri := fmt.Sprintf(pathArtifacts+"/%s/reevaluate?force=true", c.addr, url.PathEscape(artifactID))
+	result := new(map[string]interface{})
+	err := c.post(uri, nil, result)
+	if err != nil {
+		return "", err
+	}
+	res := *result
+	return res["id"].(string), nil
+}
+
 // RollbackPost rolls back to a specific gitops commit
 func (c *client) RollbackPost(env string, app string, targetSHA string) (string, error) {
 	uri := fmt.Sprintf(pathRollback+"?env=%s&app=%s&sha=%s", c.addr, env, app, targetSHA)
@@ -296,6 +505,18 @@ func (c *client) RollbackPost(env string, app string, targetSHA string) (string,
 	return res["id"].(string), nil
 }
 
+// ForceRollbackPost rolls back to a specific gitops commit, reverting manual commits too
+func (c *client) ForceRollbackPost(env string, app string, targetSHA string) (string, error) {
+	uri := fmt.Sprintf(pathRollback+"?env=%s&app=%s&sha=%s&force=true", c.addr, env, app, targetSHA)
+	result := new(map[string]interface{})
+	err := c.post(uri, nil, result)
+	if err != nil {
+		return "", err
+	}
+	res := *result
+	return res["id"].(string), nil
+}
+
 // DeletePost deletes an application in an env
 func (c *client) DeletePost(env string, app string) error {
 	uri := fmt.Sprintf(pathDelete+"?env=%s&app=%s", c.addr, env, app)
@@ -307,6 +528,125 @@ func (c *client) DeletePost(env string, app string) error {
 	return nil
 }
 
+// CompactPost squashes the gitops history of the app folders in the env before the given time, app is a glob pattern
+func (c *client) CompactPost(before time.Time, env string, app string) (string, error) {
+	uri := fmt.Sprintf(pathCompact+"?before=%s&env=%s&app=%s", c.addr, url.QueryEscape(before.Format(time.RFC3339)), url.QueryEscape(env), url.QueryEscape(app))
+	result := new(map[string]interface{})
+	err := c.post(uri, nil, result)
+	if err != nil {
+		return "", err
+	}
+	res := *result
+	return res["id"].(string), nil
+}
+
+// ReleaseDiffGet compares the releases of an app in an env at two gitops commits
+func (c *client) ReleaseDiffGet(env string, app string, from string, to string) (*dx.ReleaseDiff, error) {
+	uri := fmt.Sprintf(pathReleaseDiff+"?env=%s&app=%s&from=%s&to=%s", c.addr, url.QueryEscape(env), url.QueryEscape(app), url.QueryEscape(from), url.QueryEscape(to))
+	diff := new(dx.ReleaseDiff)
+	err := c.get(uri, diff)
+	return diff, err
+}
+
+// MaintenanceGet returns the maintenance mode state
+func (c *client) MaintenanceGet() (*dx.Maintenance, error) {
+	uri := fmt.Sprintf(pathMaintenance, c.addr)
+	maintenance := new(dx.Maintenance)
+	err := c.get(uri, maintenance)
+	return maintenance, err
+}
+
+// MaintenancePost turns maintenance mode on or off
+func (c *client) MaintenancePost(enabled bool, message string) (*dx.Maintenance, error) {
+	mode := "off"
+	if enabled {
+		mode = "on"
+	}
+	uri := fmt.Sprintf(pathMaintenance+"?mode=%s&message=%s", c.addr, mode, url.QueryEscape(message))
+	maintenance := new(dx.Maintenance)
+	err := c.post(uri, nil, maintenance)
+	return maintenance, err
+}
+
+// FreezesGet returns the frozen apps
+func (c *client) FreezesGet() ([]*dx.Freeze, error) {
+	uri := fmt.Sprintf(pathFreeze, c.addr)
+	var freezes []*dx.Freeze
+	err := c.get(uri, &freezes)
+	return freezes, err
+}
+
+// FreezePost freezes the releases of an app in an env
+func (c *client) FreezePost(env string, app string, reason string) (*dx.Freeze, error) {
+	uri := fmt.Sprintf(pathFreeze+"/%s/%s?reason=%s", c.addr, url.PathEscape(env), url.PathEscape(app), url.QueryEscape(reason))
+	freeze := new(dx.Freeze)
+	err := c.post(uri, nil, freeze)
+	return freeze, err
+}
+
+// FreezeDelete lifts the release freeze of an app in an env
+func (c *client) FreezeDelete(env string, app string) error {
+	uri := fmt.Sprintf(pathFreeze+"/%s/%s", c.addr, url.PathEscape(env), url.PathEscape(app))
+	return c.delete(uri)
+}
+
+// EnvSyncsGet returns the envs whose Flux sync is failing
+func (c *client) EnvSyncsGet() ([]*dx.EnvSync, error) {
+	uri := fmt.Sprintf(pathEnvSync, c.addr)
+	var syncs []*dx.EnvSync
+	err := c.get(uri, &syncs)
+	return syncs, err
+}
+
+// EnvSyncOverride lets the auto-deploys to an env through while its sync is failing
+func (c *client) EnvSyncOverride(env string) (*dx.EnvSync, error) {
+	uri := fmt.Sprintf(pathEnvSync+"/%s/override", c.addr, url.PathEscape(env))
+	sync := new(dx.EnvSync)
+	err := c.post(uri, nil, sync)
+	return sync, err
+}
+
+// EnvSyncOverrideDelete holds the auto-deploys to an env with a failing sync again
+func (c *client) EnvSyncOverrideDelete(env string) (*dx.EnvSync, error) {
+	uri := fmt.Sprintf(pathEnvSync+"/%s/override", c.addr, url.PathEscape(env))
+	sync := new(dx.EnvSync)
+	err := c.do(uri, "DELETE", nil, sync)
+	return sync, err
+}
+
+// AppDeleteConfirmation returns the token that confirms deleting an app from an env
+func (c *client) AppDeleteConfirmation(env string, app string) (*dx.DeleteConfirmation, error) {
+	uri := fmt.Sprintf(pathApps+"/%s/%s", c.addr, url.PathEscape(env), url.PathEscape(app))
+	confirmation := new(dx.DeleteConfirmation)
+	err := c.do(uri, "DELETE", nil, confirmation)
+	return confirmation, err
+}
+
+// AppDelete deletes an app from an env with a confirmation token
+func (c *client) AppDelete(env string, app string, confirmationToken string) (string, error) {
+	uri := fmt.Sprintf(pathApps+"/%s/%s?confirm=%s", c.addr, url.PathEscape(env), url.PathEscape(app), url.QueryEscape(confirmationToken))
+	result := new(map[string]interface{})
+	err := c.do(uri, "DELETE", nil, result)
+	if err != nil {
+		return "", err
+	}
+	res := *result
+	return res["id"].(string), nil
+}
+
+// EventLogsGet gets the last log lines of the processing of an event
+func (c *client) EventLogsGet(trackingID string) (*dx.EventLogs, error) {
+	uri := fmt.Sprintf(pathEventLogs, c.addr)
+
+	result := new(dx.EventLogs)
+	err := c.get(uri+"?id="+url.QueryEscape(trackingID), result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 // TrackGet gets the status of an event
 func (c *client) TrackGet(trackingID string) (*dx.ReleaseStatus, error) {
 	uri := fmt.Sprintf(pathEvent, c.addr)
@@ -349,8 +689,41 @@ func (c *client) UserPost(toSave *model.User) (*model.User, error) {
 	return createdUser, nil
 }
 
+// UsersGet returns all users
+func (c *client) UsersGet() ([]*model.User, error) {
+	uri := fmt.Sprintf(pathUsers, c.addr)
+
+	var users []*model.User
+	err := c.get(uri, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// UserDelete deletes the user with the given login name, its tokens stop working
+func (c *client) UserDelete(login string) error {
+	uri := fmt.Sprintf(pathUser+"/%s", c.addr, url.PathEscape(login))
+	return c.delete(uri)
+}
+
 type GitopsRepoResult struct {
-	GitopsRepo string `json:"gitopsRepo"`
+	GitopsRepo     string                   `json:"gitopsRepo"`
+	HistoryRewrite *dx.GitopsHistoryRewrite `json:"historyRewrite,omitempty"`
+}
+
+// MeGet returns the identity that the client's token maps to
+func (c *client) MeGet() (*dx.Identity, error) {
+	uri := fmt.Sprintf(pathMe, c.addr)
+
+	identity := new(dx.Identity)
+	err := c.get(uri, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
 }
 
 // GitopsRepoGet returns the configured gitops repo name
@@ -406,6 +779,15 @@ func (c *client) do(rawURL, method string, in, out interface{}) error {
 }
 
 func (c *client) open(rawURL, method string, in interface{}) (io.ReadCloser, error) {
+	resp, err := c.request(rawURL, method, in)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// request sends the request, and returns the response if its status is successful
+func (c *client) request(rawURL, method string, in interface{}) (*http.Response, error) {
 	uri, err := url.Parse(rawURL)
 	if err != nil {
 		return nil, err
@@ -434,5 +816,5 @@ func (c *client) open(rawURL, method string, in interface{}) (io.ReadCloser, err
 		out, _ := ioutil.ReadAll(resp.Body)
 		return nil, fmt.Errorf("client error %d: %s", resp.StatusCode, string(out))
 	}
-	return resp.Body, nil
+	return resp, nil
 }
@@ -2,6 +2,8 @@ package client
 
 import (
 	"encoding/base32"
+	"encoding/json"
+	"fmt"
 	"github.com/gimlet-io/gimletd/cmd/config"
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
@@ -11,6 +13,8 @@ import (
 	"github.com/gorilla/securecookie"
 	"github.com/stretchr/testify/assert"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -67,4 +71,217 @@ func Test_artifact(t *testing.T) {
 	)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(artifacts))
+
+	_, err = client.ArtifactPost(&dx.Artifact{
+		Version: dx.Version{
+			SHA:            "sha2",
+			RepositoryName: "my-app",
+		},
+	})
+	assert.Nil(t, err)
+
+	page, err := client.ArtifactsPage("", "", nil, "", nil, 1, "", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(page.Artifacts))
+	assert.Equal(t, 2, page.Total)
+	assert.NotEmpty(t, page.NextCursor)
+
+	nextPage, err := client.ArtifactsPage("", "", nil, "", nil, 1, page.NextCursor, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nextPage.Artifacts))
+	assert.NotEqual(t, page.Artifacts[0].ID, nextPage.Artifacts[0].ID, "the next page should continue the list")
+}
+
+func Test_pathsInOpenAPISpec(t *testing.T) {
+	router := server.SetupRouter(&config.Config{}, store.NewTest(), nil, nil, nil)
+	specBytes, err := server.OpenAPISpec(router)
+	assert.Nil(t, err)
+
+	var spec struct {
+		Paths map[string]interface{} `json:"paths"`
+	}
+	err = json.Unmarshal(specBytes, &spec)
+	assert.Nil(t, err)
+
+	for _, path := range []string{
+		pathArtifact, pathArtifacts, pathReleases, pathStatus, pathRollback, pathDelete,
+		pathEvent, pathEventLogs, pathUser, pathGitopsRepo, pathCompact, pathBOM, pathMaintenance, pathDora, pathMe, pathDrift,
+		pathReleaseState, pathUsers, pathFreeze, pathEnvSync, pathReleaseDiff,
+	} {
+		assert.Contains(t, spec.Paths, fmt.Sprintf(path, ""), "client paths should be part of the API contract")
+	}
+}
+
+// eventID is what the client reads from the responses that only return the id of the created event
+type eventID struct {
+	ID string `json:"id"`
+}
+
+func Test_typesInOpenAPISpec(t *testing.T) {
+	router := server.SetupRouter(&config.Config{}, store.NewTest(), nil, nil, nil)
+	specBytes, err := server.OpenAPISpec(router)
+	assert.Nil(t, err)
+
+	var spec map[string]interface{}
+	err = json.Unmarshal(specBytes, &spec)
+	assert.Nil(t, err)
+
+	// the types the client decodes the responses into
+	for operation, clientType := range map[string]interface{}{
+		"POST /api/artifact":                      dx.Artifact{},
+		"GET /api/artifacts":                      []*dx.Artifact{},
+		"GET /api/releases":                       []*dx.Release{},
+		"POST /api/releases":                      eventID{},
+		"GET /api/releases/{gitopsRef}/manifests": []*dx.RenderedManifests{},
+		"GET /api/releases/diff":                  dx.ReleaseDiff{},
+		"GET /api/shadow/{env}/{app}":             dx.RenderedManifests{},
+		"GET /api/status":                         map[string]*dx.Release{},
+		"GET /api/bom":                            dx.BillOfMaterials{},
+		"GET /api/releaseState":                   dx.ReleaseState{},
+		"GET /api/drift":                          dx.DriftReport{},
+		"GET /api/metrics/dora":                   dx.DoraMetrics{},
+		"GET /api/repositories/{name}/stats":      dx.RepositoryStats{},
+		"POST /api/artifacts/{id}/reevaluate":     eventID{},
+		"POST /api/rollback":                      eventID{},
+		"POST /api/compact":                       eventID{},
+		"DELETE /api/apps/{env}/{app}":            eventID{},
+		"GET /api/maintenance":                    dx.Maintenance{},
+		"POST /api/maintenance":                   dx.Maintenance{},
+		"GET /api/freeze":                         []*dx.Freeze{},
+		"POST /api/freeze/{env}/{app}":            dx.Freeze{},
+		"GET /api/envSync":                        []*dx.EnvSync{},
+		"POST /api/envSync/{env}/override":        dx.EnvSync{},
+		"DELETE /api/envSync/{env}/override":      dx.EnvSync{},
+		"GET /api/event":                          dx.ReleaseStatus{},
+		"GET /api/event/logs":                     dx.EventLogs{},
+		"GET /api/user/{login}":                   model.User{},
+		"POST /api/user":                          model.User{},
+		"GET /api/users":                          []*model.User{},
+		"GET /api/me":                             dx.Identity{},
+		"GET /api/gitopsRepo":                     GitopsRepoResult{},
+	} {
+		parts := strings.SplitN(operation, " ", 2)
+		schema := responseSchema(spec, strings.ToLower(parts[0]), parts[1])
+		if !assert.NotNil(t, schema, "%s should have a response in the API contract", operation) {
+			continue
+		}
+		assertSchemaOf(t, spec, schema, reflect.TypeOf(clientType), operation)
+	}
+}
+
+// responseSchema returns the schema of the successful response of an operation in the OpenAPI document
+func responseSchema(spec map[string]interface{}, method string, path string) map[string]interface{} {
+	operation, _ := spec["paths"].(map[string]interface{})[path].(map[string]interface{})[method].(map[string]interface{})
+	if operation == nil {
+		return nil
+	}
+	for status, response := range operation["responses"].(map[string]interface{}) {
+		if !strings.HasPrefix(status, "2") {
+			continue
+		}
+		content, _ := response.(map[string]interface{})["content"].(map[string]interface{})
+		if content == nil {
+			return nil
+		}
+		return content["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+	}
+	return nil
+}
+
+// assertSchemaOf checks that a schema of the OpenAPI document describes the Go type,
+// structs are compared by their JSON field names
+func assertSchemaOf(t *testing.T, spec map[string]interface{}, schema map[string]interface{}, goType reflect.Type, operation string) {
+	for goType.Kind() == reflect.Ptr {
+		goType = goType.Elem()
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+		schema = schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+	}
+
+	switch goType.Kind() {
+	case reflect.Slice:
+		if assert.Equal(t, "array", schema["type"], "%s should return an array", operation) {
+			assertSchemaOf(t, spec, schema["items"].(map[string]interface{}), goType.Elem(), operation)
+		}
+	case reflect.Map:
+		if assert.Equal(t, "object", schema["type"], "%s should return an object", operation) {
+			assertSchemaOf(t, spec, schema["additionalProperties"].(map[string]interface{}), goType.Elem(), operation)
+		}
+	case reflect.Struct:
+		var properties []string
+		for property := range schema["properties"].(map[string]interface{}) {
+			properties = append(properties, property)
+		}
+		assert.ElementsMatch(t, jsonFields(goType), properties, "%s should return the fields of %s", operation, goType.Name())
+	}
+}
+
+// jsonFields returns the names of the JSON fields of a struct, with the fields of the embedded structs
+func jsonFields(t reflect.Type) []string {
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			fields = append(fields, jsonFields(embedded)...)
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+func Test_users(t *testing.T) {
+	store := store.NewTest()
+
+	router := server.SetupRouter(&config.Config{}, store, nil, nil, nil)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	admin := &model.User{
+		Login: "admin",
+		Secret: base32.StdEncoding.EncodeToString(
+			securecookie.GenerateRandomKey(32),
+		),
+		Admin: true,
+	}
+	err := store.CreateUser(admin)
+	assert.Nil(t, err)
+
+	tokenStr, err := token.New(token.UserToken, admin.Login).Sign(admin.Secret)
+	assert.Nil(t, err)
+	auther := new(oauth2.Config).Client(oauth2.NoContext, &oauth2.Token{AccessToken: tokenStr})
+	client := NewClient(server.URL, auther)
+
+	created, err := client.UserPost(&model.User{Login: "laszlo"})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, created.Token)
+
+	users, err := client.UsersGet()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(users))
+
+	user, err := client.UserGet("laszlo", true)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, user.Token)
+
+	err = client.UserDelete("laszlo")
+	assert.Nil(t, err)
+	_, err = client.UserGet("laszlo", false)
+	assert.NotNil(t, err, "deleted users should not be found")
 }
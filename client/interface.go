@@ -33,6 +33,9 @@ type Client interface {
 	// ArtifactPost creates a new artifact.
 	ArtifactPost(artifact *dx.Artifact) (*dx.Artifact, error)
 
+	// ArtifactPostAndWait creates a new artifact and waits until the deploy decision is made on it
+	ArtifactPostAndWait(artifact *dx.Artifact, timeout time.Duration) (*dx.ArtifactIngestion, error)
+
 	// ArtifactsGet returns all artifacts in the database within the given constraints
 	ArtifactsGet(
 		repo, branch string,
@@ -43,6 +46,18 @@ type Client interface {
 		since, until *time.Time,
 	) ([]*dx.Artifact, error)
 
+	// ArtifactsPage returns a page of artifacts within the given constraints, newest first.
+	// Pass the NextCursor of the previous page to get the next one, an empty cursor for the first page
+	ArtifactsPage(
+		repo, branch string,
+		event *dx.GitEvent,
+		sourceBranch string,
+		sha []string,
+		limit int,
+		cursor string,
+		since, until *time.Time,
+	) (*dx.ArtifactsPage, error)
+
 	// ReleasesGet returns all releases from the gitops repo within the given constraints
 	ReleasesGet(
 		app string,
@@ -52,30 +67,112 @@ type Client interface {
 		since, until *time.Time,
 	) ([]*dx.Release, error)
 
+	// ReleaseLifecycleGet returns the deploys, rollbacks and deletes of the app, or all apps of the env, classified by their type
+	ReleaseLifecycleGet(app string, env string, limit int) ([]*dx.Release, error)
+
+	// RenderedManifestsGet returns the manifests as they were written to the gitops repo in the given commit
+	RenderedManifestsGet(gitopsRef string) ([]*dx.RenderedManifests, error)
+
+	// ShadowManifestsGet returns the manifests of the last shadow deploy of the app to the env
+	ShadowManifestsGet(env string, app string) (*dx.RenderedManifests, error)
+
 	// StatusGet returns release status for all apps in an env
 	StatusGet(
 		app string,
 		env string,
 	) (map[string]*dx.Release, error)
 
+	// BOMGet returns the artifacts deployed in an env and all their dependencies
+	BOMGet(env string) (*dx.BillOfMaterials, error)
+
+	// ReleaseStateGet returns the current releases that the release state worker last found, of all envs if env is empty
+	ReleaseStateGet(env string) (*dx.ReleaseState, error)
+
+	// DriftGet compares the chart and the values of an app across the given envs, or all envs if none given
+	DriftGet(app string, envs []string) (*dx.DriftReport, error)
+
+	// DoraMetricsGet returns the deployment frequency, lead time, change failure rate and MTTR of a time window
+	DoraMetricsGet(since, until time.Time) (*dx.DoraMetrics, error)
+
+	// RepositoryStatsGet returns the artifact counts, the last deploy per env and the average deploy latency of a repository
+	RepositoryStatsGet(repo string) (*dx.RepositoryStats, error)
+
 	// ReleasesPost releases the given artifact to the given environment
 	ReleasesPost(request dx.ReleaseRequest) (string, error)
 
+	// ReevaluatePost re-runs the deploy policies of the given artifact, and deploys it to the envs that match now
+	ReevaluatePost(artifactID string) (string, error)
+
+	// ForceReevaluatePost re-runs the deploy policies of the given artifact, deploying to the apps within their rollback protection window too
+	ForceReevaluatePost(artifactID string) (string, error)
+
 	// RollbackPost rolls back to the given sha
 	RollbackPost(env string, app string, targetSHA string) (string, error)
 
+	// ForceRollbackPost rolls back to the given sha, even if commits that were not made by GimletD have to be reverted
+	ForceRollbackPost(env string, app string, targetSHA string) (string, error)
+
 	// DeletePost deletes an application in an env
 	DeletePost(env string, app string) error
 
+	// CompactPost squashes the gitops history of the app folders in the env before the given time, app is a glob pattern
+	CompactPost(before time.Time, env string, app string) (string, error)
+
+	// AppDeleteConfirmation returns the token that confirms deleting an app from an env
+	AppDeleteConfirmation(env string, app string) (*dx.DeleteConfirmation, error)
+
+	// AppDelete deletes an app from an env with a confirmation token, returns the tracking id
+	AppDelete(env string, app string, confirmationToken string) (string, error)
+
+	// ReleaseDiffGet compares the releases of an app in an env at two gitops commits:
+	// the changed images, chart and values, and the app commits between the artifacts
+	ReleaseDiffGet(env string, app string, from string, to string) (*dx.ReleaseDiff, error)
+
+	// MaintenanceGet returns the maintenance mode state
+	MaintenanceGet() (*dx.Maintenance, error)
+
+	// MaintenancePost turns maintenance mode on or off
+	MaintenancePost(enabled bool, message string) (*dx.Maintenance, error)
+
+	// FreezesGet returns the frozen apps
+	FreezesGet() ([]*dx.Freeze, error)
+
+	// FreezePost freezes the releases of an app in an env, its deploys are parked until it is unfrozen
+	FreezePost(env string, app string, reason string) (*dx.Freeze, error)
+
+	// FreezeDelete lifts the release freeze of an app in an env
+	FreezeDelete(env string, app string) error
+
+	// EnvSyncsGet returns the envs whose Flux sync is failing
+	EnvSyncsGet() ([]*dx.EnvSync, error)
+
+	// EnvSyncOverride lets the auto-deploys to an env through while its sync is failing, until the sync recovers
+	EnvSyncOverride(env string) (*dx.EnvSync, error)
+
+	// EnvSyncOverrideDelete holds the auto-deploys to an env with a failing sync again
+	EnvSyncOverrideDelete(env string) (*dx.EnvSync, error)
+
 	// TrackGet returns the state of an event
 	TrackGet(trackingID string) (*dx.ReleaseStatus, error)
 
+	// EventLogsGet returns the last log lines of the processing of an event
+	EventLogsGet(trackingID string) (*dx.EventLogs, error)
+
 	// UserGet returns the user with the given login
 	UserGet(login string, withToken bool) (*model.User, error)
 
 	// UserPost creates a user
 	UserPost(user *model.User) (*model.User, error)
 
+	// UsersGet returns all users
+	UsersGet() ([]*model.User, error)
+
+	// UserDelete deletes a user, its tokens stop working
+	UserDelete(login string) error
+
+	// MeGet returns the identity that the client's token maps to
+	MeGet() (*dx.Identity, error)
+
 	// GitopsRepoGet returns the configured gitops repo name
 	GitopsRepoGet() (string, error)
 }
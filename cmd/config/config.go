@@ -2,6 +2,7 @@ package config
 
 import (
 	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"gopkg.in/yaml.v2"
@@ -26,9 +27,96 @@ func defaults(c *Config) {
 	if c.RepoCachePath == "" {
 		c.RepoCachePath = "/tmp/gimletd"
 	}
+	if c.RepoCacheRefreshInterval == 0 {
+		c.RepoCacheRefreshInterval = 30 * time.Second
+	}
+	if c.PlatformConfig.DeployKeyPath == "" {
+		c.PlatformConfig.DeployKeyPath = c.GitopsRepoDeployKeyPath
+	}
+	if c.ChartCacheRefreshInterval == 0 {
+		c.ChartCacheRefreshInterval = 5 * time.Minute
+	}
+	if c.BranchDeleteCloneMode == "" {
+		c.BranchDeleteCloneMode = "full"
+	}
 	if c.ReleaseStats == "" {
 		c.ReleaseStats = "disabled"
 	}
+	if c.ReleaseStatsInterval == 0 {
+		c.ReleaseStatsInterval = 30 * time.Second
+	}
+	if c.StuckEventThreshold == 0 {
+		c.StuckEventThreshold = 10 * time.Minute
+	}
+	if c.EventBacklog.Threshold == 0 {
+		c.EventBacklog.Threshold = 100
+	}
+	if c.EventBacklog.MaxAge == 0 {
+		c.EventBacklog.MaxAge = 15 * time.Minute
+	}
+	if c.DoraMetricsWindow == 0 {
+		c.DoraMetricsWindow = 30 * 24 * time.Hour
+	}
+	if c.Alerting.FailureThreshold == 0 {
+		c.Alerting.FailureThreshold = 3
+	}
+	if c.Alerting.RateLimit == 0 {
+		c.Alerting.RateLimit = 30 * time.Minute
+	}
+	if c.GitopsRemoteCircuit.FailureThreshold == 0 {
+		c.GitopsRemoteCircuit.FailureThreshold = 3
+	}
+	if c.GitopsRemoteCircuit.ProbeInterval == 0 {
+		c.GitopsRemoteCircuit.ProbeInterval = 1 * time.Minute
+	}
+	if c.CleanupArchive.Retention == 0 {
+		c.CleanupArchive.Retention = 30 * 24 * time.Hour
+	}
+	if c.VulnerabilityScan.Timeout == 0 {
+		c.VulnerabilityScan.Timeout = 5 * time.Minute
+	}
+	if c.ManifestValidation.Timeout == 0 {
+		c.ManifestValidation.Timeout = time.Minute
+	}
+	if c.ImageUpdate.Interval == 0 {
+		c.ImageUpdate.Interval = 5 * time.Minute
+	}
+	if c.HelmRender.Concurrency == 0 {
+		c.HelmRender.Concurrency = 4
+	}
+	if c.GitopsChecks.Timeout == 0 {
+		c.GitopsChecks.Timeout = 30 * time.Minute
+	}
+	if c.GitopsChecks.PollInterval == 0 {
+		c.GitopsChecks.PollInterval = 30 * time.Second
+	}
+	if c.GroupSync.Interval == 0 {
+		c.GroupSync.Interval = 10 * time.Minute
+	}
+	if c.OIDC.TokenTTL == 0 {
+		c.OIDC.TokenTTL = 8 * time.Hour
+	}
+	if c.OIDC.LoginClaim == "" {
+		c.OIDC.LoginClaim = "email"
+	}
+	if c.OIDC.GroupsClaim == "" {
+		c.OIDC.GroupsClaim = "groups"
+	}
+	if c.CORS.AllowCredentials == "" {
+		c.CORS.AllowCredentials = "true"
+	}
+	if c.Firehose.Interval == 0 {
+		c.Firehose.Interval = 10 * time.Second
+	}
+	if c.Firehose.BatchSize == 0 {
+		c.Firehose.BatchSize = 100
+	}
+	if c.Firehose.Retention == 0 {
+		c.Firehose.Retention = 7 * 24 * time.Hour
+	}
+	if c.ArtifactExpiry.Interval == 0 {
+		c.ArtifactExpiry.Interval = time.Hour
+	}
 }
 
 // String returns the configuration in string format.
@@ -44,16 +132,134 @@ type Config struct {
 	Database                Database
 	GitopsRepo              string `envconfig:"GITOPS_REPO"`
 	GitopsRepoDeployKeyPath string `envconfig:"GITOPS_REPO_DEPLOY_KEY_PATH"`
-	RepoCachePath           string `envconfig:"REPO_CACHE_PATH"`
-	Notifications           Notifications
-	Github                  Github
-	ReleaseStats            string `envconfig:"RELEASE_STATS"`
-	PrintAdminToken         bool   `envconfig:"PRINT_ADMIN_TOKEN"`
+
+	// GitopsRepoDefaultBranch overrides the default branch of the gitops repo, that is detected from the remote HEAD otherwise
+	GitopsRepoDefaultBranch string `envconfig:"GITOPS_REPO_DEFAULT_BRANCH"`
+
+	RepoCachePath string `envconfig:"REPO_CACHE_PATH"`
+
+	// RepoCacheRefreshInterval is the period the gitops repo cache is pulled in the background
+	RepoCacheRefreshInterval time.Duration `envconfig:"REPO_CACHE_REFRESH_INTERVAL"`
+
+	// ChartCacheRefreshInterval is the age after cached git hosted charts that point to a branch are fetched again
+	ChartCacheRefreshInterval time.Duration `envconfig:"CHART_CACHE_REFRESH_INTERVAL"`
+
+	// DisableGitSubmodules skips the submodules of the gitops repo and the git hosted charts, they are cloned and updated by default
+	DisableGitSubmodules bool `envconfig:"DISABLE_GIT_SUBMODULES"`
+
+	// PlatformConfig is a git repo with per env override values that are merged over the manifest values at deploy time
+	PlatformConfig PlatformConfig
+
+	// GitopsRepoWebhookSecret enables the push webhook of the gitops repo that refreshes the repo cache
+	GitopsRepoWebhookSecret string `envconfig:"GITOPS_REPO_WEBHOOK_SECRET"`
+
+	TLS                 TLS
+	ArtifactSigning     ArtifactSigning
+	Notifications       Notifications
+	PagerDuty           PagerDuty
+	Alerting            Alerting
+	ChangeManagement    ChangeManagement
+	DeployHooks         DeployHooks
+	ImageUpdate         ImageUpdate
+	ArtifactExpiry      ArtifactExpiry
+	GitopsRemoteCircuit GitopsRemoteCircuit
+	CleanupArchive      CleanupArchive
+	VulnerabilityScan   VulnerabilityScan
+	ManifestValidation  ManifestValidation
+	GitopsChecks        GitopsChecks
+	EventBacklog        EventBacklog
+	TemplateLimits      TemplateLimits
+	HelmRender          HelmRender
+	Firehose            Firehose
+	GroupSync           GroupSync
+	OIDC                OIDC
+	CORS                CORS
+	Github              Github
+	ReleaseStats        string `envconfig:"RELEASE_STATS"`
+	PrintAdminToken     bool   `envconfig:"PRINT_ADMIN_TOKEN"`
+
+	// AdminToken is a bearer token that authenticates the admin user, so installs don't need the generated token from the logs.
+	// The generated admin token keeps working
+	AdminToken string `envconfig:"ADMIN_TOKEN"`
+
+	// ReleaseStatsInterval is the period the release state worker walks the gitops repo
+	ReleaseStatsInterval time.Duration `envconfig:"RELEASE_STATS_INTERVAL"`
+	// ReleaseStatsEnvs is a comma separated list of envs that the release state worker walks, all envs by default
+	ReleaseStatsEnvs string `envconfig:"RELEASE_STATS_ENVS"`
+
+	// BranchDeleteCloneMode is full or shallow. Full keeps clones of the app repos with a cleanup policy to detect deleted branches,
+	// shallow only keeps the manifests of each branch and lists the remote branches instead
+	BranchDeleteCloneMode string `envconfig:"BRANCH_DELETE_CLONE_MODE"`
+
+	// EnvsConfigPath is a YAML file of the env registry, where envs can set the default chart, values and deploy policy of their manifests
+	EnvsConfigPath string `envconfig:"ENVS_CONFIG_PATH"`
+
+	// RollbackProtectionWindow blocks policy based deploys of an app in an env for the given duration after a rollback
+	RollbackProtectionWindow time.Duration `envconfig:"ROLLBACK_PROTECTION_WINDOW"`
+
+	// StuckEventThreshold is the duration after an event in processing is considered stuck
+	StuckEventThreshold time.Duration `envconfig:"STUCK_EVENT_THRESHOLD"`
+
+	// EventsRetention drops the monthly partitions of events older than this duration. Postgres only, zero keeps every event
+	EventsRetention time.Duration `envconfig:"EVENTS_RETENTION"`
+
+	// DoraMetricsWindow is the rolling time window of the exported DORA metrics
+	DoraMetricsWindow time.Duration `envconfig:"DORA_METRICS_WINDOW"`
+
+	// DriftReportEnvs is a comma separated list of envs that the periodic config drift report compares, all envs by default
+	DriftReportEnvs string `envconfig:"DRIFT_REPORT_ENVS"`
+
+	// RegistryWebhookSecret enables the image push webhooks of container registries that create artifacts
+	RegistryWebhookSecret string `envconfig:"REGISTRY_WEBHOOK_SECRET"`
+
+	// PublicEndpoints exposes the current releases and the deploy badges of the envs without authentication
+	PublicEndpoints bool `envconfig:"PUBLIC_ENDPOINTS"`
+
+	// RBACRules is a YAML list of rules that grant roles to user groups, eg.: [{group: platform, role: admin}]
+	RBACRules string `envconfig:"RBAC_RULES"`
+
+	// AllowedCIDRs is a comma separated list of networks that can reach the API, eg.: 10.0.0.0/8,192.168.1.10/32
+	AllowedCIDRs string `envconfig:"API_ALLOWED_CIDRS"`
+
+	// ArtifactRepoAllowlist is a comma separated list of the source repositories that may submit artifacts, each with the login
+	// of the user or API token that may submit them, eg.: my-org/my-app:my-app-ci,my-org/team-*:team-ci.
+	// Repositories added with the admin API are allowed too. Every repository is allowed while both lists are empty
+	ArtifactRepoAllowlist string `envconfig:"ARTIFACT_REPO_ALLOWLIST"`
+}
+
+// PlatformConfig configures the platform config repo, where the overrides of an env are in <env>/values.yaml.
+// The gitops repo deploy key is used if no deploy key is set
+type PlatformConfig struct {
+	Repo          string `envconfig:"PLATFORM_CONFIG_REPO"`
+	DeployKeyPath string `envconfig:"PLATFORM_CONFIG_REPO_DEPLOY_KEY_PATH"`
+	// DefaultBranch overrides the default branch of the repo, that is detected from the remote HEAD otherwise
+	DefaultBranch string `envconfig:"PLATFORM_CONFIG_REPO_DEFAULT_BRANCH"`
+}
+
+// TLS configures HTTPS serving of the API.
+// With a client CA set, the clients of the authenticated API routes must present a certificate signed by it.
+// The webhooks and the public routes don't need a client certificate
+type TLS struct {
+	CertPath     string `envconfig:"TLS_CERT_PATH"`
+	KeyPath      string `envconfig:"TLS_KEY_PATH"`
+	ClientCAPath string `envconfig:"TLS_CLIENT_CA_PATH"`
+}
+
+// ArtifactSigning configures the verification of artifact signatures.
+// Protected envs only get artifacts with a verified signature
+type ArtifactSigning struct {
+	PublicKeysPath string `envconfig:"ARTIFACT_SIGNING_PUBLIC_KEYS_PATH"`
+	ProtectedEnvs  string `envconfig:"ARTIFACT_SIGNING_PROTECTED_ENVS"`
 }
 
 type Database struct {
+	// Driver is sqlite3, postgres, mysql, or memory that keeps the data in memory only, for demos
 	Driver string `envconfig:"DATABASE_DRIVER"`
 	Config string `envconfig:"DATABASE_CONFIG"`
+
+	// ReadConfig is the connection string of a read-only replica.
+	// The artifact listing and search endpoints query it, so dashboard and CI reads don't contend with the writes of the workers
+	ReadConfig string `envconfig:"DATABASE_READ_CONFIG"`
 }
 
 // Logging provides the logging configuration.
@@ -70,10 +276,210 @@ type Notifications struct {
 	Token          string `envconfig:"NOTIFICATIONS_TOKEN"`
 	DefaultChannel string `envconfig:"NOTIFICATIONS_DEFAULT_CHANNEL"`
 	ChannelMapping string `envconfig:"NOTIFICATIONS_CHANNEL_MAPPING"`
+
+	// Routing routes messages to channels by event type, env and team, eg.: [{event: failure, channel: alerts}, {env: staging, channel: staging}, {team: payments, channel: payments}]
+	// Event types are deploy, failure, rollback, cleanup, gitops. The first matching route wins, then the channel mapping applies
+	Routing string `envconfig:"NOTIFICATIONS_ROUTING"`
+
+	// AppTeams maps apps to the teams that own them for the team routes, eg.: my-app=payments,other-app=platform
+	AppTeams string `envconfig:"NOTIFICATIONS_APP_TEAMS"`
+	// TeamsFromCodeOwners takes the team of the apps not in the app teams from the CODEOWNERS file of their repository.
+	// The default owner of the repository is the team, it needs the GitHub application
+	TeamsFromCodeOwners bool `envconfig:"NOTIFICATIONS_TEAMS_FROM_CODEOWNERS"`
+
+	// TemplatesPath is a directory of message templates, that override the messages of their event type, eg.: failure.tmpl
+	TemplatesPath string `envconfig:"NOTIFICATIONS_TEMPLATES_PATH"`
+	// Templates is a YAML map of event types and message templates, it takes precedence over the templates directory
+	Templates string `envconfig:"NOTIFICATIONS_TEMPLATES"`
+
+	// GitProvider is one of github, gitlab, bitbucket, bitbucket-server, gitea. Used to render commit links
+	GitProvider string `envconfig:"NOTIFICATIONS_GIT_PROVIDER"`
+	// GitHost is the host of the git provider, needed for self-hosted installations
+	GitHost string `envconfig:"NOTIFICATIONS_GIT_HOST"`
+	// CommitURLTemplate overrides the commit link format, eg.: https://git.example.com/{repo}/commit/{sha}
+	CommitURLTemplate string `envconfig:"NOTIFICATIONS_COMMIT_URL_TEMPLATE"`
+}
+
+// PagerDuty triggers incidents when deploys to the critical envs fail, or rollbacks happen in them
+type PagerDuty struct {
+	RoutingKey   string `envconfig:"PAGERDUTY_ROUTING_KEY"`
+	CriticalEnvs string `envconfig:"PAGERDUTY_CRITICAL_ENVS"`
+}
+
+// Alerting raises Opsgenie or Grafana OnCall alerts when apps are rolled back, or their deploys fail repeatedly
+type Alerting struct {
+	// Provider is opsgenie or grafana-oncall, alerting is disabled by default
+	Provider                string `envconfig:"ALERTING_PROVIDER"`
+	OpsgenieAPIKey          string `envconfig:"ALERTING_OPSGENIE_API_KEY"`
+	OpsgenieAPIURL          string `envconfig:"ALERTING_OPSGENIE_API_URL"`
+	GrafanaOnCallWebhookURL string `envconfig:"ALERTING_GRAFANA_ONCALL_WEBHOOK_URL"`
+	// Envs is a comma separated list of envs that raise alerts, all envs by default
+	Envs string `envconfig:"ALERTING_ENVS"`
+	// FailureThreshold is the number of consecutive failed deploys of an app in an env that raise an alert
+	FailureThreshold int `envconfig:"ALERTING_FAILURE_THRESHOLD"`
+	// RateLimit is the minimum time between two alerts of an app in an env
+	RateLimit time.Duration `envconfig:"ALERTING_RATE_LIMIT"`
+}
+
+// ChangeManagement records the deploys and rollbacks of the production envs as Jira issues or Statuspage component updates
+type ChangeManagement struct {
+	// Provider is jira or statuspage, change management is disabled by default
+	Provider string `envconfig:"CHANGE_MANAGEMENT_PROVIDER"`
+	// Envs is a comma separated list of the recorded envs, eg.: production
+	Envs string `envconfig:"CHANGE_MANAGEMENT_ENVS"`
+	// Templates is a YAML map of the deploy and rollback templates of the recorded descriptions
+	Templates string `envconfig:"CHANGE_MANAGEMENT_TEMPLATES"`
+
+	// JiraURL is the Jira site, eg. https://example.atlassian.net
+	JiraURL      string `envconfig:"CHANGE_MANAGEMENT_JIRA_URL"`
+	JiraUser     string `envconfig:"CHANGE_MANAGEMENT_JIRA_USER"`
+	JiraAPIToken string `envconfig:"CHANGE_MANAGEMENT_JIRA_API_TOKEN"`
+	// JiraProject is the key of the project that the issues are created in
+	JiraProject string `envconfig:"CHANGE_MANAGEMENT_JIRA_PROJECT"`
+	// JiraIssueType is the type of the created issues, Task by default
+	JiraIssueType string `envconfig:"CHANGE_MANAGEMENT_JIRA_ISSUE_TYPE"`
+
+	StatuspageAPIKey string `envconfig:"CHANGE_MANAGEMENT_STATUSPAGE_API_KEY"`
+	StatuspagePageID string `envconfig:"CHANGE_MANAGEMENT_STATUSPAGE_PAGE_ID"`
+	// StatuspageComponents holds the app=componentID mappings of the updated components
+	StatuspageComponents string `envconfig:"CHANGE_MANAGEMENT_STATUSPAGE_COMPONENTS"`
+}
+
+// DeployHooks holds the env=url mappings of the hooks called around gitops writes
+type DeployHooks struct {
+	PreCommit string `envconfig:"DEPLOY_HOOKS_PRE_COMMIT"`
+	PostPush  string `envconfig:"DEPLOY_HOOKS_POST_PUSH"`
+	Secret    string `envconfig:"DEPLOY_HOOKS_SECRET"`
+}
+
+// VulnerabilityScan configures the image scanner of the envs that have a vulnerability scan policy in the env registry
+type VulnerabilityScan struct {
+	// Scanner is trivy or grype, its CLI must be on the PATH
+	Scanner string `envconfig:"VULNERABILITY_SCANNER"`
+	// Server is the address of a Trivy server, that holds the vulnerability database
+	Server  string        `envconfig:"VULNERABILITY_SCANNER_SERVER"`
+	Timeout time.Duration `envconfig:"VULNERABILITY_SCAN_TIMEOUT"`
+}
+
+// ManifestValidation configures the validation of the rendered manifests of the envs
+// that have a manifest validation policy in the env registry
+type ManifestValidation struct {
+	Timeout time.Duration `envconfig:"MANIFEST_VALIDATION_TIMEOUT"`
+}
+
+// TemplateLimits guard the daemon against manifests that would hang or exhaust it,
+// while their vars are resolved or their chart is templated. Zero values keep the defaults of dx.TemplateLimits
+type TemplateLimits struct {
+	Timeout             time.Duration `envconfig:"TEMPLATE_TIMEOUT"`
+	MaxOutputBytes      int           `envconfig:"TEMPLATE_MAX_OUTPUT_BYTES"`
+	MaxListLength       int           `envconfig:"TEMPLATE_MAX_LIST_LENGTH"`
+	MaxIterations       int           `envconfig:"TEMPLATE_MAX_ITERATIONS"`
+	MaxAbandonedRenders int           `envconfig:"TEMPLATE_MAX_ABANDONED_RENDERS"`
+}
+
+// GitopsChecks makes GimletD wait for the CI checks of the gitops repo on its pushed commits, eg. kubeval or OPA pipelines.
+// Events stay in the checking status until the checks finish, and their deploys fail if the checks fail or time out
+type GitopsChecks struct {
+	Wait         bool          `envconfig:"GITOPS_CHECKS_WAIT"`
+	Timeout      time.Duration `envconfig:"GITOPS_CHECKS_TIMEOUT"`
+	PollInterval time.Duration `envconfig:"GITOPS_CHECKS_POLL_INTERVAL"`
+}
+
+// EventBacklog notifies the operators when the unprocessed events pile up, eg. as the gitops worker silently stopped.
+// The backlog is stuck when it has more events than the threshold, or its oldest event waits longer than the max age
+type EventBacklog struct {
+	Threshold int           `envconfig:"EVENT_BACKLOG_THRESHOLD"`
+	MaxAge    time.Duration `envconfig:"EVENT_BACKLOG_MAX_AGE"`
+}
+
+// GroupSync syncs the teams of a GitHub org into user groups, that RBAC rules can target.
+// The GitHub App needs the members read permission of the org
+type GroupSync struct {
+	Org      string        `envconfig:"GROUP_SYNC_GITHUB_ORG"`
+	Interval time.Duration `envconfig:"GROUP_SYNC_INTERVAL"`
+}
+
+// CORS lets browser based dashboards hosted on other origins call the API, eg. with the tokens of their users
+type CORS struct {
+	// AllowedOrigins is a comma separated list of origins, HOST and http://localhost:8888 by default.
+	// * allows every origin, only without credentials
+	AllowedOrigins string `envconfig:"CORS_ALLOWED_ORIGINS"`
+	// AllowedHeaders is a comma separated list of request headers allowed on top of Accept, Authorization, Content-Type, X-CSRF-Token and X-Correlation-ID
+	AllowedHeaders string `envconfig:"CORS_ALLOWED_HEADERS"`
+	// AllowCredentials lets the browser send cookies to the API, true or false, true by default
+	AllowCredentials string `envconfig:"CORS_ALLOW_CREDENTIALS"`
+}
+
+// OIDC logs in human users with an OpenID Connect provider, eg. dex, Okta or Google.
+// Logins get GimletD tokens that expire after TokenTTL, the static tokens of machine users keep working
+type OIDC struct {
+	Issuer       string `envconfig:"OIDC_ISSUER"`
+	ClientID     string `envconfig:"OIDC_CLIENT_ID"`
+	ClientSecret string `envconfig:"OIDC_CLIENT_SECRET"`
+	// RedirectURL is the callback the provider redirects to after login, <HOST>/auth/oidc/callback by default
+	RedirectURL string `envconfig:"OIDC_REDIRECT_URL"`
+	// Scopes is a comma separated list of requested scopes, openid,email,profile,groups by default
+	Scopes string `envconfig:"OIDC_SCOPES"`
+	// LoginClaim is the ID token claim that the GimletD user is named after, with an sso: prefix
+	LoginClaim string `envconfig:"OIDC_LOGIN_CLAIM"`
+	// GroupsClaim is the ID token claim of the user's groups, RBAC rules that grant the admin role to them make the user admin
+	GroupsClaim string        `envconfig:"OIDC_GROUPS_CLAIM"`
+	TokenTTL    time.Duration `envconfig:"OIDC_TOKEN_TTL"`
+}
+
+// Firehose streams every event state change to an HTTP sink, with at-least-once delivery.
+// Changes are posted in batches, signed with the secret if one is set
+type Firehose struct {
+	URL       string        `envconfig:"FIREHOSE_URL"`
+	Secret    string        `envconfig:"FIREHOSE_SECRET"`
+	Interval  time.Duration `envconfig:"FIREHOSE_INTERVAL"`
+	BatchSize int           `envconfig:"FIREHOSE_BATCH_SIZE"`
+	// Retention prunes the event changes that could not be shipped for this long, or were recorded without a sink
+	Retention time.Duration `envconfig:"FIREHOSE_RETENTION"`
+}
+
+// HelmRender isolates Helm templating into subprocesses of the gimletd binary, one per render,
+// so the memory of the renders is released with the process
+type HelmRender struct {
+	Subprocess  bool `envconfig:"HELM_RENDER_SUBPROCESS"`
+	Concurrency int  `envconfig:"HELM_RENDER_CONCURRENCY"`
+}
+
+// ImageUpdate configures the registry polling of the apps with an image update policy
+type ImageUpdate struct {
+	Interval time.Duration `envconfig:"IMAGE_UPDATE_INTERVAL"`
+	// RegistryCredentials is a comma separated list of host=user:password credentials, eg.: ghcr.io=bot:ghp_xxx
+	RegistryCredentials string `envconfig:"IMAGE_UPDATE_REGISTRY_CREDENTIALS"`
+}
+
+// ArtifactExpiry marks artifacts expired when their images are deleted from the registry, or after the max age.
+// Expired artifacts are not released or rolled back to. The registry is accessed with the image update credentials
+type ArtifactExpiry struct {
+	CheckImages bool          `envconfig:"ARTIFACT_EXPIRY_CHECK_IMAGES"`
+	MaxAge      time.Duration `envconfig:"ARTIFACT_EXPIRY_MAX_AGE"`
+	Interval    time.Duration `envconfig:"ARTIFACT_EXPIRY_INTERVAL"`
+}
+
+// GitopsRemoteCircuit pauses event processing after consecutive failed pushes to the gitops repo,
+// and probes the remote periodically before resuming
+type GitopsRemoteCircuit struct {
+	FailureThreshold int           `envconfig:"GITOPS_PUSH_FAILURE_THRESHOLD"`
+	ProbeInterval    time.Duration `envconfig:"GITOPS_REMOTE_PROBE_INTERVAL"`
+}
+
+// CleanupArchive pushes the last manifests of the deleted apps to archive/<env>/<app>/<time> branches of the gitops repo,
+// so accidentally deleted previews can be restored
+type CleanupArchive struct {
+	Enabled bool `envconfig:"CLEANUP_ARCHIVE"`
+	// Retention is how long the archive branches are kept, 30 days by default
+	Retention time.Duration `envconfig:"CLEANUP_ARCHIVE_RETENTION"`
 }
 
 type Github struct {
-	AppID          string    `envconfig:"GITHUB_APP_ID"`
+	AppID string `envconfig:"GITHUB_APP_ID"`
+	// InstallationID is the default installation of the app.
+	// Optional if the app is installed in a single organization, the installations are discovered.
+	// Repositories of other organizations are accessed with the installation of their owner
 	InstallationID string    `envconfig:"GITHUB_INSTALLATION_ID"`
 	PrivateKey     Multiline `envconfig:"GITHUB_PRIVATE_KEY"`
 	SkipVerify     bool      `envconfig:"GITHUB_SKIP_VERIFY"`
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+)
+
+// ValidationError lists every problem of the configuration, so they can be fixed in one go
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "found %d configuration problem(s):", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  - " + p)
+	}
+	return b.String()
+}
+
+// Validate checks the combinations of settings that would only fail later, at first use.
+// It returns a *ValidationError with all the problems found, nil if there are none
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.oneOf("DATABASE_DRIVER", c.Database.Driver, "sqlite3", "postgres", "mysql", "memory")
+	if c.Database.ReadConfig != "" && (c.Database.Driver == "sqlite3" || c.Database.Driver == "memory") {
+		v.problem(fmt.Sprintf("DATABASE_READ_CONFIG is not supported with the %s DATABASE_DRIVER", c.Database.Driver))
+	}
+
+	v.together("GITOPS_REPO", c.GitopsRepo, "GITOPS_REPO_DEPLOY_KEY_PATH", c.GitopsRepoDeployKeyPath)
+	v.fileExists("GITOPS_REPO_DEPLOY_KEY_PATH", c.GitopsRepoDeployKeyPath)
+	if c.PlatformConfig.Repo != "" {
+		v.required("PLATFORM_CONFIG_REPO_DEPLOY_KEY_PATH", c.PlatformConfig.DeployKeyPath, "PLATFORM_CONFIG_REPO is set")
+		v.fileExists("PLATFORM_CONFIG_REPO_DEPLOY_KEY_PATH", c.PlatformConfig.DeployKeyPath)
+	}
+	v.fileExists("ENVS_CONFIG_PATH", c.EnvsConfigPath)
+
+	v.together("GITHUB_APP_ID", c.Github.AppID, "GITHUB_PRIVATE_KEY", string(c.Github.PrivateKey))
+	if c.Github.InstallationID != "" {
+		v.required("GITHUB_APP_ID", c.Github.AppID, "GITHUB_INSTALLATION_ID is set")
+	}
+
+	if c.GroupSync.Org != "" {
+		v.required("GITHUB_APP_ID", c.Github.AppID, "GROUP_SYNC_GITHUB_ORG is set")
+	}
+	if c.AdminToken != "" && len(c.AdminToken) < 32 {
+		v.problem("ADMIN_TOKEN must be at least 32 characters long")
+	}
+	if c.GitopsChecks.Wait {
+		v.required("GITHUB_APP_ID", c.Github.AppID, "GITOPS_CHECKS_WAIT is set")
+	}
+	if c.Notifications.TeamsFromCodeOwners {
+		v.required("GITHUB_APP_ID", c.Github.AppID, "NOTIFICATIONS_TEAMS_FROM_CODEOWNERS is set")
+	}
+	if c.RBACRules != "" {
+		if _, err := dx.ParseRBACRules(c.RBACRules); err != nil {
+			v.problem("RBAC_RULES is invalid: %s", err)
+		}
+	}
+
+	if c.OIDC.Issuer != "" {
+		v.required("OIDC_CLIENT_ID", c.OIDC.ClientID, "OIDC_ISSUER is set")
+		v.required("OIDC_CLIENT_SECRET", c.OIDC.ClientSecret, "OIDC_ISSUER is set")
+		if c.OIDC.RedirectURL == "" {
+			v.required("HOST", c.Host, "OIDC_ISSUER is set without OIDC_REDIRECT_URL")
+		}
+	}
+	v.url("OIDC_ISSUER", c.OIDC.Issuer)
+	v.url("OIDC_REDIRECT_URL", c.OIDC.RedirectURL)
+
+	v.oneOf("CORS_ALLOW_CREDENTIALS", c.CORS.AllowCredentials, "true", "false")
+	for _, origin := range strings.Split(c.CORS.AllowedOrigins, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "*" && c.CORS.AllowCredentials == "true" {
+			v.problem("CORS_ALLOWED_ORIGINS allows every origin, CORS_ALLOW_CREDENTIALS must be false")
+		} else if origin != "*" && origin != "" {
+			v.url("CORS_ALLOWED_ORIGINS", origin)
+		}
+	}
+
+	v.oneOf("NOTIFICATIONS_PROVIDER", c.Notifications.Provider, "", "slack")
+	if c.Notifications.Provider == "slack" {
+		v.required("NOTIFICATIONS_TOKEN", c.Notifications.Token, "NOTIFICATIONS_PROVIDER is slack")
+	}
+	v.mapping("NOTIFICATIONS_CHANNEL_MAPPING", c.Notifications.ChannelMapping)
+	v.mapping("NOTIFICATIONS_APP_TEAMS", c.Notifications.AppTeams)
+	v.fileExists("NOTIFICATIONS_TEMPLATES_PATH", c.Notifications.TemplatesPath)
+	if c.PagerDuty.CriticalEnvs != "" {
+		v.required("PAGERDUTY_ROUTING_KEY", c.PagerDuty.RoutingKey, "PAGERDUTY_CRITICAL_ENVS is set")
+	}
+	v.oneOf("ALERTING_PROVIDER", c.Alerting.Provider, "", "opsgenie", "grafana-oncall")
+	switch c.Alerting.Provider {
+	case "opsgenie":
+		v.required("ALERTING_OPSGENIE_API_KEY", c.Alerting.OpsgenieAPIKey, "ALERTING_PROVIDER is opsgenie")
+		v.url("ALERTING_OPSGENIE_API_URL", c.Alerting.OpsgenieAPIURL)
+	case "grafana-oncall":
+		v.required("ALERTING_GRAFANA_ONCALL_WEBHOOK_URL", c.Alerting.GrafanaOnCallWebhookURL, "ALERTING_PROVIDER is grafana-oncall")
+		v.url("ALERTING_GRAFANA_ONCALL_WEBHOOK_URL", c.Alerting.GrafanaOnCallWebhookURL)
+	}
+
+	v.oneOf("CHANGE_MANAGEMENT_PROVIDER", c.ChangeManagement.Provider, "", "jira", "statuspage")
+	if c.ChangeManagement.Provider != "" {
+		v.required("CHANGE_MANAGEMENT_ENVS", c.ChangeManagement.Envs, "CHANGE_MANAGEMENT_PROVIDER is set")
+	}
+	switch c.ChangeManagement.Provider {
+	case "jira":
+		v.required("CHANGE_MANAGEMENT_JIRA_URL", c.ChangeManagement.JiraURL, "CHANGE_MANAGEMENT_PROVIDER is jira")
+		v.url("CHANGE_MANAGEMENT_JIRA_URL", c.ChangeManagement.JiraURL)
+		v.required("CHANGE_MANAGEMENT_JIRA_USER", c.ChangeManagement.JiraUser, "CHANGE_MANAGEMENT_PROVIDER is jira")
+		v.required("CHANGE_MANAGEMENT_JIRA_API_TOKEN", c.ChangeManagement.JiraAPIToken, "CHANGE_MANAGEMENT_PROVIDER is jira")
+		v.required("CHANGE_MANAGEMENT_JIRA_PROJECT", c.ChangeManagement.JiraProject, "CHANGE_MANAGEMENT_PROVIDER is jira")
+	case "statuspage":
+		v.required("CHANGE_MANAGEMENT_STATUSPAGE_API_KEY", c.ChangeManagement.StatuspageAPIKey, "CHANGE_MANAGEMENT_PROVIDER is statuspage")
+		v.required("CHANGE_MANAGEMENT_STATUSPAGE_PAGE_ID", c.ChangeManagement.StatuspagePageID, "CHANGE_MANAGEMENT_PROVIDER is statuspage")
+		v.required("CHANGE_MANAGEMENT_STATUSPAGE_COMPONENTS", c.ChangeManagement.StatuspageComponents, "CHANGE_MANAGEMENT_PROVIDER is statuspage")
+		v.mapping("CHANGE_MANAGEMENT_STATUSPAGE_COMPONENTS", c.ChangeManagement.StatuspageComponents)
+	}
+
+	v.mapping("DEPLOY_HOOKS_PRE_COMMIT", c.DeployHooks.PreCommit)
+	v.mapping("DEPLOY_HOOKS_POST_PUSH", c.DeployHooks.PostPush)
+	v.mapping("IMAGE_UPDATE_REGISTRY_CREDENTIALS", c.ImageUpdate.RegistryCredentials)
+
+	v.together("TLS_CERT_PATH", c.TLS.CertPath, "TLS_KEY_PATH", c.TLS.KeyPath)
+	if c.TLS.ClientCAPath != "" {
+		v.required("TLS_CERT_PATH", c.TLS.CertPath, "TLS_CLIENT_CA_PATH is set")
+	}
+	v.fileExists("TLS_CERT_PATH", c.TLS.CertPath)
+	v.fileExists("TLS_KEY_PATH", c.TLS.KeyPath)
+	v.fileExists("TLS_CLIENT_CA_PATH", c.TLS.ClientCAPath)
+
+	if c.ArtifactSigning.ProtectedEnvs != "" {
+		v.required("ARTIFACT_SIGNING_PUBLIC_KEYS_PATH", c.ArtifactSigning.PublicKeysPath, "ARTIFACT_SIGNING_PROTECTED_ENVS is set")
+	}
+	v.fileExists("ARTIFACT_SIGNING_PUBLIC_KEYS_PATH", c.ArtifactSigning.PublicKeysPath)
+
+	v.oneOf("VULNERABILITY_SCANNER", c.VulnerabilityScan.Scanner, "", "trivy", "grype")
+	if c.VulnerabilityScan.Server != "" {
+		v.required("VULNERABILITY_SCANNER", c.VulnerabilityScan.Scanner, "VULNERABILITY_SCANNER_SERVER is set")
+	}
+
+	v.oneOf("BRANCH_DELETE_CLONE_MODE", c.BranchDeleteCloneMode, "full", "shallow")
+	v.oneOf("RELEASE_STATS", c.ReleaseStats, "enabled", "disabled")
+	if c.ReleaseStats == "enabled" {
+		v.required("GITOPS_REPO", c.GitopsRepo, "RELEASE_STATS is enabled")
+	}
+
+	if c.HelmRender.Concurrency < 0 {
+		v.problem("HELM_RENDER_CONCURRENCY must be positive, got %d", c.HelmRender.Concurrency)
+	}
+
+	if c.ArtifactExpiry.MaxAge < 0 {
+		v.problem("ARTIFACT_EXPIRY_MAX_AGE must be positive, got %s", c.ArtifactExpiry.MaxAge)
+	}
+
+	v.url("FIREHOSE_URL", c.Firehose.URL)
+	if c.Firehose.Secret != "" {
+		v.required("FIREHOSE_URL", c.Firehose.URL, "FIREHOSE_SECRET is set")
+	}
+	if c.Firehose.BatchSize < 0 {
+		v.problem("FIREHOSE_BATCH_SIZE must be positive, got %d", c.Firehose.BatchSize)
+	}
+
+	for _, cidr := range strings.Split(c.AllowedCIDRs, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			v.problem("API_ALLOWED_CIDRS has an invalid network %q, use the 10.0.0.0/8 format", cidr)
+		}
+	}
+
+	if _, err := model.ParseRepoAllowlist(c.ArtifactRepoAllowlist); err != nil {
+		v.problem("ARTIFACT_REPO_ALLOWLIST has an invalid entry: %s", err)
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) problem(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(name string, value string, reason string) {
+	if value == "" {
+		v.problem("%s must be set, as %s", name, reason)
+	}
+}
+
+// together checks that two settings are either both set, or none of them
+func (v *validator) together(name string, value string, otherName string, otherValue string) {
+	if value != "" && otherValue == "" {
+		v.problem("%s must be set, as %s is set", otherName, name)
+	}
+	if value == "" && otherValue != "" {
+		v.problem("%s must be set, as %s is set", name, otherName)
+	}
+}
+
+func (v *validator) oneOf(name string, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	var options []string
+	for _, a := range allowed {
+		if a != "" {
+			options = append(options, a)
+		}
+	}
+	v.problem("%s is %q, it must be one of %s", name, value, strings.Join(options, ", "))
+}
+
+func (v *validator) fileExists(name string, path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		v.problem("%s points to %s, that cannot be read: %s", name, path, err)
+	}
+}
+
+// mapping checks the key1=value1,key2=value2 format
+func (v *validator) mapping(name string, mapping string) {
+	if mapping == "" {
+		return
+	}
+	for _, pair := range strings.Split(mapping, ",") {
+		keyValue := strings.SplitN(pair, "=", 2)
+		if len(keyValue) != 2 || keyValue[0] == "" {
+			v.problem("%s has an invalid entry %q, use the key1=value1,key2=value2 format", name, pair)
+		}
+	}
+}
+
+func (v *validator) url(name string, value string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		v.problem("%s is %q, it must be an absolute URL", name, value)
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validate(t *testing.T) {
+	c := &Config{}
+	defaults(c)
+	assert.Nil(t, c.Validate(), "the defaults should be valid")
+
+	c.Notifications.Provider = "slack"
+	c.GitopsRepo = "gimlet-io/gitops"
+	c.Github.AppID = "123"
+	c.AllowedCIDRs = "10.0.0.0/8,10.0.0.1"
+	c.ArtifactRepoAllowlist = "my-org/my-app:my-app-ci,my-org/team-*"
+	err := c.Validate()
+	assert.NotNil(t, err)
+	problems := err.(*ValidationError).Problems
+	assert.Equal(t, []string{
+		"GITOPS_REPO_DEPLOY_KEY_PATH must be set, as GITOPS_REPO is set",
+		"GITHUB_PRIVATE_KEY must be set, as GITHUB_APP_ID is set",
+		"NOTIFICATIONS_TOKEN must be set, as NOTIFICATIONS_PROVIDER is slack",
+		"API_ALLOWED_CIDRS has an invalid network \"10.0.0.1\", use the 10.0.0.0/8 format",
+		"ARTIFACT_REPO_ALLOWLIST has an invalid entry: \"my-org/team-*\" is not in the repository:login format",
+	}, problems, "should report every problem at once")
+	assert.Contains(t, err.Error(), "found 5 configuration problem(s)")
+}
+
+func Test_validateFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gimletd-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	deployKeyPath := filepath.Join(dir, "deploy.key")
+	err = ioutil.WriteFile(deployKeyPath, []byte("key"), 0600)
+	assert.Nil(t, err)
+
+	c := &Config{
+		GitopsRepo:              "gimlet-io/gitops",
+		GitopsRepoDeployKeyPath: deployKeyPath,
+		DeployHooks:             DeployHooks{PreCommit: "production=https://hooks.example.com"},
+	}
+	defaults(c)
+	assert.Nil(t, c.Validate())
+
+	c.GitopsRepoDeployKeyPath = filepath.Join(dir, "missing.key")
+	c.DeployHooks.PreCommit = "production"
+	err = c.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "GITOPS_REPO_DEPLOY_KEY_PATH points to")
+	assert.Contains(t, err.Error(), "DEPLOY_HOOKS_PRE_COMMIT has an invalid entry \"production\"")
+}
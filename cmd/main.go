@@ -1,23 +1,35 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"encoding/base32"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/dx/helm"
+	"github.com/gimlet-io/gimletd/firehose"
 	"github.com/gimlet-io/gimletd/git/customScm"
 	"github.com/gimlet-io/gimletd/git/customScm/customGithub"
 	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/hooks"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/registry"
+	"github.com/gimlet-io/gimletd/scanner"
 	"github.com/gimlet-io/gimletd/server"
 	"github.com/gimlet-io/gimletd/server/token"
 	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/validation"
 	"github.com/gimlet-io/gimletd/worker"
 	"github.com/go-chi/chi"
 	"github.com/gorilla/securecookie"
@@ -27,6 +39,15 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == helm.TemplateSubcommand {
+		err := helm.ServeTemplate(os.Stdin, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	err := godotenv.Load(".env")
 	if err != nil {
 		logrus.Warnf("could not load .env file, relying on env vars")
@@ -40,6 +61,11 @@ func main() {
 
 	initLogging(config)
 
+	err = config.Validate()
+	if err != nil {
+		logrus.Fatalf("main: invalid configuration, %s", err)
+	}
+
 	if logrus.IsLevelEnabled(logrus.TraceLevel) {
 		fmt.Println(config.String())
 	}
@@ -61,12 +87,84 @@ func main() {
 		logrus.Warnf("Please set Github Application based access for features like deleted branch detection and commit status pushing")
 	}
 
+	err = notifications.SetGitProvider(
+		config.Notifications.GitProvider,
+		config.Notifications.GitHost,
+		config.Notifications.CommitURLTemplate,
+	)
+	if err != nil {
+		logrus.Fatalf("invalid notifications config: %s", err)
+	}
+
+	var envs map[string]*dx.Env
+	if config.EnvsConfigPath != "" {
+		envs, err = dx.LoadEnvs(config.EnvsConfigPath)
+		if err != nil {
+			logrus.Fatalf("invalid env registry: %s", err)
+		}
+	}
+
+	nativeGit.DisableSubmodules(config.DisableGitSubmodules)
+	dx.SetTemplateLimits(dx.TemplateLimits{
+		Timeout:             config.TemplateLimits.Timeout,
+		MaxOutputBytes:      config.TemplateLimits.MaxOutputBytes,
+		MaxListLength:       config.TemplateLimits.MaxListLength,
+		MaxIterations:       config.TemplateLimits.MaxIterations,
+		MaxAbandonedRenders: config.TemplateLimits.MaxAbandonedRenders,
+	})
+	if config.HelmRender.Subprocess {
+		executable, err := os.Executable()
+		if err != nil {
+			logrus.Fatalf("cannot locate the gimletd binary for the helm render subprocesses: %s", err)
+		}
+		helm.SetRenderPool(helm.NewRenderPool(
+			executable,
+			config.HelmRender.Concurrency,
+			helmRenders,
+			helmRendersInFlight,
+		))
+	}
+
 	notificationsManager := notifications.NewManager()
 	if config.Notifications.Provider == "slack" {
-		notificationsManager.AddProvider(slackNotificationProvider(config))
+		slackProvider, err := slackNotificationProvider(config, tokenManager)
+		if err != nil {
+			logrus.Fatalf("invalid notifications config: %s", err)
+		}
+		notificationsManager.AddProvider(slackProvider)
+	}
+	if config.PagerDuty.RoutingKey != "" {
+		notificationsManager.AddProvider(notifications.NewPagerDutyProvider(
+			config.PagerDuty.RoutingKey,
+			parseList(config.PagerDuty.CriticalEnvs),
+		))
+	}
+	switch config.Alerting.Provider {
+	case "opsgenie":
+		notificationsManager.AddProvider(notifications.NewOpsgenieProvider(
+			config.Alerting.OpsgenieAPIKey,
+			config.Alerting.OpsgenieAPIURL,
+			parseList(config.Alerting.Envs),
+			config.Alerting.FailureThreshold,
+			config.Alerting.RateLimit,
+		))
+	case "grafana-oncall":
+		notificationsManager.AddProvider(notifications.NewGrafanaOnCallProvider(
+			config.Alerting.GrafanaOnCallWebhookURL,
+			parseList(config.Alerting.Envs),
+			config.Alerting.FailureThreshold,
+			config.Alerting.RateLimit,
+		))
+	}
+	if config.ChangeManagement.Provider != "" {
+		changeManagementProvider, err := changeManagementProvider(config)
+		if err != nil {
+			logrus.Fatalf("invalid change management config: %s", err)
+		}
+		notificationsManager.AddProvider(changeManagementProvider)
 	}
 	if tokenManager != nil {
-		notificationsManager.AddProvider(notifications.NewGithubProvider(tokenManager))
+		notificationsManager.AddProvider(notifications.NewGithubProvider(tokenManager, envs))
 	}
 	go notificationsManager.Run()
 
@@ -77,16 +175,59 @@ func main() {
 		config.RepoCachePath,
 		config.GitopsRepo,
 		config.GitopsRepoDeployKeyPath,
+		config.GitopsRepoDefaultBranch,
+		envs,
+		config.RepoCacheRefreshInterval,
 		stopCh,
 	)
 	if err != nil {
 		panic(err)
 	}
+	repoCache.OnHistoryRewrite(func(rewrite *dx.GitopsHistoryRewrite) {
+		err := store.SaveGitopsHistoryRewrite(rewrite)
+		if err != nil {
+			logrus.Errorf("cannot save gitops history rewrite: %s", err)
+		}
+		notificationsManager.Broadcast(notifications.NewGitopsHistoryMessage(config.GitopsRepo, rewrite))
+	})
 	go repoCache.Run()
 	logrus.Info("repo cache initialized")
 
+	var platformConfig *nativeGit.PlatformConfig
+	if config.PlatformConfig.Repo != "" {
+		platformConfig, err = nativeGit.NewPlatformConfig(
+			config.RepoCachePath,
+			config.PlatformConfig.Repo,
+			config.PlatformConfig.DeployKeyPath,
+			config.PlatformConfig.DefaultBranch,
+			config.RepoCacheRefreshInterval,
+			stopCh,
+		)
+		if err != nil {
+			panic(err)
+		}
+		go platformConfig.Run()
+		logrus.Info("platform config initialized")
+	}
+
+	var imageScanner *scanner.Scanner
+	if config.VulnerabilityScan.Scanner != "" {
+		imageScanner, err = scanner.New(
+			config.VulnerabilityScan.Scanner,
+			config.VulnerabilityScan.Server,
+			config.VulnerabilityScan.Timeout,
+		)
+		if err != nil {
+			logrus.Fatalf("invalid vulnerability scan config: %s", err)
+		}
+	}
+
 	if config.GitopsRepo != "" &&
 		config.GitopsRepoDeployKeyPath != "" {
+		var cleanupArchive *worker.CleanupArchive
+		if config.CleanupArchive.Enabled {
+			cleanupArchive = worker.NewCleanupArchive(config.CleanupArchive.Retention)
+		}
 		gitopsWorker := worker.NewGitopsWorker(
 			store,
 			config.GitopsRepo,
@@ -95,9 +236,86 @@ func main() {
 			notificationsManager,
 			eventsProcessed,
 			repoCache,
+			config.RollbackProtectionWindow,
+			hooks.NewDeployHooks(
+				parseMapping(config.DeployHooks.PreCommit),
+				parseMapping(config.DeployHooks.PostPush),
+				config.DeployHooks.Secret,
+			),
+			helm.NewChartCache(
+				filepath.Join(config.RepoCachePath, "charts"),
+				config.ChartCacheRefreshInterval,
+			),
+			platformConfig,
+			imageScanner,
+			validation.New(config.ManifestValidation.Timeout),
+			parseList(config.ArtifactSigning.ProtectedEnvs),
+			envs,
+			worker.NewRemoteCircuit(
+				config.GitopsRemoteCircuit.FailureThreshold,
+				config.GitopsRemoteCircuit.ProbeInterval,
+				func() error {
+					return nativeGit.ProbeRemote(config.GitopsRepo, config.GitopsRepoDeployKeyPath)
+				},
+				gitopsRemoteCircuitOpen,
+			),
+			config.GitopsChecks.Wait,
+			cleanupArchive,
 		)
 		go gitopsWorker.Run()
 		logrus.Info("Gitops worker started")
+
+		if config.GitopsChecks.Wait {
+			gitopsChecksWorker := worker.NewGitopsChecksWorker(
+				store,
+				config.GitopsRepo,
+				customGithub.NewCommitChecks(tokenManager),
+				notificationsManager,
+				config.GitopsChecks.Timeout,
+				config.GitopsChecks.PollInterval,
+			)
+			go gitopsChecksWorker.Run()
+		}
+
+		eventWatchdog := worker.NewEventWatchdog(
+			store,
+			config.StuckEventThreshold,
+			stuckEvents,
+			notificationsManager,
+			config.EventBacklog.Threshold,
+			config.EventBacklog.MaxAge,
+			eventBacklog,
+			eventBacklogStuck,
+		)
+		go eventWatchdog.Run()
+
+		artifactRepoAllowlist, err := model.ParseRepoAllowlist(config.ArtifactRepoAllowlist)
+		if err != nil {
+			logrus.Fatalf("invalid artifact repo allowlist: %s", err)
+		}
+		imageUpdateWorker := worker.NewImageUpdateWorker(
+			store,
+			registry.NewClient(parseMapping(config.ImageUpdate.RegistryCredentials)),
+			config.ImageUpdate.Interval,
+			artifactRepoAllowlist,
+			config.RollbackProtectionWindow,
+			envs,
+		)
+		go imageUpdateWorker.Run()
+
+		if config.ArtifactExpiry.CheckImages || config.ArtifactExpiry.MaxAge != 0 {
+			var imageRegistry worker.ImageRegistry
+			if config.ArtifactExpiry.CheckImages {
+				imageRegistry = registry.NewClient(parseMapping(config.ImageUpdate.RegistryCredentials))
+			}
+			artifactExpiryWorker := worker.NewArtifactExpiryWorker(
+				store,
+				imageRegistry,
+				config.ArtifactExpiry.MaxAge,
+				config.ArtifactExpiry.Interval,
+			)
+			go artifactExpiryWorker.Run()
+		}
 	} else {
 		logrus.Warn("Not starting GitOps worker. GITOPS_REPO and GITOPS_REPO_DEPLOY_KEY_PATH must be set to start GitOps worker")
 	}
@@ -106,21 +324,71 @@ func main() {
 		releaseStateWorker := &worker.ReleaseStateWorker{
 			GitopsRepo: config.GitopsRepo,
 			RepoCache:  repoCache,
+			Store:      store,
+			Envs:       parseList(config.ReleaseStatsEnvs),
+			Interval:   config.ReleaseStatsInterval,
 			Releases:   releases,
 			Perf:       perf,
 		}
 		go releaseStateWorker.Run()
 	}
 
+	eventPartitionWorker := worker.NewEventPartitionWorker(store, config.EventsRetention, config.Firehose.Retention)
+	go eventPartitionWorker.Run()
+
+	blobCompressionWorker := worker.NewBlobCompressionWorker(store)
+	go blobCompressionWorker.Run()
+
+	if config.Firehose.URL != "" {
+		firehoseWorker := worker.NewFirehoseWorker(
+			store,
+			firehose.NewHTTPSink(config.Firehose.URL, config.Firehose.Secret),
+			config.Firehose.Interval,
+			config.Firehose.BatchSize,
+		)
+		go firehoseWorker.Run()
+		logrus.Info("Event firehose started")
+	}
+
+	doraMetricsWorker := &worker.DoraMetricsWorker{
+		Store:               store,
+		Window:              config.DoraMetricsWindow,
+		DeploymentFrequency: doraDeploymentFrequency,
+		LeadTime:            doraLeadTime,
+		ChangeFailureRate:   doraChangeFailureRate,
+		MTTR:                doraMTTR,
+	}
+	go doraMetricsWorker.Run()
+
+	driftReportWorker := &worker.DriftReportWorker{
+		Store:       store,
+		RepoCache:   repoCache,
+		EnvRegistry: envs,
+		Envs:        parseList(config.DriftReportEnvs),
+		Drift:       configDrift,
+		Perf:        perf,
+	}
+	go driftReportWorker.Run()
+
 	if tokenManager != nil {
 		branchDeleteEventWorker := worker.NewBranchDeleteEventWorker(
 			tokenManager,
 			config.RepoCachePath,
 			store,
+			config.BranchDeleteCloneMode == "shallow",
 		)
 		go branchDeleteEventWorker.Run()
 	}
 
+	if tokenManager != nil && config.GroupSync.Org != "" {
+		groupSyncWorker := worker.NewGroupSyncWorker(
+			store,
+			customGithub.NewOrgTeams(tokenManager, config.GroupSync.Org),
+			config.GroupSync.Interval,
+		)
+		go groupSyncWorker.Run()
+	}
+
 	metricsRouter := chi.NewRouter()
 	metricsRouter.Get("/metrics", promhttp.Handler().ServeHTTP)
 	go http.ListenAndServe(":8889", metricsRouter)
@@ -129,27 +397,134 @@ func main() {
 		log.Println(http.ListenAndServe("localhost:6060", nil))
 	}()
 
+	if tokenManager != nil && config.GitopsRepo != "" {
+		server.SetDeployKeyUploader(customGithub.NewDeployKeys(tokenManager, config.GitopsRepo))
+	}
 	r := server.SetupRouter(config, store, notificationsManager, repoCache, perf)
-	err = http.ListenAndServe(":8888", r)
+	if config.TLS.CertPath != "" {
+		tlsConfig, err := serverTLSConfig(config)
+		if err != nil {
+			panic(err)
+		}
+		apiServer := &http.Server{Addr: ":8888", Handler: r, TLSConfig: tlsConfig}
+		err = apiServer.ListenAndServeTLS(config.TLS.CertPath, config.TLS.KeyPath)
+	} else {
+		err = http.ListenAndServe(":8888", r)
+	}
 	if err != nil {
 		panic(err)
 	}
 }
 
-func slackNotificationProvider(config *config.Config) *notifications.SlackProvider {
-	channelMap := map[string]string{}
-	if config.Notifications.ChannelMapping != "" {
-		pairs := strings.Split(config.Notifications.ChannelMapping, ",")
-		for _, p := range pairs {
-			keyValue := strings.Split(p, "=")
-			channelMap[keyValue[0]] = keyValue[1]
+// serverTLSConfig verifies the client certificates against the configured client CA, if there is one.
+// The certificates are not required on the listener, as the webhooks of third parties can't present one,
+// the authenticated API routes require them, see server.SetupRouter
+func serverTLSConfig(config *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.TLS.ClientCAPath == "" {
+		return tlsConfig, nil
+	}
+
+	caBytes, err := ioutil.ReadFile(config.TLS.ClientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read client CA: %s", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caBytes) {
+		return nil, fmt.Errorf("no certificates found in client CA %s", config.TLS.ClientCAPath)
+	}
+
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+func slackNotificationProvider(config *config.Config, tokenManager customScm.NonImpersonatedTokenManager) (*notifications.SlackProvider, error) {
+	routing, err := notifications.ParseRouting(config.Notifications.Routing)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := notifications.Templates{}
+	if config.Notifications.TemplatesPath != "" {
+		templates, err = notifications.LoadTemplates(config.Notifications.TemplatesPath)
+		if err != nil {
+			return nil, err
 		}
 	}
+	inlineTemplates, err := notifications.ParseTemplates(config.Notifications.Templates)
+	if err != nil {
+		return nil, err
+	}
+	templates = templates.Merge(inlineTemplates)
+
+	var codeOwnersTokenManager customScm.NonImpersonatedTokenManager
+	if config.Notifications.TeamsFromCodeOwners {
+		codeOwnersTokenManager = tokenManager
+	}
+
 	return &notifications.SlackProvider{
 		Token:          config.Notifications.Token,
-		ChannelMapping: channelMap,
+		ChannelMapping: parseMapping(config.Notifications.ChannelMapping),
 		DefaultChannel: config.Notifications.DefaultChannel,
+		Routing:        routing,
+		Teams:          notifications.NewTeams(parseMapping(config.Notifications.AppTeams), codeOwnersTokenManager),
+		Templates:      templates,
+	}, nil
+}
+
+func changeManagementProvider(config *config.Config) (*notifications.ChangeManagementProvider, error) {
+	templates, err := notifications.ParseTemplates(config.ChangeManagement.Templates)
+	if err != nil {
+		return nil, err
 	}
+
+	envs := parseList(config.ChangeManagement.Envs)
+	if config.ChangeManagement.Provider == "jira" {
+		return notifications.NewJiraProvider(
+			config.ChangeManagement.JiraURL,
+			config.ChangeManagement.JiraUser,
+			config.ChangeManagement.JiraAPIToken,
+			config.ChangeManagement.JiraProject,
+			config.ChangeManagement.JiraIssueType,
+			envs,
+			templates,
+		), nil
+	}
+	return notifications.NewStatuspageProvider(
+		config.ChangeManagement.StatuspageAPIKey,
+		config.ChangeManagement.StatuspagePageID,
+		parseMapping(config.ChangeManagement.StatuspageComponents),
+		envs,
+		templates,
+	), nil
+}
+
+// parseMapping parses the key1=value1,key2=value2 format
+func parseMapping(mapping string) map[string]string {
+	m := map[string]string{}
+	if mapping != "" {
+		pairs := strings.Split(mapping, ",")
+		for _, p := range pairs {
+			keyValue := strings.SplitN(p, "=", 2)
+			if len(keyValue) != 2 {
+				continue
+			}
+			m[keyValue[0]] = keyValue[1]
+		}
+	}
+	return m
+}
+
+// parseList parses the value1,value2 format
+func parseList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
 }
 
 // helper function configures the logging.
@@ -188,9 +563,13 @@ func setupAdminUser(config *config.Config, store *store.Store) error {
 		if err != nil {
 			return fmt.Errorf("couldn't create user admin user %s", err)
 		}
-		err = printAdminToken(admin)
-		if err != nil {
-			return err
+		if config.AdminToken != "" {
+			logrus.Infof("Admin user created, it authenticates with the ADMIN_TOKEN")
+		} else {
+			err = printAdminToken(admin)
+			if err != nil {
+				return err
+			}
 		}
 	} else if err != nil {
 		return fmt.Errorf("couldn't list users to create admin user %s", err)
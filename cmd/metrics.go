@@ -16,6 +16,61 @@ var (
 		Help: "Release status",
 	}, []string{"env", "app", "sourceCommit", "commitMessage", "gitopsCommit", "gitopsCommitCreated"})
 
+	stuckEvents = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gimletd_stuck_events",
+		Help: "The number of events stuck in processing",
+	})
+
+	eventBacklog = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gimletd_event_backlog",
+		Help: "The number of events waiting to be processed",
+	})
+
+	eventBacklogStuck = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gimletd_event_backlog_stuck",
+		Help: "1 if the unprocessed events exceed the backlog threshold or max age",
+	})
+
+	gitopsRemoteCircuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gimletd_gitops_remote_circuit_open",
+		Help: "1 if event processing is paused as pushes to the gitops repo keep failing",
+	})
+
+	doraDeploymentFrequency = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gimletd_dora_deployment_frequency",
+		Help: "Average number of deploys per day in the DORA metrics window",
+	})
+
+	doraLeadTime = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gimletd_dora_lead_time_seconds",
+		Help: "Median time from artifact creation to the gitops commit applied",
+	})
+
+	doraChangeFailureRate = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gimletd_dora_change_failure_rate",
+		Help: "Ratio of rollbacks to deploys in the DORA metrics window",
+	})
+
+	doraMTTR = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gimletd_dora_mttr_seconds",
+		Help: "Mean time from a deploy to the rollback that restored the env",
+	})
+
+	configDrift = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gimletd_config_drift",
+		Help: "Number of chart and value settings of an app that differ across envs",
+	}, []string{"app"})
+
+	helmRenders = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "gimletd_helm_render_seconds",
+		Help: "Duration of the Helm renders in subprocesses, by outcome",
+	}, []string{"outcome"})
+
+	helmRendersInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gimletd_helm_renders_in_flight",
+		Help: "The number of Helm render subprocesses running",
+	})
+
 	perf = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name: "gimletd_perf",
 		Help: "Performance of functions",
@@ -0,0 +1,37 @@
+// Command migrate rolls back the GimletD database schema to a given migration version.
+// It uses the same DATABASE_DRIVER and DATABASE_CONFIG settings as GimletD
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	version := flag.Int("down", -1, "the migration version to roll back to")
+	flag.Parse()
+
+	if *version < 0 {
+		fmt.Fprintln(os.Stderr, "usage: migrate -down <version>")
+		os.Exit(2)
+	}
+
+	godotenv.Load(".env")
+	config, err := config.Environ()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %s\n", err)
+		os.Exit(1)
+	}
+
+	err = store.MigrateDown(config.Database.Driver, config.Database.Config, *version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot roll back migrations: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("database rolled back to migration version %d\n", *version)
+}
@@ -0,0 +1,31 @@
+// Command openapi writes the OpenAPI document of the GimletD API
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/server"
+)
+
+func main() {
+	router := server.SetupRouter(&config.Config{PublicEndpoints: true}, nil, nil, nil, nil)
+	spec, err := server.OpenAPISpec(router)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot generate openapi spec: %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Println(string(spec))
+		return
+	}
+
+	err = ioutil.WriteFile(os.Args[1], append(spec, '\n'), 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot write openapi spec: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,150 @@
+package dora
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+)
+
+// Compute calculates the DORA metrics from the events stored in the given time window.
+// Deploys are the processed artifact and release events that wrote to the gitops repo
+func Compute(store *store.Store, since, until time.Time) (*dx.DoraMetrics, error) {
+	events, err := store.DeployEvents(since, until)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get deploy events: %s", err)
+	}
+
+	metrics := &dx.DoraMetrics{
+		Since: since.Unix(),
+		Until: until.Unix(),
+	}
+
+	var deploys []*model.Event
+	var deployLeadTimes []float64
+	var restoreTimes []float64
+	for _, event := range events {
+		switch event.Type {
+		case model.TypeArtifact, model.TypeRelease, model.TypeReevaluation:
+			if len(event.GitopsHashes) == 0 {
+				continue // nothing was deployed
+			}
+			deploys = append(deploys, event)
+
+			eventLeadTimes, err := leadTimes(store, event)
+			if err != nil {
+				return nil, err
+			}
+			deployLeadTimes = append(deployLeadTimes, eventLeadTimes...)
+		case model.TypeRollback:
+			metrics.Rollbacks++
+
+			var rollbackRequest dx.RollbackRequest
+			err := json.Unmarshal([]byte(event.Blob), &rollbackRequest)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse rollback request: %s", err)
+			}
+			if deploy := lastDeployTo(deploys, rollbackRequest.Env); deploy != nil {
+				restoreTimes = append(restoreTimes, float64(event.Created-deploy.Created))
+			}
+		}
+	}
+
+	metrics.Deploys = len(deploys)
+	days := until.Sub(since).Hours() / 24
+	if days > 0 {
+		metrics.DeploymentFrequency = float64(metrics.Deploys) / days
+	}
+	if metrics.Deploys > 0 {
+		metrics.ChangeFailureRate = float64(metrics.Rollbacks) / float64(metrics.Deploys)
+	}
+	metrics.LeadTimeSeconds = median(deployLeadTimes)
+	metrics.MTTRSeconds = mean(restoreTimes)
+
+	return metrics, nil
+}
+
+// leadTimes returns the time from artifact creation to the successful Flux reconciliation,
+// for every gitops commit of the deploy event
+func leadTimes(store *store.Store, event *model.Event) ([]float64, error) {
+	artifactCreated, err := artifactCreated(store, event)
+	if err != nil {
+		return nil, err
+	}
+	if artifactCreated == 0 {
+		return nil, nil
+	}
+
+	var leadTimes []float64
+	for _, sha := range event.GitopsHashes {
+		gitopsCommit, err := store.GitopsCommit(sha)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get gitops commit: %s", err)
+		}
+		if gitopsCommit == nil ||
+			gitopsCommit.Status != model.ReconciliationSucceeded ||
+			gitopsCommit.Created == 0 {
+			continue // not applied (yet)
+		}
+		leadTimes = append(leadTimes, float64(gitopsCommit.Created-artifactCreated))
+	}
+
+	return leadTimes, nil
+}
+
+func artifactCreated(store *store.Store, event *model.Event) (int64, error) {
+	if event.Type == model.TypeArtifact {
+		return event.Created, nil
+	}
+
+	var releaseRequest dx.ReleaseRequest
+	err := json.Unmarshal([]byte(event.Blob), &releaseRequest)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse release request: %s", err)
+	}
+	artifactEvent, err := store.Artifact(releaseRequest.ArtifactID)
+	if err != nil {
+		return 0, nil // the artifact may have been deleted since
+	}
+	return artifactEvent.Created, nil
+}
+
+func lastDeployTo(deploys []*model.Event, env string) *model.Event {
+	for i := len(deploys) - 1; i >= 0; i-- {
+		for _, triggeredEnv := range deploys[i].TriggeredEnvs {
+			if triggeredEnv == env {
+				return deploys[i]
+			}
+		}
+	}
+	return nil
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
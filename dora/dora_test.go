@@ -0,0 +1,63 @@
+package dora
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_compute(t *testing.T) {
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	now := time.Now()
+
+	deploy, err := s.CreateEvent(&model.Event{Type: model.TypeArtifact, Blob: "{}"})
+	assert.Nil(t, err)
+	err = s.UpdateEventStatus(deploy.ID, model.StatusProcessed, "", `["abc"]`, `["staging"]`, "[]")
+	assert.Nil(t, err)
+	err = s.SaveOrUpdateGitopsCommit(&model.GitopsCommit{
+		Sha:     "abc",
+		Status:  model.ReconciliationSucceeded,
+		Created: now.Add(10 * time.Minute).Unix(),
+	})
+	assert.Nil(t, err)
+
+	noop, err := s.CreateEvent(&model.Event{Type: model.TypeArtifact, Blob: "{}"})
+	assert.Nil(t, err)
+	err = s.UpdateEventStatus(noop.ID, model.StatusProcessed, "", "[]", "[]", "[]")
+	assert.Nil(t, err)
+
+	rollbackRequest, _ := json.Marshal(dx.RollbackRequest{Env: "staging", App: "my-app", TargetSHA: "xyz"})
+	rollback, err := s.CreateEvent(&model.Event{Type: model.TypeRollback, Blob: string(rollbackRequest)})
+	assert.Nil(t, err)
+	err = s.UpdateEventStatus(rollback.ID, model.StatusProcessed, "", `["def"]`, "[]", "[]")
+	assert.Nil(t, err)
+
+	metrics, err := Compute(s, now.Add(-24*time.Hour), now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, metrics.Deploys, "events that didn't write the gitops repo are not deploys")
+	assert.Equal(t, 1, metrics.Rollbacks)
+	assert.InDelta(t, 1/25.0*24, metrics.DeploymentFrequency, 0.001)
+	assert.InDelta(t, 600, metrics.LeadTimeSeconds, 2)
+	assert.Equal(t, 1.0, metrics.ChangeFailureRate)
+	assert.InDelta(t, 0, metrics.MTTRSeconds, 2)
+
+	metrics, err = Compute(s, now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, metrics.Deploys)
+	assert.Equal(t, 0.0, metrics.ChangeFailureRate)
+}
+
+func Test_median(t *testing.T) {
+	assert.Equal(t, 0.0, median(nil))
+	assert.Equal(t, 2.0, median([]float64{3, 1, 2}))
+	assert.Equal(t, 2.5, median([]float64{4, 1, 2, 3}))
+}
@@ -0,0 +1,80 @@
+package dora
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+)
+
+// RepositoryStats calculates the pipeline health metrics of a source code repository
+// from its artifact and release events
+func RepositoryStats(store *store.Store, repo string) (*dx.RepositoryStats, error) {
+	events, err := store.RepositoryEvents(repo)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get repository events: %s", err)
+	}
+
+	stats := &dx.RepositoryStats{
+		Repository:        repo,
+		ArtifactsByBranch: map[string]int{},
+		ArtifactsByEvent:  map[string]int{},
+		LastDeploys:       map[string]*dx.LastDeploy{},
+	}
+
+	var deployLatencies []float64
+	for _, event := range events {
+		if event.Type == model.TypeArtifact {
+			stats.Artifacts++
+			stats.ArtifactsByBranch[event.Branch]++
+			stats.ArtifactsByEvent[event.Event.String()]++
+		}
+
+		if event.Status != model.StatusProcessed && event.Status != model.StatusPartial ||
+			len(event.GitopsHashes) == 0 {
+			continue // nothing was deployed
+		}
+
+		artifactID, err := deployedArtifactID(event)
+		if err != nil {
+			return nil, err
+		}
+		for _, envStatus := range event.EnvStatuses {
+			if envStatus.Status != dx.EnvStatusSuccess {
+				continue
+			}
+			stats.LastDeploys[envStatus.Env] = &dx.LastDeploy{
+				Env:        envStatus.Env,
+				App:        envStatus.App,
+				ArtifactID: artifactID,
+				GitopsRef:  envStatus.GitopsRef,
+				Created:    event.Created,
+			}
+		}
+
+		eventLeadTimes, err := leadTimes(store, event)
+		if err != nil {
+			return nil, err
+		}
+		deployLatencies = append(deployLatencies, eventLeadTimes...)
+	}
+
+	stats.AverageDeployLatencySeconds = mean(deployLatencies)
+
+	return stats, nil
+}
+
+func deployedArtifactID(event *model.Event) (string, error) {
+	if event.Type == model.TypeArtifact {
+		return event.ArtifactID, nil
+	}
+
+	var releaseRequest dx.ReleaseRequest
+	err := json.Unmarshal([]byte(event.Blob), &releaseRequest)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse release request: %s", err)
+	}
+	return releaseRequest.ArtifactID, nil
+}
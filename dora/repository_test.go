@@ -0,0 +1,64 @@
+package dora
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_repositoryStats(t *testing.T) {
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	now := time.Now()
+
+	artifactEvent := func(id string, repo string, branch string, event dx.GitEvent) *model.Event {
+		e, err := model.ToEvent(dx.Artifact{
+			ID:      id,
+			Version: dx.Version{RepositoryName: repo, Branch: branch, Event: event},
+		})
+		assert.Nil(t, err)
+		saved, err := s.CreateEvent(e)
+		assert.Nil(t, err)
+		return saved
+	}
+
+	deployed := artifactEvent("my-app-1", "gimlet-io/my-app", "main", dx.Push)
+	err := s.UpdateEventStatus(deployed.ID, model.StatusProcessed, "", `["abc"]`, `["staging"]`,
+		`[{"env":"staging","app":"my-app","status":"success","gitopsRef":"abc"}]`)
+	assert.Nil(t, err)
+	err = s.SaveOrUpdateGitopsCommit(&model.GitopsCommit{
+		Sha:     "abc",
+		Status:  model.ReconciliationSucceeded,
+		Created: now.Add(10 * time.Minute).Unix(),
+	})
+	assert.Nil(t, err)
+
+	artifactEvent("my-app-2", "gimlet-io/my-app", "feature", dx.PR)
+	artifactEvent("my-app-3", "gimlet-io/my-app", "main", dx.Push)
+	artifactEvent("other-app-1", "gimlet-io/other-app", "main", dx.Push)
+
+	releaseRequest, _ := json.Marshal(dx.ReleaseRequest{Env: "production", ArtifactID: "my-app-1"})
+	release, err := s.CreateEvent(&model.Event{Type: model.TypeRelease, Blob: string(releaseRequest), Repository: "gimlet-io/my-app"})
+	assert.Nil(t, err)
+	err = s.UpdateEventStatus(release.ID, model.StatusProcessed, "", `["def"]`, `["production"]`,
+		`[{"env":"production","app":"my-app","status":"success","gitopsRef":"def"}]`)
+	assert.Nil(t, err)
+
+	stats, err := RepositoryStats(s, "gimlet-io/my-app")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, stats.Artifacts)
+	assert.Equal(t, map[string]int{"main": 2, "feature": 1}, stats.ArtifactsByBranch)
+	assert.Equal(t, map[string]int{"push": 2, "pr": 1}, stats.ArtifactsByEvent)
+	assert.Equal(t, "my-app-1", stats.LastDeploys["staging"].ArtifactID)
+	assert.Equal(t, "abc", stats.LastDeploys["staging"].GitopsRef)
+	assert.Equal(t, "my-app-1", stats.LastDeploys["production"].ArtifactID, "releases are deploys too")
+	assert.InDelta(t, 600, stats.AverageDeployLatencySeconds, 2, "only applied gitops commits count")
+}
@@ -0,0 +1,232 @@
+package drift
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Releases returns the current releases of every app in the given envs, indexed by app then env.
+// Each env is read from the gitops repo branch it is deployed to
+func Releases(
+	repoCache *nativeGit.GitopsRepoCache,
+	envs []string,
+	perf *prometheus.HistogramVec,
+) (map[string]map[string]*dx.Release, error) {
+	releases := map[string]map[string]*dx.Release{}
+	for _, env := range envs {
+		repo, releaseRepo := repoCache.EnvInstanceForRead(env)
+		appReleases, err := nativeGit.Status(repo, "", env, perf)
+		releaseRepo()
+		if err != nil {
+			return nil, err
+		}
+		for app, release := range appReleases {
+			if _, ok := releases[app]; !ok {
+				releases[app] = map[string]*dx.Release{}
+			}
+			releases[app][env] = release
+		}
+	}
+	return releases, nil
+}
+
+// Detect compares the chart and the values of an app in the given envs.
+// The releases hold the current release of the app in each env.
+//
+// Values are compared before the artifact variables are resolved,
+// so values that only differ because the envs run different versions of the app, like the image tag, are not drift.
+// The resolved values are reported for the drifting keys
+func Detect(
+	store *store.Store,
+	envRegistry map[string]*dx.Env,
+	app string,
+	releases map[string]*dx.Release,
+) (*dx.DriftReport, error) {
+	report := &dx.DriftReport{
+		App:    app,
+		Envs:   []string{},
+		Charts: map[string]string{},
+		Values: []*dx.ValueDrift{},
+	}
+
+	var envs []string
+	for env := range releases {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+
+	rawValues := map[string]map[string]string{}
+	resolvedValues := map[string]map[string]string{}
+	for _, env := range envs {
+		release := releases[env]
+		if release == nil || release.ArtifactID == "" {
+			report.Missing = append(report.Missing, env)
+			continue
+		}
+
+		raw, resolved, err := appManifest(store, envRegistry[env], env, app, release.ArtifactID)
+		if err != nil {
+			return nil, err
+		}
+		if raw == nil {
+			report.Missing = append(report.Missing, env)
+			continue
+		}
+
+		report.Envs = append(report.Envs, env)
+		report.Charts[env] = chartRef(resolved.Chart)
+		rawValues[env] = flatten("", raw.Values)
+		resolvedValues[env] = flatten("", resolved.Values)
+	}
+
+	for _, env := range report.Envs {
+		if report.Charts[env] != report.Charts[report.Envs[0]] {
+			report.ChartDrift = true
+		}
+	}
+
+	keys := map[string]bool{}
+	for _, values := range rawValues {
+		for key := range values {
+			keys[key] = true
+		}
+	}
+	var sortedKeys []string
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		if !drifts(key, report.Envs, rawValues) {
+			continue
+		}
+
+		valueDrift := &dx.ValueDrift{
+			Key:    key,
+			Values: map[string]string{},
+		}
+		for _, env := range report.Envs {
+			if value, ok := resolvedValues[env][key]; ok {
+				valueDrift.Values[env] = value
+			}
+		}
+		report.Values = append(report.Values, valueDrift)
+	}
+
+	return report, nil
+}
+
+// appManifest returns the manifest of the app in the env from the artifact, with the env defaults applied.
+// Both the raw and the variable resolved form is returned, nil if the artifact has no manifest for the app
+func appManifest(
+	store *store.Store,
+	envDefaults *dx.Env,
+	env string,
+	app string,
+	artifactID string,
+) (*dx.Manifest, *dx.Manifest, error) {
+	event, err := store.Artifact(artifactID)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("cannot get artifact %s: %s", artifactID, err)
+	}
+	artifact, err := model.ToArtifact(event)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifests, err := dx.ExpandVariants(artifact.Environments)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, manifest := range manifests {
+		if manifest.Env != env {
+			continue
+		}
+
+		resolved, err := copyManifest(manifest)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = resolved.ApplyValuesFiles()
+		if err != nil {
+			return nil, nil, err
+		}
+		resolved.ApplyEnvDefaults(envDefaults)
+		err = resolved.ResolveVars(artifact.Vars())
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot resolve manifest vars %s", err.Error())
+		}
+		if resolved.App != app {
+			continue
+		}
+
+		raw := *manifest
+		raw.ApplyValuesFiles() // the same values files were merged in the resolved manifest without an error
+		raw.ApplyEnvDefaults(envDefaults)
+		return &raw, resolved, nil
+	}
+
+	return nil, nil, nil
+}
+
+func copyManifest(manifest *dx.Manifest) (*dx.Manifest, error) {
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var manifestCopy dx.Manifest
+	err = json.Unmarshal(manifestBytes, &manifestCopy)
+	return &manifestCopy, err
+}
+
+func chartRef(chart dx.Chart) string {
+	ref := chart.Name
+	if chart.Repository != "" {
+		ref = chart.Repository + "/" + ref
+	}
+	if chart.Version != "" {
+		ref = ref + "@" + chart.Version
+	}
+	return ref
+}
+
+func drifts(key string, envs []string, values map[string]map[string]string) bool {
+	first, firstSet := values[envs[0]][key]
+	for _, env := range envs[1:] {
+		value, set := values[env][key]
+		if set != firstSet || value != first {
+			return true
+		}
+	}
+	return false
+}
+
+// flatten turns nested values into dot separated keys. Lists and scalars are leaves, in their JSON form
+func flatten(prefix string, values map[string]interface{}) map[string]string {
+	flat := map[string]string{}
+	for key, value := range values {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			for k, v := range flatten(key, nested) {
+				flat[k] = v
+			}
+			continue
+		}
+		valueBytes, _ := json.Marshal(value)
+		flat[key] = string(valueBytes)
+	}
+	return flat
+}
@@ -0,0 +1,95 @@
+package drift
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_detect(t *testing.T) {
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	manifest := func(env string, chartVersion string, replicas int) *dx.Manifest {
+		return &dx.Manifest{
+			App:   "my-app",
+			Env:   env,
+			Chart: dx.Chart{Name: "onechart", Version: chartVersion},
+			Values: map[string]interface{}{
+				"replicas": replicas,
+				"image": map[string]interface{}{
+					"tag": "{{ .SHA }}",
+				},
+			},
+		}
+	}
+
+	saveArtifact(t, s, dx.Artifact{
+		ID:      "my-app-1",
+		Version: dx.Version{SHA: "abc"},
+		Environments: []*dx.Manifest{
+			manifest("staging", "0.10.0", 1),
+		},
+	})
+	saveArtifact(t, s, dx.Artifact{
+		ID:      "my-app-2",
+		Version: dx.Version{SHA: "def"},
+		Environments: []*dx.Manifest{
+			manifest("production", "0.9.0", 2),
+		},
+	})
+
+	envRegistry := map[string]*dx.Env{
+		"production": {
+			Name: "production",
+			Values: map[string]interface{}{
+				"replicas":            3,
+				"podDisruptionBudget": map[string]interface{}{"enabled": true},
+			},
+		},
+	}
+
+	report, err := Detect(s, envRegistry, "my-app", map[string]*dx.Release{
+		"staging":    {ArtifactID: "my-app-1"},
+		"production": {ArtifactID: "my-app-2"},
+		"preview":    nil,
+	})
+	assert.Nil(t, err)
+	assert.True(t, report.Drifted())
+	assert.Equal(t, []string{"production", "staging"}, report.Envs)
+	assert.Equal(t, []string{"preview"}, report.Missing)
+	assert.True(t, report.ChartDrift)
+	assert.Equal(t, "onechart@0.9.0", report.Charts["production"])
+	assert.Equal(t, 2, len(report.Values), "different versions of the image tag should not be drift")
+	assert.Equal(t, "podDisruptionBudget.enabled", report.Values[0].Key)
+	assert.Equal(t, map[string]string{"production": "true"}, report.Values[0].Values, "env defaults should be part of the compared config")
+	assert.Equal(t, "replicas", report.Values[1].Key)
+	assert.Equal(t, map[string]string{"staging": "1", "production": "2"}, report.Values[1].Values, "manifest values should take precedence over env defaults")
+}
+
+func Test_flatten(t *testing.T) {
+	flat := flatten("", map[string]interface{}{
+		"replicas": 1,
+		"resources": map[string]interface{}{
+			"limits": map[string]interface{}{"memory": "200Mi"},
+		},
+		"ports": []interface{}{80, 443},
+	})
+	assert.Equal(t, map[string]string{
+		"replicas":                "1",
+		"resources.limits.memory": `"200Mi"`,
+		"ports":                   "[80,443]",
+	}, flat)
+}
+
+func saveArtifact(t *testing.T, s *store.Store, artifact dx.Artifact) {
+	event, err := model.ToEvent(artifact)
+	assert.Nil(t, err)
+	_, err = s.CreateEvent(event)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,131 @@
+package drift
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+)
+
+// maxDiffCommits caps the app commits listed in a release diff
+const maxDiffCommits = 100
+
+// Compare compares the chart and the resolved values of an app in two of its releases in an env,
+// and lists the app commits between the artifacts of the releases.
+// The images are compared on the rendered manifests, they are not set here
+func Compare(
+	store *store.Store,
+	envDefaults *dx.Env,
+	env string,
+	app string,
+	from *dx.Release,
+	to *dx.Release,
+) (*dx.ReleaseDiff, error) {
+	diff := &dx.ReleaseDiff{
+		Env:     env,
+		App:     app,
+		From:    from,
+		To:      to,
+		Images:  []string{},
+		Values:  []*dx.ValueChange{},
+		Commits: []*dx.Version{},
+	}
+
+	fromValues := map[string]string{}
+	_, fromManifest, err := appManifest(store, envDefaults, env, app, from.ArtifactID)
+	if err != nil {
+		return nil, err
+	}
+	if fromManifest != nil {
+		diff.FromChart = chartRef(fromManifest.Chart)
+		fromValues = flatten("", fromManifest.Values)
+	}
+
+	toValues := map[string]string{}
+	_, toManifest, err := appManifest(store, envDefaults, env, app, to.ArtifactID)
+	if err != nil {
+		return nil, err
+	}
+	if toManifest != nil {
+		diff.ToChart = chartRef(toManifest.Chart)
+		toValues = flatten("", toManifest.Values)
+	}
+	diff.ChartChanged = diff.FromChart != diff.ToChart
+
+	keys := map[string]bool{}
+	for key := range fromValues {
+		keys[key] = true
+	}
+	for key := range toValues {
+		keys[key] = true
+	}
+	var sortedKeys []string
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		if fromValues[key] == toValues[key] {
+			continue
+		}
+		diff.Values = append(diff.Values, &dx.ValueChange{
+			Key:  key,
+			From: fromValues[key],
+			To:   toValues[key],
+		})
+	}
+
+	diff.Commits, err = commitsBetween(store, from, to)
+	return diff, err
+}
+
+// commitsBetween returns the versions of the artifacts that were built after the older release's artifact,
+// up to and including the newer one's, deduplicated by commit. Releases of different repositories have no commits in between
+func commitsBetween(store *store.Store, from *dx.Release, to *dx.Release) ([]*dx.Version, error) {
+	commits := []*dx.Version{}
+	if from.Version == nil || to.Version == nil || from.Version.RepositoryName != to.Version.RepositoryName {
+		return commits, nil
+	}
+
+	older, err := store.Artifact(from.ArtifactID)
+	if err == sql.ErrNoRows {
+		return commits, nil
+	} else if err != nil {
+		return nil, err
+	}
+	newer, err := store.Artifact(to.ArtifactID)
+	if err == sql.ErrNoRows {
+		return commits, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if older.Created > newer.Created {
+		older, newer = newer, older // comparing backwards, eg. to a rollback target
+	}
+
+	since := time.Unix(older.Created, 0)
+	until := time.Unix(newer.Created+1, 0)
+	events, err := store.Artifacts(to.Version.RepositoryName, to.Version.Branch, nil, "", nil, "", nil, maxDiffCommits, 0, &since, &until)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{older.SHA: true}
+	for _, event := range events {
+		artifact, err := model.ToArtifact(event)
+		if err != nil {
+			return nil, err
+		}
+		if seen[artifact.Version.SHA] {
+			continue
+		}
+		seen[artifact.Version.SHA] = true
+		version := artifact.Version
+		commits = append(commits, &version)
+	}
+	return commits, nil
+}
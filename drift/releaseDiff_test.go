@@ -0,0 +1,62 @@
+package drift
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_compare(t *testing.T) {
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	artifact := func(id string, repo string, sha string, chartVersion string, values map[string]interface{}) dx.Artifact {
+		return dx.Artifact{
+			ID:      id,
+			Version: dx.Version{RepositoryName: repo, SHA: sha, Branch: "main"},
+			Environments: []*dx.Manifest{{
+				App:    "my-app",
+				Env:    "production",
+				Chart:  dx.Chart{Name: "onechart", Version: chartVersion},
+				Values: values,
+			}},
+		}
+	}
+
+	saveArtifact(t, s, artifact("my-app-1", "my-app", "abc", "0.9.0", map[string]interface{}{"replicas": 1, "image": map[string]interface{}{"tag": "{{ .GitSHA }}"}}))
+	saveArtifact(t, s, artifact("my-app-2", "my-app", "def", "0.9.0", nil))
+	saveArtifact(t, s, artifact("other-app-1", "other-app", "xyz", "0.9.0", nil))
+	saveArtifact(t, s, artifact("my-app-3", "my-app", "ghi", "0.10.0", map[string]interface{}{"image": map[string]interface{}{"tag": "{{ .GitSHA }}"}, "debug": true}))
+	saveArtifact(t, s, artifact("my-app-3-rebuild", "my-app", "ghi", "0.10.0", nil))
+
+	from := &dx.Release{ArtifactID: "my-app-1", Version: &dx.Version{RepositoryName: "my-app", SHA: "abc", Branch: "main"}}
+	to := &dx.Release{ArtifactID: "my-app-3", Version: &dx.Version{RepositoryName: "my-app", SHA: "ghi", Branch: "main"}}
+	diff, err := Compare(s, nil, "production", "my-app", from, to)
+	assert.Nil(t, err)
+	assert.True(t, diff.ChartChanged)
+	assert.Equal(t, "onechart@0.9.0", diff.FromChart)
+	assert.Equal(t, "onechart@0.10.0", diff.ToChart)
+
+	assert.Equal(t, 3, len(diff.Values))
+	assert.Equal(t, &dx.ValueChange{Key: "debug", To: "true"}, diff.Values[0], "added values should be reported")
+	assert.Equal(t, &dx.ValueChange{Key: "image.tag", From: `"abc"`, To: `"ghi"`}, diff.Values[1], "values should be compared resolved")
+	assert.Equal(t, &dx.ValueChange{Key: "replicas", From: "1"}, diff.Values[2], "removed values should be reported")
+
+	var shas []string
+	for _, commit := range diff.Commits {
+		shas = append(shas, commit.SHA)
+	}
+	assert.ElementsMatch(t, []string{"def", "ghi"}, shas, "should list the commits after the from artifact once, of the same repository")
+
+	diff, err = Compare(s, nil, "production", "my-app", to, from)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(diff.Commits), "should list the commits in between when comparing backwards too")
+
+	diff, err = Compare(s, nil, "production", "my-app", from, &dx.Release{ArtifactID: "other-app-1", Version: &dx.Version{RepositoryName: "other-app"}})
+	assert.Nil(t, err)
+	assert.Empty(t, diff.Commits, "releases of different repositories have no commits in between")
+}
@@ -34,6 +34,31 @@ type Artifact struct {
 
 	// CI job information, test results, Docker image information, etc
 	Items []map[string]interface{} `json:"items,omitempty"`
+
+	// IDs of other artifacts this artifact is released together with, eg. a frontend pinning its backend
+	Dependencies []string `json:"dependencies,omitempty"`
+
+	// Base64 encoded signature of the artifact's signing payload, see SignArtifact
+	Signature string `json:"signature,omitempty"`
+
+	// SignatureStatus is the result of the signature verification on ingestion, set by GimletD
+	SignatureStatus string `json:"signatureStatus,omitempty"`
+
+	// Source attributes the artifact to the API user and CI system that submitted it, set by GimletD
+	Source *ArtifactSource `json:"source,omitempty"`
+}
+
+// ArtifactSource identifies who and what submitted an artifact
+type ArtifactSource struct {
+	// SubmittedBy is the login of the user whose API token submitted the artifact,
+	// registry-webhook for the artifacts of registry webhooks, whose pusher is the author of the version
+	SubmittedBy string `json:"submittedBy,omitempty"`
+
+	// UserAgent is the User-Agent header of the submitting request
+	UserAgent string `json:"userAgent,omitempty"`
+
+	// CIURL is the url of the CI item of the artifact, the job that built it
+	CIURL string `json:"ciUrl,omitempty"`
 }
 
 func (a *Artifact) HasCleanupPolicy() bool {
@@ -45,8 +70,14 @@ func (a *Artifact) HasCleanupPolicy() bool {
 	return false
 }
 
+// Vars returns the variables available for manifest templating:
+// the built-in GitSHA, GitBranch and ArtifactID, the CI context and the string fields of the items
 func (a *Artifact) Vars() map[string]string {
-	vars := map[string]string{}
+	vars := map[string]string{
+		"GitSHA":     a.Version.SHA,
+		"GitBranch":  a.Version.Branch,
+		"ArtifactID": a.ID,
+	}
 
 	for k, v := range a.Context {
 		vars[k] = v
@@ -61,3 +92,36 @@ func (a *Artifact) Vars() map[string]string {
 	}
 	return vars
 }
+
+// CIURL returns the url of the item named CI, empty if the artifact has none
+func (a *Artifact) CIURL() string {
+	for _, item := range a.Items {
+		if name, _ := item["name"].(string); name != "CI" {
+			continue
+		}
+		if url, ok := item["url"].(string); ok {
+			return url
+		}
+	}
+	return ""
+}
+
+// ArtifactsPage is a page of the artifact list
+type ArtifactsPage struct {
+	Artifacts []*Artifact `json:"artifacts"`
+	// Total is the number of artifacts within the constraints of the list, on all pages
+	Total int `json:"total"`
+	// NextCursor fetches the next page, empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// ArtifactIngestion is the result of saving an artifact and waiting for the deploy decision on it
+type ArtifactIngestion struct {
+	Artifact      *Artifact `json:"artifact"`
+	Status        string    `json:"status"`
+	StatusDesc    string    `json:"statusDesc,omitempty"`
+	TriggeredEnvs []string  `json:"triggeredEnvs"`
+
+	// Envs are the outcomes of the deploys per env
+	Envs []EnvStatus `json:"envs,omitempty"`
+}
@@ -0,0 +1,237 @@
+package dx
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	giturl "github.com/whilp/git-urls"
+	"gopkg.in/yaml.v3"
+)
+
+// ArtifactBuilder assembles an artifact from a CI checkout.
+// Errors are collected and returned by Build, so calls can be chained:
+//   dx.NewArtifact().WithVersionFromGit(".").WithEnvFiles(".gimlet").Build()
+type ArtifactBuilder struct {
+	artifact   *Artifact
+	signingKey crypto.Signer
+	err        error
+}
+
+// NewArtifact starts building an artifact
+func NewArtifact() *ArtifactBuilder {
+	return &ArtifactBuilder{
+		artifact: &Artifact{
+			Context: map[string]string{},
+		},
+	}
+}
+
+// WithVersion sets the version of the artifact
+func (b *ArtifactBuilder) WithVersion(version Version) *ArtifactBuilder {
+	b.artifact.Version = version
+	return b
+}
+
+// WithVersionFromGit reads the version from the HEAD commit of the git repository at path.
+// The repository name is taken from the origin remote in the owner/name format
+func (b *ArtifactBuilder) WithVersionFromGit(path string) *ArtifactBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	version, err := versionFromGit(path)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.artifact.Version = *version
+	return b
+}
+
+// WithEvent overrides the git event of the version, eg. when CI builds a pull request
+func (b *ArtifactBuilder) WithEvent(event GitEvent) *ArtifactBuilder {
+	b.artifact.Version.Event = event
+	return b
+}
+
+// WithContext adds a CI variable to the artifact
+func (b *ArtifactBuilder) WithContext(key string, value string) *ArtifactBuilder {
+	b.artifact.Context[key] = value
+	return b
+}
+
+// WithItem adds a CI item, eg. a test result or a Docker image
+func (b *ArtifactBuilder) WithItem(item map[string]interface{}) *ArtifactBuilder {
+	b.artifact.Items = append(b.artifact.Items, item)
+	return b
+}
+
+// WithDependency pins another artifact to be released together with this one
+func (b *ArtifactBuilder) WithDependency(artifactID string) *ArtifactBuilder {
+	b.artifact.Dependencies = append(b.artifact.Dependencies, artifactID)
+	return b
+}
+
+// WithEnvFiles adds the Gimlet environment files from a directory.
+// Every .yaml and .yml file is read, and a file may hold multiple manifests
+func (b *ArtifactBuilder) WithEnvFiles(dir string) *ArtifactBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	manifests, err := envFiles(dir)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.artifact.Environments = append(b.artifact.Environments, manifests...)
+	return b
+}
+
+// WithValuesFiles embeds the values files that the manifests reference, eg. valuesFiles: [.gimlet/values-prod.yaml].
+// Paths are relative to repoDir, the root of the app repo. Call it after the env files are added
+func (b *ArtifactBuilder) WithValuesFiles(repoDir string) *ArtifactBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	b.err = embedValuesFiles(repoDir, b.artifact.Environments)
+	return b
+}
+
+// WithSigningKey signs the artifact with the key when it is built
+func (b *ArtifactBuilder) WithSigningKey(key crypto.Signer) *ArtifactBuilder {
+	b.signingKey = key
+	return b
+}
+
+// Build returns the artifact, or the first error that happened while building it
+func (b *ArtifactBuilder) Build() (*Artifact, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.artifact.Version.SHA == "" {
+		return nil, errors.New("artifact version is not set")
+	}
+	for _, m := range b.artifact.Environments {
+		for _, file := range m.ValuesFiles {
+			if _, ok := m.ValuesFileContents[file]; !ok {
+				return nil, fmt.Errorf("values file %s of %s/%s is not embedded, see WithValuesFiles", file, m.Env, m.App)
+			}
+		}
+	}
+	if b.signingKey != nil {
+		err := SignArtifact(b.artifact, b.signingKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.artifact, nil
+}
+
+func versionFromGit(path string) (*Version, error) {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open git repository at %s: %s", path, err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get HEAD: %s", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("cannot get HEAD commit: %s", err)
+	}
+
+	version := &Version{
+		SHA:            commit.Hash.String(),
+		Created:        commit.Committer.When.Unix(),
+		Event:          Push,
+		AuthorName:     commit.Author.Name,
+		AuthorEmail:    commit.Author.Email,
+		CommitterName:  commit.Committer.Name,
+		CommitterEmail: commit.Committer.Email,
+		Message:        strings.TrimSpace(commit.Message),
+	}
+	if head.Name().IsBranch() {
+		version.Branch = head.Name().Short()
+	}
+
+	tags, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list tags: %s", err)
+	}
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		hash := ref.Hash()
+		if tag, err := repo.TagObject(hash); err == nil { // annotated tag
+			hash = tag.Target
+		}
+		if hash == commit.Hash {
+			version.Tag = ref.Name().Short()
+			version.Event = Tag
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list tags: %s", err)
+	}
+
+	remote, err := repo.Remote("origin")
+	if err == nil && len(remote.Config().URLs) > 0 {
+		remoteURL, err := giturl.Parse(remote.Config().URLs[0])
+		if err == nil {
+			version.RepositoryName = strings.TrimSuffix(strings.TrimPrefix(remoteURL.Path, "/"), ".git")
+			if remoteURL.Host != "" {
+				version.URL = fmt.Sprintf("https://%s/%s/commit/%s", remoteURL.Host, version.RepositoryName, version.SHA)
+			}
+		}
+	}
+
+	return version, nil
+}
+
+func envFiles(dir string) ([]*Manifest, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read env files: %s", err)
+	}
+
+	var manifests []*Manifest
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read env file %s: %s", file.Name(), err)
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		for {
+			var m Manifest
+			err := decoder.Decode(&m)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse env file %s: %s", file.Name(), err)
+			}
+			if m.Env == "" {
+				continue // not a Gimlet manifest
+			}
+			manifests = append(manifests, &m)
+		}
+	}
+	return manifests, nil
+}
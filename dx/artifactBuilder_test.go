@@ -0,0 +1,72 @@
+package dx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_artifactBuilder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gimlet-builder-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainInit(dir, false)
+	assert.Nil(t, err)
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{"git@github.com:gimlet-io/my-app.git"},
+	})
+	assert.Nil(t, err)
+
+	err = os.MkdirAll(filepath.Join(dir, ".gimlet"), 0755)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, ".gimlet", "envs.yaml"), []byte(`
+app: my-app
+env: staging
+namespace: default
+---
+app: my-app
+env: production
+namespace: default
+`), 0644)
+	assert.Nil(t, err)
+
+	w, _ := repo.Worktree()
+	w.Add(".gimlet/envs.yaml")
+	sha, err := w.Commit("Bugfix 123", &git.CommitOptions{
+		Author: &object.Signature{Name: "Jane Doe", Email: "jane@doe.org", When: time.Now()},
+	})
+	assert.Nil(t, err)
+	_, err = repo.CreateTag("v0.1.0", sha, nil)
+	assert.Nil(t, err)
+
+	artifact, err := NewArtifact().
+		WithVersionFromGit(dir).
+		WithEnvFiles(filepath.Join(dir, ".gimlet")).
+		WithItem(map[string]interface{}{"name": "CI", "url": "https://jenkins.example.com/job/dev/84"}).
+		WithContext("CI", "true").
+		Build()
+	assert.Nil(t, err)
+	assert.Equal(t, sha.String(), artifact.Version.SHA)
+	assert.Equal(t, "gimlet-io/my-app", artifact.Version.RepositoryName)
+	assert.Equal(t, "Bugfix 123", artifact.Version.Message)
+	assert.Equal(t, "v0.1.0", artifact.Version.Tag)
+	assert.Equal(t, Tag, artifact.Version.Event)
+	assert.Equal(t, "https://github.com/gimlet-io/my-app/commit/"+sha.String(), artifact.Version.URL)
+	assert.Equal(t, 2, len(artifact.Environments))
+	assert.Equal(t, 1, len(artifact.Items))
+
+	notARepo, err := ioutil.TempDir("", "gimlet-builder-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(notARepo)
+	_, err = NewArtifact().WithVersionFromGit(notARepo).WithEnvFiles(dir).Build()
+	assert.NotNil(t, err, "should return the git error")
+}
@@ -26,6 +26,6 @@ func Test_vars(t *testing.T) {
 `), &a)
 
 	vars := a.Vars()
-	assert.Equal(t, 3, len(vars))
+	assert.Equal(t, 6, len(vars), "should have the built-in vars, the context and the items")
 	assert.Equal(t, 1, len(a.Context))
 }
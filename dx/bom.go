@@ -0,0 +1,22 @@
+package dx
+
+// BillOfMaterials lists every artifact that makes up an environment:
+// the deployed artifacts and all their transitive dependencies
+type BillOfMaterials struct {
+	Env   string     `json:"env"`
+	Items []*BOMItem `json:"items"`
+}
+
+// BOMItem is an artifact in the bill of materials
+type BOMItem struct {
+	ArtifactID string `json:"artifactId"`
+
+	// App is set if the artifact is deployed in the env, empty for dependencies that are not deployed
+	App string `json:"app,omitempty"`
+
+	Version      *Version `json:"version,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+
+	// Missing is set if the artifact is not found in the artifact storage
+	Missing bool `json:"missing,omitempty"`
+}
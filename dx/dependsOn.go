@@ -0,0 +1,74 @@
+package dx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OrderByDependencies orders the manifests so every manifest comes after the manifests that it depends on in its env.
+// The order is kept otherwise.
+// Depending on an app with variants is depending on all its variants
+func OrderByDependencies(manifests []*Manifest) ([]*Manifest, error) {
+	for _, m := range manifests {
+		for _, dependency := range m.DependsOn {
+			found := false
+			for _, other := range manifests {
+				if other != m && other.Env == m.Env &&
+					(other.App == dependency || other.BaseApp() == dependency) {
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%s/%s depends on %s, that is not in the artifact", m.Env, m.App, dependency)
+			}
+		}
+	}
+
+	var ordered []*Manifest
+	placed := map[*Manifest]bool{}
+	for len(ordered) < len(manifests) {
+		progress := false
+		for _, m := range manifests {
+			if placed[m] || !dependenciesPlaced(m, manifests, placed) {
+				continue
+			}
+			ordered = append(ordered, m)
+			placed[m] = true
+			progress = true
+			break // keeps the original order of the manifests that are ready
+		}
+
+		if !progress {
+			var cycle []string
+			for _, m := range manifests {
+				if !placed[m] {
+					cycle = append(cycle, m.Env+"/"+m.App)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between %s", strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// DependsOnManifest tells if the other manifest is a dependency of this one
+func (m *Manifest) DependsOnManifest(other *Manifest) bool {
+	if other == nil || other == m || other.Env != m.Env {
+		return false
+	}
+	for _, dependency := range m.DependsOn {
+		if other.App == dependency || other.BaseApp() == dependency {
+			return true
+		}
+	}
+	return false
+}
+
+func dependenciesPlaced(m *Manifest, manifests []*Manifest, placed map[*Manifest]bool) bool {
+	for _, other := range manifests {
+		if m.DependsOnManifest(other) && !placed[other] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_orderByDependencies(t *testing.T) {
+	app := &Manifest{App: "my-app", Env: "staging", DependsOn: []string{"migrate"}}
+	migrate := &Manifest{App: "migrate", Env: "staging"}
+	productionApp := &Manifest{App: "my-app", Env: "production"}
+
+	ordered, err := OrderByDependencies([]*Manifest{app, productionApp, migrate})
+	assert.Nil(t, err)
+	assert.Equal(t, []*Manifest{productionApp, migrate, app}, ordered, "should deploy the dependency first, and keep the order otherwise")
+
+	_, err = OrderByDependencies([]*Manifest{app, productionApp})
+	assert.NotNil(t, err, "should reject dependencies that are not in the env")
+
+	cyclic := &Manifest{App: "migrate", Env: "staging", DependsOn: []string{"my-app"}}
+	_, err = OrderByDependencies([]*Manifest{app, cyclic})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "cycle")
+}
+
+func Test_dependsOnVariants(t *testing.T) {
+	app := &Manifest{App: "my-app", Env: "staging", DependsOn: []string{"db"}}
+	dbEU := &Manifest{App: "db-eu", Env: "staging", Variant: "eu"}
+	dbUS := &Manifest{App: "db-us", Env: "staging", Variant: "us"}
+
+	assert.True(t, app.DependsOnManifest(dbEU), "should depend on all variants of the app")
+	ordered, err := OrderByDependencies([]*Manifest{app, dbEU, dbUS})
+	assert.Nil(t, err)
+	assert.Equal(t, []*Manifest{dbEU, dbUS, app}, ordered)
+}
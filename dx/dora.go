@@ -0,0 +1,22 @@
+package dx
+
+// DoraMetrics are the DORA delivery metrics of a time window
+type DoraMetrics struct {
+	Since int64 `json:"since"`
+	Until int64 `json:"until"`
+
+	Deploys   int `json:"deploys"`
+	Rollbacks int `json:"rollbacks"`
+
+	// DeploymentFrequency is the average number of deploys per day
+	DeploymentFrequency float64 `json:"deploymentFrequency"`
+
+	// LeadTimeSeconds is the median time from artifact creation to the gitops commit applied by Flux
+	LeadTimeSeconds float64 `json:"leadTimeSeconds"`
+
+	// ChangeFailureRate is the ratio of rollbacks to deploys
+	ChangeFailureRate float64 `json:"changeFailureRate"`
+
+	// MTTRSeconds is the mean time from a deploy to the rollback that restored the env
+	MTTRSeconds float64 `json:"mttrSeconds"`
+}
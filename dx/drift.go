@@ -0,0 +1,30 @@
+package dx
+
+// DriftReport compares the configuration of an app across envs
+type DriftReport struct {
+	App string `json:"app"`
+
+	// Envs are the compared envs where the app is deployed
+	Envs []string `json:"envs"`
+	// Missing are the envs where the app or its artifact is not found
+	Missing []string `json:"missing,omitempty"`
+
+	// Charts holds the chart reference of the app in each env
+	Charts     map[string]string `json:"charts"`
+	ChartDrift bool              `json:"chartDrift"`
+
+	Values []*ValueDrift `json:"values"`
+}
+
+// ValueDrift is a Helm value that is configured differently across envs
+type ValueDrift struct {
+	// Key is the dot separated path of the value, eg.: resources.limits.memory
+	Key string `json:"key"`
+	// Values holds the resolved value in each env, envs without the value are left out
+	Values map[string]string `json:"values"`
+}
+
+// Drifted tells if the app is configured differently in the compared envs
+func (r *DriftReport) Drifted() bool {
+	return r.ChartDrift || len(r.Values) > 0
+}
@@ -0,0 +1,169 @@
+package dx
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Env is an entry of the environment registry.
+// Its chart and values are the defaults of the manifests deployed to the env
+type Env struct {
+	Name   string                 `yaml:"name" json:"name"`
+	Chart  *Chart                 `yaml:"chart,omitempty" json:"chart,omitempty"`
+	Values map[string]interface{} `yaml:"values,omitempty" json:"values,omitempty"`
+
+	// SealedSecretsCertificate is the PEM encoded certificate of the Sealed Secrets controller of the env,
+	// that the manifest secrets are encrypted with
+	SealedSecretsCertificate string `yaml:"sealedSecretsCertificate,omitempty" json:"sealedSecretsCertificate,omitempty"`
+
+	// GitopsBranch is the branch of the gitops repo that the env is deployed to, the default branch if empty
+	GitopsBranch string `yaml:"gitopsBranch,omitempty" json:"gitopsBranch,omitempty"`
+
+	// PullRequestComment comments the deploys of pull request artifacts on the pull request, eg. in preview envs
+	PullRequestComment *PullRequestComment `yaml:"pullRequestComment,omitempty" json:"pullRequestComment,omitempty"`
+
+	// DeployPreview comments the manifest changes on the pull requests of the branches that deploy to the env,
+	// rendered from the pull request artifact and compared with the current deploy
+	DeployPreview bool `yaml:"deployPreview,omitempty" json:"deployPreview,omitempty"`
+
+	// VulnerabilityScan gates the deploys to the env on a vulnerability scan of the deployed image
+	VulnerabilityScan *VulnerabilityScan `yaml:"vulnerabilityScan,omitempty" json:"vulnerabilityScan,omitempty"`
+
+	// ManifestValidation validates the rendered manifests before they are committed to the gitops repo
+	ManifestValidation *ManifestValidation `yaml:"manifestValidation,omitempty" json:"manifestValidation,omitempty"`
+
+	// Metadata describes the env, eg.: {tier: production, region: eu-west-1}.
+	// Strategic merge patches can be conditioned on it, see Manifest.ResolvePatches
+	Metadata map[string]string `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+
+	// DefaultDeploy is the deploy policy of the manifests of the env that have no deploy block,
+	// eg.: {branch: main, event: push} deploys every app from main without per-repo config.
+	// Manifests opt out with an empty deploy block
+	DefaultDeploy *Deploy `yaml:"defaultDeploy,omitempty" json:"defaultDeploy,omitempty"`
+
+	// MaxDeploysPerMinute limits the gitops writes to the env, eg. when a CI misfire posts hundreds of artifacts at once.
+	// The events over the limit stay queued until the last minute's deploys allow them, unlimited if zero
+	MaxDeploysPerMinute int `yaml:"maxDeploysPerMinute,omitempty" json:"maxDeploysPerMinute,omitempty"`
+
+	// HoldDeploysOnSyncFailure holds the auto-deploys to the env while Flux reports its sync failing,
+	// so broken commits don't pile up. The held deploys are requeued when the sync recovers or an admin overrides the hold.
+	// Releases, other than image updates, go on. See EnvSync
+	HoldDeploysOnSyncFailure bool `yaml:"holdDeploysOnSyncFailure,omitempty" json:"holdDeploysOnSyncFailure,omitempty"`
+}
+
+// VulnerabilityScan is the vulnerability policy of an env
+type VulnerabilityScan struct {
+	// Thresholds are the most vulnerabilities allowed of each severity, eg.: {CRITICAL: 0, HIGH: 5}.
+	// Severities are UNKNOWN, LOW, MEDIUM, HIGH and CRITICAL
+	Thresholds map[string]int `yaml:"thresholds" json:"thresholds"`
+	// Park parks the deploys that exceed a threshold instead of failing them
+	Park bool `yaml:"park,omitempty" json:"park,omitempty"`
+}
+
+// ManifestValidation is the manifest validation policy of an env.
+// With a kubeconfig the manifests are dry-run applied on the cluster of the env, they are validated with kubeconform otherwise
+type ManifestValidation struct {
+	// Kubeconfig is the path of the kubeconfig of the env's cluster
+	Kubeconfig string `yaml:"kubeconfig,omitempty" json:"kubeconfig,omitempty"`
+	// Context is the kube context of the env in the kubeconfig, the current context by default
+	Context string `yaml:"context,omitempty" json:"context,omitempty"`
+
+	// KubernetesVersion is the version of the schemas that kubeconform validates against, eg.: 1.22.0
+	KubernetesVersion string `yaml:"kubernetesVersion,omitempty" json:"kubernetesVersion,omitempty"`
+	// SchemaLocations are the extra schema locations of kubeconform, eg. of custom resources
+	SchemaLocations []string `yaml:"schemaLocations,omitempty" json:"schemaLocations,omitempty"`
+}
+
+// PullRequestComment configures the comment on the pull requests that are deployed to an env
+type PullRequestComment struct {
+	// URL is where the deployed app is reachable, eg.: https://{app}.preview.example.com
+	// Placeholders are {app}, {env}, {namespace} and {branch}
+	URL string `yaml:"url,omitempty" json:"url,omitempty"`
+}
+
+// LoadEnvs reads the environment registry from a YAML list of envs
+func LoadEnvs(path string) (map[string]*Env, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read env registry: %s", err)
+	}
+
+	var envList []*Env
+	err = yaml.Unmarshal(content, &envList)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse env registry: %s", err)
+	}
+
+	envs := map[string]*Env{}
+	for _, env := range envList {
+		if env.Name == "" {
+			return nil, fmt.Errorf("env registry entry without a name")
+		}
+		if _, exists := envs[env.Name]; exists {
+			return nil, fmt.Errorf("env %s is registered twice", env.Name)
+		}
+		envs[env.Name] = env
+	}
+	return envs, nil
+}
+
+// GitopsBranch returns the gitops repo branch of the env, empty for the default branch
+func GitopsBranch(envs map[string]*Env, env string) string {
+	if e, ok := envs[env]; ok && e != nil {
+		return e.GitopsBranch
+	}
+	return ""
+}
+
+// DeployPolicy returns the deploy policy of the manifest: its deploy block, or the default deploy policy of its env
+func DeployPolicy(envs map[string]*Env, manifest *Manifest) *Deploy {
+	if manifest.Deploy != nil {
+		return manifest.Deploy
+	}
+	if e, ok := envs[manifest.Env]; ok && e != nil {
+		return e.DefaultDeploy
+	}
+	return nil
+}
+
+// ApplyEnvDefaults makes the manifest inherit the env's chart if it has none,
+// and merges the env's default values under the manifest values
+func (m *Manifest) ApplyEnvDefaults(env *Env) {
+	if env == nil {
+		return
+	}
+
+	if m.Chart.Name == "" && env.Chart != nil {
+		m.Chart = *env.Chart
+	}
+	if len(env.Values) > 0 {
+		m.Values = mergeValues(env.Values, m.Values)
+	}
+}
+
+// ApplyPlatformOverrides merges the override values of the platform config over the manifest values
+func (m *Manifest) ApplyPlatformOverrides(overrides map[string]interface{}) {
+	if len(overrides) > 0 {
+		m.Values = mergeValues(m.Values, overrides)
+	}
+}
+
+// mergeValues deep merges the override values over the base values, without modifying either
+func mergeValues(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		baseMap, baseIsMap := merged[k].(map[string]interface{})
+		overrideMap, overrideIsMap := v.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[k] = mergeValues(baseMap, overrideMap)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
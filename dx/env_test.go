@@ -0,0 +1,103 @@
+package dx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_applyEnvDefaults(t *testing.T) {
+	env := &Env{
+		Name:  "production",
+		Chart: &Chart{Repository: "https://chart.onechart.dev", Name: "onechart", Version: "0.32.0"},
+		Values: map[string]interface{}{
+			"replicas":  2,
+			"resources": map[string]interface{}{"cpu": "200m", "memory": "200Mi"},
+		},
+	}
+
+	m := &Manifest{
+		Values: map[string]interface{}{
+			"image":     "nginx",
+			"resources": map[string]interface{}{"memory": "1Gi"},
+		},
+	}
+	m.ApplyEnvDefaults(env)
+	assert.Equal(t, "onechart", m.Chart.Name, "manifests without a chart should inherit the env's")
+	assert.Equal(t, 2, m.Values["replicas"])
+	assert.Equal(t, "nginx", m.Values["image"])
+	assert.Equal(t, map[string]interface{}{"cpu": "200m", "memory": "1Gi"}, m.Values["resources"], "manifest values should win")
+	assert.Equal(t, "200Mi", env.Values["resources"].(map[string]interface{})["memory"], "env defaults should not change")
+
+	m = &Manifest{Chart: Chart{Name: "https://github.com/my/chart.git"}}
+	m.ApplyEnvDefaults(env)
+	assert.Equal(t, "https://github.com/my/chart.git", m.Chart.Name, "an own chart should be kept")
+
+	m.ApplyEnvDefaults(nil)
+}
+
+func Test_applyPlatformOverrides(t *testing.T) {
+	m := &Manifest{
+		Values: map[string]interface{}{
+			"image":     "nginx",
+			"resources": map[string]interface{}{"cpu": "200m", "memory": "1Gi"},
+		},
+	}
+	m.ApplyPlatformOverrides(map[string]interface{}{
+		"resources": map[string]interface{}{"memory": "512Mi"},
+		"ingress":   map[string]interface{}{"ingressClassName": "nginx"},
+	})
+	assert.Equal(t, "nginx", m.Values["image"])
+	assert.Equal(t, map[string]interface{}{"cpu": "200m", "memory": "512Mi"}, m.Values["resources"], "platform overrides should win")
+	assert.Equal(t, map[string]interface{}{"ingressClassName": "nginx"}, m.Values["ingress"])
+
+	m.ApplyPlatformOverrides(nil)
+	assert.Equal(t, "nginx", m.Values["image"])
+}
+
+func Test_loadEnvs(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gimlet-envs")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "envs.yaml")
+
+	ioutil.WriteFile(path, []byte(`
+- name: staging
+  chart:
+    repository: https://chart.onechart.dev
+    name: onechart
+    version: 0.32.0
+  values:
+    replicas: 1
+- name: production
+  gitopsBranch: production
+`), 0644)
+	envs, err := LoadEnvs(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "onechart", envs["staging"].Chart.Name)
+	assert.Nil(t, envs["production"].Chart)
+	assert.Equal(t, "production", GitopsBranch(envs, "production"))
+	assert.Equal(t, "", GitopsBranch(envs, "staging"), "should deploy to the default branch")
+	assert.Equal(t, "", GitopsBranch(envs, "preview"), "unregistered envs should deploy to the default branch")
+
+	ioutil.WriteFile(path, []byte(`
+- name: staging
+  defaultDeploy:
+    branch: main
+    event: push
+`), 0644)
+	envs, err = LoadEnvs(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "main", DeployPolicy(envs, &Manifest{Env: "staging"}).Branch, "manifests without a deploy block should get the env default")
+	assert.Equal(t, "", DeployPolicy(envs, &Manifest{Env: "staging", Deploy: &Deploy{}}).Branch, "an empty deploy block should opt out")
+	assert.Nil(t, DeployPolicy(envs, &Manifest{Env: "production"}))
+
+	ioutil.WriteFile(path, []byte(`
+- name: staging
+- name: staging
+`), 0644)
+	_, err = LoadEnvs(path)
+	assert.NotNil(t, err, "duplicate envs should be rejected")
+}
@@ -3,6 +3,10 @@ package dx
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
 	"gopkg.in/yaml.v3"
 )
 
@@ -34,8 +38,44 @@ var toID = map[string]GitEvent{
 	"pr":   PR,
 }
 
+// ParseGitEvent returns the GitEvent for its string representation,
+// or an error if the string is not a known git event
+func ParseGitEvent(str string) (GitEvent, error) {
+	if event, ok := toID[str]; ok {
+		return event, nil
+	}
+	return Push, fmt.Errorf("unknown git event %q, must be one of %s", str, strings.Join(gitEventNames(), ", "))
+}
+
+// ParseGitEventPtr is like ParseGitEvent, but returns a pointer to the parsed value
+func ParseGitEventPtr(str string) (*GitEvent, error) {
+	event, err := ParseGitEvent(str)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// IsValid tells if the GitEvent is one of the known git events
+func (s GitEvent) IsValid() bool {
+	_, ok := toString[s]
+	return ok
+}
+
+func gitEventNames() []string {
+	names := []string{}
+	for name := range toID {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // MarshalJSON marshals the enum as a quoted json string
 func (s GitEvent) MarshalJSON() ([]byte, error) {
+	if !s.IsValid() {
+		return nil, fmt.Errorf("unknown git event %d", s)
+	}
 	buffer := bytes.NewBufferString(`"`)
 	buffer.WriteString(toString[s])
 	buffer.WriteString(`"`)
@@ -49,13 +89,15 @@ func (s *GitEvent) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
-	// Note that if the string cannot be found then it will be set to the zero value, 'Push' in this case.
-	*s = toID[j]
-	return nil
+	*s, err = ParseGitEvent(j)
+	return err
 }
 
 // MarshalYAML marshals the enum as a quoted yaml string
 func (s GitEvent) MarshalYAML() (interface{}, error) {
+	if !s.IsValid() {
+		return nil, fmt.Errorf("unknown git event %d", s)
+	}
 	return toString[s], nil
 }
 
@@ -66,9 +108,8 @@ func (s *GitEvent) UnmarshalYAML(n *yaml.Node) error {
 	if err != nil {
 		return err
 	}
-	// Note that if the string cannot be found then it will be set to the zero value, 'Push' in this case.
-	*s = toID[j]
-	return nil
+	*s, err = ParseGitEvent(j)
+	return err
 }
 
 func PushPtr() *GitEvent {
@@ -1,6 +1,8 @@
 package dx
 
 import (
+	"encoding/json"
+
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
 	"testing"
@@ -25,3 +27,24 @@ event: push
 event: push
 `, string(marshalled))
 }
+
+func Test_GitEventStrictParsing(t *testing.T) {
+	event, err := ParseGitEvent("tag")
+	assert.Nil(t, err)
+	assert.Equal(t, Tag, event)
+
+	_, err = ParseGitEvent("merge")
+	assert.NotNil(t, err, "should reject unknown events")
+	assert.Contains(t, err.Error(), "must be one of pr, push, tag")
+
+	var deployTrigger Deploy
+	err = yaml.Unmarshal([]byte("event: merge\n"), &deployTrigger)
+	assert.NotNil(t, err, "should reject unknown events in yaml")
+
+	var version Version
+	err = json.Unmarshal([]byte(`{"event": "merge"}`), &version)
+	assert.NotNil(t, err, "should reject unknown events in json")
+
+	_, err = json.Marshal(Version{Event: GitEvent(42)})
+	assert.NotNil(t, err, "should not marshal unknown events")
+}
@@ -0,0 +1,145 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/otiai10/copy"
+	"github.com/sirupsen/logrus"
+)
+
+// ChartCache keeps shallow clones of git hosted charts on disk, keyed by repo and ref.
+// Branch refs are refreshed after the refresh interval, tags and shas are immutable and never refetched.
+// The ref is taken from the chart url, or from the chart version, see chartRef
+type ChartCache struct {
+	cacheRoot       string
+	refreshInterval time.Duration
+
+	lock    sync.Mutex
+	entries map[string]*chartCacheEntry
+}
+
+type chartCacheEntry struct {
+	lock    sync.Mutex
+	path    string
+	fetched time.Time
+}
+
+func NewChartCache(cacheRoot string, refreshInterval time.Duration) *ChartCache {
+	return &ChartCache{
+		cacheRoot:       cacheRoot,
+		refreshInterval: refreshInterval,
+		entries:         map[string]*chartCacheEntry{},
+	}
+}
+
+// Chart returns a private copy of the chart that the caller must remove after use.
+// A nil cache clones the chart on every call
+func (c *ChartCache) Chart(m dx.Manifest, token string) (string, error) {
+	if c == nil {
+		return CloneChartFromRepo(m, token)
+	}
+
+	gitUrl, params, err := chartRef(m.Chart)
+	if err != nil {
+		return "", err
+	}
+
+	entry := c.entry(gitUrl, params)
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+
+	if entry.path == "" || (isMovingRef(params) && time.Since(entry.fetched) > c.refreshInterval) {
+		err = c.fetch(entry, gitUrl, params, token)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	tmpChartDir, err := ioutil.TempDir("", "gimlet-git-chart")
+	if err != nil {
+		return "", fmt.Errorf("cannot create tmp file: %s", err)
+	}
+	err = copy.Copy(entry.path, tmpChartDir)
+	if err != nil {
+		os.RemoveAll(tmpChartDir)
+		return "", fmt.Errorf("cannot copy cached chart: %s", err)
+	}
+
+	if v, found := params["path"]; found {
+		tmpChartDir = tmpChartDir + v[0]
+	}
+	return tmpChartDir, nil
+}
+
+func (c *ChartCache) entry(gitUrl string, params url.Values) *chartCacheEntry {
+	key := chartCacheKey(gitUrl, params)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = &chartCacheEntry{}
+	}
+	return c.entries[key]
+}
+
+// fetch clones the chart next to the cached one, then swaps them
+func (c *ChartCache) fetch(entry *chartCacheEntry, gitUrl string, params url.Values, token string) error {
+	err := os.MkdirAll(c.cacheRoot, 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create chart cache dir: %s", err)
+	}
+	path, err := ioutil.TempDir(c.cacheRoot, "chart-")
+	if err != nil {
+		return fmt.Errorf("cannot create chart cache dir: %s", err)
+	}
+
+	t0 := time.Now()
+	err = cloneChart(path, gitUrl, params, token)
+	if err != nil {
+		os.RemoveAll(path)
+		if entry.path != "" {
+			logrus.Warnf("cannot refresh chart %s, using the cached one: %s", gitUrl, err)
+			return nil
+		}
+		return err
+	}
+	logrus.Infof("fetching chart %s took %d", gitUrl, time.Since(t0).Milliseconds())
+
+	if entry.path != "" {
+		os.RemoveAll(entry.path)
+	}
+	entry.path = path
+	entry.fetched = time.Now()
+	return nil
+}
+
+func chartCacheKey(gitUrl string, params url.Values) string {
+	ref := fmt.Sprintf("sha=%s,tag=%s,branch=%s", params.Get("sha"), params.Get("tag"), params.Get("branch"))
+	hash := sha256.Sum256([]byte(gitUrl + "@" + ref))
+	return hex.EncodeToString(hash[:])
+}
+
+// isMovingRef tells if the chart points to a branch, or the default branch, which can change over time
+func isMovingRef(params url.Values) bool {
+	_, sha := params["sha"]
+	_, tag := params["tag"]
+	return !sha && !tag
+}
+
+// Cleanup removes the cached charts
+func (c *ChartCache) Cleanup() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, entry := range c.entries {
+		os.RemoveAll(entry.path)
+		delete(c.entries, key)
+	}
+}
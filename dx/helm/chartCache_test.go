@@ -0,0 +1,101 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_chartCache(t *testing.T) {
+	chartRepoPath, err := ioutil.TempDir("", "gimlet-chart-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(chartRepoPath)
+	cacheRoot, err := ioutil.TempDir("", "gimlet-chart-cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheRoot)
+
+	chartRepo, err := git.PlainInit(chartRepoPath, false)
+	assert.Nil(t, err)
+	commitChart(t, chartRepo, chartRepoPath, "0.1.0")
+
+	cache := NewChartCache(cacheRoot, time.Hour)
+	manifest := dx.Manifest{Chart: dx.Chart{Name: "file://" + chartRepoPath + "?path=/chart"}}
+
+	chartDir, err := cache.Chart(manifest, "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(chartDir)
+	chartYaml, err := ioutil.ReadFile(filepath.Join(chartDir, "Chart.yaml"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(chartYaml), "0.1.0")
+
+	commitChart(t, chartRepo, chartRepoPath, "0.2.0")
+
+	cachedChartDir, err := cache.Chart(manifest, "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cachedChartDir)
+	assert.NotEqual(t, chartDir, cachedChartDir, "every caller should get its own copy")
+	chartYaml, err = ioutil.ReadFile(filepath.Join(cachedChartDir, "Chart.yaml"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(chartYaml), "0.1.0", "the chart should be served from cache within the refresh interval")
+
+	cache.refreshInterval = 0
+	refreshedChartDir, err := cache.Chart(manifest, "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(refreshedChartDir)
+	chartYaml, err = ioutil.ReadFile(filepath.Join(refreshedChartDir, "Chart.yaml"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(chartYaml), "0.2.0", "branch refs should be refreshed")
+}
+
+func Test_chartCachePinnedVersion(t *testing.T) {
+	chartRepoPath, err := ioutil.TempDir("", "gimlet-chart-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(chartRepoPath)
+	cacheRoot, err := ioutil.TempDir("", "gimlet-chart-cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheRoot)
+
+	chartRepo, err := git.PlainInit(chartRepoPath, false)
+	assert.Nil(t, err)
+	commitChart(t, chartRepo, chartRepoPath, "0.1.0")
+	head, err := chartRepo.Head()
+	assert.Nil(t, err)
+	_, err = chartRepo.CreateTag("v0.1.0", head.Hash(), nil)
+	assert.Nil(t, err)
+	commitChart(t, chartRepo, chartRepoPath, "0.2.0")
+
+	cache := NewChartCache(cacheRoot, time.Hour)
+	for _, version := range []string{head.Hash().String(), "v0.1.0"} {
+		manifest := dx.Manifest{Chart: dx.Chart{Name: "file://" + chartRepoPath + "?path=/chart", Version: version}}
+		chartDir, err := cache.Chart(manifest, "")
+		assert.Nil(t, err)
+		defer os.RemoveAll(chartDir)
+		chartYaml, err := ioutil.ReadFile(filepath.Join(chartDir, "Chart.yaml"))
+		assert.Nil(t, err)
+		assert.Contains(t, string(chartYaml), "0.1.0", "the chart version should pin the chart to %s", version)
+	}
+
+	manifest := dx.Manifest{Chart: dx.Chart{Name: "file://" + chartRepoPath + "?path=/chart", Version: "v9.9.9"}}
+	_, err = cache.Chart(manifest, "")
+	assert.NotNil(t, err, "a missing tag should not fall back to the default branch")
+}
+
+func commitChart(t *testing.T, repo *git.Repository, repoPath string, version string) {
+	writeFile(t, filepath.Join(repoPath, "chart", "Chart.yaml"), "apiVersion: v2\nname: my-chart\nversion: "+version+"\n")
+
+	worktree, err := repo.Worktree()
+	assert.Nil(t, err)
+	_, err = worktree.Add("chart/Chart.yaml")
+	assert.Nil(t, err)
+	_, err = worktree.Commit("chart "+version, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	assert.Nil(t, err)
+}
@@ -3,6 +3,7 @@ package helm
 import (
 	"fmt"
 	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
@@ -10,14 +11,28 @@ import (
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	helmCLI "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
 	"io/ioutil"
 	"net/url"
-	"path/filepath"
+	"regexp"
 	"strings"
 )
 
-// HelmTemplate returns Kubernetes yaml from the Gimlet Manifest format
+func init() {
+	dx.RegisterChartRenderer(HelmTemplate)
+}
+
+// HelmTemplate returns Kubernetes yaml from the Gimlet Manifest format, rendered within the template limits.
+// It renders in a subprocess if a render pool is set
 func HelmTemplate(m dx.Manifest) (string, error) {
+	if renderPool != nil {
+		return renderPool.Render(m)
+	}
+	return helmTemplate(m)
+}
+
+func helmTemplate(m dx.Manifest) (string, error) {
 	actionConfig := new(action.Configuration)
 	client := action.NewInstall(actionConfig)
 
@@ -42,67 +57,118 @@ func HelmTemplate(m dx.Manifest) (string, error) {
 		return "", err
 	}
 
-	rel, err := client.Run(chartRequested, m.Values)
+	return dx.WithTemplateLimits(func() (string, error) {
+		rel, err := client.Run(chartRequested, m.Values)
+		if err != nil {
+			return "", err
+		}
+		return rel.Manifest, nil
+	})
+}
+
+// BuildDependencies fetches the missing subcharts of a local chart, like `helm dependency build` does.
+// Chart repository credentials are taken from the Helm repository config (HELM_REPOSITORY_CONFIG)
+func BuildDependencies(chartPath string) error {
+	chart, err := loader.Load(chartPath)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("cannot load chart: %s", err)
 	}
 
-	return rel.Manifest, nil
-}
-
-// SplitHelmOutput splits helm's multifile string output into file paths and their content
-func SplitHelmOutput(input map[string]string) map[string]string {
-	if len(input) != 1 {
-		return input
+	dependencies := chart.Metadata.Dependencies
+	if len(dependencies) == 0 {
+		return nil
+	}
+	if err := action.CheckDependencies(chart, dependencies); err == nil {
+		return nil // all subcharts are present
 	}
 
-	const separator = "---\n# Source: "
+	settings := helmCLI.New()
+	manager := &downloader.Manager{
+		Out:              ioutil.Discard,
+		ChartPath:        chartPath,
+		Getters:          getter.All(settings),
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+	}
+	err = manager.Build()
+	if err != nil {
+		return fmt.Errorf("cannot build chart dependencies: %s", err)
+	}
 
-	files := map[string]string{}
+	return nil
+}
 
-	for _, content := range input {
-		if !strings.Contains(content, separator) {
-			return input
-		}
+// CloneChartFromRepo returns the chart location of the specified chart
+func CloneChartFromRepo(m dx.Manifest, token string) (string, error) {
+	gitUrl, params, err := chartRef(m.Chart)
+	if err != nil {
+		return "", err
+	}
 
-		parts := strings.Split(content, separator)
-		for _, p := range parts {
-			p := strings.TrimSpace(p)
-			if p == "" {
-				continue
-			}
+	tmpChartDir, err := ioutil.TempDir("", "gimlet-git-chart")
+	if err != nil {
+		return "", fmt.Errorf("cannot create tmp file: %s", err)
+	}
 
-			lines := strings.Split(p, "\n")
-			filePath := lines[0]
-			content := strings.Join(lines[1:], "\n")
-			fileName := filepath.Base(filePath)
-			if existingContent, ok := files[fileName]; ok {
-				files[fileName] = existingContent + "---\n" + content + "\n"
-			} else {
-				files[fileName] = "---\n" + content + "\n"
-			}
-		}
+	err = cloneChart(tmpChartDir, gitUrl, params, token)
+	if err != nil {
+		return "", err
 	}
 
-	return files
+	if v, found := params["path"]; found {
+		tmpChartDir = tmpChartDir + v[0]
+	}
+	return tmpChartDir, nil
 }
 
-// CloneChartFromRepo returns the chart location of the specified chart
-func CloneChartFromRepo(m dx.Manifest, token string) (string, error) {
-	gitAddress, err := giturl.Parse(m.Chart.Name)
+// parseChartURL splits a git hosted chart reference to the repo url and the path, sha, tag, branch parameters
+func parseChartURL(chartName string) (string, url.Values, error) {
+	gitAddress, err := giturl.Parse(chartName)
 	if err != nil {
-		return "", fmt.Errorf("cannot parse chart's git address: %s", err)
+		return "", nil, fmt.Errorf("cannot parse chart's git address: %s", err)
 	}
-	gitUrl := strings.ReplaceAll(m.Chart.Name, gitAddress.RawQuery, "")
+	gitUrl := strings.ReplaceAll(chartName, gitAddress.RawQuery, "")
 	gitUrl = strings.ReplaceAll(gitUrl, "?", "")
 
-	tmpChartDir, err := ioutil.TempDir("", "gimlet-git-chart")
+	params, _ := url.ParseQuery(gitAddress.RawQuery)
+	return gitUrl, params, nil
+}
+
+var shaPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// chartRef returns the repo url and the ref parameters of a git hosted chart.
+// If the url has no sha, tag or branch, the chart version pins it: a full commit sha, or a tag otherwise.
+// Without both, the chart tracks the default branch of the repo
+func chartRef(chart dx.Chart) (string, url.Values, error) {
+	gitUrl, params, err := parseChartURL(chart.Name)
 	if err != nil {
-		return "", fmt.Errorf("cannot create tmp file: %s", err)
+		return "", nil, err
 	}
 
+	_, sha := params["sha"]
+	_, tag := params["tag"]
+	_, branch := params["branch"]
+	if chart.Version == "" || sha || tag || branch {
+		return gitUrl, params, nil
+	}
+
+	if shaPattern.MatchString(strings.ToLower(chart.Version)) {
+		params.Set("sha", strings.ToLower(chart.Version))
+	} else {
+		params.Set("tag", chart.Version)
+	}
+	return gitUrl, params, nil
+}
+
+// cloneChart clones the chart repo to dir.
+// Tags and branches are fetched shallow and single-branch, pinned shas need the history.
+// Submodules are cloned too, unless they are disabled, see nativeGit.DisableSubmodules
+func cloneChart(dir string, gitUrl string, params url.Values, token string) error {
 	opts := &git.CloneOptions{
-		URL: gitUrl,
+		URL:               gitUrl,
+		Depth:             1,
+		SingleBranch:      true,
+		RecurseSubmodules: nativeGit.SubmoduleRecursion(),
 	}
 	if token != "" {
 		opts.Auth = &http.BasicAuth{
@@ -110,43 +176,76 @@ func CloneChartFromRepo(m dx.Manifest, token string) (string, error) {
 			Password: token,
 		}
 	}
-	repo, err := git.PlainClone(tmpChartDir, false, opts)
-	if err != nil {
-		return "", fmt.Errorf("cannot clone chart git repo: %s", err)
+	if v, found := params["tag"]; found {
+		opts.ReferenceName = plumbing.NewTagReferenceName(v[0])
 	}
-	worktree, err := repo.Worktree()
-	if err != nil {
-		return "", fmt.Errorf("cannot get worktree: %s", err)
+	if v, found := params["branch"]; found {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(v[0])
+	}
+	_, shaPinned := params["sha"]
+	if shaPinned {
+		opts.Depth = 0
+		opts.SingleBranch = false
 	}
 
-	params, _ := url.ParseQuery(gitAddress.RawQuery)
-	if v, found := params["path"]; found {
-		tmpChartDir = tmpChartDir + v[0]
+	repo, err := git.PlainClone(dir, false, opts)
+	if err != nil {
+		return fmt.Errorf("cannot clone chart git repo: %s", err)
 	}
-	if v, found := params["sha"]; found {
-		err = worktree.Checkout(&git.CheckoutOptions{
-			Hash: plumbing.NewHash(v[0]),
-		})
+
+	if shaPinned {
+		worktree, err := repo.Worktree()
 		if err != nil {
-			return "", fmt.Errorf("cannot checkout sha: %s", err)
+			return fmt.Errorf("cannot get worktree: %s", err)
 		}
-	}
-	if v, found := params["tag"]; found {
 		err = worktree.Checkout(&git.CheckoutOptions{
-			Branch: plumbing.NewTagReferenceName(v[0]),
+			Hash: plumbing.NewHash(params["sha"][0]),
 		})
 		if err != nil {
-			return "", fmt.Errorf("cannot checkout tag: %s", err)
+			return fmt.Errorf("cannot checkout sha: %s", err)
+		}
+		err = nativeGit.UpdateSubmodules(repo, opts.Auth, true) // the clone updated the submodules of the default branch
+		if err != nil {
+			return err
 		}
 	}
-	if v, found := params["branch"]; found {
-		err = worktree.Checkout(&git.CheckoutOptions{
-			Branch: plumbing.NewBranchReferenceName(v[0]),
-		})
+
+	return verifyChartRef(repo, params)
+}
+
+// verifyChartRef checks that the cloned chart is checked out at the pinned sha or tag
+func verifyChartRef(repo *git.Repository, params url.Values) error {
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("cannot get the head of the chart repo: %s", err)
+	}
+
+	if sha := params.Get("sha"); sha != "" && head.Hash().String() != strings.ToLower(sha) {
+		return fmt.Errorf("chart repo is at %s instead of the pinned sha %s", head.Hash(), sha)
+	}
+
+	if tag := params.Get("tag"); tag != "" {
+		ref, err := repo.Tag(tag)
 		if err != nil {
-			return "", fmt.Errorf("cannot checkout branch: %s", err)
+			return fmt.Errorf("cannot find chart tag %s: %s", tag, err)
+		}
+		hash := ref.Hash()
+		if tagObject, err := repo.TagObject(hash); err == nil { // annotated tags point to a tag object
+			commit, err := tagObject.Commit()
+			if err != nil {
+				return fmt.Errorf("cannot get the commit of chart tag %s: %s", tag, err)
+			}
+			hash = commit.Hash
+		}
+		if head.Hash() != hash {
+			return fmt.Errorf("chart repo is at %s instead of the pinned tag %s (%s)", head.Hash(), tag, hash)
 		}
 	}
 
-	return tmpChartDir, nil
+	return nil
+}
+
+// SplitHelmOutput splits helm's multifile string output into file paths and their content, see dx.SplitHelmOutput
+func SplitHelmOutput(input map[string]string) map[string]string {
+	return dx.SplitHelmOutput(input)
 }
@@ -0,0 +1,44 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_buildDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gimlet-chart-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "child", "Chart.yaml"), `apiVersion: v2
+name: child
+version: 0.1.0
+`)
+	writeFile(t, filepath.Join(dir, "parent", "Chart.yaml"), `apiVersion: v2
+name: parent
+version: 0.1.0
+dependencies:
+- name: child
+  version: 0.1.0
+  repository: file://../child
+`)
+
+	err = BuildDependencies(filepath.Join(dir, "parent"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "parent", "charts", "child-0.1.0.tgz"))
+	assert.Nil(t, err, "subchart should be fetched")
+
+	err = BuildDependencies(filepath.Join(dir, "child"))
+	assert.Nil(t, err, "charts without dependencies should be left alone")
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,141 @@
+package helm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TemplateSubcommand makes the gimletd binary render a single manifest, see ServeTemplate
+const TemplateSubcommand = "helm-template"
+
+// chartLoadTimeout is the time a render subprocess gets to locate and load the chart, on top of the template timeout
+const chartLoadTimeout = time.Minute
+
+// RenderPool renders manifests in short-lived subprocesses of the gimletd binary,
+// so the memory that Helm holds on to is released with the process after every render.
+// Concurrency caps the number of renders that run at once, the rest wait for a free slot
+type RenderPool struct {
+	binary string
+	args   []string
+	slots  chan struct{}
+
+	renders  *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+// NewRenderPool creates a pool that executes the binary, the gimletd executable.
+// Render durations are observed with the outcome label, success or failure
+func NewRenderPool(
+	binary string,
+	concurrency int,
+	renders *prometheus.HistogramVec,
+	inFlight prometheus.Gauge,
+) *RenderPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &RenderPool{
+		binary:   binary,
+		args:     []string{TemplateSubcommand},
+		slots:    make(chan struct{}, concurrency),
+		renders:  renders,
+		inFlight: inFlight,
+	}
+}
+
+var renderPool *RenderPool
+
+// SetRenderPool makes HelmTemplate render in the subprocesses of the pool, nil renders in-process
+func SetRenderPool(pool *RenderPool) {
+	renderPool = pool
+}
+
+type renderRequest struct {
+	Manifest dx.Manifest       `json:"manifest"`
+	Limits   dx.TemplateLimits `json:"limits"`
+}
+
+type renderResponse struct {
+	Manifest string `json:"manifest"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Render renders the manifest in a subprocess, within the template limits
+func (p *RenderPool) Render(m dx.Manifest) (string, error) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+
+	p.inFlight.Inc()
+	defer p.inFlight.Dec()
+
+	t0 := time.Now()
+	manifest, err := p.render(m)
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	p.renders.WithLabelValues(outcome).Observe(time.Since(t0).Seconds())
+
+	return manifest, err
+}
+
+func (p *RenderPool) render(m dx.Manifest) (string, error) {
+	limits := dx.CurrentTemplateLimits()
+	request, err := json.Marshal(&renderRequest{Manifest: m, Limits: limits})
+	if err != nil {
+		return "", fmt.Errorf("cannot serialize render request: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), limits.Timeout+chartLoadTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.binary, p.args...)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("render subprocess killed after %s", limits.Timeout+chartLoadTimeout)
+	}
+
+	var response renderResponse
+	if decodeErr := json.Unmarshal(stdout.Bytes(), &response); decodeErr != nil {
+		if err != nil {
+			return "", fmt.Errorf("render subprocess failed: %s %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return "", fmt.Errorf("cannot parse render subprocess output: %s", decodeErr)
+	}
+	if response.Error != "" {
+		return "", fmt.Errorf("%s", response.Error)
+	}
+	return response.Manifest, nil
+}
+
+// ServeTemplate renders the manifest of the request read from in, and writes the response to out.
+// It is the entry point of the render subprocesses
+func ServeTemplate(in io.Reader, out io.Writer) error {
+	var request renderRequest
+	err := json.NewDecoder(in).Decode(&request)
+	if err != nil {
+		return fmt.Errorf("cannot parse render request: %s", err)
+	}
+
+	dx.SetTemplateLimits(request.Limits)
+	manifest, err := helmTemplate(request.Manifest)
+	response := &renderResponse{Manifest: manifest}
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	return json.NewEncoder(out).Encode(response)
+}
@@ -0,0 +1,75 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test_renderSubprocess is the render subprocess of Test_renderPool, it does nothing when run as a test
+func Test_renderSubprocess(t *testing.T) {
+	if os.Getenv("GIMLETD_TEST_RENDER_SUBPROCESS") != "1" {
+		return
+	}
+	err := ServeTemplate(os.Stdin, os.Stdout)
+	if err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func Test_renderPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gimlet-chart-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "Chart.yaml"), `apiVersion: v2
+name: my-chart
+version: 0.1.0
+`)
+	writeFile(t, filepath.Join(dir, "templates", "configmap.yaml"), `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+data:
+  greeting: {{ required "greeting is required" .Values.greeting }}
+`)
+
+	os.Setenv("GIMLETD_TEST_RENDER_SUBPROCESS", "1")
+	defer os.Unsetenv("GIMLETD_TEST_RENDER_SUBPROCESS")
+
+	renders := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_helm_render_seconds"}, []string{"outcome"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_helm_renders_in_flight"})
+	pool := NewRenderPool(os.Args[0], 2, renders, inFlight)
+	pool.args = []string{"-test.run=^Test_renderSubprocess$"}
+	SetRenderPool(pool)
+	defer SetRenderPool(nil)
+
+	manifest := dx.Manifest{
+		App:    "my-app",
+		Chart:  dx.Chart{Name: dir},
+		Values: map[string]interface{}{"greeting": "hello"},
+	}
+	rendered, err := HelmTemplate(manifest)
+	assert.Nil(t, err)
+	assert.Contains(t, rendered, "name: my-app")
+	assert.Contains(t, rendered, "greeting: hello")
+
+	inProcess, err := helmTemplate(manifest)
+	assert.Nil(t, err)
+	assert.Equal(t, inProcess, rendered, "subprocesses should render the same as in-process")
+
+	manifest.Values = map[string]interface{}{}
+	_, err = HelmTemplate(manifest)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "greeting is required", "render errors should be passed back")
+
+	assert.Equal(t, 2, testutil.CollectAndCount(renders), "should observe renders by outcome")
+	assert.Equal(t, 0.0, testutil.ToFloat64(inFlight))
+}
@@ -0,0 +1,17 @@
+package dx
+
+// Identity describes the user and the token that authenticated an API request
+type Identity struct {
+	Login string   `json:"login"`
+	Roles []string `json:"roles"`
+	// Groups are the groups of the user, synced from the SCM organization
+	Groups []string `json:"groups"`
+
+	// TokenKind is user for API tokens and sess for browser sessions
+	TokenKind      string `json:"tokenKind"`
+	TokenIssuedAt  int64  `json:"tokenIssuedAt,omitempty"`
+	TokenExpiresAt int64  `json:"tokenExpiresAt,omitempty"`
+
+	// Scopes are the API groups the token can access. Tokens are not scoped down, they get every scope of the user's roles
+	Scopes []string `json:"scopes"`
+}
@@ -0,0 +1,84 @@
+package dx
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// ImageUpdateTagVar is the var that holds the image tag in the manifests of image update deploys
+const ImageUpdateTagVar = "IMAGE_TAG"
+
+// ImageUpdate deploys the new tags of a container image without CI pushing an artifact.
+// The latest deployed artifact of the app in the env is redeployed with the new tag in the IMAGE_TAG var
+type ImageUpdate struct {
+	// Image is the image in the container registry, eg.: ghcr.io/gimlet-io/gimletd
+	Image string `yaml:"image" json:"image"`
+	// Tag is a regular expression the tags must match. Matching tags are ordered alphabetically
+	Tag string `yaml:"tag,omitempty" json:"tag,omitempty"`
+	// Semver is a semantic version range the tags must fall in, eg.: ">=1.2.0 <2.0.0"
+	Semver string `yaml:"semver,omitempty" json:"semver,omitempty"`
+}
+
+// Latest returns the latest tag that matches the policy, empty if none does
+func (u *ImageUpdate) Latest(tags []string) (string, error) {
+	var pattern *regexp.Regexp
+	if u.Tag != "" {
+		var err error
+		pattern, err = regexp.Compile(u.Tag)
+		if err != nil {
+			return "", fmt.Errorf("invalid tag pattern %s: %s", u.Tag, err)
+		}
+	}
+	var constraint *semver.Constraints
+	if u.Semver != "" {
+		var err error
+		constraint, err = semver.NewConstraint(u.Semver)
+		if err != nil {
+			return "", fmt.Errorf("invalid semver range %s: %s", u.Semver, err)
+		}
+	}
+
+	var matching []string
+	for _, tag := range tags {
+		if pattern != nil && !pattern.MatchString(tag) {
+			continue
+		}
+		if constraint != nil {
+			version, err := semver.NewVersion(tag)
+			if err != nil || !constraint.Check(version) {
+				continue
+			}
+		}
+		matching = append(matching, tag)
+	}
+	if len(matching) == 0 {
+		return "", nil
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return u.less(matching[i], matching[j])
+	})
+	return matching[len(matching)-1], nil
+}
+
+// Newer tells if the tag is ahead of the current one in the order of the policy
+func (u *ImageUpdate) Newer(tag string, current string) bool {
+	if current == "" {
+		return true
+	}
+	return u.less(current, tag)
+}
+
+func (u *ImageUpdate) less(a string, b string) bool {
+	if u.Semver != "" {
+		versionA, errA := semver.NewVersion(a)
+		versionB, errB := semver.NewVersion(b)
+		if errA == nil && errB == nil {
+			return versionA.LessThan(versionB)
+		}
+	}
+	return a < b
+}
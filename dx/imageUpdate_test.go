@@ -0,0 +1,30 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_imageUpdateLatest(t *testing.T) {
+	tags := []string{"latest", "1.2.0", "1.10.1", "1.9.3", "2.0.0", "main-a1b2c3d", "main-f0e1d2c"}
+
+	semverPolicy := &ImageUpdate{Semver: ">=1.2.0 <2.0.0"}
+	latest, err := semverPolicy.Latest(tags)
+	assert.Nil(t, err)
+	assert.Equal(t, "1.10.1", latest, "should order by semver, not alphabetically")
+	assert.True(t, semverPolicy.Newer("1.10.1", "1.9.3"))
+	assert.False(t, semverPolicy.Newer("1.9.3", "1.10.1"))
+
+	patternPolicy := &ImageUpdate{Tag: "^main-[0-9a-f]{7}$"}
+	latest, err = patternPolicy.Latest(tags)
+	assert.Nil(t, err)
+	assert.Equal(t, "main-f0e1d2c", latest)
+
+	latest, err = (&ImageUpdate{Tag: "^release-"}).Latest(tags)
+	assert.Nil(t, err)
+	assert.Equal(t, "", latest, "no tag matches")
+
+	_, err = (&ImageUpdate{Semver: "not a range"}).Latest(tags)
+	assert.NotNil(t, err)
+}
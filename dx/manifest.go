@@ -1,14 +1,14 @@
 package dx
 
 import (
-	"bytes"
 	"fmt"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 
-	"github.com/Masterminds/sprig/v3"
-	"sigs.k8s.io/yaml"
 )
 
 type Manifest struct {
@@ -17,10 +17,48 @@ type Manifest struct {
 	Namespace             string                 `yaml:"namespace" json:"namespace"`
 	Deploy                *Deploy                `yaml:"deploy,omitempty" json:"deploy,omitempty"`
 	Cleanup               *Cleanup               `yaml:"cleanup,omitempty" json:"cleanup,omitempty"`
+	ImageUpdate           *ImageUpdate           `yaml:"imageUpdate,omitempty" json:"imageUpdate,omitempty"`
 	Chart                 Chart                  `yaml:"chart" json:"chart"`
 	Values                map[string]interface{} `yaml:"values" json:"values"`
 	StrategicMergePatches string                 `yaml:"strategicMergePatches" json:"strategicMergePatches"`
 	Json6902Patches       string                 `yaml:"json6902Patches" json:"json6902Patches"`
+
+	// ValuesFiles are values files in the app repo, eg. .gimlet/values-prod.yaml, merged in the declared order under Values.
+	// CI embeds their contents in ValuesFileContents, see ArtifactBuilder.WithValuesFiles
+	ValuesFiles []string `yaml:"valuesFiles,omitempty" json:"valuesFiles,omitempty"`
+	// ValuesFileContents are the contents of the values files by path
+	ValuesFileContents map[string]string `yaml:"valuesFileContents,omitempty" json:"valuesFileContents,omitempty"`
+
+	// Secrets are sealed when the artifact is saved, their plaintext is never stored. See SealArtifactSecrets
+	Secrets map[string]string `yaml:"secrets,omitempty" json:"secrets,omitempty"`
+	// SealedSecrets are the encrypted secrets, set by GimletD or sealed in CI
+	SealedSecrets map[string]string `yaml:"sealedSecrets,omitempty" json:"sealedSecrets,omitempty"`
+
+	// Variants deploy the app multiple times to the env, see ExpandVariants
+	Variants []*Variant `yaml:"variants,omitempty" json:"variants,omitempty"`
+	// Variant is the name of the variant on expanded manifests
+	Variant string `yaml:"variant,omitempty" json:"variant,omitempty"`
+
+	// DependsOn are the apps of the artifact that are deployed to the env before this one, see OrderByDependencies
+	DependsOn []string `yaml:"dependsOn,omitempty" json:"dependsOn,omitempty"`
+	// WaitForDependencies holds back the deploy until Flux applied the dependencies successfully
+	WaitForDependencies bool `yaml:"waitForDependencies,omitempty" json:"waitForDependencies,omitempty"`
+
+	// Shadow deploys commit the manifests under ShadowFolder, that Flux doesn't sync.
+	// It previews what a new env or chart version would produce, without affecting the clusters
+	Shadow bool `yaml:"shadow,omitempty" json:"shadow,omitempty"`
+}
+
+// ShadowFolder holds the manifests of shadow deploys in the gitops repo, by env and app.
+// It is not an env folder, Flux doesn't sync it
+const ShadowFolder = ".shadow"
+
+// GitopsFolder is the folder of the env in the gitops repo that the manifest is written to
+func (m *Manifest) GitopsFolder() string {
+	if m.Shadow {
+		return filepath.Join(ShadowFolder, m.Env)
+	}
+	return m.Env
 }
 
 type Chart struct {
@@ -33,70 +71,249 @@ type Deploy struct {
 	Tag    string    `yaml:"tag,omitempty" json:"tag,omitempty"`
 	Branch string    `yaml:"branch,omitempty" json:"branch,omitempty"`
 	Event  *GitEvent `yaml:"event,omitempty" json:"event,omitempty"`
+
+	// RequiredItems are the artifact items that must be present before deploying.
+	// An item matches if it has all the listed fields with the listed values, eg.: {name: security-scan, result: passed}
+	RequiredItems []map[string]string `yaml:"requiredItems,omitempty" json:"requiredItems,omitempty"`
+}
+
+// MissingItems returns the required items that the artifact doesn't have, in a human readable form
+func (d *Deploy) MissingItems(artifact *Artifact) []string {
+	var missing []string
+	for _, required := range d.RequiredItems {
+		found := false
+		for _, item := range artifact.Items {
+			if itemMatches(item, required) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, describeItem(required))
+		}
+	}
+	return missing
+}
+
+func itemMatches(item map[string]interface{}, required map[string]string) bool {
+	for k, v := range required {
+		value, ok := item[k]
+		if !ok || fmt.Sprint(value) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func describeItem(required map[string]string) string {
+	var fields []string
+	for k, v := range required {
+		if k == "name" {
+			continue
+		}
+		fields = append(fields, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(fields)
+
+	if name, ok := required["name"]; ok {
+		if len(fields) == 0 {
+			return name
+		}
+		return fmt.Sprintf("%s with %s", name, strings.Join(fields, ", "))
+	}
+	return strings.Join(fields, ", ")
 }
 
 type Cleanup struct {
-	AppToCleanup string       `yaml:"app" json:"app"`
-	Event        CleanupEvent `yaml:"event" json:"event"`
-	Branch       string       `yaml:"branch,omitempty" json:"branch,omitempty"`
+	AppToCleanup string `yaml:"app" json:"app"`
+	// AppsToCleanup are further apps that are cleaned up together, eg. the apps of a preview env
+	AppsToCleanup []string     `yaml:"apps,omitempty" json:"apps,omitempty"`
+	Event         CleanupEvent `yaml:"event" json:"event"`
+	Branch        string       `yaml:"branch,omitempty" json:"branch,omitempty"`
 }
 
-func (m *Manifest) ResolveVars(vars map[string]string) error {
-	cleanupBkp := m.Cleanup
-	m.Cleanup = nil // cleanup only supports the BRANCH variable, not resolving it here
-	manifestString, err := yaml.Marshal(m)
-	if err != nil {
-		return fmt.Errorf("cannot marshal manifest %s", err.Error())
+// Apps returns the distinct apps to clean up
+func (c *Cleanup) Apps() []string {
+	var apps []string
+	seen := map[string]bool{}
+	for _, app := range append([]string{c.AppToCleanup}, c.AppsToCleanup...) {
+		if app == "" || seen[app] {
+			continue
+		}
+		seen[app] = true
+		apps = append(apps, app)
 	}
+	return apps
+}
 
-	functions := make(map[string]interface{})
-	for k, v := range sprig.GenericFuncMap() {
-		functions[k] = v
+// CleanupVars are the vars that cleanup policies can refer to:
+// BRANCH, SANITIZED_BRANCH that is the branch as a DNS name, and REPO, the owner/name of the repository
+func CleanupVars(branch string, repo string) map[string]string {
+	return map[string]string{
+		"BRANCH":           branch,
+		"SANITIZED_BRANCH": sanitizeDNSName(branch),
+		"REPO":             repo,
 	}
-	functions["sanitizeDNSName"] = sanitizeDNSName
-	tpl, err := template.New("").
-		Funcs(functions).
-		Parse(string(manifestString))
+}
+
+func (m *Manifest) ResolveVars(vars map[string]string) error {
+	vars, err := m.withBuiltinVars(vars)
 	if err != nil {
 		return err
 	}
 
-	var templated bytes.Buffer
-	err = tpl.Execute(&templated, vars)
+	resolved, err := resolveValue(reflect.ValueOf(*m), vars)
 	if err != nil {
 		return err
 	}
+	cleanupBkp := m.Cleanup               // cleanup only supports the CleanupVars, not resolving it here
+	patchesBkp := m.StrategicMergePatches // patches are resolved at deploy time, with the env metadata, see ResolvePatches
+	*m = resolved.Interface().(Manifest)
+	m.Cleanup = cleanupBkp
+	m.StrategicMergePatches = patchesBkp
+	return nil
+}
+
+// withBuiltinVars extends the vars with the Env, Variant, App and Namespace of the manifest.
+// Vars provided by CI take precedence over the built-in ones
+func (m *Manifest) withBuiltinVars(vars map[string]string) (map[string]string, error) {
+	extended := map[string]string{
+		"Env":     m.Env,
+		"Variant": m.Variant,
+	}
+	for k, v := range vars {
+		extended[k] = v
+	}
 
-	err = yaml.Unmarshal(templated.Bytes(), m)
-	m.Cleanup = cleanupBkp // restoring Cleanup after vars are resolved
-	return err
+	app, err := resolve(m.App, extended)
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := resolve(m.Namespace, extended)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := vars["App"]; !ok {
+		extended["App"] = app
+	}
+	if _, ok := vars["Namespace"]; !ok {
+		extended["Namespace"] = namespace
+	}
+
+	return extended, nil
 }
 
 func (c *Cleanup) ResolveVars(vars map[string]string) error {
-	cleanupPolicyString, err := yaml.Marshal(c)
+	resolved, err := resolveValue(reflect.ValueOf(*c), vars)
 	if err != nil {
-		return fmt.Errorf("cannot marshal cleanup policy %s", err.Error())
+		return err
 	}
+	*c = resolved.Interface().(Cleanup)
+	return nil
+}
 
-	functions := make(map[string]interface{})
-	for k, v := range sprig.GenericFuncMap() {
-		functions[k] = v
+// resolveValue returns a copy of the value with the vars resolved in its string leaves and map keys.
+// Other leaves keep their types, and strings are never re-parsed, so numbers, booleans and multiline strings stay intact
+func resolveValue(v reflect.Value, vars map[string]string) (reflect.Value, error) {
+	switch v.Kind() {
+	case reflect.String:
+		if !strings.Contains(v.String(), "{{") {
+			return v, nil
+		}
+		templated, err := resolve(v.String(), vars)
+		if err != nil {
+			return v, err
+		}
+		resolved := reflect.New(v.Type()).Elem()
+		resolved.SetString(templated)
+		return resolved, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v, nil
+		}
+		elem, err := resolveValue(v.Elem(), vars)
+		if err != nil {
+			return v, err
+		}
+		if v.Kind() == reflect.Ptr {
+			resolved := reflect.New(v.Type().Elem())
+			resolved.Elem().Set(elem)
+			return resolved, nil
+		}
+		resolved := reflect.New(v.Type()).Elem()
+		resolved.Set(elem)
+		return resolved, nil
+	case reflect.Struct:
+		resolved := reflect.New(v.Type()).Elem()
+		resolved.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" { // unexported
+				continue
+			}
+			field, err := resolveValue(v.Field(i), vars)
+			if err != nil {
+				return v, err
+			}
+			resolved.Field(i).Set(field)
+		}
+		return resolved, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return v, nil
+		}
+		resolved := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := resolveValue(iter.Key(), vars)
+			if err != nil {
+				return v, err
+			}
+			value, err := resolveValue(iter.Value(), vars)
+			if err != nil {
+				return v, err
+			}
+			resolved.SetMapIndex(key, value)
+		}
+		return resolved, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return v, nil
+		}
+		resolved := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := resolveValue(v.Index(i), vars)
+			if err != nil {
+				return v, err
+			}
+			resolved.Index(i).Set(item)
+		}
+		return resolved, nil
+	default:
+		return v, nil
 	}
-	functions["sanitizeDNSName"] = sanitizeDNSName
+}
+
+// resolve renders the template with the restricted template functions, within the template limits
+func resolve(templateString string, vars interface{}) (string, error) {
 	tpl, err := template.New("").
-		Funcs(functions).
-		Parse(string(cleanupPolicyString))
+		Funcs(templateFunctions()).
+		Parse(templateString)
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	var templated bytes.Buffer
-	err = tpl.Execute(&templated, vars)
+	err = countIterations(tpl)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return yaml.Unmarshal(templated.Bytes(), c)
+	return WithTemplateLimits(func() (string, error) {
+		templated := &limitedBuffer{max: templateLimits.MaxOutputBytes}
+		err := tpl.Execute(templated, vars)
+		if err != nil {
+			return "", err
+		}
+		return templated.String(), nil
+	})
 }
 
 // adheres to the Kubernetes resource name spec:
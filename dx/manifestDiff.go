@@ -0,0 +1,213 @@
+package dx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"sigs.k8s.io/yaml"
+)
+
+// MaxManifestDiffBytes caps the diff that is stored on the event record
+const MaxManifestDiffBytes = 256 * 1024
+
+// maxSummaryItems caps the image and replica changes listed in the summary
+const maxSummaryItems = 5
+
+// ManifestDiff is the change a deploy made to the manifests of an app in the gitops repo
+type ManifestDiff struct {
+	// Images are the changed container images, eg.: Deployment/my-app/app: nginx:1.20 -> nginx:1.21
+	Images []string `json:"images,omitempty"`
+	// Replicas are the changed replica counts, eg.: Deployment/my-app: 1 -> 3
+	Replicas []string `json:"replicas,omitempty"`
+	Added    int      `json:"added"`
+	Removed  int      `json:"removed"`
+
+	// Diff is the unified diff of the manifests, truncated to MaxManifestDiffBytes
+	Diff      string `json:"diff,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Empty tells if the manifests did not change
+func (d *ManifestDiff) Empty() bool {
+	return d == nil || d.Added == 0 && d.Removed == 0
+}
+
+// Summary is a short, human readable description of the diff, eg. for notifications
+func (d *ManifestDiff) Summary() string {
+	if d.Empty() {
+		return "no manifest changes"
+	}
+
+	var parts []string
+	if len(d.Images) > 0 {
+		parts = append(parts, "images changed: "+summaryList(d.Images))
+	}
+	if len(d.Replicas) > 0 {
+		parts = append(parts, "replicas changed: "+summaryList(d.Replicas))
+	}
+	parts = append(parts, fmt.Sprintf("+%d/-%d lines", d.Added, d.Removed))
+	return strings.Join(parts, ", ")
+}
+
+func summaryList(items []string) string {
+	if len(items) <= maxSummaryItems {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:maxSummaryItems], ", "), len(items)-maxSummaryItems)
+}
+
+// DiffManifests compares the previous and the current manifest files of an app, keyed by file name
+func DiffManifests(previous map[string]string, current map[string]string) *ManifestDiff {
+	manifestDiff := &ManifestDiff{}
+
+	var b strings.Builder
+	for _, name := range fileNames(previous, current) {
+		chunks := diff.Do(previous[name], current[name])
+		if len(chunks) == 0 || len(chunks) == 1 && chunks[0].Type == diffmatchpatch.DiffEqual {
+			continue
+		}
+
+		fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", name, name)
+		for _, chunk := range chunks {
+			var prefix string
+			switch chunk.Type {
+			case diffmatchpatch.DiffInsert:
+				prefix = "+"
+			case diffmatchpatch.DiffDelete:
+				prefix = "-"
+			default:
+				continue
+			}
+			for _, line := range strings.SplitAfter(chunk.Text, "\n") {
+				if line == "" {
+					continue
+				}
+				if prefix == "+" {
+					manifestDiff.Added++
+				} else {
+					manifestDiff.Removed++
+				}
+				b.WriteString(prefix + strings.TrimSuffix(line, "\n") + "\n")
+			}
+		}
+	}
+
+	manifestDiff.Diff = b.String()
+	if len(manifestDiff.Diff) > MaxManifestDiffBytes {
+		manifestDiff.Diff = manifestDiff.Diff[:MaxManifestDiffBytes]
+		manifestDiff.Truncated = true
+	}
+
+	previousWorkloads := workloads(previous)
+	currentWorkloads := workloads(current)
+	var keys []string
+	for key := range currentWorkloads {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		p, c := previousWorkloads[key], currentWorkloads[key]
+		if p == nil {
+			continue
+		}
+		if p.replicas != c.replicas {
+			manifestDiff.Replicas = append(manifestDiff.Replicas, fmt.Sprintf("%s: %s -> %s", key, p.replicas, c.replicas))
+		}
+		var containers []string
+		for name := range c.images {
+			containers = append(containers, name)
+		}
+		sort.Strings(containers)
+		for _, name := range containers {
+			if previousImage, ok := p.images[name]; ok && previousImage != c.images[name] {
+				manifestDiff.Images = append(manifestDiff.Images, fmt.Sprintf("%s/%s: %s -> %s", key, name, previousImage, c.images[name]))
+			}
+		}
+	}
+
+	return manifestDiff
+}
+
+// workload holds the fields of a Kubernetes workload that are highlighted in the diff summary
+type workload struct {
+	replicas string
+	images   map[string]string
+}
+
+type workloadResource struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas *int `json:"replicas"`
+		Template struct {
+			Spec podSpec `json:"spec"`
+		} `json:"template"`
+		JobTemplate struct {
+			Spec struct {
+				Template struct {
+					Spec podSpec `json:"spec"`
+				} `json:"template"`
+			} `json:"spec"`
+		} `json:"jobTemplate"`
+	} `json:"spec"`
+}
+
+type podSpec struct {
+	InitContainers []container `json:"initContainers"`
+	Containers     []container `json:"containers"`
+}
+
+type container struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+// workloads returns the workloads of the manifest files by kind/name
+func workloads(files map[string]string) map[string]*workload {
+	result := map[string]*workload{}
+	for _, content := range files {
+		for _, doc := range strings.Split(content, "\n---") {
+			var resource workloadResource
+			if err := yaml.Unmarshal([]byte(doc), &resource); err != nil || resource.Kind == "" {
+				continue
+			}
+
+			w := &workload{images: map[string]string{}}
+			if resource.Spec.Replicas != nil {
+				w.replicas = fmt.Sprintf("%d", *resource.Spec.Replicas)
+			}
+			spec := resource.Spec.Template.Spec
+			if resource.Kind == "CronJob" {
+				spec = resource.Spec.JobTemplate.Spec.Template.Spec
+			}
+			for _, c := range append(spec.InitContainers, spec.Containers...) {
+				w.images[c.Name] = c.Image
+			}
+			if w.replicas == "" && len(w.images) == 0 {
+				continue
+			}
+			result[resource.Kind+"/"+resource.Metadata.Name] = w
+		}
+	}
+	return result
+}
+
+// fileNames returns the sorted union of the file names
+func fileNames(a map[string]string, b map[string]string) []string {
+	var names []string
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
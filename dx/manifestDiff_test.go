@@ -0,0 +1,62 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const deploymentV1 = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: app
+          image: nginx:1.20
+`
+
+const deploymentV2 = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: app
+          image: nginx:1.21
+`
+
+const service = `apiVersion: v1
+kind: Service
+metadata:
+  name: my-app
+`
+
+func Test_diffManifests(t *testing.T) {
+	diff := DiffManifests(
+		map[string]string{"deployment.yaml": deploymentV1, "service.yaml": service},
+		map[string]string{"deployment.yaml": deploymentV2, "service.yaml": service, "configmap.yaml": "kind: ConfigMap\n"},
+	)
+
+	assert.Equal(t, []string{"Deployment/my-app/app: nginx:1.20 -> nginx:1.21"}, diff.Images)
+	assert.Equal(t, []string{"Deployment/my-app: 1 -> 3"}, diff.Replicas)
+	assert.Equal(t, 3, diff.Added)
+	assert.Equal(t, 2, diff.Removed)
+	assert.Contains(t, diff.Diff, "-  replicas: 1\n+  replicas: 3\n")
+	assert.Contains(t, diff.Diff, "+++ b/configmap.yaml\n+kind: ConfigMap\n")
+	assert.NotContains(t, diff.Diff, "service.yaml", "unchanged files should be left out")
+	assert.Equal(t,
+		"images changed: Deployment/my-app/app: nginx:1.20 -> nginx:1.21, replicas changed: Deployment/my-app: 1 -> 3, +3/-2 lines",
+		diff.Summary(),
+	)
+
+	diff = DiffManifests(map[string]string{"service.yaml": service}, map[string]string{"service.yaml": service})
+	assert.True(t, diff.Empty())
+	assert.Equal(t, "no manifest changes", diff.Summary())
+}
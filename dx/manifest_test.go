@@ -50,6 +50,33 @@ func Test_resolveVars(t *testing.T) {
 	assert.Equal(t, "debian:feature-my-feature", m.Values["image"])
 }
 
+func Test_ResolveVarsPreservesTypes(t *testing.T) {
+	values := map[string]interface{}{
+		"replicas": 3,
+		"debug":    true,
+		"ratio":    0.5,
+		"version":  "1.10",
+		"config":   "line: {{ .MESSAGE }}\nother: line\n",
+		"ports":    []interface{}{8080, "{{ .PORT }}"},
+	}
+	m := &Manifest{
+		App:     "my-app",
+		Values:  values,
+		Cleanup: &Cleanup{AppToCleanup: "my-app-{{ .BRANCH }}"},
+	}
+
+	err := m.ResolveVars(map[string]string{"MESSAGE": "it's: #1\n- broken yaml", "PORT": "9090"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, m.Values["replicas"])
+	assert.Equal(t, true, m.Values["debug"])
+	assert.Equal(t, 0.5, m.Values["ratio"])
+	assert.Equal(t, "1.10", m.Values["version"])
+	assert.Equal(t, "line: it's: #1\n- broken yaml\nother: line\n", m.Values["config"])
+	assert.Equal(t, []interface{}{8080, "9090"}, m.Values["ports"])
+	assert.Equal(t, "my-app-{{ .BRANCH }}", m.Cleanup.AppToCleanup, "cleanup is resolved separately")
+	assert.Equal(t, "{{ .PORT }}", values["ports"].([]interface{})[1], "the original values should not change")
+}
+
 func Test_sanitizeDNSName(t *testing.T) {
 	sanitized := sanitizeDNSName("CamelCase_with_snake")
 	assert.Equal(t, "camelcase-with-snake", sanitized)
@@ -66,3 +93,77 @@ func Test_sanitizeDNSName(t *testing.T) {
 	sanitized = sanitizeDNSName("dope")
 	assert.Equal(t, "dope", sanitized)
 }
+
+func Test_resolveBuiltinVars(t *testing.T) {
+	a := &Artifact{
+		ID: "my-app-1234",
+		Version: Version{
+			SHA:    "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+			Branch: "feature/my-feature",
+		},
+	}
+
+	m := &Manifest{
+		App:       "my-app-{{ .GitBranch | sanitizeDNSName }}",
+		Env:       "staging",
+		Namespace: "{{ .Env }}",
+		Values: map[string]interface{}{
+			"image":      "debian:{{ .GitSHA }}",
+			"host":       "{{ .App }}.{{ .Namespace }}.example.com",
+			"artifactId": "{{ .ArtifactID }}",
+		},
+	}
+
+	err := m.ResolveVars(a.Vars())
+	assert.Nil(t, err)
+	assert.Equal(t, "my-app-feature-my-feature", m.App)
+	assert.Equal(t, "staging", m.Namespace)
+	assert.Equal(t, "debian:ea9ab7cc31b2599bf4afcfd639da516ca27a4780", m.Values["image"])
+	assert.Equal(t, "my-app-feature-my-feature.staging.example.com", m.Values["host"])
+	assert.Equal(t, "my-app-1234", m.Values["artifactId"])
+
+	m = &Manifest{
+		App: "my-app",
+		Env: "staging",
+		Values: map[string]interface{}{
+			"env": "{{ .Env }}",
+		},
+	}
+	err = m.ResolveVars(map[string]string{"Env": "from-ci"})
+	assert.Nil(t, err)
+	assert.Equal(t, "from-ci", m.Values["env"], "CI provided vars should take precedence")
+}
+
+func Test_missingItems(t *testing.T) {
+	deploy := &Deploy{
+		RequiredItems: []map[string]string{
+			{"name": "security-scan", "result": "passed"},
+			{"name": "CI"},
+		},
+	}
+
+	a := &Artifact{
+		Items: []map[string]interface{}{
+			{"name": "CI", "url": "https://jenkins.example.com/job/dev/84"},
+			{"name": "security-scan", "result": "failed"},
+		},
+	}
+	assert.Equal(t, []string{"security-scan with result=passed"}, deploy.MissingItems(a))
+
+	a.Items[1]["result"] = "passed"
+	assert.Empty(t, deploy.MissingItems(a))
+}
+
+func Test_cleanupApps(t *testing.T) {
+	cleanup := &Cleanup{
+		AppToCleanup:  "my-app-{{ .SANITIZED_BRANCH }}",
+		AppsToCleanup: []string{"my-db-{{ .SANITIZED_BRANCH }}", "{{ .REPO | base }}-{{ .BRANCH }}", "my-app-{{ .SANITIZED_BRANCH }}"},
+		Event:         BranchDeleted,
+		Branch:        "feature/*",
+	}
+
+	err := cleanup.ResolveVars(CleanupVars("feature/My_Feature", "gimlet-io/my-app"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"my-app-feature-my-feature", "my-db-feature-my-feature", "my-app-feature/My_Feature"}, cleanup.Apps(), "should dedupe the apps")
+	assert.Equal(t, []string{"my-db"}, (&Cleanup{AppsToCleanup: []string{"my-db"}}).Apps())
+}
@@ -0,0 +1,73 @@
+package dx
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ResolvePatches resolves the vars and the template conditionals of the strategic merge patches.
+// Besides the vars of ResolveVars, the patches see the metadata of the env, so a patch can be limited to some envs, eg.:
+//
+//	{{ if eq .EnvMetadata.tier "production" }}
+//	apiVersion: autoscaling/v2beta2
+//	kind: HorizontalPodAutoscaler
+//	...
+//	{{ end }}
+//
+// Documents that resolve to nothing are dropped, and the remaining ones must still parse as YAML
+func (m *Manifest) ResolvePatches(vars map[string]string, env *Env) error {
+	if m.StrategicMergePatches == "" {
+		return nil
+	}
+
+	vars, err := m.withBuiltinVars(vars)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{}
+	for k, v := range vars {
+		data[k] = v
+	}
+	metadata := map[string]string{}
+	if env != nil {
+		for k, v := range env.Metadata {
+			metadata[k] = v
+		}
+	}
+	data["EnvMetadata"] = metadata
+
+	templated, err := resolve(m.StrategicMergePatches, data)
+	if err != nil {
+		return fmt.Errorf("cannot resolve the strategic merge patches: %s", err)
+	}
+
+	var patches []string
+	for _, doc := range splitYAMLDocuments(templated) {
+		var patch map[string]interface{}
+		err = yaml.Unmarshal([]byte(doc), &patch)
+		if err != nil {
+			return fmt.Errorf("strategic merge patch doesn't parse after resolving the vars: %s", err)
+		}
+		if patch == nil {
+			continue // a comment only document
+		}
+		patches = append(patches, doc)
+	}
+
+	m.StrategicMergePatches = strings.Join(patches, "\n---\n")
+	return nil
+}
+
+// splitYAMLDocuments returns the non-empty documents of a multi-document YAML
+func splitYAMLDocuments(content string) []string {
+	var docs []string
+	for _, doc := range strings.Split("\n"+content, "\n---") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		docs = append(docs, strings.TrimPrefix(doc, "\n"))
+	}
+	return docs
+}
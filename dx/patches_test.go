@@ -0,0 +1,69 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const conditionalPatches = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .App }}
+spec:
+  template:
+    metadata:
+      annotations:
+        gitSha: "{{ .GitSHA }}"
+{{- if eq .EnvMetadata.tier "production" }}
+---
+apiVersion: autoscaling/v2beta2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: {{ .App }}
+spec:
+  minReplicas: 3
+{{- end }}
+`
+
+func Test_resolvePatches(t *testing.T) {
+	production := &Env{Name: "production", Metadata: map[string]string{"tier": "production"}}
+	staging := &Env{Name: "staging"}
+	vars := map[string]string{"GitSHA": "ea9ab7cc"}
+
+	m := &Manifest{App: "my-app", Env: "production", StrategicMergePatches: conditionalPatches}
+	err := m.ResolvePatches(vars, production)
+	assert.Nil(t, err)
+	assert.Contains(t, m.StrategicMergePatches, `gitSha: "ea9ab7cc"`)
+	assert.Contains(t, m.StrategicMergePatches, "kind: HorizontalPodAutoscaler", "should add the patch in the production tier")
+
+	m = &Manifest{App: "my-app", Env: "staging", StrategicMergePatches: conditionalPatches}
+	err = m.ResolvePatches(vars, staging)
+	assert.Nil(t, err)
+	assert.Contains(t, m.StrategicMergePatches, "kind: Deployment")
+	assert.NotContains(t, m.StrategicMergePatches, "HorizontalPodAutoscaler", "should leave out the patch without the metadata")
+	assert.NotContains(t, m.StrategicMergePatches, "---", "should drop the empty documents")
+
+	m = &Manifest{App: "my-app", Env: "staging", StrategicMergePatches: `{{ if eq .Env "production" }}
+kind: HorizontalPodAutoscaler
+{{ end }}`}
+	err = m.ResolvePatches(vars, staging)
+	assert.Nil(t, err)
+	assert.Equal(t, "", m.StrategicMergePatches, "should resolve to no patches")
+
+	m = &Manifest{App: "my-app", Env: "staging", StrategicMergePatches: `
+kind: Deployment
+metadata:
+  name: {{ .App }}
+  labels: {{ .Labels }}`}
+	err = m.ResolvePatches(map[string]string{"Labels": "{broken"}, staging)
+	assert.NotNil(t, err, "should fail if a var breaks the patch")
+}
+
+func Test_resolveVarsKeepsPatches(t *testing.T) {
+	m := &Manifest{App: "my-app", Env: "staging", StrategicMergePatches: conditionalPatches}
+	err := m.ResolveVars(map[string]string{"GitSHA": "ea9ab7cc"})
+	assert.Nil(t, err)
+	assert.Equal(t, conditionalPatches, m.StrategicMergePatches, "should leave the patches for ResolvePatches, that has the env metadata")
+}
@@ -0,0 +1,50 @@
+package dx
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+)
+
+const RoleAdmin = "admin"
+
+// RBACRule grants a role to the members of a group, eg.: {group: platform, role: admin}.
+// Groups are synced from the teams of the SCM organization
+type RBACRule struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// ParseRBACRules parses a YAML list of RBAC rules
+func ParseRBACRules(rules string) ([]*RBACRule, error) {
+	var parsed []*RBACRule
+	err := yaml.Unmarshal([]byte(rules), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse RBAC rules: %s", err)
+	}
+
+	for _, rule := range parsed {
+		if rule.Group == "" {
+			return nil, fmt.Errorf("RBAC rule without a group")
+		}
+		if rule.Role != RoleAdmin {
+			return nil, fmt.Errorf("RBAC rule of group %s has unknown role %q, roles are: %s", rule.Group, rule.Role, RoleAdmin)
+		}
+	}
+	return parsed, nil
+}
+
+// GrantsRole tells if any of the rules grants the role to a member of the given groups
+func GrantsRole(rules []*RBACRule, groups []string, role string) bool {
+	for _, rule := range rules {
+		if rule.Role != role {
+			continue
+		}
+		for _, group := range groups {
+			if rule.Group == group {
+				return true
+			}
+		}
+	}
+	return false
+}
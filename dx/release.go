@@ -15,6 +15,27 @@ type Release struct {
 	Created    int64  `json:"created,omitempty"`
 
 	RolledBack bool `json:"rolledBack,omitempty"`
+
+	// Type is what the gitops commit did to the app: deploy, rollback or delete
+	Type string `json:"type,omitempty"`
+
+	// RevertedRef is the gitops commit that a rollback reverted.
+	// The version and the artifact of rollbacks are of the reverted release
+	RevertedRef string `json:"revertedRef,omitempty"`
+}
+
+const ReleaseTypeDeploy = "deploy"
+const ReleaseTypeRollback = "rollback"
+const ReleaseTypeDelete = "delete"
+
+// RenderedManifests holds the files of an app as they were written to the gitops repo in a commit
+type RenderedManifests struct {
+	Env       string            `json:"env"`
+	App       string            `json:"app"`
+	GitopsRef string            `json:"gitopsRef"`
+	Files     map[string]string `json:"files"`
+	// Shadow manifests are in the ShadowFolder, they are not synced to the cluster
+	Shadow bool `json:"shadow,omitempty"`
 }
 
 // ReleaseRequest contains all metadata about the release intent
@@ -23,6 +44,20 @@ type ReleaseRequest struct {
 	App         string `json:"app,omitempty"`
 	ArtifactID  string `json:"artifactId"`
 	TriggeredBy string `json:"triggeredBy"`
+
+	// Redeploy rolls forward to an older artifact, that must have been deployed to the env before,
+	// without being rolled back or failing to apply
+	Redeploy bool `json:"redeploy,omitempty"`
+}
+
+// ReevaluationRequest re-runs the deploy policies of a stored artifact, eg. after the default deploy policies changed.
+// It deploys to the envs that match now, but were not deployed by the artifact before
+type ReevaluationRequest struct {
+	ArtifactID  string `json:"artifactId"`
+	TriggeredBy string `json:"triggeredBy"`
+
+	// Force deploys to the apps that are within their rollback protection window too
+	Force bool `json:"force,omitempty"`
 }
 
 // RollbackRequest contains all metadata about the rollback intent
@@ -31,6 +66,91 @@ type RollbackRequest struct {
 	App         string `json:"app"`
 	TargetSHA   string `json:"targetSHA"`
 	TriggeredBy string `json:"triggeredBy"`
+
+	// Force reverts the commits that were not made by GimletD too, eg. a manual hotfix in the gitops repo
+	Force bool `json:"force,omitempty"`
+}
+
+// CompactionRequest contains all metadata about the gitops history compaction intent
+type CompactionRequest struct {
+	Before int64  `json:"before"`
+	Env    string `json:"env"`
+	// App is the app folder to compact, a glob pattern, eg. my-app-pr-* for the preview apps
+	App         string `json:"app"`
+	TriggeredBy string `json:"triggeredBy"`
+}
+
+// DeleteRequest contains all metadata about the intent of deleting an app from an env
+type DeleteRequest struct {
+	Env         string `json:"env"`
+	App         string `json:"app"`
+	TriggeredBy string `json:"triggeredBy"`
+}
+
+// DeleteConfirmation is the token that has to be sent back to confirm deleting an app
+type DeleteConfirmation struct {
+	ConfirmationToken string `json:"confirmationToken"`
+	Expires           int64  `json:"expires"`
+}
+
+// Maintenance is the state of the maintenance mode.
+// During maintenance the gitops queue is paused and new release requests are rejected
+type Maintenance struct {
+	Enabled     bool   `json:"enabled"`
+	Message     string `json:"message,omitempty"`
+	TriggeredBy string `json:"triggeredBy,omitempty"`
+	Since       int64  `json:"since,omitempty"`
+}
+
+// Freeze is a release freeze of an app in an env, made with the freeze API.
+// Unlike maintenance mode, it only parks the deploys of the app, releases of other apps go on
+type Freeze struct {
+	Env      string `json:"env"`
+	App      string `json:"app"`
+	Reason   string `json:"reason,omitempty"`
+	FrozenBy string `json:"frozenBy"`
+	Since    int64  `json:"since"`
+}
+
+// Frozen returns the freeze of the app in the env, nil if it is not frozen.
+// Freezing an app freezes its variants too
+func Frozen(freezes []*Freeze, env string, app string, baseApp string) *Freeze {
+	for _, freeze := range freezes {
+		if freeze.Env == env && (freeze.App == app || freeze.App == baseApp) {
+			return freeze
+		}
+	}
+	return nil
+}
+
+// EnvSync is a failing Flux sync of an env, recorded from the Flux notification events until the sync succeeds again.
+// Auto-deploys to envs that hold their deploys on sync failures stay queued, unless an admin overrode the hold
+type EnvSync struct {
+	Env          string `json:"env"`
+	Sha          string `json:"sha,omitempty"`
+	Reason       string `json:"reason"`
+	Message      string `json:"message,omitempty"`
+	Since        int64  `json:"since"`
+	OverriddenBy string `json:"overriddenBy,omitempty"`
+}
+
+// FailingSync returns the failing sync of the env, nil if its sync is not failing
+func FailingSync(syncs []*EnvSync, env string) *EnvSync {
+	for _, sync := range syncs {
+		if sync.Env == env {
+			return sync
+		}
+	}
+	return nil
+}
+
+// GitopsHistoryRewrite is a rewrite of the gitops repo history that GimletD did not make, eg. a force push.
+// Rollbacks and the release history may refer to commits that are gone
+type GitopsHistoryRewrite struct {
+	Branch   string `json:"branch,omitempty"`
+	OldHead  string `json:"oldHead"`
+	NewHead  string `json:"newHead"`
+	Detected int64  `json:"detected"`
 }
 
 //GitopsStatus holds the gitops references that were created based on an event
@@ -41,7 +161,36 @@ type GitopsStatus struct {
 }
 
 type ReleaseStatus struct {
-	Status       string         `json:"status"`
-	StatusDesc   string         `json:"statusDesc"`
-	GitopsHashes []GitopsStatus `json:"gitopsHashes"`
+	Status        string         `json:"status"`
+	StatusDesc    string         `json:"statusDesc"`
+	GitopsHashes  []GitopsStatus `json:"gitopsHashes"`
+	CorrelationID string         `json:"correlationId,omitempty"`
+	Envs          []EnvStatus    `json:"envs,omitempty"`
+}
+
+// EventLogs are the last log lines of an event's processing
+type EventLogs struct {
+	ID     string   `json:"id"`
+	Status string   `json:"status"`
+	Lines  []string `json:"lines"`
+}
+
+const EnvStatusSuccess = "success"
+const EnvStatusFailure = "failure"
+const EnvStatusParked = "parked"
+
+// EnvStatusChecking is the status of a pushed deploy that waits for the CI checks of the gitops repo
+const EnvStatusChecking = "checking"
+
+// EnvStatus is the outcome of the deploy of an app in one env.
+// An event that deploys to multiple envs reports each of them, as some may fail while others succeed
+type EnvStatus struct {
+	Env        string `json:"env"`
+	App        string `json:"app"`
+	Status     string `json:"status"`
+	StatusDesc string `json:"statusDesc,omitempty"`
+	GitopsRef  string `json:"gitopsRef,omitempty"`
+
+	// Diff is the change of the app's manifests in the gitops commit
+	Diff *ManifestDiff `json:"diff,omitempty"`
 }
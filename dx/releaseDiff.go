@@ -0,0 +1,35 @@
+package dx
+
+// ReleaseDiff is what changed in an app in an env between two gitops commits,
+// eg. since the last good deploy
+type ReleaseDiff struct {
+	Env string `json:"env"`
+	App string `json:"app"`
+
+	// From and To are the releases of the app at the compared gitops commits
+	From *Release `json:"from"`
+	To   *Release `json:"to"`
+
+	// Images are the changed container images of the rendered manifests, eg.: Deployment/my-app/app: nginx:1.20 -> nginx:1.21
+	Images []string `json:"images"`
+
+	// FromChart and ToChart are the chart references of the releases, empty if the artifact is not found
+	FromChart    string `json:"fromChart,omitempty"`
+	ToChart      string `json:"toChart,omitempty"`
+	ChartChanged bool   `json:"chartChanged"`
+
+	Values []*ValueChange `json:"values"`
+
+	// Commits are the app commits between the artifacts of the releases, newest first.
+	// They are taken from the artifacts that GimletD received from the repository and branch of the To release
+	Commits []*Version `json:"commits"`
+}
+
+// ValueChange is a resolved Helm value that changed between two releases.
+// From is empty if the value was added, To is empty if it was removed
+type ValueChange struct {
+	// Key is the dot separated path of the value, eg.: resources.limits.memory
+	Key  string `json:"key"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
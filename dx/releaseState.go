@@ -0,0 +1,19 @@
+package dx
+
+// ReleaseState is the current release of every app in the gitops repo, as the release state worker last found it
+type ReleaseState struct {
+	// Updated is when the gitops repo was last walked, zero if never
+	Updated  int64              `json:"updated"`
+	Releases []*AppReleaseState `json:"releases"`
+}
+
+// AppReleaseState is the current release of an app in an env
+type AppReleaseState struct {
+	Env string `json:"env"`
+	App string `json:"app"`
+	// Release is empty if the app has no release file
+	Release *Release `json:"release,omitempty"`
+	// GitopsRef is the last gitops commit that touched the app
+	GitopsRef string `json:"gitopsRef"`
+	Created   int64  `json:"created"`
+}
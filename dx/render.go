@@ -0,0 +1,120 @@
+package dx
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gimlet-io/gimletd/dx/kustomize"
+)
+
+// ChartRenderer templates the chart of a resolved manifest with its values, to a multi-document YAML
+type ChartRenderer func(m Manifest) (string, error)
+
+var chartRenderer ChartRenderer
+
+// RegisterChartRenderer sets the chart renderer of Template.
+// The helm package registers its renderer when it is imported:
+//
+//	import _ "github.com/gimlet-io/gimletd/dx/helm"
+func RegisterChartRenderer(renderer ChartRenderer) {
+	chartRenderer = renderer
+}
+
+// Render resolves the manifest the way GimletD does at deploy time, and renders it to the files that are written to the gitops repo.
+// The values files of the manifest are merged under its values.
+// The env is optional: its chart and values are the defaults of the manifest, its metadata is seen by the patches,
+// and its certificate seals the secrets. Platform config overrides are not applied.
+// It is meant for previews in CI or the CLI, git hosted charts must be cloned first, see helm.CloneChartFromRepo
+func Render(m *Manifest, vars map[string]string, env *Env) (map[string]string, error) {
+	err := m.ApplyValuesFiles()
+	if err != nil {
+		return nil, err
+	}
+	m.ApplyEnvDefaults(env)
+	err = m.ResolveVars(vars)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve manifest vars %s", err.Error())
+	}
+	err = m.ResolvePatches(vars, env)
+	if err != nil {
+		return nil, err
+	}
+	err = m.SealSecrets(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return Template(m)
+}
+
+// Template renders a resolved manifest: it templates the chart, applies the strategic merge patches,
+// and splits the output to files named after the chart templates. Sealed secrets are written to sealed-secrets.yaml
+func Template(m *Manifest) (map[string]string, error) {
+	if chartRenderer == nil {
+		return nil, fmt.Errorf("no chart renderer is registered, import github.com/gimlet-io/gimletd/dx/helm")
+	}
+	if len(m.Secrets) > 0 {
+		return nil, fmt.Errorf("secrets must be sealed before writing them to git")
+	}
+
+	templatedManifests, err := chartRenderer(*m)
+	if err != nil {
+		return nil, fmt.Errorf("cannot run helm template %s", err.Error())
+	}
+
+	if m.StrategicMergePatches != "" {
+		templatedManifests, err = kustomize.ApplyPatches(m.StrategicMergePatches, templatedManifests)
+		if err != nil {
+			return nil, fmt.Errorf("cannot apply Kustomize patches to chart %s", err.Error())
+		}
+	}
+
+	files := SplitHelmOutput(map[string]string{"manifest.yaml": templatedManifests})
+
+	if len(m.SealedSecrets) > 0 {
+		files["sealed-secrets.yaml"], err = m.SealedSecretResource()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// SplitHelmOutput splits helm's multifile string output into file paths and their content
+func SplitHelmOutput(input map[string]string) map[string]string {
+	if len(input) != 1 {
+		return input
+	}
+
+	const separator = "---\n# Source: "
+
+	files := map[string]string{}
+
+	for _, content := range input {
+		if !strings.Contains(content, separator) {
+			return input
+		}
+
+		parts := strings.Split(content, separator)
+		for _, p := range parts {
+			p := strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+
+			lines := strings.Split(p, "\n")
+			filePath := lines[0]
+			content := strings.Join(lines[1:], "\n")
+			fileName := filepath.Base(filePath)
+			if existingContent, ok := files[fileName]; ok {
+				files[fileName] = existingContent + "---\n" + content + "\n"
+			} else {
+				files[fileName] = "---\n" + content + "\n"
+			}
+		}
+	}
+
+	return files
+}
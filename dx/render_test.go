@@ -0,0 +1,108 @@
+package dx
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const renderedChart = `---
+# Source: onechart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: my-app
+---
+# Source: onechart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+spec:
+  template:
+    spec:
+      containers:
+      - name: my-app
+        image: nginx
+`
+
+func Test_render(t *testing.T) {
+	previous := chartRenderer
+	defer RegisterChartRenderer(previous)
+	RegisterChartRenderer(func(m Manifest) (string, error) {
+		return renderedChart, nil
+	})
+
+	m := &Manifest{
+		App:       "my-app",
+		Env:       "production",
+		Namespace: "default",
+		Values: map[string]interface{}{
+			"image": "nginx:{{ .GitSHA }}",
+		},
+		StrategicMergePatches: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app
+spec:
+  template:
+    metadata:
+      annotations:
+        gitSha: "{{ .GitSHA }}"
+{{- if eq .EnvMetadata.tier "production" }}
+  replicas: 3
+{{- end }}
+`,
+	}
+	env := &Env{Name: "production", Metadata: map[string]string{"tier": "production"}}
+
+	files, err := Render(m, map[string]string{"GitSHA": "ea9ab7cc"}, env)
+	assert.Nil(t, err)
+	assert.Equal(t, "nginx:ea9ab7cc", m.Values["image"], "should resolve the vars")
+	assert.Contains(t, files["manifest.yaml"], `gitSha: ea9ab7cc`, "should apply the patches")
+	assert.Contains(t, files["manifest.yaml"], "replicas: 3", "should resolve the patch conditionals with the env metadata")
+
+	m = &Manifest{App: "my-app", Env: "production"}
+	files, err = Render(m, map[string]string{}, env)
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+	assert.Contains(t, files, "service.yaml", "should split the chart output to files")
+	assert.Contains(t, files, "deployment.yaml", "should split the chart output to files")
+}
+
+func Test_renderWithoutSealedSecretsCertificate(t *testing.T) {
+	previous := chartRenderer
+	defer RegisterChartRenderer(previous)
+	RegisterChartRenderer(func(m Manifest) (string, error) {
+		return renderedChart, nil
+	})
+
+	m := &Manifest{
+		App:       "my-app",
+		Env:       "production",
+		Namespace: "default",
+		Secrets:   map[string]string{"password": "secret"},
+	}
+	_, err := Render(m, map[string]string{}, &Env{Name: "production"})
+	assert.NotNil(t, err, "should not render secrets in plain text")
+
+	_, err = Template(m)
+	assert.NotNil(t, err, "should not render secrets in plain text")
+}
+
+func Test_templateErrors(t *testing.T) {
+	previous := chartRenderer
+	defer RegisterChartRenderer(previous)
+
+	RegisterChartRenderer(nil)
+	_, err := Template(&Manifest{App: "my-app"})
+	assert.NotNil(t, err, "should need a chart renderer")
+
+	RegisterChartRenderer(func(m Manifest) (string, error) {
+		return "", fmt.Errorf("chart not found")
+	})
+	_, err = Template(&Manifest{App: "my-app"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,30 @@
+package dx
+
+// RepositoryStats are the pipeline health metrics of a source code repository
+type RepositoryStats struct {
+	Repository string `json:"repository"`
+
+	// Artifacts is the number of artifacts of the repository
+	Artifacts int `json:"artifacts"`
+
+	// ArtifactsByBranch is the number of artifacts per branch
+	ArtifactsByBranch map[string]int `json:"artifactsByBranch"`
+
+	// ArtifactsByEvent is the number of artifacts per git event: push, tag, pr
+	ArtifactsByEvent map[string]int `json:"artifactsByEvent"`
+
+	// LastDeploys are the last deploys of the repository's apps, per env
+	LastDeploys map[string]*LastDeploy `json:"lastDeploys"`
+
+	// AverageDeployLatencySeconds is the mean time from artifact creation to the gitops commit applied by Flux
+	AverageDeployLatencySeconds float64 `json:"averageDeployLatencySeconds"`
+}
+
+// LastDeploy is the last deploy to an env
+type LastDeploy struct {
+	Env        string `json:"env"`
+	App        string `json:"app,omitempty"`
+	ArtifactID string `json:"artifactId,omitempty"`
+	GitopsRef  string `json:"gitopsRef,omitempty"`
+	Created    int64  `json:"created"`
+}
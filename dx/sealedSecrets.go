@@ -0,0 +1,191 @@
+package dx
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SealSecrets encrypts the secrets of the manifest with the Sealed Secrets certificate of the env,
+// and drops their plaintext from the manifest.
+// The encryption is compatible with `kubeseal` in its default, strict scope
+func (m *Manifest) SealSecrets(env *Env) error {
+	if len(m.Secrets) == 0 {
+		return nil
+	}
+	if env == nil || env.SealedSecretsCertificate == "" {
+		return fmt.Errorf("env %s has no sealed secrets certificate to encrypt the secrets of %s with", m.Env, m.App)
+	}
+	if m.Namespace == "" {
+		return fmt.Errorf("secrets of %s need the namespace to be set", m.App)
+	}
+
+	key, err := parseSealingKey(env.SealedSecretsCertificate)
+	if err != nil {
+		return err
+	}
+
+	label := []byte(fmt.Sprintf("%s/%s", m.Namespace, m.SecretName()))
+	sealed := map[string]string{}
+	for k, v := range m.Secrets {
+		ciphertext, err := hybridEncrypt(rand.Reader, key, []byte(v), label)
+		if err != nil {
+			return fmt.Errorf("cannot encrypt secret %s: %s", k, err)
+		}
+		sealed[k] = base64.StdEncoding.EncodeToString(ciphertext)
+	}
+
+	m.SealedSecrets = sealed
+	m.Secrets = nil
+	return nil
+}
+
+// SealArtifactSecrets seals the secrets of the manifests of an artifact on ingestion,
+// so their plaintext is never stored, served or passed on to callbacks.
+// The namespace and the app are resolved with the artifact vars and the env defaults, as they are at deploy time.
+// Manifests with variants can't be sealed for each variant here, CI has to send their sealedSecrets
+func SealArtifactSecrets(artifact *Artifact, envs map[string]*Env) error {
+	for _, m := range artifact.Environments {
+		if len(m.Secrets) == 0 {
+			continue
+		}
+		if len(m.Variants) > 0 {
+			return fmt.Errorf("secrets of %s in %s can't be sealed for its variants, send sealedSecrets instead", m.App, m.Env)
+		}
+
+		resolved, err := m.deepCopy()
+		if err != nil {
+			return err
+		}
+		resolved.ApplyEnvDefaults(envs[m.Env])
+		err = resolved.ResolveVars(artifact.Vars())
+		if err != nil {
+			return fmt.Errorf("cannot resolve manifest vars %s", err.Error())
+		}
+		err = resolved.SealSecrets(envs[m.Env])
+		if err != nil {
+			return err
+		}
+
+		if m.SealedSecrets == nil {
+			m.SealedSecrets = map[string]string{}
+		}
+		for k, v := range resolved.SealedSecrets {
+			m.SealedSecrets[k] = v
+		}
+		m.Secrets = nil
+	}
+	return nil
+}
+
+func (m *Manifest) deepCopy() (*Manifest, error) {
+	manifestBytes, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var manifestCopy Manifest
+	err = json.Unmarshal(manifestBytes, &manifestCopy)
+	return &manifestCopy, err
+}
+
+// SecretName is the name of the Kubernetes secret that holds the secrets of the manifest
+func (m *Manifest) SecretName() string {
+	return m.App + "-secrets"
+}
+
+// SealedSecretResource renders the SealedSecret Kubernetes resource of the sealed secrets of the manifest
+func (m *Manifest) SealedSecretResource() (string, error) {
+	metadata := map[string]interface{}{
+		"name":      m.SecretName(),
+		"namespace": m.Namespace,
+	}
+	resource := map[string]interface{}{
+		"apiVersion": "bitnami.com/v1alpha1",
+		"kind":       "SealedSecret",
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"encryptedData": m.SealedSecrets,
+			"template": map[string]interface{}{
+				"metadata": metadata,
+			},
+		},
+	}
+
+	resourceBytes, err := yaml.Marshal(resource)
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal sealed secret: %s", err)
+	}
+	return "---\n" + string(resourceBytes), nil
+}
+
+// parseSealingKey reads the RSA public key from the PEM encoded certificate of the Sealed Secrets controller,
+// as `kubeseal --fetch-cert` prints it. PEM encoded public keys are accepted too
+func parseSealingKey(certificate string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil {
+		return nil, fmt.Errorf("cannot decode sealed secrets certificate")
+	}
+
+	var key interface{}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse sealed secrets certificate: %s", err)
+		}
+		key = cert.PublicKey
+	} else {
+		var err error
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse sealed secrets public key: %s", err)
+		}
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("sealed secrets certificate must have an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// hybridEncrypt encrypts the plaintext with a random AES-GCM session key, that is encrypted with RSA-OAEP.
+// The output is the length of the encrypted session key in two bytes, the encrypted session key, then the ciphertext
+func hybridEncrypt(rnd io.Reader, key *rsa.PublicKey, plaintext []byte, label []byte) ([]byte, error) {
+	sessionKey := make([]byte, 32)
+	if _, err := io.ReadFull(rnd, sessionKey); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	aed, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedSessionKey, err := rsa.EncryptOAEP(sha256.New(), rnd, key, sessionKey, label)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := make([]byte, 2)
+	binary.BigEndian.PutUint16(ciphertext, uint16(len(encryptedSessionKey)))
+	ciphertext = append(ciphertext, encryptedSessionKey...)
+
+	// the session key is used only once, so the nonce can be zero
+	zeroNonce := make([]byte, aed.NonceSize())
+	return aed.Seal(ciphertext, zeroNonce, plaintext, nil), nil
+}
@@ -0,0 +1,123 @@
+package dx
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_sealSecrets(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.Nil(t, err)
+	env := &Env{
+		Name:                     "production",
+		SealedSecretsCertificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+
+	m := &Manifest{
+		App:       "my-app",
+		Env:       "production",
+		Namespace: "my-namespace",
+		Secrets:   map[string]string{"DB_PASSWORD": "hunter2"},
+	}
+	err = m.SealSecrets(&Env{Name: "production"})
+	assert.NotNil(t, err, "should not seal without a certificate")
+
+	err = m.SealSecrets(env)
+	assert.Nil(t, err)
+	assert.Nil(t, m.Secrets, "plaintext should be dropped")
+
+	ciphertext, err := base64.StdEncoding.DecodeString(m.SealedSecrets["DB_PASSWORD"])
+	assert.Nil(t, err)
+	plaintext := hybridDecrypt(t, key, ciphertext, []byte("my-namespace/my-app-secrets"))
+	assert.Equal(t, "hunter2", string(plaintext))
+
+	resource, err := m.SealedSecretResource()
+	assert.Nil(t, err)
+	var parsed map[string]interface{}
+	err = yaml.Unmarshal([]byte(resource), &parsed)
+	assert.Nil(t, err)
+	assert.Equal(t, "SealedSecret", parsed["kind"])
+	encryptedData := parsed["spec"].(map[string]interface{})["encryptedData"].(map[string]interface{})
+	assert.Equal(t, m.SealedSecrets["DB_PASSWORD"], encryptedData["DB_PASSWORD"])
+}
+
+func Test_sealArtifactSecrets(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	envs := map[string]*Env{
+		"preview": {
+			Name:                     "preview",
+			SealedSecretsCertificate: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes(t, key)})),
+		},
+	}
+
+	artifact := &Artifact{
+		Version: Version{Branch: "feature"},
+		Environments: []*Manifest{{
+			App:       "my-app-{{ .GitBranch }}",
+			Env:       "preview",
+			Namespace: "{{ .GitBranch }}",
+			Secrets:   map[string]string{"DB_PASSWORD": "hunter2"},
+		}},
+	}
+	err = SealArtifactSecrets(artifact, envs)
+	assert.Nil(t, err)
+	m := artifact.Environments[0]
+	assert.Nil(t, m.Secrets, "plaintext should not be stored")
+	assert.Equal(t, "my-app-{{ .GitBranch }}", m.App, "only the secrets should be resolved")
+	ciphertext, err := base64.StdEncoding.DecodeString(m.SealedSecrets["DB_PASSWORD"])
+	assert.Nil(t, err)
+	plaintext := hybridDecrypt(t, key, ciphertext, []byte("feature/my-app-feature-secrets"))
+	assert.Equal(t, "hunter2", string(plaintext), "should be sealed to the namespace and name of the deploy")
+
+	err = SealArtifactSecrets(&Artifact{Environments: []*Manifest{{
+		App: "my-app", Env: "staging", Namespace: "default", Secrets: map[string]string{"DB_PASSWORD": "hunter2"},
+	}}}, envs)
+	assert.NotNil(t, err, "should not take secrets for envs without a certificate")
+
+	err = SealArtifactSecrets(&Artifact{Environments: []*Manifest{{
+		App: "my-app", Env: "preview", Namespace: "default", Secrets: map[string]string{"DB_PASSWORD": "hunter2"},
+		Variants: []*Variant{{Name: "blue"}},
+	}}}, envs)
+	assert.NotNil(t, err, "should not seal the secrets of variants")
+}
+
+func publicKeyBytes(t *testing.T, key *rsa.PrivateKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	assert.Nil(t, err)
+	return der
+}
+
+func hybridDecrypt(t *testing.T, key *rsa.PrivateKey, ciphertext []byte, label []byte) []byte {
+	keyLength := int(binary.BigEndian.Uint16(ciphertext))
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, ciphertext[2:2+keyLength], label)
+	assert.Nil(t, err)
+
+	block, err := aes.NewCipher(sessionKey)
+	assert.Nil(t, err)
+	aed, err := cipher.NewGCM(block)
+	assert.Nil(t, err)
+	plaintext, err := aed.Open(nil, make([]byte, aed.NonceSize()), ciphertext[2+keyLength:], nil)
+	assert.Nil(t, err)
+	return plaintext
+}
@@ -0,0 +1,123 @@
+package dx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Signature verification statuses of an artifact
+const SignatureUnsigned = "unsigned"
+const SignatureUnverified = "unverified" // signed, but GimletD has no public keys to verify with
+const SignatureVerified = "verified"
+const SignatureInvalid = "invalid"
+
+// SigningPayload is the content that is signed: the artifact in JSON without the fields GimletD sets on ingestion.
+// ECDSA signatures over it are compatible with `cosign sign-blob`
+func (a *Artifact) SigningPayload() ([]byte, error) {
+	unsigned := *a
+	unsigned.ID = ""
+	unsigned.Created = 0
+	unsigned.Signature = ""
+	unsigned.SignatureStatus = ""
+	unsigned.Source = nil
+	return json.Marshal(unsigned)
+}
+
+// SignArtifact signs the artifact with an ECDSA, Ed25519 or RSA private key
+func SignArtifact(a *Artifact, key crypto.Signer) error {
+	payload, err := a.SigningPayload()
+	if err != nil {
+		return fmt.Errorf("cannot serialize artifact: %s", err)
+	}
+
+	var signature []byte
+	if _, ok := key.Public().(ed25519.PublicKey); ok {
+		signature, err = key.Sign(rand.Reader, payload, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(payload)
+		signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot sign artifact: %s", err)
+	}
+
+	a.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// VerifyArtifact returns the signature status of the artifact against the trusted public keys
+func VerifyArtifact(a *Artifact, keys []crypto.PublicKey) string {
+	if a.Signature == "" {
+		return SignatureUnsigned
+	}
+	if len(keys) == 0 {
+		return SignatureUnverified
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(a.Signature)
+	if err != nil {
+		return SignatureInvalid
+	}
+	payload, err := a.SigningPayload()
+	if err != nil {
+		return SignatureInvalid
+	}
+	digest := sha256.Sum256(payload)
+
+	for _, key := range keys {
+		if verify(key, payload, digest[:], signature) {
+			return SignatureVerified
+		}
+	}
+	return SignatureInvalid
+}
+
+func verify(key crypto.PublicKey, payload []byte, digest []byte, signature []byte) bool {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest, signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, signature) == nil
+	}
+	return false
+}
+
+// LoadPublicKeys reads the PEM encoded public keys from a file, eg. a cosign.pub
+func LoadPublicKeys(path string) ([]crypto.PublicKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read public keys: %s", err)
+	}
+
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse public key: %s", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no public key found in " + path)
+	}
+	return keys, nil
+}
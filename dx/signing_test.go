@@ -0,0 +1,69 @@
+package dx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_signAndVerifyArtifact(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	for _, key := range []crypto.Signer{ecdsaKey, ed25519Key} {
+		artifact := &Artifact{Version: Version{RepositoryName: "my-app", SHA: "abc"}}
+		assert.Equal(t, SignatureUnsigned, VerifyArtifact(artifact, []crypto.PublicKey{key.Public()}))
+
+		err = SignArtifact(artifact, key)
+		assert.Nil(t, err)
+		assert.Equal(t, SignatureUnverified, VerifyArtifact(artifact, nil))
+
+		artifact.ID = "my-app-123"
+		artifact.Created = 1
+		assert.Equal(t, SignatureVerified, VerifyArtifact(artifact, []crypto.PublicKey{otherKey.Public(), key.Public()}),
+			"fields set by GimletD should not invalidate the signature")
+
+		artifact.Version.SHA = "def"
+		assert.Equal(t, SignatureInvalid, VerifyArtifact(artifact, []crypto.PublicKey{key.Public()}), "tampering should be detected")
+	}
+}
+
+func Test_loadPublicKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gimlet-keys")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var pemBytes []byte
+	for i := 0; i < 2; i++ {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		assert.Nil(t, err)
+		pemBytes = append(pemBytes, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})...)
+	}
+	path := filepath.Join(dir, "cosign.pub")
+	err = ioutil.WriteFile(path, pemBytes, 0644)
+	assert.Nil(t, err)
+
+	keys, err := LoadPublicKeys(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(keys))
+
+	err = ioutil.WriteFile(path, []byte("not a key"), 0644)
+	assert.Nil(t, err)
+	_, err = LoadPublicKeys(path)
+	assert.NotNil(t, err)
+}
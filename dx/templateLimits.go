@@ -0,0 +1,261 @@
+package dx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// TemplateLimits guard the daemon against manifests that would hang or exhaust it,
+// while their vars are resolved or their chart is templated
+type TemplateLimits struct {
+	// Timeout is the longest a template may render. Templates can't be cancelled,
+	// a render that times out is abandoned and its result dropped
+	Timeout time.Duration
+	// MaxOutputBytes is the largest rendered output, also the largest string a template function may build
+	MaxOutputBytes int
+	// MaxListLength is the longest list the until, untilStep and seq functions may build
+	MaxListLength int
+	// MaxIterations is the most range loop iterations of a vars render, counted across the nested loops,
+	// so loops that emit nothing are stopped too
+	MaxIterations int
+	// MaxAbandonedRenders is the most timed out renders that may still run in the background.
+	// Renders are refused until they finish, so hanging templates can't pile up
+	MaxAbandonedRenders int
+}
+
+var templateLimits = TemplateLimits{
+	Timeout:             30 * time.Second,
+	MaxOutputBytes:      10 << 20,
+	MaxListLength:       10000,
+	MaxIterations:       100000,
+	MaxAbandonedRenders: 4,
+}
+
+// abandonedRenders counts the timed out renders that still run
+var abandonedRenders int32
+
+// SetTemplateLimits configures the limits of templating, zero fields keep the defaults
+func SetTemplateLimits(limits TemplateLimits) {
+	if limits.Timeout > 0 {
+		templateLimits.Timeout = limits.Timeout
+	}
+	if limits.MaxOutputBytes > 0 {
+		templateLimits.MaxOutputBytes = limits.MaxOutputBytes
+	}
+	if limits.MaxListLength > 0 {
+		templateLimits.MaxListLength = limits.MaxListLength
+	}
+	if limits.MaxIterations > 0 {
+		templateLimits.MaxIterations = limits.MaxIterations
+	}
+	if limits.MaxAbandonedRenders > 0 {
+		templateLimits.MaxAbandonedRenders = limits.MaxAbandonedRenders
+	}
+}
+
+// CurrentTemplateLimits returns the limits of templating
+func CurrentTemplateLimits() TemplateLimits {
+	return templateLimits
+}
+
+// Render states, a render is abandoned if it times out before it is done
+const (
+	renderRunning int32 = iota
+	renderDone
+	renderAbandoned
+)
+
+// WithTemplateLimits runs the render function within the timeout, and checks the size of its output.
+// It refuses to render while too many abandoned renders still run
+func WithTemplateLimits(render func() (string, error)) (string, error) {
+	if atomic.LoadInt32(&abandonedRenders) >= int32(templateLimits.MaxAbandonedRenders) {
+		return "", fmt.Errorf("%d timed out renders are still running, try again later", templateLimits.MaxAbandonedRenders)
+	}
+
+	type result struct {
+		out string
+		err error
+	}
+	done := make(chan result, 1)
+	state := renderRunning
+	go func() {
+		out, err := render()
+		if !atomic.CompareAndSwapInt32(&state, renderRunning, renderDone) {
+			atomic.AddInt32(&abandonedRenders, -1)
+		}
+		done <- result{out: out, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return "", r.err
+		}
+		if len(r.out) > templateLimits.MaxOutputBytes {
+			return "", fmt.Errorf("rendered template is larger than %d bytes", templateLimits.MaxOutputBytes)
+		}
+		return r.out, nil
+	case <-time.After(templateLimits.Timeout):
+		if atomic.CompareAndSwapInt32(&state, renderRunning, renderAbandoned) {
+			atomic.AddInt32(&abandonedRenders, 1)
+		}
+		return "", fmt.Errorf("rendering the template took longer than %s", templateLimits.Timeout)
+	}
+}
+
+// deniedFunctions are the sprig functions that reach outside of the template,
+// or that burn CPU for no use in a manifest
+var deniedFunctions = []string{
+	"env",
+	"expandenv",
+	"getHostByName",
+	"genPrivateKey",
+	"derivePassword",
+	"genCA",
+	"genCAWithKey",
+	"genSelfSignedCert",
+	"genSelfSignedCertWithKey",
+	"genSignedCert",
+	"genSignedCertWithKey",
+}
+
+// iterationFunction is called at the start of every range loop iteration of the vars templates, see countIterations
+const iterationFunction = "gimletdRangeIteration"
+
+// templateFunctions is the restricted sprig function set of manifest templates,
+// with the list and string building functions capped by the template limits.
+// The functions count the range loop iterations of a single render
+func templateFunctions() map[string]interface{} {
+	functions := map[string]interface{}{}
+	for k, v := range sprig.GenericFuncMap() {
+		functions[k] = v
+	}
+	for _, name := range deniedFunctions {
+		delete(functions, name)
+	}
+
+	until := functions["until"].(func(int) []int)
+	untilStep := functions["untilStep"].(func(int, int, int) []int)
+	seq := functions["seq"].(func(...int) string)
+	functions["until"] = func(count int) ([]int, error) {
+		if err := checkListLength(0, count, 1); err != nil {
+			return nil, err
+		}
+		return until(count), nil
+	}
+	functions["untilStep"] = func(start, stop, step int) ([]int, error) {
+		if err := checkListLength(start, stop, step); err != nil {
+			return nil, err
+		}
+		return untilStep(start, stop, step), nil
+	}
+	functions["seq"] = func(params ...int) (string, error) {
+		switch len(params) {
+		case 1:
+			if err := checkListLength(1, params[0], 1); err != nil {
+				return "", err
+			}
+		case 2:
+			if err := checkListLength(params[0], params[1], 1); err != nil {
+				return "", err
+			}
+		case 3:
+			if err := checkListLength(params[0], params[2], params[1]); err != nil {
+				return "", err
+			}
+		}
+		return seq(params...), nil
+	}
+	functions["repeat"] = func(count int, str string) (string, error) {
+		if count > 0 && len(str) > 0 && count > templateLimits.MaxOutputBytes/len(str) {
+			return "", fmt.Errorf("repeat would build a string larger than %d bytes", templateLimits.MaxOutputBytes)
+		}
+		if count < 0 {
+			count = 0
+		}
+		return strings.Repeat(str, count), nil
+	}
+
+	iterations := 0
+	functions[iterationFunction] = func() (string, error) {
+		iterations++
+		if iterations > templateLimits.MaxIterations {
+			return "", fmt.Errorf("template loops cannot run more than %d iterations", templateLimits.MaxIterations)
+		}
+		return "", nil
+	}
+
+	functions["sanitizeDNSName"] = sanitizeDNSName
+	return functions
+}
+
+// countIterations makes every range loop of the template call the iteration function first,
+// as text/template has no hook to limit loops with
+func countIterations(tpl *template.Template) error {
+	counter, err := template.New("").Funcs(template.FuncMap{iterationFunction: func() string { return "" }}).
+		Parse("{{ " + iterationFunction + " }}")
+	if err != nil {
+		return err
+	}
+	call := counter.Tree.Root.Nodes[0]
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+			n.List.Nodes = append([]parse.Node{call}, n.List.Nodes...)
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	for _, t := range tpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+	return nil
+}
+
+func checkListLength(start int, stop int, step int) error {
+	if step == 0 {
+		return nil
+	}
+	length := (stop - start) / step
+	if length > templateLimits.MaxListLength || length < -templateLimits.MaxListLength {
+		return fmt.Errorf("cannot build a list longer than %d items", templateLimits.MaxListLength)
+	}
+	return nil
+}
+
+// limitedBuffer fails the writes that would grow it over the max size
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		return 0, fmt.Errorf("rendered template is larger than %d bytes", b.max)
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,73 @@
+package dx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_restrictedTemplateFunctions(t *testing.T) {
+	_, err := resolve(`{{ env "HOME" }}`, nil)
+	assert.NotNil(t, err, "env should not be available")
+	_, err = resolve(`{{ getHostByName "example.com" }}`, nil)
+	assert.NotNil(t, err, "network functions should not be available")
+
+	templated, err := resolve(`{{ "my-app" | upper }}{{ range until 3 }}.{{ end }}`, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "MY-APP...", templated, "the rest of sprig should work")
+}
+
+func Test_templateLimits(t *testing.T) {
+	defer func(limits TemplateLimits) { templateLimits = limits }(templateLimits)
+	SetTemplateLimits(TemplateLimits{MaxOutputBytes: 100, MaxListLength: 10})
+
+	_, err := resolve(`{{ range until 1000000000 }}{{ end }}`, nil)
+	assert.NotNil(t, err, "huge lists should not be built")
+	_, err = resolve(`{{ seq 1 2 1000000000 }}`, nil)
+	assert.NotNil(t, err)
+	_, err = resolve(`{{ repeat 1000000000 "x" }}`, nil)
+	assert.NotNil(t, err, "huge strings should not be built")
+	_, err = resolve(`{{ range until 10 }}0123456789abcdef{{ end }}`, nil)
+	assert.NotNil(t, err, "output should be limited")
+
+	_, err = resolve(`{{ range until 10 }}{{ range until 10 }}{{ range until 10 }}{{ end }}{{ end }}{{ end }}`, nil)
+	assert.Nil(t, err)
+	SetTemplateLimits(TemplateLimits{MaxIterations: 100})
+	_, err = resolve(`{{ range until 10 }}{{ range until 10 }}{{ range until 10 }}{{ end }}{{ end }}{{ end }}`, nil)
+	assert.NotNil(t, err, "loops that emit nothing should be limited too")
+	_, err = resolve(`{{ define "loop" }}{{ range until 10 }}{{ range until 10 }}{{ end }}{{ end }}{{ end }}{{ template "loop" }}{{ template "loop" }}`, nil)
+	assert.NotNil(t, err, "loops in defined templates should count")
+
+	SetTemplateLimits(TemplateLimits{Timeout: 10 * time.Millisecond})
+	_, err = WithTemplateLimits(func() (string, error) {
+		time.Sleep(time.Second)
+		return "", nil
+	})
+	assert.NotNil(t, err, "slow renders should time out")
+}
+
+func Test_abandonedRenders(t *testing.T) {
+	defer func(limits TemplateLimits) { templateLimits = limits }(templateLimits)
+	SetTemplateLimits(TemplateLimits{Timeout: 10 * time.Millisecond, MaxAbandonedRenders: 2})
+
+	hang := make(chan struct{})
+	hanging := func() (string, error) {
+		<-hang
+		return "", nil
+	}
+	fast := func() (string, error) { return "ok", nil }
+
+	for i := 0; i < 2; i++ {
+		_, err := WithTemplateLimits(hanging)
+		assert.NotNil(t, err)
+	}
+	_, err := WithTemplateLimits(fast)
+	assert.NotNil(t, err, "should refuse to render while too many abandoned renders run")
+
+	close(hang)
+	assert.Eventually(t, func() bool {
+		out, err := WithTemplateLimits(fast)
+		return err == nil && out == "ok"
+	}, time.Second, 10*time.Millisecond, "should render again when the abandoned renders finish")
+}
@@ -0,0 +1,59 @@
+package dx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ApplyValuesFiles merges the values files of the manifest in their declared order, under the manifest values.
+// The contents must be embedded in the artifact by CI, GimletD has no access to the app repo
+func (m *Manifest) ApplyValuesFiles() error {
+	if len(m.ValuesFiles) == 0 {
+		return nil
+	}
+
+	merged := map[string]interface{}{}
+	for _, file := range m.ValuesFiles {
+		content, ok := m.ValuesFileContents[file]
+		if !ok {
+			return fmt.Errorf("values file %s of %s/%s is not embedded in the artifact", file, m.Env, m.App)
+		}
+
+		var values map[string]interface{}
+		err := yaml.Unmarshal([]byte(content), &values)
+		if err != nil {
+			return fmt.Errorf("cannot parse values file %s of %s/%s: %s", file, m.Env, m.App, err)
+		}
+		merged = mergeValues(merged, values)
+	}
+
+	m.Values = mergeValues(merged, m.Values)
+	return nil
+}
+
+// embedValuesFiles reads the values files that the manifests reference from the app repo at repoDir
+func embedValuesFiles(repoDir string, manifests []*Manifest) error {
+	for _, m := range manifests {
+		for _, file := range m.ValuesFiles {
+			cleaned := path.Clean(filepath.ToSlash(file))
+			if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+				return fmt.Errorf("values file %s of %s/%s is outside of the app repo", file, m.Env, m.App)
+			}
+
+			content, err := ioutil.ReadFile(filepath.Join(repoDir, filepath.FromSlash(cleaned)))
+			if err != nil {
+				return fmt.Errorf("cannot read values file %s of %s/%s: %s", file, m.Env, m.App, err)
+			}
+			if m.ValuesFileContents == nil {
+				m.ValuesFileContents = map[string]string{}
+			}
+			m.ValuesFileContents[file] = string(content)
+		}
+	}
+	return nil
+}
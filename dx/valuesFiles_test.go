@@ -0,0 +1,80 @@
+package dx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_applyValuesFiles(t *testing.T) {
+	m := &Manifest{
+		App:         "my-app",
+		Env:         "production",
+		ValuesFiles: []string{".gimlet/values.yaml", ".gimlet/values-prod.yaml"},
+		ValuesFileContents: map[string]string{
+			".gimlet/values.yaml": `
+replicas: 1
+resources:
+  requests:
+    cpu: 100m
+    memory: 128Mi
+`,
+			".gimlet/values-prod.yaml": `
+replicas: 3
+resources:
+  requests:
+    cpu: 500m
+`,
+		},
+		Values: map[string]interface{}{
+			"image":    "nginx:1.19",
+			"replicas": 5,
+		},
+	}
+
+	err := m.ApplyValuesFiles()
+	assert.Nil(t, err)
+	assert.Equal(t, 5, m.Values["replicas"], "inline values should take precedence")
+	assert.Equal(t, "nginx:1.19", m.Values["image"])
+	requests := m.Values["resources"].(map[string]interface{})["requests"].(map[string]interface{})
+	assert.Equal(t, "500m", requests["cpu"], "later values files should take precedence")
+	assert.Equal(t, "128Mi", requests["memory"])
+
+	m.ValuesFiles = append(m.ValuesFiles, ".gimlet/missing.yaml")
+	err = m.ApplyValuesFiles()
+	assert.NotNil(t, err, "should fail if a values file is not embedded")
+}
+
+func Test_withValuesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gimlet-values-files-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.MkdirAll(filepath.Join(dir, ".gimlet"), 0755)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, ".gimlet", "envs.yaml"), []byte(`
+app: my-app
+env: production
+namespace: default
+valuesFiles:
+  - .gimlet/values-prod.yaml
+`), 0644)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, ".gimlet", "values-prod.yaml"), []byte("replicas: 3\n"), 0644)
+	assert.Nil(t, err)
+
+	version := Version{SHA: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780"}
+	_, err = NewArtifact().WithVersion(version).WithEnvFiles(filepath.Join(dir, ".gimlet")).Build()
+	assert.NotNil(t, err, "should not build an artifact without the referenced values files")
+
+	artifact, err := NewArtifact().WithVersion(version).WithEnvFiles(filepath.Join(dir, ".gimlet")).WithValuesFiles(dir).Build()
+	assert.Nil(t, err)
+	assert.Equal(t, "replicas: 3\n", artifact.Environments[0].ValuesFileContents[".gimlet/values-prod.yaml"])
+
+	m := &Manifest{App: "my-app", Env: "production", ValuesFiles: []string{"../secrets.yaml"}}
+	err = embedValuesFiles(dir, []*Manifest{m})
+	assert.NotNil(t, err, "should not read files outside of the app repo")
+}
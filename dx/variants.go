@@ -0,0 +1,78 @@
+package dx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Variant is an instance of the app in the env, eg. per region or per tenant.
+// It is deployed as <app>-<name> to its own gitops folder, with its values merged over the values of the manifest
+type Variant struct {
+	Name   string                 `yaml:"name" json:"name"`
+	Values map[string]interface{} `yaml:"values,omitempty" json:"values,omitempty"`
+}
+
+// ExpandVariants returns a manifest for each variant of the manifests.
+// Manifests without variants are returned as they are
+func ExpandVariants(manifests []*Manifest) ([]*Manifest, error) {
+	var expanded []*Manifest
+	for _, m := range manifests {
+		if len(m.Variants) == 0 {
+			expanded = append(expanded, m)
+			continue
+		}
+
+		names := map[string]bool{}
+		for _, v := range m.Variants {
+			if v.Name == "" {
+				return nil, fmt.Errorf("variant without a name in %s/%s", m.Env, m.App)
+			}
+			if names[v.Name] {
+				return nil, fmt.Errorf("variant %s is declared twice in %s/%s", v.Name, m.Env, m.App)
+			}
+			names[v.Name] = true
+
+			variant, err := m.withVariant(v)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, variant)
+		}
+	}
+	return expanded, nil
+}
+
+// BaseApp is the app name without the variant postfix
+func (m *Manifest) BaseApp() string {
+	if m.Variant == "" {
+		return m.App
+	}
+	return strings.TrimSuffix(m.App, "-"+m.Variant)
+}
+
+func (m *Manifest) withVariant(v *Variant) (*Manifest, error) {
+	manifestBytes, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var variant Manifest
+	err = json.Unmarshal(manifestBytes, &variant)
+	if err != nil {
+		return nil, err
+	}
+
+	variant.App = fmt.Sprintf("%s-%s", m.App, v.Name)
+	variant.Variant = v.Name
+	variant.Variants = nil
+	variant.Values = mergeValues(variant.Values, v.Values)
+	if variant.Cleanup != nil {
+		if variant.Cleanup.AppToCleanup != "" {
+			variant.Cleanup.AppToCleanup = fmt.Sprintf("%s-%s", variant.Cleanup.AppToCleanup, v.Name)
+		}
+		for i, app := range variant.Cleanup.AppsToCleanup {
+			variant.Cleanup.AppsToCleanup[i] = fmt.Sprintf("%s-%s", app, v.Name)
+		}
+	}
+	return &variant, nil
+}
@@ -0,0 +1,61 @@
+package dx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_expandVariants(t *testing.T) {
+	manifests := []*Manifest{
+		{
+			App: "my-app",
+			Env: "staging",
+		},
+		{
+			App:       "my-app",
+			Env:       "production",
+			Namespace: "{{ .Variant }}",
+			Values: map[string]interface{}{
+				"replicas": 2,
+				"ingress": map[string]interface{}{
+					"host": "{{ .Variant }}.example.com",
+				},
+			},
+			Cleanup: &Cleanup{AppToCleanup: "my-app-{{ .BRANCH }}", AppsToCleanup: []string{"my-db-{{ .BRANCH }}"}},
+			Variants: []*Variant{
+				{Name: "eu"},
+				{Name: "us", Values: map[string]interface{}{"replicas": 5}},
+			},
+		},
+	}
+
+	expanded, err := ExpandVariants(manifests)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(expanded))
+	assert.Equal(t, manifests[0], expanded[0], "manifests without variants should be kept as they are")
+
+	eu, us := expanded[1], expanded[2]
+	assert.Equal(t, "my-app-eu", eu.App)
+	assert.Equal(t, "my-app", eu.BaseApp())
+	assert.Nil(t, eu.Variants)
+	assert.Equal(t, "my-app-{{ .BRANCH }}-eu", eu.Cleanup.AppToCleanup)
+	assert.Equal(t, []string{"my-db-{{ .BRANCH }}-eu"}, eu.Cleanup.AppsToCleanup)
+	assert.Equal(t, "my-app-{{ .BRANCH }}", manifests[1].Cleanup.AppToCleanup, "should not modify the original manifest")
+	assert.Equal(t, []string{"my-db-{{ .BRANCH }}"}, manifests[1].Cleanup.AppsToCleanup, "should not modify the original manifest")
+	assert.Equal(t, "my-app-us", us.App)
+	assert.EqualValues(t, 5, us.Values["replicas"])
+	assert.EqualValues(t, 2, eu.Values["replicas"])
+
+	err = us.ResolveVars(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, "us", us.Namespace)
+	assert.Equal(t, "us.example.com", us.Values["ingress"].(map[string]interface{})["host"])
+	assert.Equal(t, "my-app", us.BaseApp())
+
+	_, err = ExpandVariants([]*Manifest{{
+		App:      "my-app",
+		Variants: []*Variant{{Name: "eu"}, {Name: "eu"}},
+	}})
+	assert.NotNil(t, err, "should reject duplicate variants")
+}
@@ -0,0 +1,77 @@
+package firehose
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gimlet-io/gimletd/hooks"
+	"github.com/gimlet-io/gimletd/model"
+)
+
+const signatureHeader = "X-Gimlet-Signature"
+
+// Sink receives the event state changes of the firehose.
+// Delivery is at-least-once: a batch is sent again until Send returns without error,
+// so sinks should deduplicate by the seq field of the changes
+type Sink interface {
+	Send(changes []*model.EventChange) error
+}
+
+// Batch is the payload posted to the HTTP sink
+type Batch struct {
+	Changes []*model.EventChange `json:"changes"`
+}
+
+// HTTPSink posts the event changes as JSON to a URL, signed with the secret if one is set
+type HTTPSink struct {
+	URL    string
+	Secret string
+
+	client *http.Client
+}
+
+func NewHTTPSink(url string, secret string) *HTTPSink {
+	return &HTTPSink{
+		URL:    url,
+		Secret: secret,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Send posts the changes, non-2xx responses are errors
+func (s *HTTPSink) Send(changes []*model.EventChange) error {
+	payloadBytes, err := json.Marshal(&Batch{Changes: changes})
+	if err != nil {
+		return fmt.Errorf("cannot serialize event changes: %s", err)
+	}
+
+	req, err := http.NewRequest("POST", s.URL, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("cannot create firehose request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Secret != "" {
+		req.Header.Set(signatureHeader, hooks.Signature(s.Secret, payloadBytes))
+	}
+
+	client := s.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot post event changes: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("firehose sink responded with status %d: %s", res.StatusCode, string(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,6 @@
+package customScm
+
+// The aggregated states of the CI checks of a commit
+const ChecksPending = "pending"
+const ChecksSuccess = "success"
+const ChecksFailure = "failure"
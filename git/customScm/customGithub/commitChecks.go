@@ -0,0 +1,98 @@
+package customGithub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/git/customScm"
+	"github.com/google/go-github/v37/github"
+	"golang.org/x/oauth2"
+)
+
+// CommitChecks reads the commit statuses and check runs of a GitHub repo, with the token of the GitHub App.
+// The GitHub App needs the commit statuses and checks read permissions of the repo
+type CommitChecks struct {
+	tokenManager customScm.NonImpersonatedTokenManager
+}
+
+func NewCommitChecks(tokenManager customScm.NonImpersonatedTokenManager) *CommitChecks {
+	return &CommitChecks{
+		tokenManager: tokenManager,
+	}
+}
+
+// Checks returns the aggregated state of the CI checks of the commit, and the names of the failed checks.
+// A commit without any checks is pending, as its pipelines may not have started yet
+func (c *CommitChecks) Checks(repo string, sha string) (string, string, error) {
+	ownerAndName := strings.SplitN(repo, "/", 2)
+	if len(ownerAndName) != 2 {
+		return "", "", fmt.Errorf("repository %s is not in the owner/name format", repo)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	token, _, err := c.tokenManager.TokenFor(ownerAndName[0])
+	if err != nil {
+		return "", "", fmt.Errorf("couldn't get scm token: %s", err)
+	}
+	client := github.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+
+	status, _, err := client.Repositories.GetCombinedStatus(ctx, ownerAndName[0], ownerAndName[1], sha, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return "", "", fmt.Errorf("cannot get the commit statuses of %s@%s: %s", repo, sha, err)
+	}
+
+	var runs []*github.CheckRun
+	opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, res, err := client.Checks.ListCheckRunsForRef(ctx, ownerAndName[0], ownerAndName[1], sha, opts)
+		if err != nil {
+			return "", "", fmt.Errorf("cannot list the check runs of %s@%s: %s", repo, sha, err)
+		}
+		runs = append(runs, page.CheckRuns...)
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	state, failed := checksState(status.Statuses, runs)
+	return state, strings.Join(failed, ", "), nil
+}
+
+// checksState aggregates the commit statuses and check runs: any failure fails the commit,
+// then any unfinished check keeps it pending
+func checksState(statuses []*github.RepoStatus, runs []*github.CheckRun) (string, []string) {
+	var failed []string
+	pending := len(statuses) == 0 && len(runs) == 0
+
+	for _, status := range statuses {
+		switch status.GetState() {
+		case "failure", "error":
+			failed = append(failed, status.GetContext())
+		case "pending":
+			pending = true
+		}
+	}
+	for _, run := range runs {
+		if run.GetStatus() != "completed" {
+			pending = true
+			continue
+		}
+		switch run.GetConclusion() {
+		case "failure", "cancelled", "timed_out", "action_required":
+			failed = append(failed, run.GetName())
+		}
+	}
+
+	if len(failed) > 0 {
+		return customScm.ChecksFailure, failed
+	}
+	if pending {
+		return customScm.ChecksPending, nil
+	}
+	return customScm.ChecksSuccess, nil
+}
@@ -0,0 +1,34 @@
+package customGithub
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimletd/git/customScm"
+	"github.com/google/go-github/v37/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checksState(t *testing.T) {
+	state, _ := checksState(nil, nil)
+	assert.Equal(t, customScm.ChecksPending, state, "should wait for the checks to start")
+
+	statuses := []*github.RepoStatus{
+		{Context: github.String("kubeval"), State: github.String("success")},
+	}
+	runs := []*github.CheckRun{
+		{Name: github.String("opa"), Status: github.String("in_progress")},
+	}
+	state, _ = checksState(statuses, runs)
+	assert.Equal(t, customScm.ChecksPending, state)
+
+	runs[0].Status = github.String("completed")
+	runs[0].Conclusion = github.String("success")
+	state, _ = checksState(statuses, runs)
+	assert.Equal(t, customScm.ChecksSuccess, state)
+
+	runs = append(runs, &github.CheckRun{Name: github.String("conftest"), Status: github.String("completed"), Conclusion: github.String("failure")})
+	statuses = append(statuses, &github.RepoStatus{Context: github.String("lint"), State: github.String("pending")})
+	state, failed := checksState(statuses, runs)
+	assert.Equal(t, customScm.ChecksFailure, state, "a failure should decide even while other checks run")
+	assert.Equal(t, []string{"conftest"}, failed)
+}
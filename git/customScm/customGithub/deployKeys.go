@@ -0,0 +1,103 @@
+package customGithub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/git/customScm"
+	"github.com/google/go-github/v37/github"
+	"golang.org/x/oauth2"
+)
+
+// DeployKeys manages the deploy keys of a GitHub repo, with the token of the GitHub App.
+// The GitHub App needs the administration write permission of the repo
+type DeployKeys struct {
+	tokenManager customScm.NonImpersonatedTokenManager
+	repoName     string
+}
+
+// NewDeployKeys manages the deploy keys of the repo, in the owner/name format
+func NewDeployKeys(tokenManager customScm.NonImpersonatedTokenManager, repo string) *DeployKeys {
+	return &DeployKeys{
+		tokenManager: tokenManager,
+		repoName:     repo,
+	}
+}
+
+// Add registers the public key on the repo with write access
+func (d *DeployKeys) Add(title string, publicKey string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client, owner, repo, err := d.client(ctx)
+	if err != nil {
+		return err
+	}
+	readOnly := false
+	_, _, err = client.Repositories.CreateKey(ctx, owner, repo, &github.Key{
+		Title:    &title,
+		Key:      &publicKey,
+		ReadOnly: &readOnly,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot add deploy key to %s: %s", d.repoName, err)
+	}
+	return nil
+}
+
+// Remove deletes the public key from the repo, it returns false if the repo doesn't have the key
+func (d *DeployKeys) Remove(publicKey string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	client, owner, repo, err := d.client(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		keys, res, err := client.Repositories.ListKeys(ctx, owner, repo, opts)
+		if err != nil {
+			return false, fmt.Errorf("cannot list the deploy keys of %s: %s", d.repoName, err)
+		}
+		for _, key := range keys {
+			if !sameKey(key.GetKey(), publicKey) {
+				continue
+			}
+			_, err = client.Repositories.DeleteKey(ctx, owner, repo, key.GetID())
+			if err != nil {
+				return false, fmt.Errorf("cannot delete deploy key %d of %s: %s", key.GetID(), d.repoName, err)
+			}
+			return true, nil
+		}
+		if res.NextPage == 0 {
+			return false, nil
+		}
+		opts.Page = res.NextPage
+	}
+}
+
+// client returns a GitHub client, and the owner and name of the repo
+func (d *DeployKeys) client(ctx context.Context) (*github.Client, string, string, error) {
+	parts := strings.Split(d.repoName, "/")
+	if len(parts) != 2 {
+		return nil, "", "", fmt.Errorf("cannot determine repo owner and name of %s", d.repoName)
+	}
+
+	token, _, err := d.tokenManager.TokenFor(parts[0])
+	if err != nil {
+		return nil, "", "", fmt.Errorf("couldn't get scm token: %s", err)
+	}
+	client := github.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+	return client, parts[0], parts[1], nil
+}
+
+// sameKey compares authorized_keys format keys by their type and key data, GitHub drops the comments
+func sameKey(a string, b string) bool {
+	aFields, bFields := strings.Fields(a), strings.Fields(b)
+	return len(aFields) >= 2 && len(bFields) >= 2 &&
+		aFields[0] == bFields[0] && aFields[1] == bFields[1]
+}
@@ -6,91 +6,170 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gimlet-io/gimletd/cmd/config"
 	"github.com/google/go-github/v37/github"
-	"github.com/sirupsen/logrus"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-// GithubOrgTokenManager maintains a valid git org/non-impersonated token
+const orgUser = "abc123"
+
+// installations are listed at most this often, when a token is asked for an unknown owner
+const installationDiscoveryInterval = time.Minute
+
+// appsAPI is the part of the Github Apps API the token manager uses
+type appsAPI interface {
+	ListInstallations(ctx context.Context, opts *github.ListOptions) ([]*github.Installation, *github.Response, error)
+	CreateInstallationToken(ctx context.Context, id int64, opts *github.InstallationTokenOptions) (*github.InstallationToken, *github.Response, error)
+}
+
+// GithubOrgTokenManager maintains valid git org/non-impersonated tokens
+// for every organization and user account the Github app is installed in
 type GithubOrgTokenManager struct {
-	appId          string
-	privateKey     string
-	installationId int64
+	appId      string
+	privateKey string
+	apps       func() (appsAPI, error)
 
-	orgUser   string
-	orgToken  string
-	expiresAt *time.Time
+	lock sync.Mutex
+	// installationId is the installation Token() returns a token for, 0 if it is ambiguous
+	installationId int64
+	installations  map[string]int64
+	discoveredAt   time.Time
+	tokens         map[int64]*github.InstallationToken
 }
 
+// NewGithubOrgTokenManager creates a token manager for the configured Github app.
+// If GITHUB_INSTALLATION_ID is not set, the installations of the app are discovered
 func NewGithubOrgTokenManager(config *config.Config) (*GithubOrgTokenManager, error) {
-	installID, err := strconv.ParseInt(config.Github.InstallationID, 10, 64)
-	if err != nil {
-		return nil, fmt.Errorf("could not parse installationId: %s", err)
-	}
-
 	manager := &GithubOrgTokenManager{
-		appId:          config.Github.AppID,
-		privateKey:     config.Github.PrivateKey.String(),
-		installationId: installID,
+		appId:         config.Github.AppID,
+		privateKey:    config.Github.PrivateKey.String(),
+		installations: map[string]int64{},
+		tokens:        map[int64]*github.InstallationToken{},
 	}
-	err = manager.refreshOrgToken()
-	if err != nil {
-		return nil, fmt.Errorf("could refresh org token: %s", err)
+	manager.apps = manager.appsClient
+
+	if config.Github.InstallationID != "" {
+		installID, err := strconv.ParseInt(config.Github.InstallationID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse installationId: %s", err)
+		}
+		manager.installationId = installID
+	} else {
+		err := manager.discoverInstallations()
+		if err != nil {
+			return nil, fmt.Errorf("could not discover the installations of the Github app: %s", err)
+		}
 	}
 
-	go manager.refreshLoop()
+	if manager.installationId != 0 {
+		_, _, err := manager.Token()
+		if err != nil {
+			return nil, fmt.Errorf("could refresh org token: %s", err)
+		}
+	}
 
 	return manager, nil
 }
 
-// Token returns a valid cached orgToken
+// Token returns a valid token of the default installation:
+// the one set in GITHUB_INSTALLATION_ID, or the only installation of the app
 func (tm *GithubOrgTokenManager) Token() (string, string, error) {
-	if tm.orgToken == "" {
-		return "", "", fmt.Errorf("no valid orgToken available")
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+
+	if tm.installationId == 0 {
+		return "", "", fmt.Errorf("the Github app is installed in %d accounts, set GITHUB_INSTALLATION_ID to pick the default one", len(tm.installations))
 	}
-	return tm.orgToken, tm.orgUser, nil
+	return tm.token(tm.installationId)
 }
 
-func (tm *GithubOrgTokenManager) refreshLoop() {
-	for {
-		time.Sleep(5 * time.Minute)
-		if tm.orgToken != "" && tm.expiresAt != nil && tm.expiresAt.Before(time.Now().Add(time.Minute*10)) {
-			err := tm.refreshOrgToken()
-			if err != nil {
-				logrus.Errorf("could not refresh orgToken %v", err)
-				continue
-			}
+// TokenFor returns a valid token of the installation in the given organization or user account
+func (tm *GithubOrgTokenManager) TokenFor(owner string) (string, string, error) {
+	tm.lock.Lock()
+	defer tm.lock.Unlock()
+
+	installationId, ok := tm.installations[strings.ToLower(owner)]
+	if !ok && time.Since(tm.discoveredAt) > installationDiscoveryInterval {
+		err := tm.discoverInstallations()
+		if err != nil {
+			return "", "", fmt.Errorf("could not discover the installations of the Github app: %s", err)
 		}
+		installationId, ok = tm.installations[strings.ToLower(owner)]
+	}
+	if !ok {
+		return "", "", fmt.Errorf("the Github app is not installed in %s", owner)
+	}
+	return tm.token(installationId)
+}
+
+// token returns the cached token of the installation, or creates a new one if it expires soon
+func (tm *GithubOrgTokenManager) token(installationId int64) (string, string, error) {
+	if cached, ok := tm.tokens[installationId]; ok &&
+		cached.ExpiresAt != nil && cached.ExpiresAt.After(time.Now().Add(10*time.Minute)) {
+		return cached.GetToken(), orgUser, nil
+	}
+
+	apps, err := tm.apps()
+	if err != nil {
+		return "", "", err
 	}
+	installationToken, _, err := apps.CreateInstallationToken(context.Background(), installationId, &github.InstallationTokenOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("could not create a token for installation %d: %s", installationId, err)
+	}
+	if installationToken.GetToken() == "" {
+		return "", "", fmt.Errorf("no valid orgToken available")
+	}
+
+	tm.tokens[installationId] = installationToken
+	return installationToken.GetToken(), orgUser, nil
 }
 
-func (tm *GithubOrgTokenManager) refreshOrgToken() error {
-	installationToken, err := tm.installationToken()
+// discoverInstallations lists the installations of the app by their lowercased account login.
+// The only installation becomes the default one, if none is configured
+func (tm *GithubOrgTokenManager) discoverInstallations() error {
+	apps, err := tm.apps()
 	if err != nil {
 		return err
 	}
 
-	tm.orgUser = "abc123"
-	tm.orgToken = *installationToken.Token
-	tm.expiresAt = installationToken.ExpiresAt
+	installations := map[string]int64{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, res, err := apps.ListInstallations(context.Background(), opts)
+		if err != nil {
+			return err
+		}
+		for _, installation := range page {
+			installations[strings.ToLower(installation.GetAccount().GetLogin())] = installation.GetID()
+		}
+		if res == nil || res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
 
+	tm.installations = installations
+	tm.discoveredAt = time.Now()
+	if tm.installationId == 0 && len(installations) == 1 {
+		for _, installationId := range installations {
+			tm.installationId = installationId
+		}
+	}
 	return nil
 }
 
-func (tm *GithubOrgTokenManager) installationToken() (*github.InstallationToken, error) {
+// appsClient returns a Github Apps API client authenticated with the app token
+func (tm *GithubOrgTokenManager) appsClient() (appsAPI, error) {
 	appToken, err := tm.appToken()
 	if err != nil {
 		return nil, err
 	}
 
 	client := github.NewClient(&http.Client{Transport: &transport{underlyingTransport: http.DefaultTransport, token: appToken}})
-
-	token, _, err := client.Apps.CreateInstallationToken(context.Background(), tm.installationId, &github.InstallationTokenOptions{})
-	if err != nil {
-		return nil, err
-	}
-	return token, nil
+	return client.Apps, nil
 }
 
 // appToken returns a signed JWT apptoken for the Github app
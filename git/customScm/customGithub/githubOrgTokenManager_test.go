@@ -0,0 +1,96 @@
+package customGithub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v37/github"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeApps struct {
+	installations []*github.Installation
+	listed        int
+	created       map[int64]int
+}
+
+func (f *fakeApps) ListInstallations(ctx context.Context, opts *github.ListOptions) ([]*github.Installation, *github.Response, error) {
+	f.listed++
+	return f.installations, &github.Response{}, nil
+}
+
+func (f *fakeApps) CreateInstallationToken(ctx context.Context, id int64, opts *github.InstallationTokenOptions) (*github.InstallationToken, *github.Response, error) {
+	f.created[id]++
+	expiresAt := time.Now().Add(time.Hour)
+	return &github.InstallationToken{
+		Token:     github.String(fmt.Sprintf("token-%d", id)),
+		ExpiresAt: &expiresAt,
+	}, &github.Response{}, nil
+}
+
+func installation(id int64, login string) *github.Installation {
+	return &github.Installation{ID: github.Int64(id), Account: &github.User{Login: github.String(login)}}
+}
+
+func newTestTokenManager(apps *fakeApps) *GithubOrgTokenManager {
+	return &GithubOrgTokenManager{
+		apps:          func() (appsAPI, error) { return apps, nil },
+		installations: map[string]int64{},
+		tokens:        map[int64]*github.InstallationToken{},
+	}
+}
+
+func Test_tokenForOwner(t *testing.T) {
+	apps := &fakeApps{
+		installations: []*github.Installation{installation(1, "gimlet-io"), installation(2, "Other-Org")},
+		created:       map[int64]int{},
+	}
+	tm := newTestTokenManager(apps)
+	assert.Nil(t, tm.discoverInstallations())
+
+	token, _, err := tm.TokenFor("other-org")
+	assert.Nil(t, err)
+	assert.Equal(t, "token-2", token, "should use the installation of the owner")
+
+	token, _, err = tm.TokenFor("gimlet-io")
+	assert.Nil(t, err)
+	assert.Equal(t, "token-1", token)
+
+	tm.TokenFor("gimlet-io")
+	assert.Equal(t, 1, apps.created[1], "should cache the token until it expires")
+
+	_, _, err = tm.Token()
+	assert.NotNil(t, err, "there is no default installation among multiple ones")
+
+	_, _, err = tm.TokenFor("unknown")
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, apps.listed, "should not list the installations again right away")
+
+	tm.discoveredAt = time.Now().Add(-2 * installationDiscoveryInterval)
+	apps.installations = append(apps.installations, installation(3, "unknown"))
+	token, _, err = tm.TokenFor("unknown")
+	assert.Nil(t, err)
+	assert.Equal(t, "token-3", token, "should discover new installations")
+}
+
+func Test_defaultInstallation(t *testing.T) {
+	apps := &fakeApps{
+		installations: []*github.Installation{installation(1, "gimlet-io")},
+		created:       map[int64]int{},
+	}
+	tm := newTestTokenManager(apps)
+	assert.Nil(t, tm.discoverInstallations())
+
+	token, user, err := tm.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-1", token, "the only installation should be the default")
+	assert.Equal(t, orgUser, user)
+
+	tm = newTestTokenManager(apps)
+	tm.installationId = 2
+	assert.Nil(t, tm.discoverInstallations())
+	token, _, _ = tm.Token()
+	assert.Equal(t, "token-2", token, "the configured installation should stay the default")
+}
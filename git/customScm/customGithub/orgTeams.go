@@ -0,0 +1,72 @@
+package customGithub
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gimlet-io/gimletd/git/customScm"
+	"github.com/google/go-github/v37/github"
+	"golang.org/x/oauth2"
+)
+
+// OrgTeams lists the teams of a GitHub org and their members, with the token of the GitHub App
+type OrgTeams struct {
+	tokenManager customScm.NonImpersonatedTokenManager
+	org          string
+}
+
+func NewOrgTeams(tokenManager customScm.NonImpersonatedTokenManager, org string) *OrgTeams {
+	return &OrgTeams{
+		tokenManager: tokenManager,
+		org:          org,
+	}
+}
+
+// Teams returns the logins of the members of each team, by team slug
+func (o *OrgTeams) Teams() (map[string][]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	token, _, err := o.tokenManager.TokenFor(o.org)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get scm token: %s", err)
+	}
+	client := github.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+
+	var teams []*github.Team
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, res, err := client.Teams.ListTeams(ctx, o.org, opts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list the teams of %s: %s", o.org, err)
+		}
+		teams = append(teams, page...)
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	members := map[string][]string{}
+	for _, team := range teams {
+		logins := []string{}
+		memberOpts := &github.TeamListTeamMembersOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			users, res, err := client.Teams.ListTeamMembersBySlug(ctx, o.org, team.GetSlug(), memberOpts)
+			if err != nil {
+				return nil, fmt.Errorf("cannot list the members of %s/%s: %s", o.org, team.GetSlug(), err)
+			}
+			for _, user := range users {
+				logins = append(logins, user.GetLogin())
+			}
+			if res.NextPage == 0 {
+				break
+			}
+			memberOpts.Page = res.NextPage
+		}
+		members[team.GetSlug()] = logins
+	}
+
+	return members, nil
+}
@@ -1,5 +1,8 @@
 package customScm
 
 type NonImpersonatedTokenManager interface {
+	// Token returns a token and user of the default installation
 	Token() (string, string, error)
+	// TokenFor returns a token and user that has access to the repositories of the given owner
+	TokenFor(owner string) (string, string, error)
 }
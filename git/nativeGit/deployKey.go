@@ -0,0 +1,64 @@
+package nativeGit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// PendingDeployKeySuffix marks the new deploy key of a rotation, next to the active one, until it is activated
+const PendingDeployKeySuffix = ".pending"
+
+// GenerateDeployKey creates an ECDSA P-256 key pair for the gitops repo.
+// It returns the private key in PEM format, and the public key in the authorized_keys format
+func GenerateDeployKey() ([]byte, string, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot generate key: %s", err)
+	}
+	der, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot serialize private key: %s", err)
+	}
+	publicKey, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot serialize public key: %s", err)
+	}
+
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	return privatePEM, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))), nil
+}
+
+// DeployPublicKey returns the public key of the private key at the path in the authorized_keys format, and its SHA256 fingerprint
+func DeployPublicKey(privateKeyPath string) (string, string, error) {
+	privateKey, err := ioutil.ReadFile(privateKeyPath)
+	if err != nil {
+		return "", "", err
+	}
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot parse private key: %s", err)
+	}
+
+	publicKey := signer.PublicKey()
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))), ssh.FingerprintSHA256(publicKey), nil
+}
+
+// WritePendingDeployKey writes the new deploy key of a rotation next to the active one, see ActivateDeployKey
+func WritePendingDeployKey(privateKeyPath string, privatePEM []byte) error {
+	return ioutil.WriteFile(privateKeyPath+PendingDeployKeySuffix, privatePEM, 0600)
+}
+
+// ActivateDeployKey replaces the deploy key with the pending one in a single rename,
+// so every git operation reads either the old or the new key, never a partially written one
+func ActivateDeployKey(privateKeyPath string) error {
+	return os.Rename(privateKeyPath+PendingDeployKeySuffix, privateKeyPath)
+}
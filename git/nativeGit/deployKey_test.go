@@ -0,0 +1,40 @@
+package nativeGit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_deployKeyRotation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "deploy-key-")
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "deploy.key")
+
+	oldKey, oldPublicKey, err := GenerateDeployKey()
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(keyPath, oldKey, 0600))
+	newKey, newPublicKey, err := GenerateDeployKey()
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(newPublicKey, "ecdsa-sha2-nistp256 "))
+	assert.NotEqual(t, oldPublicKey, newPublicKey)
+
+	err = WritePendingDeployKey(keyPath, newKey)
+	assert.Nil(t, err)
+	publicKey, _, err := DeployPublicKey(keyPath)
+	assert.Nil(t, err)
+	assert.Equal(t, oldPublicKey, publicKey, "should not touch the active key before activation")
+
+	err = ActivateDeployKey(keyPath)
+	assert.Nil(t, err)
+	publicKey, fingerprint, err := DeployPublicKey(keyPath)
+	assert.Nil(t, err)
+	assert.Equal(t, newPublicKey, publicKey)
+	assert.True(t, strings.HasPrefix(fingerprint, "SHA256:"))
+	_, err = os.Stat(keyPath + PendingDeployKeySuffix)
+	assert.True(t, os.IsNotExist(err), "should consume the pending key")
+}
@@ -3,103 +3,326 @@ package nativeGit
 import (
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
-	"github.com/otiai10/copy"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// GitopsRepoCache keeps a clone of the gitops repo for each branch that envs are deployed to
 type GitopsRepoCache struct {
 	cacheRoot               string
 	gitopsRepo              string
 	gitopsRepoDeployKeyPath string
-	repo                    *git.Repository
-	cachePath               string
+	defaultBranch           string
+	branchesLock            sync.RWMutex
+	branches                map[string]*branchClone // keyed by branch name, the default branch is ""
+	envBranches             map[string]string
+	refreshInterval         time.Duration
 	stopCh                  chan struct{}
+	refreshCh               chan struct{}
+
+	onHistoryRewrite  func(*dx.GitopsHistoryRewrite)
+	historyGeneration uint64 // incremented on each rewrite of the remote history
+	rewritesLock      sync.Mutex
+	expectedRewrites  map[string]string // keyed by branch, the head of the rewrite GimletD makes
+}
+
+// branchClone is the cached clone of a branch. It is read locked while it is used,
+// a reclone swaps it under the write lock, so the old clone is removed only after its readers released it
+type branchClone struct {
+	lock      sync.RWMutex
+	repo      *git.Repository
+	cachePath string
 }
 
 func NewGitopsRepoCache(
 	cacheRoot string,
 	gitopsRepo string,
 	gitopsRepoDeployKeyPath string,
+	defaultBranch string,
+	envs map[string]*dx.Env,
+	refreshInterval time.Duration,
 	stopCh chan struct{},
 ) (*GitopsRepoCache, error) {
-	cachePath, repo, err := CloneToTmpFs(cacheRoot, gitopsRepo, gitopsRepoDeployKeyPath)
-	if err != nil {
-		return nil, err
+	if defaultBranch == "" {
+		var err error
+		defaultBranch, err = DefaultBranch(gitopsRepo, gitopsRepoDeployKeyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	logrus.Infof("the default branch of the gitops repo is %s", defaultBranch)
+
+	envBranches := map[string]string{}
+	branches := map[string]*branchClone{"": nil}
+	for name, env := range envs {
+		if env.GitopsBranch != "" {
+			envBranches[name] = env.GitopsBranch
+			branches[env.GitopsBranch] = nil
+		}
+	}
+
+	for branch := range branches {
+		cloned := branch
+		if cloned == "" {
+			cloned = defaultBranch
+		}
+		cachePath, repo, err := CloneBranchToTmpFs(cacheRoot, gitopsRepo, gitopsRepoDeployKeyPath, cloned)
+		if err != nil {
+			if branch != "" {
+				return nil, fmt.Errorf("cannot clone gitops branch %s: %s", branch, err)
+			}
+			return nil, err
+		}
+		branches[branch] = &branchClone{repo: repo, cachePath: cachePath}
 	}
 
 	return &GitopsRepoCache{
 		cacheRoot:               cacheRoot,
 		gitopsRepo:              gitopsRepo,
 		gitopsRepoDeployKeyPath: gitopsRepoDeployKeyPath,
-		repo:                    repo,
-		cachePath:               cachePath,
+		defaultBranch:           defaultBranch,
+		branches:                branches,
+		envBranches:             envBranches,
+		refreshInterval:         refreshInterval,
 		stopCh:                  stopCh,
+		refreshCh:               make(chan struct{}, 1),
+		expectedRewrites:        map[string]string{},
 	}, nil
 }
 
 func (r *GitopsRepoCache) Run() {
 	for {
-		r.syncGitRepo()
+		for _, branch := range r.Branches() {
+			r.syncGitRepo(branch)
+		}
 
 		select {
 		case <-r.stopCh:
-			logrus.Infof("cleaning up git repo cache at %s", r.cachePath)
-			TmpFsCleanup(r.cachePath)
+			for _, branch := range r.Branches() {
+				clone, _ := r.clone(branch)
+				clone.lock.Lock()
+				logrus.Infof("cleaning up git repo cache at %s", clone.cachePath)
+				TmpFsCleanup(clone.cachePath)
+				clone.lock.Unlock()
+			}
 			return
-		case <-time.After(30 * time.Second):
+		case <-r.refreshCh:
+		case <-time.After(withJitter(r.refreshInterval)):
 		}
 	}
 }
 
-func (r *GitopsRepoCache) syncGitRepo() {
-	publicKeys, err := ssh.NewPublicKeysFromFile("git", r.gitopsRepoDeployKeyPath, "")
+// RequestRefresh makes the background loop pull the gitops repo without waiting for the refresh interval.
+// It doesn't block, requests are coalesced while a pull is pending
+func (r *GitopsRepoCache) RequestRefresh() {
+	select {
+	case r.refreshCh <- struct{}{}:
+	default:
+	}
+}
+
+// withJitter adds up to 10% random jitter to the interval,
+// so multiple instances don't hit the git server at the same time
+func withJitter(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return interval + time.Duration(rand.Int63n(int64(interval)/10+1))
+}
+
+// clone returns the cached clone of the branch
+func (r *GitopsRepoCache) clone(branch string) (*branchClone, bool) {
+	r.branchesLock.RLock()
+	defer r.branchesLock.RUnlock()
+	clone, ok := r.branches[branch]
+	return clone, ok
+}
+
+func (r *GitopsRepoCache) syncGitRepo(branch string) {
+	repo, release := r.branchInstanceForRead(branch)
+	err := Pull(repo, r.gitopsRepoDeployKeyPath, r.remoteBranch(branch))
+	release() // the reclone of a rewritten branch waits for the readers
+	if err == git.ErrNonFastForwardUpdate {
+		r.historyRewritten(branch, repo)
+		return
+	}
 	if err != nil {
-		logrus.Errorf("cannot generate public key from private: %s", err.Error())
+		logrus.Errorf("could not fetch: %s", err)
+	}
+}
+
+// OnHistoryRewrite registers the function that is called when the remote history of a branch is rewritten, eg. force pushed.
+// Must be set before Run
+func (r *GitopsRepoCache) OnHistoryRewrite(f func(*dx.GitopsHistoryRewrite)) {
+	r.onHistoryRewrite = f
+}
+
+// HistoryGeneration changes on each rewrite of the remote history.
+// Writable copies that were made in an earlier generation must not be pushed
+func (r *GitopsRepoCache) HistoryGeneration() uint64 {
+	return atomic.LoadUint64(&r.historyGeneration)
+}
+
+// ExpectRewrite tells that GimletD itself force pushes the branch to the given head, eg. in a compaction,
+// so it is not reported as a rewrite
+func (r *GitopsRepoCache) ExpectRewrite(branch string, head string) {
+	r.rewritesLock.Lock()
+	defer r.rewritesLock.Unlock()
+	r.expectedRewrites[branch] = head
+}
+
+// historyRewritten replaces the stale clone of the branch whose remote history was rewritten
+func (r *GitopsRepoCache) historyRewritten(branch string, stale *git.Repository) {
+	var oldHead string
+	if head, err := stale.Head(); err == nil {
+		oldHead = head.Hash().String()
 	}
 
-	w, err := r.repo.Worktree()
+	err := r.recloneBranch(branch)
 	if err != nil {
-		logrus.Errorf("could not get worktree: %s", err)
+		logrus.Errorf("cannot reclone the rewritten gitops branch: %s", err)
 		return
 	}
+	var newHead string
+	repo, release := r.branchInstanceForRead(branch)
+	if head, err := repo.Head(); err == nil {
+		newHead = head.Hash().String()
+	}
+	release()
 
-	w.Pull(&git.PullOptions{
-		Auth:       publicKeys,
-		RemoteName: "origin",
-	})
-	if err == git.NoErrAlreadyUpToDate {
+	r.rewritesLock.Lock()
+	expected := r.expectedRewrites[branch] == newHead
+	delete(r.expectedRewrites, branch)
+	r.rewritesLock.Unlock()
+	if expected {
 		return
 	}
-	if err != nil {
-		logrus.Errorf("could not fetch: %s", err)
+
+	atomic.AddUint64(&r.historyGeneration, 1)
+	logrus.Errorf("the history of the gitops repo %s was rewritten on branch %q: %s is not an ancestor of %s anymore", r.gitopsRepo, branch, oldHead, newHead)
+	if r.onHistoryRewrite != nil {
+		r.onHistoryRewrite(&dx.GitopsHistoryRewrite{
+			Branch:   branch,
+			OldHead:  oldHead,
+			NewHead:  newHead,
+			Detected: time.Now().Unix(),
+		})
+	}
+}
+
+// DefaultBranch returns the default branch of the gitops repo, detected from the remote HEAD if not configured
+func (r *GitopsRepoCache) DefaultBranch() string {
+	return r.defaultBranch
+}
+
+// remoteBranch returns the name of the branch on the remote, resolving the default branch
+func (r *GitopsRepoCache) remoteBranch(branch string) string {
+	if branch == "" {
+		return r.defaultBranch
+	}
+	return branch
+}
+
+// Branch returns the branch that the env is deployed to, empty for the default branch
+func (r *GitopsRepoCache) Branch(env string) string {
+	return r.envBranches[env]
+}
+
+// Branches returns the tracked branches, the default branch is ""
+func (r *GitopsRepoCache) Branches() []string {
+	r.branchesLock.RLock()
+	defer r.branchesLock.RUnlock()
+	var branches []string
+	for branch := range r.branches {
+		branches = append(branches, branch)
 	}
+	sort.Strings(branches)
+	return branches
+}
+
+// InstanceForRead returns the clone of the default branch, and the function that releases it
+func (r *GitopsRepoCache) InstanceForRead() (*git.Repository, func()) {
+	return r.branchInstanceForRead("")
+}
+
+// EnvInstanceForRead returns the clone of the branch that the env is deployed to, and the function that releases it.
+// The clone is not replaced until it is released, so release it as soon as the read is done
+func (r *GitopsRepoCache) EnvInstanceForRead(env string) (*git.Repository, func()) {
+	return r.branchInstanceForRead(r.Branch(env))
+}
+
+func (r *GitopsRepoCache) branchInstanceForRead(branch string) (*git.Repository, func()) {
+	clone, _ := r.clone(branch)
+	clone.lock.RLock()
+	return clone.repo, clone.lock.RUnlock
 }
 
-func (r *GitopsRepoCache) InstanceForRead() *git.Repository {
-	return r.repo
+// Envs lists the envs that have releases on their own branch
+func (r *GitopsRepoCache) Envs() ([]string, error) {
+	var envs []string
+	for _, branch := range r.Branches() {
+		repo, release := r.branchInstanceForRead(branch)
+		branchEnvs, err := Envs(repo)
+		release()
+		if err != nil {
+			return nil, err
+		}
+		for _, env := range branchEnvs {
+			if r.Branch(env) == branch {
+				envs = append(envs, env)
+			}
+		}
+	}
+	return envs, nil
 }
 
 func (r *GitopsRepoCache) InstanceForWrite() (*git.Repository, string, error) {
+	return r.BranchInstanceForWrite("")
+}
+
+// EnvInstanceForWrite returns a writable copy of the branch that the env is deployed to
+func (r *GitopsRepoCache) EnvInstanceForWrite(env string) (*git.Repository, string, error) {
+	return r.BranchInstanceForWrite(r.Branch(env))
+}
+
+// BranchInstanceForWrite returns a writable copy of the branch, with the branch and its submodules checked out.
+// The copy shares the git objects of the cache, see copyWithSharedObjects
+func (r *GitopsRepoCache) BranchInstanceForWrite(branch string) (*git.Repository, string, error) {
+	clone, ok := r.clone(branch)
+	if !ok {
+		return nil, "", fmt.Errorf("gitops branch %s is not tracked", branch)
+	}
+
 	tmpPath, err := ioutil.TempDir(r.cacheRoot, "gitops-cow-")
 	if err != nil {
-		errors.WithMessage(err, "couldn't get temporary directory")
+		return nil, "", errors.WithMessage(err, "couldn't get temporary directory")
 	}
 
-	err = copy.Copy(r.cachePath, tmpPath)
+	clone.lock.RLock()
+	err = copyWithSharedObjects(clone.cachePath, tmpPath) // the copy hard links the objects, so it outlives the clone
+	clone.lock.RUnlock()
 	if err != nil {
-		errors.WithMessage(err, "could not make copy of repo")
+		os.RemoveAll(tmpPath)
+		return nil, "", errors.WithMessage(err, "could not make copy of repo")
 	}
 
 	copiedRepo, err := git.PlainOpen(tmpPath)
 	if err != nil {
 		return nil, "", fmt.Errorf("cannot open git repository at %s: %s", tmpPath, err)
 	}
+	err = UpdateSubmodules(copiedRepo, nil, false) // the copy has the objects of the submodules that the cache pulled
+	if err != nil {
+		return nil, "", err
+	}
 
 	return copiedRepo, tmpPath, nil
 }
@@ -108,6 +331,48 @@ func (r *GitopsRepoCache) CleanupWrittenRepo(path string) error {
 	return os.RemoveAll(path)
 }
 
+// Reclone replaces the cached repo with a fresh clone.
+// Needed when the remote history was rewritten, and pulls can't fast-forward anymore
+func (r *GitopsRepoCache) Reclone() error {
+	return r.RecloneBranch("")
+}
+
+// RecloneBranch replaces the cached clone of the branch with a fresh clone
+func (r *GitopsRepoCache) RecloneBranch(branch string) error {
+	r.rewritesLock.Lock()
+	delete(r.expectedRewrites, branch)
+	r.rewritesLock.Unlock()
+
+	return r.recloneBranch(branch)
+}
+
+func (r *GitopsRepoCache) recloneBranch(branch string) error {
+	clone, ok := r.clone(branch)
+	if !ok {
+		return fmt.Errorf("gitops branch %s is not tracked", branch)
+	}
+
+	cachePath, repo, err := CloneBranchToTmpFs(r.cacheRoot, r.gitopsRepo, r.gitopsRepoDeployKeyPath, r.remoteBranch(branch))
+	if err != nil {
+		return err
+	}
+
+	clone.lock.Lock() // waits for the readers of the old clone
+	oldCachePath := clone.cachePath
+	clone.repo = repo
+	clone.cachePath = cachePath
+	clone.lock.Unlock()
+
+	return TmpFsCleanup(oldCachePath)
+}
+
 func (r *GitopsRepoCache) Invalidate() {
-	r.syncGitRepo()
+	r.InvalidateBranch("")
+}
+
+// InvalidateBranch pulls the branch, so reads see the changes that were just pushed
+func (r *GitopsRepoCache) InvalidateBranch(branch string) {
+	if _, ok := r.clone(branch); ok {
+		r.syncGitRepo(branch)
+	}
 }
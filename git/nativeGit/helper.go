@@ -9,15 +9,20 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
@@ -28,6 +33,11 @@ const File_RW_RW_R = 0664
 const Dir_RWX_RX_R = 0754
 
 func CloneToTmpFs(rootPath string, repoName string, privateKeyPath string) (string, *git.Repository, error) {
+	return CloneBranchToTmpFs(rootPath, repoName, privateKeyPath, "")
+}
+
+// CloneBranchToTmpFs clones the repo with the given branch checked out, the default branch if empty
+func CloneBranchToTmpFs(rootPath string, repoName string, privateKeyPath string, branch string) (string, *git.Repository, error) {
 	err := os.MkdirAll(rootPath, Dir_RWX_RX_R)
 	if err != nil {
 		return "", nil, errors.WithMessage(err, "cannot create folder at $REPO_CACHE_PATH")
@@ -43,14 +53,93 @@ func CloneToTmpFs(rootPath string, repoName string, privateKeyPath string) (stri
 	}
 
 	opts := &git.CloneOptions{
-		URL:  url,
-		Auth: publicKeys,
+		URL:               url,
+		Auth:              publicKeys,
+		RecurseSubmodules: SubmoduleRecursion(),
+	}
+	if branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(branch)
 	}
 
 	repo, err := git.PlainClone(path, false, opts)
 	return path, repo, err
 }
 
+// ProbeRemote lists the refs of the gitops repo with the deploy key, to check that the remote is reachable
+func ProbeRemote(repoName string, privateKeyPath string) error {
+	publicKeys, err := ssh.NewPublicKeysFromFile("git", privateKeyPath, "")
+	if err != nil {
+		return fmt.Errorf("cannot generate public key from private: %s", err.Error())
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &gitConfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{fmt.Sprintf(gitSSHAddressFormat, repoName)},
+	})
+	_, err = remote.List(&git.ListOptions{Auth: publicKeys})
+	return err
+}
+
+// DefaultBranch returns the default branch of the repo from the remote HEAD,
+// so repos with a default branch other than master are pulled and pushed right
+func DefaultBranch(repoName string, privateKeyPath string) (string, error) {
+	publicKeys, err := ssh.NewPublicKeysFromFile("git", privateKeyPath, "")
+	if err != nil {
+		return "", fmt.Errorf("cannot generate public key from private: %s", err.Error())
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &gitConfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{fmt.Sprintf(gitSSHAddressFormat, repoName)},
+	})
+	refs, err := remote.List(&git.ListOptions{Auth: publicKeys})
+	if err != nil {
+		return "", fmt.Errorf("cannot list the refs of %s: %s", repoName, err)
+	}
+
+	branch, err := headBranch(refs)
+	if err != nil {
+		return "", fmt.Errorf("cannot detect the default branch of %s: %s", repoName, err)
+	}
+	return branch, nil
+}
+
+// headBranch returns the branch that HEAD points to in the advertised refs.
+// If the server doesn't advertise HEAD as a symbolic ref, the branch at the HEAD commit is picked, main and master first
+func headBranch(refs []*plumbing.Reference) (string, error) {
+	var head *plumbing.Reference
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			head = ref
+		}
+	}
+	if head == nil {
+		return "", fmt.Errorf("remote has no HEAD")
+	}
+	if head.Type() == plumbing.SymbolicReference {
+		return head.Target().Short(), nil
+	}
+
+	var candidates []string
+	for _, ref := range refs {
+		if ref.Name().IsBranch() && ref.Hash() == head.Hash() {
+			candidates = append(candidates, ref.Name().Short())
+		}
+	}
+	sort.Strings(candidates)
+	for _, preferred := range []string{"main", "master"} {
+		for _, candidate := range candidates {
+			if candidate == preferred {
+				return candidate, nil
+			}
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0], nil
+	}
+	return "", fmt.Errorf("no branch is at HEAD %s", head.Hash())
+}
+
 func TmpFsCleanup(path string) error {
 	return os.RemoveAll(path)
 }
@@ -76,6 +165,33 @@ func Push(repo *git.Repository, privateKeyPath string) error {
 	return err
 }
 
+// Pull pulls the branch of the repo, the default branch if empty
+func Pull(repo *git.Repository, privateKeyPath string, branch string) error {
+	publicKeys, err := ssh.NewPublicKeysFromFile("git", privateKeyPath, "")
+	if err != nil {
+		return fmt.Errorf("cannot generate public key from private: %s", err.Error())
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("could not get worktree: %s", err)
+	}
+
+	pullOptions := &git.PullOptions{
+		Auth:              publicKeys,
+		RemoteName:        "origin",
+		RecurseSubmodules: SubmoduleRecursion(),
+	}
+	if branch != "" {
+		pullOptions.ReferenceName = plumbing.NewBranchReferenceName(branch)
+	}
+	err = w.Pull(pullOptions)
+	if err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return err
+}
+
 func NothingToCommit(repo *git.Repository) (bool, error) {
 	worktree, err := repo.Worktree()
 	if err != nil {
@@ -90,6 +206,10 @@ func NothingToCommit(repo *git.Repository) (bool, error) {
 	return status.IsClean(), nil
 }
 
+// The author of the commits that GimletD makes to the gitops repo
+const authorName = "Gimlet CLI"
+const authorEmail = "cli@gimlet.io"
+
 func Commit(repo *git.Repository, message string) (string, error) {
 	worktree, err := repo.Worktree()
 	if err != nil {
@@ -98,8 +218,8 @@ func Commit(repo *git.Repository, message string) (string, error) {
 
 	sha, err := worktree.Commit(message, &git.CommitOptions{
 		Author: &object.Signature{
-			Name:  "Gimlet CLI",
-			Email: "cli@gimlet.io",
+			Name:  authorName,
+			Email: authorEmail,
 			When:  time.Now(),
 		},
 	})
@@ -128,39 +248,236 @@ func NativePush(repoPath string, privateKeyPath string, branch string) error {
 	return execCommand(repoPath, "git", "push", "origin", branch)
 }
 
+// NativeForcePush overwrites the remote branch with the local one
+func NativeForcePush(repoPath string, privateKeyPath string, branch string) error {
+	sshCommand := fmt.Sprintf("ssh -i %s", privateKeyPath)
+	err := execCommand(repoPath, "git", "config", "core.sshCommand", sshCommand)
+	if err != nil {
+		return err
+	}
+	return execCommand(repoPath, "git", "push", "--force", "origin", branch)
+}
+
+// NativePushToBranch pushes the commit to a branch of the remote, creating the branch
+func NativePushToBranch(repoPath string, privateKeyPath string, sha string, branch string) error {
+	sshCommand := fmt.Sprintf("ssh -i %s", privateKeyPath)
+	err := execCommand(repoPath, "git", "config", "core.sshCommand", sshCommand)
+	if err != nil {
+		return err
+	}
+	return execCommand(repoPath, "git", "push", "origin", sha+":refs/heads/"+branch)
+}
+
+// NativeRemoteBranches lists the branches of the remote that match the pattern, eg. archive/*
+func NativeRemoteBranches(repoPath string, privateKeyPath string, pattern string) ([]string, error) {
+	sshCommand := fmt.Sprintf("ssh -i %s", privateKeyPath)
+	err := execCommand(repoPath, "git", "config", "core.sshCommand", sshCommand)
+	if err != nil {
+		return nil, err
+	}
+	output, err := execCommandOutput(repoPath, "git", "ls-remote", "--heads", "origin", pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			branches = append(branches, strings.TrimPrefix(fields[1], "refs/heads/"))
+		}
+	}
+	return branches, nil
+}
+
+// NativeDeleteRemoteBranches deletes the branches of the remote
+func NativeDeleteRemoteBranches(repoPath string, privateKeyPath string, branches []string) error {
+	if len(branches) == 0 {
+		return nil
+	}
+	sshCommand := fmt.Sprintf("ssh -i %s", privateKeyPath)
+	err := execCommand(repoPath, "git", "config", "core.sshCommand", sshCommand)
+	if err != nil {
+		return err
+	}
+	return execCommand(repoPath, "git", append([]string{"push", "origin", "--delete"}, branches...)...)
+}
+
+// SquashFolderHistory squashes the runs of consecutive commits before the given time that only change files
+// in the folders that inFolder matches, each run into a single commit with the tree of its last commit.
+// The other commits are kept with their trees, the history before the first squashed run keeps its hashes.
+// Returns false if there was nothing to squash
+func SquashFolderHistory(repo *git.Repository, before time.Time, inFolder func(path string) bool, message string) (bool, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return false, err
+	}
+
+	var commits []*object.Commit
+	commit, err := repo.CommitObject(head.Hash())
+	for err == nil {
+		commits = append([]*object.Commit{commit}, commits...)
+		if commit.NumParents() == 0 {
+			break
+		}
+		commit, err = commit.Parent(0)
+	}
+	if err != nil {
+		return false, errors.WithMessage(err, "could not walk commits")
+	}
+
+	squashed := false
+	var parent plumbing.Hash
+	var run []*object.Commit
+	write := func(c *object.Commit) error {
+		if !squashed && (c.NumParents() == 0 && parent.IsZero() || c.NumParents() > 0 && c.ParentHashes[0] == parent) {
+			parent = c.Hash
+			return nil
+		}
+		parentHashes := []plumbing.Hash{parent}
+		if c.NumParents() > 1 {
+			parentHashes = append(parentHashes, c.ParentHashes[1:]...)
+		}
+		parent, err = storeCommit(repo, &object.Commit{
+			Author:       c.Author,
+			Committer:    c.Committer,
+			Message:      c.Message,
+			TreeHash:     c.TreeHash,
+			ParentHashes: parentHashes,
+		})
+		return err
+	}
+	flush := func() error {
+		defer func() { run = nil }()
+		if len(run) == 1 {
+			return write(run[0])
+		}
+		if len(run) > 1 {
+			squashed = true
+			signature := object.Signature{Name: authorName, Email: authorEmail, When: time.Now()}
+			var parentHashes []plumbing.Hash
+			if !parent.IsZero() {
+				parentHashes = []plumbing.Hash{parent}
+			}
+			parent, err = storeCommit(repo, &object.Commit{
+				Author:       signature,
+				Committer:    signature,
+				Message:      fmt.Sprintf("%s\n\n%d commits squashed", message, len(run)),
+				TreeHash:     run[len(run)-1].TreeHash,
+				ParentHashes: parentHashes,
+			})
+			return err
+		}
+		return nil
+	}
+
+	for _, c := range commits {
+		inFolders := false
+		if c.Committer.When.Before(before) {
+			inFolders, err = onlyChangesIn(c, inFolder)
+			if err != nil {
+				return false, err
+			}
+		}
+		if inFolders {
+			run = append(run, c)
+			continue
+		}
+		if err := flush(); err != nil {
+			return false, err
+		}
+		if err := write(c); err != nil {
+			return false, err
+		}
+	}
+	if err := flush(); err != nil {
+		return false, err
+	}
+	if !squashed {
+		return false, nil
+	}
+
+	return true, repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), parent))
+}
+
+// onlyChangesIn tells if the commit changes files, and only in the folders that inFolder matches
+func onlyChangesIn(c *object.Commit, inFolder func(path string) bool) (bool, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return false, err
+	}
+	var parentTree *object.Tree
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return false, err
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return false, err
+	}
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name != "" && !inFolder(name) {
+				return false, nil
+			}
+		}
+	}
+	return len(changes) > 0, nil
+}
+
+func storeCommit(repo *git.Repository, c *object.Commit) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	if err := c.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(obj)
+}
+
 func execCommand(rootPath string, cmdName string, args ...string) error {
+	_, err := execCommandOutput(rootPath, cmdName, args...)
+	return err
+}
+
+func execCommandOutput(rootPath string, cmdName string, args ...string) (string, error) {
 	cmd := exec.CommandContext(context.TODO(), cmdName, args...)
 	cmd.Dir = rootPath
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return errors.WithMessage(err, "get stdout pipe for command")
+		return "", errors.WithMessage(err, "get stdout pipe for command")
 	}
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return errors.WithMessage(err, "get stderr pipe for command")
+		return "", errors.WithMessage(err, "get stderr pipe for command")
 	}
 	err = cmd.Start()
 	if err != nil {
-		return errors.WithMessage(err, "start command")
+		return "", errors.WithMessage(err, "start command")
 	}
 
 	stdoutData, err := ioutil.ReadAll(stdout)
 	if err != nil {
-		return errors.WithMessage(err, "read stdout data of command")
+		return "", errors.WithMessage(err, "read stdout data of command")
 	}
 	stderrData, err := ioutil.ReadAll(stderr)
 	if err != nil {
-		return errors.WithMessage(err, "read stderr data of command")
+		return "", errors.WithMessage(err, "read stderr data of command")
 	}
 
 	err = cmd.Wait()
 	logrus.Infof("git/commit: exec command '%s %s': stdout: %s", cmdName, strings.Join(args, " "), stdoutData)
 	logrus.Infof("git/commit: exec command '%s %s': stderr: %s", cmdName, strings.Join(args, " "), stderrData)
 	if err != nil {
-		return fmt.Errorf("cannot execute command %s: %s", err.Error(), stderrData)
+		return "", fmt.Errorf("cannot execute command %s: %s", err.Error(), stderrData)
 	}
 
-	return nil
+	return string(stdoutData), nil
 }
 
 func DelDir(repo *git.Repository, path string) error {
@@ -361,12 +678,15 @@ func Folder(repo *git.Repository, path string) (map[string]string, error) {
 	return files, nil
 }
 
+// Releases lists the deploys of the app, or all apps of the env, from the gitops history, newest first.
+// With lifecycle, rollbacks and deletes are listed too, classified by their Type
 func Releases(
 	repo *git.Repository,
 	app, env string,
 	since, until *time.Time,
 	limit int,
 	gitRepo string,
+	lifecycle bool,
 ) ([]*dx.Release, error) {
 	releases := []*dx.Release{}
 
@@ -398,34 +718,27 @@ func Releases(
 
 		if RollbackCommit(c) ||
 			DeleteCommit(c) {
-			return nil
-		}
-
-		releaseFile, err := c.File(env + "/release.json")
-		if err != nil {
-			releaseFile, err = c.File(path + "/release.json")
-			if err != nil {
-				logrus.Debugf("no release file for %s: %s", c.Hash.String(), err)
+			if !lifecycle {
 				return nil
 			}
+			release := lifecycleRelease(repo, c, app, env, path)
+			if gitRepo != "" { // gitRepo filter
+				if release.Version == nil ||
+					release.Version.RepositoryName != gitRepo {
+					return nil
+				}
+			}
+			releases = append(releases, release)
+			return nil
 		}
 
-		buf := new(bytes.Buffer)
-		reader, err := releaseFile.Blob.Reader()
+		release, err := releaseOf(c, env, path)
 		if err != nil {
 			logrus.Warnf("cannot parse release file for %s: %s", c.Hash.String(), err)
 			releases = append(releases, releaseFromCommit(c, app, env))
 			return nil
 		}
-
-		buf.ReadFrom(reader)
-		releaseBytes := buf.Bytes()
-
-		var release *dx.Release
-		err = json.Unmarshal(releaseBytes, &release)
-		if err != nil {
-			logrus.Warnf("cannot parse release file for %s: %s", c.Hash.String(), err)
-			//releases = append(releases, releaseFromCommit(c, app, env))
+		if release == nil {
 			return nil
 		}
 
@@ -436,6 +749,7 @@ func Releases(
 			}
 		}
 
+		release.Type = dx.ReleaseTypeDeploy
 		release.Created = c.Committer.When.Unix()
 		release.GitopsRef = c.Hash.String()
 
@@ -458,6 +772,78 @@ func Releases(
 	return releases, nil
 }
 
+// releaseOf reads the release meta data from the commit, falling back to its trailers.
+// It returns nil if the commit has no, or an unparseable release file and no release trailers, and an error if the file can't be read
+func releaseOf(c *object.Commit, env string, path string) (*dx.Release, error) {
+	releaseFile, err := c.File(env + "/release.json")
+	if err != nil {
+		releaseFile, err = c.File(path + "/release.json")
+		if err != nil {
+			logrus.Debugf("no release file for %s: %s", c.Hash.String(), err)
+			return ReleaseFromTrailers(c), nil
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	reader, err := releaseFile.Blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	buf.ReadFrom(reader)
+	releaseBytes := buf.Bytes()
+
+	var release *dx.Release
+	err = json.Unmarshal(releaseBytes, &release)
+	if err != nil {
+		logrus.Warnf("cannot parse release file for %s: %s", c.Hash.String(), err)
+		return ReleaseFromTrailers(c), nil
+	}
+	return release, nil
+}
+
+var revertedCommitPattern = regexp.MustCompile(`This reverts commit ([0-9a-f]{40})`)
+var deleteCommitPattern = regexp.MustCompile(`\[GimletD delete\] ([^/\s]+)/(\S+) deleted by (\S+)`)
+
+// lifecycleRelease classifies a rollback or delete commit.
+// Rollbacks carry the app, version and artifact of the release they reverted
+func lifecycleRelease(repo *git.Repository, c *object.Commit, app string, env string, path string) *dx.Release {
+	release := releaseFromCommit(c, app, env)
+
+	if DeleteCommit(c) {
+		release.Type = dx.ReleaseTypeDelete
+		if matches := deleteCommitPattern.FindStringSubmatch(c.Message); matches != nil {
+			release.Env = matches[1]
+			release.App = matches[2]
+			release.TriggeredBy = matches[3]
+		}
+		return release
+	}
+
+	release.Type = dx.ReleaseTypeRollback
+	matches := revertedCommitPattern.FindStringSubmatch(c.Message)
+	if matches == nil {
+		return release
+	}
+	release.RevertedRef = matches[1]
+
+	revertedCommit, err := repo.CommitObject(plumbing.NewHash(release.RevertedRef))
+	if err != nil {
+		logrus.Debugf("cannot find the reverted commit of %s: %s", c.Hash.String(), err)
+		return release
+	}
+	reverted, err := releaseOf(revertedCommit, env, path)
+	if err != nil || reverted == nil {
+		return release
+	}
+	if reverted.App != "" {
+		release.App = reverted.App
+	}
+	release.ArtifactID = reverted.ArtifactID
+	release.Version = reverted.Version
+	return release
+}
+
 func Status(
 	repo *git.Repository,
 	app, env string,
@@ -556,10 +942,111 @@ func readAppStatus(fs billy.Filesystem, path string) (*dx.Release, error) {
 	return release, err
 }
 
+// LastCommitBefore returns the most recent commit that was committed before the given time,
+// or nil if there is no such commit
+func LastCommitBefore(repo *git.Repository, before time.Time) (*object.Commit, error) {
+	commits, err := repo.Log(&git.LogOptions{})
+	if err != nil {
+		return nil, errors.WithMessage(err, "could not walk commits")
+	}
+
+	var commit *object.Commit
+	err = commits.ForEach(func(c *object.Commit) error {
+		if c.Committer.When.Before(before) {
+			commit = c
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commit, nil
+}
+
+// WithCorrelationTrailer appends the correlation ID of the deploy to the commit message as a git trailer
+func WithCorrelationTrailer(message string, correlationID string) string {
+	if correlationID == "" {
+		return message
+	}
+	return withTrailer(message, "Correlation-ID", correlationID)
+}
+
+// Git trailers of the release meta data on deploy commits,
+// so the gitops history is machine-readable even without the release.json files
+const (
+	TrailerApp        = "Gimlet-App"
+	TrailerEnv        = "Gimlet-Env"
+	TrailerArtifactID = "Gimlet-Artifact-Id"
+)
+
+// WithReleaseTrailers appends the app, env and artifact of the release to the commit message as git trailers
+func WithReleaseTrailers(message string, release *dx.Release) string {
+	if release == nil {
+		return message
+	}
+	message = withTrailer(message, TrailerApp, release.App)
+	message = withTrailer(message, TrailerEnv, release.Env)
+	if release.ArtifactID != "" {
+		message = withTrailer(message, TrailerArtifactID, release.ArtifactID)
+	}
+	return message
+}
+
+var trailerPattern = regexp.MustCompile(`^([A-Za-z0-9-]+): (.*)$`)
+
+// withTrailer adds a trailer to the trailer block of the message, that is its last paragraph
+func withTrailer(message string, key string, value string) string {
+	message = strings.TrimRight(message, "\n")
+	if len(Trailers(message)) > 0 {
+		return fmt.Sprintf("%s\n%s: %s", message, key, value)
+	}
+	return fmt.Sprintf("%s\n\n%s: %s", message, key, value)
+}
+
+// Trailers parses the git trailers of the commit message, empty if its last paragraph is not a trailer block
+func Trailers(message string) map[string]string {
+	trailers := map[string]string{}
+
+	paragraphs := strings.Split(strings.TrimSpace(message), "\n\n")
+	if len(paragraphs) < 2 { // the subject is not a trailer block
+		return trailers
+	}
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		matches := trailerPattern.FindStringSubmatch(line)
+		if matches == nil {
+			return map[string]string{}
+		}
+		trailers[matches[1]] = matches[2]
+	}
+	return trailers
+}
+
+// ReleaseFromTrailers reads the release meta data from the trailers of the commit, nil if it has none
+func ReleaseFromTrailers(c *object.Commit) *dx.Release {
+	trailers := Trailers(c.Message)
+	if trailers[TrailerApp] == "" || trailers[TrailerEnv] == "" {
+		return nil
+	}
+	return &dx.Release{
+		App:        trailers[TrailerApp],
+		Env:        trailers[TrailerEnv],
+		ArtifactID: trailers[TrailerArtifactID],
+		Created:    c.Committer.When.Unix(),
+		GitopsRef:  c.Hash.String(),
+	}
+}
+
 func RollbackCommit(c *object.Commit) bool {
 	return strings.Contains(c.Message, "This reverts commit")
 }
 
+// GimletdCommit tells if GimletD made the commit, and not someone who committed to the gitops repo by hand
+func GimletdCommit(c *object.Commit) bool {
+	return c.Author.Name == authorName && c.Author.Email == authorEmail
+}
+
 func DeleteCommit(c *object.Commit) bool {
 	return strings.Contains(c.Message, "[GimletD delete]")
 }
@@ -605,3 +1092,158 @@ func releaseFromCommit(c *object.Commit, app string, env string) *dx.Release {
 		GitopsRef: c.Hash.String(),
 	}
 }
+
+// ReleaseAt returns the release meta data of the app in the env as of the given gitops commit
+func ReleaseAt(repo *git.Repository, sha string, env string, app string) (*dx.Release, error) {
+	commit, err := repo.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		return nil, err
+	}
+	releaseFile, err := commit.File(filepath.Join(env, app, "release.json"))
+	if err != nil {
+		if release := ReleaseFromTrailers(commit); release != nil && release.Env == env && release.App == app {
+			return release, nil
+		}
+		return nil, err
+	}
+	content, err := releaseFile.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	var release dx.Release
+	err = json.Unmarshal([]byte(content), &release)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse release file of %s: %s", sha, err)
+	}
+	return &release, nil
+}
+
+// RenderedManifests returns the files of the app folders that the given commit touched,
+// read from the tree of the commit. Apps that the commit deleted are not returned
+func RenderedManifests(repo *git.Repository, sha string) ([]*dx.RenderedManifests, error) {
+	commit, err := repo.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		parentTree, err = parent.Tree()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	appDirs := map[string]bool{}
+	for _, change := range changes {
+		for _, path := range []string{change.From.Name, change.To.Name} {
+			parts := strings.Split(path, "/")
+			if parts[0] == dx.ShadowFolder {
+				if len(parts) < 4 {
+					continue
+				}
+				appDirs[strings.Join(parts[:3], "/")] = true
+				continue
+			}
+			if len(parts) < 3 {
+				continue // env level files, like the env's release.json
+			}
+			appDirs[parts[0]+"/"+parts[1]] = true
+		}
+	}
+
+	manifests := []*dx.RenderedManifests{}
+	for appDir := range appDirs {
+		appTree, err := tree.Tree(appDir)
+		if err == object.ErrDirectoryNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		files := map[string]string{}
+		err = appTree.Files().ForEach(func(f *object.File) error {
+			if f.Name == "release.json" {
+				return nil
+			}
+			content, err := f.Contents()
+			if err != nil {
+				return err
+			}
+			files[f.Name] = content
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		shadow := strings.HasPrefix(appDir, dx.ShadowFolder+"/")
+		parts := strings.SplitN(strings.TrimPrefix(appDir, dx.ShadowFolder+"/"), "/", 2)
+		manifests = append(manifests, &dx.RenderedManifests{
+			Env:       parts[0],
+			App:       parts[1],
+			GitopsRef: sha,
+			Files:     files,
+			Shadow:    shadow,
+		})
+	}
+
+	sort.Slice(manifests, func(i, j int) bool {
+		if manifests[i].Env != manifests[j].Env {
+			return manifests[i].Env < manifests[j].Env
+		}
+		return manifests[i].App < manifests[j].App
+	})
+
+	return manifests, nil
+}
+
+// AppFilesAt returns the files of the app folder as of the given gitops commit, without the release meta data.
+// Empty if the app was not deployed in the env at the commit
+func AppFilesAt(repo *git.Repository, sha string, env string, app string) (map[string]string, error) {
+	files := map[string]string{}
+
+	commit, err := repo.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	appTree, err := tree.Tree(filepath.Join(env, app))
+	if err == object.ErrDirectoryNotFound {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = appTree.Files().ForEach(func(f *object.File) error {
+		if f.Name == "release.json" {
+			return nil
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		files[f.Name] = content
+		return nil
+	})
+	return files, err
+}
@@ -3,8 +3,10 @@ package nativeGit
 import (
 	"testing"
 
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -14,7 +16,7 @@ import (
 func Test_Releases(t *testing.T) {
 	repo := initHistory()
 
-	releases, err := Releases(repo, "my-app", "staging", nil, nil, 10, "")
+	releases, err := Releases(repo, "my-app", "staging", nil, nil, 10, "", false)
 	assert.Nil(t, err)
 	assert.Equal(t, 3, len(releases), "should get all releases")
 }
@@ -22,7 +24,7 @@ func Test_Releases(t *testing.T) {
 func Test_ReleasesLimit(t *testing.T) {
 	repo := initHistory()
 
-	releases, err := Releases(repo, "my-app", "staging", nil, nil, 1, "")
+	releases, err := Releases(repo, "my-app", "staging", nil, nil, 1, "", false)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(releases), "should get only one release")
 }
@@ -30,12 +32,45 @@ func Test_ReleasesLimit(t *testing.T) {
 func Test_ReleasesGitRepo(t *testing.T) {
 	repo := initHistory()
 
-	releases, err := Releases(repo, "my-app2", "staging", nil, nil, -1, "laszlocph/gimletd-test2")
+	releases, err := Releases(repo, "my-app2", "staging", nil, nil, -1, "laszlocph/gimletd-test2", false)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(releases), "should get the commit from the gitrepo")
 	assert.Equal(t, "xxx", releases[0].App, "should get the commit from the gitrepo")
 }
 
+func Test_ReleasesLifecycle(t *testing.T) {
+	repo := initHistory()
+	head, _ := repo.Head()
+	deploySHA := head.Hash().String()
+
+	_, err := CommitFilesToGit(repo, map[string]string{"file": `4`}, "staging", "my-app", "Revert\n\nThis reverts commit "+deploySHA+".", "{}")
+	assert.Nil(t, err)
+	err = DelDir(repo, "staging/my-app")
+	assert.Nil(t, err)
+	_, err = Commit(repo, "[GimletD delete] staging/my-app deleted by laszlo")
+	assert.Nil(t, err)
+
+	releases, err := Releases(repo, "my-app", "staging", nil, nil, 10, "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(releases), "should only list deploys by default")
+
+	releases, err = Releases(repo, "my-app", "staging", nil, nil, 10, "", true)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(releases), "should list rollbacks and deletes too")
+	assert.Equal(t, dx.ReleaseTypeDelete, releases[0].Type)
+	assert.Equal(t, "my-app", releases[0].App)
+	assert.Equal(t, "laszlo", releases[0].TriggeredBy)
+	assert.Equal(t, dx.ReleaseTypeRollback, releases[1].Type)
+	assert.Equal(t, deploySHA, releases[1].RevertedRef)
+	assert.Equal(t, "fosdem-2023", releases[1].App, "rollbacks should carry the reverted release")
+	assert.Equal(t, dx.ReleaseTypeDeploy, releases[2].Type)
+	assert.True(t, releases[2].RolledBack)
+
+	releases, err = Releases(repo, "", "staging", nil, nil, 10, "laszlocph/gimletd-test", true)
+	assert.Nil(t, err)
+	assert.Equal(t, dx.ReleaseTypeRollback, releases[0].Type, "deletes can't be attributed to a git repo")
+}
+
 func Test_Status(t *testing.T) {
 	repo := initHistory()
 
@@ -110,3 +145,106 @@ func initHistory() *git.Repository {
 
 	return repo
 }
+
+func Test_RenderedManifests(t *testing.T) {
+	repo, _ := git.Init(memory.NewStorage(), memfs.New())
+
+	CommitFilesToGit(repo, map[string]string{"deployment.yaml": "kind: Deployment"}, "staging", "my-app", "first", `{"app":"my-app"}`)
+	sha, err := CommitFilesToGit(repo, map[string]string{"deployment.yaml": "kind: Deployment\nreplicas: 2", "service.yaml": "kind: Service"}, "staging", "my-app", "second", `{"app":"my-app"}`)
+	assert.Nil(t, err)
+	CommitFilesToGit(repo, map[string]string{"deployment.yaml": "kind: Deployment"}, "staging", "my-app2", "third", `{"app":"my-app2"}`)
+
+	manifests, err := RenderedManifests(repo, sha)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(manifests), "should only return the app touched by the commit")
+	assert.Equal(t, "staging", manifests[0].Env)
+	assert.Equal(t, "my-app", manifests[0].App)
+	assert.Equal(t, sha, manifests[0].GitopsRef)
+	assert.Equal(t, map[string]string{
+		"deployment.yaml": "kind: Deployment\nreplicas: 2\n",
+		"service.yaml":    "kind: Service\n",
+	}, manifests[0].Files, "should return the files as of the commit, without the release meta data")
+
+	_, err = RenderedManifests(repo, "4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+	assert.Equal(t, plumbing.ErrObjectNotFound, err)
+
+	sha, err = CommitFilesToGit(repo, map[string]string{"deployment.yaml": "kind: Deployment"}, ".shadow/production", "my-app", "shadow", `{"app":"my-app"}`)
+	assert.Nil(t, err)
+	manifests, err = RenderedManifests(repo, sha)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(manifests))
+	assert.Equal(t, "production", manifests[0].Env)
+	assert.Equal(t, "my-app", manifests[0].App)
+	assert.True(t, manifests[0].Shadow, "should mark the manifests of shadow deploys")
+	assert.Equal(t, map[string]string{"deployment.yaml": "kind: Deployment\n"}, manifests[0].Files)
+}
+
+func Test_AppFilesAt(t *testing.T) {
+	repo, _ := git.Init(memory.NewStorage(), memfs.New())
+
+	first, err := CommitFilesToGit(repo, map[string]string{"deployment.yaml": "kind: Deployment"}, "staging", "my-app", "first", `{"app":"my-app"}`)
+	assert.Nil(t, err)
+	CommitFilesToGit(repo, map[string]string{"deployment.yaml": "kind: Deployment\nreplicas: 2"}, "staging", "my-app", "second", `{"app":"my-app"}`)
+
+	files, err := AppFilesAt(repo, first, "staging", "my-app")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"deployment.yaml": "kind: Deployment\n"}, files, "should return the files as of the commit, without the release meta data")
+
+	files, err = AppFilesAt(repo, first, "production", "my-app")
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+
+	_, err = AppFilesAt(repo, "4b825dc642cb6eb9a060e54bf8d69288fbee4904", "staging", "my-app")
+	assert.Equal(t, plumbing.ErrObjectNotFound, err)
+}
+
+func Test_releaseTrailers(t *testing.T) {
+	message := WithReleaseTrailers("automated deploy", &dx.Release{App: "my-app", Env: "staging", ArtifactID: "my-app-123"})
+	message = WithCorrelationTrailer(message, "abc")
+	assert.Equal(t, "automated deploy\n\nGimlet-App: my-app\nGimlet-Env: staging\nGimlet-Artifact-Id: my-app-123\nCorrelation-ID: abc", message,
+		"trailers should form a single block")
+	assert.Empty(t, Trailers("Revert\n\nThis reverts commit abc."), "prose is not a trailer block")
+
+	repo, _ := git.Init(memory.NewStorage(), memfs.New())
+	CommitFilesToGit(repo, map[string]string{"deployment.yaml": "kind: Deployment"}, "staging", "my-app2", "first", "")
+	sha, err := CommitFilesToGit(repo, map[string]string{"deployment.yaml": "kind: Deployment"}, "staging", "my-app", message, "")
+	assert.Nil(t, err)
+
+	releases, err := Releases(repo, "my-app", "staging", nil, nil, 10, "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(releases), "should read the release from the trailers without a release file")
+	assert.Equal(t, "my-app-123", releases[0].ArtifactID)
+
+	release, err := ReleaseAt(repo, sha, "staging", "my-app")
+	assert.Nil(t, err)
+	assert.Equal(t, "my-app-123", release.ArtifactID)
+	_, err = ReleaseAt(repo, sha, "staging", "other-app")
+	assert.NotNil(t, err, "trailers only describe the deployed app")
+}
+
+func Test_headBranch(t *testing.T) {
+	hash := plumbing.NewHash("e4943e196e5a8d4704b1ebe38764f6827c57df7c")
+	other := plumbing.NewHash("ec5c0a57c81f09a63320640d2e6feeb9ba655413")
+
+	branch, err := headBranch([]*plumbing.Reference{
+		plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("trunk")),
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("trunk"), hash),
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("master"), hash),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "trunk", branch, "symbolic HEAD should be followed")
+
+	branch, err = headBranch([]*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.HEAD, hash),
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature"), hash),
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("master"), other),
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("main"), hash),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "main", branch, "main should be preferred among the branches at HEAD")
+
+	_, err = headBranch([]*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("main"), hash),
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,92 @@
+package nativeGit
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// PlatformConfig keeps a clone of the platform config repo.
+// It holds the per env override values that are merged over the manifest values at deploy time,
+// so platform teams can change infra-level settings without touching the app repos.
+// The overrides of an env are in <env>/values.yaml
+type PlatformConfig struct {
+	repoName        string
+	deployKeyPath   string
+	defaultBranch   string
+	repo            *git.Repository
+	cachePath       string
+	refreshInterval time.Duration
+	stopCh          chan struct{}
+}
+
+func NewPlatformConfig(
+	cacheRoot string,
+	repoName string,
+	deployKeyPath string,
+	defaultBranch string,
+	refreshInterval time.Duration,
+	stopCh chan struct{},
+) (*PlatformConfig, error) {
+	if defaultBranch == "" {
+		var err error
+		defaultBranch, err = DefaultBranch(repoName, deployKeyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cachePath, repo, err := CloneBranchToTmpFs(cacheRoot, repoName, deployKeyPath, defaultBranch)
+	if err != nil {
+		return nil, fmt.Errorf("cannot clone platform config repo: %s", err)
+	}
+
+	return &PlatformConfig{
+		repoName:        repoName,
+		deployKeyPath:   deployKeyPath,
+		defaultBranch:   defaultBranch,
+		repo:            repo,
+		cachePath:       cachePath,
+		refreshInterval: refreshInterval,
+		stopCh:          stopCh,
+	}, nil
+}
+
+func (p *PlatformConfig) Run() {
+	for {
+		err := Pull(p.repo, p.deployKeyPath, p.defaultBranch)
+		if err != nil {
+			logrus.Errorf("could not fetch platform config: %s", err)
+		}
+
+		select {
+		case <-p.stopCh:
+			logrus.Infof("cleaning up platform config repo at %s", p.cachePath)
+			TmpFsCleanup(p.cachePath)
+			return
+		case <-time.After(withJitter(p.refreshInterval)):
+		}
+	}
+}
+
+// Values returns the override values of the env, nil if the env has none
+func (p *PlatformConfig) Values(env string) (map[string]interface{}, error) {
+	content, err := Content(p.repo, filepath.Join(env, "values.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if content == "" {
+		return nil, nil
+	}
+
+	var values map[string]interface{}
+	err = yaml.Unmarshal([]byte(content), &values)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse platform config values of %s: %s", env, err)
+	}
+	return values, nil
+}
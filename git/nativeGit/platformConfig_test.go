@@ -0,0 +1,30 @@
+package nativeGit
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_platformConfigValues(t *testing.T) {
+	fs := memfs.New()
+	repo, _ := git.Init(memory.NewStorage(), fs)
+	util.WriteFile(fs, "production/values.yaml", []byte("resources:\n  limits:\n    cpu: 1\ningress:\n  ingressClassName: nginx\n"), File_RW_RW_R)
+	util.WriteFile(fs, "broken/values.yaml", []byte("resources: [\n"), File_RW_RW_R)
+	platformConfig := &PlatformConfig{repo: repo}
+
+	values, err := platformConfig.Values("production")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"ingressClassName": "nginx"}, values["ingress"])
+
+	values, err = platformConfig.Values("staging")
+	assert.Nil(t, err)
+	assert.Nil(t, values, "envs without overrides should have no values")
+
+	_, err = platformConfig.Values("broken")
+	assert.NotNil(t, err)
+}
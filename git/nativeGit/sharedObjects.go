@@ -0,0 +1,75 @@
+package nativeGit
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// copyWithSharedObjects copies the repo at src to dst, hardlinking the git objects instead of copying them.
+// Git objects are immutable, new objects of the copy are written to new files, so the copies share the object store of the cache
+// and only the worktree and the refs are copied. Where hardlinks are not supported, eg. across devices, objects are copied
+func copyWithSharedObjects(src string, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case isObjectFile(rel):
+			if err := os.Link(path, target); err == nil {
+				return nil
+			}
+			return copyFile(path, target, info.Mode())
+		default:
+			return copyFile(path, target, info.Mode())
+		}
+	})
+}
+
+// isObjectFile tells if the path is in the object store of the repo, .git/objects,
+// or of one of its submodules, .git/modules/<submodule>/objects
+func isObjectFile(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if parts[0] != ".git" {
+		return false
+	}
+	for i := 1; i < len(parts)-1; i++ {
+		if parts[i] == "objects" && (i == 1 || i >= 3 && parts[i-2] == "modules") {
+			return true
+		}
+	}
+	return false
+}
+
+func copyFile(src string, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package nativeGit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_copyWithSharedObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gimletd-shared-objects")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	parentPath := repoWithSubmodule(t, dir)
+
+	clonePath := filepath.Join(dir, "clone")
+	clone, err := git.PlainClone(clonePath, false, &git.CloneOptions{URL: parentPath})
+	assert.Nil(t, err)
+	err = UpdateSubmodules(clone, nil, true)
+	assert.Nil(t, err)
+
+	copyPath := filepath.Join(dir, "copy")
+	err = copyWithSharedObjects(clonePath, copyPath)
+	assert.Nil(t, err)
+
+	linked, copied := 0, 0
+	filepath.Walk(clonePath, func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(clonePath, path)
+		copyInfo, err := os.Stat(filepath.Join(copyPath, rel))
+		assert.Nil(t, err, rel+" should be copied")
+		if os.SameFile(info, copyInfo) {
+			assert.True(t, isObjectFile(rel), rel+" should not be shared")
+			linked++
+		} else {
+			copied++
+		}
+		return nil
+	})
+	assert.NotZero(t, linked, "objects should be hardlinked")
+	assert.NotZero(t, copied)
+
+	copiedRepo, err := git.PlainOpen(copyPath)
+	assert.Nil(t, err)
+	err = UpdateSubmodules(copiedRepo, nil, false)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(copyPath, "new-file"), []byte("new"), File_RW_RW_R)
+	assert.Nil(t, err)
+	w, err := copiedRepo.Worktree()
+	assert.Nil(t, err)
+	_, err = w.Add("new-file")
+	assert.Nil(t, err)
+	_, err = Commit(copiedRepo, "new file")
+	assert.Nil(t, err)
+
+	cloneHead, _ := clone.Head()
+	copyHead, _ := copiedRepo.Head()
+	assert.NotEqual(t, cloneHead.Hash(), copyHead.Hash(), "commits of the copy should not change the cache")
+	_, err = clone.CommitObject(cloneHead.Hash())
+	assert.Nil(t, err)
+}
+
+func Test_isObjectFile(t *testing.T) {
+	assert.True(t, isObjectFile(".git/objects/pack/pack-1.pack"))
+	assert.True(t, isObjectFile(".git/modules/charts/objects/ab/cdef"))
+	assert.False(t, isObjectFile(".git/refs/heads/objects/feature"))
+	assert.False(t, isObjectFile(".git/HEAD"))
+	assert.False(t, isObjectFile("objects/file"))
+}
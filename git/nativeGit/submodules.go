@@ -0,0 +1,54 @@
+package nativeGit
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+var submodulesDisabled bool
+
+// DisableSubmodules makes clones and pulls of the gitops repo and git hosted charts skip the submodules
+func DisableSubmodules(disabled bool) {
+	submodulesDisabled = disabled
+}
+
+// SubmoduleRecursion is the submodule depth that clones and pulls initialize and update
+func SubmoduleRecursion() git.SubmoduleRescursivity {
+	if submodulesDisabled {
+		return git.NoRecurseSubmodules
+	}
+	return git.DefaultSubmoduleRecursionDepth
+}
+
+// UpdateSubmodules initializes and checks out the submodules at the commits that the repo points to.
+// Without fetch, the objects must be present already, eg. in a copy of a clone that has its submodules
+func UpdateSubmodules(repo *git.Repository, auth transport.AuthMethod, fetch bool) error {
+	if submodulesDisabled {
+		return nil
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("could not get worktree: %s", err)
+	}
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return fmt.Errorf("cannot read submodules: %s", err)
+	}
+	if len(submodules) == 0 {
+		return nil
+	}
+
+	err = submodules.Update(&git.SubmoduleUpdateOptions{
+		Init:              true,
+		NoFetch:           !fetch,
+		RecurseSubmodules: SubmoduleRecursion(),
+		Auth:              auth,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot update submodules: %s", err)
+	}
+	return nil
+}
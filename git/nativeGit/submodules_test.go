@@ -0,0 +1,88 @@
+package nativeGit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_updateSubmodules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gimletd-submodules")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	parentPath := repoWithSubmodule(t, dir)
+
+	clonePath := filepath.Join(dir, "clone")
+	_, err = git.PlainClone(clonePath, false, &git.CloneOptions{URL: parentPath})
+	assert.Nil(t, err)
+	clone, err := git.PlainOpen(clonePath)
+	assert.Nil(t, err)
+
+	DisableSubmodules(true)
+	err = UpdateSubmodules(clone, nil, true)
+	DisableSubmodules(false)
+	assert.Nil(t, err)
+	assert.NoFileExists(t, filepath.Join(clonePath, "charts", "Chart.yaml"), "should skip the submodules when disabled")
+
+	err = UpdateSubmodules(clone, nil, true)
+	assert.Nil(t, err)
+	assert.FileExists(t, filepath.Join(clonePath, "charts", "Chart.yaml"), "should check out the submodule")
+
+	copyPath := filepath.Join(dir, "copy")
+	err = copy.Copy(clonePath, copyPath)
+	assert.Nil(t, err)
+	copiedRepo, err := git.PlainOpen(copyPath)
+	assert.Nil(t, err)
+	err = UpdateSubmodules(copiedRepo, nil, false)
+	assert.Nil(t, err, "should update the submodules of a copy without fetching")
+	assert.FileExists(t, filepath.Join(copyPath, "charts", "Chart.yaml"), "the copy should keep the submodule")
+}
+
+// repoWithSubmodule creates a repo that has another local repo as a submodule in the charts folder
+func repoWithSubmodule(t *testing.T, dir string) string {
+	signature := &object.Signature{Name: "gimletd", Email: "gimletd@gimlet.io", When: time.Now()}
+
+	subPath := filepath.Join(dir, "sub")
+	sub, err := git.PlainInit(subPath, false)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(subPath, "Chart.yaml"), []byte("name: onechart\n"), File_RW_RW_R)
+	assert.Nil(t, err)
+	subWorktree, _ := sub.Worktree()
+	subWorktree.Add("Chart.yaml")
+	subHead, err := subWorktree.Commit("chart", &git.CommitOptions{Author: signature})
+	assert.Nil(t, err)
+
+	parentPath := filepath.Join(dir, "parent")
+	parent, err := git.PlainInit(parentPath, false)
+	assert.Nil(t, err)
+	gitmodules := fmt.Sprintf("[submodule \"charts\"]\n\tpath = charts\n\turl = %s\n", subPath)
+	err = ioutil.WriteFile(filepath.Join(parentPath, ".gitmodules"), []byte(gitmodules), File_RW_RW_R)
+	assert.Nil(t, err)
+	parentWorktree, _ := parent.Worktree()
+	parentWorktree.Add(".gitmodules")
+
+	idx, err := parent.Storer.Index()
+	assert.Nil(t, err)
+	idx.Entries = append(idx.Entries, &index.Entry{
+		Name: "charts",
+		Mode: filemode.Submodule,
+		Hash: plumbing.Hash(subHead),
+	})
+	err = parent.Storer.SetIndex(idx)
+	assert.Nil(t, err)
+	_, err = parentWorktree.Commit("submodule", &git.CommitOptions{Author: signature})
+	assert.Nil(t, err)
+
+	return parentPath
+}
@@ -0,0 +1,164 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/sirupsen/logrus"
+)
+
+const PreCommit = "preCommit"
+const PostPush = "postPush"
+const ArtifactDecision = "artifactDecision"
+
+const signatureHeader = "X-Gimlet-Signature"
+
+const correlationIDHeader = "X-Correlation-ID"
+
+// DeployHooks calls external URLs around gitops writes.
+// Pre-commit hooks can veto a deploy by responding with a non-2xx status,
+// post-push hooks are informational
+type DeployHooks struct {
+	PreCommitURLs map[string]string
+	PostPushURLs  map[string]string
+	Secret        string
+
+	client *http.Client
+}
+
+// Payload is posted to the hook URLs
+type Payload struct {
+	Hook        string      `json:"hook"`
+	Env         string      `json:"env"`
+	App         string      `json:"app"`
+	ArtifactID  string      `json:"artifactId"`
+	TriggeredBy string      `json:"triggeredBy"`
+	Version     *dx.Version `json:"version,omitempty"`
+	GitopsRef   string      `json:"gitopsRef,omitempty"`
+	GitopsRepo  string      `json:"gitopsRepo,omitempty"`
+
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+func NewDeployHooks(preCommitURLs map[string]string, postPushURLs map[string]string, secret string) *DeployHooks {
+	return &DeployHooks{
+		PreCommitURLs: preCommitURLs,
+		PostPushURLs:  postPushURLs,
+		Secret:        secret,
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// PreCommit calls the pre-commit hook of the env, if there is one.
+// It returns an error if the hook vetoed the deploy or could not be called
+func (h *DeployHooks) PreCommit(payload *Payload) error {
+	if h == nil {
+		return nil
+	}
+	url, ok := h.PreCommitURLs[payload.Env]
+	if !ok {
+		return nil
+	}
+
+	payload.Hook = PreCommit
+	return h.post(url, payload)
+}
+
+// PostPush calls the post-push hook of the env, if there is one.
+// Errors are only logged
+func (h *DeployHooks) PostPush(payload *Payload) {
+	if h == nil {
+		return
+	}
+	url, ok := h.PostPushURLs[payload.Env]
+	if !ok {
+		return
+	}
+
+	payload.Hook = PostPush
+	err := h.post(url, payload)
+	if err != nil {
+		logrus.Warnf("post-push hook failed: %s", err)
+	}
+}
+
+func (h *DeployHooks) post(url string, payload *Payload) error {
+	client := h.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	err := post(client, url, h.Secret, payload.CorrelationID, payload)
+	if err != nil {
+		return fmt.Errorf("%s hook %s", payload.Hook, err)
+	}
+	return nil
+}
+
+// ArtifactDecisionPayload is posted to the artifact callback URLs once the deploy decision on an artifact is complete
+type ArtifactDecisionPayload struct {
+	Hook string `json:"hook"`
+	*dx.ArtifactIngestion
+
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+// PostArtifactDecision calls an artifact callback URL with the deploy decision: the triggered envs and their gitops refs
+func PostArtifactDecision(url string, secret string, ingestion *dx.ArtifactIngestion, correlationID string) error {
+	err := post(&http.Client{Timeout: 30 * time.Second}, url, secret, correlationID, &ArtifactDecisionPayload{
+		Hook:              ArtifactDecision,
+		ArtifactIngestion: ingestion,
+		CorrelationID:     correlationID,
+	})
+	if err != nil {
+		return fmt.Errorf("%s hook %s", ArtifactDecision, err)
+	}
+	return nil
+}
+
+// post sends the payload as JSON, signed with the secret if there is one
+func post(client *http.Client, url string, secret string, correlationID string, payload interface{}) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("cannot serialize payload: %s", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(signatureHeader, Signature(secret, payloadBytes))
+	}
+	if correlationID != "" {
+		req.Header.Set(correlationIDHeader, correlationID)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot be called: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("rejected the request with status %d: %s", res.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// Signature returns the HMAC signature of the payload in the sha256=<hex digest> format
+func Signature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,67 @@
+package hooks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_preCommitVeto(t *testing.T) {
+	var signature string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(signatureHeader)
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("no change ticket"))
+	}))
+	defer server.Close()
+
+	h := NewDeployHooks(map[string]string{"production": server.URL}, map[string]string{}, "secret")
+
+	err := h.PreCommit(&Payload{Env: "staging", App: "my-app"})
+	assert.Nil(t, err, "envs without hooks should not be vetoed")
+
+	err = h.PreCommit(&Payload{Env: "production", App: "my-app"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no change ticket")
+	assert.Equal(t, Signature("secret", body), signature)
+
+	var nilHooks *DeployHooks
+	assert.Nil(t, nilHooks.PreCommit(&Payload{Env: "production"}))
+}
+
+func Test_postArtifactDecision(t *testing.T) {
+	var signature, correlationID string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(signatureHeader)
+		correlationID = r.Header.Get(correlationIDHeader)
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	err := PostArtifactDecision(server.URL, "secret", &dx.ArtifactIngestion{
+		Status:        "processed",
+		TriggeredEnvs: []string{"staging"},
+		Envs:          []dx.EnvStatus{{Env: "staging", App: "my-app", Status: dx.EnvStatusSuccess, GitopsRef: "abc123"}},
+	}, "my-correlation-id")
+	assert.Nil(t, err)
+	assert.Equal(t, Signature("secret", body), signature)
+	assert.Equal(t, "my-correlation-id", correlationID)
+
+	var payload map[string]interface{}
+	err = json.Unmarshal(body, &payload)
+	assert.Nil(t, err)
+	assert.Equal(t, ArtifactDecision, payload["hook"])
+	assert.Equal(t, []interface{}{"staging"}, payload["triggeredEnvs"])
+
+	err = PostArtifactDecision(server.URL, "", &dx.ArtifactIngestion{}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "", signature, "unsigned callbacks should not have a signature")
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ArtifactRepoAllowlist holds the source repositories that were allowed to submit artifacts with the admin API, see AllowedRepository
+const ArtifactRepoAllowlist = "artifactRepoAllowlist"
+
+// RegistryWebhookSubmitter is the login that the artifacts of the container registry webhooks are submitted by,
+// allowlist entries bound to it allow the webhook artifacts of their repositories
+const RegistryWebhookSubmitter = "registry-webhook"
+
+// AllowedRepository is a source repository that may submit artifacts.
+// Repository is a name like my-org/my-app, or a path pattern like my-org/team-*
+type AllowedRepository struct {
+	Repository string `json:"repository"`
+	// Users are the logins of the users and API tokens that may submit the artifacts of the repository,
+	// so the token of one project can't impersonate another
+	Users []string `json:"users"`
+
+	CreatedBy string `json:"createdBy,omitempty"`
+	Created   int64  `json:"created,omitempty"`
+}
+
+// Allows tells if the user may submit the artifacts of the repository
+func (a *AllowedRepository) Allows(repository string, login string) bool {
+	if matched, _ := path.Match(a.Repository, repository); !matched {
+		return false
+	}
+	for _, user := range a.Users {
+		if user == login {
+			return true
+		}
+	}
+	return false
+}
+
+// RepoAllowlist are the source repositories that may submit artifacts
+type RepoAllowlist struct {
+	// Configured are the entries of the ARTIFACT_REPO_ALLOWLIST setting, they can't be removed with the API
+	Configured []*AllowedRepository `json:"configured"`
+
+	Repositories []*AllowedRepository `json:"repositories"`
+}
+
+// ParseRepoAllowlist parses the ARTIFACT_REPO_ALLOWLIST setting,
+// a comma separated list of repository:login entries, eg.: my-org/my-app:my-app-ci,my-org/team-*:team-ci
+func ParseRepoAllowlist(allowlist string) ([]*AllowedRepository, error) {
+	allowed := []*AllowedRepository{}
+	byRepository := map[string]*AllowedRepository{}
+	for _, entry := range strings.Split(allowlist, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		separator := strings.LastIndex(entry, ":")
+		if separator <= 0 || separator == len(entry)-1 {
+			return nil, fmt.Errorf("%q is not in the repository:login format", entry)
+		}
+		repository, login := entry[:separator], entry[separator+1:]
+		if _, err := path.Match(repository, ""); err != nil {
+			return nil, fmt.Errorf("%q is not a valid repository pattern", repository)
+		}
+
+		if a, ok := byRepository[repository]; ok {
+			a.Users = append(a.Users, login)
+			continue
+		}
+		a := &AllowedRepository{Repository: repository, Users: []string{login}}
+		byRepository[repository] = a
+		allowed = append(allowed, a)
+	}
+	return allowed, nil
+}
@@ -0,0 +1,17 @@
+package model
+
+// ArtifactCallbacks holds the callback URLs that are notified of deploy decisions, see ArtifactCallback
+const ArtifactCallbacks = "artifactCallbacks"
+
+// ArtifactCallback is a URL that is called when the deploy decision on an artifact of the repository is complete,
+// so CI pipelines can link the deploys on the build page without polling
+type ArtifactCallback struct {
+	ID         string `json:"id"`
+	Repository string `json:"repository"`
+	URL        string `json:"url"`
+	// Secret signs the payload in the X-Gimlet-Signature header, if set
+	Secret string `json:"secret,omitempty"`
+
+	CreatedBy string `json:"createdBy"`
+	Created   int64  `json:"created"`
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cursor is a position in a list of events ordered by their creation, newest second first,
+// and in the order of their creation within the same second.
+// It is on the nanosecond creation time, as many events are created in the same second.
+// API clients get it as an opaque string to fetch the next page with
+type Cursor struct {
+	CreatedNano int64
+	ID          string
+}
+
+func (c *Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d/%s", c.CreatedNano, c.ID)))
+}
+
+// ParseCursor decodes a cursor that was returned by the API
+func ParseCursor(cursor string) (*Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(decoded), "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	createdNano, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &Cursor{CreatedNano: createdNano, ID: parts[1]}, nil
+}
@@ -0,0 +1,27 @@
+package model
+
+// DeployKeyRotations holds the audit log of the gitops deploy key rotations, see DeployKeyRotation
+const DeployKeyRotations = "deployKeyRotations"
+
+// MaxDeployKeyRotations caps the length of the rotation audit log, older entries are dropped
+const MaxDeployKeyRotations = 100
+
+const DeployKeyPending = "pending"
+const DeployKeyActive = "active"
+
+// DeployKeyRotation is an entry of the deploy key rotation audit log.
+// A rotation is pending until the new key is registered on the gitops repo and activated
+type DeployKeyRotation struct {
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"publicKey"`
+	Status      string `json:"status"`
+	RotatedBy   string `json:"rotatedBy"`
+	Created     int64  `json:"created"`
+
+	// Uploaded tells if GimletD registered the public key on the gitops repo through the SCM API
+	Uploaded bool `json:"uploaded,omitempty"`
+	// PreviousFingerprint is the fingerprint of the key that was replaced, set when the rotation is activated
+	PreviousFingerprint string `json:"previousFingerprint,omitempty"`
+	// PreviousKeyRemoved tells if the replaced key was removed from the gitops repo through the SCM API
+	PreviousKeyRemoved bool `json:"previousKeyRemoved,omitempty"`
+}
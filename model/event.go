@@ -7,23 +7,59 @@ import (
 )
 
 const StatusNew = "new"
+const StatusProcessing = "processing"
 const StatusProcessed = "processed"
 const StatusError = "error"
+const StatusParked = "parked"
+
+// StatusPartial is the status of an event that deployed to some of its envs, but failed in others
+const StatusPartial = "partial"
+
+// StatusChecking is the status of an event whose pushed gitops commits wait for the CI checks of the gitops repo
+const StatusChecking = "checking"
+
+// StatusHeld is the status of an auto-deploy event that waits for the failing sync of its env to recover, see dx.EnvSync
+const StatusHeld = "held"
 
 const TypeArtifact = "artifact"
 const TypeRelease = "release"
 const TypeRollback = "rollback"
 const TypeBranchDeleted = "branchDeleted"
+const TypeCompaction = "compaction"
+const TypeAppDelete = "appDelete"
+const TypeReevaluation = "reevaluation"
 
 type Event struct {
 	ID           string   `json:"id,omitempty"  meddler:"id"`
 	Created      int64    `json:"created,omitempty"  meddler:"created"`
 	Type         string   `json:"type,omitempty"  meddler:"type"`
-	Blob         string   `json:"blob,omitempty"  meddler:"blob"`
+	Blob         string   `json:"blob,omitempty"  meddler:"blob,compressed"`
 	Status       string   `json:"status"  meddler:"status"`
 	StatusDesc   string   `json:"statusDesc"  meddler:"status_desc"`
 	GitopsHashes []string `json:"gitopsHashes"  meddler:"gitops_hashes,json"`
 
+	// CreatedNano is the creation time in nanoseconds, strictly increasing, so events of the same second keep their order
+	CreatedNano int64 `json:"-"  meddler:"created_nano"`
+
+	// TriggeredEnvs are the envs the event deployed to
+	TriggeredEnvs []string `json:"triggeredEnvs,omitempty"  meddler:"triggered_envs,json"`
+
+	// EnvStatuses are the outcomes of the deploys of the event, per env
+	EnvStatuses []dx.EnvStatus `json:"envStatuses,omitempty"  meddler:"env_statuses,json"`
+
+	// Logs are the last log lines of the event's processing
+	Logs []string `json:"logs,omitempty"  meddler:"logs,json"`
+
+	// ProcessingStarted is the time when a worker picked up the event
+	ProcessingStarted int64 `json:"processingStarted,omitempty"  meddler:"processing_started"`
+
+	// CorrelationID traces the deploy across systems, it is taken from the X-Correlation-ID header of the API call
+	CorrelationID string `json:"correlationId,omitempty"  meddler:"correlation_id"`
+
+	// Expired is the time the artifact was expired, as its images are gone from the registry, or it passed the max age.
+	// Expired artifacts are not released or rolled back to
+	Expired int64 `json:"expired,omitempty"  meddler:"expired"`
+
 	// denormalized artifact fields
 	Repository   string      `json:"repository,omitempty"  meddler:"repository"`
 	Branch       string      `json:"branch,omitempty"  meddler:"branch"`
@@ -33,6 +69,11 @@ type Event struct {
 	Tag          string      `json:"tag,omitempty"  meddler:"tag"`
 	SHA          string      `json:"sha"  meddler:"sha"`
 	ArtifactID   string      `json:"artifactID"  meddler:"artifact_id"`
+
+	// denormalized artifact source fields, see dx.ArtifactSource
+	SubmittedBy string `json:"submittedBy,omitempty"  meddler:"submitted_by"`
+	UserAgent   string `json:"userAgent,omitempty"  meddler:"user_agent"`
+	CIURL       string `json:"ciUrl,omitempty"  meddler:"ci_url"`
 }
 
 func ToEvent(artifact dx.Artifact) (*Event, error) {
@@ -41,6 +82,11 @@ func ToEvent(artifact dx.Artifact) (*Event, error) {
 		return nil, fmt.Errorf("cannot serialize artifact: %s", err)
 	}
 
+	var source dx.ArtifactSource
+	if artifact.Source != nil {
+		source = *artifact.Source
+	}
+
 	return &Event{
 		Type:         TypeArtifact,
 		Repository:   artifact.Version.RepositoryName,
@@ -52,6 +98,9 @@ func ToEvent(artifact dx.Artifact) (*Event, error) {
 		Blob:         string(artifactStr),
 		SHA:          artifact.Version.SHA,
 		ArtifactID:   artifact.ID,
+		SubmittedBy:  source.SubmittedBy,
+		UserAgent:    source.UserAgent,
+		CIURL:        source.CIURL,
 	}, nil
 }
 
@@ -0,0 +1,21 @@
+package model
+
+// FirehoseCursor holds the ID of the last event change that the firehose sink acknowledged
+const FirehoseCursor = "firehoseCursor"
+
+// EventChange is a state change of an event, recorded in the same transaction as the change itself.
+// The event firehose streams them to external sinks in ID order
+type EventChange struct {
+	ID         int64  `json:"seq"  meddler:"id,pk"`
+	EventID    string `json:"eventId"  meddler:"event_id"`
+	Status     string `json:"status"  meddler:"status"`
+	StatusDesc string `json:"statusDesc,omitempty"  meddler:"status_desc"`
+	Created    int64  `json:"created"  meddler:"created"`
+
+	// denormalized event fields, joined when the changes are read
+	Type          string `json:"type,omitempty"  meddler:"type,zeroisnull"`
+	Repository    string `json:"repository,omitempty"  meddler:"repository,zeroisnull"`
+	SHA           string `json:"sha,omitempty"  meddler:"sha,zeroisnull"`
+	ArtifactID    string `json:"artifactId,omitempty"  meddler:"artifact_id,zeroisnull"`
+	CorrelationID string `json:"correlationId,omitempty"  meddler:"correlation_id,zeroisnull"`
+}
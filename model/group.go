@@ -0,0 +1,7 @@
+package model
+
+// Group is a set of users, synced from the teams of the SCM organization
+type Group struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
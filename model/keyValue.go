@@ -17,6 +17,47 @@ package model
 // ReposWithCleanupPolicy an array of repo names that have a cleanup policy
 const ReposWithCleanupPolicy = "reposWithCleanupPolicy"
 
+// LastRollback is the key prefix of the last rollback time of an app in an env
+const LastRollback = "lastRollback"
+
+// WorkerHeartbeat is the key prefix of the last time a worker reported being alive
+const WorkerHeartbeat = "workerHeartbeat"
+
+// Maintenance holds the maintenance mode state
+const Maintenance = "maintenance"
+
+// Freezes holds the apps that are frozen in an env, see dx.Freeze
+const Freezes = "freezes"
+
+// ImageUpdatePolicies holds the apps that are deployed when new image tags are pushed, see ImageUpdatePolicy
+const ImageUpdatePolicies = "imageUpdatePolicies"
+
+// ReleaseState holds the releases that the release state worker last found in the gitops repo, see dx.ReleaseState
+const ReleaseState = "releaseState"
+
+// GitopsHistoryRewrite holds the last unacknowledged rewrite of the gitops repo history, see dx.GitopsHistoryRewrite
+const GitopsHistoryRewrite = "gitopsHistoryRewrite"
+
+// FailingEnvSyncs holds the envs whose Flux sync is failing, see dx.EnvSync
+const FailingEnvSyncs = "failingEnvSyncs"
+
+// Groups holds the user groups synced from the SCM organization, see Group
+const Groups = "groups"
+
+// ImageUpdatePolicy is an app in an env with an image update policy.
+// ArtifactID is the latest deployed artifact of the app, that is redeployed with the new image tags
+type ImageUpdatePolicy struct {
+	Env        string `json:"env"`
+	App        string `json:"app"`
+	ArtifactID string `json:"artifactId"`
+	// LastTag is the last image tag that was deployed or seen, newer tags are deployed
+	LastTag string `json:"lastTag,omitempty"`
+	// SkippedTag is the newer image tag that is not released yet, SkipReason tells why, eg. a recent rollback of the app.
+	// The tag is released once the reason is gone
+	SkippedTag string `json:"skippedTag,omitempty"`
+	SkipReason string `json:"skipReason,omitempty"`
+}
+
 // KeyValue is a key-value pair for simple storage for things fit in the data model
 type KeyValue struct {
 	// ID for this repo
@@ -0,0 +1,32 @@
+package model
+
+// ReleaseHookTokens holds the scoped tokens of the release webhook, see ReleaseHookToken
+const ReleaseHookTokens = "releaseHookTokens"
+
+// ReleaseHookToken lets external systems, eg. Jenkins jobs or change tickets, trigger releases through the release webhook.
+// Only the SHA256 hash of the token is stored, the token is returned once when it is created
+type ReleaseHookToken struct {
+	Name string `json:"name"`
+	// Envs are the envs the token can release to
+	Envs []string `json:"envs"`
+	// Apps are the apps the token can release, every app if empty
+	Apps []string `json:"apps,omitempty"`
+
+	TokenHash string `json:"tokenHash,omitempty"`
+	CreatedBy string `json:"createdBy"`
+	Created   int64  `json:"created"`
+}
+
+// Allows tells if the token can release the app to the env
+func (t *ReleaseHookToken) Allows(env string, app string) bool {
+	return contains(t.Envs, env) && (len(t.Apps) == 0 || contains(t.Apps, app))
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Kinds of alerts
+const alertRollback = "rollback"
+const alertRollbackFailure = "rollbackFailure"
+const alertDeployFailure = "deployFailure"
+const alertDeploySuccess = "deploySuccess"
+
+const opsgenieAPIURL = "https://api.opsgenie.com"
+
+// alert is an app in an env that needs the attention of the on-call engineer
+type alert struct {
+	Kind    string
+	Env     string
+	App     string
+	Title   string
+	Message string
+	Details map[string]string
+}
+
+func (a *alert) key() string {
+	return fmt.Sprintf("gimletd/%s/%s", a.Env, a.App)
+}
+
+// alerter raises alerts on an alerting system
+type alerter interface {
+	raise(a *alert) error
+}
+
+// AlertingProvider raises alerts on Opsgenie or Grafana OnCall when apps are rolled back, or their deploys fail repeatedly.
+// Alerts of an app in an env are rate limited, so a flapping deploy doesn't page on every failure
+type AlertingProvider struct {
+	Envs             []string
+	FailureThreshold int
+	RateLimit        time.Duration
+
+	alerter     alerter
+	lock        sync.Mutex
+	failures    map[string]int
+	lastAlerted map[string]time.Time
+	now         func() time.Time
+}
+
+// NewOpsgenieProvider raises Opsgenie alerts through the Alert API, apiURL is the regional API, eg. https://api.eu.opsgenie.com
+func NewOpsgenieProvider(apiKey string, apiURL string, envs []string, failureThreshold int, rateLimit time.Duration) *AlertingProvider {
+	if apiURL == "" {
+		apiURL = opsgenieAPIURL
+	}
+	return newAlertingProvider(&opsgenie{
+		apiKey: apiKey,
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+	}, envs, failureThreshold, rateLimit)
+}
+
+// NewGrafanaOnCallProvider raises Grafana OnCall alerts through a formatted webhook integration
+func NewGrafanaOnCallProvider(webhookURL string, envs []string, failureThreshold int, rateLimit time.Duration) *AlertingProvider {
+	return newAlertingProvider(&grafanaOnCall{
+		webhookURL: webhookURL,
+	}, envs, failureThreshold, rateLimit)
+}
+
+func newAlertingProvider(alerter alerter, envs []string, failureThreshold int, rateLimit time.Duration) *AlertingProvider {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &AlertingProvider{
+		Envs:             envs,
+		FailureThreshold: failureThreshold,
+		RateLimit:        rateLimit,
+		alerter:          alerter,
+		failures:         map[string]int{},
+		lastAlerted:      map[string]time.Time{},
+		now:              time.Now,
+	}
+}
+
+func (p *AlertingProvider) send(msg Message) error {
+	if msg.Env() != "" && !p.alerting(msg.Env()) {
+		return nil
+	}
+
+	a, err := msg.AsAlert()
+	if err != nil {
+		return fmt.Errorf("cannot create alert: %s", err)
+	}
+	if a == nil || !p.due(a) {
+		return nil
+	}
+
+	return p.alerter.raise(a)
+}
+
+func (p *AlertingProvider) alerting(env string) bool {
+	if len(p.Envs) == 0 {
+		return true
+	}
+	for _, e := range p.Envs {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// due counts the consecutive deploy failures of the app, and tells if the alert should be raised.
+// Deploy failures alert once they reach the threshold, and every alert of the app is held back within the rate limit
+func (p *AlertingProvider) due(a *alert) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := a.key()
+	switch a.Kind {
+	case alertDeploySuccess:
+		delete(p.failures, key)
+		return false
+	case alertDeployFailure:
+		p.failures[key]++
+		if p.failures[key] < p.FailureThreshold {
+			return false
+		}
+		a.Details["consecutiveFailures"] = fmt.Sprintf("%d", p.failures[key])
+	}
+
+	now := p.now()
+	if last, ok := p.lastAlerted[key]; ok && now.Sub(last) < p.RateLimit {
+		logrus.Debugf("alert of %s is rate limited, last alerted at %s", key, last)
+		return false
+	}
+	p.lastAlerted[key] = now
+	delete(p.failures, key)
+	return true
+}
+
+type opsgenie struct {
+	apiKey string
+	apiURL string
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Entity      string            `json:"entity,omitempty"`
+	Source      string            `json:"source"`
+	Priority    string            `json:"priority"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+func (o *opsgenie) raise(a *alert) error {
+	priority := "P2"
+	if a.Kind == alertRollbackFailure {
+		priority = "P1"
+	}
+
+	message := a.Title
+	if len(message) > 130 { // the limit of the Alert API
+		message = message[:130]
+	}
+
+	return postAlert(o.apiURL+"/v2/alerts", "GenieKey "+o.apiKey, &opsgenieAlert{
+		Message:     message,
+		Alias:       a.key(),
+		Description: a.Message,
+		Entity:      a.App,
+		Source:      "gimletd",
+		Priority:    priority,
+		Tags:        []string{"gimletd", a.Env, a.Kind},
+		Details:     a.Details,
+	})
+}
+
+type grafanaOnCall struct {
+	webhookURL string
+}
+
+type grafanaOnCallAlert struct {
+	AlertUID string `json:"alert_uid"`
+	Title    string `json:"title"`
+	State    string `json:"state"`
+	Message  string `json:"message"`
+}
+
+func (g *grafanaOnCall) raise(a *alert) error {
+	var keys []string
+	for k := range a.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	message := a.Message
+	for _, k := range keys {
+		message += fmt.Sprintf("\n%s: %s", k, a.Details[k])
+	}
+
+	return postAlert(g.webhookURL, "", &grafanaOnCallAlert{
+		AlertUID: a.key(),
+		Title:    a.Title,
+		State:    "alerting",
+		Message:  message,
+	})
+}
+
+func postAlert(url string, authorization string, payload interface{}) error {
+	b := new(bytes.Buffer)
+	err := json.NewEncoder(b).Encode(payload)
+	if err != nil {
+		return fmt.Errorf("cannot encode alert: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequest("POST", url, b)
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	req = req.WithContext(ctx)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not post alert: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("could not post alert, status: %d, response: %s", res.StatusCode, string(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_alertingRepeatedFailures(t *testing.T) {
+	var received []*opsgenieAlert
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a opsgenieAlert
+		json.NewDecoder(r.Body).Decode(&a)
+		received = append(received, &a)
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	opsgenie := NewOpsgenieProvider("api-key", server.URL, []string{"production"}, 3, 30*time.Minute)
+	opsgenie.now = func() time.Time { return now }
+
+	deploy := func(env string, status events.Status) Message {
+		return MessageFromGitOpsEvent(&events.DeployEvent{
+			Manifest:   &dx.Manifest{Env: env, App: "my-app"},
+			Artifact:   &dx.Artifact{Version: dx.Version{RepositoryName: "gimlet-io/my-app"}},
+			Status:     status,
+			StatusDesc: "cannot run helm template",
+		})
+	}
+
+	for i := 0; i < 3; i++ {
+		err := opsgenie.send(deploy("staging", events.Failure))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 0, len(received), "should not alert for other envs")
+
+	opsgenie.send(deploy("production", events.Failure))
+	opsgenie.send(deploy("production", events.Failure))
+	opsgenie.send(deploy("production", events.Success))
+	opsgenie.send(deploy("production", events.Failure))
+	opsgenie.send(deploy("production", events.Failure))
+	assert.Equal(t, 0, len(received), "a successful deploy should reset the failure count")
+
+	err := opsgenie.send(deploy("production", events.Failure))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, "GenieKey api-key", authorization)
+	assert.Equal(t, "gimletd/production/my-app", received[0].Alias)
+	assert.Equal(t, "P2", received[0].Priority)
+	assert.Equal(t, "3", received[0].Details["consecutiveFailures"])
+
+	for i := 0; i < 3; i++ {
+		opsgenie.send(deploy("production", events.Failure))
+	}
+	assert.Equal(t, 1, len(received), "flapping deploys should be rate limited")
+
+	now = now.Add(31 * time.Minute)
+	for i := 0; i < 3; i++ {
+		opsgenie.send(deploy("production", events.Failure))
+	}
+	assert.Equal(t, 2, len(received), "should alert again after the rate limit")
+}
+
+func Test_alertingRollbacks(t *testing.T) {
+	var received []*grafanaOnCallAlert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a grafanaOnCallAlert
+		json.NewDecoder(r.Body).Decode(&a)
+		received = append(received, &a)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	onCall := NewGrafanaOnCallProvider(server.URL, nil, 3, 30*time.Minute)
+	onCall.now = func() time.Time { return now }
+
+	rollback := func(status events.Status) Message {
+		return MessageFromRollbackEvent(&events.RollbackEvent{
+			RollbackRequest: &dx.RollbackRequest{Env: "production", App: "my-app", TargetSHA: "abc123", TriggeredBy: "laszlo"},
+			Status:          status,
+		})
+	}
+
+	err := onCall.send(rollback(events.Success))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(received), "rollbacks should alert right away")
+	assert.Equal(t, "gimletd/production/my-app", received[0].AlertUID)
+	assert.Equal(t, "alerting", received[0].State)
+	assert.Contains(t, received[0].Message, "triggeredBy: laszlo")
+
+	err = onCall.send(rollback(events.Failure))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(received), "should be rate limited")
+
+	now = now.Add(time.Hour)
+	err = onCall.send(rollback(events.Failure))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(received))
+	assert.Equal(t, "Failed to roll back my-app in production", received[1].Title)
+}
@@ -0,0 +1,262 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of release annotations
+const annotationDeploy = "deploy"
+const annotationRollback = "rollback"
+
+const statuspageAPIURL = "https://api.statuspage.io"
+
+// releaseAnnotation is a release of an app in an env, that is recorded for change management
+type releaseAnnotation struct {
+	Kind        string
+	Env         string
+	App         string
+	Title       string
+	Description string
+	Labels      []string
+}
+
+func (a *releaseAnnotation) key() string {
+	return fmt.Sprintf("%s/%s", a.Env, a.App)
+}
+
+// annotator records release annotations on a change management system
+type annotator interface {
+	annotate(a *releaseAnnotation) error
+}
+
+// ChangeManagementProvider records the deploys and rollbacks of the production envs as Jira issues or Statuspage component updates,
+// for orgs with change management requirements. The description of the annotation can be overridden by message templates
+type ChangeManagementProvider struct {
+	Envs []string
+	// Templates replace the default description of their event type, deploy or rollback
+	Templates Templates
+
+	annotator annotator
+}
+
+// NewJiraProvider creates an issue for each deploy, and comments the rollbacks on the issue of the app's last deploy.
+// url is the Jira site, eg. https://example.atlassian.net
+func NewJiraProvider(url string, user string, apiToken string, project string, issueType string, envs []string, templates Templates) *ChangeManagementProvider {
+	if issueType == "" {
+		issueType = "Task"
+	}
+	return &ChangeManagementProvider{
+		Envs:      envs,
+		Templates: templates,
+		annotator: &jira{
+			url:       strings.TrimSuffix(url, "/"),
+			user:      user,
+			apiToken:  apiToken,
+			project:   project,
+			issueType: issueType,
+			issues:    map[string]string{},
+		},
+	}
+}
+
+// NewStatuspageProvider updates the Statuspage component of the app on its deploys and rollbacks.
+// components maps the apps to their component IDs, apps without a component are not annotated
+func NewStatuspageProvider(apiKey string, pageID string, components map[string]string, envs []string, templates Templates) *ChangeManagementProvider {
+	return &ChangeManagementProvider{
+		Envs:      envs,
+		Templates: templates,
+		annotator: &statuspage{
+			apiKey:     apiKey,
+			apiURL:     statuspageAPIURL,
+			pageID:     pageID,
+			components: components,
+		},
+	}
+}
+
+func (p *ChangeManagementProvider) send(msg Message) error {
+	if !p.annotated(msg.Env()) {
+		return nil
+	}
+
+	a, err := msg.AsReleaseAnnotation()
+	if err != nil {
+		return fmt.Errorf("cannot create release annotation: %s", err)
+	}
+	if a == nil {
+		return nil
+	}
+
+	description, rendered, err := p.Templates.render(msg, a.Description)
+	if err != nil {
+		return err
+	}
+	if rendered {
+		a.Description = description
+	}
+
+	return p.annotator.annotate(a)
+}
+
+func (p *ChangeManagementProvider) annotated(env string) bool {
+	for _, e := range p.Envs {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+type jira struct {
+	url       string
+	user      string
+	apiToken  string
+	project   string
+	issueType string
+
+	lock sync.Mutex
+	// issues are the keys of the issues of the last deploys by env and app
+	issues map[string]string
+}
+
+type jiraIssue struct {
+	Fields jiraFields `json:"fields"`
+}
+
+type jiraFields struct {
+	Project     jiraKey  `json:"project"`
+	IssueType   jiraName `json:"issuetype"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+}
+
+type jiraKey struct {
+	Key string `json:"key"`
+}
+
+type jiraName struct {
+	Name string `json:"name"`
+}
+
+type jiraComment struct {
+	Body string `json:"body"`
+}
+
+func (j *jira) annotate(a *releaseAnnotation) error {
+	j.lock.Lock()
+	issueKey, ok := j.issues[a.key()]
+	j.lock.Unlock()
+
+	if a.Kind == annotationRollback && ok {
+		return postAnnotation("POST", j.url+"/rest/api/2/issue/"+issueKey+"/comment", j.authorization(), &jiraComment{
+			Body: a.Title + "\n\n" + a.Description,
+		}, nil)
+	}
+
+	var created jiraKey
+	err := postAnnotation("POST", j.url+"/rest/api/2/issue", j.authorization(), &jiraIssue{
+		Fields: jiraFields{
+			Project:     jiraKey{Key: j.project},
+			IssueType:   jiraName{Name: j.issueType},
+			Summary:     a.Title,
+			Description: a.Description,
+			Labels:      a.Labels,
+		},
+	}, &created)
+	if err != nil {
+		return err
+	}
+
+	if a.Kind == annotationDeploy {
+		j.lock.Lock()
+		j.issues[a.key()] = created.Key
+		j.lock.Unlock()
+	}
+	return nil
+}
+
+func (j *jira) authorization() string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(j.user+":"+j.apiToken))
+}
+
+type statuspage struct {
+	apiKey     string
+	apiURL     string
+	pageID     string
+	components map[string]string
+}
+
+type statuspageComponentUpdate struct {
+	Component statuspageComponent `json:"component"`
+}
+
+type statuspageComponent struct {
+	Status      string `json:"status"`
+	Description string `json:"description"`
+}
+
+func (s *statuspage) annotate(a *releaseAnnotation) error {
+	componentID, ok := s.components[a.App]
+	if !ok {
+		return nil
+	}
+
+	// a rollback degrades the component until the next deploy
+	status := "operational"
+	if a.Kind == annotationRollback {
+		status = "degraded_performance"
+	}
+
+	url := fmt.Sprintf("%s/v1/pages/%s/components/%s", s.apiURL, s.pageID, componentID)
+	return postAnnotation("PATCH", url, "OAuth "+s.apiKey, &statuspageComponentUpdate{
+		Component: statuspageComponent{
+			Status:      status,
+			Description: a.Title,
+		},
+	}, nil)
+}
+
+// postAnnotation sends the payload to the change management API, and decodes the response into result if it is not nil
+func postAnnotation(method string, url string, authorization string, payload interface{}, result interface{}) error {
+	b := new(bytes.Buffer)
+	err := json.NewEncoder(b).Encode(payload)
+	if err != nil {
+		return fmt.Errorf("cannot encode release annotation: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequest(method, url, b)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authorization)
+	req = req.WithContext(ctx)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not post release annotation: %s", err)
+	}
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("could not post release annotation, status: %d, response: %s", res.StatusCode, string(body))
+	}
+	if result != nil {
+		err = json.Unmarshal(body, result)
+		if err != nil {
+			return fmt.Errorf("cannot parse release annotation response: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_jiraReleaseAnnotations(t *testing.T) {
+	var issues []*jiraIssue
+	var comments []*jiraComment
+	var commentedIssue string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, _ := r.BasicAuth()
+		assert.Equal(t, "bot@example.com", user)
+		assert.Equal(t, "api-token", token)
+		if r.URL.Path == "/rest/api/2/issue" {
+			var issue jiraIssue
+			json.NewDecoder(r.Body).Decode(&issue)
+			issues = append(issues, &issue)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":"10001","key":"CHG-1"}`))
+			return
+		}
+		var comment jiraComment
+		json.NewDecoder(r.Body).Decode(&comment)
+		comments = append(comments, &comment)
+		commentedIssue = r.URL.Path
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	templates, err := ParseTemplates(`{deploy: "{{ .Event.Manifest.App }} {{ .Event.Artifact.Version.SHA }} is live in {{ .Env }}"}`)
+	assert.Nil(t, err)
+	jira := NewJiraProvider(server.URL, "bot@example.com", "api-token", "CHG", "", []string{"production"}, templates)
+
+	deploy := func(env string, status events.Status) Message {
+		return MessageFromGitOpsEvent(&events.DeployEvent{
+			Manifest:  &dx.Manifest{Env: env, App: "my-app"},
+			Artifact:  &dx.Artifact{Version: dx.Version{RepositoryName: "gimlet-io/my-app", SHA: "abc123"}},
+			Status:    status,
+			GitopsRef: "def456",
+		})
+	}
+
+	assert.Nil(t, jira.send(deploy("staging", events.Success)))
+	assert.Nil(t, jira.send(deploy("production", events.Failure)))
+	assert.Equal(t, 0, len(issues), "should only record the successful deploys of the recorded envs")
+
+	assert.Nil(t, jira.send(deploy("production", events.Success)))
+	assert.Equal(t, 1, len(issues))
+	assert.Equal(t, "CHG", issues[0].Fields.Project.Key)
+	assert.Equal(t, "Task", issues[0].Fields.IssueType.Name)
+	assert.Equal(t, "Deployed my-app to production", issues[0].Fields.Summary)
+	assert.Equal(t, "my-app abc123 is live in production", issues[0].Fields.Description, "should render the template")
+
+	err = jira.send(MessageFromRollbackEvent(&events.RollbackEvent{
+		RollbackRequest: &dx.RollbackRequest{Env: "production", App: "my-app", TargetSHA: "abc000", TriggeredBy: "laszlo"},
+		Status:          events.Success,
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(issues), "should comment the rollback on the issue of the last deploy")
+	assert.Equal(t, 1, len(comments))
+	assert.Equal(t, "/rest/api/2/issue/CHG-1/comment", commentedIssue)
+}
+
+func Test_statuspageReleaseAnnotations(t *testing.T) {
+	var updates []*statuspageComponentUpdate
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PATCH", r.Method)
+		assert.Equal(t, "OAuth api-key", r.Header.Get("Authorization"))
+		var update statuspageComponentUpdate
+		json.NewDecoder(r.Body).Decode(&update)
+		updates = append(updates, &update)
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	provider := NewStatuspageProvider("api-key", "page-1", map[string]string{"my-app": "component-1"}, []string{"production"}, Templates{})
+	provider.annotator.(*statuspage).apiURL = server.URL
+
+	rollback := MessageFromRollbackEvent(&events.RollbackEvent{
+		RollbackRequest: &dx.RollbackRequest{Env: "production", App: "my-app", TargetSHA: "abc000", TriggeredBy: "laszlo"},
+		Status:          events.Success,
+	})
+	assert.Nil(t, provider.send(rollback))
+	assert.Equal(t, 1, len(updates))
+	assert.Equal(t, "/v1/pages/page-1/components/component-1", paths[0])
+	assert.Equal(t, "degraded_performance", updates[0].Component.Status)
+
+	otherApp := MessageFromGitOpsEvent(&events.DeployEvent{
+		Manifest: &dx.Manifest{Env: "production", App: "other-app"},
+		Artifact: &dx.Artifact{},
+		Status:   events.Success,
+	})
+	assert.Nil(t, provider.send(otherApp))
+	assert.Equal(t, 1, len(updates), "apps without a component should not be recorded")
+}
@@ -0,0 +1,74 @@
+package notifications
+
+import (
+	"github.com/gimlet-io/gimletd/worker/events"
+	githubLib "github.com/google/go-github/v37/github"
+)
+
+// deployPreviewMessage comments the manifest changes of a pull request on the pull request, before it is merged
+type deployPreviewMessage struct {
+	event *events.DeployPreviewEvent
+}
+
+func MessageFromDeployPreviewEvent(event *events.DeployPreviewEvent) Message {
+	return &deployPreviewMessage{
+		event: event,
+	}
+}
+
+func (pm *deployPreviewMessage) AsSlackMessage() (*slackMessage, error) {
+	return nil, nil
+}
+
+func (pm *deployPreviewMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
+	return nil, nil
+}
+
+func (pm *deployPreviewMessage) AsPullRequestComment() (*pullRequestComment, error) {
+	return &pullRequestComment{
+		env:          pm.event.Manifest.Env,
+		app:          pm.event.Manifest.App,
+		namespace:    pm.event.Manifest.Namespace,
+		sourceBranch: pm.event.Artifact.Version.SourceBranch,
+		failed:       pm.event.Status == events.Failure,
+		statusDesc:   pm.event.StatusDesc,
+		diff:         pm.event.Diff,
+		preview:      true,
+	}, nil
+}
+
+func (pm *deployPreviewMessage) AsPagerDutyEvent() (*pagerDutyEvent, error) {
+	return nil, nil
+}
+
+func (pm *deployPreviewMessage) AsAlert() (*alert, error) {
+	return nil, nil
+}
+
+func (pm *deployPreviewMessage) AsReleaseAnnotation() (*releaseAnnotation, error) {
+	return nil, nil
+}
+
+func (pm *deployPreviewMessage) Env() string {
+	return pm.event.Manifest.Env
+}
+
+func (pm *deployPreviewMessage) App() string {
+	return pm.event.Manifest.App
+}
+
+func (pm *deployPreviewMessage) EventType() string {
+	return EventDeploy
+}
+
+func (pm *deployPreviewMessage) RepositoryName() string {
+	return pm.event.Artifact.Version.RepositoryName
+}
+
+func (pm *deployPreviewMessage) SHA() string {
+	return pm.event.Artifact.Version.SHA
+}
+
+func (pm *deployPreviewMessage) Event() interface{} {
+	return pm.event
+}
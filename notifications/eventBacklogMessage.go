@@ -0,0 +1,122 @@
+package notifications
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	githubLib "github.com/google/go-github/v37/github"
+)
+
+// eventBacklogMessage tells that the unprocessed events piled up, or that the backlog drained
+type eventBacklogMessage struct {
+	stuck  bool
+	size   int
+	oldest time.Time
+}
+
+func (em *eventBacklogMessage) AsSlackMessage() (*slackMessage, error) {
+	msg := &slackMessage{
+		Text:   "",
+		Blocks: []Block{},
+	}
+
+	if em.stuck {
+		msg.Text = fmt.Sprintf(":rotating_light: %d events are waiting to be processed, the oldest since %s. Is the GimletD gitops worker running?", em.size, em.oldest.Format(time.RFC3339))
+	} else {
+		msg.Text = ":white_check_mark: The GimletD event backlog is processed again"
+	}
+	msg.Blocks = append(msg.Blocks,
+		Block{
+			Type: section,
+			Text: &Text{
+				Type: markdown,
+				Text: msg.Text,
+			},
+		},
+	)
+
+	return msg, nil
+}
+
+// Env is empty, the message concerns every env
+func (em *eventBacklogMessage) Env() string {
+	return ""
+}
+
+func (em *eventBacklogMessage) App() string {
+	return ""
+}
+
+func (em *eventBacklogMessage) EventType() string {
+	if em.stuck {
+		return EventFailure
+	}
+	return EventGitops
+}
+
+func (em *eventBacklogMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
+	return nil, nil
+}
+
+func (em *eventBacklogMessage) AsPullRequestComment() (*pullRequestComment, error) {
+	return nil, nil
+}
+
+func (em *eventBacklogMessage) AsPagerDutyEvent() (*pagerDutyEvent, error) {
+	dedupKey := "gimletd/event-backlog"
+	if !em.stuck {
+		return &pagerDutyEvent{
+			EventAction: pagerDutyResolve,
+			DedupKey:    dedupKey,
+		}, nil
+	}
+
+	return &pagerDutyEvent{
+		EventAction: pagerDutyTrigger,
+		DedupKey:    dedupKey,
+		Payload: &pagerDutyPayload{
+			Summary:   fmt.Sprintf("%d events are waiting to be processed in GimletD, the oldest since %s", em.size, em.oldest.Format(time.RFC3339)),
+			Source:    "gimletd",
+			Severity:  "critical",
+			Component: "gitops-worker",
+			CustomDetails: map[string]string{
+				"backlog": strconv.Itoa(em.size),
+				"oldest":  em.oldest.Format(time.RFC3339),
+			},
+		},
+	}, nil
+}
+
+func (em *eventBacklogMessage) AsAlert() (*alert, error) {
+	return nil, nil
+}
+
+func (em *eventBacklogMessage) AsReleaseAnnotation() (*releaseAnnotation, error) {
+	return nil, nil
+}
+
+func (em *eventBacklogMessage) RepositoryName() string {
+	return ""
+}
+
+func (em *eventBacklogMessage) SHA() string {
+	return ""
+}
+
+// NewEventBacklogMessage is sent when the unprocessed events pile up, as the gitops worker silently stopped, and when they are processed again
+func NewEventBacklogMessage(stuck bool, size int, oldest time.Time) Message {
+	return &eventBacklogMessage{
+		stuck:  stuck,
+		size:   size,
+		oldest: oldest,
+	}
+}
+
+func (em *eventBacklogMessage) Event() interface{} {
+	return map[string]interface{}{
+		"Stuck":   em.stuck,
+		"Backlog": em.size,
+		"Oldest":  em.oldest.Format(time.RFC3339),
+	}
+}
@@ -82,10 +82,38 @@ func (fm *fluxMessage) Env() string {
 	return fm.env
 }
 
+func (fm *fluxMessage) App() string {
+	return ""
+}
+
+func (fm *fluxMessage) EventType() string {
+	switch fm.gitopsCommit.Status {
+	case model.ValidationFailed, model.ReconciliationFailed, model.HealthCheckFailed:
+		return EventFailure
+	}
+	return EventGitops
+}
+
 func (fm *fluxMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
 	return nil, nil
 }
 
+func (fm *fluxMessage) AsPullRequestComment() (*pullRequestComment, error) {
+	return nil, nil
+}
+
+func (fm *fluxMessage) AsPagerDutyEvent() (*pagerDutyEvent, error) {
+	return nil, nil
+}
+
+func (fm *fluxMessage) AsAlert() (*alert, error) {
+	return nil, nil
+}
+
+func (fm *fluxMessage) AsReleaseAnnotation() (*releaseAnnotation, error) {
+	return nil, nil
+}
+
 func NewMessage(gitopsRepo string, gitopsCommit *model.GitopsCommit, env string) Message {
 	return &fluxMessage{
 		gitopsCommit: gitopsCommit,
@@ -101,3 +129,7 @@ func (fm *fluxMessage) RepositoryName() string {
 func (fm *fluxMessage) SHA() string {
 	return ""
 }
+
+func (fm *fluxMessage) Event() interface{} {
+	return fm.gitopsCommit
+}
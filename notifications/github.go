@@ -3,6 +3,7 @@ package notifications
 import (
 	"context"
 	"fmt"
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/git/customScm"
 	githubLib "github.com/google/go-github/v37/github"
 	"golang.org/x/oauth2"
@@ -12,11 +13,13 @@ import (
 
 type github struct {
 	tokenManager customScm.NonImpersonatedTokenManager
+	envs         map[string]*dx.Env
 }
 
-func NewGithubProvider(tokenManager customScm.NonImpersonatedTokenManager) *github {
+func NewGithubProvider(tokenManager customScm.NonImpersonatedTokenManager, envs map[string]*dx.Env) *github {
 	return &github{
 		tokenManager: tokenManager,
+		envs:         envs,
 	}
 }
 
@@ -25,8 +28,14 @@ func (g *github) send(msg Message) error {
 	if err != nil {
 		return fmt.Errorf("cannot create github status message: %s", err)
 	}
+	comment, err := msg.AsPullRequestComment()
+	if err != nil {
+		return fmt.Errorf("cannot create pull request comment: %s", err)
+	}
+	commentConfig := g.pullRequestCommentConfig(msg.Env())
+	commenting := comment != nil && (commentConfig != nil || comment.preview) // previews are enabled on the env by the worker
 
-	if status == nil {
+	if status == nil && !commenting {
 		return nil
 	}
 
@@ -40,20 +49,45 @@ func (g *github) send(msg Message) error {
 
 	sha := msg.SHA()
 
-	return g.post(owner, repo, sha, status)
+	if status != nil {
+		err = g.post(owner, repo, sha, status)
+		if err != nil {
+			return err
+		}
+	}
+	if commenting {
+		return g.comment(owner, repo, sha, comment, commentConfig)
+	}
+	return nil
+}
+
+// pullRequestCommentConfig returns the pull request comment setting of an env, nil if the env doesn't comment
+func (g *github) pullRequestCommentConfig(env string) *dx.PullRequestComment {
+	if e, ok := g.envs[env]; ok {
+		return e.PullRequestComment
+	}
+	return nil
+}
+
+// client returns a GitHub client with access to the repositories of the owner
+func (g *github) client(ctx context.Context, owner string) (*githubLib.Client, error) {
+	token, _, err := g.tokenManager.TokenFor(owner)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get scm token: %s", err)
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	tc := oauth2.NewClient(ctx, ts)
+	return githubLib.NewClient(tc), nil
 }
 
 func (g *github) post(owner string, repo string, sha string, status *githubLib.RepoStatus) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	token, _, err := g.tokenManager.Token()
+	client, err := g.client(ctx, owner)
 	if err != nil {
-		return fmt.Errorf("couldn't get scm token: %s", err)
+		return err
 	}
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tc := oauth2.NewClient(ctx, ts)
-	client := githubLib.NewClient(tc)
 
 	opts := &githubLib.ListOptions{PerPage: 50}
 	statuses, _, err := client.Repositories.ListStatuses(ctx, owner, repo, sha, opts)
@@ -72,6 +106,63 @@ func (g *github) post(owner string, repo string, sha string, status *githubLib.R
 	return nil
 }
 
+// comment creates the deploy summary comment on the pull request of the sha,
+// or updates it if the app was already deployed from the pull request
+func (g *github) comment(owner string, repo string, sha string, comment *pullRequestComment, config *dx.PullRequestComment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	client, err := g.client(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	pullRequests, _, err := client.PullRequests.ListPullRequestsWithCommit(ctx, owner, repo, sha, nil)
+	if err != nil {
+		return fmt.Errorf("could not list pull requests of commit: %v", err)
+	}
+	number := pullRequestNumber(pullRequests, comment.sourceBranch)
+	if number == 0 {
+		return nil
+	}
+
+	body := comment.body(config)
+	opts := &githubLib.IssueListCommentsOptions{ListOptions: githubLib.ListOptions{PerPage: 100}}
+	comments, _, err := client.Issues.ListComments(ctx, owner, repo, number, opts)
+	if err != nil {
+		return fmt.Errorf("could not list pull request comments: %v", err)
+	}
+	for _, c := range comments {
+		if strings.HasPrefix(c.GetBody(), comment.marker()) {
+			if c.GetBody() == body {
+				return nil
+			}
+			_, _, err = client.Issues.EditComment(ctx, owner, repo, c.GetID(), &githubLib.IssueComment{Body: &body})
+			if err != nil {
+				return fmt.Errorf("could not edit pull request comment: %v", err)
+			}
+			return nil
+		}
+	}
+
+	_, _, err = client.Issues.CreateComment(ctx, owner, repo, number, &githubLib.IssueComment{Body: &body})
+	if err != nil {
+		return fmt.Errorf("could not create pull request comment: %v", err)
+	}
+
+	return nil
+}
+
+// pullRequestNumber picks the open pull request of the source branch, 0 if there is none
+func pullRequestNumber(pullRequests []*githubLib.PullRequest, sourceBranch string) int {
+	for _, pr := range pullRequests {
+		if pr.GetState() == "open" && pr.GetHead().GetRef() == sourceBranch {
+			return pr.GetNumber()
+		}
+	}
+	return 0
+}
+
 func statusExists(statuses []*githubLib.RepoStatus, status *githubLib.RepoStatus) bool {
 	for _, s := range statuses {
 		if *s.Context == *status.Context {
@@ -0,0 +1,157 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	githubLib "github.com/google/go-github/v37/github"
+)
+
+const checksContextFormat = "gitops-checks/%s@%s"
+
+// gitopsChecksMessage tells the outcome of the CI checks of the gitops repo on a pushed deploy
+type gitopsChecksMessage struct {
+	gitopsRepo string
+	repository string
+	sha        string
+	envStatus  dx.EnvStatus
+}
+
+func (gm *gitopsChecksMessage) failed() bool {
+	return gm.envStatus.Status == dx.EnvStatusFailure
+}
+
+func (gm *gitopsChecksMessage) AsSlackMessage() (*slackMessage, error) {
+	msg := &slackMessage{
+		Text:   "",
+		Blocks: []Block{},
+	}
+
+	if gm.failed() {
+		msg.Text = fmt.Sprintf("The gitops checks failed on the rollout of %s of %s", gm.envStatus.App, gm.repository)
+	} else {
+		msg.Text = fmt.Sprintf("The gitops checks passed on the rollout of %s of %s", gm.envStatus.App, gm.repository)
+	}
+	msg.Blocks = append(msg.Blocks,
+		Block{
+			Type: section,
+			Text: &Text{
+				Type: markdown,
+				Text: msg.Text,
+			},
+		},
+	)
+
+	if gm.failed() {
+		msg.Blocks = append(msg.Blocks,
+			Block{
+				Type: contextString,
+				Elements: []Text{
+					{
+						Type: markdown,
+						Text: fmt.Sprintf(":exclamation: *Error* :exclamation: \n%s", gm.envStatus.StatusDesc),
+					},
+				},
+			},
+		)
+	}
+	msg.Blocks = append(msg.Blocks,
+		Block{
+			Type: contextString,
+			Elements: []Text{
+				{Type: markdown, Text: fmt.Sprintf(":dart: %s", strings.Title(gm.envStatus.Env))},
+				{Type: markdown, Text: fmt.Sprintf(":paperclip: %s", commitLink(gm.gitopsRepo, gm.envStatus.GitopsRef))},
+			},
+		},
+	)
+
+	return msg, nil
+}
+
+func (gm *gitopsChecksMessage) Env() string {
+	return gm.envStatus.Env
+}
+
+func (gm *gitopsChecksMessage) App() string {
+	return gm.envStatus.App
+}
+
+func (gm *gitopsChecksMessage) EventType() string {
+	if gm.failed() {
+		return EventFailure
+	}
+	return EventGitops
+}
+
+func (gm *gitopsChecksMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
+	if gm.repository == "" {
+		return nil, nil
+	}
+	context := fmt.Sprintf(checksContextFormat, gm.envStatus.Env, time.Now().Format(time.RFC3339))
+	desc := gm.envStatus.StatusDesc
+	if len(desc) > 140 {
+		desc = desc[:140]
+	}
+
+	state := "success"
+	if gm.failed() {
+		state = "failure"
+	}
+	targetURL := commitURL(gm.gitopsRepo, gm.envStatus.GitopsRef)
+
+	return &githubLib.RepoStatus{
+		State:       &state,
+		Context:     &context,
+		Description: &desc,
+		TargetURL:   &targetURL,
+	}, nil
+}
+
+func (gm *gitopsChecksMessage) AsPullRequestComment() (*pullRequestComment, error) {
+	return nil, nil
+}
+
+func (gm *gitopsChecksMessage) AsPagerDutyEvent() (*pagerDutyEvent, error) {
+	return nil, nil
+}
+
+func (gm *gitopsChecksMessage) AsAlert() (*alert, error) {
+	return nil, nil
+}
+
+func (gm *gitopsChecksMessage) AsReleaseAnnotation() (*releaseAnnotation, error) {
+	return nil, nil
+}
+
+func (gm *gitopsChecksMessage) RepositoryName() string {
+	return gm.repository
+}
+
+func (gm *gitopsChecksMessage) SHA() string {
+	return gm.sha
+}
+
+func (gm *gitopsChecksMessage) Event() interface{} {
+	return map[string]interface{}{
+		"GitopsRepo": gm.gitopsRepo,
+		"Repository": gm.repository,
+		"SHA":        gm.sha,
+		"Env":        gm.envStatus.Env,
+		"App":        gm.envStatus.App,
+		"GitopsRef":  gm.envStatus.GitopsRef,
+		"Failed":     gm.failed(),
+		"StatusDesc": gm.envStatus.StatusDesc,
+	}
+}
+
+// NewGitopsChecksMessage is sent when the CI checks of the gitops repo passed or failed on a pushed deploy
+func NewGitopsChecksMessage(gitopsRepo string, repository string, sha string, envStatus dx.EnvStatus) Message {
+	return &gitopsChecksMessage{
+		gitopsRepo: gitopsRepo,
+		repository: repository,
+		sha:        sha,
+		envStatus:  envStatus,
+	}
+}
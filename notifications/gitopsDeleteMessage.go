@@ -69,10 +69,37 @@ func (gm *gitopsDeleteMessage) Env() string {
 	return gm.event.Env
 }
 
+func (gm *gitopsDeleteMessage) App() string {
+	return gm.event.App
+}
+
+func (gm *gitopsDeleteMessage) EventType() string {
+	if gm.event.Status == events.Failure {
+		return EventFailure
+	}
+	return EventCleanup
+}
+
 func (gm *gitopsDeleteMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
 	return nil, nil
 }
 
+func (gm *gitopsDeleteMessage) AsPullRequestComment() (*pullRequestComment, error) {
+	return nil, nil
+}
+
+func (gm *gitopsDeleteMessage) AsPagerDutyEvent() (*pagerDutyEvent, error) {
+	return nil, nil
+}
+
+func (gm *gitopsDeleteMessage) AsAlert() (*alert, error) {
+	return nil, nil
+}
+
+func (gm *gitopsDeleteMessage) AsReleaseAnnotation() (*releaseAnnotation, error) {
+	return nil, nil
+}
+
 func MessageFromDeleteEvent(event *events.DeleteEvent) Message {
 	return &gitopsDeleteMessage{
 		event: event,
@@ -86,3 +113,7 @@ func (gm *gitopsDeleteMessage) RepositoryName() string {
 func (gm *gitopsDeleteMessage) SHA() string {
 	return ""
 }
+
+func (gm *gitopsDeleteMessage) Event() interface{} {
+	return gm.event
+}
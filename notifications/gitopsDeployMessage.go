@@ -5,12 +5,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/worker/events"
 	githubLib "github.com/google/go-github/v37/github"
 )
 
-const githubCommitLink = "https://github.com/%s/commit/%s"
 const contextFormat = "gitops/%s@%s"
+const shadowContextFormat = "gitops-shadow/%s@%s"
 
 type gitopsDeployMessage struct {
 	event *events.DeployEvent
@@ -53,8 +54,42 @@ func (gm *gitopsDeployMessage) AsSlackMessage() (*slackMessage, error) {
 				},
 			},
 		)
+	} else if gm.event.Status == events.Parked {
+		msg.Text = fmt.Sprintf("Parked %s of %s", gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
+		msg.Blocks = append(msg.Blocks,
+			Block{
+				Type: section,
+				Text: &Text{
+					Type: markdown,
+					Text: msg.Text,
+				},
+			},
+		)
+		msg.Blocks = append(msg.Blocks,
+			Block{
+				Type: contextString,
+				Elements: []Text{
+					{
+						Type: markdown,
+						Text: fmt.Sprintf(":no_entry: *Parked* \n%s", gm.event.StatusDesc),
+					},
+				},
+			},
+		)
+		msg.Blocks = append(msg.Blocks,
+			Block{
+				Type: contextString,
+				Elements: []Text{
+					{Type: markdown, Text: fmt.Sprintf(":dart: %s", strings.Title(gm.event.Manifest.Env))},
+					{Type: markdown, Text: fmt.Sprintf(":clipboard: %s", gm.event.Artifact.Version.URL)},
+				},
+			},
+		)
 	} else {
 		msg.Text = fmt.Sprintf("Rolling out %s of %s", gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
+		if gm.event.Manifest.Shadow {
+			msg.Text = fmt.Sprintf("Shadow deployed %s of %s, it is not synced to the cluster", gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName)
+		}
 		msg.Blocks = append(msg.Blocks,
 			Block{
 				Type: section,
@@ -74,6 +109,16 @@ func (gm *gitopsDeployMessage) AsSlackMessage() (*slackMessage, error) {
 				},
 			},
 		)
+		if gm.event.Diff != nil {
+			msg.Blocks = append(msg.Blocks,
+				Block{
+					Type: contextString,
+					Elements: []Text{
+						{Type: markdown, Text: fmt.Sprintf(":mag: %s", gm.event.Diff.Summary())},
+					},
+				},
+			)
+		}
 	}
 
 	return msg, nil
@@ -83,18 +128,34 @@ func (gm *gitopsDeployMessage) Env() string {
 	return gm.event.Manifest.Env
 }
 
+func (gm *gitopsDeployMessage) App() string {
+	return gm.event.Manifest.App
+}
+
+func (gm *gitopsDeployMessage) EventType() string {
+	if gm.event.Status == events.Failure || gm.event.Status == events.Parked {
+		return EventFailure
+	}
+	return EventDeploy
+}
+
 func (gm *gitopsDeployMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
-	context := fmt.Sprintf(contextFormat, gm.event.Manifest.Env, time.Now().Format(time.RFC3339))
+	format := contextFormat
+	if gm.event.Manifest.Shadow {
+		format = shadowContextFormat
+	}
+	context := fmt.Sprintf(format, gm.event.Manifest.Env, time.Now().Format(time.RFC3339))
 	desc := gm.event.StatusDesc
 	if len(desc) > 140 {
 		desc = desc[:140]
 	}
 
 	state := "success"
-	targetURL := fmt.Sprintf(githubCommitLink, gm.event.GitopsRepo, gm.event.GitopsRef)
+	targetURL := commitURL(gm.event.GitopsRepo, gm.event.GitopsRef)
 	targetURLPtr := &targetURL
 
-	if gm.event.Status == events.Failure {
+	if gm.event.Status == events.Failure ||
+		gm.event.Status == events.Parked {
 		state = "failure"
 		targetURLPtr = nil
 	}
@@ -107,6 +168,117 @@ func (gm *gitopsDeployMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
 	}, nil
 }
 
+// AsPullRequestComment summarizes the deploy of pull request artifacts, eg. to preview envs.
+// Deploys with nothing to commit, and shadow deploys are not commented
+func (gm *gitopsDeployMessage) AsPullRequestComment() (*pullRequestComment, error) {
+	if gm.event.Artifact.Version.Event != dx.PR || gm.event.Manifest.Shadow {
+		return nil, nil
+	}
+
+	failed := gm.event.Status == events.Failure || gm.event.Status == events.Parked
+	if !failed && gm.event.GitopsRef == "" {
+		return nil, nil
+	}
+
+	return &pullRequestComment{
+		env:          gm.event.Manifest.Env,
+		app:          gm.event.Manifest.App,
+		namespace:    gm.event.Manifest.Namespace,
+		sourceBranch: gm.event.Artifact.Version.SourceBranch,
+		failed:       failed,
+		statusDesc:   gm.event.StatusDesc,
+		gitopsRepo:   gm.event.GitopsRepo,
+		gitopsRef:    gm.event.GitopsRef,
+		diff:         gm.event.Diff,
+		cleanup:      gm.event.Manifest.Cleanup,
+	}, nil
+}
+
+// AsPagerDutyEvent triggers an incident for failed deploys, and resolves it on the next successful one.
+// Parked deploys are intentional, and shadow deploys don't reach the clusters, they don't page
+func (gm *gitopsDeployMessage) AsPagerDutyEvent() (*pagerDutyEvent, error) {
+	if gm.event.Manifest.Shadow {
+		return nil, nil
+	}
+	dedupKey := pagerDutyDedupKey(gm.event.Manifest.Env, gm.event.Manifest.App)
+
+	switch gm.event.Status {
+	case events.Failure:
+		return &pagerDutyEvent{
+			EventAction: pagerDutyTrigger,
+			DedupKey:    dedupKey,
+			Payload: &pagerDutyPayload{
+				Summary:   fmt.Sprintf("Failed to roll out %s of %s to %s", gm.event.Manifest.App, gm.event.Artifact.Version.RepositoryName, gm.event.Manifest.Env),
+				Source:    "gimletd",
+				Severity:  "critical",
+				Component: gm.event.Manifest.App,
+				Group:     gm.event.Manifest.Env,
+				CustomDetails: map[string]string{
+					"error":         gm.event.StatusDesc,
+					"sha":           gm.event.Artifact.Version.SHA,
+					"version":       gm.event.Artifact.Version.URL,
+					"correlationId": gm.event.CorrelationID,
+				},
+			},
+		}, nil
+	case events.Parked:
+		return nil, nil
+	default:
+		return &pagerDutyEvent{
+			EventAction: pagerDutyResolve,
+			DedupKey:    dedupKey,
+		}, nil
+	}
+}
+
+// AsAlert counts the failed deploys towards the repeated deploy failures of the app, and resets the count on a successful one
+func (gm *gitopsDeployMessage) AsAlert() (*alert, error) {
+	if gm.event.Manifest.Shadow {
+		return nil, nil
+	}
+
+	switch gm.event.Status {
+	case events.Failure:
+		return &alert{
+			Kind:    alertDeployFailure,
+			Env:     gm.event.Manifest.Env,
+			App:     gm.event.Manifest.App,
+			Title:   fmt.Sprintf("Repeatedly failed to roll out %s to %s", gm.event.Manifest.App, gm.event.Manifest.Env),
+			Message: gm.event.StatusDesc,
+			Details: map[string]string{
+				"repository":    gm.event.Artifact.Version.RepositoryName,
+				"sha":           gm.event.Artifact.Version.SHA,
+				"correlationId": gm.event.CorrelationID,
+			},
+		}, nil
+	case events.Parked:
+		return nil, nil
+	default:
+		return &alert{
+			Kind: alertDeploySuccess,
+			Env:  gm.event.Manifest.Env,
+			App:  gm.event.Manifest.App,
+		}, nil
+	}
+}
+
+func (gm *gitopsDeployMessage) AsReleaseAnnotation() (*releaseAnnotation, error) {
+	if gm.event.Status != events.Success || gm.event.Manifest.Shadow {
+		return nil, nil
+	}
+
+	version := gm.event.Artifact.Version
+	return &releaseAnnotation{
+		Kind:  annotationDeploy,
+		Env:   gm.event.Manifest.Env,
+		App:   gm.event.Manifest.App,
+		Title: fmt.Sprintf("Deployed %s to %s", gm.event.Manifest.App, gm.event.Manifest.Env),
+		Description: fmt.Sprintf("Deployed %s@%s by %s\n%s\nGitops commit: %s",
+			version.RepositoryName, version.SHA, gm.event.TriggeredBy, version.Message, gm.event.GitopsRef),
+		Labels: []string{"gimletd", gm.event.Manifest.Env, gm.event.Manifest.App},
+	}, nil
+}
+
 func MessageFromGitOpsEvent(event *events.DeployEvent) Message {
 	return &gitopsDeployMessage{
 		event: event,
@@ -120,3 +292,7 @@ func (gm *gitopsDeployMessage) RepositoryName() string {
 func (gm *gitopsDeployMessage) SHA() string {
 	return gm.event.Artifact.Version.SHA
 }
+
+func (gm *gitopsDeployMessage) Event() interface{} {
+	return gm.event
+}
@@ -0,0 +1,107 @@
+package notifications
+
+import (
+	"fmt"
+
+	"github.com/gimlet-io/gimletd/dx"
+	githubLib "github.com/google/go-github/v37/github"
+)
+
+// gitopsHistoryMessage warns that the history of the gitops repo was rewritten, eg. force pushed
+type gitopsHistoryMessage struct {
+	gitopsRepo string
+	rewrite    *dx.GitopsHistoryRewrite
+}
+
+func (gm *gitopsHistoryMessage) AsSlackMessage() (*slackMessage, error) {
+	msg := &slackMessage{
+		Text:   gm.summary(),
+		Blocks: []Block{},
+	}
+
+	msg.Blocks = append(msg.Blocks,
+		Block{
+			Type: section,
+			Text: &Text{
+				Type: markdown,
+				Text: fmt.Sprintf(":rotating_light: %s", msg.Text),
+			},
+		},
+	)
+	msg.Blocks = append(msg.Blocks,
+		Block{
+			Type: contextString,
+			Elements: []Text{
+				{
+					Type: markdown,
+					Text: fmt.Sprintf("Rollbacks and the release history may refer to commits that are gone. Head was %s, now it is %s",
+						commitLink(gm.gitopsRepo, gm.rewrite.OldHead),
+						commitLink(gm.gitopsRepo, gm.rewrite.NewHead),
+					),
+				},
+			},
+		},
+	)
+
+	return msg, nil
+}
+
+func (gm *gitopsHistoryMessage) summary() string {
+	if gm.rewrite.Branch != "" {
+		return fmt.Sprintf("The history of the gitops repo %s was rewritten on the %s branch", gm.gitopsRepo, gm.rewrite.Branch)
+	}
+	return fmt.Sprintf("The history of the gitops repo %s was rewritten", gm.gitopsRepo)
+}
+
+// Env is empty, the message concerns every env
+func (gm *gitopsHistoryMessage) Env() string {
+	return ""
+}
+
+func (gm *gitopsHistoryMessage) App() string {
+	return ""
+}
+
+func (gm *gitopsHistoryMessage) EventType() string {
+	return EventGitops
+}
+
+func (gm *gitopsHistoryMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
+	return nil, nil
+}
+
+func (gm *gitopsHistoryMessage) AsPullRequestComment() (*pullRequestComment, error) {
+	return nil, nil
+}
+
+func (gm *gitopsHistoryMessage) AsPagerDutyEvent() (*pagerDutyEvent, error) {
+	return nil, nil
+}
+
+func (gm *gitopsHistoryMessage) AsAlert() (*alert, error) {
+	return nil, nil
+}
+
+func (gm *gitopsHistoryMessage) AsReleaseAnnotation() (*releaseAnnotation, error) {
+	return nil, nil
+}
+
+func (gm *gitopsHistoryMessage) RepositoryName() string {
+	return ""
+}
+
+func (gm *gitopsHistoryMessage) SHA() string {
+	return ""
+}
+
+// NewGitopsHistoryMessage is sent when the history of the gitops repo is rewritten, not by GimletD
+func NewGitopsHistoryMessage(gitopsRepo string, rewrite *dx.GitopsHistoryRewrite) Message {
+	return &gitopsHistoryMessage{
+		gitopsRepo: gitopsRepo,
+		rewrite:    rewrite,
+	}
+}
+
+func (gm *gitopsHistoryMessage) Event() interface{} {
+	return gm.rewrite
+}
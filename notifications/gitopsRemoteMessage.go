@@ -0,0 +1,141 @@
+package notifications
+
+import (
+	"fmt"
+
+	githubLib "github.com/google/go-github/v37/github"
+)
+
+// gitopsRemoteMessage tells that GimletD paused or resumed processing events, as pushes to the gitops repo keep failing
+type gitopsRemoteMessage struct {
+	gitopsRepo string
+	open       bool
+	err        error
+}
+
+func (gm *gitopsRemoteMessage) AsSlackMessage() (*slackMessage, error) {
+	msg := &slackMessage{
+		Text:   "",
+		Blocks: []Block{},
+	}
+
+	if gm.open {
+		msg.Text = fmt.Sprintf(":rotating_light: Pushing to the gitops repo %s keeps failing, GimletD paused processing events", gm.gitopsRepo)
+	} else {
+		msg.Text = fmt.Sprintf(":white_check_mark: The gitops repo %s is reachable again, GimletD resumed processing events", gm.gitopsRepo)
+	}
+	msg.Blocks = append(msg.Blocks,
+		Block{
+			Type: section,
+			Text: &Text{
+				Type: markdown,
+				Text: msg.Text,
+			},
+		},
+	)
+
+	if gm.err != nil {
+		msg.Blocks = append(msg.Blocks,
+			Block{
+				Type: contextString,
+				Elements: []Text{
+					{
+						Type: markdown,
+						Text: fmt.Sprintf(":exclamation: *Error* :exclamation: \n%s", gm.err),
+					},
+				},
+			},
+		)
+	}
+
+	return msg, nil
+}
+
+// Env is empty, the message concerns every env
+func (gm *gitopsRemoteMessage) Env() string {
+	return ""
+}
+
+func (gm *gitopsRemoteMessage) App() string {
+	return ""
+}
+
+func (gm *gitopsRemoteMessage) EventType() string {
+	if gm.open {
+		return EventFailure
+	}
+	return EventGitops
+}
+
+func (gm *gitopsRemoteMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
+	return nil, nil
+}
+
+func (gm *gitopsRemoteMessage) AsPullRequestComment() (*pullRequestComment, error) {
+	return nil, nil
+}
+
+func (gm *gitopsRemoteMessage) AsPagerDutyEvent() (*pagerDutyEvent, error) {
+	dedupKey := "gimletd/gitops-remote"
+	if !gm.open {
+		return &pagerDutyEvent{
+			EventAction: pagerDutyResolve,
+			DedupKey:    dedupKey,
+		}, nil
+	}
+
+	var errString string
+	if gm.err != nil {
+		errString = gm.err.Error()
+	}
+	return &pagerDutyEvent{
+		EventAction: pagerDutyTrigger,
+		DedupKey:    dedupKey,
+		Payload: &pagerDutyPayload{
+			Summary:   fmt.Sprintf("Pushing to the gitops repo %s keeps failing, GimletD paused processing events", gm.gitopsRepo),
+			Source:    "gimletd",
+			Severity:  "critical",
+			Component: gm.gitopsRepo,
+			CustomDetails: map[string]string{
+				"error": errString,
+			},
+		},
+	}, nil
+}
+
+func (gm *gitopsRemoteMessage) AsAlert() (*alert, error) {
+	return nil, nil
+}
+
+func (gm *gitopsRemoteMessage) AsReleaseAnnotation() (*releaseAnnotation, error) {
+	return nil, nil
+}
+
+func (gm *gitopsRemoteMessage) RepositoryName() string {
+	return ""
+}
+
+func (gm *gitopsRemoteMessage) SHA() string {
+	return ""
+}
+
+// NewGitopsRemoteMessage is sent when GimletD pauses processing events as pushes keep failing, and when it resumes
+func NewGitopsRemoteMessage(gitopsRepo string, open bool, err error) Message {
+	return &gitopsRemoteMessage{
+		gitopsRepo: gitopsRepo,
+		open:       open,
+		err:        err,
+	}
+}
+
+func (gm *gitopsRemoteMessage) Event() interface{} {
+	var errString string
+	if gm.err != nil {
+		errString = gm.err.Error()
+	}
+	return map[string]interface{}{
+		"GitopsRepo": gm.gitopsRepo,
+		"Paused":     gm.open,
+		"Error":      errString,
+	}
+}
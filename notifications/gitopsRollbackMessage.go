@@ -89,10 +89,94 @@ func (gm *gitopsRollbackMessage) Env() string {
 	return gm.event.RollbackRequest.Env
 }
 
+func (gm *gitopsRollbackMessage) App() string {
+	return gm.event.RollbackRequest.App
+}
+
+func (gm *gitopsRollbackMessage) EventType() string {
+	if gm.event.Status == events.Failure {
+		return EventFailure
+	}
+	return EventRollback
+}
+
 func (gm *gitopsRollbackMessage) AsGithubStatus() (*githubLib.RepoStatus, error) {
 	return nil, nil
 }
 
+func (gm *gitopsRollbackMessage) AsPullRequestComment() (*pullRequestComment, error) {
+	return nil, nil
+}
+
+func (gm *gitopsRollbackMessage) AsPagerDutyEvent() (*pagerDutyEvent, error) {
+	request := gm.event.RollbackRequest
+
+	summary := fmt.Sprintf("%s in %s was rolled back to %s by %s", request.App, request.Env, request.TargetSHA, request.TriggeredBy)
+	severity := "error"
+	details := map[string]string{
+		"targetSHA":     request.TargetSHA,
+		"triggeredBy":   request.TriggeredBy,
+		"correlationId": gm.event.CorrelationID,
+	}
+	if gm.event.Status == events.Failure {
+		summary = fmt.Sprintf("Failed to roll back %s in %s", request.App, request.Env)
+		severity = "critical"
+		details["error"] = gm.event.StatusDesc
+	}
+
+	return &pagerDutyEvent{
+		EventAction: pagerDutyTrigger,
+		DedupKey:    pagerDutyDedupKey(request.Env, request.App),
+		Payload: &pagerDutyPayload{
+			Summary:       summary,
+			Source:        "gimletd",
+			Severity:      severity,
+			Component:     request.App,
+			Group:         request.Env,
+			CustomDetails: details,
+		},
+	}, nil
+}
+
+func (gm *gitopsRollbackMessage) AsAlert() (*alert, error) {
+	request := gm.event.RollbackRequest
+
+	a := &alert{
+		Kind:    alertRollback,
+		Env:     request.Env,
+		App:     request.App,
+		Title:   fmt.Sprintf("%s in %s was rolled back to %s", request.App, request.Env, request.TargetSHA),
+		Message: fmt.Sprintf("Rolled back by %s", request.TriggeredBy),
+		Details: map[string]string{
+			"targetSHA":     request.TargetSHA,
+			"triggeredBy":   request.TriggeredBy,
+			"correlationId": gm.event.CorrelationID,
+		},
+	}
+	if gm.event.Status == events.Failure {
+		a.Kind = alertRollbackFailure
+		a.Title = fmt.Sprintf("Failed to roll back %s in %s", request.App, request.Env)
+		a.Message = gm.event.StatusDesc
+	}
+	return a, nil
+}
+
+func (gm *gitopsRollbackMessage) AsReleaseAnnotation() (*releaseAnnotation, error) {
+	if gm.event.Status != events.Success {
+		return nil, nil
+	}
+
+	request := gm.event.RollbackRequest
+	return &releaseAnnotation{
+		Kind:        annotationRollback,
+		Env:         request.Env,
+		App:         request.App,
+		Title:       fmt.Sprintf("Rolled back %s in %s to %s", request.App, request.Env, request.TargetSHA),
+		Description: fmt.Sprintf("Rolled back by %s", request.TriggeredBy),
+		Labels:      []string{"gimletd", request.Env, request.App, "rollback"},
+	}, nil
+}
+
 func MessageFromRollbackEvent(event *events.RollbackEvent) Message {
 	return &gitopsRollbackMessage{
 		event: event,
@@ -106,3 +190,7 @@ func (gm *gitopsRollbackMessage) RepositoryName() string {
 func (gm *gitopsRollbackMessage) SHA() string {
 	return ""
 }
+
+func (gm *gitopsRollbackMessage) Event() interface{} {
+	return gm.event
+}
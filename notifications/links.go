@@ -0,0 +1,66 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commitURLTemplates holds the commit URL format of the supported git providers.
+// Placeholders are {host}, {repo} (owner/name), {owner}, {name} and {sha}
+var commitURLTemplates = map[string]string{
+	"github":           "https://{host}/{repo}/commit/{sha}",
+	"gitlab":           "https://{host}/{repo}/-/commit/{sha}",
+	"bitbucket":        "https://{host}/{repo}/commits/{sha}",
+	"bitbucket-server": "https://{host}/projects/{owner}/repos/{name}/commits/{sha}",
+	"gitea":            "https://{host}/{repo}/commit/{sha}",
+}
+
+var defaultHosts = map[string]string{
+	"github":    "github.com",
+	"gitlab":    "gitlab.com",
+	"bitbucket": "bitbucket.org",
+}
+
+var commitURLTemplate = "https://github.com/{repo}/commit/{sha}"
+
+// SetGitProvider configures the commit links in notifications for a git provider.
+// Host can be omitted for the hosted versions of Github, Gitlab and Bitbucket,
+// a non-empty urlTemplate overrides the provider's template
+func SetGitProvider(provider string, host string, urlTemplate string) error {
+	if urlTemplate != "" {
+		commitURLTemplate = urlTemplate
+		return nil
+	}
+
+	if provider == "" {
+		provider = "github"
+	}
+	template, ok := commitURLTemplates[provider]
+	if !ok {
+		return fmt.Errorf("unknown git provider %q", provider)
+	}
+	if host == "" {
+		host = defaultHosts[provider]
+	}
+	if host == "" {
+		return fmt.Errorf("git host must be set for %s", provider)
+	}
+
+	commitURLTemplate = strings.ReplaceAll(template, "{host}", host)
+	return nil
+}
+
+// commitURL returns the URL of a commit in a repo, where repo is in the owner/name format
+func commitURL(repo string, sha string) string {
+	owner, name := repo, ""
+	if i := strings.LastIndex(repo, "/"); i != -1 {
+		owner, name = repo[:i], repo[i+1:]
+	}
+
+	return strings.NewReplacer(
+		"{repo}", repo,
+		"{owner}", owner,
+		"{name}", name,
+		"{sha}", sha,
+	).Replace(commitURLTemplate)
+}
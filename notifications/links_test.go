@@ -0,0 +1,30 @@
+package notifications
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_commitURL(t *testing.T) {
+	defer SetGitProvider("github", "", "")
+
+	err := SetGitProvider("", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://github.com/gimlet-io/gitops/commit/abc", commitURL("gimlet-io/gitops", "abc"))
+
+	err = SetGitProvider("gitlab", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://gitlab.com/group/subgroup/gitops/-/commit/abc", commitURL("group/subgroup/gitops", "abc"))
+
+	err = SetGitProvider("bitbucket-server", "git.example.com", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://git.example.com/projects/PRJ/repos/gitops/commits/abc", commitURL("PRJ/gitops", "abc"))
+
+	err = SetGitProvider("gitea", "", "")
+	assert.NotNil(t, err, "self-hosted providers need a host")
+
+	err = SetGitProvider("", "", "https://git.example.com/{repo}/c/{sha}")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://git.example.com/gimlet-io/gitops/c/abc", commitURL("gimlet-io/gitops", "abc"))
+}
@@ -5,7 +5,20 @@ import githubLib "github.com/google/go-github/v37/github"
 type Message interface {
 	AsSlackMessage() (*slackMessage, error)
 	AsGithubStatus() (*githubLib.RepoStatus, error)
+	// AsPullRequestComment is only set on the deploys of pull request artifacts
+	AsPullRequestComment() (*pullRequestComment, error)
+	// Event is the event that the message is about, message templates can refer to its fields
+	Event() interface{}
+	AsPagerDutyEvent() (*pagerDutyEvent, error)
+	// AsAlert is only set on rollbacks, and on deploys that count towards the repeated deploy failures
+	AsAlert() (*alert, error)
+	// AsReleaseAnnotation is only set on successful deploys and rollbacks, that change management records
+	AsReleaseAnnotation() (*releaseAnnotation, error)
 	Env() string
+	// App is empty on messages that are not about a single app, eg. Flux events
+	App() string
+	// EventType is one of the Event* constants, used to route the message
+	EventType() string
 	RepositoryName() string
 	SHA() string
 }
@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+const pagerDutyTrigger = "trigger"
+const pagerDutyResolve = "resolve"
+
+// PagerDutyProvider triggers PagerDuty incidents through the Events API v2
+// when deploys to critical envs fail, or rollbacks happen in them.
+// A successful deploy resolves the incident of the app in the env
+type PagerDutyProvider struct {
+	RoutingKey   string
+	CriticalEnvs []string
+
+	eventsURL string
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+func NewPagerDutyProvider(routingKey string, criticalEnvs []string) *PagerDutyProvider {
+	return &PagerDutyProvider{
+		RoutingKey:   routingKey,
+		CriticalEnvs: criticalEnvs,
+		eventsURL:    pagerDutyEventsURL,
+	}
+}
+
+func (p *PagerDutyProvider) send(msg Message) error {
+	if msg.Env() != "" && !p.critical(msg.Env()) { // messages without an env concern every env
+		return nil
+	}
+
+	event, err := msg.AsPagerDutyEvent()
+	if err != nil {
+		return fmt.Errorf("cannot create pagerduty event: %s", err)
+	}
+
+	if event == nil {
+		return nil
+	}
+
+	event.RoutingKey = p.RoutingKey
+	return p.post(event)
+}
+
+func (p *PagerDutyProvider) critical(env string) bool {
+	for _, e := range p.CriticalEnvs {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PagerDutyProvider) post(event *pagerDutyEvent) error {
+	b := new(bytes.Buffer)
+	err := json.NewEncoder(b).Encode(event)
+	if err != nil {
+		return fmt.Errorf("cannot encode pagerduty event: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequest("POST", p.eventsURL, b)
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(ctx)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not post to pagerduty: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("could not post to pagerduty, status: %d, response: %s", res.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// pagerDutyDedupKey groups the incidents of an app in an env
+func pagerDutyDedupKey(env string, app string) string {
+	return fmt.Sprintf("gimletd/%s/%s", env, app)
+}
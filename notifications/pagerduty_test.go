@@ -0,0 +1,74 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_pagerDuty(t *testing.T) {
+	var received []*pagerDutyEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event pagerDutyEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received = append(received, &event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	pagerDuty := NewPagerDutyProvider("routing-key", []string{"production"})
+	pagerDuty.eventsURL = server.URL
+
+	deploy := func(env string, status events.Status) Message {
+		return MessageFromGitOpsEvent(&events.DeployEvent{
+			Manifest:   &dx.Manifest{Env: env, App: "my-app"},
+			Artifact:   &dx.Artifact{Version: dx.Version{RepositoryName: "gimlet-io/my-app"}},
+			Status:     status,
+			StatusDesc: "cannot run helm template",
+		})
+	}
+
+	err := pagerDuty.send(deploy("staging", events.Failure))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(received), "should not page for non-critical envs")
+
+	err = pagerDuty.send(deploy("production", events.Parked))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(received), "should not page for parked deploys")
+
+	err = pagerDuty.send(MessageFromGitOpsEvent(&events.DeployEvent{
+		Manifest: &dx.Manifest{Env: "production", App: "my-app", Shadow: true},
+		Artifact: &dx.Artifact{Version: dx.Version{RepositoryName: "gimlet-io/my-app"}},
+		Status:   events.Failure,
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(received), "should not page for shadow deploys")
+
+	err = pagerDuty.send(deploy("production", events.Failure))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, "routing-key", received[0].RoutingKey)
+	assert.Equal(t, pagerDutyTrigger, received[0].EventAction)
+	assert.Equal(t, "gimletd/production/my-app", received[0].DedupKey)
+	assert.Equal(t, "critical", received[0].Payload.Severity)
+	assert.Equal(t, "cannot run helm template", received[0].Payload.CustomDetails["error"])
+
+	err = pagerDuty.send(MessageFromRollbackEvent(&events.RollbackEvent{
+		RollbackRequest: &dx.RollbackRequest{Env: "production", App: "my-app", TargetSHA: "abc123", TriggeredBy: "laszlo"},
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(received))
+	assert.Equal(t, pagerDutyTrigger, received[1].EventAction)
+	assert.Equal(t, "gimletd/production/my-app", received[1].DedupKey, "rollbacks should dedup with the deploy failures of the app")
+
+	err = pagerDuty.send(deploy("production", events.Success))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(received))
+	assert.Equal(t, pagerDutyResolve, received[2].EventAction, "successful deploys should resolve the incident")
+	assert.Nil(t, received[2].Payload)
+}
@@ -0,0 +1,103 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gimlet-io/gimletd/dx"
+)
+
+// maxPreviewDiffBytes keeps the deploy preview comments under the comment size limit of GitHub
+const maxPreviewDiffBytes = 60 * 1024
+
+// pullRequestComment summarizes the deploy of a pull request artifact on the pull request,
+// or previews the deploy that merging the pull request makes
+type pullRequestComment struct {
+	env          string
+	app          string
+	namespace    string
+	sourceBranch string
+	failed       bool
+	statusDesc   string
+	gitopsRepo   string
+	gitopsRef    string
+	diff         *dx.ManifestDiff
+	cleanup      *dx.Cleanup
+	preview      bool
+}
+
+// marker identifies the comment of an app in an env, so redeploys update it instead of commenting again
+func (c *pullRequestComment) marker() string {
+	if c.preview {
+		return fmt.Sprintf("<!-- gimletd-preview:%s/%s -->", c.env, c.app)
+	}
+	return fmt.Sprintf("<!-- gimletd:%s/%s -->", c.env, c.app)
+}
+
+func (c *pullRequestComment) body(config *dx.PullRequestComment) string {
+	if c.preview {
+		return c.previewBody()
+	}
+
+	var b strings.Builder
+	b.WriteString(c.marker() + "\n")
+
+	if c.failed {
+		fmt.Fprintf(&b, ":x: Failed to deploy **%s** to **%s**\n\n", c.app, c.env)
+		fmt.Fprintf(&b, "```\n%s\n```\n", c.statusDesc)
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, ":rocket: Deployed **%s** to **%s**\n\n", c.app, c.env)
+	if config.URL != "" {
+		url := strings.NewReplacer(
+			"{app}", c.app,
+			"{env}", c.env,
+			"{namespace}", c.namespace,
+			"{branch}", c.sourceBranch,
+		).Replace(config.URL)
+		fmt.Fprintf(&b, "- URL: %s\n", url)
+	}
+	fmt.Fprintf(&b, "- Gitops commit: %s\n", commitURL(c.gitopsRepo, c.gitopsRef))
+	if c.diff != nil {
+		fmt.Fprintf(&b, "- Changes: %s\n", c.diff.Summary())
+	}
+	if c.cleanup != nil && c.cleanup.Event == dx.BranchDeleted {
+		fmt.Fprintf(&b, "- Cleanup: `%s` is deleted automatically when the `%s` branch is deleted\n", c.app, c.sourceBranch)
+	} else {
+		fmt.Fprintf(&b, "- Cleanup: an admin can delete it with `DELETE /api/apps/%s/%s`\n", c.env, c.app)
+	}
+
+	return b.String()
+}
+
+// previewBody lists the manifest changes that merging the pull request deploys, the diff is collapsed
+func (c *pullRequestComment) previewBody() string {
+	var b strings.Builder
+	b.WriteString(c.marker() + "\n")
+
+	if c.failed {
+		fmt.Fprintf(&b, ":warning: Cannot preview the deploy of **%s** to **%s**\n\n", c.app, c.env)
+		fmt.Fprintf(&b, "```\n%s\n```\n", c.statusDesc)
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, ":mag: Merging deploys **%s** to **%s**: %s\n", c.app, c.env, c.diff.Summary())
+	if c.diff.Empty() {
+		return b.String()
+	}
+
+	diff := c.diff.Diff
+	truncated := c.diff.Truncated
+	if len(diff) > maxPreviewDiffBytes {
+		diff = diff[:maxPreviewDiffBytes]
+		truncated = true
+	}
+	b.WriteString("\n<details><summary>Manifest diff</summary>\n\n")
+	fmt.Fprintf(&b, "```diff\n%s\n```\n", strings.TrimSuffix(diff, "\n"))
+	if truncated {
+		b.WriteString("\nThe diff is truncated.\n")
+	}
+	b.WriteString("</details>\n")
+	return b.String()
+}
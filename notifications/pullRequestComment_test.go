@@ -0,0 +1,106 @@
+package notifications
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/worker/events"
+	githubLib "github.com/google/go-github/v37/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_pullRequestComment(t *testing.T) {
+	event := &events.DeployEvent{
+		Manifest: &dx.Manifest{
+			App:       "my-app-fix-login",
+			Env:       "preview",
+			Namespace: "previews",
+			Cleanup:   &dx.Cleanup{AppToCleanup: "my-app-{{ .BRANCH }}", Event: dx.BranchDeleted},
+		},
+		Artifact: &dx.Artifact{
+			Version: dx.Version{
+				Event:        dx.PR,
+				SourceBranch: "fix-login",
+			},
+		},
+		Status:     events.Success,
+		GitopsRepo: "gimlet-io/gitops",
+		GitopsRef:  "abc",
+	}
+
+	comment, err := MessageFromGitOpsEvent(event).AsPullRequestComment()
+	assert.Nil(t, err)
+	body := comment.body(&dx.PullRequestComment{URL: "https://{app}.{namespace}.example.com"})
+	assert.Contains(t, body, "<!-- gimletd:preview/my-app-fix-login -->")
+	assert.Contains(t, body, "https://my-app-fix-login.previews.example.com")
+	assert.Contains(t, body, "https://github.com/gimlet-io/gitops/commit/abc")
+	assert.Contains(t, body, "when the `fix-login` branch is deleted")
+
+	event.Manifest.Cleanup = nil
+	comment, _ = MessageFromGitOpsEvent(event).AsPullRequestComment()
+	assert.Contains(t, comment.body(&dx.PullRequestComment{}), "DELETE /api/apps/preview/my-app-fix-login")
+
+	event.GitopsRef = ""
+	comment, _ = MessageFromGitOpsEvent(event).AsPullRequestComment()
+	assert.Nil(t, comment, "deploys with nothing to commit should not be commented")
+
+	event.Status = events.Failure
+	event.StatusDesc = "cannot render"
+	comment, _ = MessageFromGitOpsEvent(event).AsPullRequestComment()
+	assert.Contains(t, comment.body(&dx.PullRequestComment{}), "cannot render")
+
+	event.Artifact.Version.Event = dx.Push
+	comment, _ = MessageFromGitOpsEvent(event).AsPullRequestComment()
+	assert.Nil(t, comment, "only pull request artifacts should be commented")
+}
+
+func Test_deployPreviewComment(t *testing.T) {
+	event := &events.DeployPreviewEvent{
+		Manifest: &dx.Manifest{App: "my-app", Env: "staging"},
+		Artifact: &dx.Artifact{
+			Version: dx.Version{
+				Event:        dx.PR,
+				SourceBranch: "fix-login",
+				TargetBranch: "main",
+			},
+		},
+		Status: events.Success,
+		Diff: dx.DiffManifests(
+			map[string]string{"deployment.yaml": "image: nginx:1.20\n"},
+			map[string]string{"deployment.yaml": "image: nginx:1.21\n"},
+		),
+	}
+
+	comment, err := MessageFromDeployPreviewEvent(event).AsPullRequestComment()
+	assert.Nil(t, err)
+	body := comment.body(nil)
+	assert.Contains(t, body, "<!-- gimletd-preview:staging/my-app -->", "should not update the deploy comment of the app")
+	assert.Contains(t, body, "Merging deploys **my-app** to **staging**")
+	assert.Contains(t, body, "```diff\n--- a/deployment.yaml")
+	assert.Contains(t, body, "+image: nginx:1.21")
+
+	event.Diff = dx.DiffManifests(map[string]string{}, map[string]string{})
+	comment, _ = MessageFromDeployPreviewEvent(event).AsPullRequestComment()
+	body = comment.body(nil)
+	assert.Contains(t, body, "no manifest changes")
+	assert.NotContains(t, body, "```diff")
+
+	event.Status = events.Failure
+	event.StatusDesc = "cannot render"
+	comment, _ = MessageFromDeployPreviewEvent(event).AsPullRequestComment()
+	assert.Contains(t, comment.body(nil), "cannot render")
+}
+
+func Test_pullRequestNumber(t *testing.T) {
+	open, closed := "open", "closed"
+	branch, other := "fix-login", "main"
+	one, two, three := 1, 2, 3
+	pullRequests := []*githubLib.PullRequest{
+		{Number: &one, State: &closed, Head: &githubLib.PullRequestBranch{Ref: &branch}},
+		{Number: &two, State: &open, Head: &githubLib.PullRequestBranch{Ref: &other}},
+		{Number: &three, State: &open, Head: &githubLib.PullRequestBranch{Ref: &branch}},
+	}
+
+	assert.Equal(t, 3, pullRequestNumber(pullRequests, "fix-login"))
+	assert.Equal(t, 0, pullRequestNumber(pullRequests, "unknown"))
+}
@@ -0,0 +1,87 @@
+package notifications
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Event types that messages can be routed by
+const EventDeploy = "deploy"
+const EventFailure = "failure"
+const EventRollback = "rollback"
+const EventCleanup = "cleanup"
+const EventGitops = "gitops"
+
+var eventTypes = []string{EventDeploy, EventFailure, EventRollback, EventCleanup, EventGitops}
+
+// Route sends the messages of an event type, env and/or team to a channel.
+// Empty fields match everything
+type Route struct {
+	Event string `yaml:"event" json:"event"`
+	Env   string `yaml:"env" json:"env"`
+	// Team matches the messages of the apps that the team owns, see Teams
+	Team    string `yaml:"team" json:"team"`
+	Channel string `yaml:"channel" json:"channel"`
+}
+
+// ParseRouting parses the routing rules from a YAML or JSON list, eg.:
+//
+//	[{event: failure, channel: alerts}, {event: deploy, env: production, channel: prod-deploys}, {team: payments, channel: payments}]
+func ParseRouting(routing string) ([]Route, error) {
+	var routes []Route
+	if routing == "" {
+		return routes, nil
+	}
+
+	err := yaml.Unmarshal([]byte(routing), &routes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse notification routing: %s", err)
+	}
+
+	for _, route := range routes {
+		if route.Channel == "" {
+			return nil, fmt.Errorf("notification route %+v has no channel", route)
+		}
+		if route.Event != "" && !validEventType(route.Event) {
+			return nil, fmt.Errorf("unknown event type %s in notification routing, must be one of %v", route.Event, eventTypes)
+		}
+	}
+	return routes, nil
+}
+
+// route returns the channel of the first matching route, team is the owner of the message's app
+func route(routes []Route, msg Message, team string) (string, bool) {
+	for _, r := range routes {
+		if r.Event != "" && r.Event != msg.EventType() {
+			continue
+		}
+		if r.Env != "" && r.Env != msg.Env() {
+			continue
+		}
+		if r.Team != "" && r.Team != team {
+			continue
+		}
+		return r.Channel, true
+	}
+	return "", false
+}
+
+// hasTeamRoutes tells if the owner teams of the apps are needed to route the messages
+func hasTeamRoutes(routes []Route) bool {
+	for _, r := range routes {
+		if r.Team != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func validEventType(eventType string) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package notifications
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_slackChannel(t *testing.T) {
+	routing, err := ParseRouting(`
+- event: failure
+  channel: alerts
+- event: deploy
+  env: production
+  channel: prod-deploys
+- event: cleanup
+  channel: previews
+`)
+	assert.Nil(t, err)
+
+	slack := &SlackProvider{
+		DefaultChannel: "general",
+		ChannelMapping: map[string]string{"staging": "staging"},
+		Routing:        routing,
+	}
+
+	deploy := func(env string, status events.Status) Message {
+		return MessageFromGitOpsEvent(&events.DeployEvent{
+			Manifest: &dx.Manifest{Env: env},
+			Artifact: &dx.Artifact{},
+			Status:   status,
+		})
+	}
+
+	assert.Equal(t, "prod-deploys", slack.channel(deploy("production", events.Success)))
+	assert.Equal(t, "alerts", slack.channel(deploy("production", events.Failure)))
+	assert.Equal(t, "staging", slack.channel(deploy("staging", events.Success)), "env mapping applies if no route matches")
+	assert.Equal(t, "general", slack.channel(deploy("dev", events.Success)))
+	assert.Equal(t, "previews", slack.channel(MessageFromDeleteEvent(&events.DeleteEvent{Env: "preview"})))
+	assert.Equal(t, "alerts", slack.channel(NewMessage("gitops", &model.GitopsCommit{Status: model.HealthCheckFailed}, "staging")))
+	assert.Equal(t, "staging", slack.channel(NewMessage("gitops", &model.GitopsCommit{Status: model.Progressing}, "staging")))
+}
+
+func Test_teamRouting(t *testing.T) {
+	routing, err := ParseRouting(`
+- event: failure
+  channel: alerts
+- team: payments
+  channel: payments
+`)
+	assert.Nil(t, err)
+
+	slack := &SlackProvider{
+		DefaultChannel: "general",
+		Routing:        routing,
+		Teams:          NewTeams(map[string]string{"checkout": "payments"}, nil),
+	}
+
+	deploy := func(app string, env string, status events.Status) Message {
+		return MessageFromGitOpsEvent(&events.DeployEvent{
+			Manifest: &dx.Manifest{App: app, Env: env},
+			Artifact: &dx.Artifact{},
+			Status:   status,
+		})
+	}
+
+	assert.Equal(t, "payments", slack.channel(deploy("checkout", "staging", events.Success)))
+	assert.Equal(t, "payments", slack.channel(deploy("checkout", "production", events.Success)), "team routes should match in every env")
+	assert.Equal(t, "alerts", slack.channel(deploy("checkout", "production", events.Failure)))
+	assert.Equal(t, "general", slack.channel(deploy("search", "production", events.Success)))
+
+	slack.Teams.codeOwners = func(repo string) (string, error) {
+		return "# owners\n* @gimlet-io/platform\n/docs @gimlet-io/writers\n* @gimlet-io/payments @laszlo\n", nil
+	}
+	assert.Equal(t, "payments", slack.channel(MessageFromGitOpsEvent(&events.DeployEvent{
+		Manifest: &dx.Manifest{App: "search", Env: "production"},
+		Artifact: &dx.Artifact{Version: dx.Version{RepositoryName: "gimlet-io/search"}},
+		Status:   events.Success,
+	})), "the default owner in CODEOWNERS should own the apps of the repository")
+}
+
+func Test_parseRouting(t *testing.T) {
+	routing, err := ParseRouting(`[{"event": "rollback", "channel": "alerts"}]`)
+	assert.Nil(t, err, "JSON should be accepted")
+	assert.Equal(t, []Route{{Event: EventRollback, Channel: "alerts"}}, routing)
+
+	_, err = ParseRouting(`[{event: deploys, channel: alerts}]`)
+	assert.NotNil(t, err, "unknown event types should be rejected")
+
+	_, err = ParseRouting(`[{event: deploy}]`)
+	assert.NotNil(t, err, "routes need a channel")
+}
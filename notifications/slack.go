@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -15,13 +18,43 @@ const markdown = "mrkdwn"
 const section = "section"
 const contextString = "context"
 
-const githubCommitLinkFormat = "<https://github.com/%s/commit/%s|%s>"
-const bitbucketServerLinkFormat = "<http://%s/projects/%s/repos/%s/commits/%s|%s>"
+const commitLinkFormat = "<%s|%s>"
+
+const slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// slackQueueSize is the number of messages a channel queue buffers before senders block
+const slackQueueSize = 100
+
+// slackMaxAttempts is the number of times a rate limited message is retried before it is dropped
+const slackMaxAttempts = 5
 
 type SlackProvider struct {
 	Token          string
 	DefaultChannel string
 	ChannelMapping map[string]string
+
+	// Routing takes precedence over the env based channel mapping
+	Routing []Route
+	// Teams resolves the owner team of the apps for the team routes
+	Teams *Teams
+
+	// Templates replace the default message of their event type
+	Templates Templates
+
+	postMessageURL string
+
+	// queues hold the messages of each channel, so bursts are sent in order and rate limits honored per channel
+	queues     map[string]chan *slackMessage
+	queuesLock sync.Mutex
+}
+
+// errRateLimited is returned by post when Slack responds with 429
+type errRateLimited struct {
+	retryAfter time.Duration
+}
+
+func (e *errRateLimited) Error() string {
+	return fmt.Sprintf("rate limited by slack, retry after %s", e.retryAfter)
 }
 
 type slackMessage struct {
@@ -51,13 +84,77 @@ func (s *SlackProvider) send(msg Message) error {
 		return nil
 	}
 
-	channel := s.DefaultChannel
-	if ch, ok := s.ChannelMapping[msg.Env()]; ok {
-		channel = ch
+	text, rendered, err := s.Templates.render(msg, slackMessage.Text)
+	if err != nil {
+		return err
+	}
+	if rendered {
+		slackMessage.Text = text
+		slackMessage.Blocks = []Block{
+			{
+				Type: section,
+				Text: &Text{
+					Type: markdown,
+					Text: text,
+				},
+			},
+		}
+	}
+
+	slackMessage.Channel = s.channel(msg)
+
+	s.queue(slackMessage.Channel) <- slackMessage
+	return nil
+}
+
+// queue returns the send queue of the channel, starting its sender on first use
+func (s *SlackProvider) queue(channel string) chan *slackMessage {
+	s.queuesLock.Lock()
+	defer s.queuesLock.Unlock()
+
+	if s.queues == nil {
+		s.queues = map[string]chan *slackMessage{}
+	}
+	q, ok := s.queues[channel]
+	if !ok {
+		q = make(chan *slackMessage, slackQueueSize)
+		s.queues[channel] = q
+		go s.sendQueued(q)
+	}
+	return q
+}
+
+// sendQueued posts the messages of a channel queue one by one,
+// waiting as long as Slack's Retry-After header asks when rate limited
+func (s *SlackProvider) sendQueued(q chan *slackMessage) {
+	for msg := range q {
+		for attempt := 1; ; attempt++ {
+			err := s.post(msg)
+			if rateLimited, ok := err.(*errRateLimited); ok && attempt < slackMaxAttempts {
+				logrus.Infof("slack rate limited messages to %s, retrying after %s", msg.Channel, rateLimited.retryAfter)
+				time.Sleep(rateLimited.retryAfter)
+				continue
+			}
+			if err != nil {
+				logrus.Warnf("cannot send notification to %s: %s", msg.Channel, err)
+			}
+			break
+		}
 	}
-	slackMessage.Channel = channel
+}
 
-	return s.post(slackMessage)
+func (s *SlackProvider) channel(msg Message) string {
+	team := ""
+	if hasTeamRoutes(s.Routing) {
+		team = s.Teams.team(msg)
+	}
+	if ch, ok := route(s.Routing, msg, team); ok {
+		return ch
+	}
+	if ch, ok := s.ChannelMapping[msg.Env()]; ok {
+		return ch
+	}
+	return s.DefaultChannel
 }
 
 func (s *SlackProvider) post(msg *slackMessage) error {
@@ -68,7 +165,12 @@ func (s *SlackProvider) post(msg *slackMessage) error {
 		return err
 	}
 
-	req, _ := http.NewRequest("POST", "https://slack.com/api/chat.postMessage", b)
+	url := s.postMessageURL
+	if url == "" {
+		url = slackPostMessageURL
+	}
+
+	req, _ := http.NewRequest("POST", url, b)
 	req.Header.Set("Content-Type", "application/json; charset=utf-8")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.Token))
 	req = req.WithContext(context.TODO())
@@ -79,6 +181,11 @@ func (s *SlackProvider) post(msg *slackMessage) error {
 		logrus.Printf("could not post to slack: %v", err)
 		return err
 	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		return &errRateLimited{retryAfter: retryAfter(res.Header.Get("Retry-After"))}
+	}
 
 	body, err := ioutil.ReadAll(res.Body)
 	var parsed map[string]interface{}
@@ -101,9 +208,18 @@ func (s *SlackProvider) post(msg *slackMessage) error {
 	return nil
 }
 
+// retryAfter parses the seconds of the Retry-After header, defaulting to a second
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return time.Second
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 func commitLink(repo string, ref string) string {
 	if len(ref) < 8 {
 		return ""
 	}
-	return fmt.Sprintf(githubCommitLinkFormat, repo, ref, ref[0:7])
+	return fmt.Sprintf(commitLinkFormat, commitURL(repo, ref), ref[0:7])
 }
@@ -0,0 +1,57 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_slackRateLimit(t *testing.T) {
+	var lock sync.Mutex
+	var received []string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		if requests == 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		var msg slackMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		received = append(received, msg.Text)
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	slack := &SlackProvider{
+		DefaultChannel: "general",
+		postMessageURL: server.URL,
+	}
+
+	q := slack.queue("general")
+	q <- &slackMessage{Channel: "general", Text: "first"}
+	q <- &slackMessage{Channel: "general", Text: "second"}
+	q <- &slackMessage{Channel: "general", Text: "third"}
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(received) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"first", "second", "third"}, received, "rate limited messages should be retried in order")
+	assert.Equal(t, 4, requests)
+}
+
+func Test_retryAfter(t *testing.T) {
+	assert.Equal(t, 30*time.Second, retryAfter("30"))
+	assert.Equal(t, time.Second, retryAfter(""))
+	assert.Equal(t, time.Second, retryAfter("soon"))
+}
@@ -0,0 +1,136 @@
+package notifications
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gimlet-io/gimletd/git/customScm"
+	githubLib "github.com/google/go-github/v37/github"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+// codeOwnersPaths are where GitHub looks for the CODEOWNERS file, in order
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+const codeOwnersCacheTTL = time.Hour
+
+// Teams resolves the team that owns the app of a message, so team routes can send each team only their messages.
+// The app to team mapping takes precedence, the default owner in the CODEOWNERS file of the app's repository is used otherwise
+type Teams struct {
+	appTeams map[string]string
+
+	// codeOwners returns the CODEOWNERS file of a repository, empty if it has none. Nil disables the lookup
+	codeOwners func(repo string) (string, error)
+	cache      map[string]cachedOwner
+	cacheLock  sync.Mutex
+}
+
+type cachedOwner struct {
+	team    string
+	fetched time.Time
+}
+
+// NewTeams returns the team resolver of the app to team mapping.
+// With a token manager, the teams of unmapped apps are looked up in the CODEOWNERS file of their repository on GitHub
+func NewTeams(appTeams map[string]string, tokenManager customScm.NonImpersonatedTokenManager) *Teams {
+	t := &Teams{
+		appTeams: appTeams,
+		cache:    map[string]cachedOwner{},
+	}
+	if tokenManager != nil {
+		t.codeOwners = githubCodeOwners(tokenManager)
+	}
+	return t
+}
+
+// team returns the team of the message's app, empty if it is not known
+func (t *Teams) team(msg Message) string {
+	if t == nil {
+		return ""
+	}
+	if team, ok := t.appTeams[msg.App()]; ok {
+		return team
+	}
+	if t.codeOwners == nil || msg.RepositoryName() == "" {
+		return ""
+	}
+	return t.repositoryOwner(msg.RepositoryName())
+}
+
+// repositoryOwner returns the default owner team in the CODEOWNERS file of the repository, cached for an hour
+func (t *Teams) repositoryOwner(repo string) string {
+	t.cacheLock.Lock()
+	defer t.cacheLock.Unlock()
+
+	if cached, ok := t.cache[repo]; ok && time.Since(cached.fetched) < codeOwnersCacheTTL {
+		return cached.team
+	}
+
+	codeOwners, err := t.codeOwners(repo)
+	if err != nil {
+		logrus.Warnf("cannot get the CODEOWNERS of %s: %s", repo, err)
+		return ""
+	}
+	team := defaultCodeOwner(codeOwners)
+	t.cache[repo] = cachedOwner{team: team, fetched: time.Now()}
+	return team
+}
+
+// defaultCodeOwner returns the first owner of the last rule that matches every file, without the @ and the org,
+// eg. @gimlet-io/payments is the payments team
+func defaultCodeOwner(codeOwners string) string {
+	owner := ""
+	scanner := bufio.NewScanner(strings.NewReader(codeOwners))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "*" && fields[0] != "/*" && fields[0] != "/**" {
+			continue
+		}
+		owner = fields[1]
+	}
+
+	owner = strings.TrimPrefix(owner, "@")
+	if i := strings.LastIndex(owner, "/"); i != -1 {
+		owner = owner[i+1:]
+	}
+	return owner
+}
+
+// githubCodeOwners fetches the CODEOWNERS file of a repository with the GitHub contents API
+func githubCodeOwners(tokenManager customScm.NonImpersonatedTokenManager) func(repo string) (string, error) {
+	return func(repo string) (string, error) {
+		ownerAndName := strings.SplitN(repo, "/", 2)
+		if len(ownerAndName) != 2 {
+			return "", fmt.Errorf("repository %s is not in the owner/name format", repo)
+		}
+
+		token, _, err := tokenManager.TokenFor(ownerAndName[0])
+		if err != nil {
+			return "", fmt.Errorf("couldn't get scm token: %s", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		client := githubLib.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+
+		for _, path := range codeOwnersPaths {
+			file, _, res, err := client.Repositories.GetContents(ctx, ownerAndName[0], ownerAndName[1], path, nil)
+			if res != nil && res.StatusCode == http.StatusNotFound {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			return file.GetContent()
+		}
+		return "", nil
+	}
+}
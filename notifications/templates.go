@@ -0,0 +1,127 @@
+package notifications
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"gopkg.in/yaml.v2"
+)
+
+// Templates override the text of chat messages by event type.
+// Templates are Go templates executed with TemplateData
+type Templates map[string]*template.Template
+
+// TemplateData is what message templates are executed with
+type TemplateData struct {
+	EventType  string
+	Env        string
+	Repository string
+	SHA        string
+	// Text is the default text of the message
+	Text string
+	// Event is the event the message is about, eg. the deploy with its Manifest, Artifact, Status and GitopsRef
+	Event interface{}
+}
+
+// LoadTemplates reads the message templates from a directory, one file for each overridden event type,
+// eg.: failure.tmpl. Event types are deploy, failure, rollback, cleanup, gitops
+func LoadTemplates(dir string) (Templates, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+
+	templates := Templates{}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read message template: %s", err)
+		}
+		err = templates.add(strings.TrimSuffix(filepath.Base(path), ".tmpl"), string(content))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// ParseTemplates parses the message templates from a YAML map of event types and templates, eg.:
+//
+//	{failure: "Deploy of {{ .Event.Manifest.App }} to {{ .Env }} failed, contact #platform"}
+func ParseTemplates(templatesString string) (Templates, error) {
+	templates := Templates{}
+	if templatesString == "" {
+		return templates, nil
+	}
+
+	var raw map[string]string
+	err := yaml.Unmarshal([]byte(templatesString), &raw)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse message templates: %s", err)
+	}
+	for eventType, content := range raw {
+		err = templates.add(eventType, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// Merge returns the templates overridden by the other templates
+func (t Templates) Merge(other Templates) Templates {
+	merged := Templates{}
+	for eventType, tpl := range t {
+		merged[eventType] = tpl
+	}
+	for eventType, tpl := range other {
+		merged[eventType] = tpl
+	}
+	return merged
+}
+
+func (t Templates) add(eventType string, content string) error {
+	if !validEventType(eventType) {
+		return fmt.Errorf("unknown event type %s in message templates, must be one of %v", eventType, eventTypes)
+	}
+	tpl, err := template.New(eventType).Funcs(templateFunctions()).Parse(content)
+	if err != nil {
+		return fmt.Errorf("cannot parse %s message template: %s", eventType, err)
+	}
+	t[eventType] = tpl
+	return nil
+}
+
+func templateFunctions() template.FuncMap {
+	functions := sprig.TxtFuncMap()
+	functions["commitURL"] = commitURL
+	functions["commitLink"] = commitLink
+	return functions
+}
+
+// render renders the template of the message's event type. The rendered return value is false if there is no template for it
+func (t Templates) render(msg Message, defaultText string) (text string, rendered bool, err error) {
+	tpl, ok := t[msg.EventType()]
+	if !ok {
+		return "", false, nil
+	}
+
+	var out bytes.Buffer
+	err = tpl.Execute(&out, TemplateData{
+		EventType:  msg.EventType(),
+		Env:        msg.Env(),
+		Repository: msg.RepositoryName(),
+		SHA:        msg.SHA(),
+		Text:       defaultText,
+		Event:      msg.Event(),
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("cannot render %s message template: %s", msg.EventType(), err)
+	}
+	return strings.TrimSpace(out.String()), true, nil
+}
@@ -0,0 +1,49 @@
+package notifications
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_templates(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gimlet-templates")
+	defer os.RemoveAll(dir)
+	err := ioutil.WriteFile(filepath.Join(dir, "failure.tmpl"), []byte(`{{ .Event.Manifest.App }} {{ .Event.Status }} in {{ .Env }}: {{ .Event.StatusDesc }}`), 0644)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "deploy.tmpl"), []byte(`from the directory`), 0644)
+	assert.Nil(t, err)
+
+	templates, err := LoadTemplates(dir)
+	assert.Nil(t, err)
+	inline, err := ParseTemplates(`{deploy: "{{ .Text | upper }}"}`)
+	assert.Nil(t, err)
+	templates = templates.Merge(inline)
+
+	event := &events.DeployEvent{
+		Manifest:   &dx.Manifest{App: "my-app", Env: "staging"},
+		Artifact:   &dx.Artifact{},
+		Status:     events.Failure,
+		StatusDesc: "cannot render",
+	}
+	text, rendered, err := templates.render(MessageFromGitOpsEvent(event), "default")
+	assert.Nil(t, err)
+	assert.True(t, rendered)
+	assert.Equal(t, "my-app failure in staging: cannot render", text)
+
+	event.Status = events.Success
+	text, _, err = templates.render(MessageFromGitOpsEvent(event), "rolling out")
+	assert.Nil(t, err)
+	assert.Equal(t, "ROLLING OUT", text, "inline templates should override the directory")
+
+	_, rendered, _ = templates.render(NewGitopsRemoteMessage("my/gitops", false, nil), "")
+	assert.False(t, rendered, "event types without a template should keep the default message")
+
+	_, err = ParseTemplates(`{unknown: "x"}`)
+	assert.NotNil(t, err)
+}
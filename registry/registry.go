@@ -0,0 +1,193 @@
+// Package registry lists the tags of container images with the Docker Registry HTTP API V2
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const dockerHub = "registry-1.docker.io"
+
+// Credential is the basic auth credential of a registry
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Client lists image tags, anonymously or with the credential of the registry host
+type Client struct {
+	credentials map[string]Credential
+	client      *http.Client
+	scheme      string
+}
+
+// NewClient takes the credentials in host=user:password format
+func NewClient(credentials map[string]string) *Client {
+	c := &Client{
+		credentials: map[string]Credential{},
+		client:      &http.Client{Timeout: 30 * time.Second},
+		scheme:      "https",
+	}
+	for host, credential := range credentials {
+		userPassword := strings.SplitN(credential, ":", 2)
+		if len(userPassword) != 2 {
+			continue
+		}
+		c.credentials[host] = Credential{Username: userPassword[0], Password: userPassword[1]}
+	}
+	return c
+}
+
+// ParseImage splits an image reference to the registry host and the repository.
+// Images without a registry host are on Docker Hub
+func ParseImage(image string) (string, string) {
+	image = strings.SplitN(image, "@", 2)[0]
+	parts := strings.SplitN(image, "/", 2)
+	host, repository := dockerHub, image
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		host, repository = parts[0], parts[1]
+	}
+
+	if i := strings.LastIndex(repository, ":"); i != -1 {
+		repository = repository[:i]
+	}
+	if host == dockerHub && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return host, repository
+}
+
+// Tags returns all tags of the image
+func (c *Client) Tags(image string) ([]string, error) {
+	host, repository := ParseImage(image)
+
+	var tags []string
+	var token string
+	next := fmt.Sprintf("%s://%s/v2/%s/tags/list", c.scheme, host, repository)
+	for next != "" {
+		res, err := c.get(next, host, token)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode == http.StatusUnauthorized && token == "" {
+			challenge := res.Header.Get("WWW-Authenticate")
+			res.Body.Close()
+			token, err = c.token(challenge, host, repository)
+			if err != nil {
+				return nil, fmt.Errorf("cannot authenticate to %s: %s", host, err)
+			}
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("cannot list tags of %s: %s", image, res.Status)
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse tags of %s: %s", image, err)
+		}
+		tags = append(tags, page.Tags...)
+
+		next, err = nextPage(next, res.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+func (c *Client) get(url string, host string, token string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if credential, ok := c.credentials[host]; ok {
+		req.SetBasicAuth(credential.Username, credential.Password)
+	}
+	return c.client.Do(req)
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// token gets a bearer token from the auth service that the challenge of the registry points to
+func (c *Client) token(challenge string, host string, repository string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("unsupported auth challenge: %s", challenge)
+	}
+	params := map[string]string{}
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("no realm in auth challenge: %s", challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", err
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", repository)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	res, err := c.get(realm.String(), host, "")
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s", res.Status)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&tokenResponse)
+	if err != nil {
+		return "", err
+	}
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+	return tokenResponse.AccessToken, nil
+}
+
+var linkNext = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPage resolves the next page of the tag list from the Link header, empty on the last page
+func nextPage(current string, link string) (string, error) {
+	match := linkNext.FindStringSubmatch(link)
+	if match == nil {
+		return "", nil
+	}
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	next, err := base.Parse(match[1])
+	if err != nil {
+		return "", err
+	}
+	return next.String(), nil
+}
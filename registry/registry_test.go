@@ -0,0 +1,55 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseImage(t *testing.T) {
+	for image, expected := range map[string][2]string{
+		"nginx":                          {"registry-1.docker.io", "library/nginx"},
+		"nginx:1.21":                     {"registry-1.docker.io", "library/nginx"},
+		"gimlet/gimletd":                 {"registry-1.docker.io", "gimlet/gimletd"},
+		"ghcr.io/gimlet-io/gimletd:v1.0": {"ghcr.io", "gimlet-io/gimletd"},
+		"localhost:5000/my-app":          {"localhost:5000", "my-app"},
+	} {
+		host, repository := ParseImage(image)
+		assert.Equal(t, expected[0], host, image)
+		assert.Equal(t, expected[1], repository, image)
+	}
+}
+
+func Test_tags(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			assert.Equal(t, "repository:gimlet-io/gimletd:pull", r.URL.Query().Get("scope"))
+			user, password, _ := r.BasicAuth()
+			assert.Equal(t, "robot:secret", user+":"+password)
+			w.Write([]byte(`{"token": "abc"}`))
+		case r.Header.Get("Authorization") != "Bearer abc":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/gimlet-io/gimletd/tags/list?last=1.0.0&n=2>; rel="next"`)
+			w.Write([]byte(`{"name": "gimlet-io/gimletd", "tags": ["0.9.0", "1.0.0"]}`))
+		default:
+			w.Write([]byte(`{"name": "gimlet-io/gimletd", "tags": ["1.1.0"]}`))
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	client := NewClient(map[string]string{host: "robot:secret"})
+	client.scheme = "http"
+
+	tags, err := client.Tags(host + "/gimlet-io/gimletd")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0.9.0", "1.0.0", "1.1.0"}, tags, "should follow the pages")
+}
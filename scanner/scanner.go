@@ -0,0 +1,213 @@
+// Package scanner scans container images for vulnerabilities with the Trivy or Grype CLI
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severities are the vulnerability severities, from the lowest to the highest
+var Severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// Vulnerability is a vulnerability found in a package of the image
+type Vulnerability struct {
+	ID       string `json:"id"`
+	Package  string `json:"package"`
+	Severity string `json:"severity"`
+}
+
+// Report is the result of an image scan
+type Report struct {
+	Image           string          `json:"image"`
+	Scanner         string          `json:"scanner"`
+	Counts          map[string]int  `json:"counts"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// Scanner runs the scanner CLI, that must be on the PATH
+type Scanner struct {
+	tool    string
+	server  string
+	timeout time.Duration
+	run     func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// New takes trivy or grype as the tool. Trivy can scan with a Trivy server, grype ignores the server
+func New(tool string, server string, timeout time.Duration) (*Scanner, error) {
+	if tool != "trivy" && tool != "grype" {
+		return nil, fmt.Errorf("unknown vulnerability scanner %q", tool)
+	}
+	return &Scanner{
+		tool:    tool,
+		server:  server,
+		timeout: timeout,
+		run:     runCommand,
+	}, nil
+}
+
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return out, err
+}
+
+// Scan scans the image, eg.: ghcr.io/gimlet-io/gimletd:v0.10.0
+func (s *Scanner) Scan(image string) (*Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var args []string
+	var parse func([]byte) ([]Vulnerability, error)
+	switch s.tool {
+	case "trivy":
+		args = []string{"image", "--quiet", "--format", "json"}
+		if s.server != "" {
+			args = append(args, "--server", s.server)
+		}
+		args = append(args, image)
+		parse = parseTrivy
+	case "grype":
+		args = []string{image, "--quiet", "--output", "json"}
+		parse = parseGrype
+	}
+
+	out, err := s.run(ctx, s.tool, args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot scan %s with %s: %s", image, s.tool, err)
+	}
+	vulnerabilities, err := parse(out)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s report: %s", s.tool, err)
+	}
+
+	report := &Report{
+		Image:           image,
+		Scanner:         s.tool,
+		Counts:          map[string]int{},
+		Vulnerabilities: vulnerabilities,
+	}
+	for _, v := range vulnerabilities {
+		report.Counts[v.Severity]++
+	}
+	sort.SliceStable(report.Vulnerabilities, func(i, j int) bool {
+		return severityRank(report.Vulnerabilities[i].Severity) > severityRank(report.Vulnerabilities[j].Severity)
+	})
+	return report, nil
+}
+
+// Exceeded returns the thresholds that the report exceeds, in a human readable form.
+// Thresholds are the most vulnerabilities allowed of each severity
+func (r *Report) Exceeded(thresholds map[string]int) []string {
+	var exceeded []string
+	for _, severity := range Severities {
+		max, ok := thresholds[severity]
+		if !ok {
+			continue
+		}
+		if r.Counts[severity] > max {
+			exceeded = append(exceeded, fmt.Sprintf("%d %s (max %d)", r.Counts[severity], severity, max))
+		}
+	}
+	return exceeded
+}
+
+// Summary counts the vulnerabilities by severity, from the highest
+func (r *Report) Summary() string {
+	var counts []string
+	for i := len(Severities) - 1; i >= 0; i-- {
+		if count := r.Counts[Severities[i]]; count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, Severities[i]))
+		}
+	}
+	if len(counts) == 0 {
+		return fmt.Sprintf("%s found no vulnerabilities in %s", r.Scanner, r.Image)
+	}
+	return fmt.Sprintf("%s found %s vulnerabilities in %s", r.Scanner, strings.Join(counts, ", "), r.Image)
+}
+
+func severityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return 0
+}
+
+// normalizeSeverity maps the severities of the scanners to Severities
+func normalizeSeverity(severity string) string {
+	severity = strings.ToUpper(severity)
+	if severity == "NEGLIGIBLE" {
+		return "LOW"
+	}
+	for _, s := range Severities {
+		if s == severity {
+			return s
+		}
+	}
+	return "UNKNOWN"
+}
+
+func parseTrivy(out []byte) ([]Vulnerability, error) {
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID string
+				PkgName         string
+				Severity        string
+			}
+		}
+	}
+	err := json.Unmarshal(out, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	vulnerabilities := []Vulnerability{}
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				ID:       v.VulnerabilityID,
+				Package:  v.PkgName,
+				Severity: normalizeSeverity(v.Severity),
+			})
+		}
+	}
+	return vulnerabilities, nil
+}
+
+func parseGrype(out []byte) ([]Vulnerability, error) {
+	var report struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID       string `json:"id"`
+				Severity string `json:"severity"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name string `json:"name"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	err := json.Unmarshal(out, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	vulnerabilities := []Vulnerability{}
+	for _, m := range report.Matches {
+		vulnerabilities = append(vulnerabilities, Vulnerability{
+			ID:       m.Vulnerability.ID,
+			Package:  m.Artifact.Name,
+			Severity: normalizeSeverity(m.Vulnerability.Severity),
+		})
+	}
+	return vulnerabilities, nil
+}
@@ -0,0 +1,57 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_scanTrivy(t *testing.T) {
+	s, err := New("trivy", "http://trivy:4954", time.Minute)
+	assert.Nil(t, err)
+
+	var args []string
+	s.run = func(ctx context.Context, name string, a ...string) ([]byte, error) {
+		args = a
+		return []byte(`{"Results": [
+			{"Target": "alpine", "Vulnerabilities": [
+				{"VulnerabilityID": "CVE-1", "PkgName": "openssl", "Severity": "HIGH"},
+				{"VulnerabilityID": "CVE-2", "PkgName": "musl", "Severity": "LOW"}
+			]},
+			{"Target": "app", "Vulnerabilities": [
+				{"VulnerabilityID": "CVE-3", "PkgName": "lodash", "Severity": "CRITICAL"}
+			]}
+		]}`), nil
+	}
+
+	report, err := s.Scan("nginx:1.21")
+	assert.Nil(t, err)
+	assert.Contains(t, args, "--server")
+	assert.Equal(t, "nginx:1.21", args[len(args)-1])
+	assert.Equal(t, 3, len(report.Vulnerabilities))
+	assert.Equal(t, "CVE-3", report.Vulnerabilities[0].ID, "the most severe vulnerabilities should come first")
+	assert.Equal(t, "trivy found 1 CRITICAL, 1 HIGH, 1 LOW vulnerabilities in nginx:1.21", report.Summary())
+
+	assert.Equal(t, []string{"1 CRITICAL (max 0)"}, report.Exceeded(map[string]int{"CRITICAL": 0, "HIGH": 5}))
+	assert.Empty(t, report.Exceeded(map[string]int{"MEDIUM": 0}))
+}
+
+func Test_scanGrype(t *testing.T) {
+	s, err := New("grype", "", time.Minute)
+	assert.Nil(t, err)
+	s.run = func(ctx context.Context, name string, a ...string) ([]byte, error) {
+		return []byte(`{"matches": [
+			{"vulnerability": {"id": "CVE-1", "severity": "Critical"}, "artifact": {"name": "openssl"}},
+			{"vulnerability": {"id": "CVE-2", "severity": "Negligible"}, "artifact": {"name": "musl"}}
+		]}`), nil
+	}
+
+	report, err := s.Scan("nginx:1.21")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"CRITICAL": 1, "LOW": 1}, report.Counts)
+
+	_, err = New("clair", "", time.Minute)
+	assert.NotNil(t, err)
+}
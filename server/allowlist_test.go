@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ipAllowlist(t *testing.T) {
+	_, err := ipAllowlist("10.0.0.0/33")
+	assert.NotNil(t, err)
+
+	allowlist, err := ipAllowlist("10.0.0.0/8, 192.168.1.10")
+	assert.Nil(t, err)
+	handler := allowlist(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for remoteAddr, expected := range map[string]int{
+		"10.1.2.3:1234":     http.StatusOK,
+		"192.168.1.10:1234": http.StatusOK,
+		"192.168.1.11:1234": http.StatusForbidden,
+		"[::1]:1234":        http.StatusForbidden,
+	} {
+		req := httptest.NewRequest("GET", "/api/artifacts", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, expected, rr.Code, remoteAddr)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+const deleteConfirmationTTL = 5 * time.Minute
+
+// deleteApp deletes an app from an env in two steps:
+// the first call returns a confirmation token, the second call with the token creates the delete event
+func deleteApp(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+
+	env := chi.URLParam(r, "env")
+	app := chi.URLParam(r, "app")
+
+	confirmationToken := r.URL.Query().Get("confirm")
+	if confirmationToken == "" {
+		expires := time.Now().Add(deleteConfirmationTTL).Unix()
+		confirmationBytes, _ := json.Marshal(dx.DeleteConfirmation{
+			ConfirmationToken: deleteConfirmationToken(user.Secret, env, app, expires),
+			Expires:           expires,
+		})
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(confirmationBytes)
+		return
+	}
+	if !validDeleteConfirmation(user.Secret, env, app, confirmationToken) {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "invalid or expired confirmation token"), http.StatusBadRequest)
+		return
+	}
+
+	deleteRequestStr, err := json.Marshal(dx.DeleteRequest{
+		Env:         env,
+		App:         app,
+		TriggeredBy: user.Login,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - cannot serialize delete request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+
+	event, err := store.CreateEvent(&model.Event{
+		Type:          model.TypeAppDelete,
+		Blob:          string(deleteRequestStr),
+		GitopsHashes:  []string{},
+		CorrelationID: correlationIDFrom(r.Context()),
+	})
+	if err != nil {
+		logrus.Errorf("cannot save delete request: %s", err)
+		http.Error(w, fmt.Sprintf("%s - cannot save delete request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+
+	eventIDBytes, _ := json.Marshal(map[string]string{
+		"id": event.ID,
+	})
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(eventIDBytes)
+}
+
+func deleteConfirmationToken(secret string, env string, app string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s/%s/%d", env, app, expires)
+	return fmt.Sprintf("%d.%s", expires, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func validDeleteConfirmation(secret string, env string, app string, token string) bool {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	return hmac.Equal([]byte(token), []byte(deleteConfirmationToken(secret, env, app, expires)))
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_deleteApp(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "admin", Secret: "secret", Admin: true}
+
+	deleteRequest := func(path string) *httptest.ResponseRecorder {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("env", "staging")
+		rctx.URLParams.Add("app", "my-app")
+
+		req := httptest.NewRequest("DELETE", path, nil)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, "store", store)
+		ctx = context.WithValue(ctx, "user", user)
+
+		rr := httptest.NewRecorder()
+		deleteApp(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	rr := deleteRequest("/api/apps/staging/my-app")
+	assert.Equal(t, http.StatusAccepted, rr.Code, "should ask for confirmation first")
+	var confirmation dx.DeleteConfirmation
+	err := json.Unmarshal(rr.Body.Bytes(), &confirmation)
+	assert.Nil(t, err)
+
+	rr = deleteRequest("/api/apps/staging/my-app?confirm=1.abc")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = deleteRequest("/api/apps/staging/my-app?confirm=" + confirmation.ConfirmationToken)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	events, err := store.UnprocessedEvents()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, model.TypeAppDelete, events[0].Type)
+
+	expired := deleteConfirmationToken(user.Secret, "staging", "my-app", time.Now().Add(-time.Minute).Unix())
+	assert.False(t, validDeleteConfirmation(user.Secret, "staging", "my-app", expired))
+	assert.False(t, validDeleteConfirmation(user.Secret, "production", "my-app", confirmation.ConfirmationToken), "tokens are bound to the env and app")
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// createArtifactCallback registers a URL that is called when the deploy decision on an artifact of the repository is complete
+func createArtifactCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+
+	var callback model.ArtifactCallback
+	err := json.NewDecoder(r.Body).Decode(&callback)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: cannot decode callback: %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+		return
+	}
+	if callback.Repository == "" || callback.URL == "" {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "repository and url parameters are mandatory"), http.StatusBadRequest)
+		return
+	}
+	callbackURL, err := url.Parse(callback.URL)
+	if err != nil || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") || callbackURL.Host == "" {
+		http.Error(w, fmt.Sprintf("%s: %s is not a valid http(s) url", http.StatusText(http.StatusBadRequest), callback.URL), http.StatusBadRequest)
+		return
+	}
+
+	callbacks, err := store.ArtifactCallbacks()
+	if err != nil {
+		logrus.Errorf("cannot load artifact callbacks: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	callback.ID = uuid.New().String()
+	callback.CreatedBy = user.Login
+	callback.Created = time.Now().Unix()
+
+	err = store.SaveArtifactCallbacks(append(callbacks, &callback))
+	if err != nil {
+		logrus.Errorf("cannot save artifact callbacks: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("artifact callback %s registered by %s for %s", callback.ID, user.Login, callback.Repository)
+
+	callback.Secret = ""
+	callbackString, err := json.Marshal(callback)
+	if err != nil {
+		logrus.Errorf("cannot serialize artifact callback: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(callbackString)
+}
+
+// getArtifactCallbacks lists the registered artifact callbacks, optionally of a repository. Secrets are not returned
+func getArtifactCallbacks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	repository := r.URL.Query().Get("repository")
+
+	callbacks, err := store.ArtifactCallbacks()
+	if err != nil {
+		logrus.Errorf("cannot load artifact callbacks: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	filtered := []*model.ArtifactCallback{}
+	for _, c := range callbacks {
+		if repository != "" && c.Repository != repository {
+			continue
+		}
+		c.Secret = ""
+		filtered = append(filtered, c)
+	}
+
+	callbacksString, err := json.Marshal(filtered)
+	if err != nil {
+		logrus.Errorf("cannot serialize artifact callbacks: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(callbacksString)
+}
+
+// deleteArtifactCallback removes an artifact callback, users can remove the callbacks they registered, admins any callback
+func deleteArtifactCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+	id := chi.URLParam(r, "id")
+
+	callbacks, err := store.ArtifactCallbacks()
+	if err != nil {
+		logrus.Errorf("cannot load artifact callbacks: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	remaining := []*model.ArtifactCallback{}
+	var deleted *model.ArtifactCallback
+	for _, c := range callbacks {
+		if c.ID == id {
+			deleted = c
+			continue
+		}
+		remaining = append(remaining, c)
+	}
+	if deleted == nil {
+		http.Error(w, fmt.Sprintf("%s: callback %s doesn't exist", http.StatusText(http.StatusNotFound), id), http.StatusNotFound)
+		return
+	}
+	if deleted.CreatedBy != user.Login && !user.Admin {
+		http.Error(w, fmt.Sprintf("%s: callback %s was registered by %s", http.StatusText(http.StatusForbidden), id, deleted.CreatedBy), http.StatusForbidden)
+		return
+	}
+
+	err = store.SaveArtifactCallbacks(remaining)
+	if err != nil {
+		logrus.Errorf("cannot save artifact callbacks: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_artifactCallbacks(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "ci"}
+	ctx := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return context.WithValue(ctx, "user", user)
+	}
+
+	status, _, _ := testPostEndpoint(createArtifactCallback, ctx, "/api/artifactCallbacks", `{"repository":"my-org/my-app","url":"ftp://ci.example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, status, "should only accept http urls")
+
+	status, body, _ := testPostEndpoint(createArtifactCallback, ctx, "/api/artifactCallbacks", `{"repository":"my-org/my-app","url":"https://ci.example.com/hook","secret":"s3cret"}`)
+	assert.Equal(t, http.StatusCreated, status, body)
+	var created model.ArtifactCallback
+	err := json.Unmarshal([]byte(body), &created)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, "ci", created.CreatedBy)
+	assert.NotContains(t, body, "s3cret")
+
+	_, _, _ = testPostEndpoint(createArtifactCallback, ctx, "/api/artifactCallbacks", `{"repository":"my-org/other-app","url":"https://ci.example.com/hook"}`)
+
+	status, body, _ = testEndpoint(getArtifactCallbacks, ctx, "/api/artifactCallbacks?repository=my-org/my-app")
+	assert.Equal(t, http.StatusOK, status)
+	var callbacks []*model.ArtifactCallback
+	json.Unmarshal([]byte(body), &callbacks)
+	assert.Len(t, callbacks, 1)
+	assert.NotContains(t, body, "s3cret")
+
+	stored, _ := store.ArtifactCallbacks()
+	assert.Equal(t, "s3cret", stored[0].Secret, "should keep the secret for signing")
+
+	deleteRequest := func(id string, user *model.User) int {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+
+		req := httptest.NewRequest("DELETE", "/api/artifactCallbacks/"+id, nil)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, "store", store)
+		ctx = context.WithValue(ctx, "user", user)
+
+		rr := httptest.NewRecorder()
+		deleteArtifactCallback(rr, req.WithContext(ctx))
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, deleteRequest("nonexistent", user))
+	assert.Equal(t, http.StatusForbidden, deleteRequest(created.ID, &model.User{Login: "someone-else"}))
+	assert.Equal(t, http.StatusOK, deleteRequest(created.ID, user))
+
+	stored, _ = store.ArtifactCallbacks()
+	assert.Len(t, stored, 1)
+	assert.Equal(t, "my-org/other-app", stored[0].Repository)
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// configuredRepoAllowlist parses the ARTIFACT_REPO_ALLOWLIST setting, it is validated on startup
+func configuredRepoAllowlist(allowlist string) []*model.AllowedRepository {
+	configured, err := model.ParseRepoAllowlist(allowlist)
+	if err != nil {
+		logrus.Errorf("invalid artifact repo allowlist: %s", err)
+		return []*model.AllowedRepository{}
+	}
+	return configured
+}
+
+// artifactRepoAllowed tells if the user may submit the artifacts of the repository.
+// Every repository is allowed while neither the configured, nor the stored allowlist has entries
+func artifactRepoAllowed(ctx context.Context, repository string, login string) (bool, error) {
+	store := ctx.Value("store").(*store.Store)
+	configured, _ := ctx.Value("artifactRepoAllowlist").([]*model.AllowedRepository)
+	return store.ArtifactRepoAllowed(configured, repository, login)
+}
+
+// getArtifactRepoAllowlist lists the source repositories that may submit artifacts
+func getArtifactRepoAllowlist(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	configured, _ := ctx.Value("artifactRepoAllowlist").([]*model.AllowedRepository)
+
+	allowlist, err := store.ArtifactRepoAllowlist()
+	if err != nil {
+		logrus.Errorf("cannot load artifact repo allowlist: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if configured == nil {
+		configured = []*model.AllowedRepository{}
+	}
+
+	allowlistString, err := json.Marshal(&model.RepoAllowlist{
+		Configured:   configured,
+		Repositories: allowlist,
+	})
+	if err != nil {
+		logrus.Errorf("cannot serialize artifact repo allowlist: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(allowlistString)
+}
+
+// allowArtifactRepo adds a source repository, or a path pattern of them, to the artifact allowlist,
+// with the users and API tokens that may submit its artifacts
+func allowArtifactRepo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+
+	var allowed model.AllowedRepository
+	err := json.NewDecoder(r.Body).Decode(&allowed)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: cannot decode allowed repository: %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+		return
+	}
+	if allowed.Repository == "" {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "repository parameter is mandatory"), http.StatusBadRequest)
+		return
+	}
+	if _, err := path.Match(allowed.Repository, ""); err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s is not a valid repository pattern", http.StatusText(http.StatusBadRequest), allowed.Repository), http.StatusBadRequest)
+		return
+	}
+	if len(allowed.Users) == 0 {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "users parameter is mandatory, the logins that may submit the artifacts of the repository"), http.StatusBadRequest)
+		return
+	}
+
+	allowlist, err := store.ArtifactRepoAllowlist()
+	if err != nil {
+		logrus.Errorf("cannot load artifact repo allowlist: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	for _, a := range allowlist {
+		if a.Repository == allowed.Repository {
+			http.Error(w, fmt.Sprintf("%s: %s is already allowed", http.StatusText(http.StatusConflict), allowed.Repository), http.StatusConflict)
+			return
+		}
+	}
+
+	allowed.CreatedBy = user.Login
+	allowed.Created = time.Now().Unix()
+
+	err = store.SaveArtifactRepoAllowlist(append(allowlist, &allowed))
+	if err != nil {
+		logrus.Errorf("cannot save artifact repo allowlist: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("%s allowed to submit the artifacts of %s by %s", strings.Join(allowed.Users, ", "), allowed.Repository, user.Login)
+
+	allowedString, err := json.Marshal(allowed)
+	if err != nil {
+		logrus.Errorf("cannot serialize allowed repository: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(allowedString)
+}
+
+// disallowArtifactRepo removes a source repository from the artifact allowlist
+func disallowArtifactRepo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+	repository := r.URL.Query().Get("repository")
+
+	allowlist, err := store.ArtifactRepoAllowlist()
+	if err != nil {
+		logrus.Errorf("cannot load artifact repo allowlist: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	remaining := []*model.AllowedRepository{}
+	for _, a := range allowlist {
+		if a.Repository != repository {
+			remaining = append(remaining, a)
+		}
+	}
+	if len(remaining) == len(allowlist) {
+		http.Error(w, fmt.Sprintf("%s: %s is not on the allowlist", http.StatusText(http.StatusNotFound), repository), http.StatusNotFound)
+		return
+	}
+
+	err = store.SaveArtifactRepoAllowlist(remaining)
+	if err != nil {
+		logrus.Errorf("cannot save artifact repo allowlist: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	logrus.Infof("%s removed from the artifact allowlist by %s", repository, user.Login)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_artifactRepoAllowlist(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "team-ci", Admin: true}
+	configured := []*model.AllowedRepository{{Repository: "my-org/team-*", Users: []string{"team-ci"}}}
+	ctx := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		ctx = context.WithValue(ctx, "artifactRepoAllowlist", configured)
+		return context.WithValue(ctx, "user", user)
+	}
+	artifact := func(repository string) string {
+		return `{"version":{"repositoryName":"` + repository + `","sha":"abc"}}`
+	}
+
+	status, _, _ := testPostEndpoint(saveArtifact, ctx, "/api/artifact", artifact("my-org/team-a-app"))
+	assert.Equal(t, http.StatusCreated, status, "configured patterns should be allowed")
+	status, body, _ := testPostEndpoint(saveArtifact, ctx, "/api/artifact", artifact("my-org/my-app"))
+	assert.Equal(t, http.StatusForbidden, status, "repositories not on the allowlist should be rejected")
+	assert.Contains(t, body, "my-org/my-app")
+
+	status, _, _ = testPostEndpoint(allowArtifactRepo, ctx, "/api/artifactRepoAllowlist", `{"repository":"my-org/[app","users":["my-app-ci"]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _, _ = testPostEndpoint(allowArtifactRepo, ctx, "/api/artifactRepoAllowlist", `{"repository":"my-org/my-app"}`)
+	assert.Equal(t, http.StatusBadRequest, status, "entries should be bound to users")
+	status, body, _ = testPostEndpoint(allowArtifactRepo, ctx, "/api/artifactRepoAllowlist", `{"repository":"my-org/my-app","users":["my-app-ci"]}`)
+	assert.Equal(t, http.StatusCreated, status, body)
+	status, _, _ = testPostEndpoint(allowArtifactRepo, ctx, "/api/artifactRepoAllowlist", `{"repository":"my-org/my-app","users":["my-app-ci"]}`)
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, _, _ = testPostEndpoint(saveArtifact, ctx, "/api/artifact", artifact("my-org/my-app"))
+	assert.Equal(t, http.StatusForbidden, status, "other users should not impersonate the repository")
+	user.Login = "my-app-ci"
+	status, _, _ = testPostEndpoint(saveArtifact, ctx, "/api/artifact", artifact("my-org/my-app"))
+	assert.Equal(t, http.StatusCreated, status, "repositories allowed with the API should be allowed for their users")
+	status, _, _ = testPostEndpoint(saveArtifact, ctx, "/api/artifact", artifact("my-org/team-a-app"))
+	assert.Equal(t, http.StatusForbidden, status, "the user should not impersonate other repositories")
+
+	status, body, _ = testEndpoint(getArtifactRepoAllowlist, ctx, "/api/artifactRepoAllowlist")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"configured":[{"repository":"my-org/team-*","users":["team-ci"]}]`)
+	assert.Contains(t, body, `"createdBy":"team-ci"`)
+
+	disallow := func(repository string) int {
+		req := httptest.NewRequest("DELETE", "/api/artifactRepoAllowlist?repository="+repository, nil)
+		rr := httptest.NewRecorder()
+		disallowArtifactRepo(rr, req.WithContext(ctx(req.Context())))
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusNotFound, disallow("my-org/other-app"))
+	assert.Equal(t, http.StatusOK, disallow("my-org/my-app"))
+
+	configured = []*model.AllowedRepository{}
+	status, _, _ = testPostEndpoint(saveArtifact, ctx, "/api/artifact", artifact("my-org/my-app"))
+	assert.Equal(t, http.StatusCreated, status, "every repository should be allowed while the allowlist is empty")
+}
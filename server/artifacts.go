@@ -1,11 +1,13 @@
 package server
 
 import (
+	"crypto"
 	"encoding/json"
 	"fmt"
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"net/http"
@@ -18,7 +20,70 @@ func saveArtifact(w http.ResponseWriter, r *http.Request) {
 	store := ctx.Value("store").(*store.Store)
 
 	var artifact dx.Artifact
-	json.NewDecoder(r.Body).Decode(&artifact)
+	err := json.NewDecoder(r.Body).Decode(&artifact)
+	if err != nil {
+		logrus.Errorf("cannot decode artifact: %s", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the wait parameter is checked before the artifact is saved, so a retry of a bad request doesn't ingest it twice
+	var wait *time.Duration
+	if val, ok := r.URL.Query()["wait"]; ok {
+		timeout, err := time.ParseDuration(val[0])
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if timeout > maxArtifactWait {
+			timeout = maxArtifactWait
+		}
+		wait = &timeout
+	}
+
+	user := ctx.Value("user").(*model.User)
+	allowed, err := artifactRepoAllowed(ctx, artifact.Version.RepositoryName, user.Login)
+	if err != nil {
+		logrus.Errorf("cannot check the artifact repo allowlist: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		logrus.Warnf("rejected the artifact of %s@%s submitted by %s, the repository is not on the allowlist for the user",
+			artifact.Version.RepositoryName, artifact.Version.SHA, user.Login)
+		http.Error(w, fmt.Sprintf("%s - %s may not submit the artifacts of repository %s", http.StatusText(http.StatusForbidden), user.Login, artifact.Version.RepositoryName), http.StatusForbidden)
+		return
+	}
+
+	for _, dependency := range artifact.Dependencies {
+		dependencyArtifact, err := artifactByID(store, dependency)
+		if err != nil {
+			logrus.Errorf("cannot get artifact dependency: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if dependencyArtifact == nil {
+			http.Error(w, fmt.Sprintf("%s - dependency artifact %s not found", http.StatusText(http.StatusBadRequest), dependency), http.StatusBadRequest)
+			return
+		}
+	}
+
+	signingKeys, _ := ctx.Value("signingKeys").([]crypto.PublicKey)
+	artifact.SignatureStatus = dx.VerifyArtifact(&artifact, signingKeys)
+	if artifact.SignatureStatus == dx.SignatureInvalid {
+		logrus.Warnf("artifact of %s@%s has an invalid signature", artifact.Version.RepositoryName, artifact.Version.SHA)
+	}
+
+	// sealed after the signature is verified, as the signature covers the secrets that CI sent
+	envs, _ := ctx.Value("envs").(map[string]*dx.Env)
+	err = dx.SealArtifactSecrets(&artifact, envs)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	artifact.Source = artifactSource(r, &artifact)
+
 	artifact.ID = fmt.Sprintf("%s-%s", artifact.Version.RepositoryName, uuid.New().String())
 	artifact.Created = time.Now().Unix()
 
@@ -28,6 +93,7 @@ func saveArtifact(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(500), 500)
 		return
 	}
+	event.CorrelationID = correlationIDFrom(ctx)
 
 	savedEvent, err := store.CreateEvent(event)
 	if err != nil {
@@ -37,6 +103,32 @@ func saveArtifact(w http.ResponseWriter, r *http.Request) {
 	}
 
 	savedArtifact, err := model.ToArtifact(savedEvent)
+
+	if wait != nil {
+		ingestion, decided, err := waitForDeployDecision(store, savedEvent.ID, *wait)
+		if err != nil {
+			logrus.Errorf("cannot get artifact event: %s", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		ingestion.Artifact = savedArtifact
+
+		ingestionStr, err := json.Marshal(ingestion)
+		if err != nil {
+			logrus.Errorf("cannot serialize artifact ingestion: %s", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+
+		if decided {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		w.Write(ingestionStr)
+		return
+	}
+
 	artifactStr, err := json.Marshal(savedArtifact)
 	if err != nil {
 		logrus.Errorf("cannot serialize artifact: %s", err)
@@ -48,17 +140,75 @@ func saveArtifact(w http.ResponseWriter, r *http.Request) {
 	w.Write(artifactStr)
 }
 
+// maxArtifactWait keeps waiting artifact posts within the request timeout
+const maxArtifactWait = 50 * time.Second
+
+// artifactSource attributes the artifact to the user of the API token and the CI system that submitted it
+func artifactSource(r *http.Request, artifact *dx.Artifact) *dx.ArtifactSource {
+	source := &dx.ArtifactSource{
+		UserAgent: r.UserAgent(),
+		CIURL:     artifact.CIURL(),
+	}
+	if user, ok := r.Context().Value("user").(*model.User); ok {
+		source.SubmittedBy = user.Login
+	}
+	return source
+}
+
+// waitForDeployDecision polls the artifact event until the gitops worker processed it, or the timeout passes.
+// Deploys that are committed and wait for the gitops checks, or are held by a failing sync are decided too
+func waitForDeployDecision(store *store.Store, eventID string, timeout time.Duration) (*dx.ArtifactIngestion, bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		event, err := store.Event(eventID)
+		if err != nil {
+			return nil, false, err
+		}
+
+		decided := event.Status == model.StatusProcessed ||
+			event.Status == model.StatusError ||
+			event.Status == model.StatusParked ||
+			event.Status == model.StatusPartial ||
+			event.Status == model.StatusChecking ||
+			event.Status == model.StatusHeld
+		if decided || time.Now().After(deadline) {
+			triggeredEnvs := event.TriggeredEnvs
+			if triggeredEnvs == nil {
+				triggeredEnvs = []string{}
+			}
+			return &dx.ArtifactIngestion{
+				Status:        event.Status,
+				StatusDesc:    event.StatusDesc,
+				TriggeredEnvs: triggeredEnvs,
+				Envs:          event.EnvStatuses,
+			}, decided, nil
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+const totalCountHeader = "X-Total-Count"
+const nextCursorHeader = "X-Next-Cursor"
+
+// defaultArtifactsLimit is the page size of the artifact list when neither limit, nor offset is set
+const defaultArtifactsLimit = 10
+
+// getArtifacts lists the artifacts newest first. The X-Total-Count header has the number of matching artifacts,
+// and X-Next-Cursor the cursor of the next page, when the page is full
 func getArtifacts(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	store := ctx.Value("store").(*store.Store)
+	store := readStore(ctx)
 
 	var limit, offset int
+	var cursor *model.Cursor
 	var since, until *time.Time
 
 	var repo, branch string
 	var event *dx.GitEvent
 	var sourceBranch string
 	var sha []string
+	var submittedBy string
 
 	params := r.URL.Query()
 	if val, ok := params["limit"]; ok {
@@ -77,6 +227,21 @@ func getArtifacts(w http.ResponseWriter, r *http.Request) {
 		}
 		offset = o
 	}
+	if val, ok := params["cursor"]; ok {
+		if offset != 0 {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+" - cursor and offset cannot be used together", http.StatusBadRequest)
+			return
+		}
+		c, err := model.ParseCursor(val[0])
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursor = c
+	}
+	if limit == 0 && offset == 0 {
+		limit = defaultArtifactsLimit
+	}
 
 	if val, ok := params["since"]; ok {
 		t, err := time.Parse(time.RFC3339, val[0])
@@ -107,9 +272,12 @@ func getArtifacts(w http.ResponseWriter, r *http.Request) {
 	if val, ok := params["sha"]; ok {
 		sha = val
 	}
+	if val, ok := params["submittedBy"]; ok {
+		submittedBy = val[0]
+	}
 	if val, ok := params["event"]; ok {
-		event = dx.PushPtr()
-		err := event.UnmarshalJSON([]byte(`"` + val[0] + `"`))
+		var err error
+		event, err = dx.ParseGitEventPtr(val[0])
 		if err != nil {
 			http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
 			return
@@ -121,12 +289,20 @@ func getArtifacts(w http.ResponseWriter, r *http.Request) {
 		event,
 		sourceBranch,
 		sha,
+		submittedBy,
+		cursor,
 		limit, offset, since, until)
 	if err != nil {
 		logrus.Errorf("cannot get artifacts: %s", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	total, err := store.ArtifactsCount(repo, branch, event, sourceBranch, sha, submittedBy, since, until)
+	if err != nil {
+		logrus.Errorf("cannot count artifacts: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 
 	artifacts := []*dx.Artifact{}
 	for _, a := range events {
@@ -146,6 +322,70 @@ func getArtifacts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set(totalCountHeader, strconv.Itoa(total))
+	if len(events) > 0 && len(events) == limit {
+		last := events[len(events)-1]
+		w.Header().Set(nextCursorHeader, (&model.Cursor{CreatedNano: last.CreatedNano, ID: last.ID}).String())
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write(artifactsStr)
 }
+
+// reevaluateArtifact re-runs the deploy policies of a stored artifact, eg. after the default deploy policies changed.
+// The deploys go to the envs that match now, and the artifact did not deploy to before
+func reevaluateArtifact(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+	artifactID := chi.URLParam(r, "id")
+
+	maintenance, err := store.Maintenance()
+	if err != nil {
+		logrus.Errorf("cannot load maintenance mode: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if maintenance.Enabled {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusServiceUnavailable), maintenanceMessage(maintenance)), http.StatusServiceUnavailable)
+		return
+	}
+
+	artifact, err := store.Artifact(artifactID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - cannot find artifact with id %s", http.StatusText(http.StatusNotFound), artifactID), http.StatusNotFound)
+		return
+	}
+	if artifact.Expired != 0 {
+		http.Error(w, fmt.Sprintf("%s: artifact %s is expired, its images may no longer exist", http.StatusText(http.StatusBadRequest), artifactID), http.StatusBadRequest)
+		return
+	}
+
+	reevaluationRequestStr, err := json.Marshal(dx.ReevaluationRequest{
+		ArtifactID:  artifactID,
+		TriggeredBy: user.Login,
+		Force:       r.URL.Query().Get("force") == "true",
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - cannot serialize reevaluation request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+
+	event, err := store.CreateEvent(&model.Event{
+		Type:          model.TypeReevaluation,
+		Blob:          string(reevaluationRequestStr),
+		Repository:    artifact.Repository,
+		GitopsHashes:  []string{},
+		CorrelationID: correlationIDFrom(ctx),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - cannot save reevaluation request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+
+	eventIDBytes, _ := json.Marshal(map[string]string{
+		"id": event.ID,
+	})
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(eventIDBytes)
+}
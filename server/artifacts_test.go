@@ -2,14 +2,20 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"encoding/json"
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
@@ -43,16 +49,153 @@ func Test_saveArtifact(t *testing.T) {
 	var a dx.Artifact
 	json.Unmarshal([]byte(artifactStr), &a)
 
-	_, body, err := testEndpoint(saveArtifact, func(ctx context.Context) context.Context {
+	_, body, err := testPostEndpoint(saveArtifact, func(ctx context.Context) context.Context {
 		ctx = context.WithValue(ctx, "store", store)
+		ctx = context.WithValue(ctx, "user", &model.User{Login: "ci"})
 		return ctx
-	}, "/path")
+	}, "/path", artifactStr)
 	assert.Nil(t, err)
 
 	var response dx.Artifact
 	err = json.Unmarshal([]byte(body), &response)
 	assert.Nil(t, err)
 	assert.NotEqual(t, response.Created, 0, "should set created time")
+	assert.Equal(t, "ci", response.Source.SubmittedBy, "should attribute the artifact to the token's user")
+	assert.Equal(t, "https://jenkins.example.com/job/dev/84/display/redirect", response.Source.CIURL)
+
+	code, body, err := testEndpoint(getArtifacts, func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return ctx
+	}, "/path?submittedBy=ci")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	var artifacts []*dx.Artifact
+	json.Unmarshal([]byte(body), &artifacts)
+	assert.Equal(t, 1, len(artifacts), "should filter by the submitting user")
+
+	_, body, _ = testEndpoint(getArtifacts, func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return ctx
+	}, "/path?submittedBy=someone-else")
+	json.Unmarshal([]byte(body), &artifacts)
+	assert.Equal(t, 0, len(artifacts))
+}
+
+func Test_saveArtifactSealsSecrets(t *testing.T) {
+	store := store.NewTest()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	assert.Nil(t, err)
+	envs := map[string]*dx.Env{
+		"production": {
+			Name:                     "production",
+			SealedSecretsCertificate: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		},
+	}
+	ctx := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		ctx = context.WithValue(ctx, "envs", envs)
+		return context.WithValue(ctx, "user", &model.User{Login: "ci"})
+	}
+
+	status, body, _ := testPostEndpoint(saveArtifact, ctx, "/path", `{
+  "version": {"repositoryName": "my-app", "sha": "abc"},
+  "environments": [{"app": "my-app", "env": "production", "namespace": "default", "secrets": {"DB_PASSWORD": "hunter2"}}]
+}`)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.NotContains(t, body, "hunter2", "the saved artifact should not be served with plaintext secrets")
+	var response dx.Artifact
+	err = json.Unmarshal([]byte(body), &response)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, response.Environments[0].SealedSecrets["DB_PASSWORD"])
+
+	stored, err := store.Artifact(response.ID)
+	assert.Nil(t, err)
+	assert.NotContains(t, stored.Blob, "hunter2", "plaintext secrets should not be stored")
+
+	_, body, _ = testEndpoint(getArtifacts, ctx, "/path")
+	assert.NotContains(t, body, "hunter2")
+
+	status, _, _ = testPostEndpoint(saveArtifact, ctx, "/path", `{
+  "version": {"repositoryName": "my-app", "sha": "abc"},
+  "environments": [{"app": "my-app", "env": "staging", "namespace": "default", "secrets": {"DB_PASSWORD": "hunter2"}}]
+}`)
+	assert.Equal(t, http.StatusBadRequest, status, "secrets that can't be sealed should be rejected")
+}
+
+func Test_waitForDeployDecision(t *testing.T) {
+	store := store.NewTest()
+
+	event, err := store.CreateEvent(&model.Event{
+		Type:         model.TypeArtifact,
+		Blob:         "{}",
+		Status:       model.StatusNew,
+		GitopsHashes: []string{},
+	})
+	assert.Nil(t, err)
+
+	ingestion, decided, err := waitForDeployDecision(store, event.ID, 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.False(t, decided, "should time out while the event is not processed")
+	assert.Equal(t, model.StatusNew, ingestion.Status)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		store.UpdateEventStatus(event.ID, model.StatusProcessed, "", "[]", `["staging"]`, "[]")
+	}()
+
+	ingestion, decided, err = waitForDeployDecision(store, event.ID, 5*time.Second)
+	assert.Nil(t, err)
+	assert.True(t, decided)
+	assert.Equal(t, []string{"staging"}, ingestion.TriggeredEnvs)
+
+	for _, status := range []string{model.StatusChecking, model.StatusHeld} {
+		err = store.UpdateEventStatus(event.ID, status, "", "[]", `["staging"]`, "[]")
+		assert.Nil(t, err)
+		ingestion, decided, err = waitForDeployDecision(store, event.ID, 5*time.Second)
+		assert.Nil(t, err)
+		assert.True(t, decided, "%s deploys should be decided", status)
+		assert.Equal(t, status, ingestion.Status)
+	}
+}
+
+func Test_saveArtifactInvalidWait(t *testing.T) {
+	store := store.NewTest()
+	ctx := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return context.WithValue(ctx, "user", &model.User{Login: "ci"})
+	}
+
+	status, _, _ := testPostEndpoint(saveArtifact, ctx, "/path?wait=forever", `{"version": {"repositoryName": "my-app", "sha": "abc"}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	count, err := store.ArtifactsCount("my-app", "", nil, "", nil, "", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count, "should not save the artifact of a bad request")
+}
+
+func Test_saveArtifactInvalidEvent(t *testing.T) {
+	store := store.NewTest()
+
+	artifactStr := `
+{
+  "version": {
+    "repositoryName": "my-app",
+    "sha": "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+    "branch": "master",
+    "event": "merge"
+  }
+}
+`
+
+	code, body, err := testPostEndpoint(saveArtifact, func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return ctx
+	}, "/path", artifactStr)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, code, "should reject unknown git events")
+	assert.Contains(t, body, "unknown git event \"merge\"")
 }
 
 
@@ -87,6 +230,102 @@ func Test_getArtifactsLimitOffset(t *testing.T) {
 	assert.Equal(t, "2", response[0].Version.SHA)
 }
 
+func Test_getArtifactsCursor(t *testing.T) {
+	store := store.NewTest()
+	setupArtifacts(store)
+
+	req := httptest.NewRequest("GET", "/path?limit=1", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "store", store))
+	rr := httptest.NewRecorder()
+	getArtifacts(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("X-Total-Count"))
+	cursor := rr.Header().Get("X-Next-Cursor")
+	assert.NotEmpty(t, cursor, "should return the cursor of the next page")
+	var firstPage []*dx.Artifact
+	json.Unmarshal(rr.Body.Bytes(), &firstPage)
+
+	req = httptest.NewRequest("GET", "/path?limit=1&cursor="+cursor, nil)
+	req = req.WithContext(context.WithValue(req.Context(), "store", store))
+	rr = httptest.NewRecorder()
+	getArtifacts(rr, req)
+	var secondPage []*dx.Artifact
+	json.Unmarshal(rr.Body.Bytes(), &secondPage)
+	assert.Equal(t, 1, len(secondPage))
+	assert.Equal(t, "ea9ab7cc31b2599bf4afcfd639da516ca27a4780", firstPage[0].Version.SHA)
+	assert.Equal(t, "2", secondPage[0].Version.SHA)
+
+	code, _, _ := testEndpoint(getArtifacts, func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return ctx
+	}, "/path?offset=1&cursor="+cursor)
+	assert.Equal(t, http.StatusBadRequest, code, "cursor and offset should not be combined")
+}
+
+func Test_reevaluateArtifact(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "admin", Admin: true}
+
+	reevaluate := func(artifactID string, query ...string) *httptest.ResponseRecorder {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", artifactID)
+
+		req := httptest.NewRequest("POST", "/api/artifacts/"+artifactID+"/reevaluate"+strings.Join(query, ""), nil)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, "store", store)
+		ctx = context.WithValue(ctx, "user", user)
+
+		rr := httptest.NewRecorder()
+		reevaluateArtifact(rr, req.WithContext(ctx))
+		return rr
+	}
+
+	rr := reevaluate("my-app-1")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	artifactEvent, _ := model.ToEvent(dx.Artifact{ID: "my-app-1", Version: dx.Version{RepositoryName: "my-app"}})
+	artifactEvent, err := store.CreateEvent(artifactEvent)
+	assert.Nil(t, err)
+	err = store.UpdateEventStatus(artifactEvent.ID, model.StatusProcessed, "", "[]", "[]", "[]")
+	assert.Nil(t, err)
+
+	rr = reevaluate("my-app-1")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	events, err := store.UnprocessedEvents()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, model.TypeReevaluation, events[0].Type)
+	assert.Equal(t, "my-app", events[0].Repository)
+	var reevaluationRequest dx.ReevaluationRequest
+	json.Unmarshal([]byte(events[0].Blob), &reevaluationRequest)
+	assert.Equal(t, "my-app-1", reevaluationRequest.ArtifactID)
+	assert.Equal(t, "admin", reevaluationRequest.TriggeredBy)
+	assert.False(t, reevaluationRequest.Force)
+
+	rr = reevaluate("my-app-1", "?force=true")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	events, err = store.UnprocessedEvents()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(events))
+	json.Unmarshal([]byte(events[1].Blob), &reevaluationRequest)
+	assert.True(t, reevaluationRequest.Force, "should pass the force flag to the worker")
+}
+
+func Test_getArtifactsReadStore(t *testing.T) {
+	primary := store.NewTest()
+	replica := store.NewTest()
+	setupArtifacts(replica)
+
+	_, body, _ := testEndpoint(getArtifacts, func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", primary)
+		ctx = context.WithValue(ctx, "readStore", replica)
+		return ctx
+	}, "/path")
+	var artifacts []*dx.Artifact
+	json.Unmarshal([]byte(body), &artifacts)
+	assert.Equal(t, 2, len(artifacts), "should list the artifacts from the read store")
+}
+
 func Test_getArtifactsBranch(t *testing.T) {
 	store := store.NewTest()
 	setupArtifacts(store)
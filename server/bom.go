@@ -0,0 +1,131 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+func getBOM(w http.ResponseWriter, r *http.Request) {
+	var env string
+
+	params := r.URL.Query()
+	if val, ok := params["env"]; ok {
+		env = val[0]
+	} else {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "env parameter is mandatory"), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
+	perf := ctx.Value("perf").(*prometheus.HistogramVec)
+
+	repo, releaseRepo := gitopsRepoCache.EnvInstanceForRead(env)
+	appReleases, err := nativeGit.Status(repo, "", env, perf)
+	releaseRepo()
+	if err != nil {
+		logrus.Errorf("cannot get status: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	bom, err := billOfMaterials(store, env, appReleases)
+	if err != nil {
+		logrus.Errorf("cannot resolve bill of materials: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	bomString, err := json.Marshal(bom)
+	if err != nil {
+		logrus.Errorf("cannot serialize bill of materials: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(bomString)
+}
+
+// billOfMaterials resolves the artifacts deployed in an env and all their transitive dependencies
+func billOfMaterials(store *store.Store, env string, appReleases map[string]*dx.Release) (*dx.BillOfMaterials, error) {
+	bom := &dx.BillOfMaterials{
+		Env:   env,
+		Items: []*dx.BOMItem{},
+	}
+
+	var apps []string
+	for app := range appReleases {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	visited := map[string]bool{}
+	var queue []*dx.BOMItem
+	for _, app := range apps {
+		release := appReleases[app]
+		if release == nil || release.ArtifactID == "" {
+			continue
+		}
+		if visited[release.ArtifactID] {
+			continue
+		}
+		visited[release.ArtifactID] = true
+		queue = append(queue, &dx.BOMItem{
+			ArtifactID: release.ArtifactID,
+			App:        app,
+		})
+	}
+
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+
+		artifact, err := artifactByID(store, item.ArtifactID)
+		if err != nil {
+			return nil, err
+		}
+		bom.Items = append(bom.Items, item)
+		if artifact == nil {
+			item.Missing = true
+			continue
+		}
+
+		item.Version = &artifact.Version
+		item.Dependencies = artifact.Dependencies
+		for _, dependency := range artifact.Dependencies {
+			if visited[dependency] {
+				continue
+			}
+			visited[dependency] = true
+			queue = append(queue, &dx.BOMItem{
+				ArtifactID: dependency,
+			})
+		}
+	}
+
+	return bom, nil
+}
+
+// artifactByID returns the artifact with the given id, nil if it doesn't exist
+func artifactByID(store *store.Store, id string) (*dx.Artifact, error) {
+	event, err := store.Artifact(id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return model.ToArtifact(event)
+}
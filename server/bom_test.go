@@ -0,0 +1,44 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_billOfMaterials(t *testing.T) {
+	store := store.NewTest()
+
+	for _, a := range []dx.Artifact{
+		{ID: "backend-1", Version: dx.Version{RepositoryName: "backend", SHA: "b1"}, Dependencies: []string{"lib-1"}},
+		{ID: "lib-1", Version: dx.Version{RepositoryName: "lib", SHA: "l1"}, Dependencies: []string{"backend-1"}},
+		{ID: "frontend-1", Version: dx.Version{RepositoryName: "frontend", SHA: "f1"}, Dependencies: []string{"backend-1", "gone-1"}},
+	} {
+		event, err := model.ToEvent(a)
+		assert.Nil(t, err)
+		_, err = store.CreateEvent(event)
+		assert.Nil(t, err)
+	}
+
+	bom, err := billOfMaterials(store, "staging", map[string]*dx.Release{
+		"frontend": {ArtifactID: "frontend-1"},
+		"backend":  {ArtifactID: "backend-1"},
+		"manual":   nil,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "staging", bom.Env)
+	assert.Equal(t, 4, len(bom.Items), "should resolve transitive dependencies once")
+
+	items := map[string]*dx.BOMItem{}
+	for _, item := range bom.Items {
+		items[item.ArtifactID] = item
+	}
+	assert.Equal(t, "backend", items["backend-1"].App)
+	assert.Equal(t, "frontend", items["frontend-1"].App)
+	assert.Equal(t, "", items["lib-1"].App, "should not set app on dependencies that are not deployed")
+	assert.Equal(t, "l1", items["lib-1"].Version.SHA)
+	assert.True(t, items["gone-1"].Missing)
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// mustClientCert only lets requests through with a client certificate that the TLS handshake verified against the client CA.
+// The listener asks for client certificates, but doesn't require them, so the webhooks of third parties keep working
+func mustClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			logrus.Warnf("request from %s to %s has no verified client certificate", r.RemoteAddr, r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusUnauthorized)+" - client certificate required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
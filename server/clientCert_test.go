@@ -0,0 +1,58 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_mustClientCert(t *testing.T) {
+	handler := mustClientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for name, test := range map[string]struct {
+		tls      *tls.ConnectionState
+		expected int
+	}{
+		"plain http":           {nil, http.StatusUnauthorized},
+		"no client cert":       {&tls.ConnectionState{}, http.StatusUnauthorized},
+		"verified client cert": {&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}, http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/api/artifacts", nil)
+		req.TLS = test.tls
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, test.expected, rr.Code, name)
+	}
+}
+
+func Test_clientCertOnlyOnAPIRoutes(t *testing.T) {
+	router := SetupRouter(&config.Config{TLS: config.TLS{ClientCAPath: "ca.pem"}}, store.NewTest(), nil, nil, nil)
+
+	for path, expected := range map[string]int{
+		"/api/artifacts": http.StatusUnauthorized,
+		"/api/users":     http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.TLS = &tls.ConnectionState{}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, expected, rr.Code, path)
+		assert.Contains(t, rr.Body.String(), "client certificate required", path)
+	}
+
+	for _, path := range []string{"/hook/release", "/hook/registry/dockerhub", "/api/gitops-webhook"} {
+		req := httptest.NewRequest("POST", path, nil)
+		req.TLS = &tls.ConnectionState{}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.NotContains(t, rr.Body.String(), "client certificate required", "third party webhooks should not need a client certificate: %s", path)
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+const correlationIDHeader = "X-Correlation-ID"
+
+var validCorrelationID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// correlationID takes the correlation ID of the request from the X-Correlation-ID header, or generates one.
+// Events created by the request carry the ID, and it is returned in the response header
+func correlationID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(correlationIDHeader)
+		if !validCorrelationID.MatchString(id) {
+			id = uuid.New().String()
+		}
+
+		w.Header().Set(correlationIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "correlationID", id)))
+	})
+}
+
+// correlationIDFrom returns the correlation ID of the request, empty if none is set
+func correlationIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value("correlationID").(string)
+	return id
+}
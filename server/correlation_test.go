@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_correlationID(t *testing.T) {
+	var fromContext string
+	handler := correlationID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromContext = correlationIDFrom(r.Context())
+	}))
+
+	req := httptest.NewRequest("POST", "/api/releases", nil)
+	req.Header.Set(correlationIDHeader, "ci-run-1234")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, "ci-run-1234", fromContext)
+	assert.Equal(t, "ci-run-1234", rr.Header().Get(correlationIDHeader))
+
+	req = httptest.NewRequest("POST", "/api/releases", nil)
+	req.Header.Set(correlationIDHeader, "not valid\n")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.NotEqual(t, "not valid\n", fromContext)
+	assert.NotEmpty(t, fromContext, "should generate an id")
+	assert.Equal(t, fromContext, rr.Header().Get(correlationIDHeader))
+}
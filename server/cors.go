@@ -0,0 +1,36 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/go-chi/cors"
+)
+
+// corsOptions allows the configured origins to call the API from the browser.
+// Without configured origins, the dashboard served on the host and the local dashboard are allowed
+func corsOptions(c config.CORS, host string) cors.Options {
+	origins := commaSeparated(c.AllowedOrigins)
+	if len(origins) == 0 {
+		origins = []string{"http://localhost:8888", host}
+	}
+
+	return cors.Options{
+		AllowedOrigins:   origins,
+		AllowedMethods:   []string{"GET", "POST", "DELETE", "OPTIONS"},
+		AllowedHeaders:   append([]string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", correlationIDHeader}, commaSeparated(c.AllowedHeaders)...),
+		ExposedHeaders:   []string{"Link", totalCountHeader, nextCursorHeader, correlationIDHeader},
+		AllowCredentials: c.AllowCredentials != "false",
+		MaxAge:           300,
+	}
+}
+
+func commaSeparated(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// DeployKeyUploader registers the deploy keys of the gitops repo through the SCM API
+type DeployKeyUploader interface {
+	Add(title string, publicKey string) error
+	Remove(publicKey string) (bool, error)
+}
+
+var deployKeyUploader DeployKeyUploader
+
+// SetDeployKeyUploader makes deploy key rotations register the new key, and remove the old one on the gitops repo.
+// Without an uploader, the new key is added by hand, and the rotation is activated with a second call
+func SetDeployKeyUploader(uploader DeployKeyUploader) {
+	deployKeyUploader = uploader
+}
+
+var deployKeyRotationLock sync.Mutex
+
+// rotateDeployKey generates a new deploy key, and switches to it if it could be registered on the gitops repo.
+// Otherwise the rotation is pending, until the public key is added to the repo and the rotation is activated
+func rotateDeployKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+	gitopsRepo := ctx.Value("gitopsRepo").(string)
+	keyPath := ctx.Value("gitopsRepoDeployKeyPath").(string)
+
+	if gitopsRepo == "" || keyPath == "" {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "the gitops repo is not configured"), http.StatusBadRequest)
+		return
+	}
+
+	deployKeyRotationLock.Lock()
+	defer deployKeyRotationLock.Unlock()
+
+	privatePEM, publicKey, err := nativeGit.GenerateDeployKey()
+	if err != nil {
+		logrus.Errorf("cannot generate deploy key: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	err = nativeGit.WritePendingDeployKey(keyPath, privatePEM)
+	if err != nil {
+		logrus.Errorf("cannot write deploy key: %s", err)
+		http.Error(w, fmt.Sprintf("%s - cannot write the new key next to %s: %s", http.StatusText(http.StatusInternalServerError), keyPath, err), http.StatusInternalServerError)
+		return
+	}
+	_, fingerprint, err := nativeGit.DeployPublicKey(keyPath + nativeGit.PendingDeployKeySuffix)
+	if err != nil {
+		logrus.Errorf("cannot read deploy key: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	rotation := &model.DeployKeyRotation{
+		Fingerprint: fingerprint,
+		PublicKey:   publicKey,
+		Status:      model.DeployKeyPending,
+		RotatedBy:   user.Login,
+		Created:     time.Now().Unix(),
+	}
+	logrus.Infof("new deploy key %s generated by %s: %s", fingerprint, user.Login, publicKey)
+
+	if deployKeyUploader != nil {
+		err = deployKeyUploader.Add(fmt.Sprintf("gimletd %s", time.Now().Format("2006-01-02")), publicKey)
+		if err != nil {
+			logrus.Warnf("could not register the new deploy key, it must be added by hand: %s", err)
+		} else {
+			rotation.Uploaded = true
+			err = activate(gitopsRepo, keyPath, rotation)
+			if err != nil {
+				logrus.Warnf("could not activate the new deploy key: %s", err)
+			}
+		}
+	}
+
+	respondWithRotation(w, store, rotation)
+}
+
+// activateDeployKey switches to the pending deploy key, once its public key is added to the gitops repo
+func activateDeployKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+	gitopsRepo := ctx.Value("gitopsRepo").(string)
+	keyPath := ctx.Value("gitopsRepoDeployKeyPath").(string)
+
+	deployKeyRotationLock.Lock()
+	defer deployKeyRotationLock.Unlock()
+
+	publicKey, fingerprint, err := nativeGit.DeployPublicKey(keyPath + nativeGit.PendingDeployKeySuffix)
+	if os.IsNotExist(err) {
+		http.Error(w, fmt.Sprintf("%s - %s", http.StatusText(http.StatusNotFound), "there is no pending deploy key rotation"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Errorf("cannot read deploy key: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	rotation := &model.DeployKeyRotation{
+		Fingerprint: fingerprint,
+		PublicKey:   publicKey,
+		Status:      model.DeployKeyPending,
+		RotatedBy:   user.Login,
+		Created:     time.Now().Unix(),
+	}
+	err = activate(gitopsRepo, keyPath, rotation)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+		return
+	}
+
+	respondWithRotation(w, store, rotation)
+}
+
+// activate checks that the pending key can access the gitops repo, then switches the repo cache and the workers to it.
+// The key is read from the file on every git operation, so renaming it over the old one switches all of them at once
+func activate(gitopsRepo string, keyPath string, rotation *model.DeployKeyRotation) error {
+	probe := func() error {
+		return nativeGit.ProbeRemote(gitopsRepo, keyPath+nativeGit.PendingDeployKeySuffix)
+	}
+	err := backoff.Retry(probe, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 5)) // the SCM may take a moment to accept a new key
+	if err != nil {
+		return fmt.Errorf("the new deploy key cannot access %s: %s", gitopsRepo, err)
+	}
+
+	previousPublicKey, previousFingerprint, err := nativeGit.DeployPublicKey(keyPath)
+	if err != nil {
+		logrus.Warnf("cannot read the previous deploy key: %s", err)
+	}
+	err = nativeGit.ActivateDeployKey(keyPath)
+	if err != nil {
+		return fmt.Errorf("cannot switch to the new deploy key: %s", err)
+	}
+	rotation.Status = model.DeployKeyActive
+	rotation.PreviousFingerprint = previousFingerprint
+	logrus.Infof("deploy key rotated from %s to %s by %s", previousFingerprint, rotation.Fingerprint, rotation.RotatedBy)
+
+	if deployKeyUploader != nil && previousPublicKey != "" {
+		removed, err := deployKeyUploader.Remove(previousPublicKey)
+		if err != nil {
+			logrus.Warnf("could not remove the previous deploy key %s, it must be removed by hand: %s", previousFingerprint, err)
+		}
+		rotation.PreviousKeyRemoved = removed
+	}
+	return nil
+}
+
+// respondWithRotation records the rotation in the audit log and writes it to the response,
+// with 202 if the rotation is pending
+func respondWithRotation(w http.ResponseWriter, store *store.Store, rotation *model.DeployKeyRotation) {
+	err := store.RecordDeployKeyRotation(rotation)
+	if err != nil {
+		logrus.Errorf("cannot record deploy key rotation: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	rotationString, err := json.Marshal(rotation)
+	if err != nil {
+		logrus.Errorf("cannot serialize deploy key rotation: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	if rotation.Status == model.DeployKeyPending {
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.Write(rotationString)
+}
+
+func getDeployKeyRotations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	rotations, err := store.DeployKeyRotations()
+	if err != nil {
+		logrus.Errorf("cannot get deploy key rotations: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	rotationsString, err := json.Marshal(rotations)
+	if err != nil {
+		logrus.Errorf("cannot serialize deploy key rotations: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(rotationsString)
+}
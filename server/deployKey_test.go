@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_rotateDeployKey(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "deploy-key-")
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "deploy.key")
+
+	store := store.NewTest()
+	user := &model.User{Login: "admin", Admin: true}
+	ctx := func(gitopsRepo string) func(ctx context.Context) context.Context {
+		return func(ctx context.Context) context.Context {
+			ctx = context.WithValue(ctx, "store", store)
+			ctx = context.WithValue(ctx, "user", user)
+			ctx = context.WithValue(ctx, "gitopsRepo", gitopsRepo)
+			return context.WithValue(ctx, "gitopsRepoDeployKeyPath", keyPath)
+		}
+	}
+
+	status, _, _ := testPostEndpoint(rotateDeployKey, ctx(""), "/api/deployKey/rotate", "")
+	assert.Equal(t, http.StatusBadRequest, status, "should not rotate without a gitops repo")
+
+	status, _, _ = testPostEndpoint(activateDeployKey, ctx("gimlet-io/gitops"), "/api/deployKey/activate", "")
+	assert.Equal(t, http.StatusNotFound, status, "should not activate without a pending rotation")
+
+	status, body, _ := testPostEndpoint(rotateDeployKey, ctx("gimlet-io/gitops"), "/api/deployKey/rotate", "")
+	assert.Equal(t, http.StatusAccepted, status, "should leave the rotation pending without an SCM uploader")
+	var rotation model.DeployKeyRotation
+	assert.Nil(t, json.Unmarshal([]byte(body), &rotation))
+	assert.Equal(t, model.DeployKeyPending, rotation.Status)
+	assert.Equal(t, "admin", rotation.RotatedBy)
+
+	publicKey, fingerprint, err := nativeGit.DeployPublicKey(keyPath + nativeGit.PendingDeployKeySuffix)
+	assert.Nil(t, err)
+	assert.Equal(t, rotation.PublicKey, publicKey, "should return the public key to add to the gitops repo")
+	assert.Equal(t, rotation.Fingerprint, fingerprint)
+
+	rotations, err := store.DeployKeyRotations()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rotations), "should record the rotation in the audit log")
+}
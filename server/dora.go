@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dora"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultDoraWindow is the time window of the DORA metrics if since is not set
+const defaultDoraWindow = 30 * 24 * time.Hour
+
+func getDoraMetrics(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	until := time.Now()
+	if val, ok := params["until"]; ok {
+		t, err := time.Parse(time.RFC3339, val[0])
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		until = t
+	}
+	since := until.Add(-defaultDoraWindow)
+	if val, ok := params["since"]; ok {
+		t, err := time.Parse(time.RFC3339, val[0])
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	if !since.Before(until) {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+" - since must be before until", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	metrics, err := dora.Compute(store, since, until)
+	if err != nil {
+		logrus.Errorf("cannot compute dora metrics: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	metricsStr, err := json.Marshal(metrics)
+	if err != nil {
+		logrus.Errorf("cannot serialize dora metrics: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(metricsStr)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gimlet-io/gimletd/drift"
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+func getDrift(w http.ResponseWriter, r *http.Request) {
+	var app string
+	var envs []string
+
+	params := r.URL.Query()
+	if val, ok := params["app"]; ok {
+		app = val[0]
+	} else {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "app parameter is mandatory"), http.StatusBadRequest)
+		return
+	}
+	if val, ok := params["envs"]; ok {
+		envs = strings.Split(val[0], ",")
+	}
+
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
+	envRegistry := ctx.Value("envs").(map[string]*dx.Env)
+	perf := ctx.Value("perf").(*prometheus.HistogramVec)
+
+	if len(envs) == 0 {
+		var err error
+		envs, err = gitopsRepoCache.Envs()
+		if err != nil {
+			logrus.Errorf("cannot get envs: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	releases, err := drift.Releases(gitopsRepoCache, envs, perf)
+	if err != nil {
+		logrus.Errorf("cannot get releases: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	appReleases, ok := releases[app]
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s - app %s is not deployed in %s", http.StatusText(http.StatusNotFound), app, strings.Join(envs, ",")), http.StatusNotFound)
+		return
+	}
+	for _, env := range envs {
+		if _, ok := appReleases[env]; !ok {
+			appReleases[env] = nil // reported as missing
+		}
+	}
+
+	report, err := drift.Detect(store, envRegistry, app, appReleases)
+	if err != nil {
+		logrus.Errorf("cannot detect drift: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	reportString, err := json.Marshal(report)
+	if err != nil {
+		logrus.Errorf("cannot serialize drift report: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(reportString)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+// recordEnvSync tracks the failing Flux syncs of the envs.
+// A failure marks the env failing, a successful reconciliation clears it, together with its override
+func recordEnvSync(store *store.Store, env string, gitopsCommit *model.GitopsCommit) error {
+	syncs, err := store.FailingEnvSyncs()
+	if err != nil {
+		return err
+	}
+
+	switch gitopsCommit.Status {
+	case model.ValidationFailed, model.ReconciliationFailed, model.HealthCheckFailed:
+		if sync := dx.FailingSync(syncs, env); sync != nil {
+			// the override stays until the sync recovers, so the fixes that are released on top don't get held
+			sync.Sha = gitopsCommit.Sha
+			sync.Reason = gitopsCommit.Status
+			sync.Message = gitopsCommit.StatusDesc
+		} else {
+			syncs = append(syncs, &dx.EnvSync{
+				Env:     env,
+				Sha:     gitopsCommit.Sha,
+				Reason:  gitopsCommit.Status,
+				Message: gitopsCommit.StatusDesc,
+				Since:   gitopsCommit.Created,
+			})
+			logrus.Infof("sync of %s is failing: %s", env, gitopsCommit.StatusDesc)
+		}
+	case model.ReconciliationSucceeded:
+		if dx.FailingSync(syncs, env) == nil {
+			return nil
+		}
+		remaining := []*dx.EnvSync{}
+		for _, sync := range syncs {
+			if sync.Env != env {
+				remaining = append(remaining, sync)
+			}
+		}
+		syncs = remaining
+		logrus.Infof("sync of %s recovered", env)
+	default:
+		return nil
+	}
+
+	return store.SaveFailingEnvSyncs(syncs)
+}
+
+// getEnvSyncs lists the envs whose Flux sync is failing
+func getEnvSyncs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	syncs, err := store.FailingEnvSyncs()
+	if err != nil {
+		logrus.Errorf("cannot load env syncs: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	syncsBytes, _ := json.Marshal(syncs)
+	w.WriteHeader(http.StatusOK)
+	w.Write(syncsBytes)
+}
+
+// overrideEnvSync lets the auto-deploys to an env through while its sync is failing, until the sync recovers
+func overrideEnvSync(w http.ResponseWriter, r *http.Request) {
+	setEnvSyncOverride(w, r, true)
+}
+
+// deleteEnvSyncOverride holds the auto-deploys to an env with a failing sync again
+func deleteEnvSyncOverride(w http.ResponseWriter, r *http.Request) {
+	setEnvSyncOverride(w, r, false)
+}
+
+func setEnvSyncOverride(w http.ResponseWriter, r *http.Request, override bool) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+	env := chi.URLParam(r, "env")
+
+	syncs, err := store.FailingEnvSyncs()
+	if err != nil {
+		logrus.Errorf("cannot load env syncs: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	sync := dx.FailingSync(syncs, env)
+	if sync == nil {
+		http.Error(w, fmt.Sprintf("%s: the sync of %s is not failing", http.StatusText(http.StatusNotFound), env), http.StatusNotFound)
+		return
+	}
+
+	if override {
+		sync.OverriddenBy = user.Login
+	} else {
+		sync.OverriddenBy = ""
+	}
+	err = store.SaveFailingEnvSyncs(syncs)
+	if err != nil {
+		logrus.Errorf("cannot save env syncs: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("sync hold of %s overridden: %t, by %s", env, override, user.Login)
+
+	syncBytes, _ := json.Marshal(sync)
+	w.WriteHeader(http.StatusOK)
+	w.Write(syncBytes)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_envSync(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "admin", Admin: true}
+	ctx := func(ctx context.Context) context.Context {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("env", "production")
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, "store", store)
+		return context.WithValue(ctx, "user", user)
+	}
+
+	status, _, _ := testPostEndpoint(overrideEnvSync, ctx, "/api/envSync/production/override", "")
+	assert.Equal(t, http.StatusNotFound, status, "should not override a healthy sync")
+
+	err := recordEnvSync(store, "production", &model.GitopsCommit{Sha: "abc", Status: model.HealthCheckFailed, StatusDesc: "timeout", Created: 1})
+	assert.Nil(t, err)
+	err = recordEnvSync(store, "production", &model.GitopsCommit{Sha: "def", Status: model.Progressing})
+	assert.Nil(t, err)
+
+	_, body, _ := testEndpoint(getEnvSyncs, ctx, "/api/envSync")
+	var syncs []*dx.EnvSync
+	err = json.Unmarshal([]byte(body), &syncs)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(syncs))
+	assert.Equal(t, "abc", syncs[0].Sha, "progressing syncs should not change the failure")
+
+	status, body, _ = testPostEndpoint(overrideEnvSync, ctx, "/api/envSync/production/override", "")
+	assert.Equal(t, http.StatusOK, status)
+	var sync dx.EnvSync
+	err = json.Unmarshal([]byte(body), &sync)
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", sync.OverriddenBy)
+
+	err = recordEnvSync(store, "production", &model.GitopsCommit{Sha: "def", Status: model.ReconciliationFailed, Created: 2})
+	assert.Nil(t, err)
+	syncs, _ = store.FailingEnvSyncs()
+	assert.Equal(t, "def", syncs[0].Sha)
+	assert.Equal(t, int64(1), syncs[0].Since)
+	assert.Equal(t, "admin", syncs[0].OverriddenBy, "the override should stay until the sync recovers")
+
+	err = recordEnvSync(store, "production", &model.GitopsCommit{Sha: "ghi", Status: model.ReconciliationSucceeded})
+	assert.Nil(t, err)
+	syncs, _ = store.FailingEnvSyncs()
+	assert.Equal(t, 0, len(syncs))
+}
@@ -56,6 +56,13 @@ func fluxEvent(w http.ResponseWriter, r *http.Request) {
 		log.Errorf("could not save or update gitops commit: %s", err)
 	}
 
+	if env != "" && gitopsCommit != nil {
+		err = recordEnvSync(store, env, gitopsCommit)
+		if err != nil {
+			log.Errorf("could not record the sync state of %s: %s", env, err)
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(""))
 }
@@ -72,6 +79,7 @@ func asGitopsCommit(event events.Event) (*model.GitopsCommit, error) {
 		Sha:        sha,
 		Status:     event.Reason,
 		StatusDesc: statusDesc,
+		Created:    event.Timestamp.Unix(),
 	}, nil
 }
 
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+// getFreezes lists the frozen apps
+func getFreezes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	freezes, err := store.Freezes()
+	if err != nil {
+		logrus.Errorf("cannot load freezes: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	freezesBytes, _ := json.Marshal(freezes)
+	w.WriteHeader(http.StatusOK)
+	w.Write(freezesBytes)
+}
+
+// freeze freezes the releases of an app in an env, the worker parks its deploys until it is unfrozen
+func freeze(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+	env := chi.URLParam(r, "env")
+	app := chi.URLParam(r, "app")
+
+	freezes, err := store.Freezes()
+	if err != nil {
+		logrus.Errorf("cannot load freezes: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	for _, f := range freezes {
+		if f.Env == env && f.App == app {
+			http.Error(w, fmt.Sprintf("%s: %s is already frozen in %s by %s", http.StatusText(http.StatusConflict), app, env, f.FrozenBy), http.StatusConflict)
+			return
+		}
+	}
+
+	f := &dx.Freeze{
+		Env:      env,
+		App:      app,
+		Reason:   r.URL.Query().Get("reason"),
+		FrozenBy: user.Login,
+		Since:    time.Now().Unix(),
+	}
+	err = store.SaveFreezes(append(freezes, f))
+	if err != nil {
+		logrus.Errorf("cannot save freezes: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("%s in %s frozen by %s", app, env, user.Login)
+
+	freezeBytes, _ := json.Marshal(f)
+	w.WriteHeader(http.StatusOK)
+	w.Write(freezeBytes)
+}
+
+// unfreeze lifts the release freeze of an app in an env. Deploys parked during the freeze are not released
+func unfreeze(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+	env := chi.URLParam(r, "env")
+	app := chi.URLParam(r, "app")
+
+	freezes, err := store.Freezes()
+	if err != nil {
+		logrus.Errorf("cannot load freezes: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	remaining := []*dx.Freeze{}
+	for _, f := range freezes {
+		if f.Env != env || f.App != app {
+			remaining = append(remaining, f)
+		}
+	}
+	if len(remaining) == len(freezes) {
+		http.Error(w, fmt.Sprintf("%s: %s is not frozen in %s", http.StatusText(http.StatusNotFound), app, env), http.StatusNotFound)
+		return
+	}
+
+	err = store.SaveFreezes(remaining)
+	if err != nil {
+		logrus.Errorf("cannot save freezes: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("%s in %s unfrozen by %s", app, env, user.Login)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_freeze(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "laszlo"}
+	ctx := func(ctx context.Context) context.Context {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("env", "production")
+		rctx.URLParams.Add("app", "my-app")
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, "store", store)
+		return context.WithValue(ctx, "user", user)
+	}
+
+	status, body, _ := testPostEndpoint(freeze, ctx, "/api/freeze/production/my-app?reason=black+friday", "")
+	assert.Equal(t, http.StatusOK, status)
+	var f dx.Freeze
+	err := json.Unmarshal([]byte(body), &f)
+	assert.Nil(t, err)
+	assert.Equal(t, "laszlo", f.FrozenBy)
+	assert.Equal(t, "black friday", f.Reason)
+
+	status, _, _ = testPostEndpoint(freeze, ctx, "/api/freeze/production/my-app", "")
+	assert.Equal(t, http.StatusConflict, status, "should not freeze twice")
+
+	_, body, _ = testEndpoint(getFreezes, ctx, "/api/freeze")
+	var freezes []*dx.Freeze
+	err = json.Unmarshal([]byte(body), &freezes)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(freezes))
+	assert.NotNil(t, dx.Frozen(freezes, "production", "my-app-pr-1", "my-app"), "variants should be frozen with their app")
+
+	unfreezeApp := func() int {
+		req := httptest.NewRequest("DELETE", "/api/freeze/production/my-app", nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(unfreeze).ServeHTTP(rr, req.WithContext(ctx(req.Context())))
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusOK, unfreezeApp())
+	assert.Equal(t, http.StatusNotFound, unfreezeApp())
+
+	freezes, _ = store.Freezes()
+	assert.Empty(t, freezes)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+type GitopsRepoResult struct {
+	GitopsRepo string `json:"gitopsRepo"`
+	// HistoryRewrite is set when the gitops repo history was rewritten, eg. force pushed, until an admin acknowledges it
+	HistoryRewrite *dx.GitopsHistoryRewrite `json:"historyRewrite,omitempty"`
+}
+
+func getGitopsRepo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	gitopsRepo := ctx.Value("gitopsRepo").(string)
+	store := ctx.Value("store").(*store.Store)
+
+	rewrite, err := store.GitopsHistoryRewrite()
+	if err != nil {
+		logrus.Errorf("cannot load gitops history rewrite: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	gitopsRepoJson, _ := json.Marshal(GitopsRepoResult{
+		GitopsRepo:     gitopsRepo,
+		HistoryRewrite: rewrite,
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(gitopsRepoJson)
+}
+
+// acknowledgeHistoryRewrite clears the history rewrite warning, once the gitops repo is checked
+func acknowledgeHistoryRewrite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+
+	err := store.SaveGitopsHistoryRewrite(nil)
+	if err != nil {
+		logrus.Errorf("cannot acknowledge gitops history rewrite: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("gitops history rewrite acknowledged by %s", user.Login)
+
+	w.WriteHeader(http.StatusNoContent)
+}
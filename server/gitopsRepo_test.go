@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_gitopsHistoryRewrite(t *testing.T) {
+	store := store.NewTest()
+	get := func() *GitopsRepoResult {
+		req := httptest.NewRequest("GET", "/api/gitopsRepo", nil)
+		ctx := context.WithValue(req.Context(), "store", store)
+		ctx = context.WithValue(ctx, "gitopsRepo", "my/gitops")
+		rr := httptest.NewRecorder()
+		getGitopsRepo(rr, req.WithContext(ctx))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var result GitopsRepoResult
+		err := json.Unmarshal(rr.Body.Bytes(), &result)
+		assert.Nil(t, err)
+		return &result
+	}
+
+	assert.Equal(t, "my/gitops", get().GitopsRepo)
+	assert.Nil(t, get().HistoryRewrite)
+
+	err := store.SaveGitopsHistoryRewrite(&dx.GitopsHistoryRewrite{OldHead: "abc", NewHead: "def", Detected: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "def", get().HistoryRewrite.NewHead, "the rewrite should be surfaced until acknowledged")
+
+	req := httptest.NewRequest("DELETE", "/api/gitopsRepo/historyRewrite", nil)
+	ctx := context.WithValue(req.Context(), "store", store)
+	ctx = context.WithValue(ctx, "user", &model.User{Login: "admin", Admin: true})
+	rr := httptest.NewRecorder()
+	acknowledgeHistoryRewrite(rr, req.WithContext(ctx))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Nil(t, get().HistoryRewrite)
+}
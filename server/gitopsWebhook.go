@@ -0,0 +1,56 @@
+package server
+
+import (
+	"crypto/hmac"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/hooks"
+	"github.com/sirupsen/logrus"
+)
+
+// gitopsRepoWebhook receives the push webhooks of the gitops repo and refreshes the repo cache,
+// so reads see new commits without waiting for the refresh interval
+func gitopsRepoWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
+	secret := ctx.Value("gitopsRepoWebhookSecret").(string)
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logrus.Errorf("cannot read webhook payload: %s", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if !validWebhook(r, body, secret) {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusUnauthorized), "invalid webhook signature"), http.StatusUnauthorized)
+		return
+	}
+
+	gitopsRepoCache.RequestRefresh()
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("{}"))
+}
+
+// validWebhook checks the Github/Gitea style HMAC signature, or the Gitlab style token of the webhook
+func validWebhook(r *http.Request, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+
+	if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+		return hmac.Equal([]byte(signature), []byte(hooks.Signature(secret, body)))
+	}
+	if signature := r.Header.Get("X-Gitea-Signature"); signature != "" {
+		return hmac.Equal([]byte("sha256="+signature), []byte(hooks.Signature(secret, body)))
+	}
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		return hmac.Equal([]byte(token), []byte(secret))
+	}
+
+	return false
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/hooks"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validWebhook(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+
+	r := httptest.NewRequest("POST", "/api/gitops-webhook", strings.NewReader(string(body)))
+	r.Header.Set("X-Hub-Signature-256", hooks.Signature("secret", body))
+	assert.True(t, validWebhook(r, body, "secret"))
+	assert.False(t, validWebhook(r, body, "other-secret"))
+	assert.False(t, validWebhook(r, body, ""), "webhooks should be rejected without a configured secret")
+
+	r = httptest.NewRequest("POST", "/api/gitops-webhook", strings.NewReader(string(body)))
+	r.Header.Set("X-Gitlab-Token", "secret")
+	assert.True(t, validWebhook(r, body, "secret"))
+
+	r = httptest.NewRequest("POST", "/api/gitops-webhook", strings.NewReader(string(body)))
+	assert.False(t, validWebhook(r, body, "secret"), "unsigned webhooks should be rejected")
+}
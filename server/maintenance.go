@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+func getMaintenance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	maintenance, err := store.Maintenance()
+	if err != nil {
+		logrus.Errorf("cannot load maintenance mode: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	maintenanceBytes, _ := json.Marshal(maintenance)
+	w.WriteHeader(http.StatusOK)
+	w.Write(maintenanceBytes)
+}
+
+func maintenance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+
+	params := r.URL.Query()
+	var enabled bool
+	if val, ok := params["mode"]; ok {
+		switch val[0] {
+		case "on":
+			enabled = true
+		case "off":
+			enabled = false
+		default:
+			http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "mode parameter must be on or off"), http.StatusBadRequest)
+			return
+		}
+	} else {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "mode parameter is mandatory"), http.StatusBadRequest)
+		return
+	}
+
+	maintenance := &dx.Maintenance{}
+	if enabled {
+		maintenance = &dx.Maintenance{
+			Enabled:     true,
+			Message:     params.Get("message"),
+			TriggeredBy: user.Login,
+			Since:       time.Now().Unix(),
+		}
+	}
+
+	err := store.SaveMaintenance(maintenance)
+	if err != nil {
+		logrus.Errorf("cannot save maintenance mode: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("maintenance mode set to %s by %s", params.Get("mode"), user.Login)
+
+	maintenanceBytes, _ := json.Marshal(maintenance)
+	w.WriteHeader(http.StatusOK)
+	w.Write(maintenanceBytes)
+}
+
+func maintenanceMessage(maintenance *dx.Maintenance) string {
+	if maintenance.Message != "" {
+		return maintenance.Message
+	}
+	return "GimletD is in maintenance mode"
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_maintenance(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "admin", Admin: true}
+	ctx := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return context.WithValue(ctx, "user", user)
+	}
+
+	status, _, _ := testPostEndpoint(maintenance, ctx, "/api/maintenance?mode=maybe", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, body, _ := testPostEndpoint(maintenance, ctx, "/api/maintenance?mode=on&message=upgrading+the+cluster", "")
+	assert.Equal(t, http.StatusOK, status)
+	var m dx.Maintenance
+	err := json.Unmarshal([]byte(body), &m)
+	assert.Nil(t, err)
+	assert.True(t, m.Enabled)
+	assert.Equal(t, "admin", m.TriggeredBy)
+
+	status, body, _ = testPostEndpoint(release, ctx, "/api/releases", `{"env":"staging","artifactId":"my-app-1"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, status, "releases should be rejected during maintenance")
+	assert.Contains(t, body, "upgrading the cluster")
+
+	status, _, _ = testPostEndpoint(maintenance, ctx, "/api/maintenance?mode=off", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _, _ = testPostEndpoint(release, ctx, "/api/releases", `{"env":"staging","artifactId":"my-app-1"}`)
+	assert.NotEqual(t, http.StatusServiceUnavailable, status)
+}
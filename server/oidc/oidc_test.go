@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_verify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	var issuer string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 issuer,
+				"authorization_endpoint": issuer + "/auth",
+				"token_endpoint":         issuer + "/token",
+				"jwks_uri":               issuer + "/keys",
+			})
+		case "/keys":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": []map[string]string{{
+					"kid": "key-1",
+					"kty": "RSA",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				}},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	issuer = server.URL
+
+	sign := func(claims jwt.MapClaims, kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		assert.Nil(t, err)
+		return signed
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   issuer,
+			"aud":   "gimletd",
+			"sub":   "123",
+			"email": "jane@example.com",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	p := NewProvider(issuer, "gimletd", "secret", "https://gimletd.example.com/auth/oidc/callback", nil)
+
+	authCodeURL, err := p.AuthCodeURL("my-state", "my-nonce")
+	assert.Nil(t, err)
+	assert.Contains(t, authCodeURL, issuer+"/auth?")
+	assert.Contains(t, authCodeURL, "nonce=my-nonce")
+
+	claims, err := p.Verify(sign(valid(), "key-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "jane@example.com", claims["email"])
+
+	otherAudience := valid()
+	otherAudience["aud"] = []interface{}{"other-app"}
+	_, err = p.Verify(sign(otherAudience, "key-1"))
+	assert.NotNil(t, err, "should not accept tokens of other clients")
+
+	otherIssuer := valid()
+	otherIssuer["iss"] = "https://accounts.example.com"
+	_, err = p.Verify(sign(otherIssuer, "key-1"))
+	assert.NotNil(t, err)
+
+	expired := valid()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = p.Verify(sign(expired, "key-1"))
+	assert.NotNil(t, err)
+
+	_, err = p.Verify(sign(valid(), "unknown-key"))
+	assert.NotNil(t, err)
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, valid())
+	forged.Header["kid"] = "key-1"
+	forgedString, _ := forged.SignedString(otherKey)
+	_, err = p.Verify(forgedString)
+	assert.NotNil(t, err, "should not accept tokens with an invalid signature")
+}
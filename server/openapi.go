@@ -0,0 +1,647 @@
+package server
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate go run ../cmd/openapi ../docs/openapi.json
+
+// apiOperation annotates a chi route for the OpenAPI document
+type apiOperation struct {
+	Summary  string
+	Params   []apiParam
+	Request  interface{}
+	Response interface{}
+	Status   int
+	Admin    bool
+	Public   bool
+}
+
+type apiParam struct {
+	Name     string
+	Required bool
+	Desc     string
+}
+
+type eventIDResult struct {
+	ID string `json:"id"`
+}
+
+// apiOperations holds the annotations of the routes, keyed by "METHOD path"
+var apiOperations = map[string]apiOperation{
+	"POST /api/artifact": {
+		Summary: "Saves an artifact, returns 403 if its repository is not on the artifact allowlist. With the wait parameter it returns an ArtifactIngestion once the deploy decision is made, or with 202 on timeout. The decision is made once the event is processed, parked, failed, or its deploys wait for the gitops checks (checking) or for a failing sync to recover (held)",
+		Params: []apiParam{
+			{Name: "wait", Desc: "duration to wait for the deploy decision, eg.: 30s"},
+		},
+		Request:  dx.Artifact{},
+		Response: dx.Artifact{},
+		Status:   http.StatusCreated,
+	},
+	"GET /api/artifacts": {
+		Summary: "Lists artifacts, newest first. The X-Total-Count response header has the number of matching artifacts, X-Next-Cursor the cursor of the next page when the page is full",
+		Params: []apiParam{
+			{Name: "limit", Desc: "10 by default"},
+			{Name: "offset"},
+			{Name: "cursor", Desc: "X-Next-Cursor of the previous page, can't be used with offset"},
+			{Name: "since", Desc: "RFC3339 timestamp"},
+			{Name: "until", Desc: "RFC3339 timestamp"},
+			{Name: "repository"},
+			{Name: "branch"},
+			{Name: "sourceBranch"},
+			{Name: "sha"},
+			{Name: "event", Desc: "one of pr, push, tag"},
+			{Name: "submittedBy", Desc: "login of the user that submitted the artifact"},
+		},
+		Response: []*dx.Artifact{},
+	},
+	"GET /api/releases": {
+		Summary: "Lists releases",
+		Params: []apiParam{
+			{Name: "limit"},
+			{Name: "since", Desc: "RFC3339 timestamp"},
+			{Name: "until", Desc: "RFC3339 timestamp"},
+			{Name: "app"},
+			{Name: "env"},
+			{Name: "git-repo"},
+			{Name: "lifecycle", Desc: "true to list the rollbacks and deletes too, classified by their type"},
+		},
+		Response: []*dx.Release{},
+	},
+	"GET /api/releases/{gitopsRef}/manifests": {
+		Summary:  "Returns the manifests as they were written to the gitops repo in the given commit",
+		Response: []*dx.RenderedManifests{},
+	},
+	"GET /api/shadow/{env}/{app}": {
+		Summary:  "Returns the manifests of the last shadow deploy of an app, that are committed to the gitops repo but not synced to the cluster",
+		Response: &dx.RenderedManifests{},
+	},
+	"GET /api/status": {
+		Summary: "Returns the current release of apps",
+		Params: []apiParam{
+			{Name: "app"},
+			{Name: "env"},
+		},
+		Response: map[string]*dx.Release{},
+	},
+	"GET /api/bom": {
+		Summary:  "Returns the bill of materials deployed to an env",
+		Params:   []apiParam{{Name: "env", Required: true}},
+		Response: dx.BillOfMaterials{},
+	},
+	"GET /api/releaseState": {
+		Summary:  "Returns the current releases that the release state worker last found in the gitops repo",
+		Params:   []apiParam{{Name: "env", Desc: "all envs by default"}},
+		Response: dx.ReleaseState{},
+	},
+	"GET /api/metrics/dora": {
+		Summary: "Returns the DORA metrics of a time window, the last 30 days by default",
+		Params: []apiParam{
+			{Name: "since", Desc: "RFC3339 timestamp"},
+			{Name: "until", Desc: "RFC3339 timestamp"},
+		},
+		Response: dx.DoraMetrics{},
+	},
+	"GET /api/repositories/{name}/stats": {
+		Summary:  "Returns the artifact counts by branch and event, the last deploy per env and the average deploy latency of a repository. Repository names with an owner are url encoded",
+		Response: dx.RepositoryStats{},
+	},
+	"POST /api/releases": {
+		Summary:  "Releases an artifact to an env, returns 503 in maintenance mode. With redeploy, only artifacts that were deployed to the env successfully before are released",
+		Request:  dx.ReleaseRequest{},
+		Response: eventIDResult{},
+		Status:   http.StatusCreated,
+	},
+	"GET /api/drift": {
+		Summary: "Compares the chart and the values of an app across envs",
+		Params: []apiParam{
+			{Name: "app", Required: true},
+			{Name: "envs", Desc: "comma separated list of envs to compare, all envs by default"},
+		},
+		Response: dx.DriftReport{},
+	},
+	"GET /api/releases/diff": {
+		Summary: "Compares the releases of an app in an env at two gitops commits: the changed images, chart and values, and the app commits between the artifacts. Returns 404 if a commit is not found, or the app is not deployed at it",
+		Params: []apiParam{
+			{Name: "env", Required: true},
+			{Name: "app", Required: true},
+			{Name: "from", Required: true, Desc: "gitops sha, eg. of the last good deploy"},
+			{Name: "to", Required: true, Desc: "gitops sha"},
+		},
+		Response: dx.ReleaseDiff{},
+	},
+	"GET /api/maintenance": {
+		Summary:  "Returns the maintenance mode state",
+		Response: dx.Maintenance{},
+	},
+	"POST /api/maintenance": {
+		Summary: "Turns maintenance mode on or off",
+		Params: []apiParam{
+			{Name: "mode", Required: true, Desc: "on or off"},
+			{Name: "message", Desc: "returned to release requests during maintenance"},
+		},
+		Response: dx.Maintenance{},
+		Admin:    true,
+	},
+	"GET /api/freeze": {
+		Summary:  "Lists the frozen apps",
+		Response: []*dx.Freeze{},
+	},
+	"POST /api/freeze/{env}/{app}": {
+		Summary: "Freezes the releases of an app in an env, its deploys are parked until it is unfrozen. Returns 409 if it is already frozen",
+		Params: []apiParam{
+			{Name: "reason", Desc: "why the app is frozen, it is in the parked deploys and their notifications"},
+		},
+		Response: dx.Freeze{},
+	},
+	"DELETE /api/freeze/{env}/{app}": {
+		Summary: "Lifts the release freeze of an app in an env, returns 404 if it is not frozen",
+	},
+	"GET /api/envSync": {
+		Summary:  "Lists the envs whose Flux sync is failing. Auto-deploys to envs that hold their deploys on sync failures are held until the sync recovers",
+		Response: []*dx.EnvSync{},
+	},
+	"POST /api/envSync/{env}/override": {
+		Summary:  "Lets the auto-deploys to an env through while its sync is failing, until the sync recovers. The held deploys are requeued. Returns 404 if the sync is not failing",
+		Response: dx.EnvSync{},
+		Admin:    true,
+	},
+	"DELETE /api/envSync/{env}/override": {
+		Summary:  "Holds the auto-deploys to an env with a failing sync again, returns 404 if the sync is not failing",
+		Response: dx.EnvSync{},
+		Admin:    true,
+	},
+	"POST /api/artifacts/{id}/reevaluate": {
+		Summary: "Re-runs the deploy policies of an artifact, and deploys it to the envs that match now but it did not deploy to before. Returns 503 in maintenance mode",
+		Params: []apiParam{
+			{Name: "force", Desc: "true to deploy to the apps within their rollback protection window too"},
+		},
+		Response: eventIDResult{},
+		Status:   http.StatusCreated,
+	},
+	"POST /api/rollback": {
+		Summary: "Rolls back an app in an env to a gitops sha",
+		Params: []apiParam{
+			{Name: "env", Required: true},
+			{Name: "app", Required: true},
+			{Name: "sha", Required: true},
+			{Name: "force", Desc: "true to revert commits that were not made by GimletD, eg. manual hotfixes"},
+		},
+		Response: eventIDResult{},
+		Status:   http.StatusCreated,
+	},
+	"POST /api/delete": {
+		Summary: "Deletes an app from an env",
+		Params: []apiParam{
+			{Name: "env", Required: true},
+			{Name: "app", Required: true},
+		},
+	},
+	"GET /api/event": {
+		Summary:  "Returns the processing status of an event",
+		Params:   []apiParam{{Name: "id", Required: true}},
+		Response: dx.ReleaseStatus{},
+	},
+	"GET /api/event/logs": {
+		Summary:  "Returns the last log lines of the processing of an event",
+		Params:   []apiParam{{Name: "id", Required: true}},
+		Response: dx.EventLogs{},
+	},
+	"POST /api/flux-events": {
+		Summary: "Receives Flux notifications",
+		Params:  []apiParam{{Name: "env", Required: true}},
+	},
+	"GET /api/me": {
+		Summary:  "Returns the login, roles, groups and token details of the authenticated user",
+		Response: dx.Identity{},
+	},
+	"GET /api/gitopsRepo": {
+		Summary:  "Returns the gitops repo, and the unacknowledged rewrite of its history if there is one",
+		Response: GitopsRepoResult{},
+	},
+	"GET /api/artifactCallbacks": {
+		Summary: "Lists the URLs that are called when the deploy decision on an artifact is complete",
+		Params: []apiParam{
+			{Name: "repository", Desc: "only the callbacks of the repository, eg. gimlet-io/gimletd"},
+		},
+		Response: []*model.ArtifactCallback{},
+	},
+	"POST /api/artifactCallbacks": {
+		Summary:  "Registers a URL that is called with the triggered envs and gitops refs once the deploy decision on an artifact of the repository is complete. The payload is signed with the secret in the X-Gimlet-Signature header",
+		Request:  model.ArtifactCallback{},
+		Response: model.ArtifactCallback{},
+		Status:   http.StatusCreated,
+	},
+	"DELETE /api/artifactCallbacks/{id}": {
+		Summary: "Removes an artifact callback",
+	},
+	"DELETE /api/gitopsRepo/historyRewrite": {
+		Summary: "Acknowledges the rewrite of the gitops repo history",
+		Status:  http.StatusNoContent,
+		Admin:   true,
+	},
+	"GET /api/user/{login}": {
+		Summary:  "Returns a user",
+		Params:   []apiParam{{Name: "withToken"}},
+		Response: model.User{},
+		Admin:    true,
+	},
+	"POST /api/user": {
+		Summary:  "Creates a user",
+		Request:  model.User{},
+		Response: model.User{},
+		Status:   http.StatusCreated,
+		Admin:    true,
+	},
+	"DELETE /api/user/{login}": {
+		Summary: "Deletes a user",
+		Admin:   true,
+	},
+	"GET /api/users": {
+		Summary:  "Lists users",
+		Response: []*model.User{},
+		Admin:    true,
+	},
+	"GET /api/groups": {
+		Summary:  "Lists the user groups synced from the SCM organization",
+		Response: []*model.Group{},
+		Admin:    true,
+	},
+	"POST /api/deployKey/rotate": {
+		Summary:  "Generates a new gitops deploy key, and switches to it if it could be registered through the SCM API. Otherwise it returns the public key with 202, to be added to the gitops repo before activating",
+		Response: model.DeployKeyRotation{},
+		Admin:    true,
+	},
+	"POST /api/deployKey/activate": {
+		Summary:  "Switches to the pending gitops deploy key, once its public key is added to the gitops repo",
+		Response: model.DeployKeyRotation{},
+		Admin:    true,
+	},
+	"GET /api/deployKey/rotations": {
+		Summary:  "Returns the audit log of the gitops deploy key rotations, newest first",
+		Response: []*model.DeployKeyRotation{},
+		Admin:    true,
+	},
+	"GET /api/releaseHookTokens": {
+		Summary:  "Lists the scoped tokens of the release webhook",
+		Response: []*model.ReleaseHookToken{},
+		Admin:    true,
+	},
+	"POST /api/releaseHookTokens": {
+		Summary:  "Creates a token for the release webhook, that can release the listed apps to the listed envs. The token is only returned once",
+		Request:  model.ReleaseHookToken{},
+		Response: releaseHookTokenResult{},
+		Status:   http.StatusCreated,
+		Admin:    true,
+	},
+	"DELETE /api/releaseHookTokens/{name}": {
+		Summary: "Revokes a token of the release webhook",
+		Admin:   true,
+	},
+	"GET /api/artifactRepoAllowlist": {
+		Summary:  "Lists the source repositories that may submit artifacts. Every repository may submit artifacts while the allowlist is empty",
+		Response: model.RepoAllowlist{},
+		Admin:    true,
+	},
+	"POST /api/artifactRepoAllowlist": {
+		Summary:  "Allows the listed users and API tokens to submit the artifacts of a source repository, or a path pattern of them like my-org/team-*",
+		Request:  model.AllowedRepository{},
+		Response: model.AllowedRepository{},
+		Status:   http.StatusCreated,
+		Admin:    true,
+	},
+	"DELETE /api/artifactRepoAllowlist": {
+		Summary: "Removes a source repository from the artifact allowlist",
+		Params:  []apiParam{{Name: "repository", Required: true}},
+		Admin:   true,
+	},
+	"DELETE /api/apps/{env}/{app}": {
+		Summary: "Deletes an app from an env. Without the confirm parameter it returns a confirmation token with 202",
+		Params: []apiParam{
+			{Name: "confirm", Desc: "the confirmation token"},
+		},
+		Response: eventIDResult{},
+		Status:   http.StatusCreated,
+		Admin:    true,
+	},
+	"POST /api/compact": {
+		Summary: "Squashes the gitops history of app folders before the given time",
+		Params: []apiParam{
+			{Name: "before", Required: true, Desc: "RFC3339 timestamp"},
+			{Name: "env", Required: true},
+			{Name: "app", Required: true, Desc: "the app folders to compact, a glob pattern, eg. my-app-pr-*"},
+		},
+		Response: eventIDResult{},
+		Status:   http.StatusCreated,
+		Admin:    true,
+	},
+	"POST /api/gitops-webhook": {
+		Summary: "Receives the push webhooks of the gitops repo, signed with the webhook secret",
+		Status:  http.StatusAccepted,
+		Public:  true,
+	},
+	"GET /auth/oidc/login": {
+		Summary: "Redirects to the login page of the OIDC provider. Only with OIDC_ISSUER set",
+		Status:  http.StatusFound,
+		Public:  true,
+	},
+	"GET /auth/oidc/callback": {
+		Summary: "Completes the OIDC login, sets a session cookie that expires after OIDC_TOKEN_TTL and redirects to HOST",
+		Params: []apiParam{
+			{Name: "code", Required: true},
+			{Name: "state", Required: true},
+		},
+		Status: http.StatusFound,
+		Public: true,
+	},
+	"POST /auth/oidc/token": {
+		Summary:  "Exchanges an ID token of the OIDC provider to a GimletD token that expires after OIDC_TOKEN_TTL, eg. for the CLI",
+		Request:  ssoTokenRequest{},
+		Response: ssoTokenResult{},
+		Public:   true,
+	},
+	"GET /api/public/status": {
+		Summary: "Returns the current releases of the apps in an env, without commit authors. Only with PUBLIC_ENDPOINTS enabled",
+		Params: []apiParam{
+			{Name: "env", Required: true},
+			{Name: "app"},
+		},
+		Response: map[string]*dx.Release{},
+		Public:   true,
+	},
+	"GET /api/public/badge/{env}/{app}": {
+		Summary: "Returns an SVG badge of the version deployed to the env. Only with PUBLIC_ENDPOINTS enabled",
+		Public:  true,
+	},
+	"POST /hook/registry/{provider}": {
+		Summary: "Receives the image push webhooks of dockerhub, harbor or ecr, and creates an artifact for each pushed tag",
+		Params: []apiParam{
+			{Name: "token", Desc: "the registry webhook secret, if not sent in the Authorization header"},
+			{Name: "repository", Desc: "the repository of the artifacts, the image name by default"},
+		},
+		Response: []*dx.Artifact{},
+		Status:   http.StatusCreated,
+		Public:   true,
+	},
+	"POST /hook/release": {
+		Summary:  "Triggers a release with a scoped release webhook token sent in the Authorization header, the artifact is referenced by its id or by its image tag",
+		Request:  releaseHookRequest{},
+		Response: eventIDResult{},
+		Status:   http.StatusCreated,
+		Public:   true,
+	},
+
+	"GET /api/openapi.json": {
+		Summary: "Returns this document",
+		Public:  true,
+	},
+}
+
+var pathParamRegex = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// OpenAPISpec generates the OpenAPI 3 document of the routes
+func OpenAPISpec(routes chi.Routes) ([]byte, error) {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+
+	err := chi.Walk(routes, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if !strings.HasPrefix(route, "/api/") {
+			return nil
+		}
+
+		path := pathParamRegex.ReplaceAllString(route, "{$1}")
+		op := apiOperations[method+" "+path]
+
+		operation := map[string]interface{}{
+			"summary": op.Summary,
+		}
+
+		params := []interface{}{}
+		for _, match := range pathParamRegex.FindAllStringSubmatch(route, -1) {
+			params = append(params, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, p := range op.Params {
+			param := map[string]interface{}{
+				"name":     p.Name,
+				"in":       "query",
+				"required": p.Required,
+				"schema":   map[string]interface{}{"type": "string"},
+			}
+			if p.Desc != "" {
+				param["description"] = p.Desc
+			}
+			params = append(params, param)
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if op.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": schemaOf(reflect.TypeOf(op.Request), schemas),
+					},
+				},
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := map[string]interface{}{
+			"description": http.StatusText(status),
+		}
+		if op.Response != nil {
+			response["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": schemaOf(reflect.TypeOf(op.Response), schemas),
+				},
+			}
+		}
+		responses := map[string]interface{}{
+			fmt.Sprint(status): response,
+			"400":              map[string]interface{}{"description": http.StatusText(http.StatusBadRequest)},
+		}
+		if !op.Public {
+			responses["401"] = map[string]interface{}{"description": http.StatusText(http.StatusUnauthorized)}
+			operation["security"] = []interface{}{map[string]interface{}{"accessToken": []string{}}}
+		}
+		operation["responses"] = responses
+		if op.Admin {
+			operation["tags"] = []string{"admin"}
+		}
+
+		if _, ok := paths[path]; !ok {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(method)] = operation
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "GimletD",
+			"version": "v1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"accessToken": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "query",
+					"name": "access_token",
+				},
+			},
+		},
+	}, "", "  ")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// schemaOf returns the JSON schema of a Go type.
+// Named structs are collected under the components and referenced
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t.Kind() != reflect.Struct &&
+		(t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+			reflect.PtrTo(t).Implements(jsonMarshalerType)) {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; !ok {
+			schemas[t.Name()] = map[string]interface{}{} // placeholder for recursive types
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return ref
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := field.Name
+		omitEmpty := false
+		if tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" {
+					omitEmpty = true
+				}
+			}
+		}
+
+		if field.Anonymous && tag == "" && indirect(field.Type).Kind() == reflect.Struct {
+			embedded := structSchema(indirect(field.Type), schemas)
+			for k, v := range embedded["properties"].(map[string]interface{}) {
+				properties[k] = v
+			}
+			continue
+		}
+
+		properties[name] = schemaOf(field.Type, schemas)
+		if !omitEmpty && field.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func getOpenAPI(routes chi.Routes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		spec, err := OpenAPISpec(routes)
+		if err != nil {
+			logrus.Errorf("cannot generate openapi spec: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(spec)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_openAPISpec(t *testing.T) {
+	router := SetupRouter(&config.Config{}, store.NewTest(), nil, nil, nil)
+
+	err := chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if route == "/" {
+			return nil
+		}
+		_, ok := apiOperations[method+" "+route]
+		assert.True(t, ok, "%s %s should be annotated for the OpenAPI document", method, route)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	specBytes, err := OpenAPISpec(router)
+	assert.Nil(t, err)
+
+	var spec struct {
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	err = json.Unmarshal(specBytes, &spec)
+	assert.Nil(t, err)
+
+	assert.Contains(t, spec.Paths["/api/artifact"], "post")
+	assert.Contains(t, spec.Paths["/api/user/{login}"], "delete")
+	assert.Contains(t, spec.Components.Schemas, "Artifact")
+	assert.Contains(t, spec.Components.Schemas, "Manifest")
+
+	version := spec.Components.Schemas["Version"]["properties"].(map[string]interface{})
+	assert.Equal(t, "string", version["event"].(map[string]interface{})["type"], "git events are serialized as strings")
+}
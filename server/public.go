@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const badgeColorDeployed = "#4c1"
+const badgeColorRolledBack = "#fe7d37"
+const badgeColorNotDeployed = "#9f9f9f"
+
+// getPublicStatus returns the current releases of an env without authentication.
+// Commit authors and messages are left out
+func getPublicStatus(w http.ResponseWriter, r *http.Request) {
+	var app, env string
+
+	params := r.URL.Query()
+	if val, ok := params["app"]; ok {
+		app = val[0]
+	}
+	if val, ok := params["env"]; ok {
+		env = val[0]
+	} else {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "env parameter is mandatory"), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
+	perf := ctx.Value("perf").(*prometheus.HistogramVec)
+
+	repo, releaseRepo := gitopsRepoCache.EnvInstanceForRead(env)
+	appReleases, err := nativeGit.Status(repo, app, env, perf)
+	releaseRepo()
+	if err != nil {
+		logrus.Errorf("cannot get status: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	publicReleases := map[string]*dx.Release{}
+	for app, release := range appReleases {
+		publicReleases[app] = publicRelease(release)
+	}
+
+	appReleasesString, err := json.Marshal(publicReleases)
+	if err != nil {
+		logrus.Errorf("cannot serialize app releases: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(appReleasesString)
+}
+
+// getBadge renders an SVG badge of the version deployed to the env, to be embedded in READMEs
+func getBadge(w http.ResponseWriter, r *http.Request) {
+	env := chi.URLParam(r, "env")
+	app := chi.URLParam(r, "app")
+
+	ctx := r.Context()
+	gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
+	perf := ctx.Value("perf").(*prometheus.HistogramVec)
+
+	var release *dx.Release
+	repo, releaseRepo := gitopsRepoCache.EnvInstanceForRead(env)
+	appReleases, err := nativeGit.Status(repo, app, env, perf)
+	releaseRepo()
+	if err != nil {
+		logrus.Debugf("cannot get status of %s in %s: %s", app, env, err)
+	} else {
+		release = appReleases[app]
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(badge(env, release)))
+}
+
+// publicRelease is the release without the personal details of the commit
+func publicRelease(release *dx.Release) *dx.Release {
+	if release == nil {
+		return nil
+	}
+
+	public := *release
+	if release.Version != nil {
+		public.Version = &dx.Version{
+			RepositoryName: release.Version.RepositoryName,
+			SHA:            release.Version.SHA,
+			Created:        release.Version.Created,
+			Branch:         release.Version.Branch,
+			Event:          release.Version.Event,
+			Tag:            release.Version.Tag,
+		}
+	}
+	return &public
+}
+
+// badge renders a flat badge with the env on the left, and the deployed version on the right
+func badge(env string, release *dx.Release) string {
+	version, color := "not deployed", badgeColorNotDeployed
+	if release != nil && release.Version != nil {
+		version, color = release.Version.Tag, badgeColorDeployed
+		if version == "" {
+			version = release.Version.SHA
+			if len(version) > 7 {
+				version = version[:7]
+			}
+		}
+		if release.RolledBack {
+			version, color = version+" (rolled back)", badgeColorRolledBack
+		}
+	}
+
+	labelWidth := textWidth(env)
+	valueWidth := textWidth(version)
+	width := labelWidth + valueWidth
+	env = html.EscapeString(env)
+	version = html.EscapeString(version)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+
+		`<title>%s: %s</title>`+
+		`<rect width="%d" height="20" fill="#555"/>`+
+		`<rect x="%d" width="%d" height="20" fill="%s"/>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%d" y="14">%s</text>`+
+		`<text x="%d" y="14">%s</text>`+
+		`</g></svg>`,
+		width, env, version,
+		env, version,
+		labelWidth,
+		labelWidth, valueWidth, color,
+		labelWidth/2, env,
+		labelWidth+valueWidth/2, version,
+	)
+}
+
+// textWidth approximates the rendered width of the text in the badge font, with padding
+func textWidth(text string) int {
+	return len(text)*7 + 10
+}
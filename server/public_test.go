@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_publicEndpointsToggle(t *testing.T) {
+	router := SetupRouter(&config.Config{}, store.NewTest(), nil, nil, nil)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/public/badge/production/my-app")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "public endpoints should be disabled by default")
+
+	router = SetupRouter(&config.Config{PublicEndpoints: true}, store.NewTest(), nil, nil, nil)
+	routes := map[string]bool{}
+	err = chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routes[method+" "+route] = true
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.True(t, routes["GET /api/public/status"])
+	assert.True(t, routes["GET /api/public/badge/{env}/{app}"])
+}
+
+func Test_badge(t *testing.T) {
+	svg := badge("production", nil)
+	assert.Contains(t, svg, "<title>production: not deployed</title>")
+	assert.Contains(t, svg, badgeColorNotDeployed)
+
+	release := &dx.Release{
+		Version: &dx.Version{SHA: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780"},
+	}
+	svg = badge("production", release)
+	assert.Contains(t, svg, "<title>production: ea9ab7c</title>")
+	assert.Contains(t, svg, badgeColorDeployed)
+
+	release.Version.Tag = "v1.0.0"
+	release.RolledBack = true
+	svg = badge("<production>", release)
+	assert.Contains(t, svg, "<title>&lt;production&gt;: v1.0.0 (rolled back)</title>")
+	assert.Contains(t, svg, badgeColorRolledBack)
+}
+
+func Test_publicRelease(t *testing.T) {
+	release := &dx.Release{
+		App: "my-app",
+		Version: &dx.Version{
+			SHA:         "ea9ab7cc31b2599bf4afcfd639da516ca27a4780",
+			AuthorEmail: "laszlo@gimlet.io",
+			Message:     "Fix the bug",
+		},
+	}
+
+	public := publicRelease(release)
+	assert.Equal(t, "my-app", public.App)
+	assert.Equal(t, release.Version.SHA, public.Version.SHA)
+	assert.Equal(t, "", public.Version.AuthorEmail)
+	assert.Equal(t, "", public.Version.Message)
+	assert.Equal(t, "laszlo@gimlet.io", release.Version.AuthorEmail, "should not modify the release")
+	assert.Nil(t, publicRelease(nil))
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"context"
+
+	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/store"
+)
+
+// readReplica connects to the read replica of the database if one is configured, otherwise reads go to the primary
+func readReplica(db config.Database, primary *store.Store) *store.Store {
+	if db.ReadConfig == "" {
+		return primary
+	}
+	return store.NewReadReplica(db.Driver, db.ReadConfig)
+}
+
+// readStore returns the store of read-only queries, falling back to the primary store
+func readStore(ctx context.Context) *store.Store {
+	if s, ok := ctx.Value("readStore").(*store.Store); ok && s != nil {
+		return s
+	}
+	return ctx.Value("store").(*store.Store)
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/registry"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Context vars of the artifacts created from registry webhooks, next to the image tag in dx.ImageUpdateTagVar
+const imageVar = "IMAGE"
+const imageDigestVar = "IMAGE_DIGEST"
+
+// registryPush is an image push parsed from the webhook of a container registry
+type registryPush struct {
+	Image  string // without the tag
+	Tag    string
+	Digest string
+	Pusher string
+}
+
+var registryWebhookParsers = map[string]func(body []byte) ([]*registryPush, error){
+	"dockerhub": parseDockerHubPush,
+	"harbor":    parseHarborPush,
+	"ecr":       parseECRPush,
+}
+
+// registryWebhook creates an artifact for each pushed image tag, for teams whose CI only pushes images.
+// The artifacts take the manifests of the latest artifact of the repository
+func registryWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	secret := ctx.Value("registryWebhookSecret").(string)
+
+	if !validRegistryWebhook(r, secret) {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusUnauthorized), "invalid webhook token"), http.StatusUnauthorized)
+		return
+	}
+
+	provider := chi.URLParam(r, "provider")
+	parse, ok := registryWebhookParsers[provider]
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s: unsupported registry %s", http.StatusText(http.StatusBadRequest), provider), http.StatusBadRequest)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logrus.Errorf("cannot read webhook payload: %s", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	pushes, err := parse(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: cannot parse %s webhook: %s", http.StatusText(http.StatusBadRequest), provider, err), http.StatusBadRequest)
+		return
+	}
+
+	artifacts := []*dx.Artifact{}
+	for _, push := range pushes {
+		if push.Tag == "" {
+			continue // untagged pushes are not deployable
+		}
+
+		repository := r.URL.Query().Get("repository")
+		if repository == "" {
+			_, repository = registry.ParseImage(push.Image)
+		}
+
+		allowed, err := artifactRepoAllowed(ctx, repository, model.RegistryWebhookSubmitter)
+		if err != nil {
+			logrus.Errorf("cannot check the artifact repo allowlist: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			logrus.Warnf("rejected the %s webhook of %s:%s, the repository %s is not on the allowlist for %s",
+				provider, push.Image, push.Tag, repository, model.RegistryWebhookSubmitter)
+			http.Error(w, fmt.Sprintf("%s - %s may not submit the artifacts of repository %s", http.StatusText(http.StatusForbidden), model.RegistryWebhookSubmitter, repository), http.StatusForbidden)
+			return
+		}
+
+		artifact, err := registryArtifact(store, repository, push)
+		if err != nil {
+			logrus.Errorf("cannot create artifact of %s:%s: %s", push.Image, push.Tag, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	// the artifacts are saved once all of them passed the allowlist
+	for _, artifact := range artifacts {
+		artifact.Source = &dx.ArtifactSource{
+			SubmittedBy: model.RegistryWebhookSubmitter,
+			UserAgent:   r.UserAgent(),
+		}
+
+		event, err := model.ToEvent(*artifact)
+		if err != nil {
+			logrus.Errorf("cannot convert to artifact model: %s", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		event.CorrelationID = correlationIDFrom(ctx)
+		_, err = store.CreateEvent(event)
+		if err != nil {
+			logrus.Errorf("cannot save artifact: %s", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+	}
+
+	artifactsStr, err := json.Marshal(artifacts)
+	if err != nil {
+		logrus.Errorf("cannot serialize artifacts: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(artifactsStr)
+}
+
+// registryArtifact synthesizes the artifact of an image push, with the manifests of the latest artifact of the repository
+func registryArtifact(store *store.Store, repository string, push *registryPush) (*dx.Artifact, error) {
+	artifact := &dx.Artifact{
+		ID:      fmt.Sprintf("%s-%s", repository, uuid.New().String()),
+		Created: time.Now().Unix(),
+		Version: dx.Version{
+			RepositoryName: repository,
+			Created:        time.Now().Unix(),
+			Event:          dx.Tag,
+			Tag:            push.Tag,
+			AuthorName:     push.Pusher,
+			Message:        fmt.Sprintf("Pushed %s:%s", push.Image, push.Tag),
+		},
+		Context: map[string]string{
+			imageVar:             push.Image,
+			dx.ImageUpdateTagVar: push.Tag,
+			imageDigestVar:       push.Digest,
+		},
+		Items: []map[string]interface{}{
+			{"name": "image", "image": push.Image, "tag": push.Tag, "digest": push.Digest},
+		},
+	}
+
+	latest, err := store.Artifacts(repository, "", nil, "", nil, "", nil, 1, 0, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(latest) > 0 {
+		latestArtifact, err := model.ToArtifact(latest[0])
+		if err != nil {
+			return nil, err
+		}
+		artifact.Environments = latestArtifact.Environments
+	}
+
+	return artifact, nil
+}
+
+// validRegistryWebhook checks the secret in the token query parameter, as Docker Hub webhooks can't have headers,
+// or in the Authorization header, that Harbor and EventBridge API destinations can send
+func validRegistryWebhook(r *http.Request, secret string) bool {
+	if secret == "" {
+		return false
+	}
+
+	if token := r.URL.Query().Get("token"); token != "" {
+		return hmac.Equal([]byte(token), []byte(secret))
+	}
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		return hmac.Equal([]byte(token), []byte(secret))
+	}
+
+	return false
+}
+
+func parseDockerHubPush(body []byte) ([]*registryPush, error) {
+	var payload struct {
+		PushData struct {
+			Tag    string `json:"tag"`
+			Pusher string `json:"pusher"`
+		} `json:"push_data"`
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Repository.RepoName == "" {
+		return nil, fmt.Errorf("no repository in payload")
+	}
+
+	return []*registryPush{{
+		Image:  payload.Repository.RepoName,
+		Tag:    payload.PushData.Tag,
+		Pusher: payload.PushData.Pusher,
+	}}, nil
+}
+
+func parseHarborPush(body []byte) ([]*registryPush, error) {
+	var payload struct {
+		Type      string `json:"type"`
+		Operator  string `json:"operator"`
+		EventData struct {
+			Resources []struct {
+				Digest      string `json:"digest"`
+				Tag         string `json:"tag"`
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Type != "PUSH_ARTIFACT" {
+		return nil, nil
+	}
+
+	var pushes []*registryPush
+	for _, resource := range payload.EventData.Resources {
+		image := resource.ResourceURL
+		if i := strings.LastIndex(image, "@"); i != -1 {
+			image = image[:i]
+		}
+		if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+			image = image[:i]
+		}
+		pushes = append(pushes, &registryPush{
+			Image:  image,
+			Tag:    resource.Tag,
+			Digest: resource.Digest,
+			Pusher: payload.Operator,
+		})
+	}
+	return pushes, nil
+}
+
+// parseECRPush parses the ECR Image Action event of EventBridge
+func parseECRPush(body []byte) ([]*registryPush, error) {
+	var payload struct {
+		Account string `json:"account"`
+		Region  string `json:"region"`
+		Detail  struct {
+			Result         string `json:"result"`
+			ActionType     string `json:"action-type"`
+			RepositoryName string `json:"repository-name"`
+			ImageDigest    string `json:"image-digest"`
+			ImageTag       string `json:"image-tag"`
+		} `json:"detail"`
+	}
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Detail.ActionType != "PUSH" || payload.Detail.Result != "SUCCESS" {
+		return nil, nil
+	}
+
+	return []*registryPush{{
+		Image:  fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s", payload.Account, payload.Region, payload.Detail.RepositoryName),
+		Tag:    payload.Detail.ImageTag,
+		Digest: payload.Detail.ImageDigest,
+	}}, nil
+}
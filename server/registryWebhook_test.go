@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseRegistryPushes(t *testing.T) {
+	pushes, err := parseDockerHubPush([]byte(`{
+  "push_data": {"pusher": "laszlo", "tag": "v1.0.0"},
+  "repository": {"repo_name": "gimlet/my-app", "name": "my-app", "namespace": "gimlet"}
+}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []*registryPush{{Image: "gimlet/my-app", Tag: "v1.0.0", Pusher: "laszlo"}}, pushes)
+
+	pushes, err = parseHarborPush([]byte(`{
+  "type": "PUSH_ARTIFACT",
+  "operator": "robot",
+  "event_data": {
+    "resources": [{"digest": "sha256:abc", "tag": "v1.0.0", "resource_url": "harbor.example.com/library/my-app:v1.0.0"}],
+    "repository": {"name": "my-app", "namespace": "library", "repo_full_name": "library/my-app"}
+  }
+}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []*registryPush{{Image: "harbor.example.com/library/my-app", Tag: "v1.0.0", Digest: "sha256:abc", Pusher: "robot"}}, pushes)
+
+	pushes, err = parseECRPush([]byte(`{
+  "detail-type": "ECR Image Action",
+  "source": "aws.ecr",
+  "account": "123456789012",
+  "region": "eu-west-1",
+  "detail": {"result": "SUCCESS", "repository-name": "my-app", "image-digest": "sha256:abc", "action-type": "PUSH", "image-tag": "v1.0.0"}
+}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []*registryPush{{Image: "123456789012.dkr.ecr.eu-west-1.amazonaws.com/my-app", Tag: "v1.0.0", Digest: "sha256:abc"}}, pushes)
+
+	pushes, err = parseECRPush([]byte(`{"detail": {"result": "SUCCESS", "action-type": "DELETE"}}`))
+	assert.Nil(t, err)
+	assert.Empty(t, pushes, "should ignore deletes")
+}
+
+func Test_validRegistryWebhook(t *testing.T) {
+	r := httptest.NewRequest("POST", "/hook/registry/dockerhub?token=secret", nil)
+	assert.True(t, validRegistryWebhook(r, "secret"))
+	assert.False(t, validRegistryWebhook(r, "other-secret"))
+	assert.False(t, validRegistryWebhook(r, ""), "webhooks should be rejected without a configured secret")
+
+	r = httptest.NewRequest("POST", "/hook/registry/harbor", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	assert.True(t, validRegistryWebhook(r, "secret"))
+
+	r = httptest.NewRequest("POST", "/hook/registry/harbor", nil)
+	assert.False(t, validRegistryWebhook(r, "secret"))
+}
+
+func Test_registryWebhook(t *testing.T) {
+	store := store.NewTest()
+	previous, err := model.ToEvent(dx.Artifact{
+		ID:           "gimlet/my-app-1",
+		Version:      dx.Version{RepositoryName: "gimlet/my-app", SHA: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780"},
+		Environments: []*dx.Manifest{{App: "my-app", Env: "staging"}},
+	})
+	assert.Nil(t, err)
+	_, err = store.CreateEvent(previous)
+	assert.Nil(t, err)
+
+	router := SetupRouter(&config.Config{RegistryWebhookSecret: "secret"}, store, nil, nil, nil)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	payload := `{"push_data": {"pusher": "laszlo", "tag": "v1.0.0"}, "repository": {"repo_name": "gimlet/my-app"}}`
+	resp, err := http.Post(server.URL+"/hook/registry/dockerhub", "application/json", strings.NewReader(payload))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = http.Post(server.URL+"/hook/registry/quay?token=secret", "application/json", strings.NewReader(payload))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "should reject unsupported registries")
+
+	resp, err = http.Post(server.URL+"/hook/registry/dockerhub?token=secret", "application/json", strings.NewReader(payload))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	body, _ := ioutil.ReadAll(resp.Body)
+	var artifacts []*dx.Artifact
+	err = json.Unmarshal(body, &artifacts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(artifacts))
+
+	saved, err := store.Artifact(artifacts[0].ID)
+	assert.Nil(t, err)
+	artifact, _ := model.ToArtifact(saved)
+	assert.Equal(t, "gimlet/my-app", artifact.Version.RepositoryName)
+	assert.Equal(t, "v1.0.0", artifact.Version.Tag)
+	assert.Equal(t, "v1.0.0", artifact.Context[dx.ImageUpdateTagVar])
+	assert.Equal(t, "gimlet/my-app", artifact.Context[imageVar])
+	assert.Equal(t, 1, len(artifact.Environments), "should take the manifests of the latest artifact")
+	assert.Equal(t, model.RegistryWebhookSubmitter, artifact.Source.SubmittedBy)
+	assert.Equal(t, "laszlo", artifact.Version.AuthorName)
+
+	for allowlist, status := range map[string]int{
+		"gimlet/my-app:my-app-ci":                    http.StatusForbidden,
+		"gimlet/*:" + model.RegistryWebhookSubmitter: http.StatusCreated,
+	} {
+		router := SetupRouter(&config.Config{RegistryWebhookSecret: "secret", ArtifactRepoAllowlist: allowlist}, store, nil, nil, nil)
+		server := httptest.NewServer(router)
+		resp, err = http.Post(server.URL+"/hook/registry/dockerhub?token=secret", "application/json", strings.NewReader(payload))
+		server.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, status, resp.StatusCode, "the webhook should be bound by the artifact allowlist: %s", allowlist)
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gimlet-io/gimletd/drift"
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/sirupsen/logrus"
+)
+
+// getReleaseDiff compares the releases of an app in an env at two gitops commits
+func getReleaseDiff(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	for _, param := range []string{"env", "app", "from", "to"} {
+		if params.Get(param) == "" {
+			http.Error(w, fmt.Sprintf("%s: %s parameter is mandatory", http.StatusText(http.StatusBadRequest), param), http.StatusBadRequest)
+			return
+		}
+	}
+	env := params.Get("env")
+	app := params.Get("app")
+
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
+	envRegistry := ctx.Value("envs").(map[string]*dx.Env)
+
+	repo, pathToCleanUp, err := gitopsRepoCache.EnvInstanceForWrite(env) // using a copy of the repo to avoid concurrent map writes error
+	defer gitopsRepoCache.CleanupWrittenRepo(pathToCleanUp)
+	if err != nil {
+		logrus.Errorf("cannot get gitops repo for write: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	releases := map[string]*dx.Release{}
+	files := map[string]map[string]string{}
+	for _, ref := range []string{params.Get("from"), params.Get("to")} {
+		release, err := nativeGit.ReleaseAt(repo, ref, env, app)
+		if err == plumbing.ErrObjectNotFound {
+			http.Error(w, fmt.Sprintf("%s - cannot find gitops commit %s", http.StatusText(http.StatusNotFound), ref), http.StatusNotFound)
+			return
+		} else if err == object.ErrFileNotFound {
+			http.Error(w, fmt.Sprintf("%s - %s is not deployed in %s at %s", http.StatusText(http.StatusNotFound), app, env, ref), http.StatusNotFound)
+			return
+		} else if err != nil {
+			logrus.Errorf("cannot get release at %s: %s", ref, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		release.GitopsRef = ref
+		releases[ref] = release
+
+		files[ref], err = nativeGit.AppFilesAt(repo, ref, env, app)
+		if err != nil {
+			logrus.Errorf("cannot get manifests at %s: %s", ref, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	from, to := params.Get("from"), params.Get("to")
+	diff, err := drift.Compare(store, envRegistry[env], env, app, releases[from], releases[to])
+	if err != nil {
+		logrus.Errorf("cannot compare releases: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if images := dx.DiffManifests(files[from], files[to]).Images; images != nil {
+		diff.Images = images
+	}
+
+	diffString, err := json.Marshal(diff)
+	if err != nil {
+		logrus.Errorf("cannot serialize release diff: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(diffString)
+}
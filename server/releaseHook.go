@@ -0,0 +1,332 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+// releaseHookArtifactSearchLimit is the number of recent artifacts that are searched for an image tag
+const releaseHookArtifactSearchLimit = 500
+
+// releaseHookRequest is the payload of the release webhook, the artifact is referenced by its id, or by its image tag
+type releaseHookRequest struct {
+	App        string `json:"app"`
+	Env        string `json:"env"`
+	ArtifactID string `json:"artifactId,omitempty"`
+	ImageTag   string `json:"imageTag,omitempty"`
+}
+
+// releaseHookTokenResult is a newly created release webhook token, the only time the token is returned
+type releaseHookTokenResult struct {
+	*model.ReleaseHookToken
+	Token string `json:"token"`
+}
+
+// releaseHook triggers a release with a scoped token, for external systems that don't use the client library,
+// eg. Jenkins freestyle jobs or change tickets
+func releaseHook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	token, err := releaseHookTokenOf(store, r)
+	if err != nil {
+		logrus.Errorf("cannot load release hook tokens: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if token == nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusUnauthorized), "invalid release hook token"), http.StatusUnauthorized)
+		return
+	}
+
+	var request releaseHookRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: cannot decode release request: %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+		return
+	}
+	if request.App == "" || request.Env == "" {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "app and env parameters are mandatory"), http.StatusBadRequest)
+		return
+	}
+	if (request.ArtifactID == "") == (request.ImageTag == "") {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "either the artifactId or the imageTag parameter is mandatory"), http.StatusBadRequest)
+		return
+	}
+	if !token.Allows(request.Env, request.App) {
+		http.Error(w, fmt.Sprintf("%s: token %s cannot release %s to %s", http.StatusText(http.StatusForbidden), token.Name, request.App, request.Env), http.StatusForbidden)
+		return
+	}
+
+	maintenance, err := store.Maintenance()
+	if err != nil {
+		logrus.Errorf("cannot load maintenance mode: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if maintenance.Enabled {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusServiceUnavailable), maintenanceMessage(maintenance)), http.StatusServiceUnavailable)
+		return
+	}
+
+	var artifact *model.Event
+	if request.ArtifactID != "" {
+		artifact, err = store.Artifact(request.ArtifactID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s - cannot find artifact with id %s", http.StatusText(http.StatusNotFound), request.ArtifactID), http.StatusNotFound)
+			return
+		}
+		parsed, err := model.ToArtifact(artifact)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s - cannot parse artifact %s: %s", http.StatusText(http.StatusInternalServerError), request.ArtifactID, err), http.StatusInternalServerError)
+			return
+		}
+		if !hasManifest(parsed, request.Env, request.App) {
+			http.Error(w, fmt.Sprintf("%s: artifact %s has no manifest for %s in %s", http.StatusText(http.StatusBadRequest), request.ArtifactID, request.App, request.Env), http.StatusBadRequest)
+			return
+		}
+	} else {
+		artifact, err = artifactByImageTag(store, request.Env, request.App, request.ImageTag)
+		if err != nil {
+			logrus.Errorf("cannot search artifacts: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if artifact == nil {
+			http.Error(w, fmt.Sprintf("%s - cannot find an artifact of %s in %s with image tag %s", http.StatusText(http.StatusNotFound), request.App, request.Env, request.ImageTag), http.StatusNotFound)
+			return
+		}
+	}
+	if artifact.Expired != 0 {
+		http.Error(w, fmt.Sprintf("%s: artifact %s is expired, its images may no longer exist", http.StatusText(http.StatusBadRequest), artifact.ArtifactID), http.StatusBadRequest)
+		return
+	}
+
+	releaseRequestStr, err := json.Marshal(dx.ReleaseRequest{
+		Env:         request.Env,
+		App:         request.App,
+		ArtifactID:  artifact.ArtifactID,
+		TriggeredBy: "hook:" + token.Name,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - cannot serialize release request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+
+	event, err := store.CreateEvent(&model.Event{
+		Type:          model.TypeRelease,
+		Blob:          string(releaseRequestStr),
+		Repository:    artifact.Repository,
+		GitopsHashes:  []string{},
+		CorrelationID: correlationIDFrom(ctx),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - cannot save release request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("release of %s to %s triggered with the %s release hook token", request.App, request.Env, token.Name)
+
+	eventIDBytes, _ := json.Marshal(map[string]string{
+		"id": event.ID,
+	})
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(eventIDBytes)
+}
+
+// releaseHookTokenOf returns the token that the request is authenticated with, nil if it is not a valid token.
+// The token is only accepted in the Authorization header, query parameters end up in access logs
+func releaseHookTokenOf(store *store.Store, r *http.Request) (*model.ReleaseHookToken, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return nil, nil
+	}
+
+	tokens, err := store.ReleaseHookTokens()
+	if err != nil {
+		return nil, err
+	}
+	hash := releaseHookTokenHash(token)
+	for _, t := range tokens {
+		if hmac.Equal([]byte(t.TokenHash), []byte(hash)) {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func releaseHookTokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// artifactByImageTag returns the latest artifact that has a manifest for the app in the env,
+// and is tagged with the image tag: from a registry push, a git tag, or the commit sha
+func artifactByImageTag(store *store.Store, env string, app string, imageTag string) (*model.Event, error) {
+	events, err := store.Artifacts("", "", nil, "", nil, "", nil, releaseHookArtifactSearchLimit, 0, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		artifact, err := model.ToArtifact(event)
+		if err != nil {
+			continue
+		}
+		if !hasManifest(artifact, env, app) {
+			continue
+		}
+		if imageTagMatches(artifact, imageTag) {
+			return event, nil
+		}
+	}
+	return nil, nil
+}
+
+func hasManifest(artifact *dx.Artifact, env string, app string) bool {
+	for _, manifest := range artifact.Environments {
+		if manifest.Env == env && manifest.App == app {
+			return true
+		}
+	}
+	return false
+}
+
+// imageTagMatches tells if the artifact is tagged with the image tag, short commit shas match too
+func imageTagMatches(artifact *dx.Artifact, imageTag string) bool {
+	if artifact.Context[dx.ImageUpdateTagVar] == imageTag || artifact.Version.Tag == imageTag {
+		return true
+	}
+	return len(imageTag) >= 7 && strings.HasPrefix(artifact.Version.SHA, imageTag)
+}
+
+// createReleaseHookToken generates a token for the release webhook, scoped to envs and apps
+func createReleaseHookToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+
+	var token model.ReleaseHookToken
+	err := json.NewDecoder(r.Body).Decode(&token)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: cannot decode token: %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+		return
+	}
+	if token.Name == "" || len(token.Envs) == 0 {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "name and envs parameters are mandatory"), http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := store.ReleaseHookTokens()
+	if err != nil {
+		logrus.Errorf("cannot load release hook tokens: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	for _, t := range tokens {
+		if t.Name == token.Name {
+			http.Error(w, fmt.Sprintf("%s: token %s already exists", http.StatusText(http.StatusConflict), token.Name), http.StatusConflict)
+			return
+		}
+	}
+
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		logrus.Errorf("cannot generate release hook token: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	plainToken := hex.EncodeToString(secret)
+	token.TokenHash = releaseHookTokenHash(plainToken)
+	token.CreatedBy = user.Login
+	token.Created = time.Now().Unix()
+
+	err = store.SaveReleaseHookTokens(append(tokens, &token))
+	if err != nil {
+		logrus.Errorf("cannot save release hook tokens: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("release hook token %s created by %s for %v", token.Name, user.Login, token.Envs)
+
+	tokenString, err := json.Marshal(releaseHookTokenResult{ReleaseHookToken: &token, Token: plainToken})
+	if err != nil {
+		logrus.Errorf("cannot serialize release hook token: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(tokenString)
+}
+
+func getReleaseHookTokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	tokens, err := store.ReleaseHookTokens()
+	if err != nil {
+		logrus.Errorf("cannot load release hook tokens: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	for _, t := range tokens {
+		t.TokenHash = ""
+	}
+
+	tokensString, err := json.Marshal(tokens)
+	if err != nil {
+		logrus.Errorf("cannot serialize release hook tokens: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(tokensString)
+}
+
+func deleteReleaseHookToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	name := chi.URLParam(r, "name")
+
+	tokens, err := store.ReleaseHookTokens()
+	if err != nil {
+		logrus.Errorf("cannot load release hook tokens: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+	remaining := []*model.ReleaseHookToken{}
+	for _, t := range tokens {
+		if t.Name != name {
+			remaining = append(remaining, t)
+		}
+	}
+	if len(remaining) == len(tokens) {
+		http.Error(w, fmt.Sprintf("%s: token %s doesn't exist", http.StatusText(http.StatusNotFound), name), http.StatusNotFound)
+		return
+	}
+
+	err = store.SaveReleaseHookTokens(remaining)
+	if err != nil {
+		logrus.Errorf("cannot save release hook tokens: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
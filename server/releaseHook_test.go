@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_releaseHook(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "admin", Admin: true}
+	ctx := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return context.WithValue(ctx, "user", user)
+	}
+
+	artifactEvent, _ := model.ToEvent(dx.Artifact{
+		ID:           "my-app-1",
+		Version:      dx.Version{RepositoryName: "my-app", SHA: "ea9ab7cc31b2599bf4afcfd639da516ca27a4780"},
+		Environments: []*dx.Manifest{{App: "my-app", Env: "staging"}, {App: "my-app", Env: "production"}},
+	})
+	_, err := store.CreateEvent(artifactEvent)
+	assert.Nil(t, err)
+
+	status, body, _ := testPostEndpoint(createReleaseHookToken, ctx, "/api/releaseHookTokens", `{"name":"jenkins","envs":["staging"]}`)
+	assert.Equal(t, http.StatusCreated, status)
+	var created releaseHookTokenResult
+	err = json.Unmarshal([]byte(body), &created)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, created.Token)
+
+	status, _, _ = testPostEndpoint(createReleaseHookToken, ctx, "/api/releaseHookTokens", `{"name":"jenkins","envs":["staging"]}`)
+	assert.Equal(t, http.StatusConflict, status, "token names should be unique")
+
+	hook := func(token string, path string, body string) (int, string) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		releaseHook(rr, req.WithContext(ctx(req.Context())))
+		return rr.Code, rr.Body.String()
+	}
+
+	status, _ = hook("invalid", "/hook/release", `{"app":"my-app","env":"staging","artifactId":"my-app-1"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, _, _ = testPostEndpoint(releaseHook, ctx, "/hook/release?token="+created.Token, `{"app":"my-app","env":"staging","artifactId":"my-app-1"}`)
+	assert.Equal(t, http.StatusUnauthorized, status, "should not accept the token in the query")
+
+	status, _ = hook(created.Token, "/hook/release", `{"app":"my-app","env":"production","artifactId":"my-app-1"}`)
+	assert.Equal(t, http.StatusForbidden, status, "should only release to the envs of the token")
+
+	status, _ = hook(created.Token, "/hook/release", `{"app":"other-app","env":"staging","artifactId":"my-app-1"}`)
+	assert.Equal(t, http.StatusBadRequest, status, "should not release an artifact to an app it has no manifest for")
+
+	status, _ = hook(created.Token, "/hook/release", `{"app":"my-app","env":"staging","imageTag":"0000000"}`)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, body = hook(created.Token, "/hook/release", `{"app":"my-app","env":"staging","imageTag":"ea9ab7cc"}`)
+	assert.Equal(t, http.StatusCreated, status, body)
+	var result eventIDResult
+	json.Unmarshal([]byte(body), &result)
+	event, err := store.Event(result.ID)
+	assert.Nil(t, err)
+	var releaseRequest dx.ReleaseRequest
+	json.Unmarshal([]byte(event.Blob), &releaseRequest)
+	assert.Equal(t, "my-app-1", releaseRequest.ArtifactID, "should find the artifact by its short sha")
+	assert.Equal(t, "hook:jenkins", releaseRequest.TriggeredBy)
+
+	status, body, _ = testEndpoint(getReleaseHookTokens, ctx, "/api/releaseHookTokens")
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotContains(t, body, "tokenHash")
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// getReleaseState returns the releases that the release state worker last found, optionally of one env
+func getReleaseState(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	releaseState, err := store.ReleaseState()
+	if err != nil {
+		logrus.Errorf("cannot get release state: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if env := r.URL.Query().Get("env"); env != "" {
+		envReleases := []*dx.AppReleaseState{}
+		for _, appRelease := range releaseState.Releases {
+			if appRelease.Env == env {
+				envReleases = append(envReleases, appRelease)
+			}
+		}
+		releaseState.Releases = envReleases
+	}
+
+	releaseStateString, err := json.Marshal(releaseState)
+	if err != nil {
+		logrus.Errorf("cannot serialize release state: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(releaseStateString)
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getReleaseState(t *testing.T) {
+	store := store.NewTest()
+	get := func(path string) *dx.ReleaseState {
+		req := httptest.NewRequest("GET", path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "store", store))
+		rr := httptest.NewRecorder()
+		getReleaseState(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var releaseState dx.ReleaseState
+		err := json.Unmarshal(rr.Body.Bytes(), &releaseState)
+		assert.Nil(t, err)
+		return &releaseState
+	}
+
+	assert.Empty(t, get("/api/releaseState").Releases, "should be empty before the worker runs")
+
+	err := store.SaveReleaseState(&dx.ReleaseState{
+		Updated: 1,
+		Releases: []*dx.AppReleaseState{
+			{Env: "staging", App: "my-app", GitopsRef: "abc"},
+			{Env: "production", App: "my-app", GitopsRef: "def"},
+		},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 2, len(get("/api/releaseState").Releases))
+	releaseState := get("/api/releaseState?env=production")
+	assert.Equal(t, 1, len(releaseState.Releases))
+	assert.Equal(t, "def", releaseState.Releases[0].GitopsRef)
+}
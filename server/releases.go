@@ -9,6 +9,10 @@ import (
 	"github.com/gimlet-io/gimletd/git/nativeGit"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gobwas/glob"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
@@ -21,6 +25,7 @@ import (
 func getReleases(w http.ResponseWriter, r *http.Request) {
 	var since, until *time.Time
 	var app, env, gitRepo string
+	var lifecycle bool
 	limit := 10
 
 	params := r.URL.Query()
@@ -62,12 +67,15 @@ func getReleases(w http.ResponseWriter, r *http.Request) {
 	if val, ok := params["git-repo"]; ok {
 		gitRepo = val[0]
 	}
+	if val, ok := params["lifecycle"]; ok {
+		lifecycle = val[0] == "true"
+	}
 
 	ctx := r.Context()
 	gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
 	gitopsRepo := ctx.Value("gitopsRepo").(string)
 
-	repo, pathToClanUp, err := gitopsRepoCache.InstanceForWrite() // using a copy of the repo to avoid concurrent map writes error
+	repo, pathToClanUp, err := gitopsRepoCache.EnvInstanceForWrite(env) // using a copy of the repo to avoid concurrent map writes error
 	defer gitopsRepoCache.CleanupWrittenRepo(pathToClanUp)
 	if err != nil {
 		logrus.Errorf("cannot get gitops repo for write: %s", err)
@@ -75,7 +83,7 @@ func getReleases(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	releases, err := nativeGit.Releases(repo, app, env, since, until, limit, gitRepo)
+	releases, err := nativeGit.Releases(repo, app, env, since, until, limit, gitRepo, lifecycle)
 	if err != nil {
 		logrus.Errorf("cannot get releases: %s", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -97,6 +105,98 @@ func getReleases(w http.ResponseWriter, r *http.Request) {
 	w.Write(releasesStr)
 }
 
+func getRenderedManifests(w http.ResponseWriter, r *http.Request) {
+	gitopsRef := chi.URLParam(r, "gitopsRef")
+
+	ctx := r.Context()
+	gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
+
+	manifests, err := renderedManifests(gitopsRepoCache, gitopsRef)
+	if err == plumbing.ErrObjectNotFound {
+		http.Error(w, fmt.Sprintf("%s - cannot find gitops commit %s", http.StatusText(http.StatusNotFound), gitopsRef), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Errorf("cannot get rendered manifests: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	manifestsStr, err := json.Marshal(manifests)
+	if err != nil {
+		logrus.Errorf("cannot serialize rendered manifests: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(manifestsStr)
+}
+
+// getShadowManifests returns the manifests of the last shadow deploy of the app to the env, see dx.Manifest.Shadow
+func getShadowManifests(w http.ResponseWriter, r *http.Request) {
+	env := chi.URLParam(r, "env")
+	app := chi.URLParam(r, "app")
+
+	ctx := r.Context()
+	gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
+
+	repo, releaseRepo := gitopsRepoCache.EnvInstanceForRead(env)
+	defer releaseRepo()
+	folder, err := nativeGit.Folder(repo, filepath.Join(dx.ShadowFolder, env, app))
+	files := map[string]string{}
+	for name, content := range folder {
+		if name != "release.json" {
+			files[name] = content
+		}
+	}
+	if err != nil || len(files) == 0 {
+		http.Error(w, fmt.Sprintf("%s - %s has no shadow deploy in %s", http.StatusText(http.StatusNotFound), app, env), http.StatusNotFound)
+		return
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		logrus.Errorf("cannot get gitops repo head: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	manifestsStr, err := json.Marshal(&dx.RenderedManifests{
+		Env:       env,
+		App:       app,
+		GitopsRef: head.Hash().String(),
+		Files:     files,
+		Shadow:    true,
+	})
+	if err != nil {
+		logrus.Errorf("cannot serialize shadow manifests: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(manifestsStr)
+}
+
+// renderedManifests looks up the gitops commit on every branch, as commits of an env are only on its own branch
+func renderedManifests(gitopsRepoCache *nativeGit.GitopsRepoCache, gitopsRef string) ([]*dx.RenderedManifests, error) {
+	for _, branch := range gitopsRepoCache.Branches() {
+		repo, pathToCleanUp, err := gitopsRepoCache.BranchInstanceForWrite(branch) // using a copy of the repo to avoid concurrent map writes error
+		if err != nil {
+			gitopsRepoCache.CleanupWrittenRepo(pathToCleanUp)
+			return nil, err
+		}
+
+		manifests, err := nativeGit.RenderedManifests(repo, gitopsRef)
+		gitopsRepoCache.CleanupWrittenRepo(pathToCleanUp)
+		if err != plumbing.ErrObjectNotFound {
+			return manifests, err
+		}
+	}
+	return nil, plumbing.ErrObjectNotFound
+}
+
 func getStatus(w http.ResponseWriter, r *http.Request) {
 	var app, env string
 
@@ -116,7 +216,9 @@ func getStatus(w http.ResponseWriter, r *http.Request) {
 	gitopsRepo := ctx.Value("gitopsRepo").(string)
 	perf := ctx.Value("perf").(*prometheus.HistogramVec)
 
-	appReleases, err := nativeGit.Status(gitopsRepoCache.InstanceForRead(), app, env, perf)
+	repo, releaseRepo := gitopsRepoCache.EnvInstanceForRead(env)
+	appReleases, err := nativeGit.Status(repo, app, env, perf)
+	releaseRepo()
 	if err != nil {
 		logrus.Errorf("cannot get status: %s", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -146,9 +248,20 @@ func release(w http.ResponseWriter, r *http.Request) {
 	store := ctx.Value("store").(*store.Store)
 	user := ctx.Value("user").(*model.User)
 
+	maintenance, err := store.Maintenance()
+	if err != nil {
+		logrus.Errorf("cannot load maintenance mode: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if maintenance.Enabled {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusServiceUnavailable), maintenanceMessage(maintenance)), http.StatusServiceUnavailable)
+		return
+	}
+
 	body, _ := ioutil.ReadAll(r.Body)
 	var releaseRequest dx.ReleaseRequest
-	err := json.NewDecoder(bytes.NewReader(body)).Decode(&releaseRequest)
+	err = json.NewDecoder(bytes.NewReader(body)).Decode(&releaseRequest)
 	if err != nil {
 		logrus.Errorf("cannot decode release request: %s", err)
 		http.Error(w, http.StatusText(400), 400)
@@ -170,6 +283,7 @@ func release(w http.ResponseWriter, r *http.Request) {
 		App:         releaseRequest.App,
 		ArtifactID:  releaseRequest.ArtifactID,
 		TriggeredBy: user.Login,
+		Redeploy:    releaseRequest.Redeploy,
 	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("%s - cannot serialize release request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
@@ -181,11 +295,33 @@ func release(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("%s - cannot find artifact with id %s", http.StatusText(http.StatusNotFound), releaseRequest.ArtifactID), http.StatusNotFound)
 		return
 	}
+	if artifact.Expired != 0 {
+		http.Error(w, fmt.Sprintf("%s: artifact %s is expired, its images may no longer exist", http.StatusText(http.StatusBadRequest), releaseRequest.ArtifactID), http.StatusBadRequest)
+		return
+	}
+
+	if releaseRequest.Redeploy {
+		gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
+		repo, pathToCleanUp, err := gitopsRepoCache.EnvInstanceForWrite(releaseRequest.Env) // using a copy of the repo to avoid concurrent map writes error
+		defer gitopsRepoCache.CleanupWrittenRepo(pathToCleanUp)
+		if err != nil {
+			logrus.Errorf("cannot get gitops repo for write: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		err = previouslyPassed(store, repo, artifact, releaseRequest.Env, releaseRequest.App)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: cannot redeploy: %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+			return
+		}
+	}
 	event, err := store.CreateEvent(&model.Event{
-		Type:         model.TypeRelease,
-		Blob:         string(releaseRequestStr),
-		Repository:   artifact.Repository,
-		GitopsHashes: []string{},
+		Type:          model.TypeRelease,
+		Blob:          string(releaseRequestStr),
+		Repository:    artifact.Repository,
+		GitopsHashes:  []string{},
+		CorrelationID: correlationIDFrom(ctx),
 	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("%s - cannot save release request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
@@ -226,11 +362,20 @@ func rollback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	force := params.Get("force") == "true"
+
+	gitopsRepoCache := ctx.Value("gitopsRepoCache").(*nativeGit.GitopsRepoCache)
+	if err := rollbackTargetExpired(store, gitopsRepoCache, env, app, targetSHA); err != nil {
+		http.Error(w, fmt.Sprintf("%s: cannot roll back: %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+		return
+	}
+
 	rollbackRequestStr, err := json.Marshal(dx.RollbackRequest{
 		Env:         env,
 		App:         app,
 		TargetSHA:   targetSHA,
 		TriggeredBy: user.Login,
+		Force:       force,
 	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("%s - cannot serialize rollback request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
@@ -238,8 +383,9 @@ func rollback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	event, err := store.CreateEvent(&model.Event{
-		Type: model.TypeRollback,
-		Blob: string(rollbackRequestStr),
+		Type:          model.TypeRollback,
+		Blob:          string(rollbackRequestStr),
+		CorrelationID: correlationIDFrom(ctx),
 	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("%s - cannot save rollback request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
@@ -254,6 +400,25 @@ func rollback(w http.ResponseWriter, r *http.Request) {
 	w.Write(eventIDBytes)
 }
 
+// rollbackTargetExpired refuses rollbacks to releases of expired artifacts, as their images may no longer exist.
+// Targets without release meta data are let through
+func rollbackTargetExpired(store *store.Store, gitopsRepoCache *nativeGit.GitopsRepoCache, env string, app string, targetSHA string) error {
+	repo, releaseRepo := gitopsRepoCache.EnvInstanceForRead(env)
+	release, err := nativeGit.ReleaseAt(repo, targetSHA, env, app)
+	releaseRepo()
+	if err != nil || release.ArtifactID == "" {
+		return nil
+	}
+	artifact, err := store.Artifact(release.ArtifactID)
+	if err != nil {
+		return nil
+	}
+	if artifact.Expired != 0 {
+		return fmt.Errorf("%s was released from artifact %s, that is expired", targetSHA, release.ArtifactID)
+	}
+	return nil
+}
+
 func delete(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user := ctx.Value("user").(*model.User)
@@ -275,7 +440,7 @@ func delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repo, pathToCleanUp, err := gitopsRepoCache.InstanceForWrite()
+	repo, pathToCleanUp, err := gitopsRepoCache.EnvInstanceForWrite(env)
 	defer gitopsRepoCache.CleanupWrittenRepo(pathToCleanUp)
 	if err != nil {
 		logrus.Errorf("cannot get gitops repo for write: %s", err)
@@ -303,19 +468,112 @@ func delete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	gitMessage := fmt.Sprintf("[GimletD delete] %s/%s deleted by %s", env, app, user.Login)
-	_, err = nativeGit.Commit(repo, gitMessage)
+	_, err = nativeGit.Commit(repo, nativeGit.WithCorrelationTrailer(gitMessage, correlationIDFrom(ctx)))
 
 	t0 := time.Now().UnixNano()
 	head, _ := repo.Head()
 	err = nativeGit.NativePush(pathToCleanUp, gitopsRepoDeployKeyPath, head.Name().Short())
 	logrus.Infof("Pushing took %d", (time.Now().UnixNano()-t0)/1000/1000)
 
-	gitopsRepoCache.Invalidate()
+	gitopsRepoCache.InvalidateBranch(gitopsRepoCache.Branch(env))
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("{}"))
 }
 
+func compact(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	user := ctx.Value("user").(*model.User)
+
+	params := r.URL.Query()
+	var before time.Time
+	if val, ok := params["before"]; ok {
+		t, err := time.Parse(time.RFC3339, val[0])
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		before = t
+	} else {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "before parameter is mandatory"), http.StatusBadRequest)
+		return
+	}
+
+	env := params.Get("env")
+	app := params.Get("app")
+	if env == "" || app == "" {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "env and app parameters are mandatory"), http.StatusBadRequest)
+		return
+	}
+	if _, err := glob.Compile(app); err != nil {
+		http.Error(w, fmt.Sprintf("%s: invalid app pattern: %s", http.StatusText(http.StatusBadRequest), err), http.StatusBadRequest)
+		return
+	}
+
+	compactionRequestStr, err := json.Marshal(dx.CompactionRequest{
+		Before:      before.Unix(),
+		Env:         env,
+		App:         app,
+		TriggeredBy: user.Login,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - cannot serialize compaction request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+
+	event, err := store.CreateEvent(&model.Event{
+		Type:          model.TypeCompaction,
+		Blob:          string(compactionRequestStr),
+		GitopsHashes:  []string{},
+		CorrelationID: correlationIDFrom(ctx),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s - cannot save compaction request: %s", http.StatusText(http.StatusInternalServerError), err), http.StatusInternalServerError)
+		return
+	}
+
+	eventIDBytes, _ := json.Marshal(map[string]string{
+		"id": event.ID,
+	})
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(eventIDBytes)
+}
+
+func getEventLogs(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "id parameter is mandatory"), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	event, err := store.Event(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("cannot get event: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	lines := event.Logs
+	if lines == nil {
+		lines = []string{}
+	}
+	logsBytes, _ := json.Marshal(dx.EventLogs{
+		ID:     event.ID,
+		Status: event.Status,
+		Lines:  lines,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(logsBytes)
+}
+
 func getEvent(w http.ResponseWriter, r *http.Request) {
 	var id string
 
@@ -361,11 +619,79 @@ func getEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	statusBytes, _ := json.Marshal(dx.ReleaseStatus{
-		Status:       event.Status,
-		StatusDesc:   event.StatusDesc,
-		GitopsHashes: gitopsStatus,
+		Status:        event.Status,
+		StatusDesc:    event.StatusDesc,
+		GitopsHashes:  gitopsStatus,
+		CorrelationID: event.CorrelationID,
+		Envs:          event.EnvStatuses,
 	})
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(statusBytes)
 }
+
+// previouslyPassed checks that the artifact was deployed to the env before, for every app of the release,
+// and that the deploy was not rolled back or failed to apply
+func previouslyPassed(store *store.Store, repo *git.Repository, artifactEvent *model.Event, env string, app string) error {
+	artifact, err := model.ToArtifact(artifactEvent)
+	if err != nil {
+		return err
+	}
+	manifests, err := dx.ExpandVariants(artifact.Environments)
+	if err != nil {
+		return err
+	}
+
+	var apps []string
+	for _, m := range manifests {
+		if m.Env != env {
+			continue
+		}
+		err = m.ResolveVars(artifact.Vars())
+		if err != nil {
+			return err
+		}
+		if app != "" && m.App != app && m.BaseApp() != app {
+			continue
+		}
+		apps = append(apps, m.App)
+	}
+	if len(apps) == 0 {
+		return fmt.Errorf("artifact %s has no manifest for %s", artifact.ID, env)
+	}
+
+	for _, app := range apps {
+		releases, err := nativeGit.Releases(repo, app, env, nil, nil, -1, "", false)
+		if err != nil {
+			return err
+		}
+
+		passed := false
+		for _, release := range releases {
+			if release.ArtifactID != artifact.ID || release.RolledBack {
+				continue
+			}
+			gitopsCommit, err := store.GitopsCommit(release.GitopsRef)
+			if err != nil {
+				return err
+			}
+			if gitopsCommit != nil && failedToApply(gitopsCommit) {
+				continue
+			}
+			passed = true
+			break
+		}
+		if !passed {
+			return fmt.Errorf("artifact %s was not deployed to %s/%s successfully before", artifact.ID, env, app)
+		}
+	}
+	return nil
+}
+
+func failedToApply(gitopsCommit *model.GitopsCommit) bool {
+	switch gitopsCommit.Status {
+	case model.ValidationFailed, model.ReconciliationFailed, model.HealthCheckFailed:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_previouslyPassed(t *testing.T) {
+	store := store.NewTest()
+	repo, _ := git.Init(memory.NewStorage(), memfs.New())
+	nativeGit.CommitFilesToGit(repo, map[string]string{"file": "0"}, "production", "other-app", "init", "{}")
+
+	artifactEvent := func(id string) *model.Event {
+		event, err := model.ToEvent(dx.Artifact{
+			ID:           id,
+			Version:      dx.Version{RepositoryName: "my-app"},
+			Environments: []*dx.Manifest{{App: "my-app", Env: "production"}},
+		})
+		assert.Nil(t, err)
+		return event
+	}
+
+	deployed := artifactEvent("my-app-1")
+	sha, err := nativeGit.CommitFilesToGit(repo, map[string]string{"file": "1"}, "production", "my-app", "deploy",
+		`{"app":"my-app","env":"production","artifactId":"my-app-1"}`)
+	assert.Nil(t, err)
+	err = previouslyPassed(store, repo, deployed, "production", "")
+	assert.Nil(t, err)
+	err = previouslyPassed(store, repo, deployed, "production", "my-app")
+	assert.Nil(t, err)
+
+	err = previouslyPassed(store, repo, artifactEvent("my-app-2"), "production", "")
+	assert.NotNil(t, err, "should not redeploy an artifact that was never deployed to the env")
+
+	err = previouslyPassed(store, repo, deployed, "staging", "")
+	assert.NotNil(t, err, "should not redeploy to an env without a manifest")
+
+	err = store.SaveOrUpdateGitopsCommit(&model.GitopsCommit{Sha: sha, Status: model.HealthCheckFailed})
+	assert.Nil(t, err)
+	err = previouslyPassed(store, repo, deployed, "production", "")
+	assert.NotNil(t, err, "should not redeploy an artifact that failed to apply")
+}
+
+func Test_releaseExpiredArtifact(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "admin", Admin: true}
+	ctx := func(ctx context.Context) context.Context {
+		ctx = context.WithValue(ctx, "store", store)
+		return context.WithValue(ctx, "user", user)
+	}
+
+	artifactEvent, _ := model.ToEvent(dx.Artifact{ID: "my-app-1", Version: dx.Version{RepositoryName: "my-app"}})
+	_, err := store.CreateEvent(artifactEvent)
+	assert.Nil(t, err)
+	err = store.ExpireArtifact("my-app-1")
+	assert.Nil(t, err)
+
+	status, body, _ := testPostEndpoint(release, ctx, "/api/releases", `{"env":"staging","artifactId":"my-app-1"}`)
+	assert.Equal(t, http.StatusBadRequest, status, "expired artifacts should not be released")
+	assert.Contains(t, body, "expired")
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gimlet-io/gimletd/dora"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+// getRepositoryStats returns the pipeline health metrics of a repository.
+// Repository names with an owner, like gimlet-io/gimletd, are passed url encoded
+func getRepositoryStats(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(chi.URLParam(r, "name"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+" - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	stats, err := dora.RepositoryStats(store, name)
+	if err != nil {
+		logrus.Errorf("cannot compute repository stats: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if stats.Artifacts == 0 && len(stats.LastDeploys) == 0 {
+		http.Error(w, fmt.Sprintf("%s - repository %s has no artifacts", http.StatusText(http.StatusNotFound), name), http.StatusNotFound)
+		return
+	}
+
+	statsStr, err := json.Marshal(stats)
+	if err != nil {
+		logrus.Errorf("cannot serialize repository stats: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(statsStr)
+}
@@ -1,10 +1,12 @@
 package server
 
 import (
-	"encoding/json"
+	"crypto"
 	"github.com/gimlet-io/gimletd/cmd/config"
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/git/nativeGit"
 	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/server/oidc"
 	"github.com/gimlet-io/gimletd/server/session"
 	"github.com/gimlet-io/gimletd/store"
 	"github.com/go-chi/chi"
@@ -12,6 +14,7 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/prometheus/client_golang/prometheus"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -23,7 +26,15 @@ func SetupRouter(
 	perf *prometheus.HistogramVec,
 ) *chi.Mux {
 	r := chi.NewRouter()
+	if config.AllowedCIDRs != "" {
+		allowlist, err := ipAllowlist(config.AllowedCIDRs)
+		if err != nil {
+			panic(err)
+		}
+		r.Use(allowlist) // before RealIP, so forwarded headers can't spoof the client address
+	}
 	r.Use(middleware.RequestID)
+	r.Use(correlationID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
@@ -31,58 +42,153 @@ func SetupRouter(
 	r.Use(middleware.Timeout(60 * time.Second))
 
 	r.Use(middleware.WithValue("store", store))
+	r.Use(middleware.WithValue("readStore", readReplica(config.Database, store)))
 	r.Use(middleware.WithValue("notificationsManager", notificationsManager))
 	r.Use(middleware.WithValue("gitopsRepo", config.GitopsRepo))
 	r.Use(middleware.WithValue("gitopsRepoDeployKeyPath", config.GitopsRepoDeployKeyPath))
 	r.Use(middleware.WithValue("gitopsRepoCache", repoCache))
+	r.Use(middleware.WithValue("gitopsRepoWebhookSecret", config.GitopsRepoWebhookSecret))
+	r.Use(middleware.WithValue("registryWebhookSecret", config.RegistryWebhookSecret))
 	r.Use(middleware.WithValue("perf", perf))
+	r.Use(middleware.WithValue("adminToken", config.AdminToken))
+	r.Use(middleware.WithValue("artifactRepoAllowlist", configuredRepoAllowlist(config.ArtifactRepoAllowlist)))
 
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:8888", config.Host},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
+	var signingKeys []crypto.PublicKey
+	if config.ArtifactSigning.PublicKeysPath != "" {
+		keys, err := dx.LoadPublicKeys(config.ArtifactSigning.PublicKeysPath)
+		if err != nil {
+			panic(err)
+		}
+		signingKeys = keys
+	}
+	r.Use(middleware.WithValue("signingKeys", signingKeys))
+
+	envs := map[string]*dx.Env{}
+	if config.EnvsConfigPath != "" {
+		registry, err := dx.LoadEnvs(config.EnvsConfigPath)
+		if err != nil {
+			panic(err)
+		}
+		envs = registry
+	}
+	r.Use(middleware.WithValue("envs", envs))
+
+	var rbacRules []*dx.RBACRule
+	if config.RBACRules != "" {
+		rules, err := dx.ParseRBACRules(config.RBACRules)
+		if err != nil {
+			panic(err)
+		}
+		rbacRules = rules
+	}
+	r.Use(middleware.WithValue("rbacRules", rbacRules))
+
+	if config.OIDC.Issuer != "" {
+		redirectURL := config.OIDC.RedirectURL
+		if redirectURL == "" {
+			redirectURL = strings.TrimSuffix(config.Host, "/") + "/auth/oidc/callback"
+		}
+		var scopes []string
+		for _, scope := range strings.Split(config.OIDC.Scopes, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+		r.Use(middleware.WithValue("sso", &sso{
+			provider:    oidc.NewProvider(config.OIDC.Issuer, config.OIDC.ClientID, config.OIDC.ClientSecret, redirectURL, scopes),
+			loginClaim:  config.OIDC.LoginClaim,
+			groupsClaim: config.OIDC.GroupsClaim,
+			tokenTTL:    config.OIDC.TokenTTL,
+			host:        config.Host,
+		}))
+	}
+
+	r.Use(cors.Handler(corsOptions(config.CORS, config.Host)))
 
 	r.Group(func(r chi.Router) {
+		if config.TLS.ClientCAPath != "" {
+			r.Use(mustClientCert)
+		}
 		r.Use(session.SetUser())
 		r.Use(session.MustUser())
 		r.Post("/api/artifact", saveArtifact)
 		r.Get("/api/artifacts", getArtifacts)
+		r.Post("/api/artifacts/{id}/reevaluate", reevaluateArtifact)
 		r.Get("/api/releases", getReleases)
+		r.Get("/api/releases/diff", getReleaseDiff)
+		r.Get("/api/releases/{gitopsRef}/manifests", getRenderedManifests)
+		r.Get("/api/shadow/{env}/{app}", getShadowManifests)
 		r.Get("/api/status", getStatus)
+		r.Get("/api/bom", getBOM)
+		r.Get("/api/releaseState", getReleaseState)
+		r.Get("/api/drift", getDrift)
+		r.Get("/api/maintenance", getMaintenance)
+		r.Get("/api/freeze", getFreezes)
+		r.Get("/api/envSync", getEnvSyncs)
+		r.Post("/api/freeze/{env}/{app}", freeze)
+		r.Delete("/api/freeze/{env}/{app}", unfreeze)
+		r.Get("/api/metrics/dora", getDoraMetrics)
+		r.Get("/api/repositories/{name}/stats", getRepositoryStats)
 		r.Post("/api/releases", release)
 		r.Post("/api/rollback", rollback)
 		r.Post("/api/delete", delete)
 		r.Get("/api/event", getEvent)
+		r.Get("/api/event/logs", getEventLogs)
+		r.Get("/api/me", getMe)
 		r.Post("/api/flux-events", fluxEvent)
-
-		r.Get("/api/gitopsRepo", func(w http.ResponseWriter, r *http.Request) {
-			gitopsRepo := r.Context().Value("gitopsRepo").(string)
-			gitopsRepoJson, _ := json.Marshal(GitopsRepoResult{GitopsRepo: gitopsRepo})
-			w.WriteHeader(http.StatusOK)
-			w.Write(gitopsRepoJson)
-		})
+		r.Get("/api/gitopsRepo", getGitopsRepo)
+		r.Get("/api/artifactCallbacks", getArtifactCallbacks)
+		r.Post("/api/artifactCallbacks", createArtifactCallback)
+		r.Delete("/api/artifactCallbacks/{id}", deleteArtifactCallback)
 	})
 
 	r.Group(func(r chi.Router) {
+		if config.TLS.ClientCAPath != "" {
+			r.Use(mustClientCert)
+		}
 		r.Use(session.SetUser())
 		r.Use(session.MustAdmin())
 		r.Get("/api/user/{login}", getUser)
 		r.Post("/api/user", saveUser)
 		r.Delete("/api/user/{login}", deleteUser)
 		r.Get("/api/users", getUsers)
+		r.Get("/api/groups", getGroups)
+		r.Post("/api/deployKey/rotate", rotateDeployKey)
+		r.Post("/api/deployKey/activate", activateDeployKey)
+		r.Get("/api/deployKey/rotations", getDeployKeyRotations)
+		r.Get("/api/releaseHookTokens", getReleaseHookTokens)
+		r.Post("/api/releaseHookTokens", createReleaseHookToken)
+		r.Delete("/api/releaseHookTokens/{name}", deleteReleaseHookToken)
+		r.Get("/api/artifactRepoAllowlist", getArtifactRepoAllowlist)
+		r.Post("/api/artifactRepoAllowlist", allowArtifactRepo)
+		r.Delete("/api/artifactRepoAllowlist", disallowArtifactRepo)
+		r.Post("/api/compact", compact)
+		r.Delete("/api/apps/{env}/{app}", deleteApp)
+		r.Post("/api/maintenance", maintenance)
+		r.Post("/api/envSync/{env}/override", overrideEnvSync)
+		r.Delete("/api/envSync/{env}/override", deleteEnvSyncOverride)
+		r.Delete("/api/gitopsRepo/historyRewrite", acknowledgeHistoryRewrite)
 	})
 
+	if config.PublicEndpoints {
+		r.Get("/api/public/status", getPublicStatus)
+		r.Get("/api/public/badge/{env}/{app}", getBadge)
+	}
+
+	if config.OIDC.Issuer != "" {
+		r.Get("/auth/oidc/login", oidcLogin)
+		r.Get("/auth/oidc/callback", oidcCallback)
+		r.Post("/auth/oidc/token", oidcToken)
+	}
+
+	r.Post("/api/gitops-webhook", gitopsRepoWebhook)
+	r.Post("/hook/registry/{provider}", registryWebhook)
+	r.Post("/hook/release", releaseHook)
+	r.Get("/api/openapi.json", getOpenAPI(r))
+
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
 
 	return r
 }
-
-type GitopsRepoResult struct {
-	GitopsRepo string `json:"gitopsRepo"`
-}
@@ -65,3 +65,32 @@ func Test_MustUser(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode, "should authorize a user with token")
 }
+
+func Test_CORS(t *testing.T) {
+	router := SetupRouter(
+		&config.Config{CORS: config.CORS{AllowedOrigins: "https://dashboard.example.com", AllowCredentials: "false"}},
+		store.NewTest(),
+		nil,
+		nil,
+		nil,
+	)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	preflight := func(origin string) *http.Response {
+		req, _ := http.NewRequest("OPTIONS", server.URL+"/api/artifacts", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		req.Header.Set("Access-Control-Request-Headers", "Authorization")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		return resp
+	}
+
+	resp := preflight("https://dashboard.example.com")
+	assert.Equal(t, "https://dashboard.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", resp.Header.Get("Access-Control-Allow-Credentials"), "credentials should be disallowed")
+
+	resp = preflight("https://evil.example.com")
+	assert.Equal(t, "", resp.Header.Get("Access-Control-Allow-Origin"), "other origins should not be allowed")
+}
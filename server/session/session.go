@@ -17,10 +17,14 @@ package session
 
 import (
 	"context"
+	"crypto/subtle"
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/server/token"
 	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
 	"net/http"
+	"strings"
 )
 
 func SetUser() func(next http.Handler) http.Handler {
@@ -31,6 +35,18 @@ func SetUser() func(next http.Handler) http.Handler {
 			ctx := r.Context()
 			store := ctx.Value("store").(*store.Store)
 
+			// the admin token from the config authenticates the admin user, without a signed token
+			if adminToken, _ := ctx.Value("adminToken").(string); adminToken != "" && isAdminToken(r, adminToken) {
+				admin, err := store.User("admin")
+				if err == nil {
+					r = r.WithContext(context.WithValue(r.Context(), "user", admin))
+					r = r.WithContext(context.WithValue(r.Context(), "token", token.New(token.UserToken, admin.Login)))
+					next.ServeHTTP(w, r)
+					return
+				}
+				logrus.Errorf("cannot get the admin user: %s", err)
+			}
+
 			t, err := token.ParseRequest(r, func(t *token.Token) (string, error) {
 				var err error
 				user, err = store.User(t.Subject)
@@ -41,6 +57,7 @@ func SetUser() func(next http.Handler) http.Handler {
 			})
 			if err == nil {
 				r = r.WithContext(context.WithValue(r.Context(), "user", user))
+				r = r.WithContext(context.WithValue(r.Context(), "token", t))
 
 				// if this is a session token (ie not the API token)
 				// this means the user is accessing with a web browser,
@@ -63,6 +80,12 @@ func SetUser() func(next http.Handler) http.Handler {
 	}
 }
 
+// isAdminToken tells if the request's bearer token is the admin token
+func isAdminToken(r *http.Request, adminToken string) bool {
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(bearer), []byte(adminToken)) == 1
+}
+
 // SetCSRF sets the X-CSRF-TOKEN header with a signed token to prevent CSRF
 func SetCSRF() func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -101,6 +124,26 @@ func MustUser() func(next http.Handler) http.Handler {
 	}
 }
 
+// IsAdmin tells if the user is admin, either by the admin flag,
+// or by an RBAC rule that grants the admin role to one of her groups
+func IsAdmin(ctx context.Context, user *model.User) bool {
+	if user.Admin {
+		return true
+	}
+
+	rules, _ := ctx.Value("rbacRules").([]*dx.RBACRule)
+	if len(rules) == 0 {
+		return false
+	}
+	store := ctx.Value("store").(*store.Store)
+	groups, err := store.GroupsOf(user.Login)
+	if err != nil {
+		logrus.Errorf("cannot get the groups of %s: %s", user.Login, err)
+		return false
+	}
+	return dx.GrantsRole(rules, groups, dx.RoleAdmin)
+}
+
 // MustAdmin makes sure there is an authenticated user set and she is admin
 func MustAdmin() func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -109,7 +152,7 @@ func MustAdmin() func(next http.Handler) http.Handler {
 			user, userSet := ctx.Value("user").(*model.User)
 			if !userSet {
 				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			} else if user.Admin {
+			} else if IsAdmin(ctx, user) {
 				next.ServeHTTP(w, r)
 			} else {
 				http.Error(w, http.StatusText(http.StatusForbidden) + " admin user is required", http.StatusForbidden)
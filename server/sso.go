@@ -0,0 +1,277 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/server/oidc"
+	"github.com/gimlet-io/gimletd/server/token"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gorilla/securecookie"
+	"github.com/sirupsen/logrus"
+)
+
+const oidcStateCookie = "oidc_state"
+const sessionCookie = "user_sess"
+
+// sso holds the OpenID Connect login settings of human users
+type sso struct {
+	provider    *oidc.Provider
+	loginClaim  string
+	groupsClaim string
+	tokenTTL    time.Duration
+	// host is where the browser is redirected after login
+	host string
+}
+
+type ssoTokenRequest struct {
+	IDToken string `json:"idToken"`
+}
+
+// ssoTokenResult is a short-lived GimletD token of an SSO user
+type ssoTokenResult struct {
+	Login     string `json:"login"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// oidcLogin redirects the browser to the login page of the OIDC provider
+func oidcLogin(w http.ResponseWriter, r *http.Request) {
+	sso := r.Context().Value("sso").(*sso)
+
+	state, err := randomHex()
+	if err != nil {
+		logrus.Errorf("cannot generate oidc state: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomHex()
+	if err != nil {
+		logrus.Errorf("cannot generate oidc nonce: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	authCodeURL, err := sso.provider.AuthCodeURL(state, nonce)
+	if err != nil {
+		logrus.Errorf("cannot start oidc login: %s", err)
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadGateway), "oidc provider is unavailable"), http.StatusBadGateway)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state + "." + nonce,
+		Path:     "/auth/oidc",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   secureCookies(r, sso.host),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authCodeURL, http.StatusFound)
+}
+
+// oidcCallback completes the login of the OIDC provider, and sets a session cookie that expires with the token TTL
+func oidcCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	sso := ctx.Value("sso").(*sso)
+
+	if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+		http.Error(w, fmt.Sprintf("%s: %s %s", http.StatusText(http.StatusUnauthorized), errorCode, r.URL.Query().Get("error_description")), http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "login is not started or expired"), http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+	parts := strings.SplitN(cookie.Value, ".", 2)
+	if len(parts) != 2 || parts[0] != r.URL.Query().Get("state") {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "login state doesn't match"), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := sso.provider.Exchange(ctx, r.URL.Query().Get("code"), parts[1])
+	if err != nil {
+		logrus.Warnf("oidc login failed: %s", err)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := ssoUser(store, sso, rbacRulesOf(r), claims)
+	if err != nil {
+		logrus.Warnf("oidc login failed: %s", err)
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+		return
+	}
+
+	expiresAt := time.Now().Add(sso.tokenTTL)
+	sessionToken, err := token.New(token.SessToken, user.Login).SignExpires(user.Secret, expiresAt.Unix())
+	if err != nil {
+		logrus.Errorf("couldn't create session token %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("%s logged in with oidc", user.Login)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sessionToken,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   secureCookies(r, sso.host),
+		SameSite: http.SameSiteLaxMode,
+	})
+	redirect := "/"
+	if sso.host != "" {
+		redirect = strings.TrimSuffix(sso.host, "/") + "/"
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// oidcToken exchanges an ID token of the OIDC provider to a short-lived GimletD token, eg. for the CLI
+func oidcToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+	sso := ctx.Value("sso").(*sso)
+
+	var request ssoTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.IDToken == "" {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "idToken parameter is mandatory"), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := sso.provider.Verify(request.IDToken)
+	if err != nil {
+		logrus.Warnf("oidc token exchange failed: %s", err)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := ssoUser(store, sso, rbacRulesOf(r), claims)
+	if err != nil {
+		logrus.Warnf("oidc token exchange failed: %s", err)
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusForbidden), err), http.StatusForbidden)
+		return
+	}
+
+	expiresAt := time.Now().Add(sso.tokenTTL).Unix()
+	userToken, err := token.New(token.UserToken, user.Login).SignExpires(user.Secret, expiresAt)
+	if err != nil {
+		logrus.Errorf("couldn't create user token %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	resultString, err := json.Marshal(ssoTokenResult{
+		Login:     user.Login,
+		Token:     userToken,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		logrus.Errorf("cannot serialize token: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(resultString)
+}
+
+// ssoLoginPrefix namespaces the users that were created at OIDC login,
+// so an identity of the OIDC provider can't log in as a static or machine user of the same name
+const ssoLoginPrefix = "sso:"
+
+// emailVerified reads the email_verified claim, some providers send it as a string
+func emailVerified(claims jwt.MapClaims) (verified bool, present bool) {
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		return v, true
+	case string:
+		return v == "true", true
+	}
+	return false, false
+}
+
+// ssoUser returns the GimletD user of the ID token claims, it is created at first login.
+// With RBAC rules set, the admin flag of the user follows the groups in the token
+func ssoUser(store *store.Store, sso *sso, rules []*dx.RBACRule, claims jwt.MapClaims) (*model.User, error) {
+	claim, _ := claims[sso.loginClaim].(string)
+	if claim == "" {
+		return nil, fmt.Errorf("id token has no %s claim", sso.loginClaim)
+	}
+	// email logins need a verified email, other logins are only refused if the email is known to be unverified
+	verified, present := emailVerified(claims)
+	if !verified && (present || sso.loginClaim == "email") {
+		return nil, fmt.Errorf("email of %s is not verified", claim)
+	}
+	login := ssoLoginPrefix + claim
+
+	user, err := store.User(login)
+	if err == sql.ErrNoRows {
+		user = &model.User{
+			Login:  login,
+			Secret: base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)),
+		}
+		err = store.CreateUser(user)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create user %s: %s", login, err)
+		}
+		logrus.Infof("user %s is created at first oidc login", login)
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get user %s: %s", login, err)
+	}
+
+	groupsClaim, hasGroups := claims[sso.groupsClaim].([]interface{})
+	if len(rules) > 0 && hasGroups {
+		var groups []string
+		for _, g := range groupsClaim {
+			if group, ok := g.(string); ok {
+				groups = append(groups, group)
+			}
+		}
+		admin := dx.GrantsRole(rules, groups, dx.RoleAdmin)
+		if user.Admin != admin {
+			user.Admin = admin
+			err = store.UpdateUser(user)
+			if err != nil {
+				return nil, fmt.Errorf("cannot update user %s: %s", login, err)
+			}
+		}
+	}
+
+	return user, nil
+}
+
+func rbacRulesOf(r *http.Request) []*dx.RBACRule {
+	rules, _ := r.Context().Value("rbacRules").([]*dx.RBACRule)
+	return rules
+}
+
+func secureCookies(r *http.Request, host string) bool {
+	return r.TLS != nil || strings.HasPrefix(host, "https://")
+}
+
+func randomHex() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
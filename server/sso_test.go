@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/server/token"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ssoUser(t *testing.T) {
+	store := store.NewTest()
+	sso := &sso{loginClaim: "email", groupsClaim: "groups", tokenTTL: time.Hour}
+	rules := []*dx.RBACRule{{Group: "platform", Role: dx.RoleAdmin}}
+
+	_, err := ssoUser(store, sso, rules, jwt.MapClaims{"sub": "123"})
+	assert.NotNil(t, err, "should need the login claim")
+
+	_, err = ssoUser(store, sso, rules, jwt.MapClaims{"email": "jane@example.com", "email_verified": false})
+	assert.NotNil(t, err, "should not log in with unverified emails")
+	_, err = ssoUser(store, sso, rules, jwt.MapClaims{"email": "jane@example.com"})
+	assert.NotNil(t, err, "should not log in with emails that are not known to be verified")
+	_, err = ssoUser(store, sso, rules, jwt.MapClaims{"email": "jane@example.com", "email_verified": "false"})
+	assert.NotNil(t, err, "should not log in with unverified emails sent as strings")
+	usernameSSO := *sso
+	usernameSSO.loginClaim = "preferred_username"
+	_, err = ssoUser(store, &usernameSSO, rules, jwt.MapClaims{"preferred_username": "jane", "email_verified": false})
+	assert.NotNil(t, err, "should not log in with unverified emails, whatever the login claim is")
+	_, err = ssoUser(store, &usernameSSO, rules, jwt.MapClaims{"preferred_username": "jane", "email_verified": "false"})
+	assert.NotNil(t, err, "should not log in with unverified emails sent as strings, whatever the login claim is")
+
+	user, err := ssoUser(store, sso, rules, jwt.MapClaims{"email": "jane@example.com", "email_verified": true, "groups": []interface{}{"developers"}})
+	assert.Nil(t, err)
+	assert.False(t, user.Admin)
+	assert.NotEmpty(t, user.Secret)
+	stored, err := store.User("sso:jane@example.com")
+	assert.Nil(t, err, "should create the user at first login")
+	assert.Equal(t, user.Secret, stored.Secret)
+
+	user, err = ssoUser(store, sso, rules, jwt.MapClaims{"email": "jane@example.com", "email_verified": true, "groups": []interface{}{"developers", "platform"}})
+	assert.Nil(t, err)
+	assert.True(t, user.Admin, "should be admin through the groups of the token")
+	stored, _ = store.User("sso:jane@example.com")
+	assert.True(t, stored.Admin)
+	assert.Equal(t, user.Secret, stored.Secret, "should keep the secret of the user")
+
+	user, err = ssoUser(store, sso, nil, jwt.MapClaims{"email": "jane@example.com", "email_verified": "true", "groups": []interface{}{}})
+	assert.Nil(t, err)
+	assert.True(t, user.Admin, "should not change the admin flag without RBAC rules")
+
+	expired, err := token.New(token.UserToken, user.Login).SignExpires(user.Secret, time.Now().Add(-time.Minute).Unix())
+	assert.Nil(t, err)
+	_, err = token.Parse(expired, func(t *token.Token) (string, error) { return user.Secret, nil })
+	assert.NotNil(t, err, "expired tokens should be rejected")
+
+	valid, _ := token.New(token.UserToken, user.Login).SignExpires(user.Secret, time.Now().Add(sso.tokenTTL).Unix())
+	parsed, err := token.Parse(valid, func(t *token.Token) (string, error) { return user.Secret, nil })
+	assert.Nil(t, err)
+	assert.Equal(t, "sso:jane@example.com", parsed.Subject)
+}
+
+func Test_ssoUserNamespace(t *testing.T) {
+	store := store.NewTest()
+	sso := &sso{loginClaim: "preferred_username", groupsClaim: "groups", tokenTTL: time.Hour}
+	rules := []*dx.RBACRule{{Group: "platform", Role: dx.RoleAdmin}}
+
+	admin := &model.User{Login: "admin", Secret: "admin-secret", Admin: true}
+	err := store.CreateUser(admin)
+	assert.Nil(t, err)
+
+	user, err := ssoUser(store, sso, rules, jwt.MapClaims{"preferred_username": "admin", "groups": []interface{}{"developers"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "sso:admin", user.Login, "oidc identities should not log in as the static users")
+	assert.NotEqual(t, admin.Secret, user.Secret)
+	assert.False(t, user.Admin)
+
+	stored, err := store.User("admin")
+	assert.Nil(t, err)
+	assert.True(t, stored.Admin, "oidc groups should not change the static users")
+
+	status, _, _ := testPostEndpoint(saveUser, func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, "store", store)
+	}, "/api/user", `{"login":"sso:jane"}`)
+	assert.Equal(t, http.StatusBadRequest, status, "only oidc logins should create users in the sso namespace")
+}
@@ -46,6 +46,10 @@ const SignerAlgo = "HS256"
 type Token struct {
 	Kind    string
 	Subject string
+
+	// IssuedAt and ExpiresAt are set on parsed tokens, zero ExpiresAt means no expiry
+	IssuedAt  int64
+	ExpiresAt int64
 }
 
 // Parse parses a JWT token
@@ -57,6 +61,9 @@ func Parse(raw string, fn SecretFunc) (*Token, error) {
 	} else if !parsed.Valid {
 		return nil, jwt.ValidationError{}
 	}
+	if token.ExpiresAt != 0 && time.Now().Unix() > token.ExpiresAt {
+		return nil, jwt.NewValidationError("token is expired", jwt.ValidationErrorExpired)
+	}
 	return token, nil
 }
 
@@ -144,6 +151,8 @@ func keyFunc(token *Token, fn SecretFunc) jwt.Keyfunc {
 		claims := t.Claims.(*gimletClaims)
 		token.Kind = claims.Type
 		token.Subject = claims.Subject
+		token.IssuedAt = claims.IssuedAt
+		token.ExpiresAt = claims.ExpiresAt
 
 		// invoke the callback function to retrieve
 		// the secret key used to verify
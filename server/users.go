@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"encoding/base32"
 	"encoding/json"
+	"fmt"
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/server/session"
 	"github.com/gimlet-io/gimletd/server/token"
 	"github.com/gimlet-io/gimletd/store"
 	"github.com/go-chi/chi"
@@ -12,6 +15,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
 	"net/http"
+	"strings"
 )
 
 func getUsers(w http.ResponseWriter, r *http.Request) {
@@ -101,6 +105,11 @@ func saveUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if strings.HasPrefix(user.Login, ssoLoginPrefix) {
+		http.Error(w, fmt.Sprintf("%s: %s", http.StatusText(http.StatusBadRequest), "the "+ssoLoginPrefix+" prefix is reserved for the users of OIDC logins"), http.StatusBadRequest)
+		return
+	}
+
 	user.Secret = base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32))
 
 	ctx := r.Context()
@@ -133,3 +142,64 @@ func saveUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	w.Write(userString)
 }
+
+func getMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := ctx.Value("user").(*model.User)
+
+	store := ctx.Value("store").(*store.Store)
+	groups, err := store.GroupsOf(user.Login)
+	if err != nil {
+		logrus.Errorf("cannot get the groups of %s: %s", user.Login, err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	identity := dx.Identity{
+		Login:  user.Login,
+		Roles:  []string{"user"},
+		Groups: groups,
+		Scopes: []string{"read", "write"},
+	}
+	if session.IsAdmin(ctx, user) {
+		identity.Roles = append(identity.Roles, "admin")
+		identity.Scopes = append(identity.Scopes, "admin")
+	}
+	if t, ok := ctx.Value("token").(*token.Token); ok {
+		identity.TokenKind = t.Kind
+		identity.TokenIssuedAt = t.IssuedAt
+		identity.TokenExpiresAt = t.ExpiresAt
+	}
+
+	identityString, err := json.Marshal(identity)
+	if err != nil {
+		logrus.Errorf("cannot serialize identity: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(identityString)
+}
+
+func getGroups(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	store := ctx.Value("store").(*store.Store)
+
+	groups, err := store.Groups()
+	if err != nil {
+		logrus.Errorf("cannot get groups: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	groupsString, err := json.Marshal(groups)
+	if err != nil {
+		logrus.Errorf("cannot serialize groups: %s", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(groupsString)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/server/session"
+	"github.com/gimlet-io/gimletd/server/token"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getMe(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "ci", Secret: "secret"}
+	err := store.CreateUser(user)
+	assert.Nil(t, err)
+
+	tokenStr, err := token.New(token.UserToken, user.Login).Sign(user.Secret)
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest("GET", "/api/me", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenStr)
+	req = req.WithContext(context.WithValue(req.Context(), "store", store))
+	rr := httptest.NewRecorder()
+	session.SetUser()(http.HandlerFunc(getMe)).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var identity dx.Identity
+	err = json.Unmarshal(rr.Body.Bytes(), &identity)
+	assert.Nil(t, err)
+	assert.Equal(t, "ci", identity.Login)
+	assert.Equal(t, []string{"user"}, identity.Roles)
+	assert.Equal(t, []string{"read", "write"}, identity.Scopes)
+	assert.Equal(t, token.UserToken, identity.TokenKind)
+	assert.NotZero(t, identity.TokenIssuedAt, "should return when the token was issued")
+	assert.Zero(t, identity.TokenExpiresAt, "API tokens don't expire")
+}
+
+func Test_adminToken(t *testing.T) {
+	store := store.NewTest()
+	err := store.CreateUser(&model.User{Login: "admin", Secret: "secret", Admin: true})
+	assert.Nil(t, err)
+	adminToken := "c2VlZGVkLWJ5LXRlcnJhZm9ybS1vbi1maXJzdC1ib290"
+
+	getUsersWith := func(bearer string) int {
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		ctx := context.WithValue(req.Context(), "store", store)
+		ctx = context.WithValue(ctx, "adminToken", adminToken)
+		rr := httptest.NewRecorder()
+		session.SetUser()(session.MustAdmin()(http.HandlerFunc(getUsers))).ServeHTTP(rr, req.WithContext(ctx))
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, getUsersWith(adminToken))
+	assert.Equal(t, http.StatusUnauthorized, getUsersWith(adminToken[1:]))
+
+	generated, err := token.New(token.UserToken, "admin").Sign("secret")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, getUsersWith(generated), "the generated admin token should keep working")
+}
+
+func Test_groupRBAC(t *testing.T) {
+	store := store.NewTest()
+	user := &model.User{Login: "laszlo", Secret: "secret"}
+	err := store.CreateUser(user)
+	assert.Nil(t, err)
+	tokenStr, err := token.New(token.UserToken, user.Login).Sign(user.Secret)
+	assert.Nil(t, err)
+
+	err = store.SaveGroups([]*model.Group{{Name: "platform", Members: []string{"Laszlo"}}})
+	assert.Nil(t, err)
+
+	getGroupsAsAdmin := func(rules []*dx.RBACRule) int {
+		req := httptest.NewRequest("GET", "/api/groups", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+		ctx := context.WithValue(req.Context(), "store", store)
+		ctx = context.WithValue(ctx, "rbacRules", rules)
+		rr := httptest.NewRecorder()
+		session.SetUser()(session.MustAdmin()(http.HandlerFunc(getGroups))).ServeHTTP(rr, req.WithContext(ctx))
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, getGroupsAsAdmin(nil))
+	assert.Equal(t, http.StatusForbidden, getGroupsAsAdmin([]*dx.RBACRule{{Group: "backend", Role: dx.RoleAdmin}}))
+	assert.Equal(t, http.StatusOK, getGroupsAsAdmin([]*dx.RBACRule{{Group: "platform", Role: dx.RoleAdmin}}),
+		"group members should be admins by the rules of their group")
+}
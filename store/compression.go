@@ -0,0 +1,123 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	database_sql "database/sql"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/gimlet-io/gimletd/store/sql"
+	"github.com/russross/meddler"
+)
+
+// compressedBlobMarker prefixes the gzipped and base64 encoded blobs,
+// blobs without it were stored before compression and are read as they are
+const compressedBlobMarker = "gz:"
+
+func init() {
+	meddler.Register("compressed", compressedMeddler{})
+}
+
+// compressedMeddler gzips string fields on write and decompresses them on read
+type compressedMeddler struct{}
+
+func (m compressedMeddler) PreRead(fieldAddr interface{}) (scanTarget interface{}, err error) {
+	return new(database_sql.NullString), nil
+}
+
+func (m compressedMeddler) PostRead(fieldAddr interface{}, scanTarget interface{}) error {
+	field, ok := fieldAddr.(*string)
+	if !ok {
+		return fmt.Errorf("compressed meddler only supports string fields, got %s", reflect.TypeOf(fieldAddr))
+	}
+	blob, err := decompressBlob(scanTarget.(*database_sql.NullString).String)
+	if err != nil {
+		return err
+	}
+	*field = blob
+	return nil
+}
+
+func (m compressedMeddler) PreWrite(field interface{}) (saveValue interface{}, err error) {
+	blob, ok := field.(string)
+	if !ok {
+		return nil, fmt.Errorf("compressed meddler only supports string fields, got %s", reflect.TypeOf(field))
+	}
+	return compressBlob(blob)
+}
+
+func compressBlob(blob string) (string, error) {
+	if blob == "" {
+		return "", nil
+	}
+
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, err := w.Write([]byte(blob))
+	if err != nil {
+		return "", err
+	}
+	err = w.Close()
+	if err != nil {
+		return "", err
+	}
+	return compressedBlobMarker + base64.StdEncoding.EncodeToString(b.Bytes()), nil
+}
+
+func decompressBlob(blob string) (string, error) {
+	if !strings.HasPrefix(blob, compressedBlobMarker) {
+		return blob, nil
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(blob, compressedBlobMarker))
+	if err != nil {
+		return "", fmt.Errorf("cannot decode compressed blob: %s", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", fmt.Errorf("cannot decompress blob: %s", err)
+	}
+	decompressed, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("cannot decompress blob: %s", err)
+	}
+	return string(decompressed), nil
+}
+
+// CompressEventBlobs compresses the blobs of a batch of events that were stored uncompressed, and returns their number
+func (db *sqlStore) CompressEventBlobs(batchSize int) (int, error) {
+	rows, err := db.Query(sql.Stmt(db.driver, sql.SelectUncompressedBlobs), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	blobs := map[string]string{}
+	for rows.Next() {
+		var id, blob string
+		if err := rows.Scan(&id, &blob); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		blobs[id] = blob
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	stmt := sql.Stmt(db.driver, sql.UpdateEventBlob)
+	for id, blob := range blobs {
+		compressed, err := compressBlob(blob)
+		if err != nil {
+			return 0, err
+		}
+		_, err = db.Exec(stmt, compressed, id)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(blobs), nil
+}
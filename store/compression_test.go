@@ -0,0 +1,55 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobCompression(t *testing.T) {
+	s := NewTest()
+	defer func() {
+		s.Close()
+	}()
+	db, ok := s.Driver.(*sqlStore)
+	if !ok {
+		t.Skip("blobs are only compressed by the SQL drivers")
+	}
+
+	event, err := s.CreateEvent(&model.Event{Type: model.TypeArtifact, ArtifactID: "my-app-1", Blob: `{"id": "my-app-1"}`})
+	assert.Nil(t, err)
+
+	var stored string
+	err = db.QueryRow(`SELECT blob FROM events WHERE id = ?`, event.ID).Scan(&stored)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(stored, compressedBlobMarker), "blobs should be compressed on write")
+
+	artifact, err := s.Artifact("my-app-1")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id": "my-app-1"}`, artifact.Blob, "blobs should be decompressed on read")
+
+	legacy, err := s.CreateEvent(&model.Event{Type: model.TypeArtifact, ArtifactID: "my-app-2"})
+	assert.Nil(t, err)
+	_, err = db.Exec(`UPDATE events SET blob = '{"id": "my-app-2"}' WHERE id = ?`, legacy.ID)
+	assert.Nil(t, err)
+	artifact, err = s.Artifact("my-app-2")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id": "my-app-2"}`, artifact.Blob, "uncompressed blobs should be read as they are")
+
+	compressed, err := s.CompressEventBlobs(10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, compressed)
+	err = db.QueryRow(`SELECT blob FROM events WHERE id = ?`, legacy.ID).Scan(&stored)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(stored, compressedBlobMarker))
+
+	artifact, err = s.Artifact("my-app-2")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id": "my-app-2"}`, artifact.Blob)
+
+	compressed, err = s.CompressEventBlobs(10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, compressed, "compressed blobs should not be compressed again")
+}
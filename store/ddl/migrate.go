@@ -16,60 +16,161 @@ package ddl
 
 import (
 	"database/sql"
+	"fmt"
+
+	queries "github.com/gimlet-io/gimletd/store/sql"
 )
 
 // Migrate performs the database migration. If the migration fails
 // and error is returned.
+//
+// Applied migrations are recorded with their version. Migrate fails fast if the
+// applied migrations diverge from the known ones, eg. the database was migrated by a newer GimletD
 func Migrate(driver string, db *sql.DB) error {
-	if err := createTable(db); err != nil {
+	known := migrations[driver]
+	applied, err := appliedMigrations(driver, db)
+	if err != nil {
+		return err
+	}
+	if err := checkDivergence(known, applied); err != nil {
 		return err
 	}
 
-	completed, err := selectCompleted(db)
-	if err != nil && err != sql.ErrNoRows {
+	for _, migration := range known[len(applied):] {
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migration.up); err != nil {
+				return fmt.Errorf("migration %d %s failed: %s", migration.version, migration.name, err)
+			}
+			_, err := tx.Exec(queries.Rebind(driver, migrationInsert), migration.version, migration.name)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateDown rolls back the applied migrations above the given version,
+// in reverse order, by running their down-migrations
+func MigrateDown(driver string, db *sql.DB, version int) error {
+	known := migrations[driver]
+	applied, err := appliedMigrations(driver, db)
+	if err != nil {
 		return err
 	}
-	for _, migration := range migrations[driver] {
-		if _, ok := completed[migration.name]; ok {
-			continue
+	if err := checkDivergence(known, applied); err != nil {
+		return err
+	}
+
+	for i := len(applied) - 1; i >= 0; i-- {
+		migration := known[i]
+		if migration.version <= version {
+			break
+		}
+		if migration.down == "" {
+			return fmt.Errorf("migration %d %s can't be rolled back", migration.version, migration.name)
 		}
 
-		if _, err := db.Exec(migration.stmt); err != nil {
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migration.down); err != nil {
+				return fmt.Errorf("rolling back migration %d %s failed: %s", migration.version, migration.name, err)
+			}
+			_, err := tx.Exec(queries.Rebind(driver, migrationDelete), migration.version)
 			return err
-		}
-		if err := insertMigration(db, migration.name); err != nil {
+		})
+		if err != nil {
 			return err
 		}
-
 	}
 	return nil
 }
 
-func createTable(db *sql.DB) error {
-	_, err := db.Exec(migrationTableCreate)
-	return err
+// Version returns the version of the last applied migration
+func Version(driver string, db *sql.DB) (int, error) {
+	applied, err := appliedMigrations(driver, db)
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+	return applied[len(applied)-1].version, nil
+}
+
+type appliedMigration struct {
+	version int
+	name    string
 }
 
-func insertMigration(db *sql.DB, name string) error {
-	_, err := db.Exec(migrationInsert, name)
-	return err
+// checkDivergence makes sure that the applied migrations are the first migrations of the known ones
+func checkDivergence(known []migration, applied []appliedMigration) error {
+	for i, a := range applied {
+		if i >= len(known) {
+			return fmt.Errorf("database has migration %d %s that this version of GimletD doesn't know, was it migrated by a newer version?", a.version, a.name)
+		}
+		if a.version != known[i].version || a.name != known[i].name {
+			return fmt.Errorf("database migrations diverged at %d %s, expected %d %s", a.version, a.name, known[i].version, known[i].name)
+		}
+	}
+	return nil
 }
 
-func selectCompleted(db *sql.DB) (map[string]struct{}, error) {
-	migrations := map[string]struct{}{}
+func appliedMigrations(driver string, db *sql.DB) ([]appliedMigration, error) {
+	if err := createTable(driver, db); err != nil {
+		return nil, err
+	}
+
 	rows, err := db.Query(migrationSelect)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+
+	var applied []appliedMigration
 	for rows.Next() {
+		var version sql.NullInt64
 		var name string
-		if err := rows.Scan(&name); err != nil {
+		if err := rows.Scan(&version, &name); err != nil {
 			return nil, err
 		}
-		migrations[name] = struct{}{}
+		if !version.Valid {
+			return nil, fmt.Errorf("migration %s has no version", name)
+		}
+		applied = append(applied, appliedMigration{version: int(version.Int64), name: name})
+	}
+	return applied, rows.Err()
+}
+
+func createTable(driver string, db *sql.DB) error {
+	_, err := db.Exec(migrationTableCreate)
+	if err != nil {
+		return err
+	}
+
+	// migrations tables created before versioning only have names
+	if _, err := db.Exec(migrationVersionSelect); err == nil {
+		return nil
+	}
+	if _, err := db.Exec(migrationVersionAdd); err != nil {
+		return err
+	}
+	for _, migration := range migrations[driver] {
+		_, err := db.Exec(queries.Rebind(driver, migrationVersionUpdate), migration.version, migration.name)
+		if err != nil {
+			return err
+		}
 	}
-	return migrations, nil
+	return nil
+}
+
+func inTx(db *sql.DB, f func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
 //
@@ -78,15 +179,32 @@ func selectCompleted(db *sql.DB) (map[string]struct{}, error) {
 
 var migrationTableCreate = `
 CREATE TABLE IF NOT EXISTS migrations (
- name VARCHAR(255)
+ version INTEGER
+,name VARCHAR(255)
 ,UNIQUE(name)
 )
 `
 
+var migrationVersionSelect = `
+SELECT version FROM migrations LIMIT 1
+`
+
+var migrationVersionAdd = `
+ALTER TABLE migrations ADD COLUMN version INTEGER
+`
+
+var migrationVersionUpdate = `
+UPDATE migrations SET version = ? WHERE name = ?
+`
+
 var migrationInsert = `
-INSERT INTO migrations (name) VALUES (?)
+INSERT INTO migrations (version, name) VALUES (?, ?)
+`
+
+var migrationDelete = `
+DELETE FROM migrations WHERE version = ?
 `
 
 var migrationSelect = `
-SELECT name FROM migrations
+SELECT version, name FROM migrations ORDER BY version
 `
@@ -0,0 +1,93 @@
+package ddl
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.Nil(t, err)
+	db.SetMaxOpenConns(1) // every connection would get a new in-memory database
+	return db
+}
+
+func Test_migrationVersions(t *testing.T) {
+	for driver, driverMigrations := range migrations {
+		for i, m := range driverMigrations {
+			if i > 0 {
+				assert.Greater(t, m.version, driverMigrations[i-1].version, "%s migration versions must increase", driver)
+			}
+		}
+	}
+}
+
+func Test_migrateUpAndDown(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	err := Migrate("sqlite3", db)
+	assert.Nil(t, err)
+	version, _ := Version("sqlite3", db)
+	assert.Equal(t, latestVersion(), version)
+
+	_, err = db.Exec(`INSERT INTO events (id, blob, gitops_hashes) VALUES ('1', '{}', '["abc"]')`)
+	assert.Nil(t, err)
+
+	err = MigrateDown("sqlite3", db, 2)
+	assert.Nil(t, err)
+	version, _ = Version("sqlite3", db)
+	assert.Equal(t, 2, version)
+
+	_, err = db.Exec(`SELECT gitops_hashes FROM events`)
+	assert.NotNil(t, err, "the column should be dropped")
+	var blob string
+	err = db.QueryRow(`SELECT blob FROM events WHERE id = '1'`).Scan(&blob)
+	assert.Nil(t, err, "rows should be kept")
+
+	err = Migrate("sqlite3", db)
+	assert.Nil(t, err)
+	version, _ = Version("sqlite3", db)
+	assert.Equal(t, latestVersion(), version)
+}
+
+func Test_migrateLegacyTable(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	_, err := db.Exec(`CREATE TABLE migrations (name VARCHAR(255), UNIQUE(name))`)
+	assert.Nil(t, err)
+	for _, m := range migrations["sqlite3"][:3] {
+		_, err = db.Exec(m.up)
+		assert.Nil(t, err)
+		_, err = db.Exec(`INSERT INTO migrations (name) VALUES (?)`, m.name)
+		assert.Nil(t, err)
+	}
+
+	err = Migrate("sqlite3", db)
+	assert.Nil(t, err)
+	version, _ := Version("sqlite3", db)
+	assert.Equal(t, latestVersion(), version)
+}
+
+func Test_migrateDivergence(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	err := Migrate("sqlite3", db)
+	assert.Nil(t, err)
+
+	_, err = db.Exec(`INSERT INTO migrations (version, name) VALUES (99, 'from-the-future')`)
+	assert.Nil(t, err)
+
+	err = Migrate("sqlite3", db)
+	assert.NotNil(t, err, "should fail on unknown migrations")
+}
+
+func latestVersion() int {
+	sqliteMigrations := migrations["sqlite3"]
+	return sqliteMigrations[len(sqliteMigrations)-1].version
+}
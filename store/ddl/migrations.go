@@ -14,22 +14,44 @@
 
 package ddl
 
+import (
+	"fmt"
+	"strings"
+)
+
 const createTableUsers = "create-table-users"
 const createTableEvents = "create-table-events"
 const addGitopsStatusColumnToEventsTable = "add-gitops_status-to-events-table"
 const createTableGitopsCommits = "create-table-gitopsCommits"
 const createTableKeyValues = "create-table-key-values"
+const addProcessingStartedColumnToEventsTable = "add-processing_started-to-events-table"
+const addTriggeredEnvsColumnToEventsTable = "add-triggered_envs-to-events-table"
+const addCreatedColumnToGitopsCommitsTable = "add-created-to-gitops-commits-table"
+const createPartitionedTableEvents = "create-partitioned-table-events"
+const addCorrelationIDColumnToEventsTable = "add-correlation_id-to-events-table"
+const addEnvStatusesColumnToEventsTable = "add-env_statuses-to-events-table"
+const addLogsColumnToEventsTable = "add-logs-to-events-table"
+const createEventsNotifyTrigger = "create-events-notify-trigger"
+const createTableEventChanges = "create-table-event-changes"
+const addExpiredColumnToEventsTable = "add-expired-to-events-table"
+const addSourceColumnsToEventsTable = "add-source-columns-to-events-table"
+const addCreatedNanoColumnToEventsTable = "add-created_nano-to-events-table"
 
+// migration is a versioned schema change.
+// Versions must be strictly increasing, and released migrations must never change
 type migration struct {
-	name string
-	stmt string
+	version int
+	name    string
+	up      string
+	down    string
 }
 
 var migrations = map[string][]migration{
 	"sqlite3": {
 		{
-			name: createTableUsers,
-			stmt: `
+			version: 1,
+			name:    createTableUsers,
+			up: `
 CREATE TABLE IF NOT EXISTS users (
 id           INTEGER PRIMARY KEY AUTOINCREMENT,
 login         TEXT,
@@ -38,10 +60,12 @@ admin         BOOLEAN,
 UNIQUE(login)
 );
 `,
+			down: `DROP TABLE users;`,
 		},
 		{
-			name: createTableEvents,
-			stmt: `
+			version: 2,
+			name:    createTableEvents,
+			up: `
 CREATE TABLE IF NOT EXISTS events (
 id            TEXT,
 created       INTEGER,
@@ -60,14 +84,18 @@ artifact_id   TEXT,
 UNIQUE(id)
 );
 `,
+			down: `DROP TABLE events;`,
 		},
 		{
-			name: addGitopsStatusColumnToEventsTable,
-			stmt: `ALTER TABLE events ADD COLUMN gitops_hashes TEXT DEFAULT '[]';`,
+			version: 3,
+			name:    addGitopsStatusColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN gitops_hashes TEXT DEFAULT '[]';`,
+			down:    sqliteRebuildEvents(eventsColumnsV2),
 		},
 		{
-			name: createTableGitopsCommits,
-			stmt: `
+			version: 4,
+			name:    createTableGitopsCommits,
+			up: `
 CREATE TABLE IF NOT EXISTS gitops_commits (
 id          INTEGER PRIMARY KEY AUTOINCREMENT,
 sha         TEXT,
@@ -76,10 +104,12 @@ status_desc TEXT,
 UNIQUE(id)
 );
 `,
+			down: `DROP TABLE gitops_commits;`,
 		},
 		{
-			name: createTableKeyValues,
-			stmt: `
+			version: 5,
+			name:    createTableKeyValues,
+			up: `
 CREATE TABLE IF NOT EXISTS key_values (
 	id        INTEGER PRIMARY KEY AUTOINCREMENT,
 	key       TEXT,
@@ -87,8 +117,290 @@ CREATE TABLE IF NOT EXISTS key_values (
 	UNIQUE(key)
 	);
 `,
+			down: `DROP TABLE key_values;`,
+		},
+		{
+			version: 6,
+			name:    addProcessingStartedColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN processing_started INTEGER DEFAULT 0;`,
+			down:    sqliteRebuildEvents(eventsColumnsV3),
+		},
+		{
+			version: 7,
+			name:    addTriggeredEnvsColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN triggered_envs TEXT DEFAULT '[]';`,
+			down:    sqliteRebuildEvents(eventsColumnsV6),
+		},
+		{
+			version: 8,
+			name:    addCreatedColumnToGitopsCommitsTable,
+			up:      `ALTER TABLE gitops_commits ADD COLUMN created INTEGER DEFAULT 0;`,
+			down: `
+CREATE TABLE gitops_commits_rebuild (
+id          INTEGER PRIMARY KEY AUTOINCREMENT,
+sha         TEXT,
+status      TEXT,
+status_desc TEXT,
+UNIQUE(id)
+);
+INSERT INTO gitops_commits_rebuild SELECT id, sha, status, status_desc FROM gitops_commits;
+DROP TABLE gitops_commits;
+ALTER TABLE gitops_commits_rebuild RENAME TO gitops_commits;
+`,
+		},
+		{
+			version: 9,
+			name:    addCorrelationIDColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN correlation_id TEXT DEFAULT '';`,
+			down:    sqliteRebuildEvents(eventsColumnsV7),
+		},
+		{
+			version: 10,
+			name:    addEnvStatusesColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN env_statuses TEXT DEFAULT '[]';`,
+			down:    sqliteRebuildEvents(eventsColumnsV9),
+		},
+		{
+			version: 11,
+			name:    addLogsColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN logs TEXT DEFAULT '[]';`,
+			down:    sqliteRebuildEvents(eventsColumnsV10),
+		},
+		{
+			version: 12,
+			name:    createTableEventChanges,
+			up: `
+CREATE TABLE IF NOT EXISTS event_changes (
+id          INTEGER PRIMARY KEY AUTOINCREMENT,
+event_id    TEXT,
+status      TEXT,
+status_desc TEXT DEFAULT '',
+created     INTEGER
+);
+`,
+			down: `DROP TABLE event_changes;`,
+		},
+		{
+			version: 13,
+			name:    addExpiredColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN expired INTEGER DEFAULT 0;`,
+			down:    sqliteRebuildEvents(eventsColumnsV11),
+		},
+		{
+			version: 14,
+			name:    addSourceColumnsToEventsTable,
+			up: `
+ALTER TABLE events ADD COLUMN submitted_by TEXT DEFAULT '';
+ALTER TABLE events ADD COLUMN user_agent TEXT DEFAULT '';
+ALTER TABLE events ADD COLUMN ci_url TEXT DEFAULT '';
+`,
+			down: sqliteRebuildEvents(eventsColumnsV13),
+		},
+		{
+			version: 15,
+			name:    addCreatedNanoColumnToEventsTable,
+			up: `
+ALTER TABLE events ADD COLUMN created_nano INTEGER DEFAULT 0;
+UPDATE events SET created_nano = created * 1000000000;
+`,
+			down: sqliteRebuildEvents(eventsColumnsV14),
 		},
 	},
-	"postgres": {},
-	"mysql":    {},
+	"postgres": {
+		{
+			version: 1,
+			name:    createTableUsers,
+			up: `
+CREATE TABLE IF NOT EXISTS users (
+id           SERIAL PRIMARY KEY,
+login         TEXT,
+secret        TEXT,
+admin         BOOLEAN,
+UNIQUE(login)
+);
+`,
+			down: `DROP TABLE users;`,
+		},
+		{
+			// events are range partitioned by month on the created column, see store.MaintainEventPartitions.
+			// Rows outside of the created partitions land in the default partition
+			version: 2,
+			name:    createPartitionedTableEvents,
+			up: `
+CREATE TABLE IF NOT EXISTS events (
+id                 TEXT,
+created            BIGINT NOT NULL,
+type               TEXT,
+blob               TEXT,
+status             TEXT DEFAULT 'new',
+status_desc        TEXT DEFAULT '',
+repository         TEXT,
+branch             TEXT,
+event              INTEGER,
+source_branch      TEXT,
+target_branch      TEXT,
+tag                TEXT,
+sha                TEXT,
+artifact_id        TEXT,
+gitops_hashes      TEXT DEFAULT '[]',
+processing_started BIGINT DEFAULT 0,
+triggered_envs     TEXT DEFAULT '[]',
+UNIQUE(id, created)
+) PARTITION BY RANGE (created);
+CREATE TABLE IF NOT EXISTS events_default PARTITION OF events DEFAULT;
+CREATE INDEX IF NOT EXISTS events_status_created ON events (status, created);
+CREATE INDEX IF NOT EXISTS events_type_created ON events (type, created);
+`,
+			down: `DROP TABLE events;`,
+		},
+		{
+			version: 3,
+			name:    createTableGitopsCommits,
+			up: `
+CREATE TABLE IF NOT EXISTS gitops_commits (
+id          SERIAL PRIMARY KEY,
+sha         TEXT,
+status      TEXT,
+status_desc TEXT,
+created     BIGINT DEFAULT 0
+);
+`,
+			down: `DROP TABLE gitops_commits;`,
+		},
+		{
+			version: 4,
+			name:    createTableKeyValues,
+			up: `
+CREATE TABLE IF NOT EXISTS key_values (
+id        SERIAL PRIMARY KEY,
+key       TEXT,
+value     TEXT,
+UNIQUE(key)
+);
+`,
+			down: `DROP TABLE key_values;`,
+		},
+		{
+			version: 5,
+			name:    addCorrelationIDColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN correlation_id TEXT DEFAULT '';`,
+			down:    `ALTER TABLE events DROP COLUMN correlation_id;`,
+		},
+		{
+			version: 6,
+			name:    addEnvStatusesColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN env_statuses TEXT DEFAULT '[]';`,
+			down:    `ALTER TABLE events DROP COLUMN env_statuses;`,
+		},
+		{
+			version: 7,
+			name:    addLogsColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN logs TEXT DEFAULT '[]';`,
+			down:    `ALTER TABLE events DROP COLUMN logs;`,
+		},
+		{
+			// wakes the workers listening on the gimletd_events channel, see store.EventsNotify
+			version: 8,
+			name:    createEventsNotifyTrigger,
+			up: `
+CREATE OR REPLACE FUNCTION notify_events() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('gimletd_events', '');
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER events_notify AFTER INSERT ON events FOR EACH STATEMENT EXECUTE PROCEDURE notify_events();
+`,
+			down: `
+DROP TRIGGER events_notify ON events;
+DROP FUNCTION notify_events();
+`,
+		},
+		{
+			// the outbox of the event firehose, see worker.FirehoseWorker
+			version: 9,
+			name:    createTableEventChanges,
+			up: `
+CREATE TABLE IF NOT EXISTS event_changes (
+id          BIGSERIAL PRIMARY KEY,
+event_id    TEXT,
+status      TEXT,
+status_desc TEXT DEFAULT '',
+created     BIGINT
+);
+CREATE INDEX IF NOT EXISTS event_changes_created ON event_changes (created);
+`,
+			down: `DROP TABLE event_changes;`,
+		},
+		{
+			version: 10,
+			name:    addExpiredColumnToEventsTable,
+			up:      `ALTER TABLE events ADD COLUMN expired BIGINT DEFAULT 0;`,
+			down:    `ALTER TABLE events DROP COLUMN expired;`,
+		},
+		{
+			version: 11,
+			name:    addSourceColumnsToEventsTable,
+			up: `
+ALTER TABLE events ADD COLUMN submitted_by TEXT DEFAULT '';
+ALTER TABLE events ADD COLUMN user_agent TEXT DEFAULT '';
+ALTER TABLE events ADD COLUMN ci_url TEXT DEFAULT '';
+CREATE INDEX IF NOT EXISTS events_submitted_by_created ON events (submitted_by, created);
+`,
+			down: `
+DROP INDEX IF EXISTS events_submitted_by_created;
+ALTER TABLE events DROP COLUMN submitted_by;
+ALTER TABLE events DROP COLUMN user_agent;
+ALTER TABLE events DROP COLUMN ci_url;
+`,
+		},
+		{
+			version: 12,
+			name:    addCreatedNanoColumnToEventsTable,
+			up: `
+ALTER TABLE events ADD COLUMN created_nano BIGINT DEFAULT 0;
+UPDATE events SET created_nano = created * 1000000000;
+CREATE INDEX IF NOT EXISTS events_type_created_nano ON events (type, created_nano);
+`,
+			down: `
+DROP INDEX IF EXISTS events_type_created_nano;
+ALTER TABLE events DROP COLUMN created_nano;
+`,
+		},
+	},
+	"mysql": {},
+}
+
+var eventsColumnsV2 = []string{
+	"id TEXT", "created INTEGER", "type TEXT", "blob TEXT",
+	"status TEXT DEFAULT 'new'", "status_desc TEXT DEFAULT ''",
+	"repository TEXT", "branch TEXT", "event TEXT", "source_branch TEXT", "target_branch TEXT", "tag TEXT",
+	"sha TEXT", "artifact_id TEXT",
+}
+var eventsColumnsV3 = append(eventsColumnsV2[:len(eventsColumnsV2):len(eventsColumnsV2)], "gitops_hashes TEXT DEFAULT '[]'")
+var eventsColumnsV6 = append(eventsColumnsV3[:len(eventsColumnsV3):len(eventsColumnsV3)], "processing_started INTEGER DEFAULT 0")
+var eventsColumnsV7 = append(eventsColumnsV6[:len(eventsColumnsV6):len(eventsColumnsV6)], "triggered_envs TEXT DEFAULT '[]'")
+var eventsColumnsV9 = append(eventsColumnsV7[:len(eventsColumnsV7):len(eventsColumnsV7)], "correlation_id TEXT DEFAULT ''")
+var eventsColumnsV10 = append(eventsColumnsV9[:len(eventsColumnsV9):len(eventsColumnsV9)], "env_statuses TEXT DEFAULT '[]'")
+var eventsColumnsV11 = append(eventsColumnsV10[:len(eventsColumnsV10):len(eventsColumnsV10)], "logs TEXT DEFAULT '[]'")
+var eventsColumnsV13 = append(eventsColumnsV11[:len(eventsColumnsV11):len(eventsColumnsV11)], "expired INTEGER DEFAULT 0")
+var eventsColumnsV14 = append(eventsColumnsV13[:len(eventsColumnsV13):len(eventsColumnsV13)], "submitted_by TEXT DEFAULT ''", "user_agent TEXT DEFAULT ''", "ci_url TEXT DEFAULT ''")
+
+// sqliteRebuildEvents recreates the events table with the given columns,
+// as SQLite can't drop columns
+func sqliteRebuildEvents(columns []string) string {
+	var names []string
+	for _, c := range columns {
+		names = append(names, strings.Fields(c)[0])
+	}
+
+	return fmt.Sprintf(`
+CREATE TABLE events_rebuild (
+%s,
+UNIQUE(id)
+);
+INSERT INTO events_rebuild SELECT %s FROM events;
+DROP TABLE events;
+ALTER TABLE events_rebuild RENAME TO events;
+`, strings.Join(columns, ",\n"), strings.Join(names, ", "))
 }
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+)
+
+// Driver is the interface storage backends implement.
+// Store embeds a Driver, so call sites don't depend on the actual backend.
+type Driver interface {
+	// CreateEvent stores a new event
+	CreateEvent(event *model.Event) (*model.Event, error)
+
+	// Artifacts returns all artifact events within the given constraints, newest first.
+	// With a cursor, the artifacts after the cursor's position are returned
+	Artifacts(
+		repo, branch string,
+		gitEvent *dx.GitEvent,
+		sourceBranch string,
+		sha []string,
+		submittedBy string,
+		cursor *model.Cursor,
+		limit, offset int,
+		since, until *time.Time) ([]*model.Event, error)
+
+	// ArtifactsCount returns the number of artifact events within the given constraints
+	ArtifactsCount(
+		repo, branch string,
+		gitEvent *dx.GitEvent,
+		sourceBranch string,
+		sha []string,
+		submittedBy string,
+		since, until *time.Time) (int, error)
+
+	// Artifact returns an artifact event by artifact id
+	Artifact(id string) (*model.Event, error)
+
+	// Event returns an event by id
+	Event(id string) (*model.Event, error)
+
+	// UnprocessedEvents returns the next batch of events to process
+	UnprocessedEvents() ([]*model.Event, error)
+
+	// UpdateEventStatus updates an event status
+	UpdateEventStatus(id string, status string, desc string, gitopsStatusString string, triggeredEnvsString string, envStatusesString string) error
+
+	// UpdateEventLogs stores the last log lines of an event's processing
+	UpdateEventLogs(id string, logsString string) error
+
+	// MarkEventProcessing flags an event that a worker started processing
+	MarkEventProcessing(id string) error
+
+	// StuckEvents returns the events that are in processing since before the given time
+	StuckEvents(startedBefore time.Time) ([]*model.Event, error)
+
+	// EventBacklog returns the number of events waiting to be processed, and the creation time of the oldest one
+	EventBacklog() (size int, oldest time.Time, err error)
+
+	// DeployEvents returns the processed artifact, release and rollback events created in the given time range
+	DeployEvents(since, until time.Time) ([]*model.Event, error)
+
+	// RepositoryEvents returns the artifact, release and reevaluation events of a repository, oldest first
+	RepositoryEvents(repo string) ([]*model.Event, error)
+
+	// EventsNotify returns a channel that signals new events, nil if the backend can only be polled
+	EventsNotify() <-chan struct{}
+
+	// CheckingEvents returns the events that wait for the CI checks of their gitops commits
+	CheckingEvents() ([]*model.Event, error)
+
+	// RequeueEvent puts a processing event back to the queue
+	RequeueEvent(id string) error
+
+	// HoldEvent takes a new event out of the queue until RequeueHeldEvents
+	HoldEvent(id string, desc string) error
+
+	// RequeueHeldEvents puts the held events back to the queue, and returns their number
+	RequeueHeldEvents() (int, error)
+
+	// EventChanges returns the next batch of event state changes after the given change ID, that were recorded before the given time.
+	// Changes are in ID order
+	EventChanges(afterID int64, before time.Time, limit int) ([]*model.EventChange, error)
+
+	// DeleteEventChanges deletes the event state changes up to, and including the given change ID
+	DeleteEventChanges(throughID int64) error
+
+	// PruneEventChanges deletes the event state changes recorded before the given time
+	PruneEventChanges(before time.Time) error
+
+	// UnexpiredArtifacts returns the artifact events that are not expired yet, oldest first
+	UnexpiredArtifacts() ([]*model.Event, error)
+
+	// ExpireArtifact marks the artifact expired
+	ExpireArtifact(artifactID string) error
+
+	// ExpireArtifactsCreatedBefore marks the artifacts created before the given time expired, and returns their number
+	ExpireArtifactsCreatedBefore(before time.Time) (int64, error)
+
+	// MaintainEventPartitions creates upcoming and drops expired partitions of the events table, where supported
+	MaintainEventPartitions(now time.Time, monthsAhead int, retention time.Duration) error
+
+	// CompressEventBlobs compresses the blobs of a batch of events that were stored uncompressed, and returns their number
+	CompressEventBlobs(batchSize int) (int, error)
+
+	// GitopsCommit returns a gitops commit by sha, nil if not found
+	GitopsCommit(sha string) (*model.GitopsCommit, error)
+
+	// SaveOrUpdateGitopsCommit upserts a gitops commit by sha
+	SaveOrUpdateGitopsCommit(gitopsCommit *model.GitopsCommit) error
+
+	// SaveKeyValue upserts a key-value pair
+	SaveKeyValue(setting *model.KeyValue) error
+
+	// KeyValue returns a key-value pair by key
+	KeyValue(key string) (*model.KeyValue, error)
+
+	// User returns a user by its login name
+	User(login string) (*model.User, error)
+
+	// Users returns all users
+	Users() ([]*model.User, error)
+
+	// CreateUser stores a new user
+	CreateUser(user *model.User) error
+
+	// UpdateUser updates a stored user
+	UpdateUser(user *model.User) error
+
+	// DeleteUser deletes a user by its login name
+	DeleteUser(login string) error
+
+	// Close releases the resources held by the driver
+	Close() error
+}
+
+// DriverFactory opens a Driver with the given driver name and datasource config
+type DriverFactory func(driver, config string) (Driver, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]DriverFactory{}
+)
+
+// Register makes a storage driver available by the provided name.
+// It panics if Register is called twice with the same name.
+func Register(name string, factory DriverFactory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if factory == nil {
+		panic("store: Register driver factory is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("store: Register called twice for driver " + name)
+	}
+	drivers[name] = factory
+}
+
+// Drivers returns the sorted list of the registered driver names
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	var names []string
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func openDriver(driver, config string) (Driver, error) {
+	driversMu.RLock()
+	factory, ok := drivers[driver]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown database driver %q, registered drivers are %v", driver, Drivers())
+	}
+
+	return factory(driver, config)
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	database_sql "database/sql"
 	"fmt"
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
@@ -8,26 +9,115 @@ import (
 	"github.com/google/uuid"
 	"github.com/russross/meddler"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// lastCreatedNano is the creation time of the last event, see nextCreatedNano
+var lastCreatedNano int64
+
+// nextCreatedNano returns the creation time of a new event in nanoseconds.
+// It is strictly increasing, even if events are created within the resolution of the clock, or the clock steps back
+func nextCreatedNano() int64 {
+	for {
+		last := atomic.LoadInt64(&lastCreatedNano)
+		next := time.Now().UnixNano()
+		if next <= last {
+			next = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastCreatedNano, last, next) {
+			return next
+		}
+	}
+}
+
 // CreateEvent stores a new event in the database
-func (db *Store) CreateEvent(event *model.Event) (*model.Event, error) {
+func (db *sqlStore) CreateEvent(event *model.Event) (*model.Event, error) {
 	event.ID = uuid.New().String()
-	event.Created = time.Now().Unix()
+	event.CreatedNano = nextCreatedNano()
+	event.Created = event.CreatedNano / int64(time.Second)
 	event.Status = model.StatusNew
-	return event, meddler.Insert(db, "events", event)
+	if event.CorrelationID == "" {
+		event.CorrelationID = uuid.New().String()
+	}
+	return event, db.inTx(func(tx *database_sql.Tx) error {
+		err := meddler.Insert(tx, "events", event)
+		if err != nil {
+			return err
+		}
+		return db.recordEventChange(tx, event.ID, event.Status, "")
+	})
 }
 
-// Artifacts returns all events in the database within the given constraints
-func (db *Store) Artifacts(
+// Artifacts returns all events in the database within the given constraints, newest second first,
+// and in the order of their creation within the same second.
+// With a cursor, the artifacts after the cursor's position are returned, and the offset is ignored
+func (db *sqlStore) Artifacts(
 	repo, branch string,
 	gitEvent *dx.GitEvent,
 	sourceBranch string,
 	sha []string,
+	submittedBy string,
+	cursor *model.Cursor,
 	limit, offset int,
 	since, until *time.Time) ([]*model.Event, error) {
 
+	filters, args := artifactFilters(repo, branch, gitEvent, sourceBranch, sha, submittedBy, since, until)
+
+	if cursor != nil {
+		filters = addFilter(filters, "(created < ? OR (created = ? AND (created_nano > ? OR (created_nano = ? AND id > ?))))")
+		created := cursor.CreatedNano / int64(time.Second)
+		args = append(args, created, created, cursor.CreatedNano, cursor.CreatedNano, cursor.ID)
+		offset = 0
+	}
+
+	if limit == 0 && offset == 0 {
+		limit = 10
+	}
+	limitAndOffset := fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+
+	query := fmt.Sprintf(`
+SELECT id, repository, branch, event, source_branch, target_branch, tag, created, blob, status, status_desc, sha, artifact_id, correlation_id, expired,
+submitted_by, user_agent, ci_url, created_nano
+FROM events
+%s
+ORDER BY created desc, created_nano asc, id asc
+%s;`, strings.Join(filters, " "), limitAndOffset)
+
+	var data []*model.Event
+	err := meddler.QueryAll(db, &data, sql.Rebind(db.driver, query), args...)
+	return data, err
+}
+
+// ArtifactsCount returns the number of artifacts within the given constraints
+func (db *sqlStore) ArtifactsCount(
+	repo, branch string,
+	gitEvent *dx.GitEvent,
+	sourceBranch string,
+	sha []string,
+	submittedBy string,
+	since, until *time.Time) (int, error) {
+
+	filters, args := artifactFilters(repo, branch, gitEvent, sourceBranch, sha, submittedBy, since, until)
+	query := fmt.Sprintf(`
+SELECT COUNT(*)
+FROM events
+%s;`, strings.Join(filters, " "))
+
+	var count int
+	err := db.QueryRow(sql.Rebind(db.driver, query), args...).Scan(&count)
+	return count, err
+}
+
+// artifactFilters returns the SQL filters and their arguments of the artifact queries
+func artifactFilters(
+	repo, branch string,
+	gitEvent *dx.GitEvent,
+	sourceBranch string,
+	sha []string,
+	submittedBy string,
+	since, until *time.Time) ([]string, []interface{}) {
+
 	filters := []string{}
 	args := []interface{}{}
 
@@ -61,6 +151,10 @@ func (db *Store) Artifacts(
 			args = append(args, s)
 		}
 	}
+	if submittedBy != "" {
+		filters = addFilter(filters, "submitted_by = ?")
+		args = append(args, submittedBy)
+	}
 
 	if gitEvent != nil {
 		var intRep int
@@ -68,63 +162,250 @@ func (db *Store) Artifacts(
 		filters = addFilter(filters, fmt.Sprintf(" event = %d", intRep))
 	}
 
-	if limit == 0 && offset == 0 {
-		limit = 10
-	}
-	limitAndOffset := fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
-
-	query := fmt.Sprintf(`
-SELECT id, repository, branch, event, source_branch, target_branch, tag, created, blob, status, status_desc, sha, artifact_id
-FROM events
-%s
-ORDER BY created desc
-%s;`, strings.Join(filters, " "), limitAndOffset)
-
-	var data []*model.Event
-	err := meddler.QueryAll(db, &data, query, args...)
-	return data, err
+	return filters, args
 }
 
 // Artifact returns an artifact by id
-func (db *Store) Artifact(id string) (*model.Event, error) {
+func (db *sqlStore) Artifact(id string) (*model.Event, error) {
 	query := fmt.Sprintf(`
-SELECT id, repository, branch, event, source_branch, target_branch, tag, created, blob, status, status_desc, sha, artifact_id
+SELECT id, repository, branch, event, source_branch, target_branch, tag, created, blob, status, status_desc, sha, artifact_id, correlation_id, expired,
+submitted_by, user_agent, ci_url
 FROM events
 WHERE artifact_id = ?;
 `)
 
 	var data model.Event
-	err := meddler.QueryRow(db, &data, query, id)
+	err := meddler.QueryRow(db, &data, sql.Rebind(db.driver, query), id)
 	return &data, err
 }
 
 // Event returns an event by id
-func (db *Store) Event(id string) (*model.Event, error) {
+func (db *sqlStore) Event(id string) (*model.Event, error) {
 	query := fmt.Sprintf(`
-SELECT id, created, blob, status, status_desc, gitops_hashes
+SELECT id, created, blob, status, status_desc, gitops_hashes, triggered_envs, correlation_id, env_statuses, logs
 FROM events
 WHERE id = ?;
 `)
 
 	var data model.Event
-	err := meddler.QueryRow(db, &data, query, id)
+	err := meddler.QueryRow(db, &data, sql.Rebind(db.driver, query), id)
 	return &data, err
 }
 
 // UnprocessedEvents selects an event timeline
-func (db *Store) UnprocessedEvents() (events []*model.Event, err error) {
+func (db *sqlStore) UnprocessedEvents() (events []*model.Event, err error) {
 	stmt := sql.Stmt(db.driver, sql.SelectUnprocessedEvents)
 	err = meddler.QueryAll(db, &events, stmt)
 	return events, err
 }
 
 // UpdateEventStatus updates an event status in the database
-func (db *Store) UpdateEventStatus(id string, status string, desc string, gitopsStatusString string) error {
-	stmt := sql.Stmt(db.driver, sql.UpdateEventStatus)
-	_, err := db.Exec(stmt, status, desc, gitopsStatusString, id)
+func (db *sqlStore) UpdateEventStatus(id string, status string, desc string, gitopsStatusString string, triggeredEnvsString string, envStatusesString string) error {
+	return db.inTx(func(tx *database_sql.Tx) error {
+		stmt := sql.Stmt(db.driver, sql.UpdateEventStatus)
+		_, err := tx.Exec(stmt, status, desc, gitopsStatusString, triggeredEnvsString, envStatusesString, id)
+		if err != nil {
+			return err
+		}
+		return db.recordEventChange(tx, id, status, desc)
+	})
+}
+
+// UpdateEventLogs stores the last log lines of an event's processing
+func (db *sqlStore) UpdateEventLogs(id string, logsString string) error {
+	stmt := sql.Stmt(db.driver, sql.UpdateEventLogs)
+	_, err := db.Exec(stmt, logsString, id)
+	return err
+}
+
+// MarkEventProcessing flags an event that a worker started processing
+func (db *sqlStore) MarkEventProcessing(id string) error {
+	return db.inTx(func(tx *database_sql.Tx) error {
+		stmt := sql.Stmt(db.driver, sql.MarkEventProcessing)
+		_, err := tx.Exec(stmt, time.Now().Unix(), id)
+		if err != nil {
+			return err
+		}
+		return db.recordEventChange(tx, id, model.StatusProcessing, "")
+	})
+}
+
+// StuckEvents returns the events that are in processing since before the given time
+func (db *sqlStore) StuckEvents(startedBefore time.Time) (events []*model.Event, err error) {
+	stmt := sql.Stmt(db.driver, sql.SelectStuckEvents)
+	err = meddler.QueryAll(db, &events, stmt, startedBefore.Unix())
+	return events, err
+}
+
+// EventBacklog returns the number of events waiting to be processed, and the creation time of the oldest one
+func (db *sqlStore) EventBacklog() (int, time.Time, error) {
+	stmt := sql.Stmt(db.driver, sql.SelectEventBacklog)
+	var size int
+	var oldest int64
+	err := db.QueryRow(stmt).Scan(&size, &oldest)
+	return size, time.Unix(oldest, 0), err
+}
+
+// CheckingEvents returns the events that wait for the CI checks of their gitops commits
+func (db *sqlStore) CheckingEvents() (events []*model.Event, err error) {
+	stmt := sql.Stmt(db.driver, sql.SelectCheckingEvents)
+	err = meddler.QueryAll(db, &events, stmt)
+	return events, err
+}
+
+// DeployEvents returns the processed artifact, release and rollback events created in the given time range
+func (db *sqlStore) DeployEvents(since, until time.Time) (events []*model.Event, err error) {
+	stmt := sql.Stmt(db.driver, sql.SelectDeployEvents)
+	err = meddler.QueryAll(db, &events, stmt, since.Unix(), until.Unix())
+	return events, err
+}
+
+// RepositoryEvents returns the artifact, release and reevaluation events of a repository, oldest first
+func (db *sqlStore) RepositoryEvents(repo string) (events []*model.Event, err error) {
+	stmt := sql.Stmt(db.driver, sql.SelectRepositoryEvents)
+	err = meddler.QueryAll(db, &events, stmt, repo)
+	return events, err
+}
+
+// RequeueEvent puts a processing event back to the queue
+func (db *sqlStore) RequeueEvent(id string) error {
+	return db.inTx(func(tx *database_sql.Tx) error {
+		stmt := sql.Stmt(db.driver, sql.RequeueEvent)
+		result, err := tx.Exec(stmt, id)
+		if err != nil {
+			return err
+		}
+		requeued, err := result.RowsAffected()
+		if err != nil || requeued == 0 {
+			return err
+		}
+		return db.recordEventChange(tx, id, model.StatusNew, "")
+	})
+}
+
+// HoldEvent takes a new event out of the queue until RequeueHeldEvents
+func (db *sqlStore) HoldEvent(id string, desc string) error {
+	return db.inTx(func(tx *database_sql.Tx) error {
+		stmt := sql.Stmt(db.driver, sql.HoldEvent)
+		result, err := tx.Exec(stmt, desc, id)
+		if err != nil {
+			return err
+		}
+		held, err := result.RowsAffected()
+		if err != nil || held == 0 {
+			return err
+		}
+		return db.recordEventChange(tx, id, model.StatusHeld, desc)
+	})
+}
+
+// RequeueHeldEvents puts the held events back to the queue, and returns their number
+func (db *sqlStore) RequeueHeldEvents() (int, error) {
+	requeued := 0
+	err := db.inTx(func(tx *database_sql.Tx) error {
+		var ids []string
+		rows, err := tx.Query(sql.Stmt(db.driver, sql.SelectHeldEvents))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		stmt := sql.Stmt(db.driver, sql.RequeueHeldEvent)
+		for _, id := range ids {
+			result, err := tx.Exec(stmt, id)
+			if err != nil {
+				return err
+			}
+			if n, err := result.RowsAffected(); err != nil || n == 0 {
+				continue
+			}
+			requeued++
+			err = db.recordEventChange(tx, id, model.StatusNew, "")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return requeued, err
+}
+
+// EventChanges returns the next batch of event state changes after the given change ID, that were recorded before the given time
+func (db *sqlStore) EventChanges(afterID int64, before time.Time, limit int) (changes []*model.EventChange, err error) {
+	stmt := sql.Stmt(db.driver, sql.SelectEventChanges)
+	err = meddler.QueryAll(db, &changes, stmt, afterID, before.Unix(), limit)
+	return changes, err
+}
+
+// DeleteEventChanges deletes the event state changes up to, and including the given change ID
+func (db *sqlStore) DeleteEventChanges(throughID int64) error {
+	stmt := sql.Stmt(db.driver, sql.DeleteEventChanges)
+	_, err := db.Exec(stmt, throughID)
+	return err
+}
+
+// PruneEventChanges deletes the event state changes recorded before the given time
+func (db *sqlStore) PruneEventChanges(before time.Time) error {
+	stmt := sql.Stmt(db.driver, sql.PruneEventChanges)
+	_, err := db.Exec(stmt, before.Unix())
+	return err
+}
+
+// UnexpiredArtifacts returns the artifact events that are not expired yet, oldest first
+func (db *sqlStore) UnexpiredArtifacts() (events []*model.Event, err error) {
+	stmt := sql.Stmt(db.driver, sql.SelectUnexpiredArtifacts)
+	err = meddler.QueryAll(db, &events, stmt)
+	return events, err
+}
+
+// ExpireArtifact marks the artifact expired
+func (db *sqlStore) ExpireArtifact(artifactID string) error {
+	stmt := sql.Stmt(db.driver, sql.ExpireArtifact)
+	_, err := db.Exec(stmt, time.Now().Unix(), artifactID)
+	return err
+}
+
+// ExpireArtifactsCreatedBefore marks the artifacts created before the given time expired, and returns their number
+func (db *sqlStore) ExpireArtifactsCreatedBefore(before time.Time) (int64, error) {
+	stmt := sql.Stmt(db.driver, sql.ExpireArtifactsCreatedBefore)
+	result, err := db.Exec(stmt, time.Now().Unix(), before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// recordEventChange appends an event state change to the outbox of the event firehose
+func (db *sqlStore) recordEventChange(tx *database_sql.Tx, id string, status string, desc string) error {
+	stmt := sql.Stmt(db.driver, sql.InsertEventChange)
+	_, err := tx.Exec(stmt, id, status, desc, time.Now().Unix())
 	return err
 }
 
+func (db *sqlStore) inTx(f func(tx *database_sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = f(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func addFilter(filters []string, filter string) []string {
 	if len(filters) == 0 {
 		return append(filters, "WHERE "+filter)
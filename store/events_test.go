@@ -5,6 +5,7 @@ import (
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -48,9 +49,134 @@ func TestEventCRUD(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotEqual(t, savedEvent.Created, 0)
 	assert.Equal(t, savedEvent.Event, dx.PR)
+	assert.NotEmpty(t, savedEvent.CorrelationID, "should generate a correlation id")
 
-	artifacts, err := s.Artifacts("", "", nil, "", []string{}, 0, 0, nil, nil)
+	artifacts, err := s.Artifacts("", "", nil, "", []string{}, "", nil, 0, 0, nil, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(artifacts))
 	assert.Equal(t, "ea9ab7cc31b2599bf4afcfd639da516ca27a4780", artifacts[0].SHA)
+	assert.Equal(t, savedEvent.CorrelationID, artifacts[0].CorrelationID)
+}
+
+func TestArtifactsCursor(t *testing.T) {
+	s := NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	for _, sha := range []string{"a", "b", "c"} {
+		event, _ := model.ToEvent(dx.Artifact{Version: dx.Version{RepositoryName: "my-app", SHA: sha}})
+		_, err := s.CreateEvent(event)
+		assert.Nil(t, err)
+	}
+
+	count, err := s.ArtifactsCount("my-app", "", nil, "", nil, "", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+
+	var seen []string
+	var cursor *model.Cursor
+	for i := 0; i < 3; i++ {
+		page, err := s.Artifacts("my-app", "", nil, "", nil, "", cursor, 1, 0, nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(page))
+		seen = append(seen, page[0].SHA)
+		cursor = &model.Cursor{CreatedNano: page[0].CreatedNano, ID: page[0].ID}
+	}
+	all, err := s.Artifacts("my-app", "", nil, "", nil, "", nil, 3, 0, nil, nil)
+	assert.Nil(t, err)
+	var listed []string
+	for _, a := range all {
+		listed = append(listed, a.SHA)
+	}
+	assert.Equal(t, listed, seen, "should page through artifacts created in the same second in the order of the list")
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, seen)
+
+	page, err := s.Artifacts("my-app", "", nil, "", nil, "", cursor, 1, 0, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(page))
+}
+
+func TestEventChanges(t *testing.T) {
+	s := NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	event, err := s.CreateEvent(&model.Event{
+		Type:         model.TypeRelease,
+		Blob:         "{}",
+		Repository:   "my-app",
+		GitopsHashes: []string{},
+	})
+	assert.Nil(t, err)
+	err = s.MarkEventProcessing(event.ID)
+	assert.Nil(t, err)
+	err = s.UpdateEventStatus(event.ID, model.StatusError, "cannot render", "[]", "[]", "[]")
+	assert.Nil(t, err)
+	err = s.RequeueEvent(event.ID)
+	assert.Nil(t, err)
+
+	now := time.Now().Add(time.Second)
+	changes, err := s.EventChanges(0, now, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(changes), "requeueing an event that is not in processing is not a change")
+	assert.Equal(t, model.StatusNew, changes[0].Status)
+	assert.Equal(t, model.StatusProcessing, changes[1].Status)
+	assert.Equal(t, model.StatusError, changes[2].Status)
+	assert.Equal(t, "cannot render", changes[2].StatusDesc)
+	assert.Equal(t, "my-app", changes[2].Repository)
+	assert.Equal(t, event.CorrelationID, changes[2].CorrelationID)
+
+	changes, err = s.EventChanges(changes[0].ID, now, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, model.StatusProcessing, changes[0].Status)
+
+	err = s.DeleteEventChanges(changes[0].ID)
+	assert.Nil(t, err)
+	changes, err = s.EventChanges(0, now, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(changes))
+
+	err = s.PruneEventChanges(now)
+	assert.Nil(t, err)
+	changes, err = s.EventChanges(0, now, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(changes))
+}
+
+func TestArtifactExpiry(t *testing.T) {
+	s := NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	for _, id := range []string{"my-app-1", "my-app-2"} {
+		artifactEvent, _ := model.ToEvent(dx.Artifact{ID: id, Version: dx.Version{RepositoryName: "my-app"}})
+		_, err := s.CreateEvent(artifactEvent)
+		assert.Nil(t, err)
+	}
+
+	err := s.ExpireArtifact("my-app-1")
+	assert.Nil(t, err)
+	artifact, err := s.Artifact("my-app-1")
+	assert.Nil(t, err)
+	assert.NotEqual(t, int64(0), artifact.Expired)
+
+	unexpired, err := s.UnexpiredArtifacts()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(unexpired))
+	assert.Equal(t, "my-app-2", unexpired[0].ArtifactID)
+
+	expired, err := s.ExpireArtifactsCreatedBefore(time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), expired, "should not expire recent artifacts")
+	expired, err = s.ExpireArtifactsCreatedBefore(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), expired, "should only count the newly expired artifacts")
+
+	unexpired, err = s.UnexpiredArtifacts()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(unexpired))
 }
@@ -7,7 +7,7 @@ import (
 	"github.com/russross/meddler"
 )
 
-func (db *Store) GitopsCommit(sha string) (*model.GitopsCommit, error) {
+func (db *sqlStore) GitopsCommit(sha string) (*model.GitopsCommit, error) {
 	stmt := queries.Stmt(db.driver, queries.SelectGitopsCommitBySha)
 	gitopsCommit := new(model.GitopsCommit)
 	err := meddler.QueryRow(db, gitopsCommit, stmt, sha)
@@ -21,7 +21,7 @@ func (db *Store) GitopsCommit(sha string) (*model.GitopsCommit, error) {
 	return gitopsCommit, err
 }
 
-func (db *Store) SaveOrUpdateGitopsCommit(gitopsCommit *model.GitopsCommit) error {
+func (db *sqlStore) SaveOrUpdateGitopsCommit(gitopsCommit *model.GitopsCommit) error {
 	stmt := queries.Stmt(db.driver, queries.SelectGitopsCommitBySha)
 	savedGitopsCommit := new(model.GitopsCommit)
 	err := meddler.QueryRow(db, savedGitopsCommit, stmt, gitopsCommit.Sha)
@@ -33,5 +33,6 @@ func (db *Store) SaveOrUpdateGitopsCommit(gitopsCommit *model.GitopsCommit) erro
 
 	savedGitopsCommit.Status = gitopsCommit.Status
 	savedGitopsCommit.StatusDesc = gitopsCommit.StatusDesc
+	savedGitopsCommit.Created = gitopsCommit.Created
 	return meddler.Update(db, "gitops_commits", savedGitopsCommit)
 }
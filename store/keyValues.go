@@ -3,13 +3,19 @@ package store
 import (
 	database_sql "database/sql"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/store/sql"
 	"github.com/russross/meddler"
 )
 
 // SaveKeyValue sets a setting
-func (db *Store) SaveKeyValue(setting *model.KeyValue) error {
+func (db *sqlStore) SaveKeyValue(setting *model.KeyValue) error {
 	storedSetting, err := db.KeyValue(setting.Key)
 
 	if err != nil {
@@ -26,7 +32,7 @@ func (db *Store) SaveKeyValue(setting *model.KeyValue) error {
 }
 
 // KeyValue returns the value of a given KeyValue key
-func (db *Store) KeyValue(key string) (*model.KeyValue, error) {
+func (db *sqlStore) KeyValue(key string) (*model.KeyValue, error) {
 	stmt := sql.Stmt(db.driver, sql.SelectKeyValue)
 	data := new(model.KeyValue)
 	err := meddler.QueryRow(db, data, stmt, key)
@@ -60,3 +66,408 @@ func (db *Store) SaveReposWithCleanupPolicy(reposWithCleanupPolicy []string) err
 
 	return db.SaveKeyValue(reposWithCleanupPolicyKeyValue)
 }
+
+// ImageUpdatePolicies returns the apps with an image update policy, empty if none was recorded
+func (db *Store) ImageUpdatePolicies() ([]*model.ImageUpdatePolicy, error) {
+	policies := []*model.ImageUpdatePolicy{}
+	keyValue, err := db.KeyValue(model.ImageUpdatePolicies)
+	if err == database_sql.ErrNoRows {
+		return policies, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(keyValue.Value), &policies)
+	return policies, err
+}
+
+// SaveImageUpdatePolicies stores the apps with an image update policy
+func (db *Store) SaveImageUpdatePolicies(policies []*model.ImageUpdatePolicy) error {
+	policiesBytes, err := json.Marshal(policies)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.ImageUpdatePolicies,
+		Value: string(policiesBytes),
+	})
+}
+
+// Freezes returns the release freezes of the apps, empty if none was made
+func (db *Store) Freezes() ([]*dx.Freeze, error) {
+	freezes := []*dx.Freeze{}
+	keyValue, err := db.KeyValue(model.Freezes)
+	if err == database_sql.ErrNoRows {
+		return freezes, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(keyValue.Value), &freezes)
+	return freezes, err
+}
+
+// SaveFreezes stores the release freezes of the apps
+func (db *Store) SaveFreezes(freezes []*dx.Freeze) error {
+	freezesBytes, err := json.Marshal(freezes)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.Freezes,
+		Value: string(freezesBytes),
+	})
+}
+
+// FailingEnvSyncs returns the envs whose Flux sync is failing, empty if none is
+func (db *Store) FailingEnvSyncs() ([]*dx.EnvSync, error) {
+	syncs := []*dx.EnvSync{}
+	keyValue, err := db.KeyValue(model.FailingEnvSyncs)
+	if err == database_sql.ErrNoRows {
+		return syncs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(keyValue.Value), &syncs)
+	return syncs, err
+}
+
+// SaveFailingEnvSyncs stores the envs whose Flux sync is failing
+func (db *Store) SaveFailingEnvSyncs(syncs []*dx.EnvSync) error {
+	syncsBytes, err := json.Marshal(syncs)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.FailingEnvSyncs,
+		Value: string(syncsBytes),
+	})
+}
+
+// LastRollback returns the time of the last rollback of an app in an env
+func (db *Store) LastRollback(env string, app string) (time.Time, error) {
+	return db.timeValue(fmt.Sprintf("%s/%s/%s", model.LastRollback, env, app))
+}
+
+// SaveLastRollback records the time of the last rollback of an app in an env
+func (db *Store) SaveLastRollback(env string, app string, t time.Time) error {
+	return db.saveTimeValue(fmt.Sprintf("%s/%s/%s", model.LastRollback, env, app), t)
+}
+
+// Heartbeat returns the time a worker last reported being alive
+func (db *Store) Heartbeat(worker string) (time.Time, error) {
+	return db.timeValue(fmt.Sprintf("%s/%s", model.WorkerHeartbeat, worker))
+}
+
+// SaveHeartbeat records that a worker is alive
+func (db *Store) SaveHeartbeat(worker string, t time.Time) error {
+	return db.saveTimeValue(fmt.Sprintf("%s/%s", model.WorkerHeartbeat, worker), t)
+}
+
+// ReleaseState returns the releases that the release state worker last found, empty if it never ran
+func (db *Store) ReleaseState() (*dx.ReleaseState, error) {
+	releaseState := &dx.ReleaseState{Releases: []*dx.AppReleaseState{}}
+	keyValue, err := db.KeyValue(model.ReleaseState)
+	if err == database_sql.ErrNoRows {
+		return releaseState, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(keyValue.Value), releaseState)
+	return releaseState, err
+}
+
+// SaveReleaseState stores the releases that the release state worker found
+func (db *Store) SaveReleaseState(releaseState *dx.ReleaseState) error {
+	releaseStateBytes, err := json.Marshal(releaseState)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.ReleaseState,
+		Value: string(releaseStateBytes),
+	})
+}
+
+// GitopsHistoryRewrite returns the last unacknowledged rewrite of the gitops repo history, nil if there is none
+func (db *Store) GitopsHistoryRewrite() (*dx.GitopsHistoryRewrite, error) {
+	keyValue, err := db.KeyValue(model.GitopsHistoryRewrite)
+	if err == database_sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var rewrite *dx.GitopsHistoryRewrite
+	err = json.Unmarshal([]byte(keyValue.Value), &rewrite)
+	return rewrite, err
+}
+
+// SaveGitopsHistoryRewrite stores a rewrite of the gitops repo history, nil acknowledges the stored one
+func (db *Store) SaveGitopsHistoryRewrite(rewrite *dx.GitopsHistoryRewrite) error {
+	rewriteBytes, err := json.Marshal(rewrite)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.GitopsHistoryRewrite,
+		Value: string(rewriteBytes),
+	})
+}
+
+// Groups returns the user groups, empty if they were never synced
+func (db *Store) Groups() ([]*model.Group, error) {
+	groups := []*model.Group{}
+	keyValue, err := db.KeyValue(model.Groups)
+	if err == database_sql.ErrNoRows {
+		return groups, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(keyValue.Value), &groups)
+	return groups, err
+}
+
+// SaveGroups replaces the user groups
+func (db *Store) SaveGroups(groups []*model.Group) error {
+	groupsBytes, err := json.Marshal(groups)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.Groups,
+		Value: string(groupsBytes),
+	})
+}
+
+// GroupsOf returns the names of the groups that the user is a member of
+func (db *Store) GroupsOf(login string) ([]string, error) {
+	groups, err := db.Groups()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, group := range groups {
+		for _, member := range group.Members {
+			if strings.EqualFold(member, login) {
+				names = append(names, group.Name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// Maintenance returns the maintenance mode state, disabled if it was never set
+func (db *Store) Maintenance() (*dx.Maintenance, error) {
+	maintenance := &dx.Maintenance{}
+	keyValue, err := db.KeyValue(model.Maintenance)
+	if err == database_sql.ErrNoRows {
+		return maintenance, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(keyValue.Value), maintenance)
+	return maintenance, err
+}
+
+// SaveMaintenance stores the maintenance mode state
+func (db *Store) SaveMaintenance(maintenance *dx.Maintenance) error {
+	maintenanceBytes, err := json.Marshal(maintenance)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.Maintenance,
+		Value: string(maintenanceBytes),
+	})
+}
+
+// FirehoseCursor returns the ID of the last event change that the firehose sink acknowledged, zero if none was
+func (db *Store) FirehoseCursor() (int64, error) {
+	keyValue, err := db.KeyValue(model.FirehoseCursor)
+	if err == database_sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(keyValue.Value, 10, 64)
+}
+
+// SaveFirehoseCursor records the ID of the last event change that the firehose sink acknowledged
+func (db *Store) SaveFirehoseCursor(cursor int64) error {
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.FirehoseCursor,
+		Value: strconv.FormatInt(cursor, 10),
+	})
+}
+
+func (db *Store) timeValue(key string) (time.Time, error) {
+	keyValue, err := db.KeyValue(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	unix, err := strconv.ParseInt(keyValue.Value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(unix, 0), nil
+}
+
+func (db *Store) saveTimeValue(key string, t time.Time) error {
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   key,
+		Value: strconv.FormatInt(t.Unix(), 10),
+	})
+}
+
+// DeployKeyRotations returns the deploy key rotation audit log, newest first
+func (db *Store) DeployKeyRotations() ([]*model.DeployKeyRotation, error) {
+	rotations := []*model.DeployKeyRotation{}
+	keyValue, err := db.KeyValue(model.DeployKeyRotations)
+	if err == database_sql.ErrNoRows {
+		return rotations, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(keyValue.Value), &rotations)
+	return rotations, err
+}
+
+// RecordDeployKeyRotation adds an entry to the deploy key rotation audit log
+func (db *Store) RecordDeployKeyRotation(rotation *model.DeployKeyRotation) error {
+	rotations, err := db.DeployKeyRotations()
+	if err != nil {
+		return err
+	}
+
+	rotations = append([]*model.DeployKeyRotation{rotation}, rotations...)
+	if len(rotations) > model.MaxDeployKeyRotations {
+		rotations = rotations[:model.MaxDeployKeyRotations]
+	}
+	rotationsBytes, err := json.Marshal(rotations)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.DeployKeyRotations,
+		Value: string(rotationsBytes),
+	})
+}
+
+// ReleaseHookTokens returns the scoped tokens of the release webhook
+func (db *Store) ReleaseHookTokens() ([]*model.ReleaseHookToken, error) {
+	tokens := []*model.ReleaseHookToken{}
+	keyValue, err := db.KeyValue(model.ReleaseHookTokens)
+	if err == database_sql.ErrNoRows {
+		return tokens, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(keyValue.Value), &tokens)
+	return tokens, err
+}
+
+// SaveReleaseHookTokens stores the scoped tokens of the release webhook
+func (db *Store) SaveReleaseHookTokens(tokens []*model.ReleaseHookToken) error {
+	tokensBytes, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.ReleaseHookTokens,
+		Value: string(tokensBytes),
+	})
+}
+
+// ArtifactCallbacks returns the callback URLs that are notified of deploy decisions on artifacts
+func (db *Store) ArtifactCallbacks() ([]*model.ArtifactCallback, error) {
+	callbacks := []*model.ArtifactCallback{}
+	keyValue, err := db.KeyValue(model.ArtifactCallbacks)
+	if err == database_sql.ErrNoRows {
+		return callbacks, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(keyValue.Value), &callbacks)
+	return callbacks, err
+}
+
+// SaveArtifactCallbacks stores the callback URLs that are notified of deploy decisions on artifacts
+func (db *Store) SaveArtifactCallbacks(callbacks []*model.ArtifactCallback) error {
+	callbacksBytes, err := json.Marshal(callbacks)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.ArtifactCallbacks,
+		Value: string(callbacksBytes),
+	})
+}
+
+// ArtifactRepoAllowlist returns the source repositories that were allowed to submit artifacts with the admin API
+func (db *Store) ArtifactRepoAllowlist() ([]*model.AllowedRepository, error) {
+	allowlist := []*model.AllowedRepository{}
+	keyValue, err := db.KeyValue(model.ArtifactRepoAllowlist)
+	if err == database_sql.ErrNoRows {
+		return allowlist, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(keyValue.Value), &allowlist)
+	return allowlist, err
+}
+
+// ArtifactRepoAllowed tells if the user may submit the artifacts of the repository, by the configured and the stored allowlist.
+// Every repository is allowed while both lists are empty
+func (db *Store) ArtifactRepoAllowed(configured []*model.AllowedRepository, repository string, login string) (bool, error) {
+	allowlist, err := db.ArtifactRepoAllowlist()
+	if err != nil {
+		return false, err
+	}
+	if len(configured) == 0 && len(allowlist) == 0 {
+		return true, nil
+	}
+
+	for _, allowed := range append(append([]*model.AllowedRepository{}, configured...), allowlist...) {
+		if allowed.Allows(repository, login) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SaveArtifactRepoAllowlist stores the source repositories that are allowed to submit artifacts
+func (db *Store) SaveArtifactRepoAllowlist(allowlist []*model.AllowedRepository) error {
+	allowlistBytes, err := json.Marshal(allowlist)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveKeyValue(&model.KeyValue{
+		Key:   model.ArtifactRepoAllowlist,
+		Value: string(allowlistBytes),
+	})
+}
@@ -0,0 +1,703 @@
+package store
+
+import (
+	database_sql "database/sql"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/google/uuid"
+)
+
+// unprocessedEventsBatch is the size of the batches that UnprocessedEvents returns
+const unprocessedEventsBatch = 10
+
+// memoryStore is the storage driver that keeps everything in memory,
+// for embedded and demo runs, and for tests that don't need a database.
+// Nothing is persisted, the data is gone when the process exits
+type memoryStore struct {
+	lock sync.RWMutex
+
+	events        []*model.Event
+	eventChanges  []*model.EventChange
+	changeSeq     int64
+	gitopsCommits map[string]*model.GitopsCommit
+	commitSeq     int64
+	keyValues     map[string]*model.KeyValue
+	keyValueSeq   int64
+	users         []*model.User
+	userSeq       int64
+
+	notify chan struct{}
+}
+
+func init() {
+	Register("memory", openMemoryStore)
+}
+
+// NewMemory returns a Store that keeps everything in memory
+func NewMemory() *Store {
+	return &Store{Driver: newMemoryStore()}
+}
+
+func openMemoryStore(driver, config string) (Driver, error) {
+	return newMemoryStore(), nil
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		gitopsCommits: map[string]*model.GitopsCommit{},
+		keyValues:     map[string]*model.KeyValue{},
+		notify:        make(chan struct{}, 1),
+	}
+}
+
+// CreateEvent stores a new event
+func (m *memoryStore) CreateEvent(event *model.Event) (*model.Event, error) {
+	event.ID = uuid.New().String()
+	event.CreatedNano = nextCreatedNano()
+	event.Created = event.CreatedNano / int64(time.Second)
+	event.Status = model.StatusNew
+	if event.CorrelationID == "" {
+		event.CorrelationID = uuid.New().String()
+	}
+
+	m.lock.Lock()
+	m.events = append(m.events, copyEvent(event))
+	m.recordEventChange(event.ID, event.Status, "")
+	m.lock.Unlock()
+
+	select {
+	case m.notify <- struct{}{}:
+	default: // a signal is already pending
+	}
+	return event, nil
+}
+
+// listedBefore tells if the artifact a is listed before b: newest second first,
+// and in the order of their creation within the same second
+func listedBefore(a *model.Event, b *model.Event) bool {
+	if a.Created != b.Created {
+		return a.Created > b.Created
+	}
+	if a.CreatedNano != b.CreatedNano {
+		return a.CreatedNano < b.CreatedNano
+	}
+	return a.ID < b.ID
+}
+
+// Artifacts returns all artifact events within the given constraints, newest second first,
+// and in the order of their creation within the same second.
+// With a cursor, the artifacts after the cursor's position are returned, and the offset is ignored
+func (m *memoryStore) Artifacts(
+	repo, branch string,
+	gitEvent *dx.GitEvent,
+	sourceBranch string,
+	sha []string,
+	submittedBy string,
+	cursor *model.Cursor,
+	limit, offset int,
+	since, until *time.Time) ([]*model.Event, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var artifacts []*model.Event
+	for _, e := range m.events {
+		if !artifactMatches(e, repo, branch, gitEvent, sourceBranch, sha, submittedBy, since, until) {
+			continue
+		}
+		if cursor != nil && !listedBefore(&model.Event{Created: cursor.CreatedNano / int64(time.Second), CreatedNano: cursor.CreatedNano, ID: cursor.ID}, e) {
+			continue
+		}
+		artifacts = append(artifacts, copyEvent(e))
+	}
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		return listedBefore(artifacts[i], artifacts[j])
+	})
+
+	if cursor != nil {
+		offset = 0
+	}
+	if limit == 0 && offset == 0 {
+		limit = 10
+	}
+	if offset >= len(artifacts) {
+		return nil, nil
+	}
+	artifacts = artifacts[offset:]
+	if limit > 0 && limit < len(artifacts) {
+		artifacts = artifacts[:limit]
+	}
+	return artifacts, nil
+}
+
+// ArtifactsCount returns the number of artifact events within the given constraints
+func (m *memoryStore) ArtifactsCount(
+	repo, branch string,
+	gitEvent *dx.GitEvent,
+	sourceBranch string,
+	sha []string,
+	submittedBy string,
+	since, until *time.Time) (int, error) {
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	count := 0
+	for _, e := range m.events {
+		if artifactMatches(e, repo, branch, gitEvent, sourceBranch, sha, submittedBy, since, until) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// artifactMatches is the in-memory counterpart of artifactFilters
+func artifactMatches(
+	e *model.Event,
+	repo, branch string,
+	gitEvent *dx.GitEvent,
+	sourceBranch string,
+	sha []string,
+	submittedBy string,
+	since, until *time.Time) bool {
+
+	if e.Type != model.TypeArtifact {
+		return false
+	}
+	if since != nil && e.Created < since.Unix() {
+		return false
+	}
+	if until != nil && e.Created >= until.Unix() {
+		return false
+	}
+	if repo != "" && e.Repository != repo {
+		return false
+	}
+	if branch != "" && e.Branch != branch {
+		return false
+	}
+	if sourceBranch != "" && e.Branch != sourceBranch {
+		return false
+	}
+	if len(sha) != 0 && !contains(sha, e.SHA) {
+		return false
+	}
+	if submittedBy != "" && e.SubmittedBy != submittedBy {
+		return false
+	}
+	if gitEvent != nil && e.Event != *gitEvent {
+		return false
+	}
+	return true
+}
+
+// Artifact returns an artifact event by artifact id
+func (m *memoryStore) Artifact(id string) (*model.Event, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, e := range m.events {
+		if e.ArtifactID == id {
+			return copyEvent(e), nil
+		}
+	}
+	return &model.Event{}, database_sql.ErrNoRows
+}
+
+// Event returns an event by id
+func (m *memoryStore) Event(id string) (*model.Event, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if e := m.event(id); e != nil {
+		return copyEvent(e), nil
+	}
+	return &model.Event{}, database_sql.ErrNoRows
+}
+
+// UnprocessedEvents returns the next batch of events to process, oldest first
+func (m *memoryStore) UnprocessedEvents() ([]*model.Event, error) {
+	events := m.eventsWhere(func(e *model.Event) bool {
+		return e.Status == model.StatusNew
+	}, byCreated)
+	if len(events) > unprocessedEventsBatch {
+		events = events[:unprocessedEventsBatch]
+	}
+	return events, nil
+}
+
+// UpdateEventStatus updates an event status
+func (m *memoryStore) UpdateEventStatus(id string, status string, desc string, gitopsStatusString string, triggeredEnvsString string, envStatusesString string) error {
+	var gitopsHashes, triggeredEnvs []string
+	var envStatuses []dx.EnvStatus
+	if err := unmarshalColumn(gitopsStatusString, &gitopsHashes); err != nil {
+		return err
+	}
+	if err := unmarshalColumn(triggeredEnvsString, &triggeredEnvs); err != nil {
+		return err
+	}
+	if err := unmarshalColumn(envStatusesString, &envStatuses); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	e := m.event(id)
+	if e == nil {
+		return nil
+	}
+	e.Status = status
+	e.StatusDesc = desc
+	e.GitopsHashes = gitopsHashes
+	e.TriggeredEnvs = triggeredEnvs
+	e.EnvStatuses = envStatuses
+	m.recordEventChange(id, status, desc)
+	return nil
+}
+
+// UpdateEventLogs stores the last log lines of an event's processing
+func (m *memoryStore) UpdateEventLogs(id string, logsString string) error {
+	var logs []string
+	if err := unmarshalColumn(logsString, &logs); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if e := m.event(id); e != nil {
+		e.Logs = logs
+	}
+	return nil
+}
+
+// MarkEventProcessing flags an event that a worker started processing
+func (m *memoryStore) MarkEventProcessing(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if e := m.event(id); e != nil {
+		e.Status = model.StatusProcessing
+		e.ProcessingStarted = time.Now().Unix()
+	}
+	m.recordEventChange(id, model.StatusProcessing, "")
+	return nil
+}
+
+// StuckEvents returns the events that are in processing since before the given time
+func (m *memoryStore) StuckEvents(startedBefore time.Time) ([]*model.Event, error) {
+	return m.eventsWhere(func(e *model.Event) bool {
+		return e.Status == model.StatusProcessing && e.ProcessingStarted < startedBefore.Unix()
+	}, byProcessingStarted), nil
+}
+
+// EventBacklog returns the number of events waiting to be processed, and the creation time of the oldest one
+func (m *memoryStore) EventBacklog() (int, time.Time, error) {
+	backlog := m.eventsWhere(func(e *model.Event) bool {
+		return e.Status == model.StatusNew
+	}, byCreated)
+	if len(backlog) == 0 {
+		return 0, time.Unix(0, 0), nil
+	}
+	return len(backlog), time.Unix(backlog[0].Created, 0), nil
+}
+
+// CheckingEvents returns the events that wait for the CI checks of their gitops commits
+func (m *memoryStore) CheckingEvents() ([]*model.Event, error) {
+	return m.eventsWhere(func(e *model.Event) bool {
+		return e.Status == model.StatusChecking
+	}, byProcessingStarted), nil
+}
+
+// DeployEvents returns the processed artifact, release and rollback events created in the given time range
+func (m *memoryStore) DeployEvents(since, until time.Time) ([]*model.Event, error) {
+	types := []string{model.TypeArtifact, model.TypeRelease, model.TypeReevaluation, model.TypeRollback}
+	statuses := []string{model.StatusProcessed, model.StatusPartial}
+	return m.eventsWhere(func(e *model.Event) bool {
+		return contains(types, e.Type) && contains(statuses, e.Status) &&
+			e.Created >= since.Unix() && e.Created < until.Unix()
+	}, byCreated), nil
+}
+
+// RepositoryEvents returns the artifact, release and reevaluation events of a repository, oldest first
+func (m *memoryStore) RepositoryEvents(repo string) ([]*model.Event, error) {
+	types := []string{model.TypeArtifact, model.TypeRelease, model.TypeReevaluation}
+	return m.eventsWhere(func(e *model.Event) bool {
+		return e.Repository == repo && contains(types, e.Type)
+	}, byCreated), nil
+}
+
+// EventsNotify returns a channel that signals when new events are stored
+func (m *memoryStore) EventsNotify() <-chan struct{} {
+	return m.notify
+}
+
+// RequeueEvent puts a processing event back to the queue
+func (m *memoryStore) RequeueEvent(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	e := m.event(id)
+	if e == nil || e.Status != model.StatusProcessing {
+		return nil
+	}
+	e.Status = model.StatusNew
+	e.ProcessingStarted = 0
+	m.recordEventChange(id, model.StatusNew, "")
+	return nil
+}
+
+// HoldEvent takes a new event out of the queue until RequeueHeldEvents
+func (m *memoryStore) HoldEvent(id string, desc string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	e := m.event(id)
+	if e == nil || e.Status != model.StatusNew {
+		return nil
+	}
+	e.Status = model.StatusHeld
+	e.StatusDesc = desc
+	m.recordEventChange(id, model.StatusHeld, desc)
+	return nil
+}
+
+// RequeueHeldEvents puts the held events back to the queue, and returns their number
+func (m *memoryStore) RequeueHeldEvents() (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	requeued := 0
+	for _, e := range m.events {
+		if e.Status != model.StatusHeld {
+			continue
+		}
+		e.Status = model.StatusNew
+		e.StatusDesc = ""
+		m.recordEventChange(e.ID, model.StatusNew, "")
+		requeued++
+	}
+	return requeued, nil
+}
+
+// EventChanges returns the next batch of event state changes after the given change ID, that were recorded before the given time
+func (m *memoryStore) EventChanges(afterID int64, before time.Time, limit int) ([]*model.EventChange, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var changes []*model.EventChange
+	for _, c := range m.eventChanges {
+		if len(changes) == limit {
+			break
+		}
+		if c.ID <= afterID || c.Created >= before.Unix() {
+			continue
+		}
+		change := *c
+		if e := m.event(c.EventID); e != nil {
+			change.Type = e.Type
+			change.Repository = e.Repository
+			change.SHA = e.SHA
+			change.ArtifactID = e.ArtifactID
+			change.CorrelationID = e.CorrelationID
+		}
+		changes = append(changes, &change)
+	}
+	return changes, nil
+}
+
+// DeleteEventChanges deletes the event state changes up to, and including the given change ID
+func (m *memoryStore) DeleteEventChanges(throughID int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.eventChanges = m.changesWhere(func(c *model.EventChange) bool {
+		return c.ID > throughID
+	})
+	return nil
+}
+
+// PruneEventChanges deletes the event state changes recorded before the given time
+func (m *memoryStore) PruneEventChanges(before time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.eventChanges = m.changesWhere(func(c *model.EventChange) bool {
+		return c.Created >= before.Unix()
+	})
+	return nil
+}
+
+// UnexpiredArtifacts returns the artifact events that are not expired yet, oldest first
+func (m *memoryStore) UnexpiredArtifacts() ([]*model.Event, error) {
+	return m.eventsWhere(func(e *model.Event) bool {
+		return e.Type == model.TypeArtifact && e.Expired == 0
+	}, byCreated), nil
+}
+
+// ExpireArtifact marks the artifact expired
+func (m *memoryStore) ExpireArtifact(artifactID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, e := range m.events {
+		if e.ArtifactID == artifactID && e.Expired == 0 {
+			e.Expired = time.Now().Unix()
+		}
+	}
+	return nil
+}
+
+// ExpireArtifactsCreatedBefore marks the artifacts created before the given time expired, and returns their number
+func (m *memoryStore) ExpireArtifactsCreatedBefore(before time.Time) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var expired int64
+	for _, e := range m.events {
+		if e.Type == model.TypeArtifact && e.Expired == 0 && e.Created < before.Unix() {
+			e.Expired = time.Now().Unix()
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// MaintainEventPartitions is a no-op, events are not partitioned in memory
+func (m *memoryStore) MaintainEventPartitions(now time.Time, monthsAhead int, retention time.Duration) error {
+	return nil
+}
+
+// CompressEventBlobs is a no-op, blobs are not compressed in memory
+func (m *memoryStore) CompressEventBlobs(batchSize int) (int, error) {
+	return 0, nil
+}
+
+// GitopsCommit returns a gitops commit by sha, nil if not found
+func (m *memoryStore) GitopsCommit(sha string) (*model.GitopsCommit, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	gitopsCommit, ok := m.gitopsCommits[sha]
+	if !ok {
+		return nil, nil
+	}
+	stored := *gitopsCommit
+	return &stored, nil
+}
+
+// SaveOrUpdateGitopsCommit upserts a gitops commit by sha
+func (m *memoryStore) SaveOrUpdateGitopsCommit(gitopsCommit *model.GitopsCommit) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if saved, ok := m.gitopsCommits[gitopsCommit.Sha]; ok {
+		saved.Status = gitopsCommit.Status
+		saved.StatusDesc = gitopsCommit.StatusDesc
+		saved.Created = gitopsCommit.Created
+		return nil
+	}
+
+	m.commitSeq++
+	gitopsCommit.ID = m.commitSeq
+	stored := *gitopsCommit
+	m.gitopsCommits[gitopsCommit.Sha] = &stored
+	return nil
+}
+
+// SaveKeyValue upserts a key-value pair
+func (m *memoryStore) SaveKeyValue(setting *model.KeyValue) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if stored, ok := m.keyValues[setting.Key]; ok {
+		stored.Value = setting.Value
+		return nil
+	}
+
+	m.keyValueSeq++
+	setting.ID = m.keyValueSeq
+	stored := *setting
+	m.keyValues[setting.Key] = &stored
+	return nil
+}
+
+// KeyValue returns a key-value pair by key
+func (m *memoryStore) KeyValue(key string) (*model.KeyValue, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	stored, ok := m.keyValues[key]
+	if !ok {
+		return new(model.KeyValue), database_sql.ErrNoRows
+	}
+	keyValue := *stored
+	return &keyValue, nil
+}
+
+// User returns a user by its login name
+func (m *memoryStore) User(login string) (*model.User, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, u := range m.users {
+		if u.Login == login {
+			user := *u
+			return &user, nil
+		}
+	}
+	return new(model.User), database_sql.ErrNoRows
+}
+
+// Users returns all users
+func (m *memoryStore) Users() ([]*model.User, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var users []*model.User
+	for _, u := range m.users {
+		user := *u
+		users = append(users, &user)
+	}
+	return users, nil
+}
+
+// CreateUser stores a new user
+func (m *memoryStore) CreateUser(user *model.User) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.userSeq++
+	user.ID = m.userSeq
+	stored := *user
+	stored.Token = "" // not persisted
+	m.users = append(m.users, &stored)
+	return nil
+}
+
+// UpdateUser updates a stored user
+func (m *memoryStore) UpdateUser(user *model.User) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, u := range m.users {
+		if u.ID == user.ID {
+			stored := *user
+			stored.Token = ""
+			m.users[i] = &stored
+			return nil
+		}
+	}
+	return nil
+}
+
+// DeleteUser deletes a user by its login name
+func (m *memoryStore) DeleteUser(login string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var users []*model.User
+	for _, u := range m.users {
+		if u.Login != login {
+			users = append(users, u)
+		}
+	}
+	m.users = users
+	return nil
+}
+
+// Close releases nothing, the data is kept until the process exits
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+// event returns the stored event by id, nil if not found. The lock must be held
+func (m *memoryStore) event(id string) *model.Event {
+	for _, e := range m.events {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// eventsWhere returns copies of the events that match, ordered by the less function
+func (m *memoryStore) eventsWhere(match func(e *model.Event) bool, less func(a, b *model.Event) bool) []*model.Event {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var events []*model.Event
+	for _, e := range m.events {
+		if match(e) {
+			events = append(events, copyEvent(e))
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return less(events[i], events[j])
+	})
+	return events
+}
+
+// changesWhere returns the event changes to keep. The lock must be held
+func (m *memoryStore) changesWhere(keep func(c *model.EventChange) bool) []*model.EventChange {
+	var changes []*model.EventChange
+	for _, c := range m.eventChanges {
+		if keep(c) {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// recordEventChange appends an event state change to the outbox of the event firehose. The lock must be held
+func (m *memoryStore) recordEventChange(id string, status string, desc string) {
+	m.changeSeq++
+	m.eventChanges = append(m.eventChanges, &model.EventChange{
+		ID:         m.changeSeq,
+		EventID:    id,
+		Status:     status,
+		StatusDesc: desc,
+		Created:    time.Now().Unix(),
+	})
+}
+
+// unmarshalColumn parses the JSON that the SQL drivers store as it is, empty is kept as the zero value
+func unmarshalColumn(value string, field interface{}) error {
+	if value == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(value), field)
+}
+
+func byCreated(a, b *model.Event) bool {
+	return a.Created < b.Created
+}
+
+func byProcessingStarted(a, b *model.Event) bool {
+	return a.ProcessingStarted < b.ProcessingStarted
+}
+
+// copyEvent copies the event, so callers can't modify the stored one
+func copyEvent(e *model.Event) *model.Event {
+	event := *e
+	event.GitopsHashes = append([]string(nil), e.GitopsHashes...)
+	event.TriggeredEnvs = append([]string(nil), e.TriggeredEnvs...)
+	event.EnvStatuses = append([]dx.EnvStatus(nil), e.EnvStatuses...)
+	event.Logs = append([]string(nil), e.Logs...)
+	return &event
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryEventQueue(t *testing.T) {
+	s := NewMemory()
+	defer s.Close()
+
+	event, err := s.CreateEvent(&model.Event{Type: model.TypeArtifact, ArtifactID: "my-app-1", Repository: "gimlet-io/my-app"})
+	assert.Nil(t, err)
+	select {
+	case <-s.EventsNotify():
+	default:
+		t.Fatal("should signal the new event")
+	}
+
+	event.Status = "tampered"
+	events, err := s.UnprocessedEvents()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, model.StatusNew, events[0].Status, "should not share the stored event")
+
+	assert.Nil(t, s.MarkEventProcessing(event.ID))
+	size, _, err := s.EventBacklog()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, size)
+	stuck, err := s.StuckEvents(time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(stuck))
+
+	err = s.UpdateEventStatus(event.ID, model.StatusProcessed, "", `["abc123"]`, `["staging"]`, "")
+	assert.Nil(t, err)
+	assert.Nil(t, s.RequeueEvent(event.ID), "should only requeue processing events")
+	stored, err := s.Event(event.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, model.StatusProcessed, stored.Status)
+	assert.Equal(t, []string{"abc123"}, stored.GitopsHashes)
+
+	changes, err := s.EventChanges(0, time.Now().Add(time.Second), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(changes))
+	assert.Equal(t, "gimlet-io/my-app", changes[2].Repository, "should join the event fields")
+
+	_, err = s.Artifact("my-app-2")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = s.KeyValue(model.Maintenance)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestListedBefore(t *testing.T) {
+	older := &model.Event{ID: "b", Created: 1, CreatedNano: 1500000000}
+	first := &model.Event{ID: "c", Created: 2, CreatedNano: 2100000000}
+	second := &model.Event{ID: "a", Created: 2, CreatedNano: 2200000000}
+
+	assert.True(t, listedBefore(first, older), "should list the newer seconds first")
+	assert.True(t, listedBefore(first, second), "should keep the creation order within the same second")
+	assert.False(t, listedBefore(second, first))
+	assert.True(t, listedBefore(&model.Event{ID: "a", Created: 2, CreatedNano: 2000000000}, &model.Event{ID: "b", Created: 2, CreatedNano: 2000000000}),
+		"should order by id if the creation times are the same")
+}
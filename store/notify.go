@@ -0,0 +1,51 @@
+package store
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// eventsNotifyChannel is notified by the trigger on the events table, see the postgres migrations
+const eventsNotifyChannel = "gimletd_events"
+
+// EventsNotify returns a channel that signals when new events are stored, so workers don't have to poll.
+// Only Postgres supports it, on other databases the channel is nil
+func (db *sqlStore) EventsNotify() <-chan struct{} {
+	if db.driver != "postgres" {
+		return nil
+	}
+
+	db.notifyOnce.Do(func() {
+		db.notify = make(chan struct{}, 1)
+		db.listener = pq.NewListener(db.config, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				logrus.Warnf("events listener: %s", err)
+			}
+		})
+		err := db.listener.Listen(eventsNotifyChannel)
+		if err != nil {
+			logrus.Warnf("cannot listen to new events: %s", err)
+		}
+
+		go func() {
+			// a nil notification means the connection was re-established, and notifications may have been missed
+			for range db.listener.Notify {
+				select {
+				case db.notify <- struct{}{}:
+				default: // a signal is already pending
+				}
+			}
+		}()
+	})
+	return db.notify
+}
+
+// Close closes the events listener and the database
+func (db *sqlStore) Close() error {
+	if db.listener != nil {
+		db.listener.Close()
+	}
+	return db.DB.Close()
+}
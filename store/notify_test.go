@@ -0,0 +1,30 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsNotify(t *testing.T) {
+	s := NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	notify := s.EventsNotify()
+	if notify == nil {
+		return // only Postgres supports notifications
+	}
+
+	_, err := s.CreateEvent(&model.Event{Type: model.TypeArtifact, Blob: "{}"})
+	assert.Nil(t, err)
+
+	select {
+	case <-notify:
+	case <-time.After(5 * time.Second):
+		t.Errorf("should be notified of the new event")
+	}
+}
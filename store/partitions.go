@@ -0,0 +1,103 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const eventPartitionPrefix = "events_p"
+const eventPartitionLayout = "200601"
+
+// MaintainEventPartitions creates the monthly partitions of the events table for the current and the next months,
+// and drops the partitions that ended before the retention. Zero retention keeps every partition.
+// Only Postgres partitions the events table, other drivers are left alone
+func (db *sqlStore) MaintainEventPartitions(now time.Time, monthsAhead int, retention time.Duration) error {
+	if db.driver != "postgres" {
+		return nil
+	}
+
+	month := monthStart(now)
+	for i := 0; i <= monthsAhead; i++ {
+		name, from, to := eventPartition(month.AddDate(0, i, 0))
+		_, err := db.Exec(fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s PARTITION OF events FOR VALUES FROM (%d) TO (%d)",
+			name, from, to,
+		))
+		if err != nil {
+			return fmt.Errorf("cannot create event partition %s: %s", name, err)
+		}
+	}
+
+	if retention == 0 {
+		return nil
+	}
+
+	partitions, err := db.eventPartitions()
+	if err != nil {
+		return err
+	}
+	for _, name := range partitions {
+		if !expiredPartition(name, now.Add(-retention)) {
+			continue
+		}
+		logrus.Infof("dropping event partition %s, it is older than %s", name, retention)
+		_, err := db.Exec(fmt.Sprintf("DROP TABLE %s", name))
+		if err != nil {
+			return fmt.Errorf("cannot drop event partition %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (db *sqlStore) eventPartitions() ([]string, error) {
+	rows, err := db.Query(`
+SELECT child.relname
+FROM pg_inherits
+JOIN pg_class parent ON pg_inherits.inhparent = parent.oid
+JOIN pg_class child ON pg_inherits.inhrelid = child.oid
+WHERE parent.relname = 'events'`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list event partitions: %s", err)
+	}
+	defer rows.Close()
+
+	var partitions []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, name)
+	}
+	return partitions, rows.Err()
+}
+
+// eventPartition returns the name and the created range of the monthly partition
+func eventPartition(month time.Time) (string, int64, int64) {
+	start := monthStart(month)
+	end := start.AddDate(0, 1, 0)
+	return eventPartitionPrefix + start.Format(eventPartitionLayout), start.Unix(), end.Unix()
+}
+
+// expiredPartition tells if the monthly partition ended before the cutoff.
+// The default partition, and tables not created by MaintainEventPartitions never expire
+func expiredPartition(name string, cutoff time.Time) bool {
+	if !strings.HasPrefix(name, eventPartitionPrefix) {
+		return false
+	}
+	month, err := time.Parse(eventPartitionLayout, strings.TrimPrefix(name, eventPartitionPrefix))
+	if err != nil {
+		return false
+	}
+
+	_, _, end := eventPartition(month)
+	return end <= cutoff.Unix()
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,32 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_eventPartition(t *testing.T) {
+	name, from, to := eventPartition(time.Date(2021, 12, 15, 10, 0, 0, 0, time.UTC))
+	assert.Equal(t, "events_p202112", name)
+	assert.Equal(t, time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC).Unix(), from)
+	assert.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).Unix(), to)
+}
+
+func Test_expiredPartition(t *testing.T) {
+	cutoff := time.Date(2021, 12, 15, 0, 0, 0, 0, time.UTC)
+	assert.True(t, expiredPartition("events_p202111", cutoff))
+	assert.False(t, expiredPartition("events_p202112", cutoff), "partitions with events after the cutoff should be kept")
+	assert.False(t, expiredPartition("events_default", cutoff))
+}
+
+func Test_maintainEventPartitionsIsNoopOnSqlite(t *testing.T) {
+	s := NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	err := s.MaintainEventPartitions(time.Now(), 2, time.Hour)
+	assert.Nil(t, err)
+}
@@ -20,8 +20,28 @@ const SelectAllUser = "select-all-user"
 const DeleteUser = "deleteUser"
 const SelectUnprocessedEvents = "select-unprocessed-events"
 const UpdateEventStatus = "update-event-status"
+const UpdateEventLogs = "update-event-logs"
+const MarkEventProcessing = "mark-event-processing"
+const SelectStuckEvents = "select-stuck-events"
+const SelectEventBacklog = "select-event-backlog"
+const SelectCheckingEvents = "select-checking-events"
+const SelectDeployEvents = "select-deploy-events"
+const RequeueEvent = "requeue-event"
+const HoldEvent = "hold-event"
+const SelectHeldEvents = "select-held-events"
+const RequeueHeldEvent = "requeue-held-event"
 const SelectGitopsCommitBySha = "select-gitops-commit-by-sha"
 const SelectKeyValue = "select-key-value"
+const InsertEventChange = "insert-event-change"
+const SelectEventChanges = "select-event-changes"
+const DeleteEventChanges = "delete-event-changes"
+const PruneEventChanges = "prune-event-changes"
+const SelectUnexpiredArtifacts = "select-unexpired-artifacts"
+const ExpireArtifact = "expire-artifact"
+const ExpireArtifactsCreatedBefore = "expire-artifacts-created-before"
+const SelectRepositoryEvents = "select-repository-events"
+const SelectUncompressedBlobs = "select-uncompressed-blobs"
+const UpdateEventBlob = "update-event-blob"
 
 var queries = map[string]map[string]string{
 	"sqlite3": {
@@ -41,15 +61,56 @@ FROM users;
 DELETE FROM users where login = ?;
 `,
 		SelectUnprocessedEvents: `
-SELECT id, created, type, blob, status, status_desc, sha, repository, branch, event, source_branch, target_branch, tag, artifact_id
+SELECT id, created, type, blob, status, status_desc, sha, repository, branch, event, source_branch, target_branch, tag, artifact_id, correlation_id
 FROM events
-WHERE status='new' order by created ASC limit 10;
+WHERE status='new' order by created ASC, created_nano ASC limit 10;
 `,
 		UpdateEventStatus: `
-UPDATE events SET status = ?, status_desc = ?, gitops_hashes = ? WHERE id = ?;
+UPDATE events SET status = ?, status_desc = ?, gitops_hashes = ?, triggered_envs = ?, env_statuses = ? WHERE id = ?;
+`,
+		UpdateEventLogs: `
+UPDATE events SET logs = ? WHERE id = ?;
+`,
+		MarkEventProcessing: `
+UPDATE events SET status = 'processing', processing_started = ? WHERE id = ?;
+`,
+		SelectStuckEvents: `
+SELECT id, created, type, blob, status, status_desc, sha, repository, branch, event, source_branch, target_branch, tag, artifact_id, processing_started
+FROM events
+WHERE status='processing' AND processing_started < ? order by processing_started ASC;
+`,
+		SelectEventBacklog: `
+SELECT COUNT(*), COALESCE(MIN(created), 0)
+FROM events
+WHERE status='new';
+`,
+		SelectCheckingEvents: `
+SELECT id, created, type, blob, status, status_desc, sha, repository, artifact_id, correlation_id, processing_started, gitops_hashes, triggered_envs, env_statuses
+FROM events
+WHERE status='checking' order by processing_started ASC;
+`,
+		SelectDeployEvents: `
+SELECT id, created, type, blob, status, status_desc, sha, repository, branch, event, source_branch, target_branch, tag, artifact_id, gitops_hashes, triggered_envs
+FROM events
+WHERE type IN ('artifact', 'release', 'reevaluation', 'rollback') AND status IN ('processed', 'partial') AND created >= ? AND created < ?
+ORDER BY created ASC;
+`,
+		RequeueEvent: `
+UPDATE events SET status = 'new', processing_started = 0 WHERE id = ? AND status = 'processing';
+`,
+		HoldEvent: `
+UPDATE events SET status = 'held', status_desc = ? WHERE id = ? AND status = 'new';
+`,
+		SelectHeldEvents: `
+SELECT id
+FROM events
+WHERE status='held';
+`,
+		RequeueHeldEvent: `
+UPDATE events SET status = 'new', status_desc = '' WHERE id = ? AND status = 'held';
 `,
 		SelectGitopsCommitBySha: `
-SELECT id, sha, status, status_desc
+SELECT id, sha, status, status_desc, created
 FROM gitops_commits
 WHERE sha = ?;
 `,
@@ -57,6 +118,51 @@ WHERE sha = ?;
 SELECT id, key, value
 FROM key_values
 WHERE key = ?;
+`,
+		InsertEventChange: `
+INSERT INTO event_changes (event_id, status, status_desc, created) VALUES (?, ?, ?, ?);
+`,
+		SelectEventChanges: `
+SELECT event_changes.id, event_changes.event_id, event_changes.status, event_changes.status_desc, event_changes.created,
+events.type, events.repository, events.sha, events.artifact_id, events.correlation_id
+FROM event_changes
+LEFT JOIN events ON events.id = event_changes.event_id
+WHERE event_changes.id > ? AND event_changes.created < ?
+ORDER BY event_changes.id ASC
+LIMIT ?;
+`,
+		DeleteEventChanges: `
+DELETE FROM event_changes WHERE id <= ?;
+`,
+		PruneEventChanges: `
+DELETE FROM event_changes WHERE created < ?;
+`,
+		SelectUnexpiredArtifacts: `
+SELECT id, created, type, blob, sha, repository, artifact_id
+FROM events
+WHERE type = 'artifact' AND expired = 0
+ORDER BY created ASC;
+`,
+		ExpireArtifact: `
+UPDATE events SET expired = ? WHERE artifact_id = ? AND expired = 0;
+`,
+		ExpireArtifactsCreatedBefore: `
+UPDATE events SET expired = ? WHERE type = 'artifact' AND expired = 0 AND created < ?;
+`,
+		SelectRepositoryEvents: `
+SELECT id, created, type, blob, status, branch, event, artifact_id, gitops_hashes, triggered_envs, env_statuses
+FROM events
+WHERE repository = ? AND type IN ('artifact', 'release', 'reevaluation')
+ORDER BY created ASC;
+`,
+		SelectUncompressedBlobs: `
+SELECT id, blob
+FROM events
+WHERE blob NOT LIKE 'gz:%' AND blob != ''
+LIMIT ?;
+`,
+		UpdateEventBlob: `
+UPDATE events SET blob = ? WHERE id = ?;
 `,
 	},
 	"postgres": {},
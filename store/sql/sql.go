@@ -14,8 +14,35 @@
 
 package sql
 
+import (
+	"strconv"
+	"strings"
+)
+
 // Stmt returns the named sql statement compatible with
 // the specified database driver.
 func Stmt(driver string, name string) string {
-	return queries[driver][name]
+	if query, ok := queries[driver][name]; ok {
+		return query
+	}
+	return Rebind(driver, queries["sqlite3"][name])
+}
+
+// Rebind replaces the ? placeholders to $n for postgres
+func Rebind(driver string, query string) string {
+	if driver != "postgres" {
+		return query
+	}
+
+	n := 0
+	var b strings.Builder
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
 }
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"github.com/gimlet-io/gimletd/store/ddl"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/russross/meddler"
@@ -13,38 +14,85 @@ import (
 	// MySQL driver
 	_ "github.com/go-sql-driver/mysql"
 	// PostgreSQL driver
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	// Sqlite driver
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // Store is used to access data
-// from the sql/database driver with a relational database backend.
+// through the storage driver selected by the configuration.
 type Store struct {
+	Driver
+}
+
+// sqlStore is the storage driver
+// with a relational database backend.
+type sqlStore struct {
 	*sql.DB
 
 	driver string
 	config string
+
+	notifyOnce sync.Once
+	notify     chan struct{}
+	listener   *pq.Listener
 }
 
-// New creates a database connection for the given driver and datasource
+func init() {
+	Register("sqlite3", openSqlStore)
+	Register("mysql", openSqlStore)
+	Register("postgres", openSqlStore)
+}
+
+// New creates a connection for the given driver and datasource
 // and returns a new Store.
 func New(driver, config string) *Store {
-	return &Store{
-		DB:     open(driver, config),
+	d, err := openDriver(driver, config)
+	if err != nil {
+		logrus.Errorln(err)
+		logrus.Fatalln("database connection failed")
+	}
+	return &Store{Driver: d}
+}
+
+// NewReadReplica connects to a read-only replica of the database and returns a Store for read queries.
+// The replica gets its schema through replication, so it is not migrated
+func NewReadReplica(driver, config string) *Store {
+	return &Store{Driver: &sqlStore{
+		DB:     connect(driver, config),
 		driver: driver,
 		config: config,
-	}
+	}}
 }
 
 // From returns a Store using an existing database connection.
 func From(db *sql.DB) *Store {
-	return &Store{DB: db}
+	return &Store{Driver: &sqlStore{DB: db}}
+}
+
+func openSqlStore(driver, config string) (Driver, error) {
+	return &sqlStore{
+		DB:     open(driver, config),
+		driver: driver,
+		config: config,
+	}, nil
 }
 
 // open opens a new database connection with the specified
-// driver and connection string and returns a store.
+// driver and connection string, and migrates the schema.
 func open(driver, config string) *sql.DB {
+	db := connect(driver, config)
+
+	if err := setupDatabase(driver, db); err != nil {
+		logrus.Errorln(err)
+		logrus.Fatalln("migration failed")
+	}
+	return db
+}
+
+// connect opens a new database connection with the specified
+// driver and connection string, and waits until it can be reached.
+func connect(driver, config string) *sql.DB {
 	db, err := sql.Open(driver, config)
 	if err != nil {
 		logrus.Errorln(err)
@@ -61,11 +109,6 @@ func open(driver, config string) *sql.DB {
 		logrus.Errorln(err)
 		logrus.Fatalln("database ping attempts failed")
 	}
-
-	if err := setupDatabase(driver, db); err != nil {
-		logrus.Errorln(err)
-		logrus.Fatalln("migration failed")
-	}
 	return db
 }
 
@@ -87,6 +130,7 @@ func openTest() *sql.DB {
 // NewTest creates a new database connection for testing purposes.
 // The database driver and connection string are provided by
 // environment variables, with fallback to in-memory sqlite.
+// DATABASE_DRIVER=memory runs the tests on the in-memory driver
 func NewTest() *Store {
 	var (
 		driver = "sqlite3"
@@ -96,11 +140,14 @@ func NewTest() *Store {
 		driver = os.Getenv("DATABASE_DRIVER")
 		config = os.Getenv("DATABASE_CONFIG")
 	}
-	return &Store{
+	if driver == "memory" {
+		return NewMemory()
+	}
+	return &Store{Driver: &sqlStore{
 		DB:     open(driver, config),
 		driver: driver,
 		config: config,
-	}
+	}}
 }
 
 // helper function to ping the database with backoff to ensure
@@ -124,6 +171,21 @@ func setupDatabase(driver string, db *sql.DB) error {
 	return ddl.Migrate(driver, db)
 }
 
+// MigrateDown rolls back the database schema to the given migration version
+func MigrateDown(driver, config string, version int) error {
+	db, err := sql.Open(driver, config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := pingDatabase(db); err != nil {
+		return err
+	}
+
+	return ddl.MigrateDown(driver, db, version)
+}
+
 // helper function to setup the meddler default driver
 // based on the selected driver name.
 func setupMeddler(driver string) {
@@ -16,6 +16,8 @@ package store
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestStoreInit(t *testing.T) {
@@ -24,3 +26,22 @@ func TestStoreInit(t *testing.T) {
 		s.Close()
 	}()
 }
+
+func TestDriverRegistration(t *testing.T) {
+	_, err := openDriver("no-such-driver", "")
+	assert.NotNil(t, err, "should not open unregistered drivers")
+
+	Register("test-driver", func(driver, config string) (Driver, error) {
+		return NewTest().Driver, nil
+	})
+	assert.Contains(t, Drivers(), "test-driver")
+
+	s := New("test-driver", "")
+	defer func() {
+		s.Close()
+	}()
+
+	users, err := s.Users()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(users))
+}
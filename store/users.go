@@ -7,7 +7,7 @@ import (
 )
 
 // User gets a user by its login name
-func (db *Store) User(login string) (*model.User, error) {
+func (db *sqlStore) User(login string) (*model.User, error) {
 	stmt := sql.Stmt(db.driver, sql.SelectUserByLogin)
 	data := new(model.User)
 	err := meddler.QueryRow(db, data, stmt, login)
@@ -15,7 +15,7 @@ func (db *Store) User(login string) (*model.User, error) {
 }
 
 // Users returns all users in the database
-func (db *Store) Users() ([]*model.User, error) {
+func (db *sqlStore) Users() ([]*model.User, error) {
 	stmt := sql.Stmt(db.driver, sql.SelectAllUser)
 	var data []*model.User
 	err := meddler.QueryAll(db, &data, stmt)
@@ -23,12 +23,17 @@ func (db *Store) Users() ([]*model.User, error) {
 }
 
 // CreateUser stores a new user in the database
-func (db *Store) CreateUser(user *model.User) error {
+func (db *sqlStore) CreateUser(user *model.User) error {
 	return meddler.Insert(db, "users", user)
 }
 
+// UpdateUser updates a user in the database
+func (db *sqlStore) UpdateUser(user *model.User) error {
+	return meddler.Update(db, "users", user)
+}
+
 // DeleteUser deletes a user in the database
-func (db *Store) DeleteUser(login string) error {
+func (db *sqlStore) DeleteUser(login string) error {
 	stmt := sql.Stmt(db.driver, sql.DeleteUser)
 	_, err := db.Exec(stmt, login)
 	return err
@@ -31,6 +31,13 @@ func TestUserCRUD(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, len(users), 1)
 
+	u.Admin = true
+	err = s.UpdateUser(u)
+	assert.Nil(t, err)
+	u, err = s.User("aLogin")
+	assert.Nil(t, err)
+	assert.True(t, u.Admin)
+
 	err = s.DeleteUser("aLogin")
 	assert.Nil(t, err)
 
@@ -0,0 +1,101 @@
+// Package validation validates rendered manifests with a server-side dry-run of kubectl against the cluster of the env,
+// or with kubeconform against the bundled Kubernetes schemas. The CLIs must be on the PATH
+package validation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+)
+
+// Validator runs the validator CLIs
+type Validator struct {
+	timeout time.Duration
+	run     func(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error)
+}
+
+// New returns a validator that stops the CLIs after the timeout
+func New(timeout time.Duration) *Validator {
+	return &Validator{
+		timeout: timeout,
+		run:     runCommand,
+	}
+}
+
+func runCommand(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()+"\n"+string(out)))
+	}
+	return out, nil
+}
+
+// Validate checks the rendered files of an app against the validation policy of its env.
+// With a kubeconfig the files are dry-run applied on the cluster, kubeconform validates them otherwise
+func (v *Validator) Validate(files map[string]string, policy *dx.ManifestValidation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+
+	stream := manifestStream(files)
+
+	var tool string
+	var args []string
+	if policy.Kubeconfig != "" {
+		tool = "kubectl"
+		args = []string{"--kubeconfig", policy.Kubeconfig}
+		if policy.Context != "" {
+			args = append(args, "--context", policy.Context)
+		}
+		args = append(args, "apply", "--dry-run=server", "--validate=true", "-f", "-")
+	} else {
+		tool = "kubeconform"
+		args = []string{"-strict", "-summary", "-output", "text"}
+		if policy.KubernetesVersion != "" {
+			args = append(args, "-kubernetes-version", policy.KubernetesVersion)
+		}
+		if len(policy.SchemaLocations) > 0 {
+			args = append(args, "-schema-location", "default")
+			for _, location := range policy.SchemaLocations {
+				args = append(args, "-schema-location", location)
+			}
+		}
+		args = append(args, "-")
+	}
+
+	_, err := v.run(ctx, stream, tool, args...)
+	if err != nil {
+		return fmt.Errorf("manifest validation with %s failed: %s", tool, err)
+	}
+	return nil
+}
+
+// manifestStream joins the files into a single YAML stream, in file name order
+func manifestStream(files map[string]string) []byte {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	for _, name := range names {
+		content := strings.TrimSpace(files[name])
+		if content == "" {
+			continue
+		}
+		b.WriteString("---\n")
+		b.WriteString(content)
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
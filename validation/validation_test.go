@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validateWithKubectl(t *testing.T) {
+	v := New(time.Minute)
+
+	var tool string
+	var args []string
+	var stdin string
+	v.run = func(ctx context.Context, in []byte, name string, a ...string) ([]byte, error) {
+		tool, args, stdin = name, a, string(in)
+		return nil, nil
+	}
+
+	err := v.Validate(map[string]string{
+		"service.yaml":    "kind: Service\n",
+		"deployment.yaml": "kind: Deployment",
+	}, &dx.ManifestValidation{Kubeconfig: "/etc/kube/staging", Context: "staging"})
+	assert.Nil(t, err)
+	assert.Equal(t, "kubectl", tool)
+	assert.Equal(t, []string{"--kubeconfig", "/etc/kube/staging", "--context", "staging", "apply", "--dry-run=server", "--validate=true", "-f", "-"}, args)
+	assert.Equal(t, "---\nkind: Deployment\n---\nkind: Service\n", stdin, "should stream the files in name order")
+}
+
+func Test_validateWithKubeconform(t *testing.T) {
+	v := New(time.Minute)
+
+	var tool string
+	var args []string
+	v.run = func(ctx context.Context, in []byte, name string, a ...string) ([]byte, error) {
+		tool, args = name, a
+		return nil, fmt.Errorf("exit status 1: deployment.yaml - Deployment my-app is invalid")
+	}
+
+	err := v.Validate(map[string]string{"deployment.yaml": "kind: Deployment"}, &dx.ManifestValidation{
+		KubernetesVersion: "1.22.0",
+		SchemaLocations:   []string{"https://schemas.example.com/{{ .ResourceKind }}.json"},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Deployment my-app is invalid")
+	assert.Equal(t, "kubeconform", tool)
+	assert.Contains(t, args, "1.22.0")
+	assert.Contains(t, args, "default", "should keep the default schemas next to the extra locations")
+}
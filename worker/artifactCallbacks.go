@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/hooks"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// callArtifactCallbacks notifies the callback URLs of the artifact's repository about the deploy decision on the artifact.
+// Callbacks are called in the background with retries, failures are only logged
+func callArtifactCallbacks(store *store.Store, event *model.Event, log *logrus.Entry) {
+	if event.Type != model.TypeArtifact {
+		return
+	}
+
+	callbacks, err := store.ArtifactCallbacks()
+	if err != nil {
+		log.Warnf("cannot load artifact callbacks: %s", err)
+		return
+	}
+	var repositoryCallbacks []*model.ArtifactCallback
+	for _, callback := range callbacks {
+		if callback.Repository == event.Repository {
+			repositoryCallbacks = append(repositoryCallbacks, callback)
+		}
+	}
+	if len(repositoryCallbacks) == 0 {
+		return
+	}
+
+	artifact, err := model.ToArtifact(event)
+	if err != nil {
+		log.Warnf("cannot parse artifact for the callbacks: %s", err)
+		return
+	}
+	triggeredEnvs := event.TriggeredEnvs
+	if triggeredEnvs == nil {
+		triggeredEnvs = []string{}
+	}
+	ingestion := &dx.ArtifactIngestion{
+		Artifact:      artifact,
+		Status:        event.Status,
+		StatusDesc:    event.StatusDesc,
+		TriggeredEnvs: triggeredEnvs,
+		Envs:          event.EnvStatuses,
+	}
+
+	for _, callback := range repositoryCallbacks {
+		go func(callback *model.ArtifactCallback) {
+			operation := func() error {
+				return hooks.PostArtifactDecision(callback.URL, callback.Secret, ingestion, event.CorrelationID)
+			}
+			err := backoff.Retry(operation, backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3))
+			if err != nil {
+				log.Warnf("artifact callback %s failed: %s", callback.ID, err)
+			}
+		}(callback)
+	}
+}
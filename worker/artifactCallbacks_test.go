@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/hooks"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_artifactCallbacks(t *testing.T) {
+	received := make(chan *http.Request, 2)
+	bodies := make(chan []byte, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	s := store.NewTest()
+	err := s.SaveArtifactCallbacks([]*model.ArtifactCallback{
+		{ID: "1", Repository: "my-org/my-app", URL: server.URL, Secret: "secret"},
+		{ID: "2", Repository: "my-org/other-app", URL: server.URL},
+	})
+	assert.Nil(t, err)
+
+	artifact := dx.Artifact{ID: "my-app-123", Version: dx.Version{SHA: "ea9ab7cc", RepositoryName: "my-org/my-app"}}
+	event, _ := model.ToEvent(artifact)
+	event, err = s.CreateEvent(event)
+	assert.Nil(t, err)
+
+	gitopsEvents := []*events.DeployEvent{
+		{Manifest: &dx.Manifest{Env: "staging", App: "my-app"}, Artifact: &artifact, Status: events.Success, GitopsRef: "abc"},
+	}
+	finalizeEvent(s, notifications.NewDummyManager(), event, gitopsEvents, nil, false, newEventLog(event))
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		assert.Equal(t, hooks.Signature("secret", body), r.Header.Get("X-Gimlet-Signature"))
+
+		var payload hooks.ArtifactDecisionPayload
+		err = json.Unmarshal(body, &payload)
+		assert.Nil(t, err)
+		assert.Equal(t, model.StatusProcessed, payload.Status)
+		assert.Equal(t, []string{"staging"}, payload.TriggeredEnvs)
+		assert.Equal(t, "abc", payload.Envs[0].GitopsRef)
+		assert.Equal(t, "my-app-123", payload.Artifact.ID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the callback of the repository should be called")
+	}
+
+	select {
+	case <-received:
+		t.Fatal("callbacks of other repositories should not be called")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// ArtifactExpiryWorker marks artifacts expired when their images are deleted from the registry,
+// or when they are older than the max age. Expired artifacts are not released or rolled back to
+type ArtifactExpiryWorker struct {
+	store    *store.Store
+	registry ImageRegistry
+	maxAge   time.Duration
+	interval time.Duration
+}
+
+// NewArtifactExpiryWorker creates the worker. A nil registry skips the image checks, a zero max age the age based expiry
+func NewArtifactExpiryWorker(
+	store *store.Store,
+	registry ImageRegistry,
+	maxAge time.Duration,
+	interval time.Duration,
+) *ArtifactExpiryWorker {
+	return &ArtifactExpiryWorker{
+		store:    store,
+		registry: registry,
+		maxAge:   maxAge,
+		interval: interval,
+	}
+}
+
+func (w *ArtifactExpiryWorker) Run() {
+	for {
+		err := w.expire()
+		if err != nil {
+			logrus.Errorf("could not expire artifacts: %s", err)
+		}
+
+		time.Sleep(w.interval)
+	}
+}
+
+func (w *ArtifactExpiryWorker) expire() error {
+	if w.maxAge != 0 {
+		expired, err := w.store.ExpireArtifactsCreatedBefore(time.Now().Add(-w.maxAge))
+		if err != nil {
+			return err
+		}
+		if expired > 0 {
+			logrus.Infof("expired %d artifacts older than %s", expired, w.maxAge)
+		}
+	}
+
+	if w.registry == nil {
+		return nil
+	}
+
+	artifactEvents, err := w.store.UnexpiredArtifacts()
+	if err != nil {
+		return err
+	}
+
+	tagsOfImages := map[string]map[string]bool{} // the registry is asked once per image in a run
+	for _, artifactEvent := range artifactEvents {
+		artifact, err := model.ToArtifact(artifactEvent)
+		if err != nil {
+			return err
+		}
+
+		missing, err := w.missingImage(artifact, tagsOfImages)
+		if err != nil {
+			logrus.Warnf("could not check the images of %s: %s", artifact.ID, err)
+			continue
+		}
+		if missing == "" {
+			continue
+		}
+
+		err = w.store.ExpireArtifact(artifact.ID)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("expired %s, %s is gone from the registry", artifact.ID, missing)
+	}
+	return nil
+}
+
+// missingImage returns the first image of the artifact that is gone from the registry, empty if all exist
+func (w *ArtifactExpiryWorker) missingImage(artifact *dx.Artifact, tagsOfImages map[string]map[string]bool) (string, error) {
+	for _, image := range artifactImages(artifact) {
+		repository, tag := splitImageTag(image)
+		if tag == "" {
+			continue // only tagged images are checked, not digests
+		}
+
+		tags, ok := tagsOfImages[repository]
+		if !ok {
+			tagList, err := w.registry.Tags(repository)
+			if err != nil {
+				return "", fmt.Errorf("cannot list the tags of %s: %s", repository, err)
+			}
+			tags = map[string]bool{}
+			for _, t := range tagList {
+				tags[t] = true
+			}
+			tagsOfImages[repository] = tags
+		}
+
+		if !tags[tag] {
+			return image, nil
+		}
+	}
+	return "", nil
+}
+
+// artifactImages returns the images of the artifact's manifests, with the manifest vars resolved
+func artifactImages(artifact *dx.Artifact) []string {
+	manifests, err := dx.ExpandVariants(artifact.Environments)
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var images []string
+	for _, m := range manifests {
+		resolved, err := copyManifest(m)
+		if err != nil {
+			continue
+		}
+		if err := resolved.ResolveVars(artifact.Vars()); err != nil {
+			continue
+		}
+		image := manifestImage(resolved)
+		if strings.Contains(image, "<no value>") {
+			continue // the artifact doesn't carry a var of the image reference, it cannot be checked
+		}
+		if image != "" && !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// splitImageTag splits an image reference to the repository and the tag, the tag is empty for digests and untagged images
+func splitImageTag(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	i := strings.LastIndex(image, ":")
+	if i == -1 || strings.Contains(image[i:], "/") {
+		return image, ""
+	}
+	return image[:i], image[i+1:]
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type dummyTagRegistry struct {
+	tags map[string][]string
+}
+
+func (r *dummyTagRegistry) Tags(image string) ([]string, error) {
+	tags, ok := r.tags[image]
+	if !ok {
+		return nil, fmt.Errorf("registry unreachable")
+	}
+	return tags, nil
+}
+
+func Test_artifactExpiry(t *testing.T) {
+	s := store.NewTest()
+
+	artifactWithImage := func(id string, image map[string]interface{}) {
+		artifact := dx.Artifact{
+			ID:      id,
+			Version: dx.Version{RepositoryName: "my-app", SHA: "ea9ab7cc"},
+			Environments: []*dx.Manifest{
+				{App: "my-app", Env: "staging", Values: map[string]interface{}{"image": image}},
+			},
+		}
+		artifactEvent, _ := model.ToEvent(artifact)
+		_, err := s.CreateEvent(artifactEvent)
+		assert.Nil(t, err)
+	}
+	artifactWithImage("my-app-existing", map[string]interface{}{"repository": "ghcr.io/gimlet-io/my-app", "tag": "{{ .GitSHA }}"})
+	artifactWithImage("my-app-deleted", map[string]interface{}{"repository": "ghcr.io/gimlet-io/my-app", "tag": "1.0.0"})
+	artifactWithImage("my-app-unreachable", map[string]interface{}{"repository": "quay.io/gimlet-io/my-app", "tag": "1.0.0"})
+	artifactWithImage("my-app-untagged", map[string]interface{}{"repository": "ghcr.io/gimlet-io/my-app"})
+
+	registry := &dummyTagRegistry{tags: map[string][]string{
+		"ghcr.io/gimlet-io/my-app": {"ea9ab7cc", "1.1.0"},
+	}}
+	w := NewArtifactExpiryWorker(s, registry, 0, 0)
+	assert.Nil(t, w.expire())
+
+	for id, expired := range map[string]bool{
+		"my-app-existing":    false,
+		"my-app-deleted":     true,
+		"my-app-unreachable": false,
+		"my-app-untagged":    false,
+	} {
+		artifact, err := s.Artifact(id)
+		assert.Nil(t, err)
+		assert.Equal(t, expired, artifact.Expired != 0, id)
+	}
+}
+
+func Test_splitImageTag(t *testing.T) {
+	for image, expected := range map[string][2]string{
+		"nginx:1.21":                    {"nginx", "1.21"},
+		"localhost:5000/my-app:v1":      {"localhost:5000/my-app", "v1"},
+		"localhost:5000/my-app":         {"localhost:5000/my-app", ""},
+		"ghcr.io/my-app@sha256:abcdef0": {"ghcr.io/my-app@sha256:abcdef0", ""},
+	} {
+		repository, tag := splitImageTag(image)
+		assert.Equal(t, expected[0], repository, image)
+		assert.Equal(t, expected[1], tag, image)
+	}
+}
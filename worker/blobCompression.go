@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+const blobCompressionBatchSize = 100
+
+// BlobCompressionWorker compresses the event blobs that were stored before blob compression, in the background.
+// It stops when no uncompressed blob is left, new events are compressed on write
+type BlobCompressionWorker struct {
+	store *store.Store
+	pause time.Duration
+}
+
+func NewBlobCompressionWorker(store *store.Store) *BlobCompressionWorker {
+	return &BlobCompressionWorker{
+		store: store,
+		pause: time.Second,
+	}
+}
+
+func (w *BlobCompressionWorker) Run() {
+	total := 0
+	for {
+		compressed, err := w.store.CompressEventBlobs(blobCompressionBatchSize)
+		if err != nil {
+			logrus.Errorf("could not compress event blobs: %s", err)
+			return
+		}
+		total += compressed
+		if compressed == 0 {
+			if total > 0 {
+				logrus.Infof("compressed the blobs of %d events", total)
+			}
+			return
+		}
+		time.Sleep(w.pause) // leaves room for the regular load of the database
+	}
+}
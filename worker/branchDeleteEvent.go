@@ -35,17 +35,31 @@ type BranchDeleteEventWorker struct {
 	tokenManager customScm.NonImpersonatedTokenManager
 	cachePath    string
 	dao          *store.Store
+
+	// shallow mode doesn't keep clones of the app repos, only the manifests of each branch.
+	// Deleted branches are detected by listing the remote branches
+	shallow         bool
+	remoteURLFormat string
+}
+
+// deletedBranch holds the manifests of a branch as they were before the branch got deleted
+type deletedBranch struct {
+	branch    string
+	manifests []*dx.Manifest
 }
 
 func NewBranchDeleteEventWorker(
 	tokenManager customScm.NonImpersonatedTokenManager,
 	cachePath string,
 	dao *store.Store,
+	shallow bool,
 ) *BranchDeleteEventWorker {
 	branchDeleteEventWorker := &BranchDeleteEventWorker{
-		tokenManager: tokenManager,
-		cachePath:    cachePath,
-		dao:          dao,
+		tokenManager:    tokenManager,
+		cachePath:       cachePath,
+		dao:             dao,
+		shallow:         shallow,
+		remoteURLFormat: "https://github.com/%s",
 	}
 
 	return branchDeleteEventWorker
@@ -59,62 +73,39 @@ func (r *BranchDeleteEventWorker) Run() {
 		}
 
 		for _, repoName := range reposWithCleanupPolicy {
-			repoPath := filepath.Join(r.cachePath, strings.ReplaceAll(repoName, "/", "%"))
-			if _, err := os.Stat(repoPath); err == nil { // repo exist
-				repo, err := git.PlainOpen(repoPath)
+			var deletedBranches []*deletedBranch
+			if r.shallow {
+				deletedBranches, err = r.shallowDeletedBranches(repoName)
+			} else {
+				deletedBranches, err = r.deletedBranches(repoName)
+			}
+			if err != nil {
+				logrus.Warn(err)
+				continue
+			}
+
+			for _, deletedBranch := range deletedBranches {
+				branchDeletedEventStr, err := json.Marshal(events.BranchDeletedEvent{
+					Repo:      repoName,
+					Branch:    deletedBranch.branch,
+					Manifests: deletedBranch.manifests,
+				})
 				if err != nil {
-					logrus.Warnf("could not open %s: %s", repoPath, err)
-					os.RemoveAll(repoPath)
+					logrus.Warnf("could not serialize branch deleted event: %s", err)
 					continue
 				}
 
-				copyOfOldState, err, oldStatePath := copyRepo(repoPath)
-				if oldStatePath != "" {
-					defer os.RemoveAll(oldStatePath)
-				}
-
-				deletedBranches, err := r.detectDeletedBranches(repo)
+				// store branch deleted event
+				_, err = r.dao.CreateEvent(&model.Event{
+					Type:         model.TypeBranchDeleted,
+					Blob:         string(branchDeletedEventStr),
+					Repository:   repoName,
+					GitopsHashes: []string{},
+				})
 				if err != nil {
-					logrus.Warnf("could not detect deleted branches in %s: %s", repoPath, err)
-					os.RemoveAll(repoPath)
+					logrus.Warnf("could not store branch deleted event: %s", err)
 					continue
 				}
-				for _, deletedBranch := range deletedBranches {
-					manifests, err := r.extractManifestsFromBranch(copyOfOldState, deletedBranch)
-					if err != nil {
-						logrus.Warnf("could not extract manifests: %s", err)
-						continue
-					}
-
-					branchDeletedEventStr, err := json.Marshal(events.BranchDeletedEvent{
-						Repo:      repoName,
-						Branch:    deletedBranch,
-						Manifests: manifests,
-					})
-					if err != nil {
-						logrus.Warnf("could not serialize branch deleted event: %s", err)
-						continue
-					}
-
-					// store branch deleted event
-					_, err = r.dao.CreateEvent(&model.Event{
-						Type:         model.TypeBranchDeleted,
-						Blob:         string(branchDeletedEventStr),
-						Repository:   repoName,
-						GitopsHashes: []string{},
-					})
-					if err != nil {
-						logrus.Warnf("could not store branch deleted event: %s", err)
-						continue
-					}
-				}
-			} else if os.IsNotExist(err) {
-				err := r.clone(repoName)
-				if err != nil {
-					logrus.Warnf("could not clone: %s", err)
-				}
-			} else {
-				logrus.Warn(err)
 			}
 		}
 
@@ -122,7 +113,53 @@ func (r *BranchDeleteEventWorker) Run() {
 	}
 }
 
-func (r *BranchDeleteEventWorker) detectDeletedBranches(repo *git.Repository) ([]string, error) {
+// deletedBranches fetches the full clone of the repo, and returns the branches that were pruned
+func (r *BranchDeleteEventWorker) deletedBranches(repoName string) ([]*deletedBranch, error) {
+	repoPath := filepath.Join(r.cachePath, strings.ReplaceAll(repoName, "/", "%"))
+	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+		err := r.clone(repoName)
+		if err != nil {
+			return nil, fmt.Errorf("could not clone: %s", err)
+		}
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		os.RemoveAll(repoPath)
+		return nil, fmt.Errorf("could not open %s: %s", repoPath, err)
+	}
+
+	copyOfOldState, err, oldStatePath := copyRepo(repoPath)
+	if oldStatePath != "" {
+		defer os.RemoveAll(oldStatePath)
+	}
+
+	deletedBranchNames, err := r.detectDeletedBranches(repo, repoName)
+	if err != nil {
+		os.RemoveAll(repoPath)
+		return nil, fmt.Errorf("could not detect deleted branches in %s: %s", repoPath, err)
+	}
+
+	var deletedBranches []*deletedBranch
+	for _, branch := range deletedBranchNames {
+		manifests, err := r.extractManifestsFromBranch(copyOfOldState, branch)
+		if err != nil {
+			logrus.Warnf("could not extract manifests: %s", err)
+			continue
+		}
+		deletedBranches = append(deletedBranches, &deletedBranch{
+			branch:    branch,
+			manifests: manifests,
+		})
+	}
+
+	return deletedBranches, nil
+}
+
+func (r *BranchDeleteEventWorker) detectDeletedBranches(repo *git.Repository, repoName string) ([]string, error) {
 	var prunedBranches, staleBranches []string
 
 	refIter, _ := repo.References()
@@ -133,7 +170,7 @@ func (r *BranchDeleteEventWorker) detectDeletedBranches(repo *git.Repository) ([
 		return nil
 	})
 
-	token, user, err := r.tokenManager.Token()
+	token, user, err := r.tokenManager.TokenFor(repoOwner(repoName))
 	if err != nil {
 		return []string{}, fmt.Errorf("couldn't get scm token: %s", err)
 	}
@@ -183,21 +220,31 @@ func (r *BranchDeleteEventWorker) extractManifestsFromBranch(repo *git.Repositor
 		return manifests, err
 	}
 
+	manifests, err = parseManifests(files)
+	if err != nil {
+		return manifests, err
+	}
+
+	err = nativeGit.Branch(repo, fmt.Sprintf("refs/heads/%s", branchBkp))
+	if err != nil {
+		return manifests, err
+	}
+
+	return manifests, nil
+}
+
+// parseManifests parses the files of the .gimlet folder, one manifest per file
+func parseManifests(files map[string]string) ([]*dx.Manifest, error) {
+	var manifests []*dx.Manifest
 	for _, content := range files {
 		var mf dx.Manifest
-		err = yaml.Unmarshal([]byte(content), &mf)
+		err := yaml.Unmarshal([]byte(content), &mf)
 		if err != nil {
 			return manifests, err
 		}
 
 		manifests = append(manifests, &mf)
 	}
-
-	err = nativeGit.Branch(repo, fmt.Sprintf("refs/heads/%s", branchBkp))
-	if err != nil {
-		return manifests, err
-	}
-
 	return manifests, nil
 }
 
@@ -224,14 +271,14 @@ func (r *BranchDeleteEventWorker) clone(repoName string) error {
 		return errors.WithMessage(err, "couldn't create folder")
 	}
 
-	token, user, err := r.tokenManager.Token()
+	token, user, err := r.tokenManager.TokenFor(repoOwner(repoName))
 	if err != nil {
 		os.RemoveAll(repoPath)
 		return errors.WithMessage(err, "couldn't get scm token")
 	}
 
 	opts := &git.CloneOptions{
-		URL: fmt.Sprintf("%s/%s", "https://github.com", repoName),
+		URL: fmt.Sprintf(r.remoteURLFormat, repoName),
 		Auth: &http.BasicAuth{
 			Username: user,
 			Password: token,
@@ -276,3 +323,8 @@ func copyRepo(repoPath string) (*git.Repository, error, string) {
 	copiedRepo, err := git.PlainOpen(tmpPath)
 	return copiedRepo, err, tmpPath
 }
+
+// repoOwner returns the organization or user of an owner/name repository name
+func repoOwner(repoName string) string {
+	return strings.SplitN(repoName, "/", 2)[0]
+}
@@ -0,0 +1,229 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/sirupsen/logrus"
+)
+
+// branchState is what shallow mode keeps of a branch: its head, and the manifests at the head
+type branchState struct {
+	SHA       string         `json:"sha"`
+	Manifests []*dx.Manifest `json:"manifests"`
+}
+
+// shallowDeletedBranches lists the remote branches of the repo, and returns the ones that were deleted
+// with the manifests they had. The manifests of new and updated branches are read from a depth 1 fetch
+// into a temporary bare repo. Only the branch states are kept on disk between runs.
+// Deleted branches are not reported on the first run, as there is nothing to compare with
+func (r *BranchDeleteEventWorker) shallowDeletedBranches(repoName string) ([]*deletedBranch, error) {
+	statePath := filepath.Join(r.cachePath, strings.ReplaceAll(repoName, "/", "%")+".branches.json")
+
+	token, user, err := r.tokenManager.TokenFor(repoOwner(repoName))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get scm token: %s", err)
+	}
+	auth := &http.BasicAuth{
+		Username: user,
+		Password: token,
+	}
+	remoteConfig := &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{fmt.Sprintf(r.remoteURLFormat, repoName)},
+	}
+
+	refs, err := git.NewRemote(memory.NewStorage(), remoteConfig).List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return nil, fmt.Errorf("could not list branches of %s: %s", repoName, err)
+	}
+	heads := map[string]string{}
+	for _, ref := range refs {
+		if ref.Name().IsBranch() {
+			heads[ref.Name().Short()] = ref.Hash().String()
+		}
+	}
+
+	states, err := loadBranchStates(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var changedBranches []string
+	for branch, sha := range heads {
+		if state, ok := states[branch]; !ok || state.SHA != sha {
+			changedBranches = append(changedBranches, branch)
+		}
+	}
+
+	newStates := map[string]*branchState{}
+	for branch := range heads {
+		if state, ok := states[branch]; ok {
+			newStates[branch] = state
+		}
+	}
+	if len(changedBranches) > 0 {
+		manifests, err := r.fetchManifests(remoteConfig, auth, changedBranches)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch manifests of %s: %s", repoName, err)
+		}
+		for _, branch := range changedBranches {
+			branchManifests, ok := manifests[branch]
+			if !ok {
+				continue // keeping the last known state, and retrying in the next run
+			}
+			newStates[branch] = &branchState{
+				SHA:       heads[branch],
+				Manifests: branchManifests,
+			}
+		}
+	}
+
+	var deletedBranches []*deletedBranch
+	if states != nil {
+		for branch, state := range states {
+			if _, ok := heads[branch]; !ok {
+				deletedBranches = append(deletedBranches, &deletedBranch{
+					branch:    branch,
+					manifests: state.Manifests,
+				})
+			}
+		}
+	}
+	sort.Slice(deletedBranches, func(i, j int) bool {
+		return deletedBranches[i].branch < deletedBranches[j].branch
+	})
+
+	return deletedBranches, saveBranchStates(statePath, newStates)
+}
+
+// fetchManifests fetches the heads of the branches with depth 1, and reads the manifests from their .gimlet folder
+func (r *BranchDeleteEventWorker) fetchManifests(
+	remoteConfig *config.RemoteConfig,
+	auth *http.BasicAuth,
+	branches []string,
+) (map[string][]*dx.Manifest, error) {
+	tmpPath, err := ioutil.TempDir(r.cachePath, "branches-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpPath)
+
+	repo, err := git.PlainInit(tmpPath, true)
+	if err != nil {
+		return nil, err
+	}
+	_, err = repo.CreateRemote(remoteConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var refSpecs []config.RefSpec
+	for _, branch := range branches {
+		refSpecs = append(refSpecs, config.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/heads/%s", branch, branch)))
+	}
+	err = repo.Fetch(&git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   refSpecs,
+		Auth:       auth,
+		Depth:      1,
+		Tags:       git.NoTags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+
+	manifests := map[string][]*dx.Manifest{}
+	for _, branch := range branches {
+		branchManifests, err := manifestsOnBranch(repo, branch)
+		if err != nil {
+			logrus.Warnf("could not extract manifests from %s: %s", branch, err)
+			continue
+		}
+		manifests[branch] = branchManifests
+	}
+
+	return manifests, nil
+}
+
+func manifestsOnBranch(repo *git.Repository, branch string) ([]*dx.Manifest, error) {
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	gimletFolder, err := tree.Tree(".gimlet")
+	if err == object.ErrDirectoryNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{}
+	for _, entry := range gimletFolder.Entries {
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+		file, err := gimletFolder.TreeEntryFile(&entry)
+		if err != nil {
+			return nil, err
+		}
+		content, err := file.Contents()
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name] = content
+	}
+
+	return parseManifests(files)
+}
+
+// loadBranchStates returns nil if there are no stored states yet
+func loadBranchStates(path string) (map[string]*branchState, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read branch states: %s", err)
+	}
+
+	var states map[string]*branchState
+	err = json.Unmarshal(content, &states)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse branch states %s: %s", path, err)
+	}
+	return states, nil
+}
+
+func saveBranchStates(path string, states map[string]*branchState) error {
+	content, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path+".tmp", content, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write branch states: %s", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
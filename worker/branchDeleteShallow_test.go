@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+type dummyTokenManager struct{}
+
+func (d *dummyTokenManager) Token() (string, string, error) {
+	return "", "", nil
+}
+
+func (d *dummyTokenManager) TokenFor(owner string) (string, string, error) {
+	return "", "", nil
+}
+
+func Test_shallowDeletedBranches(t *testing.T) {
+	remotesPath, _ := ioutil.TempDir("", "gimletd-remotes-")
+	defer os.RemoveAll(remotesPath)
+	cachePath, _ := ioutil.TempDir("", "gimletd-cache-")
+	defer os.RemoveAll(cachePath)
+
+	remotePath := filepath.Join(remotesPath, "gimlet-io", "my-app")
+	remote, err := git.PlainInit(remotePath, false)
+	assert.Nil(t, err)
+	commitFile(t, remote, remotePath, "README.md", "my-app")
+
+	err = remote.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature"), head(t, remote)))
+	assert.Nil(t, err)
+	w, _ := remote.Worktree()
+	err = w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature")})
+	assert.Nil(t, err)
+	commitFile(t, remote, remotePath, ".gimlet/preview.yaml", "app: my-app-feature\nenv: preview\n")
+
+	worker := NewBranchDeleteEventWorker(&dummyTokenManager{}, cachePath, nil, true)
+	worker.remoteURLFormat = filepath.Join(remotesPath, "%s")
+
+	deletedBranches, err := worker.shallowDeletedBranches("gimlet-io/my-app")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deletedBranches), "should not report deletes on the first run")
+
+	err = w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("master")})
+	assert.Nil(t, err)
+	err = remote.Storer.RemoveReference(plumbing.NewBranchReferenceName("feature"))
+	assert.Nil(t, err)
+
+	deletedBranches, err = worker.shallowDeletedBranches("gimlet-io/my-app")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deletedBranches))
+	assert.Equal(t, "feature", deletedBranches[0].branch)
+	assert.Equal(t, 1, len(deletedBranches[0].manifests), "should report the manifests the branch had")
+	assert.Equal(t, "my-app-feature", deletedBranches[0].manifests[0].App)
+
+	deletedBranches, err = worker.shallowDeletedBranches("gimlet-io/my-app")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deletedBranches), "should report a deleted branch only once")
+
+	files, _ := ioutil.ReadDir(cachePath)
+	assert.Equal(t, 1, len(files), "should only keep the branch states")
+}
+
+func commitFile(t *testing.T, repo *git.Repository, repoPath string, path string, content string) {
+	err := os.MkdirAll(filepath.Dir(filepath.Join(repoPath, path)), 0755)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(repoPath, path), []byte(content), 0644)
+	assert.Nil(t, err)
+
+	w, _ := repo.Worktree()
+	_, err = w.Add(path)
+	assert.Nil(t, err)
+	_, err = w.Commit("adding "+path, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@gimlet.io", When: time.Now()},
+	})
+	assert.Nil(t, err)
+}
+
+func head(t *testing.T, repo *git.Repository) plumbing.Hash {
+	ref, err := repo.Head()
+	assert.Nil(t, err)
+	return ref.Hash()
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/go-git/go-git/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// archiveBranchPrefix namespaces the archive branches in the gitops repo
+const archiveBranchPrefix = "archive/"
+
+// archiveBranchLayout is the time format of the archive branch names
+const archiveBranchLayout = "20060102T150405Z"
+
+// CleanupArchive keeps the last manifests of the deleted apps on archive branches of the gitops repo,
+// so an accidentally deleted preview can be restored, eg.:
+// git checkout archive/preview/my-app/20230102T150405Z -- preview/my-app.
+// Archive branches older than the retention are deleted
+type CleanupArchive struct {
+	retention time.Duration
+	now       func() time.Time
+}
+
+func NewCleanupArchive(retention time.Duration) *CleanupArchive {
+	return &CleanupArchive{
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// archive pushes the HEAD of the repo, where the apps are not deleted yet, to an archive branch of each app.
+// The expired archives are pruned afterwards
+func (a *CleanupArchive) archive(repo *git.Repository, repoPath string, deployKeyPath string, env string, apps []string) error {
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("cannot archive %s: %s", env, err)
+	}
+
+	now := a.now()
+	for _, app := range apps {
+		branch := archiveBranch(env, app, now)
+		err := nativeGit.NativePushToBranch(repoPath, deployKeyPath, head.Hash().String(), branch)
+		if err != nil {
+			return fmt.Errorf("cannot archive %s/%s to %s: %s", env, app, branch, err)
+		}
+		logrus.Infof("archived %s/%s to the %s branch", env, app, branch)
+	}
+
+	a.prune(repoPath, deployKeyPath)
+	return nil
+}
+
+// prune deletes the archive branches that are older than the retention
+func (a *CleanupArchive) prune(repoPath string, deployKeyPath string) {
+	branches, err := nativeGit.NativeRemoteBranches(repoPath, deployKeyPath, archiveBranchPrefix+"*")
+	if err != nil {
+		logrus.Warnf("cannot list the archive branches: %s", err)
+		return
+	}
+
+	var expired []string
+	for _, branch := range branches {
+		if expiredArchive(branch, a.now().Add(-a.retention)) {
+			expired = append(expired, branch)
+		}
+	}
+	err = nativeGit.NativeDeleteRemoteBranches(repoPath, deployKeyPath, expired)
+	if err != nil {
+		logrus.Warnf("cannot delete the expired archive branches: %s", err)
+	} else if len(expired) > 0 {
+		logrus.Infof("deleted %d archive branches, they are older than %s", len(expired), a.retention)
+	}
+}
+
+func archiveBranch(env string, app string, t time.Time) string {
+	return fmt.Sprintf("%s%s/%s/%s", archiveBranchPrefix, env, app, t.UTC().Format(archiveBranchLayout))
+}
+
+// expiredArchive tells if the archive branch was made before the cutoff.
+// Branches that were not made by CleanupArchive never expire
+func expiredArchive(branch string, cutoff time.Time) bool {
+	if !strings.HasPrefix(branch, archiveBranchPrefix) {
+		return false
+	}
+	archived, err := time.Parse(archiveBranchLayout, branch[strings.LastIndex(branch, "/")+1:])
+	if err != nil {
+		return false
+	}
+	return archived.Before(cutoff)
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_expiredArchive(t *testing.T) {
+	cutoff := time.Date(2021, 12, 15, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "archive/preview/my-app/20211214T100000Z", archiveBranch("preview", "my-app", time.Date(2021, 12, 14, 10, 0, 0, 0, time.UTC)))
+	assert.True(t, expiredArchive("archive/preview/my-app/20211214T100000Z", cutoff))
+	assert.False(t, expiredArchive("archive/preview/my-app/20211215T100000Z", cutoff))
+	assert.False(t, expiredArchive("archive/notes", cutoff), "branches not made by the archive should be kept")
+	assert.False(t, expiredArchive("preview/my-app/20211214T100000Z", cutoff))
+}
+
+func Test_cleanupArchive(t *testing.T) {
+	remotePath, _ := ioutil.TempDir("", "gitops-remote-")
+	defer os.RemoveAll(remotePath)
+	assert.Nil(t, exec.Command("git", "init", "--bare", remotePath).Run())
+
+	path, _ := ioutil.TempDir("", "gitops-")
+	defer os.RemoveAll(path)
+	repo, _ := git.PlainInit(path, false)
+	initHistory(repo)
+	assert.Nil(t, exec.Command("git", "-C", path, "remote", "add", "origin", remotePath).Run())
+	assert.Nil(t, nativeGit.NativePushToBranch(path, "", "HEAD", "archive/preview/my-app/20200101T000000Z"))
+
+	now := time.Date(2021, 12, 15, 0, 0, 0, 0, time.UTC)
+	archive := NewCleanupArchive(30 * 24 * time.Hour)
+	archive.now = func() time.Time { return now }
+	err := archive.archive(repo, path, "", "staging", []string{"my-app"})
+	assert.Nil(t, err)
+
+	branches, err := nativeGit.NativeRemoteBranches(path, "", "archive/*")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"archive/staging/my-app/20211215T000000Z"}, branches, "should archive the app and prune the expired archives")
+}
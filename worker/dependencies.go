@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/sirupsen/logrus"
+)
+
+// dependencyHealthTimeout is how long a deploy waits for Flux to apply its dependencies.
+// It is kept below the stuck event threshold, as the worker doesn't process other events while waiting
+const dependencyHealthTimeout = 5 * time.Minute
+const dependencyHealthPoll = 5 * time.Second
+
+// dependenciesReady checks that the dependencies of the manifest that were deployed by the same event succeeded.
+// If the manifest waits for its dependencies, it pushes them and waits until Flux applied them
+func dependenciesReady(
+	store *store.Store,
+	batch *gitopsBatch,
+	manifest *dx.Manifest,
+	gitopsEvents []*events.DeployEvent,
+	envs map[string]*dx.Env,
+	log *logrus.Entry,
+) error {
+	committed := false
+	for _, gitopsEvent := range gitopsEvents {
+		if !manifest.DependsOnManifest(gitopsEvent.Manifest) {
+			continue
+		}
+		if gitopsEvent.Status != events.Success {
+			return fmt.Errorf("dependency %s is not deployed: %s", gitopsEvent.Manifest.App, gitopsEvent.StatusDesc)
+		}
+		if gitopsEvent.GitopsRef != "" {
+			committed = true
+		}
+	}
+	if !manifest.WaitForDependencies || !committed {
+		return nil
+	}
+
+	branch := dx.GitopsBranch(envs, manifest.Env)
+	if batch.hasCommitsOn(branch) {
+		err := batch.push()
+		if err != nil {
+			return fmt.Errorf("cannot push dependencies: %s", err)
+		}
+	}
+
+	sha := batch.pushed[branch]
+	if sha == "" {
+		return fmt.Errorf("cannot find the pushed dependencies")
+	}
+	log.Infof("waiting for Flux to apply the dependencies in %s", sha)
+	return waitForHealthy(store, sha, dependencyHealthTimeout, dependencyHealthPoll)
+}
+
+// waitForHealthy waits until Flux reports the gitops commit applied
+func waitForHealthy(store *store.Store, sha string, timeout time.Duration, poll time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		gitopsCommit, err := store.GitopsCommit(sha)
+		if err != nil {
+			return err
+		}
+		if gitopsCommit != nil {
+			switch gitopsCommit.Status {
+			case model.ReconciliationSucceeded:
+				return nil
+			case model.ValidationFailed, model.ReconciliationFailed, model.HealthCheckFailed:
+				return fmt.Errorf("dependencies failed to apply: %s", gitopsCommit.StatusDesc)
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("dependencies were not applied in %s", timeout)
+		}
+		time.Sleep(poll)
+	}
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dependenciesReady(t *testing.T) {
+	app := &dx.Manifest{App: "my-app", Env: "staging", DependsOn: []string{"migrate"}}
+	migrate := &dx.Manifest{App: "migrate", Env: "staging"}
+	batch := newGitopsBatch(nil, "", nil)
+
+	err := dependenciesReady(nil, batch, app, []*events.DeployEvent{
+		{Manifest: migrate, Status: events.Failure, StatusDesc: "cannot template"},
+	}, nil, testLog)
+	assert.NotNil(t, err, "should not deploy when a dependency failed")
+
+	err = dependenciesReady(nil, batch, app, []*events.DeployEvent{
+		{Manifest: migrate, Status: events.Success, GitopsRef: "abc"},
+	}, nil, testLog)
+	assert.Nil(t, err, "should not wait for the dependencies unless asked")
+
+	err = dependenciesReady(nil, batch, app, nil, nil, testLog)
+	assert.Nil(t, err, "dependencies that were not deployed by the event don't hold back the deploy")
+}
+
+func Test_waitForHealthy(t *testing.T) {
+	s := store.NewTest()
+
+	err := waitForHealthy(s, "abc", 10*time.Millisecond, time.Millisecond)
+	assert.NotNil(t, err, "should time out without a Flux status")
+
+	s.SaveOrUpdateGitopsCommit(&model.GitopsCommit{Sha: "abc", Status: model.ReconciliationSucceeded})
+	err = waitForHealthy(s, "abc", 10*time.Millisecond, time.Millisecond)
+	assert.Nil(t, err)
+
+	s.SaveOrUpdateGitopsCommit(&model.GitopsCommit{Sha: "def", Status: model.HealthCheckFailed, StatusDesc: "migrate job failed"})
+	err = waitForHealthy(s, "def", 10*time.Millisecond, time.Millisecond)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "migrate job failed")
+}
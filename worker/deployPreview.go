@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/dx/helm"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/sirupsen/logrus"
+)
+
+// deployPreviews renders the manifests of a pull request artifact that would deploy once the pull request is merged,
+// and compares them with the current deploy in the gitops repo. Only envs with deploy previews enabled are rendered
+func deployPreviews(
+	repoCache *nativeGit.GitopsRepoCache,
+	tokenForChartClone string,
+	event *model.Event,
+	chartCache *helm.ChartCache,
+	platformConfig *nativeGit.PlatformConfig,
+	envs map[string]*dx.Env,
+	log *logrus.Entry,
+) []*events.DeployPreviewEvent {
+	if repoCache == nil {
+		return nil
+	}
+	artifact, err := model.ToArtifact(event)
+	if err != nil || artifact.Version.Event != dx.PR || artifact.Version.TargetBranch == "" {
+		return nil
+	}
+
+	manifests, err := dx.ExpandVariants(artifact.Environments)
+	if err != nil {
+		return nil
+	}
+
+	var previews []*events.DeployPreviewEvent
+	for _, env := range manifests {
+		if e, ok := envs[env.Env]; !ok || !e.DeployPreview || !deployTrigger(merged(artifact), dx.DeployPolicy(envs, env)) {
+			continue
+		}
+		envLog := log.WithFields(logrus.Fields{"app": env.App, "env": env.Env})
+
+		preview := &events.DeployPreviewEvent{
+			Manifest:      env,
+			Artifact:      artifact,
+			Status:        events.Success,
+			CorrelationID: event.CorrelationID,
+		}
+		previews = append(previews, preview)
+
+		err = resolveManifest(env, artifact, platformConfig, envs)
+		if err != nil {
+			preview.Status = events.Failure
+			preview.StatusDesc = err.Error()
+			continue
+		}
+		files, err := renderManifest(env, tokenForChartClone, chartCache, envLog)
+		if err != nil {
+			envLog.Warnf("cannot render deploy preview: %s", err)
+			preview.Status = events.Failure
+			preview.StatusDesc = err.Error()
+			continue
+		}
+		repo, releaseRepo := repoCache.EnvInstanceForRead(env.Env)
+		preview.Diff = diffManifests(repo, env, files)
+		releaseRepo()
+	}
+
+	return previews
+}
+
+// merged is the artifact as if the pull request was merged, so the deploy policies of the target branch match it
+func merged(artifact *dx.Artifact) *dx.Artifact {
+	mergedArtifact := *artifact
+	mergedArtifact.Version.Event = dx.Push
+	mergedArtifact.Version.Branch = artifact.Version.TargetBranch
+	return &mergedArtifact
+}
@@ -0,0 +1,25 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_mergedTrigger(t *testing.T) {
+	artifact := &dx.Artifact{
+		Version: dx.Version{
+			Branch:       "fix-login",
+			Event:        dx.PR,
+			SourceBranch: "fix-login",
+			TargetBranch: "main",
+		},
+	}
+	staging := &dx.Deploy{Branch: "main", Event: dx.PushPtr()}
+
+	assert.False(t, deployTrigger(artifact, staging), "the pull request itself should not deploy to staging")
+	assert.True(t, deployTrigger(merged(artifact), staging), "merging the pull request should deploy to staging")
+	assert.False(t, deployTrigger(merged(artifact), &dx.Deploy{Branch: "release", Event: dx.PushPtr()}))
+	assert.Equal(t, dx.PR, artifact.Version.Event, "should not change the artifact")
+}
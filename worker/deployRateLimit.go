@@ -0,0 +1,228 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
+)
+
+// deployRateWindow is the window that the deploys per env are limited in
+const deployRateWindow = time.Minute
+
+// deployRateLimiter limits the gitops writes per env to the env's MaxDeploysPerMinute,
+// protecting Flux and the clusters from being hammered by a flood of artifacts
+type deployRateLimiter struct {
+	envs    map[string]*dx.Env
+	deploys map[string][]time.Time
+	now     func() time.Time
+}
+
+func newDeployRateLimiter(envs map[string]*dx.Env) *deployRateLimiter {
+	return &deployRateLimiter{
+		envs:    envs,
+		deploys: map[string][]time.Time{},
+		now:     time.Now,
+	}
+}
+
+// active tells if any env is rate limited
+func (l *deployRateLimiter) active() bool {
+	for _, e := range l.envs {
+		if e != nil && e.MaxDeploysPerMinute > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedEnv returns the first env that has no deploys left in the window, empty if none
+func (l *deployRateLimiter) limitedEnv(envNames []string) string {
+	for _, env := range envNames {
+		e, ok := l.envs[env]
+		if !ok || e == nil || e.MaxDeploysPerMinute <= 0 {
+			continue
+		}
+		if len(l.recent(env)) >= e.MaxDeploysPerMinute {
+			return env
+		}
+	}
+	return ""
+}
+
+// record counts the deploys that were written to the gitops repo. Shadow deploys are not synced, so they are not counted
+func (l *deployRateLimiter) record(gitopsEvents []*events.DeployEvent) {
+	for _, gitopsEvent := range gitopsEvents {
+		if gitopsEvent == nil || gitopsEvent.GitopsRef == "" || gitopsEvent.Manifest == nil || gitopsEvent.Manifest.Shadow {
+			continue
+		}
+		env := gitopsEvent.Manifest.Env
+		if e, ok := l.envs[env]; !ok || e == nil || e.MaxDeploysPerMinute <= 0 {
+			continue
+		}
+		l.deploys[env] = append(l.recent(env), l.now())
+	}
+}
+
+// recent drops the deploys of env that are out of the window and returns the rest
+func (l *deployRateLimiter) recent(env string) []time.Time {
+	cutoff := l.now().Add(-deployRateWindow)
+	deploys := l.deploys[env]
+	i := 0
+	for i < len(deploys) && !deploys[i].After(cutoff) {
+		i++
+	}
+	l.deploys[env] = deploys[i:]
+	return l.deploys[env]
+}
+
+// deployTarget is an app in an env that an event writes to. An empty app stands for every app of the env
+type deployTarget struct {
+	env string
+	app string
+}
+
+func (t deployTarget) overlaps(other deployTarget) bool {
+	return t.env == other.env && (t.app == "" || other.app == "" || t.app == other.app)
+}
+
+// rateLimitRound tracks the apps whose events wait in a round of the worker because of the rate limit.
+// The later events of those apps wait too, so the events of an app keep their order
+type rateLimitRound struct {
+	waiting []deployTarget
+	// all is set when an event that may write to any app waits
+	all bool
+}
+
+// wait tells if the event has to wait for a later round, and why: it deploys to a rate limited env,
+// or it writes to an app that has waiting events before it. The events of the other envs and apps go on
+func (l *deployRateLimiter) wait(round *rateLimitRound, dao *store.Store, event *model.Event, envs map[string]*dx.Env) (bool, string) {
+	targets, all := eventTargets(dao, event, envs)
+
+	waitsBehind := round.all || all && len(round.waiting) > 0
+	for _, target := range targets {
+		for _, waiting := range round.waiting {
+			if target.overlaps(waiting) {
+				waitsBehind = true
+			}
+		}
+	}
+
+	reason := ""
+	if waitsBehind {
+		reason = "earlier events of its apps wait for the rate limit"
+	} else if batchable(event) {
+		var envNames []string
+		for _, target := range targets {
+			envNames = append(envNames, target.env)
+		}
+		if env := l.limitedEnv(envNames); env != "" {
+			reason = fmt.Sprintf("deploys to %s are rate limited", env)
+		}
+	}
+	if reason == "" {
+		return false, ""
+	}
+
+	round.waiting = append(round.waiting, targets...)
+	round.all = round.all || all
+	return true, reason
+}
+
+// eventTargets returns the apps that an event may write to.
+// All is set if they can't be told before processing the event, like for branch deletions and compactions
+func eventTargets(dao *store.Store, event *model.Event, envs map[string]*dx.Env) ([]deployTarget, bool) {
+	var targets []deployTarget
+	switch event.Type {
+	case model.TypeArtifact:
+		artifact, err := model.ToArtifact(event)
+		if err != nil {
+			return nil, true
+		}
+		manifests, err := dx.ExpandVariants(artifact.Environments)
+		if err != nil {
+			return nil, true
+		}
+		for _, manifest := range manifests {
+			if deployTrigger(artifact, dx.DeployPolicy(envs, manifest)) {
+				targets = append(targets, deployTarget{env: manifest.Env, app: resolvedApp(manifest, artifact)})
+			}
+		}
+	case model.TypeRelease:
+		var releaseRequest dx.ReleaseRequest
+		if err := json.Unmarshal([]byte(event.Blob), &releaseRequest); err != nil {
+			return nil, true
+		}
+		targets = append(targets, deployTarget{env: releaseRequest.Env, app: releaseRequest.App})
+	case model.TypeReevaluation:
+		var reevaluationRequest dx.ReevaluationRequest
+		if err := json.Unmarshal([]byte(event.Blob), &reevaluationRequest); err != nil {
+			return nil, true
+		}
+		artifactEvent, err := dao.Artifact(reevaluationRequest.ArtifactID)
+		if err != nil {
+			return nil, true
+		}
+		artifact, err := model.ToArtifact(artifactEvent)
+		if err != nil {
+			return nil, true
+		}
+		manifests, err := dx.ExpandVariants(artifact.Environments)
+		if err != nil {
+			return nil, true
+		}
+		for _, manifest := range manifests {
+			targets = append(targets, deployTarget{env: manifest.Env, app: resolvedApp(manifest, artifact)})
+		}
+	case model.TypeRollback:
+		var rollbackRequest dx.RollbackRequest
+		if err := json.Unmarshal([]byte(event.Blob), &rollbackRequest); err != nil {
+			return nil, true
+		}
+		targets = append(targets, deployTarget{env: rollbackRequest.Env, app: rollbackRequest.App})
+	case model.TypeAppDelete:
+		var deleteRequest dx.DeleteRequest
+		if err := json.Unmarshal([]byte(event.Blob), &deleteRequest); err != nil {
+			return nil, true
+		}
+		targets = append(targets, deployTarget{env: deleteRequest.Env, app: deleteRequest.App})
+	default:
+		return nil, true
+	}
+	return targets, false
+}
+
+// resolvedApp returns the app name of the manifest with the artifact vars resolved, as it is deployed.
+// Every app of the env if it can't be resolved
+func resolvedApp(manifest *dx.Manifest, artifact *dx.Artifact) string {
+	resolved, err := copyManifest(manifest)
+	if err != nil {
+		return ""
+	}
+	if err := resolved.ResolveVars(artifact.Vars()); err != nil {
+		return ""
+	}
+	return resolved.App
+}
+
+// deployEnvs returns the envs that an event may deploy to.
+// Artifacts deploy to the envs of their matching deploy policies, reevaluations conservatively to every env of the artifact
+func deployEnvs(dao *store.Store, event *model.Event, envs map[string]*dx.Env) []string {
+	if !batchable(event) {
+		return nil
+	}
+	targets, _ := eventTargets(dao, event, envs)
+	var envNames []string
+	seen := map[string]bool{}
+	for _, target := range targets {
+		if !seen[target.env] {
+			seen[target.env] = true
+			envNames = append(envNames, target.env)
+		}
+	}
+	return envNames
+}
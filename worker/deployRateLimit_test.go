@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_deployRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := newDeployRateLimiter(map[string]*dx.Env{
+		"staging":    {Name: "staging", MaxDeploysPerMinute: 2},
+		"production": {Name: "production"},
+	})
+	limiter.now = func() time.Time { return now }
+	assert.True(t, limiter.active())
+
+	deploy := func(env string, shadow bool) *events.DeployEvent {
+		return &events.DeployEvent{
+			Manifest:  &dx.Manifest{Env: env, App: "my-app", Shadow: shadow},
+			GitopsRef: "abc123",
+		}
+	}
+
+	limiter.record([]*events.DeployEvent{deploy("staging", false), deploy("staging", true), {Manifest: &dx.Manifest{Env: "staging"}}})
+	assert.Equal(t, "", limiter.limitedEnv([]string{"staging"}), "shadow and failed deploys should not count")
+
+	limiter.record([]*events.DeployEvent{deploy("staging", false), deploy("production", false)})
+	assert.Equal(t, "staging", limiter.limitedEnv([]string{"production", "staging"}))
+	assert.Equal(t, "", limiter.limitedEnv([]string{"production"}), "envs without a limit are not limited")
+
+	now = now.Add(deployRateWindow + time.Second)
+	assert.Equal(t, "", limiter.limitedEnv([]string{"staging"}), "should free up after the window")
+
+	assert.False(t, newDeployRateLimiter(map[string]*dx.Env{"staging": {Name: "staging"}}).active())
+}
+
+func Test_rateLimitRoundWait(t *testing.T) {
+	now := time.Now()
+	limiter := newDeployRateLimiter(map[string]*dx.Env{
+		"staging":    {Name: "staging", MaxDeploysPerMinute: 1},
+		"production": {Name: "production", MaxDeploysPerMinute: 1},
+	})
+	limiter.now = func() time.Time { return now }
+	limiter.record([]*events.DeployEvent{{Manifest: &dx.Manifest{Env: "staging", App: "my-app"}, GitopsRef: "abc123"}})
+
+	event := func(eventType string, request interface{}) *model.Event {
+		blob, _ := json.Marshal(request)
+		return &model.Event{ID: eventType, Type: eventType, Blob: string(blob)}
+	}
+	release := func(env, app string) *model.Event {
+		return event(model.TypeRelease, dx.ReleaseRequest{Env: env, App: app})
+	}
+
+	round := &rateLimitRound{}
+	wait, reason := limiter.wait(round, nil, release("staging", "my-app"), limiter.envs)
+	assert.True(t, wait)
+	assert.Equal(t, "deploys to staging are rate limited", reason)
+
+	wait, _ = limiter.wait(round, nil, release("production", "my-app"), limiter.envs)
+	assert.False(t, wait, "other envs should go on")
+	wait, _ = limiter.wait(round, nil, event(model.TypeRollback, dx.RollbackRequest{Env: "staging", App: "other-app"}), limiter.envs)
+	assert.False(t, wait, "other apps of the limited env should go on")
+
+	wait, reason = limiter.wait(round, nil, event(model.TypeRollback, dx.RollbackRequest{Env: "staging", App: "my-app"}), limiter.envs)
+	assert.True(t, wait, "later events of the waiting app should keep their order")
+	assert.Equal(t, "earlier events of its apps wait for the rate limit", reason)
+	wait, _ = limiter.wait(round, nil, event(model.TypeAppDelete, dx.DeleteRequest{Env: "staging", App: "my-app"}), limiter.envs)
+	assert.True(t, wait)
+
+	wait, _ = limiter.wait(round, nil, &model.Event{Type: model.TypeBranchDeleted}, limiter.envs)
+	assert.True(t, wait, "events that may write to any app should wait behind the waiting ones")
+	wait, _ = limiter.wait(round, nil, event(model.TypeRollback, dx.RollbackRequest{Env: "production", App: "my-app"}), limiter.envs)
+	assert.True(t, wait, "and the events after them too")
+
+	wait, _ = limiter.wait(&rateLimitRound{}, nil, &model.Event{Type: model.TypeBranchDeleted}, limiter.envs)
+	assert.False(t, wait, "nothing to wait for in a fresh round")
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/gimlet-io/gimletd/dora"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// DoraMetricsWorker periodically exports the DORA metrics of a rolling time window as Prometheus gauges
+type DoraMetricsWorker struct {
+	Store               *store.Store
+	Window              time.Duration
+	DeploymentFrequency prometheus.Gauge
+	LeadTime            prometheus.Gauge
+	ChangeFailureRate   prometheus.Gauge
+	MTTR                prometheus.Gauge
+}
+
+func (w *DoraMetricsWorker) Run() {
+	for {
+		now := time.Now()
+		metrics, err := dora.Compute(w.Store, now.Add(-w.Window), now)
+		if err != nil {
+			logrus.Errorf("cannot compute dora metrics: %s", err)
+		} else {
+			w.DeploymentFrequency.Set(metrics.DeploymentFrequency)
+			w.LeadTime.Set(metrics.LeadTimeSeconds)
+			w.ChangeFailureRate.Set(metrics.ChangeFailureRate)
+			w.MTTR.Set(metrics.MTTRSeconds)
+		}
+		time.Sleep(5 * time.Minute)
+	}
+}
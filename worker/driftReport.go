@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/drift"
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// DriftReportWorker periodically compares the configuration of every app across envs,
+// logs the apps that drifted and exports the number of drifting settings per app
+type DriftReportWorker struct {
+	Store       *store.Store
+	RepoCache   *nativeGit.GitopsRepoCache
+	EnvRegistry map[string]*dx.Env
+	// Envs are compared, all envs if empty
+	Envs  []string
+	Drift *prometheus.GaugeVec
+	Perf  *prometheus.HistogramVec
+}
+
+func (w *DriftReportWorker) Run() {
+	for {
+		err := w.report()
+		if err != nil {
+			logrus.Errorf("cannot report config drift: %s", err)
+		}
+		time.Sleep(30 * time.Minute)
+	}
+}
+
+func (w *DriftReportWorker) report() error {
+	envs := w.Envs
+	if len(envs) == 0 {
+		var err error
+		envs, err = w.RepoCache.Envs()
+		if err != nil {
+			return err
+		}
+	}
+
+	releases, err := drift.Releases(w.RepoCache, envs, w.Perf)
+	if err != nil {
+		return err
+	}
+
+	var apps []string
+	for app := range releases {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	w.Drift.Reset()
+	for _, app := range apps {
+		if len(releases[app]) < 2 {
+			continue // nothing to compare with
+		}
+
+		report, err := drift.Detect(w.Store, w.EnvRegistry, app, releases[app])
+		if err != nil {
+			logrus.Warnf("cannot detect config drift of %s: %s", app, err)
+			continue
+		}
+
+		drifting := len(report.Values)
+		if report.ChartDrift {
+			drifting++
+		}
+		w.Drift.WithLabelValues(app).Set(float64(drifting))
+
+		if report.Drifted() {
+			var keys []string
+			for _, value := range report.Values {
+				keys = append(keys, value.Key)
+			}
+			if report.ChartDrift {
+				keys = append(keys, "chart")
+			}
+			logrus.Infof("config of %s drifted between %s: %s", app, strings.Join(report.Envs, ","), strings.Join(keys, ", "))
+		}
+	}
+
+	return nil
+}
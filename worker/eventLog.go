@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/sirupsen/logrus"
+)
+
+// eventLogTailLines is the number of the last log lines of an event's processing that are stored on the event
+const eventLogTailLines = 200
+
+// eventLog is the logger of an event's processing.
+// Every line carries the fields of the event, and the last lines are kept to be stored on the event
+type eventLog struct {
+	*logrus.Entry
+	tail *logTail
+}
+
+func newEventLog(event *model.Event) *eventLog {
+	std := logrus.StandardLogger()
+	tail := &logTail{
+		max:       eventLogTailLines,
+		formatter: &logrus.TextFormatter{DisableColors: true, FullTimestamp: true},
+	}
+
+	logger := logrus.New()
+	logger.Out = std.Out
+	logger.Formatter = std.Formatter
+	logger.Level = std.Level
+	logger.Hooks.Add(tail)
+
+	return &eventLog{
+		Entry: logger.WithFields(logrus.Fields{
+			"eventId":       event.ID,
+			"eventType":     event.Type,
+			"repo":          event.Repository,
+			"correlationId": event.CorrelationID,
+		}),
+		tail: tail,
+	}
+}
+
+// Tail returns the last log lines of the event
+func (l *eventLog) Tail() []string {
+	return l.tail.lines()
+}
+
+// logTail is a logrus hook that keeps the last formatted log lines
+type logTail struct {
+	max       int
+	formatter logrus.Formatter
+
+	mu    sync.Mutex
+	buf   []string
+	start int
+}
+
+func (t *logTail) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (t *logTail) Fire(entry *logrus.Entry) error {
+	line, err := t.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.buf) < t.max {
+		t.buf = append(t.buf, strings.TrimSuffix(string(line), "\n"))
+		return nil
+	}
+	t.buf[t.start] = strings.TrimSuffix(string(line), "\n")
+	t.start = (t.start + 1) % t.max
+	return nil
+}
+
+func (t *logTail) lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := make([]string, 0, len(t.buf))
+	lines = append(lines, t.buf[t.start:]...)
+	return append(lines, t.buf[:t.start]...)
+}
@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_eventLogTail(t *testing.T) {
+	log := newEventLog(&model.Event{ID: "123", Type: model.TypeArtifact, Repository: "my-app"})
+	log.WithFields(logrus.Fields{"app": "my-app", "env": "staging"}).Info("deploying")
+	assert.Equal(t, 1, len(log.Tail()))
+	assert.Contains(t, log.Tail()[0], "deploying")
+	for _, field := range []string{"eventId=123", "eventType=artifact", "repo=my-app", "app=my-app", "env=staging"} {
+		assert.Contains(t, log.Tail()[0], field)
+	}
+
+	for i := 0; i < eventLogTailLines+10; i++ {
+		log.Infof("line %d", i)
+	}
+	tail := log.Tail()
+	assert.Equal(t, eventLogTailLines, len(tail), "should only keep the tail")
+	assert.Contains(t, tail[0], "line 10")
+	assert.Contains(t, tail[len(tail)-1], fmt.Sprintf("line %d", eventLogTailLines+9))
+}
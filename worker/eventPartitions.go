@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// EventPartitionWorker keeps the monthly partitions of the events table in place,
+// and prunes the ones past the retention.
+// It also prunes the event changes that the firehose did not ship within the event changes retention
+type EventPartitionWorker struct {
+	store                 *store.Store
+	retention             time.Duration
+	eventChangesRetention time.Duration
+}
+
+func NewEventPartitionWorker(
+	store *store.Store,
+	retention time.Duration,
+	eventChangesRetention time.Duration,
+) *EventPartitionWorker {
+	return &EventPartitionWorker{
+		store:                 store,
+		retention:             retention,
+		eventChangesRetention: eventChangesRetention,
+	}
+}
+
+func (w *EventPartitionWorker) Run() {
+	for {
+		err := w.store.MaintainEventPartitions(time.Now(), 2, w.retention)
+		if err != nil {
+			logrus.Errorf("could not maintain event partitions: %s", err)
+		}
+		err = w.store.PruneEventChanges(time.Now().Add(-w.eventChangesRetention))
+		if err != nil {
+			logrus.Errorf("could not prune event changes: %s", err)
+		}
+		time.Sleep(6 * time.Hour)
+	}
+}
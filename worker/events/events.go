@@ -9,8 +9,19 @@ type Status int
 const (
 	Success Status = iota
 	Failure
+	Parked
 )
 
+var statusToString = map[Status]string{
+	Success: "success",
+	Failure: "failure",
+	Parked:  "parked",
+}
+
+func (s Status) String() string {
+	return statusToString[s]
+}
+
 type DeployEvent struct {
 	Manifest    *dx.Manifest
 	Artifact    *dx.Artifact
@@ -21,6 +32,24 @@ type DeployEvent struct {
 
 	GitopsRef  string
 	GitopsRepo string
+
+	// Diff is the change of the app's manifests in the gitops commit
+	Diff *dx.ManifestDiff
+
+	CorrelationID string
+}
+
+// DeployPreviewEvent is the manifest change that merging a pull request would deploy to an env
+type DeployPreviewEvent struct {
+	Manifest *dx.Manifest
+	Artifact *dx.Artifact
+
+	Status     Status
+	StatusDesc string
+
+	Diff *dx.ManifestDiff
+
+	CorrelationID string
 }
 
 type RollbackEvent struct {
@@ -31,6 +60,8 @@ type RollbackEvent struct {
 
 	GitopsRefs []string
 	GitopsRepo string
+
+	CorrelationID string
 }
 
 type DeleteEvent struct {
@@ -44,6 +75,8 @@ type DeleteEvent struct {
 	GitopsRef  string
 	GitopsRepo string
 	BranchDeletedEvent BranchDeletedEvent
+
+	CorrelationID string
 }
 
 // BranchDeletedEvent contains all metadata about the deleted branch
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/gimlet-io/gimletd/firehose"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// FirehoseWorker streams the event state changes to an external sink, so they can be analyzed outside of GimletD.
+// The cursor only advances when the sink acknowledged a batch, so changes are delivered at least once
+type FirehoseWorker struct {
+	store     *store.Store
+	sink      firehose.Sink
+	interval  time.Duration
+	batchSize int
+
+	// settle holds back the changes of the last moments,
+	// as concurrent transactions may commit their changes out of ID order
+	settle time.Duration
+}
+
+func NewFirehoseWorker(
+	store *store.Store,
+	sink firehose.Sink,
+	interval time.Duration,
+	batchSize int,
+) *FirehoseWorker {
+	return &FirehoseWorker{
+		store:     store,
+		sink:      sink,
+		interval:  interval,
+		batchSize: batchSize,
+		settle:    2 * time.Second,
+	}
+}
+
+func (w *FirehoseWorker) Run() {
+	for {
+		err := w.ship()
+		if err != nil {
+			logrus.Errorf("could not ship event changes: %s", err)
+		}
+		time.Sleep(w.interval)
+	}
+}
+
+// ship sends the event changes after the cursor in batches, until it caught up
+func (w *FirehoseWorker) ship() error {
+	cursor, err := w.store.FirehoseCursor()
+	if err != nil {
+		return err
+	}
+
+	for {
+		changes, err := w.store.EventChanges(cursor, time.Now().Add(-w.settle), w.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		err = w.sink.Send(changes)
+		if err != nil {
+			return err
+		}
+
+		cursor = changes[len(changes)-1].ID
+		err = w.store.SaveFirehoseCursor(cursor)
+		if err != nil {
+			return err
+		}
+		err = w.store.DeleteEventChanges(cursor)
+		if err != nil {
+			logrus.Warnf("could not delete shipped event changes: %s", err)
+		}
+
+		if len(changes) < w.batchSize {
+			return nil
+		}
+	}
+}
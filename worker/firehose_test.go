@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/firehose"
+	"github.com/gimlet-io/gimletd/hooks"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_firehose(t *testing.T) {
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	var received []*model.EventChange
+	failing := true
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, hooks.Signature("secret", body), r.Header.Get("X-Gimlet-Signature"))
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var batch firehose.Batch
+		err := json.Unmarshal(body, &batch)
+		assert.Nil(t, err)
+		received = append(received, batch.Changes...)
+	}))
+	defer sink.Close()
+
+	firehoseWorker := NewFirehoseWorker(s, firehose.NewHTTPSink(sink.URL, "secret"), time.Second, 2)
+	firehoseWorker.settle = -1 * time.Second
+
+	event, err := s.CreateEvent(&model.Event{
+		Type:         model.TypeRelease,
+		Blob:         "{}",
+		GitopsHashes: []string{},
+	})
+	assert.Nil(t, err)
+	err = s.MarkEventProcessing(event.ID)
+	assert.Nil(t, err)
+	err = s.UpdateEventStatus(event.ID, model.StatusProcessed, "", "[]", "[]", "[]")
+	assert.Nil(t, err)
+
+	err = firehoseWorker.ship()
+	assert.NotNil(t, err)
+	cursor, err := s.FirehoseCursor()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cursor, "should not advance the cursor on failed deliveries")
+
+	failing = false
+	err = firehoseWorker.ship()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(received))
+	assert.Equal(t, model.StatusProcessed, received[2].Status)
+	cursor, err = s.FirehoseCursor()
+	assert.Nil(t, err)
+	assert.Equal(t, received[2].ID, cursor)
+
+	err = firehoseWorker.ship()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(received), "should not resend acknowledged changes")
+}
@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"fmt"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// frozen returns the release freeze of the manifest's app in its env, nil if it is not frozen
+func frozen(dao *store.Store, manifest *dx.Manifest, log *logrus.Entry) *dx.Freeze {
+	freezes, err := dao.Freezes()
+	if err != nil {
+		log.Warnf("could not load freezes: %s", err)
+		return nil
+	}
+	return dx.Frozen(freezes, manifest.Env, manifest.App, manifest.BaseApp())
+}
+
+// frozenDesc describes the parked deploy of a frozen app, with the reason of the freeze
+func frozenDesc(manifest *dx.Manifest, freeze *dx.Freeze) string {
+	desc := fmt.Sprintf("deploy of %s to %s is parked, it is frozen by %s", manifest.App, manifest.Env, freeze.FrozenBy)
+	if freeze.Reason != "" {
+		desc += ": " + freeze.Reason
+	}
+	return desc
+}
@@ -4,20 +4,21 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"github.com/gimlet-io/gimletd/dx/kustomize"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/dx/helm"
 	"github.com/gimlet-io/gimletd/git/customScm"
 	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/hooks"
 	"github.com/gimlet-io/gimletd/model"
 	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/scanner"
 	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/validation"
 	"github.com/gimlet-io/gimletd/worker/events"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
@@ -27,6 +28,11 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// GitopsWorkerName identifies the gitops worker in heartbeats
+const GitopsWorkerName = "gitops"
+
+const heartbeatInterval = 10 * time.Second
+
 type GitopsWorker struct {
 	store                   *store.Store
 	gitopsRepo              string
@@ -35,6 +41,21 @@ type GitopsWorker struct {
 	notificationsManager    notifications.Manager
 	eventsProcessed         prometheus.Counter
 	repoCache               *nativeGit.GitopsRepoCache
+	rollbackProtection      time.Duration
+	deployHooks             *hooks.DeployHooks
+	chartCache              *helm.ChartCache
+	platformConfig          *nativeGit.PlatformConfig
+	imageScanner            *scanner.Scanner
+	manifestValidator       *validation.Validator
+	signedArtifactEnvs      []string
+	envs                    map[string]*dx.Env
+	remoteCircuit           *RemoteCircuit
+	awaitGitopsChecks       bool
+	cleanupArchive          *CleanupArchive
+	rateLimiter             *deployRateLimiter
+
+	// holding are the envs whose failing sync held the auto-deploys in the last round, nil before the first one
+	holding map[string]bool
 }
 
 func NewGitopsWorker(
@@ -45,6 +66,17 @@ func NewGitopsWorker(
 	notificationsManager notifications.Manager,
 	eventsProcessed prometheus.Counter,
 	repoCache *nativeGit.GitopsRepoCache,
+	rollbackProtection time.Duration,
+	deployHooks *hooks.DeployHooks,
+	chartCache *helm.ChartCache,
+	platformConfig *nativeGit.PlatformConfig,
+	imageScanner *scanner.Scanner,
+	manifestValidator *validation.Validator,
+	signedArtifactEnvs []string,
+	envs map[string]*dx.Env,
+	remoteCircuit *RemoteCircuit,
+	awaitGitopsChecks bool,
+	cleanupArchive *CleanupArchive,
 ) *GitopsWorker {
 	return &GitopsWorker{
 		store:                   store,
@@ -54,11 +86,57 @@ func NewGitopsWorker(
 		tokenManager:            tokenManager,
 		eventsProcessed:         eventsProcessed,
 		repoCache:               repoCache,
+		rollbackProtection:      rollbackProtection,
+		deployHooks:             deployHooks,
+		chartCache:              chartCache,
+		platformConfig:          platformConfig,
+		imageScanner:            imageScanner,
+		manifestValidator:       manifestValidator,
+		signedArtifactEnvs:      signedArtifactEnvs,
+		envs:                    envs,
+		remoteCircuit:           remoteCircuit,
+		awaitGitopsChecks:       awaitGitopsChecks,
+		cleanupArchive:          cleanupArchive,
+		rateLimiter:             newDeployRateLimiter(envs),
 	}
 }
 
 func (w *GitopsWorker) Run() {
+	var lastHeartbeat time.Time
 	for {
+		if time.Since(lastHeartbeat) > heartbeatInterval {
+			lastHeartbeat = time.Now()
+			err := w.store.SaveHeartbeat(GitopsWorkerName, lastHeartbeat)
+			if err != nil {
+				logrus.Warnf("could not save heartbeat: %s", err)
+			}
+		}
+
+		maintenance, err := w.store.Maintenance()
+		if err != nil {
+			logrus.Warnf("could not load maintenance mode: %s", err)
+		} else if maintenance.Enabled {
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		allowed, recovered := w.remoteCircuit.allow()
+		if recovered {
+			w.notificationsManager.Broadcast(notifications.NewGitopsRemoteMessage(w.gitopsRepo, false, nil))
+		}
+		if !allowed {
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		failingSyncs, err := w.failingSyncs()
+		if err != nil {
+			logrus.Errorf("could not load the failing env syncs: %s", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		w.requeueHeldEvents(holdingEnvs(w.envs, failingSyncs))
+
 		events, err := w.store.UnprocessedEvents()
 		if err != nil {
 			logrus.Errorf("Could not fetch unprocessed events %s", err.Error())
@@ -66,19 +144,79 @@ func (w *GitopsWorker) Run() {
 			continue
 		}
 
-		for _, event := range events {
+		batch := newGitopsBatch(w.repoCache, w.gitopsRepoDeployKeyPath, w.deployHooks)
+		var pending []*processedEvent
+		rateLimited := false
+		round := &rateLimitRound{}
+		for _, event := range w.holdAutoDeploys(events, failingSyncs) {
+			if w.rateLimiter.active() {
+				if wait, reason := w.rateLimiter.wait(round, w.store, event, w.envs); wait {
+					logrus.Infof("event %s stays queued, %s", event.ID, reason)
+					rateLimited = true
+					continue
+				}
+			}
 			w.eventsProcessed.Inc()
-			processEvent(w.store,
+			err := w.store.MarkEventProcessing(event.ID)
+			if err != nil {
+				logrus.Warnf("could not mark event as processing: %s", err)
+			}
+			if !batchable(event) {
+				// rollbacks, deletes and compactions work on the remote state, the batched deploys must be pushed first
+				w.finalize(batch, pending)
+				pending = nil
+			}
+			log := newEventLog(event)
+			gitopsEvents, err := processEvent(w.store,
 				w.gitopsRepo,
 				w.gitopsRepoDeployKeyPath,
 				w.tokenManager,
 				event,
 				w.notificationsManager,
 				w.repoCache,
+				w.rollbackProtection,
+				w.deployHooks,
+				w.chartCache,
+				w.platformConfig,
+				w.imageScanner,
+				w.manifestValidator,
+				w.signedArtifactEnvs,
+				w.envs,
+				w.cleanupArchive,
+				batch,
+				log.Entry,
 			)
+			w.rateLimiter.record(gitopsEvents)
+			pending = append(pending, &processedEvent{event: event, gitopsEvents: gitopsEvents, err: err, log: log})
+		}
+		w.finalize(batch, pending)
+
+		if rateLimited {
+			time.Sleep(1 * time.Second)
+			continue
 		}
+		waitForEvents(w.store.EventsNotify(), len(events) > 0)
+	}
+}
+
+// eventsFallbackPoll is how often the worker polls when stored events are notified,
+// to pick up requeued events and the notifications that were missed
+const eventsFallbackPoll = 10 * time.Second
 
+// waitForEvents waits until there may be new events to process.
+// Without notifications it falls back to polling
+func waitForEvents(notify <-chan struct{}, found bool) {
+	if notify == nil {
 		time.Sleep(100 * time.Millisecond)
+		return
+	}
+	if found {
+		return // there may be more events than a batch
+	}
+
+	select {
+	case <-notify:
+	case <-time.After(eventsFallbackPoll):
 	}
 }
 
@@ -90,12 +228,25 @@ func processEvent(
 	event *model.Event,
 	notificationsManager notifications.Manager,
 	repoCache *nativeGit.GitopsRepoCache,
-) {
+	rollbackProtection time.Duration,
+	deployHooks *hooks.DeployHooks,
+	chartCache *helm.ChartCache,
+	platformConfig *nativeGit.PlatformConfig,
+	imageScanner *scanner.Scanner,
+	manifestValidator *validation.Validator,
+	signedArtifactEnvs []string,
+	envs map[string]*dx.Env,
+	cleanupArchive *CleanupArchive,
+	batch *gitopsBatch,
+	log *logrus.Entry,
+) ([]*events.DeployEvent, error) {
 	var token string
 	if tokenManager != nil { // only needed for private helm charts
 		token, _, _ = tokenManager.Token()
 	}
 
+	log.Infof("processing %s event", event.Type)
+
 	// process event based on type
 	var err error
 	var gitopsEvents []*events.DeployEvent
@@ -105,20 +256,55 @@ func processEvent(
 	case model.TypeArtifact:
 		gitopsEvents, err = processArtifactEvent(
 			gitopsRepo,
-			repoCache,
-			gitopsRepoDeployKeyPath,
+			batch,
 			token,
 			event,
 			store,
+			rollbackProtection,
+			deployHooks,
+			chartCache,
+			platformConfig,
+			imageScanner,
+			manifestValidator,
+			signedArtifactEnvs,
+			envs,
+			log,
 		)
+		for _, preview := range deployPreviews(repoCache, token, event, chartCache, platformConfig, envs, log) {
+			notificationsManager.Broadcast(notifications.MessageFromDeployPreviewEvent(preview))
+		}
 	case model.TypeRelease:
 		gitopsEvents, err = processReleaseEvent(
 			store,
 			gitopsRepo,
-			repoCache,
-			gitopsRepoDeployKeyPath,
+			batch,
 			token,
 			event,
+			deployHooks,
+			chartCache,
+			platformConfig,
+			imageScanner,
+			manifestValidator,
+			signedArtifactEnvs,
+			envs,
+			log,
+		)
+	case model.TypeReevaluation:
+		gitopsEvents, err = processReevaluationEvent(
+			gitopsRepo,
+			batch,
+			token,
+			event,
+			store,
+			rollbackProtection,
+			deployHooks,
+			chartCache,
+			platformConfig,
+			imageScanner,
+			manifestValidator,
+			signedArtifactEnvs,
+			envs,
+			log,
 		)
 	case model.TypeRollback:
 		rollbackEvent, err = processRollbackEvent(
@@ -126,24 +312,123 @@ func processEvent(
 			gitopsRepoDeployKeyPath,
 			repoCache,
 			event,
+			log,
 		)
 		notificationsManager.Broadcast(notifications.MessageFromRollbackEvent(rollbackEvent))
 		for _, sha := range rollbackEvent.GitopsRefs {
 			setGitopsHashOnEvent(event, sha)
 		}
+		if err == nil {
+			recordRollback(store, rollbackEvent.RollbackRequest, log)
+		}
 	case model.TypeBranchDeleted:
 		deleteEvents, err = processBranchDeletedEvent(
 			gitopsRepo,
 			gitopsRepoDeployKeyPath,
 			repoCache,
+			cleanupArchive,
 			event,
+			log,
 		)
 		for _, deleteEvent := range deleteEvents {
 			notificationsManager.Broadcast(notifications.MessageFromDeleteEvent(deleteEvent))
 			setGitopsHashOnEvent(event, deleteEvent.GitopsRef)
 		}
+	case model.TypeAppDelete:
+		var deleteEvent *events.DeleteEvent
+		deleteEvent, err = processAppDeleteEvent(
+			gitopsRepo,
+			gitopsRepoDeployKeyPath,
+			repoCache,
+			cleanupArchive,
+			event,
+			log,
+		)
+		if deleteEvent != nil {
+			notificationsManager.Broadcast(notifications.MessageFromDeleteEvent(deleteEvent))
+			setGitopsHashOnEvent(event, deleteEvent.GitopsRef)
+		}
+	case model.TypeCompaction:
+		err = processCompactionEvent(
+			gitopsRepoDeployKeyPath,
+			repoCache,
+			event,
+			log,
+		)
+	}
+
+	for _, gitopsEvent := range gitopsEvents {
+		if gitopsEvent != nil {
+			gitopsEvent.CorrelationID = event.CorrelationID
+		}
+	}
+
+	return gitopsEvents, err
+}
+
+// processedEvent is an event that waits for the push of the batch it committed to
+type processedEvent struct {
+	event        *model.Event
+	gitopsEvents []*events.DeployEvent
+	err          error
+	log          *eventLog
+}
+
+// batchable tells if the event only commits deploys, that can be pushed together with other deploys
+func batchable(event *model.Event) bool {
+	return event.Type == model.TypeArtifact || event.Type == model.TypeRelease || event.Type == model.TypeReevaluation
+}
+
+// finalize pushes the batched commits, then notifies about the processed events and stores their state
+func (w *GitopsWorker) finalize(batch *gitopsBatch, pending []*processedEvent) {
+	committed := map[*processedEvent][]*events.DeployEvent{}
+	for _, p := range pending {
+		for _, gitopsEvent := range p.gitopsEvents {
+			if gitopsEvent.GitopsRef != "" {
+				committed[p] = append(committed[p], gitopsEvent)
+			}
+		}
+	}
+
+	pushing := batch.hasCommits()
+	pushErr := batch.push()
+	if pushErr != nil {
+		logrus.Errorf("could not push gitops changes: %s", pushErr)
+		if w.remoteCircuit.pushFailed(pushErr) {
+			w.notificationsManager.Broadcast(notifications.NewGitopsRemoteMessage(w.gitopsRepo, true, pushErr))
+		}
+	} else if pushing {
+		w.remoteCircuit.pushSucceeded()
 	}
 
+	for _, p := range pending {
+		err := p.err
+		if err == nil && pushErr != nil && failedToPush(committed[p]) {
+			err = pushErr
+		}
+		finalizeEvent(w.store, w.notificationsManager, p.event, p.gitopsEvents, err, w.awaitGitopsChecks, p.log)
+	}
+}
+
+// failedToPush tells if any of the committed deploys were on a branch that failed to push, the push clears their gitops ref
+func failedToPush(committed []*events.DeployEvent) bool {
+	for _, gitopsEvent := range committed {
+		if gitopsEvent.GitopsRef == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func finalizeEvent(
+	store *store.Store,
+	notificationsManager notifications.Manager,
+	event *model.Event,
+	gitopsEvents []*events.DeployEvent,
+	err error,
+	awaitGitopsChecks bool,
+	log *eventLog,
+) {
 	// send out notifications based on gitops events
 	for _, gitopsEvent := range gitopsEvents {
 		notificationsManager.Broadcast(notifications.MessageFromGitOpsEvent(gitopsEvent))
@@ -153,30 +438,73 @@ func processEvent(
 	for _, gitopsEvent := range gitopsEvents {
 		setGitopsHashOnEvent(event, gitopsEvent.GitopsRef)
 	}
+	event.TriggeredEnvs = triggeredEnvs(gitopsEvents)
+	event.EnvStatuses = envStatuses(gitopsEvents)
+
+	if err == nil {
+		if failed := failedDeploys(gitopsEvents); failed != "" {
+			err = errors.New(failed)
+		}
+	}
 
 	// store event state
 	if err != nil {
-		logrus.Errorf("error in processing event: %s", err.Error())
+		log.Errorf("error in processing event: %s", err.Error())
 		event.Status = model.StatusError
+		if len(event.TriggeredEnvs) > 0 {
+			event.Status = model.StatusPartial
+		}
 		event.StatusDesc = err.Error()
 		err := updateEvent(store, event)
 		if err != nil {
-			logrus.Warnf("could not update event status %v", err)
+			log.Warnf("could not update event status %v", err)
+		}
+	} else if parked := parkedDeploys(gitopsEvents); parked != "" {
+		log.Infof("event is parked: %s", parked)
+		event.Status = model.StatusParked
+		event.StatusDesc = parked
+		err := updateEvent(store, event)
+		if err != nil {
+			log.Warnf("could not update event status %v", err)
+		}
+	} else if awaitGitopsChecks && awaitChecks(event.EnvStatuses) {
+		log.Info("event is pushed, waiting for the gitops checks")
+		event.Status = model.StatusChecking
+		event.StatusDesc = "waiting for the checks of the gitops commits"
+		err := updateEvent(store, event)
+		if err != nil {
+			log.Warnf("could not update event status %v", err)
 		}
 	} else {
+		log.Info("event is processed")
 		event.Status = model.StatusProcessed
 		err := updateEvent(store, event)
 		if err != nil {
-			logrus.Warnf("could not update event status %v", err)
+			log.Warnf("could not update event status %v", err)
 		}
 	}
+
+	event.Logs = log.Tail()
+	logsString, err := json.Marshal(event.Logs)
+	if err == nil {
+		err = store.UpdateEventLogs(event.ID, string(logsString))
+	}
+	if err != nil {
+		log.Warnf("could not store event logs %v", err)
+	}
+
+	if event.Status != model.StatusChecking {
+		callArtifactCallbacks(store, event, log.Entry)
+	}
 }
 
 func processBranchDeletedEvent(
 	gitopsRepo string,
 	gitopsRepoDeployKeyPath string,
 	gitopsRepoCache *nativeGit.GitopsRepoCache,
+	cleanupArchive *CleanupArchive,
 	event *model.Event,
+	log *logrus.Entry,
 ) ([]*events.DeleteEvent, error) {
 	var deletedEvents []*events.DeleteEvent
 	var branchDeletedEvent events.BranchDeletedEvent
@@ -185,7 +513,11 @@ func processBranchDeletedEvent(
 		return nil, fmt.Errorf("cannot parse delete request with id: %s", event.ID)
 	}
 
-	for _, env := range branchDeletedEvent.Manifests {
+	manifests, err := dx.ExpandVariants(branchDeletedEvent.Manifests)
+	if err != nil {
+		return nil, err
+	}
+	for _, env := range manifests {
 		if env.Cleanup == nil {
 			continue
 		}
@@ -198,32 +530,39 @@ func processBranchDeletedEvent(
 			GitopsRepo:  gitopsRepo,
 
 			BranchDeletedEvent: branchDeletedEvent,
+			CorrelationID:      event.CorrelationID,
 		}
 
-		err := env.Cleanup.ResolveVars(map[string]string{
-			"BRANCH": branchDeletedEvent.Branch,
-		})
+		err := env.Cleanup.ResolveVars(dx.CleanupVars(branchDeletedEvent.Branch, branchDeletedEvent.Repo))
 		if err != nil {
 			gitopsEvent.Status = events.Failure
 			gitopsEvent.StatusDesc = err.Error()
 			return []*events.DeleteEvent{gitopsEvent}, err
 		}
-		gitopsEvent.App = env.Cleanup.AppToCleanup // vars are resolved now
+		gitopsEvent.App = strings.Join(env.Cleanup.Apps(), ", ") // vars are resolved now
 
 		if !cleanupTrigger(branchDeletedEvent.Branch, env.Cleanup) {
 			continue
 		}
+		log.WithFields(logrus.Fields{"app": gitopsEvent.App, "env": env.Env}).
+			Infof("cleaning up after the deleted %s branch", branchDeletedEvent.Branch)
 
 		gitopsEvent, err = cloneTemplateDeleteAndPush(
 			gitopsRepoCache,
 			gitopsRepoDeployKeyPath,
+			cleanupArchive,
 			env.Cleanup,
 			env.Env,
 			"policy",
 			gitopsEvent,
 		)
 		if gitopsEvent != nil {
-			deletedEvents = append(deletedEvents, gitopsEvent)
+			// the apps are deleted in one commit, each with its own event
+			for _, app := range env.Cleanup.Apps() {
+				appEvent := *gitopsEvent
+				appEvent.App = app
+				deletedEvents = append(deletedEvents, &appEvent)
+			}
 		}
 		if err != nil {
 			return deletedEvents, err
@@ -233,6 +572,112 @@ func processBranchDeletedEvent(
 	return deletedEvents, err
 }
 
+// parkedDeploys returns the reasons of the parked deploys, empty if none was parked
+func parkedDeploys(gitopsEvents []*events.DeployEvent) string {
+	var reasons []string
+	for _, gitopsEvent := range gitopsEvents {
+		if gitopsEvent != nil && gitopsEvent.Status == events.Parked {
+			reasons = append(reasons, gitopsEvent.StatusDesc)
+		}
+	}
+	return strings.Join(reasons, "\n")
+}
+
+// failedDeploys returns the reasons of the failed deploys, empty if none failed
+func failedDeploys(gitopsEvents []*events.DeployEvent) string {
+	var reasons []string
+	for _, gitopsEvent := range gitopsEvents {
+		if gitopsEvent != nil && gitopsEvent.Status == events.Failure {
+			reasons = append(reasons, gitopsEvent.StatusDesc)
+		}
+	}
+	return strings.Join(reasons, "\n")
+}
+
+// triggeredEnvs returns the distinct envs that the gitops events deployed to
+func triggeredEnvs(gitopsEvents []*events.DeployEvent) []string {
+	envs := []string{}
+	seen := map[string]bool{}
+	for _, gitopsEvent := range gitopsEvents {
+		if gitopsEvent == nil || gitopsEvent.Manifest == nil || gitopsEvent.Status != events.Success {
+			continue
+		}
+		if !seen[gitopsEvent.Manifest.Env] {
+			seen[gitopsEvent.Manifest.Env] = true
+			envs = append(envs, gitopsEvent.Manifest.Env)
+		}
+	}
+	return envs
+}
+
+// envStatuses returns the outcome of each deploy of the gitops events
+func envStatuses(gitopsEvents []*events.DeployEvent) []dx.EnvStatus {
+	statuses := []dx.EnvStatus{}
+	for _, gitopsEvent := range gitopsEvents {
+		if gitopsEvent == nil || gitopsEvent.Manifest == nil {
+			continue
+		}
+
+		status := dx.EnvStatusSuccess
+		switch gitopsEvent.Status {
+		case events.Failure:
+			status = dx.EnvStatusFailure
+		case events.Parked:
+			status = dx.EnvStatusParked
+		}
+		statuses = append(statuses, dx.EnvStatus{
+			Env:        gitopsEvent.Manifest.Env,
+			App:        gitopsEvent.Manifest.App,
+			Status:     status,
+			StatusDesc: gitopsEvent.StatusDesc,
+			GitopsRef:  gitopsEvent.GitopsRef,
+			Diff:       gitopsEvent.Diff,
+		})
+	}
+	return statuses
+}
+
+func processAppDeleteEvent(
+	gitopsRepo string,
+	gitopsRepoDeployKeyPath string,
+	gitopsRepoCache *nativeGit.GitopsRepoCache,
+	cleanupArchive *CleanupArchive,
+	event *model.Event,
+	log *logrus.Entry,
+) (*events.DeleteEvent, error) {
+	var deleteRequest dx.DeleteRequest
+	err := json.Unmarshal([]byte(event.Blob), &deleteRequest)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse delete request with id: %s", event.ID)
+	}
+
+	log.WithFields(logrus.Fields{"app": deleteRequest.App, "env": deleteRequest.Env}).
+		Infof("deleting app, requested by %s", deleteRequest.TriggeredBy)
+	gitopsEvent := &events.DeleteEvent{
+		Env:           deleteRequest.Env,
+		App:           deleteRequest.App,
+		TriggeredBy:   deleteRequest.TriggeredBy,
+		Status:        events.Success,
+		GitopsRepo:    gitopsRepo,
+		CorrelationID: event.CorrelationID,
+	}
+
+	deleteEvent, err := cloneTemplateDeleteAndPush(
+		gitopsRepoCache,
+		gitopsRepoDeployKeyPath,
+		cleanupArchive,
+		&dx.Cleanup{AppToCleanup: deleteRequest.App},
+		deleteRequest.Env,
+		deleteRequest.TriggeredBy,
+		gitopsEvent,
+	)
+	if err == nil && deleteEvent == nil {
+		return nil, fmt.Errorf("%s is not deployed to %s", deleteRequest.App, deleteRequest.Env)
+	}
+
+	return deleteEvent, err
+}
+
 func setGitopsHashOnEvent(event *model.Event, gitopsSha string) {
 	if gitopsSha == "" {
 		return
@@ -248,10 +693,17 @@ func setGitopsHashOnEvent(event *model.Event, gitopsSha string) {
 func processReleaseEvent(
 	store *store.Store,
 	gitopsRepo string,
-	gitopsRepoCache *nativeGit.GitopsRepoCache,
-	gitopsRepoDeployKeyPath string,
+	batch *gitopsBatch,
 	githubChartAccessToken string,
 	event *model.Event,
+	deployHooks *hooks.DeployHooks,
+	chartCache *helm.ChartCache,
+	platformConfig *nativeGit.PlatformConfig,
+	imageScanner *scanner.Scanner,
+	manifestValidator *validation.Validator,
+	signedArtifactEnvs []string,
+	envs map[string]*dx.Env,
+	log *logrus.Entry,
 ) ([]*events.DeployEvent, error) {
 	var gitopsEvents []*events.DeployEvent
 	var releaseRequest dx.ReleaseRequest
@@ -264,34 +716,93 @@ func processReleaseEvent(
 	if err != nil {
 		return gitopsEvents, fmt.Errorf("cannot find artifact with id: %s", event.ArtifactID)
 	}
+	if artifactEvent.Expired != 0 {
+		return gitopsEvents, fmt.Errorf("artifact %s is expired, its images may no longer exist", releaseRequest.ArtifactID)
+	}
 	artifact, err := model.ToArtifact(artifactEvent)
 	if err != nil {
 		return gitopsEvents, fmt.Errorf("cannot parse artifact %s", err.Error())
 	}
 
-	for _, env := range artifact.Environments {
+	manifests, err := dx.ExpandVariants(artifact.Environments)
+	if err != nil {
+		return gitopsEvents, err
+	}
+	manifests, err = dx.OrderByDependencies(manifests)
+	if err != nil {
+		return gitopsEvents, err
+	}
+	for _, env := range manifests {
 		if env.Env != releaseRequest.Env {
 			continue
 		}
 		env.ResolveVars(artifact.Vars())
 		if releaseRequest.App != "" &&
-			env.App != releaseRequest.App {
+			env.App != releaseRequest.App &&
+			env.BaseApp() != releaseRequest.App { // releasing the app releases all its variants
 			continue
 		}
+		envLog := log.WithFields(logrus.Fields{"app": env.App, "env": env.Env})
+
+		if err := checkSignature(artifact, env.Env, signedArtifactEnvs); err != nil {
+			gitopsEvents = append(gitopsEvents, &events.DeployEvent{
+				Manifest:    env,
+				Artifact:    artifact,
+				TriggeredBy: releaseRequest.TriggeredBy,
+				Status:      events.Failure,
+				StatusDesc:  err.Error(),
+				GitopsRepo:  gitopsRepo,
+			})
+			envLog.Warn(err.Error())
+			return gitopsEvents, err
+		}
+
+		if f := frozen(store, env, envLog); f != nil {
+			gitopsEvents = append(gitopsEvents, &events.DeployEvent{
+				Manifest:    env,
+				Artifact:    artifact,
+				TriggeredBy: releaseRequest.TriggeredBy,
+				Status:      events.Parked,
+				StatusDesc:  frozenDesc(env, f),
+				GitopsRepo:  gitopsRepo,
+			})
+			envLog.Info(frozenDesc(env, f))
+			continue
+		}
+
+		if err := dependenciesReady(store, batch, env, gitopsEvents, envs, envLog); err != nil {
+			gitopsEvents = append(gitopsEvents, &events.DeployEvent{
+				Manifest:    env,
+				Artifact:    artifact,
+				TriggeredBy: releaseRequest.TriggeredBy,
+				Status:      events.Failure,
+				StatusDesc:  err.Error(),
+				GitopsRepo:  gitopsRepo,
+			})
+			return gitopsEvents, err
+		}
 
-		gitopsEvent, err := cloneTemplateWriteAndPush(
+		gitopsEvent, err := templateAndCommit(
+			batch,
 			gitopsRepo,
-			gitopsRepoCache,
-			gitopsRepoDeployKeyPath,
 			githubChartAccessToken,
 			artifact,
 			env,
 			releaseRequest.TriggeredBy,
+			event.CorrelationID,
+			deployHooks,
+			chartCache,
+			platformConfig,
+			imageScanner,
+			manifestValidator,
+			envs,
+			envLog,
 		)
 		gitopsEvents = append(gitopsEvents, gitopsEvent)
 		if err != nil {
 			return gitopsEvents, err
 		}
+		keepImageUpdatePoliciesUpToDate(store, env, artifact, envLog)
 	}
 
 	return gitopsEvents, nil
@@ -302,6 +813,7 @@ func processRollbackEvent(
 	gitopsRepoDeployKeyPath string,
 	gitopsRepoCache *nativeGit.GitopsRepoCache,
 	event *model.Event,
+	log *logrus.Entry,
 ) (*events.RollbackEvent, error) {
 	var rollbackRequest dx.RollbackRequest
 	err := json.Unmarshal([]byte(event.Blob), &rollbackRequest)
@@ -309,14 +821,17 @@ func processRollbackEvent(
 		return nil, fmt.Errorf("cannot parse release request with id: %s", event.ID)
 	}
 
+	log = log.WithFields(logrus.Fields{"app": rollbackRequest.App, "env": rollbackRequest.Env})
+	log.Infof("rolling back to %s, requested by %s", rollbackRequest.TargetSHA, rollbackRequest.TriggeredBy)
 	rollbackEvent := &events.RollbackEvent{
 		RollbackRequest: &rollbackRequest,
 		GitopsRepo:      gitopsRepo,
+		CorrelationID:   event.CorrelationID,
 	}
 
 	t0 := time.Now().UnixNano()
-	repo, repoTmpPath, err := gitopsRepoCache.InstanceForWrite()
-	logrus.Infof("Obtaining instance for write took %d", (time.Now().UnixNano()-t0)/1000/1000)
+	repo, repoTmpPath, err := gitopsRepoCache.EnvInstanceForWrite(rollbackRequest.Env)
+	log.Infof("Obtaining instance for write took %d", (time.Now().UnixNano()-t0)/1000/1000)
 	defer nativeGit.TmpFsCleanup(repoTmpPath)
 	if err != nil {
 		rollbackEvent.Status = events.Failure
@@ -332,6 +847,8 @@ func processRollbackEvent(
 		repo,
 		repoTmpPath,
 		rollbackRequest.TargetSHA,
+		rollbackRequest.Force,
+		log,
 	)
 	if err != nil {
 		rollbackEvent.Status = events.Failure
@@ -353,13 +870,87 @@ func processRollbackEvent(
 		rollbackEvent.StatusDesc = err.Error()
 		return rollbackEvent, err
 	}
-	gitopsRepoCache.Invalidate()
+	gitopsRepoCache.InvalidateBranch(gitopsRepoCache.Branch(rollbackRequest.Env))
 
 	rollbackEvent.GitopsRefs = hashes
 	rollbackEvent.Status = events.Success
 	return rollbackEvent, nil
 }
 
+func processCompactionEvent(
+	gitopsRepoDeployKeyPath string,
+	gitopsRepoCache *nativeGit.GitopsRepoCache,
+	event *model.Event,
+	log *logrus.Entry,
+) error {
+	var compactionRequest dx.CompactionRequest
+	err := json.Unmarshal([]byte(event.Blob), &compactionRequest)
+	if err != nil {
+		return fmt.Errorf("cannot parse compaction request with id: %s", event.ID)
+	}
+
+	return compactBranch(gitopsRepoDeployKeyPath, gitopsRepoCache, gitopsRepoCache.Branch(compactionRequest.Env), compactionRequest, log)
+}
+
+func compactBranch(
+	gitopsRepoDeployKeyPath string,
+	gitopsRepoCache *nativeGit.GitopsRepoCache,
+	branch string,
+	compactionRequest dx.CompactionRequest,
+	log *logrus.Entry,
+) error {
+	repo, repoTmpPath, err := gitopsRepoCache.BranchInstanceForWrite(branch)
+	defer nativeGit.TmpFsCleanup(repoTmpPath)
+	if err != nil {
+		return err
+	}
+
+	compacted, err := compactHistory(repo, compactionRequest, log)
+	if err != nil || !compacted {
+		return err
+	}
+
+	head, _ := repo.Head()
+	gitopsRepoCache.ExpectRewrite(branch, head.Hash().String())
+	err = nativeGit.NativeForcePush(repoTmpPath, gitopsRepoDeployKeyPath, head.Name().Short())
+	if err != nil {
+		return err
+	}
+
+	return gitopsRepoCache.RecloneBranch(branch)
+}
+
+// compactHistory squashes the gitops history of the requested app folders that is older than the requested time.
+// Only the commits that change nothing else are squashed, the history of the other apps is kept
+func compactHistory(repo *git.Repository, compactionRequest dx.CompactionRequest, log *logrus.Entry) (bool, error) {
+	before := time.Unix(compactionRequest.Before, 0)
+	folder := filepath.Join(compactionRequest.Env, compactionRequest.App)
+	app, err := glob.Compile(compactionRequest.App)
+	if err != nil {
+		return false, fmt.Errorf("invalid app pattern %s: %s", compactionRequest.App, err)
+	}
+	inAppFolder := func(file string) bool {
+		parts := strings.Split(file, "/")
+		if parts[0] == dx.ShadowFolder {
+			parts = parts[1:]
+		}
+		if len(parts) < 3 || parts[0] != compactionRequest.Env {
+			return false
+		}
+		return app.Match(parts[1])
+	}
+
+	message := fmt.Sprintf("[GimletD compact] history of %s before %s squashed by %s", folder, before.Format(time.RFC3339), compactionRequest.TriggeredBy)
+	compacted, err := nativeGit.SquashFolderHistory(repo, before, inAppFolder, message)
+	if err != nil {
+		return false, errors.WithMessage(err, "could not squash history")
+	}
+	if !compacted {
+		log.Infof("no history of %s to compact before %s", folder, before.Format(time.RFC3339))
+	}
+	return compacted, nil
+}
+
 func shasSince(repo *git.Repository, since string) ([]string, error) {
 	var hashes []string
 	commitWalker, err := repo.Log(&git.LogOptions{})
@@ -385,11 +976,19 @@ func shasSince(repo *git.Repository, since string) ([]string, error) {
 
 func processArtifactEvent(
 	gitopsRepo string,
-	gitopsRepoCache *nativeGit.GitopsRepoCache,
-	gitopsRepoDeployKeyPath string,
+	batch *gitopsBatch,
 	githubChartAccessToken string,
 	event *model.Event,
 	dao *store.Store,
+	rollbackProtection time.Duration,
+	deployHooks *hooks.DeployHooks,
+	chartCache *helm.ChartCache,
+	platformConfig *nativeGit.PlatformConfig,
+	imageScanner *scanner.Scanner,
+	manifestValidator *validation.Validator,
+	signedArtifactEnvs []string,
+	envs map[string]*dx.Env,
+	log *logrus.Entry,
 ) ([]*events.DeployEvent, error) {
 	var gitopsEvents []*events.DeployEvent
 	artifact, err := model.ToArtifact(event)
@@ -398,36 +997,328 @@ func processArtifactEvent(
 	}
 
 	if artifact.HasCleanupPolicy() {
-		keepReposWithCleanupPolicyUpToDate(dao, artifact)
+		keepReposWithCleanupPolicyUpToDate(dao, artifact, log)
+	}
+
+	return deployByPolicy(
+		gitopsRepo,
+		batch,
+		githubChartAccessToken,
+		artifact,
+		nil,
+		event.CorrelationID,
+		dao,
+		rollbackProtection,
+		false,
+		deployHooks,
+		chartCache,
+		platformConfig,
+		imageScanner,
+		manifestValidator,
+		signedArtifactEnvs,
+		envs,
+		log,
+	)
+}
+
+// processReevaluationEvent re-runs the deploy policies of a stored artifact,
+// and deploys it to the apps in envs that match now, but the artifact did not deploy to before
+func processReevaluationEvent(
+	gitopsRepo string,
+	batch *gitopsBatch,
+	githubChartAccessToken string,
+	event *model.Event,
+	dao *store.Store,
+	rollbackProtection time.Duration,
+	deployHooks *hooks.DeployHooks,
+	chartCache *helm.ChartCache,
+	platformConfig *nativeGit.PlatformConfig,
+	imageScanner *scanner.Scanner,
+	manifestValidator *validation.Validator,
+	signedArtifactEnvs []string,
+	envs map[string]*dx.Env,
+	log *logrus.Entry,
+) ([]*events.DeployEvent, error) {
+	var gitopsEvents []*events.DeployEvent
+	var reevaluationRequest dx.ReevaluationRequest
+	err := json.Unmarshal([]byte(event.Blob), &reevaluationRequest)
+	if err != nil {
+		return gitopsEvents, fmt.Errorf("cannot parse reevaluation request with id: %s", event.ID)
+	}
+
+	artifactEvent, err := dao.Artifact(reevaluationRequest.ArtifactID)
+	if err != nil {
+		return gitopsEvents, fmt.Errorf("cannot find artifact with id: %s", reevaluationRequest.ArtifactID)
+	}
+	if artifactEvent.Expired != 0 {
+		return gitopsEvents, fmt.Errorf("artifact %s is expired, its images may no longer exist", reevaluationRequest.ArtifactID)
+	}
+	artifact, err := model.ToArtifact(artifactEvent)
+	if err != nil {
+		return gitopsEvents, fmt.Errorf("cannot parse artifact %s", err.Error())
+	}
+
+	deployed, err := deployedApps(dao, artifactEvent.Repository, artifact.ID)
+	if err != nil {
+		return gitopsEvents, err
+	}
+
+	return deployByPolicy(
+		gitopsRepo,
+		batch,
+		githubChartAccessToken,
+		artifact,
+		deployed,
+		event.CorrelationID,
+		dao,
+		rollbackProtection,
+		reevaluationRequest.Force,
+		deployHooks,
+		chartCache,
+		platformConfig,
+		imageScanner,
+		manifestValidator,
+		signedArtifactEnvs,
+		envs,
+		log,
+	)
+}
+
+// deployedApps returns the env/app pairs that the artifact was successfully deployed to, by policy or by releases
+func deployedApps(dao *store.Store, repo string, artifactID string) (map[string]bool, error) {
+	repositoryEvents, err := dao.RepositoryEvents(repo)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the events of %s: %s", repo, err)
+	}
+
+	deployed := map[string]bool{}
+	for _, event := range repositoryEvents {
+		eventArtifactID := event.ArtifactID
+		if event.Type != model.TypeArtifact {
+			var releaseRequest dx.ReleaseRequest // reevaluation requests have the same artifactId field
+			if err := json.Unmarshal([]byte(event.Blob), &releaseRequest); err != nil {
+				continue
+			}
+			eventArtifactID = releaseRequest.ArtifactID
+		}
+		if eventArtifactID != artifactID {
+			continue
+		}
+
+		for _, envStatus := range event.EnvStatuses {
+			if envStatus.Status == dx.EnvStatusSuccess || envStatus.Status == dx.EnvStatusChecking {
+				deployed[envStatus.Env+"/"+envStatus.App] = true
+			}
+		}
+	}
+	return deployed, nil
+}
+
+// deployByPolicy deploys the artifact to the envs whose deploy policy it matches, skipping the already deployed env/app pairs.
+// Deploys of recently rolled back apps are parked, unless forced
+func deployByPolicy(
+	gitopsRepo string,
+	batch *gitopsBatch,
+	githubChartAccessToken string,
+	artifact *dx.Artifact,
+	deployed map[string]bool,
+	correlationID string,
+	dao *store.Store,
+	rollbackProtection time.Duration,
+	force bool,
+	deployHooks *hooks.DeployHooks,
+	chartCache *helm.ChartCache,
+	platformConfig *nativeGit.PlatformConfig,
+	imageScanner *scanner.Scanner,
+	manifestValidator *validation.Validator,
+	signedArtifactEnvs []string,
+	envs map[string]*dx.Env,
+	log *logrus.Entry,
+) ([]*events.DeployEvent, error) {
+	var gitopsEvents []*events.DeployEvent
+	manifests, err := dx.ExpandVariants(artifact.Environments)
+	if err != nil {
+		return gitopsEvents, err
+	}
+	manifests, err = dx.OrderByDependencies(manifests)
+	if err != nil {
+		return gitopsEvents, err
 	}
+	var deployErrors []string
+	for _, env := range manifests {
+		deployPolicy := dx.DeployPolicy(envs, env)
+		if !deployTrigger(artifact, deployPolicy) {
+			continue
+		}
+		if err := env.ResolveVars(artifact.Vars()); err != nil {
+			gitopsEvents = append(gitopsEvents, &events.DeployEvent{
+				Manifest:    env,
+				Artifact:    artifact,
+				TriggeredBy: "policy",
+				Status:      events.Failure,
+				StatusDesc:  fmt.Sprintf("cannot resolve manifest vars: %s", err),
+				GitopsRepo:  gitopsRepo,
+			})
+			deployErrors = append(deployErrors, fmt.Sprintf("%s/%s: cannot resolve manifest vars: %s", env.Env, env.App, err))
+			continue
+		}
+
+		// the deployed apps are keyed by their resolved names
+		if deployed[env.Env+"/"+env.App] {
+			continue
+		}
+		envLog := log.WithFields(logrus.Fields{"app": env.App, "env": env.Env})
+
+		if missing := deployPolicy.MissingItems(artifact); len(missing) > 0 {
+			gitopsEvents = append(gitopsEvents, &events.DeployEvent{
+				Manifest:    env,
+				Artifact:    artifact,
+				TriggeredBy: "policy",
+				Status:      events.Parked,
+				StatusDesc:  fmt.Sprintf("deploy to %s is parked, missing required items: %s", env.Env, strings.Join(missing, "; ")),
+				GitopsRepo:  gitopsRepo,
+			})
+			continue
+		}
 
-	for _, env := range artifact.Environments {
-		if !deployTrigger(artifact, env.Deploy) {
+		if err := checkSignature(artifact, env.Env, signedArtifactEnvs); err != nil {
+			envLog.Warn(err.Error())
+			gitopsEvents = append(gitopsEvents, &events.DeployEvent{
+				Manifest:    env,
+				Artifact:    artifact,
+				TriggeredBy: "policy",
+				Status:      events.Failure,
+				StatusDesc:  err.Error(),
+				GitopsRepo:  gitopsRepo,
+			})
 			continue
 		}
 
-		gitopsEvent, err := cloneTemplateWriteAndPush(
+		if f := frozen(dao, env, envLog); f != nil {
+			gitopsEvents = append(gitopsEvents, &events.DeployEvent{
+				Manifest:    env,
+				Artifact:    artifact,
+				TriggeredBy: "policy",
+				Status:      events.Parked,
+				StatusDesc:  frozenDesc(env, f),
+				GitopsRepo:  gitopsRepo,
+			})
+			continue
+		}
+
+		if remaining := rollbackProtectionRemaining(dao, env.Env, env.App, rollbackProtection, envLog); remaining > 0 && !force {
+			gitopsEvents = append(gitopsEvents, &events.DeployEvent{
+				Manifest:    env,
+				Artifact:    artifact,
+				TriggeredBy: "policy",
+				Status:      events.Parked,
+				StatusDesc: fmt.Sprintf(
+					"deploy of %s to %s is parked, it was rolled back within the last %s, the protection ends in %s. Reevaluate the artifact with force to deploy it now",
+					env.App, env.Env, rollbackProtection, remaining.Round(time.Second),
+				),
+				GitopsRepo: gitopsRepo,
+			})
+			continue
+		}
+
+		if err := dependenciesReady(dao, batch, env, gitopsEvents, envs, envLog); err != nil {
+			gitopsEvents = append(gitopsEvents, &events.DeployEvent{
+				Manifest:    env,
+				Artifact:    artifact,
+				TriggeredBy: "policy",
+				Status:      events.Failure,
+				StatusDesc:  err.Error(),
+				GitopsRepo:  gitopsRepo,
+			})
+			deployErrors = append(deployErrors, fmt.Sprintf("%s/%s: %s", env.Env, env.App, err))
+			continue
+		}
+
+		gitopsEvent, err := templateAndCommit(
+			batch,
 			gitopsRepo,
-			gitopsRepoCache,
-			gitopsRepoDeployKeyPath,
 			githubChartAccessToken,
 			artifact,
 			env,
 			"policy",
+			correlationID,
+			deployHooks,
+			chartCache,
+			platformConfig,
+			imageScanner,
+			manifestValidator,
+			envs,
+			envLog,
 		)
 		gitopsEvents = append(gitopsEvents, gitopsEvent)
 		if err != nil {
-			return gitopsEvents, err
+			// a failed env doesn't block the deploys to the other envs
+			deployErrors = append(deployErrors, fmt.Sprintf("%s/%s: %s", env.Env, env.App, err))
+			continue
 		}
+		keepImageUpdatePoliciesUpToDate(dao, env, artifact, envLog)
 	}
 
+	if len(deployErrors) > 0 {
+		return gitopsEvents, fmt.Errorf("deploy failed in %s", strings.Join(deployErrors, "; "))
+	}
 	return gitopsEvents, nil
 }
 
-func keepReposWithCleanupPolicyUpToDate(dao *store.Store, artifact *dx.Artifact) {
+// checkSignature refuses artifacts without a verified signature in the protected envs
+func checkSignature(artifact *dx.Artifact, env string, signedArtifactEnvs []string) error {
+	for _, protectedEnv := range signedArtifactEnvs {
+		if protectedEnv != env {
+			continue
+		}
+		if artifact.SignatureStatus != dx.SignatureVerified {
+			status := artifact.SignatureStatus
+			if status == "" {
+				status = dx.SignatureUnsigned
+			}
+			return fmt.Errorf("%s only accepts artifacts with a verified signature, the signature of %s is %s", env, artifact.ID, status)
+		}
+	}
+	return nil
+}
+
+// rollbackProtected tells if policy based deploys are blocked for an app in an env due to a recent rollback
+func rollbackProtected(dao *store.Store, env string, app string, rollbackProtection time.Duration, log *logrus.Entry) bool {
+	return rollbackProtectionRemaining(dao, env, app, rollbackProtection, log) > 0
+}
+
+// rollbackProtectionRemaining returns how long policy based deploys are still blocked for an app in an env due to a recent rollback
+func rollbackProtectionRemaining(dao *store.Store, env string, app string, rollbackProtection time.Duration, log *logrus.Entry) time.Duration {
+	if rollbackProtection == 0 {
+		return 0
+	}
+
+	lastRollback, err := dao.LastRollback(env, app)
+	if err == sql.ErrNoRows {
+		return 0
+	} else if err != nil {
+		log.Warnf("could not load last rollback of %s in %s: %s", app, env, err)
+		return 0
+	}
+
+	remaining := rollbackProtection - time.Since(lastRollback)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+func recordRollback(dao *store.Store, rollbackRequest *dx.RollbackRequest, log *logrus.Entry) {
+	err := dao.SaveLastRollback(rollbackRequest.Env, rollbackRequest.App, time.Now())
+	if err != nil {
+		log.Warnf("could not record rollback of %s in %s: %s", rollbackRequest.App, rollbackRequest.Env, err)
+	}
+}
+
+func keepReposWithCleanupPolicyUpToDate(dao *store.Store, artifact *dx.Artifact, log *logrus.Entry) {
 	reposWithCleanupPolicy, err := dao.ReposWithCleanupPolicy()
 	if err != nil && err != sql.ErrNoRows {
-		logrus.Warnf("could not load repos with cleanup policy: %s", err)
+		log.Warnf("could not load repos with cleanup policy: %s", err)
 	}
 
 	repoIsNew := true
@@ -441,44 +1332,67 @@ func keepReposWithCleanupPolicyUpToDate(dao *store.Store, artifact *dx.Artifact)
 		reposWithCleanupPolicy = append(reposWithCleanupPolicy, artifact.Version.RepositoryName)
 		err = dao.SaveReposWithCleanupPolicy(reposWithCleanupPolicy)
 		if err != nil {
-			logrus.Warnf("could not update repos with cleanup policy: %s", err)
+			log.Warnf("could not update repos with cleanup policy: %s", err)
 		}
 	}
 }
 
-func cloneTemplateWriteAndPush(
+// templateAndCommit renders the manifest and commits it to the batch, the commit is pushed with the batch
+func templateAndCommit(
+	batch *gitopsBatch,
 	gitopsRepo string,
-	gitopsRepoCache *nativeGit.GitopsRepoCache,
-	gitopsRepoDeployKeyPath string,
 	githubChartAccessToken string,
 	artifact *dx.Artifact,
 	env *dx.Manifest,
 	triggeredBy string,
+	correlationID string,
+	deployHooks *hooks.DeployHooks,
+	chartCache *helm.ChartCache,
+	platformConfig *nativeGit.PlatformConfig,
+	imageScanner *scanner.Scanner,
+	manifestValidator *validation.Validator,
+	envs map[string]*dx.Env,
+	log *logrus.Entry,
 ) (*events.DeployEvent, error) {
+	log.Infof("deploying %s, triggered by %s", artifact.ID, triggeredBy)
 	gitopsEvent := &events.DeployEvent{
-		Manifest:    env,
-		Artifact:    artifact,
-		TriggeredBy: triggeredBy,
-		Status:      events.Success,
-		GitopsRepo:  gitopsRepo,
+		Manifest:      env,
+		Artifact:      artifact,
+		TriggeredBy:   triggeredBy,
+		Status:        events.Success,
+		GitopsRepo:    gitopsRepo,
+		CorrelationID: correlationID,
 	}
 
-	repo, repoTmpPath, err := gitopsRepoCache.InstanceForWrite()
-	defer nativeGit.TmpFsCleanup(repoTmpPath)
+	branch := dx.GitopsBranch(envs, env.Env)
+	repo, err := batch.repository(branch)
 	if err != nil {
 		gitopsEvent.Status = events.Failure
 		gitopsEvent.StatusDesc = err.Error()
 		return gitopsEvent, err
 	}
 
-	err = env.ResolveVars(artifact.Vars())
+	err = resolveManifest(env, artifact, platformConfig, envs)
 	if err != nil {
-		err = fmt.Errorf("cannot resolve manifest vars %s", err.Error())
 		gitopsEvent.Status = events.Failure
 		gitopsEvent.StatusDesc = err.Error()
 		return gitopsEvent, err
 	}
 
+	if policy := vulnerabilityPolicy(envs, env.Env); policy != nil {
+		err = vulnerabilityGate(imageScanner, env, policy, log)
+		if err != nil {
+			gitopsEvent.StatusDesc = err.Error()
+			if policy.Park {
+				log.Info(err.Error())
+				gitopsEvent.Status = events.Parked
+				return gitopsEvent, nil
+			}
+			gitopsEvent.Status = events.Failure
+			return gitopsEvent, err
+		}
+	}
+
 	releaseMeta := &dx.Release{
 		App:         env.App,
 		Env:         env.Env,
@@ -487,34 +1401,49 @@ func cloneTemplateWriteAndPush(
 		TriggeredBy: triggeredBy,
 	}
 
-	sha, err := gitopsTemplateAndWrite(
+	if !env.Shadow { // shadow deploys don't reach the clusters, the deploy hooks are not called
+		err = deployHooks.PreCommit(&hooks.Payload{
+			Env:           env.Env,
+			App:           env.App,
+			ArtifactID:    artifact.ID,
+			TriggeredBy:   triggeredBy,
+			Version:       &artifact.Version,
+			GitopsRepo:    gitopsRepo,
+			CorrelationID: correlationID,
+		})
+		if err != nil {
+			gitopsEvent.Status = events.Failure
+			gitopsEvent.StatusDesc = err.Error()
+			return gitopsEvent, err
+		}
+	}
+
+	sha, manifestDiff, err := gitopsTemplateAndWrite(
 		repo,
 		env,
 		releaseMeta,
 		githubChartAccessToken,
+		chartCache,
+		manifestValidator,
+		manifestValidationPolicy(envs, env.Env),
+		correlationID,
+		log,
 	)
 	if err != nil {
+		log.Errorf("deploy failed: %s", err)
+		batch.discardChanges(branch)
 		gitopsEvent.Status = events.Failure
 		gitopsEvent.StatusDesc = err.Error()
 		return gitopsEvent, err
 	}
 
 	if sha != "" { // if there is a change to push
-		head, _ := repo.Head()
-
-		operation := func() error {
-			return nativeGit.NativePush(repoTmpPath, gitopsRepoDeployKeyPath, head.Name().Short())
-		}
-		backoffStrategy := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 5)
-		err := backoff.Retry(operation, backoffStrategy)
-		if err != nil {
-			gitopsEvent.Status = events.Failure
-			gitopsEvent.StatusDesc = err.Error()
-			return gitopsEvent, err
-		}
-		gitopsRepoCache.Invalidate()
-
+		log.Infof("committed %s: %s", sha, manifestDiff.Summary())
 		gitopsEvent.GitopsRef = sha
+		gitopsEvent.Diff = manifestDiff
+		batch.committed(branch, gitopsEvent)
+	} else {
+		log.Info("nothing to commit, the gitops repo is up to date")
 	}
 
 	return gitopsEvent, nil
@@ -523,12 +1452,13 @@ func cloneTemplateWriteAndPush(
 func cloneTemplateDeleteAndPush(
 	gitopsRepoCache *nativeGit.GitopsRepoCache,
 	gitopsRepoDeployKeyPath string,
+	cleanupArchive *CleanupArchive,
 	cleanupPolicy *dx.Cleanup,
 	env string,
 	triggeredBy string,
 	gitopsEvent *events.DeleteEvent,
 ) (*events.DeleteEvent, error) {
-	repo, repoTmpPath, err := gitopsRepoCache.InstanceForWrite()
+	repo, repoTmpPath, err := gitopsRepoCache.EnvInstanceForWrite(env)
 	defer nativeGit.TmpFsCleanup(repoTmpPath)
 	if err != nil {
 		gitopsEvent.Status = events.Failure
@@ -536,11 +1466,30 @@ func cloneTemplateDeleteAndPush(
 		return gitopsEvent, err
 	}
 
-	err = nativeGit.DelDir(repo, filepath.Join(env, cleanupPolicy.AppToCleanup))
-	if err != nil {
-		gitopsEvent.Status = events.Failure
-		gitopsEvent.StatusDesc = err.Error()
-		return gitopsEvent, err
+	if cleanupArchive != nil {
+		var deployed []string
+		for _, app := range cleanupPolicy.Apps() {
+			if _, err := os.Stat(filepath.Join(repoTmpPath, env, app)); err == nil {
+				deployed = append(deployed, app)
+			}
+		}
+		err = cleanupArchive.archive(repo, repoTmpPath, gitopsRepoDeployKeyPath, env, deployed)
+		if err != nil {
+			gitopsEvent.Status = events.Failure
+			gitopsEvent.StatusDesc = err.Error()
+			return gitopsEvent, err
+		}
+	}
+
+	var deleted []string
+	for _, app := range cleanupPolicy.Apps() {
+		err = nativeGit.DelDir(repo, filepath.Join(env, app))
+		if err != nil {
+			gitopsEvent.Status = events.Failure
+			gitopsEvent.StatusDesc = err.Error()
+			return gitopsEvent, err
+		}
+		deleted = append(deleted, env+"/"+app)
 	}
 
 	empty, err := nativeGit.NothingToCommit(repo)
@@ -553,8 +1502,8 @@ func cloneTemplateDeleteAndPush(
 		return nil, nil
 	}
 
-	gitMessage := fmt.Sprintf("[GimletD delete] %s/%s deleted by %s", env, cleanupPolicy.AppToCleanup, triggeredBy)
-	sha, err := nativeGit.Commit(repo, gitMessage)
+	gitMessage := fmt.Sprintf("[GimletD delete] %s deleted by %s", strings.Join(deleted, ", "), triggeredBy)
+	sha, err := nativeGit.Commit(repo, nativeGit.WithCorrelationTrailer(gitMessage, gitopsEvent.CorrelationID))
 
 	if sha != "" { // if there is a change to push
 		err = nativeGit.Push(repo, gitopsRepoDeployKeyPath)
@@ -563,7 +1512,7 @@ func cloneTemplateDeleteAndPush(
 			gitopsEvent.StatusDesc = err.Error()
 			return gitopsEvent, err
 		}
-		gitopsRepoCache.Invalidate()
+		gitopsRepoCache.InvalidateBranch(gitopsRepoCache.Branch(env))
 
 		gitopsEvent.GitopsRef = sha
 	}
@@ -571,7 +1520,9 @@ func cloneTemplateDeleteAndPush(
 	return gitopsEvent, nil
 }
 
-func revertTo(env string, app string, repo *git.Repository, repoTmpPath string, sha string) error {
+// revertTo reverts the commits of the app in the env since the given sha.
+// Without force, it refuses to revert commits that were not made by GimletD, so a rollback doesn't clobber a manual hotfix
+func revertTo(env string, app string, repo *git.Repository, repoTmpPath string, sha string, force bool, log *logrus.Entry) error {
 	path := fmt.Sprintf("%s/%s", env, app)
 	commits, err := repo.Log(&git.LogOptions{})
 	if err != nil {
@@ -594,10 +1545,23 @@ func revertTo(env string, app string, repo *git.Repository, repoTmpPath string,
 		return err
 	}
 
+	var manualCommits []string
+	for _, commit := range commitsToRevert {
+		if !nativeGit.GimletdCommit(commit) {
+			manualCommits = append(manualCommits, fmt.Sprintf("%s by %s", commit.Hash.String()[:8], commit.Author.Email))
+		}
+	}
+	if len(manualCommits) > 0 {
+		if !force {
+			return fmt.Errorf("the rollback would revert commits that were not made by GimletD: %s. Roll back with force to revert them", strings.Join(manualCommits, ", "))
+		}
+		log.Warnf("force reverting commits that were not made by GimletD: %s", strings.Join(manualCommits, ", "))
+	}
+
 	for _, commit := range commitsToRevert {
 		hasBeenReverted, err := nativeGit.HasBeenReverted(repo, commit, env, app)
 		if !hasBeenReverted {
-			logrus.Infof("reverting %s", commit.Hash.String())
+			log.Infof("reverting %s", commit.Hash.String())
 			err = nativeGit.NativeRevert(repoTmpPath, commit.Hash.String())
 			if err != nil {
 				return errors.WithMessage(err, "could not revert")
@@ -612,7 +1576,46 @@ func updateEvent(store *store.Store, event *model.Event) error {
 	if err != nil {
 		return err
 	}
-	return store.UpdateEventStatus(event.ID, event.Status, event.StatusDesc, string(gitopsHashesString))
+	triggeredEnvsString, err := json.Marshal(event.TriggeredEnvs)
+	if err != nil {
+		return err
+	}
+	envStatusesString, err := json.Marshal(event.EnvStatuses)
+	if err != nil {
+		return err
+	}
+	return store.UpdateEventStatus(event.ID, event.Status, event.StatusDesc, string(gitopsHashesString), string(triggeredEnvsString), string(envStatusesString))
+}
+
+// resolveManifest applies the env defaults and the platform overrides to the manifest,
+// then resolves its vars and patches with the artifact, and seals its secrets
+func resolveManifest(
+	env *dx.Manifest,
+	artifact *dx.Artifact,
+	platformConfig *nativeGit.PlatformConfig,
+	envs map[string]*dx.Env,
+) error {
+	err := env.ApplyValuesFiles()
+	if err != nil {
+		return err
+	}
+	env.ApplyEnvDefaults(envs[env.Env])
+	if platformConfig != nil {
+		overrides, err := platformConfig.Values(env.Env)
+		if err != nil {
+			return err
+		}
+		env.ApplyPlatformOverrides(overrides)
+	}
+	err = env.ResolveVars(artifact.Vars())
+	if err != nil {
+		return fmt.Errorf("cannot resolve manifest vars %s", err.Error())
+	}
+	err = env.ResolvePatches(artifact.Vars(), envs[env.Env])
+	if err != nil {
+		return err
+	}
+	return env.SealSecrets(envs[env.Env])
 }
 
 func gitopsTemplateAndWrite(
@@ -620,48 +1623,99 @@ func gitopsTemplateAndWrite(
 	env *dx.Manifest,
 	release *dx.Release,
 	tokenForChartClone string,
-) (string, error) {
+	chartCache *helm.ChartCache,
+	manifestValidator *validation.Validator,
+	validationPolicy *dx.ManifestValidation,
+	correlationID string,
+	log *logrus.Entry,
+) (string, *dx.ManifestDiff, error) {
+	files, err := renderManifest(env, tokenForChartClone, chartCache, log)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if validationPolicy != nil {
+		err = validateManifests(manifestValidator, env, files, validationPolicy, log)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	releaseString, err := json.Marshal(release)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot marshal release meta data %s", err.Error())
+	}
+
+	manifestDiff := diffManifests(repo, env, files)
+
+	message := "automated deploy"
+	if env.Shadow {
+		message = "automated shadow deploy"
+	}
+	message = nativeGit.WithReleaseTrailers(message, release)
+	message = nativeGit.WithCorrelationTrailer(message, correlationID)
+	sha, err := nativeGit.CommitFilesToGit(repo, files, env.GitopsFolder(), env.App, message, string(releaseString))
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot write to git: %s", err.Error())
+	}
+
+	return sha, manifestDiff, nil
+}
+
+// renderManifest fetches the git hosted chart of the resolved manifest, and renders it to the files of the gitops repo
+func renderManifest(
+	env *dx.Manifest,
+	tokenForChartClone string,
+	chartCache *helm.ChartCache,
+	log *logrus.Entry,
+) (map[string]string, error) {
 	if strings.HasPrefix(env.Chart.Name, "git@") {
-		return "", fmt.Errorf("only HTTPS git repo urls supported in GimletD for git based charts")
+		return nil, fmt.Errorf("only HTTPS git repo urls supported in GimletD for git based charts")
 	}
 	if strings.Contains(env.Chart.Name, ".git") {
 		t0 := time.Now().UnixNano()
-		tmpChartDir, err := helm.CloneChartFromRepo(*env, tokenForChartClone)
+		tmpChartDir, err := chartCache.Chart(*env, tokenForChartClone)
 		if err != nil {
-			return "", fmt.Errorf("cannot fetch chart from git %s", err.Error())
+			return nil, fmt.Errorf("cannot fetch chart from git %s", err.Error())
 		}
-		logrus.Infof("Cloning chart took %d", (time.Now().UnixNano()-t0)/1000/1000)
+		log.Infof("Getting chart took %d", (time.Now().UnixNano()-t0)/1000/1000)
 		env.Chart.Name = tmpChartDir
 		defer os.RemoveAll(tmpChartDir)
+
+		err = helm.BuildDependencies(tmpChartDir)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	t0 := time.Now().UnixNano()
-	templatedManifests, err := helm.HelmTemplate(*env)
+	files, err := dx.Template(env)
 	if err != nil {
-		return "", fmt.Errorf("cannot run helm template %s", err.Error())
-	}
-	logrus.Infof("Helm template took %d", (time.Now().UnixNano()-t0)/1000/1000)
-
-	if env.StrategicMergePatches != "" {
-		templatedManifests, err = kustomize.ApplyPatches(env.StrategicMergePatches, templatedManifests)
-		if err != nil {
-			return "", fmt.Errorf("cannot apply Kustomize patches to chart %s", err.Error())
-		}
+		return nil, err
 	}
+	log.Infof("Helm template took %d", (time.Now().UnixNano()-t0)/1000/1000)
 
-	files := helm.SplitHelmOutput(map[string]string{"manifest.yaml": templatedManifests})
+	return files, nil
+}
 
-	releaseString, err := json.Marshal(release)
+// diffManifests compares the files of the app in the gitops repo with the ones about to be written.
+// The release meta data changes with every deploy, it is left out
+func diffManifests(repo *git.Repository, env *dx.Manifest, files map[string]string) *dx.ManifestDiff {
+	previous, err := nativeGit.Folder(repo, filepath.Join(env.GitopsFolder(), env.App))
 	if err != nil {
-		return "", fmt.Errorf("cannot marshal release meta data %s", err.Error())
+		previous = map[string]string{}
 	}
+	delete(previous, "release.json")
 
-	sha, err := nativeGit.CommitFilesToGit(repo, files, env.Env, env.App, "automated deploy", string(releaseString))
-	if err != nil {
-		return "", fmt.Errorf("cannot write to git: %s", err.Error())
+	current := map[string]string{}
+	for path, content := range files {
+		if !strings.HasSuffix(content, "\n") {
+			content = content + "\n"
+		}
+		current[filepath.Base(path)] = content
 	}
 
-	return sha, nil
+	return dx.DiffManifests(previous, current)
 }
 
 func deployTrigger(artifactToCheck *dx.Artifact, deployPolicy *dx.Deploy) bool {
@@ -747,7 +1801,7 @@ func cleanupTrigger(branch string, cleanupPolicy *dx.Cleanup) bool {
 		return false
 	}
 
-	if cleanupPolicy.AppToCleanup == "" {
+	if len(cleanupPolicy.Apps()) == 0 {
 		return false
 	}
 
@@ -0,0 +1,205 @@
+package worker
+
+import (
+	"fmt"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/hooks"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/go-git/go-git/v5"
+)
+
+// gitopsBatch collects the deploy commits of a poll cycle in one writable copy of each gitops repo branch,
+// so they reach the remote in a single push per branch
+type gitopsBatch struct {
+	repoCache     *nativeGit.GitopsRepoCache
+	deployKeyPath string
+	deployHooks   *hooks.DeployHooks
+
+	branches map[string]*branchBatch
+	// pushed is the last pushed commit of each branch in the poll cycle
+	pushed map[string]string
+}
+
+// branchBatch is the writable copy of a gitops repo branch and the commits that wait to be pushed to it
+type branchBatch struct {
+	repo     *git.Repository
+	repoPath string
+	commits  []*events.DeployEvent // in commit order
+	// generation is the history generation of the gitops repo that the copy was made in
+	generation uint64
+}
+
+func newGitopsBatch(
+	repoCache *nativeGit.GitopsRepoCache,
+	deployKeyPath string,
+	deployHooks *hooks.DeployHooks,
+) *gitopsBatch {
+	return &gitopsBatch{
+		repoCache:     repoCache,
+		deployKeyPath: deployKeyPath,
+		deployHooks:   deployHooks,
+		branches:      map[string]*branchBatch{},
+		pushed:        map[string]string{},
+	}
+}
+
+// repository returns the writable copy of the gitops repo branch that the batch commits to
+func (b *gitopsBatch) repository(branch string) (*git.Repository, error) {
+	if batch, ok := b.branches[branch]; ok {
+		return batch.repo, nil
+	}
+
+	generation := b.repoCache.HistoryGeneration()
+	repo, repoPath, err := b.repoCache.BranchInstanceForWrite(branch)
+	if err != nil {
+		nativeGit.TmpFsCleanup(repoPath)
+		return nil, err
+	}
+	b.branches[branch] = &branchBatch{repo: repo, repoPath: repoPath, generation: generation}
+	return repo, nil
+}
+
+// committed records a deploy that is committed to the branch and waits for the push
+func (b *gitopsBatch) committed(branch string, gitopsEvent *events.DeployEvent) {
+	b.branches[branch].commits = append(b.branches[branch].commits, gitopsEvent)
+}
+
+// hasCommits tells if there are commits to push on any branch
+func (b *gitopsBatch) hasCommits() bool {
+	for _, batch := range b.branches {
+		if len(batch.commits) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCommitsOn tells if there are commits to push on the branch
+func (b *gitopsBatch) hasCommitsOn(branch string) bool {
+	batch, ok := b.branches[branch]
+	return ok && len(batch.commits) > 0
+}
+
+// discardChanges drops the uncommitted changes a failed deploy may have left in the worktree of the branch
+func (b *gitopsBatch) discardChanges(branch string) {
+	batch, ok := b.branches[branch]
+	if !ok {
+		return
+	}
+	head, err := batch.repo.Head()
+	if err != nil {
+		return
+	}
+	worktree, err := batch.repo.Worktree()
+	if err != nil {
+		return
+	}
+	worktree.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset})
+}
+
+// push pushes the batched commits of every branch, then updates the gitops refs of the deploys,
+// as rebasing on the remote may change the commit shas.
+// A failed push only fails the deploys of its branch.
+// The batch is empty afterwards, and can be reused in the next poll cycle
+func (b *gitopsBatch) push() error {
+	defer b.reset()
+
+	var pushErr error
+	for branch, batch := range b.branches {
+		err := b.pushBranch(branch, batch)
+		if err != nil {
+			pushErr = err
+		}
+	}
+	return pushErr
+}
+
+func (b *gitopsBatch) pushBranch(branch string, batch *branchBatch) error {
+	if len(batch.commits) == 0 {
+		return nil
+	}
+
+	head, err := batch.repo.Head()
+	if err == nil && b.repoCache.HistoryGeneration() != batch.generation {
+		// rebasing on the rewritten history could bring back commits that the rewrite removed
+		err = fmt.Errorf("the gitops repo history was rewritten during the deploy, the deploy must be retried")
+	} else if err == nil {
+		operation := func() error {
+			return nativeGit.NativePush(batch.repoPath, b.deployKeyPath, head.Name().Short())
+		}
+		backoffStrategy := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 5)
+		err = backoff.Retry(operation, backoffStrategy)
+	}
+	if err != nil {
+		for _, gitopsEvent := range batch.commits {
+			gitopsEvent.Status = events.Failure
+			gitopsEvent.StatusDesc = err.Error()
+			gitopsEvent.GitopsRef = ""
+		}
+		return err
+	}
+	b.repoCache.InvalidateBranch(branch)
+
+	shas, err := lastCommits(batch.repoPath, len(batch.commits))
+	if err != nil {
+		return fmt.Errorf("cannot read pushed commits: %s", err)
+	}
+	b.pushed[branch] = shas[len(shas)-1]
+	for i, gitopsEvent := range batch.commits {
+		gitopsEvent.GitopsRef = shas[i]
+		if gitopsEvent.Manifest.Shadow {
+			continue
+		}
+		b.deployHooks.PostPush(&hooks.Payload{
+			Env:           gitopsEvent.Manifest.Env,
+			App:           gitopsEvent.Manifest.App,
+			ArtifactID:    gitopsEvent.Artifact.ID,
+			TriggeredBy:   gitopsEvent.TriggeredBy,
+			Version:       &gitopsEvent.Artifact.Version,
+			GitopsRef:     gitopsEvent.GitopsRef,
+			GitopsRepo:    gitopsEvent.GitopsRepo,
+			CorrelationID: gitopsEvent.CorrelationID,
+		})
+	}
+	return nil
+}
+
+func (b *gitopsBatch) reset() {
+	for _, batch := range b.branches {
+		if batch.repoPath != "" {
+			nativeGit.TmpFsCleanup(batch.repoPath)
+		}
+	}
+	b.branches = map[string]*branchBatch{}
+}
+
+// lastCommits returns the shas of the last n commits on HEAD, oldest first
+func lastCommits(repoPath string, n int) ([]string, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	shas := make([]string, n)
+	for i := n - 1; i >= 0; i-- {
+		shas[i] = commit.Hash.String()
+		if i == 0 {
+			break
+		}
+		commit, err = commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return shas, nil
+}
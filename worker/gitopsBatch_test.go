@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_lastCommits(t *testing.T) {
+	path, _ := ioutil.TempDir("", "gitops-")
+	defer os.RemoveAll(path)
+
+	repo, _ := git.PlainInit(path, false)
+	initHistory(repo)
+
+	var SHAs []string
+	commits, _ := repo.Log(&git.LogOptions{})
+	commits.ForEach(func(c *object.Commit) error {
+		SHAs = append(SHAs, c.Hash.String())
+		return nil
+	})
+
+	lastTwo, err := lastCommits(path, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{SHAs[1], SHAs[0]}, lastTwo, "should be ordered oldest first")
+}
+
+func Test_batchDiscardChanges(t *testing.T) {
+	path, _ := ioutil.TempDir("", "gitops-")
+	defer os.RemoveAll(path)
+
+	repo, _ := git.PlainInit(path, false)
+	initHistory(repo)
+
+	batch := &gitopsBatch{branches: map[string]*branchBatch{"": {repo: repo, repoPath: path}}}
+	err := ioutil.WriteFile(filepath.Join(path, "staging", "my-app", "file"), []byte("half written"), 0644)
+	assert.Nil(t, err)
+
+	batch.discardChanges("")
+	empty, err := nativeGit.NothingToCommit(repo)
+	assert.Nil(t, err)
+	assert.True(t, empty, "a failed deploy should not leak into the next commit of the batch")
+}
+
+func Test_pushEmptyBatch(t *testing.T) {
+	batch := newGitopsBatch(nil, "", nil)
+	assert.Nil(t, batch.push(), "nothing to push without commits")
+}
+
+func Test_failedToPush(t *testing.T) {
+	pushed := &events.DeployEvent{GitopsRef: "abc"}
+	failed := &events.DeployEvent{GitopsRef: ""}
+	assert.False(t, failedToPush([]*events.DeployEvent{pushed}))
+	assert.True(t, failedToPush([]*events.DeployEvent{pushed, failed}), "should fail the event if a branch it deployed to failed to push")
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/git/customScm"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// CheckSource returns the aggregated state of the CI checks of a commit, and the failed checks, see customGithub.CommitChecks
+type CheckSource interface {
+	Checks(repo string, sha string) (string, string, error)
+}
+
+// GitopsChecksWorker decides the events that wait for the CI checks of the gitops repo on their pushed commits,
+// eg. kubeval or OPA pipelines. Deploys fail if their checks fail, or don't finish within the timeout
+type GitopsChecksWorker struct {
+	store                *store.Store
+	gitopsRepo           string
+	checks               CheckSource
+	notificationsManager notifications.Manager
+	timeout              time.Duration
+	interval             time.Duration
+}
+
+func NewGitopsChecksWorker(
+	store *store.Store,
+	gitopsRepo string,
+	checks CheckSource,
+	notificationsManager notifications.Manager,
+	timeout time.Duration,
+	interval time.Duration,
+) *GitopsChecksWorker {
+	return &GitopsChecksWorker{
+		store:                store,
+		gitopsRepo:           gitopsRepo,
+		checks:               checks,
+		notificationsManager: notificationsManager,
+		timeout:              timeout,
+		interval:             interval,
+	}
+}
+
+func (w *GitopsChecksWorker) Run() {
+	for {
+		events, err := w.store.CheckingEvents()
+		if err != nil {
+			logrus.Errorf("could not load the events that wait for gitops checks: %s", err)
+		}
+		for _, event := range events {
+			w.check(event)
+		}
+		time.Sleep(w.interval)
+	}
+}
+
+// check decides the deploys of the event whose gitops checks finished,
+// and the event itself once none of its deploys wait for checks
+func (w *GitopsChecksWorker) check(event *model.Event) {
+	log := logrus.WithField("eventId", event.ID)
+	timedOut := time.Since(time.Unix(event.ProcessingStarted, 0)) > w.timeout
+
+	decided := false
+	checking := false
+	for i := range event.EnvStatuses {
+		envStatus := &event.EnvStatuses[i]
+		if envStatus.Status != dx.EnvStatusChecking {
+			continue
+		}
+
+		state, failedChecks, err := w.checks.Checks(w.gitopsRepo, envStatus.GitopsRef)
+		if err != nil {
+			log.Warnf("could not get the gitops checks of %s: %s", envStatus.GitopsRef, err)
+			state = customScm.ChecksPending
+		}
+
+		switch {
+		case state == customScm.ChecksSuccess:
+			envStatus.Status = dx.EnvStatusSuccess
+		case state == customScm.ChecksFailure:
+			envStatus.Status = dx.EnvStatusFailure
+			envStatus.StatusDesc = fmt.Sprintf("gitops checks failed in %s/%s: %s", envStatus.Env, envStatus.App, failedChecks)
+		case timedOut:
+			envStatus.Status = dx.EnvStatusFailure
+			envStatus.StatusDesc = fmt.Sprintf("gitops checks did not finish in %s in %s/%s", w.timeout, envStatus.Env, envStatus.App)
+		default:
+			checking = true
+			continue
+		}
+		decided = true
+		w.notificationsManager.Broadcast(notifications.NewGitopsChecksMessage(w.gitopsRepo, event.Repository, event.SHA, *envStatus))
+	}
+	if !decided {
+		return
+	}
+
+	if !checking {
+		event.Status, event.StatusDesc = checksOutcome(event.EnvStatuses)
+		log.Infof("gitops checks are finished, event is %s", event.Status)
+	}
+	err := updateEvent(w.store, event)
+	if err != nil {
+		log.Warnf("could not update event status %v", err)
+		return
+	}
+	if !checking {
+		callArtifactCallbacks(w.store, event, log)
+	}
+}
+
+// awaitChecks marks the pushed deploys to wait for the gitops checks, and tells if there were any
+func awaitChecks(envStatuses []dx.EnvStatus) bool {
+	awaiting := false
+	for i := range envStatuses {
+		if envStatuses[i].Status == dx.EnvStatusSuccess && envStatuses[i].GitopsRef != "" {
+			envStatuses[i].Status = dx.EnvStatusChecking
+			awaiting = true
+		}
+	}
+	return awaiting
+}
+
+// checksOutcome returns the status of an event once the gitops checks of its deploys are decided
+func checksOutcome(envStatuses []dx.EnvStatus) (string, string) {
+	var failed []string
+	succeeded := false
+	for _, envStatus := range envStatuses {
+		switch envStatus.Status {
+		case dx.EnvStatusFailure:
+			failed = append(failed, envStatus.StatusDesc)
+		case dx.EnvStatusSuccess:
+			succeeded = true
+		}
+	}
+
+	if len(failed) == 0 {
+		return model.StatusProcessed, ""
+	}
+	if succeeded {
+		return model.StatusPartial, strings.Join(failed, "\n")
+	}
+	return model.StatusError, strings.Join(failed, "\n")
+}
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/git/customScm"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCheckSource struct {
+	states map[string]string
+}
+
+func (f *fakeCheckSource) Checks(repo string, sha string) (string, string, error) {
+	if state, ok := f.states[sha]; ok {
+		return state, "conftest", nil
+	}
+	return customScm.ChecksPending, "", nil
+}
+
+func Test_gitopsChecks(t *testing.T) {
+	s := store.NewTest()
+	artifact := dx.Artifact{ID: "my-app-123", Version: dx.Version{SHA: "ea9ab7cc"}}
+	event, _ := model.ToEvent(artifact)
+	event, err := s.CreateEvent(event)
+	assert.Nil(t, err)
+	s.MarkEventProcessing(event.ID)
+
+	gitopsEvents := []*events.DeployEvent{
+		{Manifest: &dx.Manifest{Env: "staging", App: "my-app"}, Artifact: &artifact, Status: events.Success, GitopsRef: "abc"},
+		{Manifest: &dx.Manifest{Env: "production", App: "my-app"}, Artifact: &artifact, Status: events.Success, GitopsRef: "def"},
+	}
+	finalizeEvent(s, notifications.NewDummyManager(), event, gitopsEvents, nil, true, newEventLog(event))
+
+	checking, err := s.CheckingEvents()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(checking), "should wait for the gitops checks")
+	assert.Equal(t, model.StatusChecking, checking[0].Status)
+	assert.Equal(t, dx.EnvStatusChecking, checking[0].EnvStatuses[0].Status)
+
+	checks := &fakeCheckSource{states: map[string]string{"abc": customScm.ChecksSuccess}}
+	w := NewGitopsChecksWorker(s, "my/gitops", checks, notifications.NewDummyManager(), time.Hour, time.Second)
+	w.check(checking[0])
+
+	stored, _ := s.Event(event.ID)
+	assert.Equal(t, model.StatusChecking, stored.Status, "should wait for the pending checks")
+	assert.Equal(t, dx.EnvStatusSuccess, stored.EnvStatuses[0].Status)
+	assert.Equal(t, dx.EnvStatusChecking, stored.EnvStatuses[1].Status)
+
+	checks.states["def"] = customScm.ChecksFailure
+	checking, _ = s.CheckingEvents()
+	w.check(checking[0])
+
+	stored, _ = s.Event(event.ID)
+	assert.Equal(t, model.StatusPartial, stored.Status)
+	assert.Equal(t, "gitops checks failed in production/my-app: conftest", stored.StatusDesc)
+	checking, _ = s.CheckingEvents()
+	assert.Equal(t, 0, len(checking))
+}
+
+func Test_gitopsChecksTimeout(t *testing.T) {
+	event := &model.Event{
+		ProcessingStarted: time.Now().Add(-2 * time.Hour).Unix(),
+		EnvStatuses: []dx.EnvStatus{
+			{Env: "staging", App: "my-app", Status: dx.EnvStatusChecking, GitopsRef: "abc"},
+		},
+	}
+	s := store.NewTest()
+	w := NewGitopsChecksWorker(s, "my/gitops", &fakeCheckSource{}, notifications.NewDummyManager(), time.Hour, time.Second)
+	w.check(event)
+
+	assert.Equal(t, model.StatusError, event.Status, "should fail the deploys whose checks don't finish in time")
+	assert.Contains(t, event.StatusDesc, "gitops checks did not finish")
+}
@@ -19,19 +19,28 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/gimlet-io/gimletd/worker/events"
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
 )
 
+var testLog = logrus.NewEntry(logrus.StandardLogger())
+
 func Test_gitopsTemplateAndWrite(t *testing.T) {
 	var a dx.Artifact
 	json.Unmarshal([]byte(`
@@ -96,7 +105,7 @@ func Test_gitopsTemplateAndWrite(t *testing.T) {
 	repo, _ := git.Init(memory.NewStorage(), memfs.New())
 	_, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{""}})
 
-	_, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "")
+	_, _, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "", nil, nil, nil, "", testLog)
 	assert.Nil(t, err)
 }
 
@@ -144,7 +153,7 @@ func Test_gitopsTemplateAndWrite_deleteStaleFiles(t *testing.T) {
 `
 
 	json.Unmarshal([]byte(withVolume), &a)
-	_, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "")
+	_, _, err = gitopsTemplateAndWrite(repo, a.Environments[0], &dx.Release{}, "", nil, nil, nil, "", testLog)
 	assert.Nil(t, err)
 
 	content, _ := nativeGit.Content(repo, "staging/my-app/deployment.yaml")
@@ -182,7 +191,7 @@ func Test_gitopsTemplateAndWrite_deleteStaleFiles(t *testing.T) {
 
 	var b dx.Artifact
 	err = json.Unmarshal([]byte(withoutVolume), &b)
-	_, err = gitopsTemplateAndWrite(repo, b.Environments[0], &dx.Release{}, "")
+	_, _, err = gitopsTemplateAndWrite(repo, b.Environments[0], &dx.Release{}, "", nil, nil, nil, "", testLog)
 	assert.Nil(t, err)
 
 	content, _ = nativeGit.Content(repo, "staging/my-app/pvc.yaml")
@@ -410,6 +419,8 @@ func Test_revertTo(t *testing.T) {
 		repo,
 		path,
 		SHAs[2],
+		false,
+		testLog,
 	)
 	assert.Nil(t, err)
 	content, _ := nativeGit.Content(repo, "staging/my-app/file")
@@ -429,6 +440,8 @@ func Test_revertTo(t *testing.T) {
 		repo,
 		path,
 		SHAs[4],
+		false,
+		testLog,
 	)
 	assert.Nil(t, err)
 	content, _ = nativeGit.Content(repo, "staging/my-app/file")
@@ -440,12 +453,49 @@ func Test_revertTo(t *testing.T) {
 		repo,
 		path,
 		SHAs[5],
+		false,
+		testLog,
 	)
 	assert.Nil(t, err)
 	content, _ = nativeGit.Content(repo, "staging/my-app/file")
 	assert.Equal(t, "0\n", content)
 }
 
+func Test_revertToManualCommit(t *testing.T) {
+	path, _ := ioutil.TempDir("", "gitops-")
+	defer os.RemoveAll(path)
+
+	repo, _ := git.PlainInit(path, false)
+	initHistory(repo)
+
+	err := ioutil.WriteFile(filepath.Join(path, "staging", "my-app", "file"), []byte("hotfix"), 0644)
+	assert.Nil(t, err)
+	worktree, _ := repo.Worktree()
+	worktree.Add("staging/my-app/file")
+	_, err = worktree.Commit("Manual hotfix", &git.CommitOptions{
+		Author: &object.Signature{Name: "Jane Doe", Email: "jane@example.com", When: time.Now()},
+	})
+	assert.Nil(t, err)
+
+	commits, _ := repo.Log(&git.LogOptions{})
+	var SHAs []string
+	commits.ForEach(func(c *object.Commit) error {
+		SHAs = append(SHAs, c.Hash.String())
+		return nil
+	})
+
+	err = revertTo("staging", "my-app", repo, path, SHAs[2], false, testLog)
+	assert.NotNil(t, err, "should not revert a manual commit without force")
+	assert.Contains(t, err.Error(), "jane@example.com")
+	content, _ := nativeGit.Content(repo, "staging/my-app/file")
+	assert.Equal(t, "hotfix", content)
+
+	err = revertTo("staging", "my-app", repo, path, SHAs[2], true, testLog)
+	assert.Nil(t, err)
+	content, _ = nativeGit.Content(repo, "staging/my-app/file")
+	assert.Equal(t, "2\n", content)
+}
+
 func initHistory(repo *git.Repository) {
 	sha, _ := nativeGit.CommitFilesToGit(
 		repo,
@@ -539,3 +589,391 @@ func Test_cleanupTrigger(t *testing.T) {
 	})
 	assert.False(t, triggered, "Should not trigger on missing app")
 }
+
+func Test_rollbackProtected(t *testing.T) {
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	assert.False(t, rollbackProtected(s, "staging", "my-app", 10*time.Minute, testLog), "Should not protect apps that were never rolled back")
+
+	err := s.SaveLastRollback("staging", "my-app", time.Now().Add(-5*time.Minute))
+	assert.Nil(t, err)
+
+	assert.True(t, rollbackProtected(s, "staging", "my-app", 10*time.Minute, testLog), "Should protect within the window")
+	assert.False(t, rollbackProtected(s, "staging", "my-app", 2*time.Minute, testLog), "Should not protect after the window")
+	assert.False(t, rollbackProtected(s, "staging", "my-app", 0, testLog), "Should not protect if the policy is disabled")
+	assert.False(t, rollbackProtected(s, "production", "my-app", 10*time.Minute, testLog), "Should not protect other envs")
+}
+
+func Test_compactHistory(t *testing.T) {
+	path, _ := ioutil.TempDir("", "gitops-")
+	defer os.RemoveAll(path)
+
+	repo, _ := git.PlainInit(path, false)
+	initHistory(repo)
+	for i, app := range []string{"my-app-pr-1", "my-app-pr-2", "other-app", "my-app-pr-1", "my-app-pr-2"} {
+		nativeGit.CommitFilesToGit(repo, map[string]string{"file": fmt.Sprint(i)}, "staging", app, "deploy "+app, "")
+	}
+	nativeGit.CommitFilesToGit(repo, map[string]string{"file": "production"}, "production", "my-app-pr-1", "deploy to production", "")
+	head, _ := repo.Head()
+	firstCommits := commitMessages(repo)[6:]
+
+	compacted, err := compactHistory(repo, dx.CompactionRequest{
+		Before:      time.Now().Add(-1 * time.Hour).Unix(),
+		Env:         "staging",
+		App:         "my-app-pr-*",
+		TriggeredBy: "admin",
+	}, testLog)
+	assert.Nil(t, err)
+	assert.False(t, compacted, "should not compact if there is no history before the given time")
+
+	compacted, err = compactHistory(repo, dx.CompactionRequest{
+		Before:      time.Now().Add(1 * time.Hour).Unix(),
+		Env:         "staging",
+		App:         "my-app-pr-*",
+		TriggeredBy: "admin",
+	}, testLog)
+	assert.Nil(t, err)
+	assert.True(t, compacted)
+
+	messages := commitMessages(repo)
+	assert.Equal(t, 8, len(messages), "should squash the runs of the preview app commits")
+	assert.Equal(t, "[Gimlet] production/my-app-pr-1 deploy to production", messages[0], "should keep the commits of other envs")
+	assert.Contains(t, messages[1], "[GimletD compact] history of staging/my-app-pr-*")
+	assert.Contains(t, messages[1], "2 commits squashed")
+	assert.Equal(t, "[Gimlet] staging/other-app deploy other-app", messages[2], "should keep the commits of other apps")
+	assert.Contains(t, messages[3], "[GimletD compact]")
+	assert.Equal(t, firstCommits, messages[4:], "should keep the earlier history")
+
+	newHead, _ := repo.Head()
+	assert.NotEqual(t, head.Hash(), newHead.Hash())
+	oldCommit, _ := repo.CommitObject(head.Hash())
+	newCommit, _ := repo.CommitObject(newHead.Hash())
+	assert.Equal(t, oldCommit.TreeHash, newCommit.TreeHash, "should keep the content")
+
+	compacted, err = compactHistory(repo, dx.CompactionRequest{
+		Before:      time.Now().Add(1 * time.Hour).Unix(),
+		Env:         "staging",
+		App:         "other-app",
+		TriggeredBy: "admin",
+	}, testLog)
+	assert.Nil(t, err)
+	assert.False(t, compacted, "should not squash single commits")
+}
+
+func commitMessages(repo *git.Repository) []string {
+	var messages []string
+	commits, _ := repo.Log(&git.LogOptions{})
+	commits.ForEach(func(c *object.Commit) error {
+		messages = append(messages, c.Message)
+		return nil
+	})
+	return messages
+}
+
+func Test_parkArtifactWithMissingItems(t *testing.T) {
+	artifact := dx.Artifact{
+		Version: dx.Version{Event: dx.Push, Branch: "main"},
+		Environments: []*dx.Manifest{
+			{
+				App: "my-app",
+				Env: "production",
+				Deploy: &dx.Deploy{
+					Branch:        "main",
+					Event:         dx.PushPtr(),
+					RequiredItems: []map[string]string{{"name": "security-scan", "result": "passed"}},
+				},
+			},
+		},
+	}
+	event, err := model.ToEvent(artifact)
+	assert.Nil(t, err)
+
+	gitopsEvents, err := processArtifactEvent("", nil, "", event, store.NewTest(), 0, nil, nil, nil, nil, nil, nil, nil, testLog)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(gitopsEvents))
+	assert.Equal(t, events.Parked, gitopsEvents[0].Status)
+	assert.Contains(t, parkedDeploys(gitopsEvents), "security-scan with result=passed")
+	assert.Empty(t, triggeredEnvs(gitopsEvents), "parked deploys are not triggered")
+}
+
+func Test_parkArtifactOfFrozenApp(t *testing.T) {
+	artifact := dx.Artifact{
+		Version: dx.Version{Event: dx.Push, Branch: "main"},
+		Environments: []*dx.Manifest{
+			{
+				App:    "my-app",
+				Env:    "production",
+				Deploy: &dx.Deploy{Branch: "main", Event: dx.PushPtr()},
+			},
+		},
+	}
+	event, err := model.ToEvent(artifact)
+	assert.Nil(t, err)
+
+	dao := store.NewTest()
+	err = dao.SaveFreezes([]*dx.Freeze{{Env: "production", App: "my-app", Reason: "black friday", FrozenBy: "laszlo"}})
+	assert.Nil(t, err)
+
+	gitopsEvents, err := processArtifactEvent("", nil, "", event, dao, 0, nil, nil, nil, nil, nil, nil, nil, testLog)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(gitopsEvents))
+	assert.Equal(t, events.Parked, gitopsEvents[0].Status)
+	assert.Contains(t, parkedDeploys(gitopsEvents), "frozen by laszlo: black friday")
+}
+
+func Test_parkArtifactOfFrozenTemplatedApp(t *testing.T) {
+	artifact := dx.Artifact{
+		Version: dx.Version{Event: dx.Push, Branch: "main"},
+		Environments: []*dx.Manifest{
+			{
+				App:    "my-app-{{ .GitBranch }}",
+				Env:    "production",
+				Deploy: &dx.Deploy{Branch: "main", Event: dx.PushPtr()},
+			},
+		},
+	}
+	event, err := model.ToEvent(artifact)
+	assert.Nil(t, err)
+
+	dao := store.NewTest()
+	err = dao.SaveFreezes([]*dx.Freeze{{Env: "production", App: "my-app-main", Reason: "black friday", FrozenBy: "laszlo"}})
+	assert.Nil(t, err)
+
+	gitopsEvents, err := processArtifactEvent("", nil, "", event, dao, 0, nil, nil, nil, nil, nil, nil, nil, testLog)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(gitopsEvents))
+	assert.Equal(t, events.Parked, gitopsEvents[0].Status, "should match the freeze with the resolved app name")
+	assert.Contains(t, parkedDeploys(gitopsEvents), "deploy of my-app-main to production is parked, it is frozen by laszlo")
+}
+
+func Test_reevaluateArtifact(t *testing.T) {
+	artifact := dx.Artifact{
+		ID:      "my-app-123",
+		Version: dx.Version{Event: dx.Push, Branch: "main", RepositoryName: "my-app"},
+		Environments: []*dx.Manifest{
+			{
+				App:    "my-app",
+				Env:    "staging",
+				Deploy: &dx.Deploy{Branch: "main", Event: dx.PushPtr()},
+			},
+			{
+				App: "my-app",
+				Env: "production",
+			},
+		},
+	}
+	artifactEvent, err := model.ToEvent(artifact)
+	assert.Nil(t, err)
+
+	dao := store.NewTest()
+	artifactEvent, err = dao.CreateEvent(artifactEvent)
+	assert.Nil(t, err)
+	err = dao.UpdateEventStatus(artifactEvent.ID, model.StatusProcessed, "", "[]", `["staging"]`,
+		`[{"env": "staging", "app": "my-app", "status": "success"}]`)
+	assert.Nil(t, err)
+	err = dao.SaveFreezes([]*dx.Freeze{
+		{Env: "staging", App: "my-app", Reason: "black friday", FrozenBy: "laszlo"},
+		{Env: "production", App: "my-app", Reason: "black friday", FrozenBy: "laszlo"},
+	})
+	assert.Nil(t, err)
+
+	reevaluationRequest, _ := json.Marshal(dx.ReevaluationRequest{ArtifactID: "my-app-123", TriggeredBy: "laszlo"})
+	event := &model.Event{Type: model.TypeReevaluation, Blob: string(reevaluationRequest)}
+
+	envs := map[string]*dx.Env{
+		"production": {Name: "production", DefaultDeploy: &dx.Deploy{Branch: "main", Event: dx.PushPtr()}},
+	}
+	gitopsEvents, err := processReevaluationEvent("", nil, "", event, dao, 0, nil, nil, nil, nil, nil, nil, envs, testLog)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(gitopsEvents), "should not deploy to staging again")
+	assert.Equal(t, "production", gitopsEvents[0].Manifest.Env, "should deploy by the new default deploy policy")
+}
+
+func Test_parkRollbackProtectedDeploys(t *testing.T) {
+	path, _ := ioutil.TempDir("", "gitops-")
+	defer os.RemoveAll(path)
+	repo, _ := git.PlainInit(path, false)
+	initHistory(repo)
+
+	artifact := dx.Artifact{
+		ID:      "my-app-123",
+		Version: dx.Version{Event: dx.Push, Branch: "main", RepositoryName: "my-app"},
+		Environments: []*dx.Manifest{
+			{
+				App:    "my-app",
+				Env:    "staging",
+				Deploy:      &dx.Deploy{Branch: "main", Event: dx.PushPtr()},
+				ValuesFiles: []string{"values-staging.yaml"},
+			},
+		},
+	}
+	artifactEvent, err := model.ToEvent(artifact)
+	assert.Nil(t, err)
+
+	dao := store.NewTest()
+	artifactEvent, err = dao.CreateEvent(artifactEvent)
+	assert.Nil(t, err)
+	err = dao.SaveLastRollback("staging", "my-app", time.Now().Add(-30*time.Second))
+	assert.Nil(t, err)
+
+	gitopsEvents, err := processArtifactEvent("", nil, "", artifactEvent, dao, 10*time.Minute, nil, nil, nil, nil, nil, nil, nil, testLog)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(gitopsEvents))
+	assert.Equal(t, events.Parked, gitopsEvents[0].Status)
+	assert.Contains(t, gitopsEvents[0].StatusDesc, "it was rolled back within the last 10m0s, the protection ends in 9m")
+
+	reevaluationRequest, _ := json.Marshal(dx.ReevaluationRequest{ArtifactID: "my-app-123", TriggeredBy: "laszlo", Force: true})
+	event := &model.Event{Type: model.TypeReevaluation, Blob: string(reevaluationRequest)}
+	batch := &gitopsBatch{branches: map[string]*branchBatch{"": {repo: repo, repoPath: path}}}
+	gitopsEvents, err = processReevaluationEvent("", batch, "", event, dao, 10*time.Minute, nil, nil, nil, nil, nil, nil, nil, testLog)
+	assert.NotNil(t, err, "should attempt the deploy, and fail on the missing values file")
+	assert.Equal(t, 1, len(gitopsEvents))
+	assert.Equal(t, events.Failure, gitopsEvents[0].Status, "forced reevaluation should skip the rollback protection")
+}
+
+func Test_reevaluateArtifactWithTemplatedApp(t *testing.T) {
+	artifact := dx.Artifact{
+		ID:      "my-app-123",
+		Version: dx.Version{Event: dx.Push, Branch: "main", RepositoryName: "my-app"},
+		Environments: []*dx.Manifest{
+			{
+				App:    "my-app-{{ .GitBranch }}",
+				Env:    "staging",
+				Deploy: &dx.Deploy{Branch: "main", Event: dx.PushPtr()},
+			},
+		},
+	}
+	artifactEvent, err := model.ToEvent(artifact)
+	assert.Nil(t, err)
+
+	dao := store.NewTest()
+	artifactEvent, err = dao.CreateEvent(artifactEvent)
+	assert.Nil(t, err)
+	err = dao.UpdateEventStatus(artifactEvent.ID, model.StatusProcessed, "", "[]", `["staging"]`,
+		`[{"env": "staging", "app": "my-app-main", "status": "success"}]`)
+	assert.Nil(t, err)
+
+	reevaluationRequest, _ := json.Marshal(dx.ReevaluationRequest{ArtifactID: "my-app-123", TriggeredBy: "laszlo"})
+	event := &model.Event{Type: model.TypeReevaluation, Blob: string(reevaluationRequest)}
+
+	gitopsEvents, err := processReevaluationEvent("", nil, "", event, dao, 0, nil, nil, nil, nil, nil, nil, nil, testLog)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(gitopsEvents), "should not deploy the resolved app again")
+}
+
+func Test_refuseUnsignedArtifactInProtectedEnv(t *testing.T) {
+	artifact := dx.Artifact{
+		ID:              "my-app-123",
+		Version:         dx.Version{Event: dx.Push, Branch: "main"},
+		SignatureStatus: dx.SignatureUnsigned,
+		Environments: []*dx.Manifest{
+			{
+				App: "my-app",
+				Env: "production",
+				Deploy: &dx.Deploy{
+					Branch: "main",
+					Event:  dx.PushPtr(),
+				},
+			},
+		},
+	}
+	event, err := model.ToEvent(artifact)
+	assert.Nil(t, err)
+
+	gitopsEvents, err := processArtifactEvent("", nil, "", event, store.NewTest(), 0, nil, nil, nil, nil, nil, []string{"production"}, nil, testLog)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(gitopsEvents))
+	assert.Equal(t, events.Failure, gitopsEvents[0].Status)
+	assert.Contains(t, gitopsEvents[0].StatusDesc, "the signature of my-app-123 is unsigned")
+
+	assert.Nil(t, checkSignature(&dx.Artifact{SignatureStatus: dx.SignatureVerified}, "production", []string{"production"}))
+	assert.Nil(t, checkSignature(&dx.Artifact{}, "staging", []string{"production"}), "unprotected envs accept any artifact")
+}
+
+func Test_deployToAllEnvsOnPartialFailure(t *testing.T) {
+	path, _ := ioutil.TempDir("", "gitops-")
+	defer os.RemoveAll(path)
+	repo, _ := git.PlainInit(path, false)
+	initHistory(repo)
+
+	artifact := dx.Artifact{
+		ID:      "my-app-123",
+		Version: dx.Version{Event: dx.Push, Branch: "main"},
+		Environments: []*dx.Manifest{
+			{
+				App:    "my-app",
+				Env:    "staging",
+				Deploy: &dx.Deploy{Branch: "main", Event: dx.PushPtr()},
+				Values: map[string]interface{}{"image": "{{ .BROKEN"},
+			},
+			{
+				App: "my-app",
+				Env: "production",
+				Deploy: &dx.Deploy{
+					Branch:        "main",
+					Event:         dx.PushPtr(),
+					RequiredItems: []map[string]string{{"name": "security-scan"}},
+				},
+			},
+		},
+	}
+	event, err := model.ToEvent(artifact)
+	assert.Nil(t, err)
+
+	batch := &gitopsBatch{branches: map[string]*branchBatch{"": {repo: repo, repoPath: path}}}
+	gitopsEvents, err := processArtifactEvent("", batch, "", event, store.NewTest(), 0, nil, nil, nil, nil, nil, nil, nil, testLog)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "staging/my-app")
+	assert.Equal(t, 2, len(gitopsEvents), "should attempt the envs after the failed one")
+	assert.Equal(t, events.Failure, gitopsEvents[0].Status)
+	assert.Equal(t, events.Parked, gitopsEvents[1].Status)
+}
+
+func Test_finalizePartiallyFailedEvent(t *testing.T) {
+	s := store.NewTest()
+	artifact := dx.Artifact{ID: "my-app-123", Version: dx.Version{SHA: "ea9ab7cc"}}
+	event, _ := model.ToEvent(artifact)
+	event, err := s.CreateEvent(event)
+	assert.Nil(t, err)
+
+	gitopsEvents := []*events.DeployEvent{
+		{Manifest: &dx.Manifest{Env: "staging", App: "my-app"}, Artifact: &artifact, Status: events.Success, GitopsRef: "abc"},
+		{Manifest: &dx.Manifest{Env: "production", App: "my-app"}, Artifact: &artifact, Status: events.Failure, StatusDesc: "cannot template"},
+	}
+	finalizeEvent(s, notifications.NewDummyManager(), event, gitopsEvents, fmt.Errorf("deploy failed in production/my-app: cannot template"), false, newEventLog(event))
+
+	stored, err := s.Event(event.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, model.StatusPartial, stored.Status)
+	assert.Contains(t, stored.Logs[len(stored.Logs)-1], "deploy failed in production/my-app", "should store the logs of the processing")
+	assert.Contains(t, stored.Logs[len(stored.Logs)-1], "eventId="+event.ID)
+	assert.Equal(t, []string{"staging"}, stored.TriggeredEnvs)
+	assert.Equal(t, []dx.EnvStatus{
+		{Env: "staging", App: "my-app", Status: dx.EnvStatusSuccess, GitopsRef: "abc"},
+		{Env: "production", App: "my-app", Status: dx.EnvStatusFailure, StatusDesc: "cannot template"},
+	}, stored.EnvStatuses)
+
+	gitopsEvents[0].Status = events.Failure
+	finalizeEvent(s, notifications.NewDummyManager(), event, gitopsEvents, fmt.Errorf("push failed"), false, newEventLog(event))
+	stored, _ = s.Event(event.ID)
+	assert.Equal(t, model.StatusError, stored.Status, "should be an error if no env was deployed")
+}
+
+func Test_waitForEvents(t *testing.T) {
+	start := time.Now()
+	waitForEvents(nil, true)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "should poll without notifications")
+
+	notify := make(chan struct{}, 1)
+	start = time.Now()
+	waitForEvents(notify, true)
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "should not wait when there may be more events")
+
+	notify <- struct{}{}
+	start = time.Now()
+	waitForEvents(notify, false)
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "should wake up on notifications")
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/sirupsen/logrus"
+)
+
+// TeamSource lists the teams of the SCM organization, see customGithub.OrgTeams
+type TeamSource interface {
+	Teams() (map[string][]string, error)
+}
+
+// GroupSyncWorker periodically replaces the user groups with the teams of the SCM organization,
+// so the RBAC rules that target groups follow the org structure
+type GroupSyncWorker struct {
+	store    *store.Store
+	teams    TeamSource
+	interval time.Duration
+}
+
+func NewGroupSyncWorker(
+	store *store.Store,
+	teams TeamSource,
+	interval time.Duration,
+) *GroupSyncWorker {
+	return &GroupSyncWorker{
+		store:    store,
+		teams:    teams,
+		interval: interval,
+	}
+}
+
+func (w *GroupSyncWorker) Run() {
+	for {
+		err := w.sync()
+		if err != nil {
+			logrus.Errorf("could not sync groups, keeping the last synced ones: %s", err)
+		}
+		time.Sleep(w.interval)
+	}
+}
+
+func (w *GroupSyncWorker) sync() error {
+	teams, err := w.teams.Teams()
+	if err != nil {
+		return err
+	}
+
+	groups := []*model.Group{}
+	for name, members := range teams {
+		sort.Strings(members)
+		groups = append(groups, &model.Group{Name: name, Members: members})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return w.store.SaveGroups(groups)
+}
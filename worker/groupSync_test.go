@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTeams struct {
+	teams map[string][]string
+	err   error
+}
+
+func (f *fakeTeams) Teams() (map[string][]string, error) {
+	return f.teams, f.err
+}
+
+func Test_groupSync(t *testing.T) {
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	teams := &fakeTeams{teams: map[string][]string{
+		"platform": {"laszlo", "jane"},
+		"backend":  {"jane"},
+	}}
+	groupSyncWorker := NewGroupSyncWorker(s, teams, time.Minute)
+
+	err := groupSyncWorker.sync()
+	assert.Nil(t, err)
+	groups, err := s.Groups()
+	assert.Nil(t, err)
+	assert.Equal(t, []*model.Group{
+		{Name: "backend", Members: []string{"jane"}},
+		{Name: "platform", Members: []string{"jane", "laszlo"}},
+	}, groups)
+	janesGroups, err := s.GroupsOf("jane")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"backend", "platform"}, janesGroups)
+
+	teams.err = fmt.Errorf("rate limited")
+	err = groupSyncWorker.sync()
+	assert.NotNil(t, err)
+	groups, err = s.Groups()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(groups), "should keep the last synced groups on errors")
+}
@@ -0,0 +1,328 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// imageUpdatePoliciesLock guards the read-modify-write of the image update policies,
+// as both the gitops worker and the image update worker update them
+var imageUpdatePoliciesLock sync.Mutex
+
+// ImageRegistry lists the tags of container images, see registry.Client
+type ImageRegistry interface {
+	Tags(image string) ([]string, error)
+}
+
+// ImageUpdateWorker polls the container registry for the apps with an image update policy,
+// and releases their latest deployed artifact with the new image tags
+type ImageUpdateWorker struct {
+	store                 *store.Store
+	registry              ImageRegistry
+	interval              time.Duration
+	artifactRepoAllowlist []*model.AllowedRepository
+	rollbackProtection    time.Duration
+	envs                  map[string]*dx.Env
+}
+
+func NewImageUpdateWorker(
+	store *store.Store,
+	registry ImageRegistry,
+	interval time.Duration,
+	artifactRepoAllowlist []*model.AllowedRepository,
+	rollbackProtection time.Duration,
+	envs map[string]*dx.Env,
+) *ImageUpdateWorker {
+	return &ImageUpdateWorker{
+		store:                 store,
+		registry:              registry,
+		interval:              interval,
+		artifactRepoAllowlist: artifactRepoAllowlist,
+		rollbackProtection:    rollbackProtection,
+		envs:                  envs,
+	}
+}
+
+func (w *ImageUpdateWorker) Run() {
+	for {
+		imageUpdatePoliciesLock.Lock()
+		policies, err := w.store.ImageUpdatePolicies()
+		imageUpdatePoliciesLock.Unlock()
+		if err != nil {
+			logrus.Errorf("could not load image update policies: %s", err)
+		}
+
+		for _, policy := range policies {
+			err := w.update(policy)
+			if err != nil {
+				logrus.Warnf("could not update the image of %s in %s: %s", policy.App, policy.Env, err)
+			}
+		}
+
+		time.Sleep(w.interval)
+	}
+}
+
+// update releases the latest tag of the image if it is newer than the last deployed one.
+// The first tag seen is only recorded, unless the artifact of the policy carries the deployed tag
+func (w *ImageUpdateWorker) update(policy *model.ImageUpdatePolicy) error {
+	artifactEvent, err := w.store.Artifact(policy.ArtifactID)
+	if err != nil {
+		return fmt.Errorf("cannot find artifact %s: %s", policy.ArtifactID, err)
+	}
+	artifact, err := model.ToArtifact(artifactEvent)
+	if err != nil {
+		return err
+	}
+	manifest, resolved, err := imageUpdateManifest(artifact, policy)
+	if err != nil {
+		return err
+	}
+
+	tags, err := w.registry.Tags(resolved.ImageUpdate.Image)
+	if err != nil {
+		return err
+	}
+	latest, err := resolved.ImageUpdate.Latest(tags)
+	if err != nil {
+		return err
+	}
+	if latest == "" || !resolved.ImageUpdate.Newer(latest, policy.LastTag) {
+		return nil
+	}
+
+	if policy.LastTag != "" {
+		reason, err := w.skipReason(policy)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			logrus.Infof("not releasing %s of %s to %s yet, %s", latest, policy.App, policy.Env, reason)
+			return recordSkippedImageTag(w.store, policy, latest, reason)
+		}
+
+		err = w.release(artifact, manifest, policy, latest)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("releasing %s of %s to %s", latest, policy.App, policy.Env)
+	}
+
+	return recordImageTag(w.store, policy, latest)
+}
+
+// skipReason tells why the image update of the policy can't be released now, empty if it can be:
+// the app was rolled back within the rollback protection window, or the failing sync of the env holds the auto-deploys
+func (w *ImageUpdateWorker) skipReason(policy *model.ImageUpdatePolicy) (string, error) {
+	log := logrus.WithFields(logrus.Fields{"env": policy.Env, "app": policy.App})
+	if rollbackProtected(w.store, policy.Env, policy.App, w.rollbackProtection, log) {
+		return fmt.Sprintf("the app was rolled back within the rollback protection window of %s", w.rollbackProtection), nil
+	}
+
+	if !holdsDeploysOnSyncFailure(w.envs) {
+		return "", nil
+	}
+	syncs, err := w.store.FailingEnvSyncs()
+	if err != nil {
+		return "", fmt.Errorf("cannot load the failing syncs: %s", err)
+	}
+	if sync := heldSync(w.envs, syncs, []string{policy.Env}); sync != nil {
+		return fmt.Sprintf("the sync of %s is failing: %s", sync.Env, sync.Reason), nil
+	}
+	return "", nil
+}
+
+// release saves an artifact that holds only the manifest of the policy with the image tag, and releases it to the env.
+// The artifact is submitted by the submitter of the artifact of the policy, so it must still be on the artifact allowlist
+func (w *ImageUpdateWorker) release(artifact *dx.Artifact, manifest *dx.Manifest, policy *model.ImageUpdatePolicy, tag string) error {
+	var submittedBy string
+	if artifact.Source != nil {
+		submittedBy = artifact.Source.SubmittedBy
+	}
+	allowed, err := w.store.ArtifactRepoAllowed(w.artifactRepoAllowlist, artifact.Version.RepositoryName, submittedBy)
+	if err != nil {
+		return fmt.Errorf("cannot check the artifact repo allowlist: %s", err)
+	}
+	if !allowed {
+		return fmt.Errorf("%s may not submit the artifacts of repository %s anymore", submittedBy, artifact.Version.RepositoryName)
+	}
+
+	context := map[string]string{}
+	for k, v := range artifact.Context {
+		context[k] = v
+	}
+	context[dx.ImageUpdateTagVar] = tag
+
+	manifest.Deploy = &dx.Deploy{} // the artifact is only deployed by the release, not by the default deploy policy of the env
+	manifest.Cleanup = nil
+	imageArtifact := &dx.Artifact{
+		ID:           fmt.Sprintf("%s-%s", artifact.Version.RepositoryName, uuid.New().String()),
+		Created:      time.Now().Unix(),
+		Version:      artifact.Version,
+		Context:      context,
+		Environments: []*dx.Manifest{manifest},
+		Items:        artifact.Items,
+		Dependencies: artifact.Dependencies,
+		Source:       &dx.ArtifactSource{SubmittedBy: submittedBy},
+	}
+
+	artifactEvent, err := model.ToEvent(*imageArtifact)
+	if err != nil {
+		return err
+	}
+	_, err = w.store.CreateEvent(artifactEvent)
+	if err != nil {
+		return fmt.Errorf("cannot save artifact: %s", err)
+	}
+
+	releaseRequestStr, err := json.Marshal(dx.ReleaseRequest{
+		Env:         policy.Env,
+		App:         policy.App,
+		ArtifactID:  imageArtifact.ID,
+		TriggeredBy: imageUpdateTrigger,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.store.CreateEvent(&model.Event{
+		Type:         model.TypeRelease,
+		Blob:         string(releaseRequestStr),
+		Repository:   imageArtifact.Version.RepositoryName,
+		GitopsHashes: []string{},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot save release request: %s", err)
+	}
+	return nil
+}
+
+// imageUpdateManifest returns the manifest of the policy from the artifact, as is and with its vars resolved
+func imageUpdateManifest(artifact *dx.Artifact, policy *model.ImageUpdatePolicy) (*dx.Manifest, *dx.Manifest, error) {
+	manifests, err := dx.ExpandVariants(artifact.Environments)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, m := range manifests {
+		if m.Env != policy.Env || m.ImageUpdate == nil {
+			continue
+		}
+
+		manifest, err := copyManifest(m)
+		if err != nil {
+			return nil, nil, err
+		}
+		resolved, err := copyManifest(m)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = resolved.ResolveVars(artifact.Vars())
+		if err != nil {
+			return nil, nil, err
+		}
+		if resolved.App == policy.App {
+			return manifest, resolved, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("artifact %s has no image update policy for %s in %s", artifact.ID, policy.App, policy.Env)
+}
+
+func copyManifest(m *dx.Manifest) (*dx.Manifest, error) {
+	manifestBytes, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var manifest dx.Manifest
+	err = json.Unmarshal(manifestBytes, &manifest)
+	return &manifest, err
+}
+
+// recordImageTag stores the last image tag of a policy
+func recordImageTag(dao *store.Store, policy *model.ImageUpdatePolicy, tag string) error {
+	imageUpdatePoliciesLock.Lock()
+	defer imageUpdatePoliciesLock.Unlock()
+
+	policies, err := dao.ImageUpdatePolicies()
+	if err != nil {
+		return err
+	}
+	for _, p := range policies {
+		if p.Env == policy.Env && p.App == policy.App {
+			p.LastTag = tag
+			p.SkippedTag = ""
+			p.SkipReason = ""
+		}
+	}
+	return dao.SaveImageUpdatePolicies(policies)
+}
+
+// recordSkippedImageTag records the image tag that is not released yet, and why
+func recordSkippedImageTag(dao *store.Store, policy *model.ImageUpdatePolicy, tag string, reason string) error {
+	imageUpdatePoliciesLock.Lock()
+	defer imageUpdatePoliciesLock.Unlock()
+
+	policies, err := dao.ImageUpdatePolicies()
+	if err != nil {
+		return err
+	}
+	for _, p := range policies {
+		if p.Env == policy.Env && p.App == policy.App {
+			p.SkippedTag = tag
+			p.SkipReason = reason
+		}
+	}
+	return dao.SaveImageUpdatePolicies(policies)
+}
+
+// keepImageUpdatePoliciesUpToDate makes the deployed artifact the base of the image updates of the app in the env,
+// or drops the policy of the app if the deployed manifest doesn't have one
+func keepImageUpdatePoliciesUpToDate(dao *store.Store, manifest *dx.Manifest, artifact *dx.Artifact, log *logrus.Entry) {
+	if manifest.Shadow { // image updates would overwrite the deployed app, not the shadow
+		return
+	}
+
+	imageUpdatePoliciesLock.Lock()
+	defer imageUpdatePoliciesLock.Unlock()
+
+	policies, err := dao.ImageUpdatePolicies()
+	if err != nil {
+		log.Warnf("could not load image update policies: %s", err)
+		return
+	}
+
+	var policy *model.ImageUpdatePolicy
+	updated := []*model.ImageUpdatePolicy{}
+	for _, p := range policies {
+		if p.Env == manifest.Env && p.App == manifest.App {
+			policy = p
+			continue
+		}
+		updated = append(updated, p)
+	}
+	if policy == nil && manifest.ImageUpdate == nil {
+		return
+	}
+
+	if manifest.ImageUpdate != nil {
+		if policy == nil {
+			policy = &model.ImageUpdatePolicy{Env: manifest.Env, App: manifest.App}
+		}
+		policy.ArtifactID = artifact.ID
+		if tag, ok := artifact.Context[dx.ImageUpdateTagVar]; ok {
+			policy.LastTag = tag
+		}
+		updated = append(updated, policy)
+	}
+
+	err = dao.SaveImageUpdatePolicies(updated)
+	if err != nil {
+		log.Warnf("could not update image update policies: %s", err)
+	}
+}
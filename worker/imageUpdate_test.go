@@ -0,0 +1,142 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type dummyRegistry struct {
+	tags []string
+}
+
+func (r *dummyRegistry) Tags(image string) ([]string, error) {
+	return r.tags, nil
+}
+
+func Test_imageUpdate(t *testing.T) {
+	s := store.NewTest()
+	artifact := &dx.Artifact{
+		ID:      "my-app-123",
+		Version: dx.Version{RepositoryName: "my-app", SHA: "ea9ab7cc", Branch: "main", Event: dx.Push},
+		Source:  &dx.ArtifactSource{SubmittedBy: "my-app-ci"},
+		Environments: []*dx.Manifest{
+			{
+				App:         "my-app",
+				Env:         "staging",
+				Deploy:      &dx.Deploy{Branch: "main", Event: dx.PushPtr()},
+				ImageUpdate: &dx.ImageUpdate{Image: "ghcr.io/gimlet-io/my-app", Semver: ">=1.0.0"},
+				Values:      map[string]interface{}{"image": "ghcr.io/gimlet-io/my-app:{{ .IMAGE_TAG }}"},
+			},
+		},
+	}
+	artifactEvent, _ := model.ToEvent(*artifact)
+	_, err := s.CreateEvent(artifactEvent)
+	assert.Nil(t, err)
+	keepImageUpdatePoliciesUpToDate(s, artifact.Environments[0], artifact, testLog)
+
+	registry := &dummyRegistry{tags: []string{"0.9.0", "1.0.0"}}
+	w := NewImageUpdateWorker(s, registry, 0, nil, 0, nil)
+
+	policies, _ := s.ImageUpdatePolicies()
+	assert.Equal(t, 1, len(policies))
+	assert.Nil(t, w.update(policies[0]))
+	policies, _ = s.ImageUpdatePolicies()
+	assert.Equal(t, "1.0.0", policies[0].LastTag, "should record the first tag seen")
+	unprocessed, _ := s.UnprocessedEvents()
+	assert.Equal(t, 1, len(unprocessed), "should not release the first tag seen")
+
+	registry.tags = append(registry.tags, "1.1.0")
+	assert.Nil(t, w.update(policies[0]))
+	policies, _ = s.ImageUpdatePolicies()
+	assert.Equal(t, "1.1.0", policies[0].LastTag)
+
+	unprocessed, _ = s.UnprocessedEvents()
+	assert.Equal(t, 3, len(unprocessed), "should save an artifact and a release")
+	var imageArtifact *dx.Artifact
+	var releaseRequest dx.ReleaseRequest
+	for _, event := range unprocessed[1:] {
+		switch event.Type {
+		case model.TypeArtifact:
+			imageArtifact, _ = model.ToArtifact(event)
+		case model.TypeRelease:
+			json.Unmarshal([]byte(event.Blob), &releaseRequest)
+		}
+	}
+	assert.Equal(t, "1.1.0", imageArtifact.Context[dx.ImageUpdateTagVar])
+	assert.Equal(t, &dx.Deploy{}, imageArtifact.Environments[0].Deploy, "should only be deployed by the release")
+	assert.Equal(t, dx.ReleaseRequest{Env: "staging", App: "my-app", ArtifactID: imageArtifact.ID, TriggeredBy: "imageUpdate"}, releaseRequest)
+	assert.Equal(t, "my-app-ci", imageArtifact.Source.SubmittedBy, "should be submitted by the submitter of the artifact of the policy")
+
+	w = NewImageUpdateWorker(s, registry, 0, []*model.AllowedRepository{{Repository: "my-app", Users: []string{"other-ci"}}}, 0, nil)
+	registry.tags = append(registry.tags, "1.2.0")
+	assert.NotNil(t, w.update(policies[0]), "should not release if the submitter is not on the allowlist")
+	unprocessed, _ = s.UnprocessedEvents()
+	assert.Equal(t, 3, len(unprocessed))
+
+	keepImageUpdatePoliciesUpToDate(s, imageArtifact.Environments[0], imageArtifact, testLog)
+	policies, _ = s.ImageUpdatePolicies()
+	assert.Equal(t, imageArtifact.ID, policies[0].ArtifactID, "the released artifact should be the base of the next update")
+
+	keepImageUpdatePoliciesUpToDate(s, &dx.Manifest{App: "my-app", Env: "staging"}, &dx.Artifact{ID: "my-app-456"}, testLog)
+	policies, _ = s.ImageUpdatePolicies()
+	assert.Empty(t, policies, "should drop the policy if the deployed manifest has none")
+}
+
+func Test_imageUpdateSkips(t *testing.T) {
+	s := store.NewTest()
+	artifact := &dx.Artifact{
+		ID:      "my-app-123",
+		Version: dx.Version{RepositoryName: "my-app", SHA: "ea9ab7cc", Branch: "main", Event: dx.Push},
+		Context: map[string]string{dx.ImageUpdateTagVar: "1.0.0"},
+		Environments: []*dx.Manifest{
+			{
+				App:         "my-app",
+				Env:         "staging",
+				ImageUpdate: &dx.ImageUpdate{Image: "ghcr.io/gimlet-io/my-app", Semver: ">=1.0.0"},
+			},
+		},
+	}
+	artifactEvent, _ := model.ToEvent(*artifact)
+	_, err := s.CreateEvent(artifactEvent)
+	assert.Nil(t, err)
+	keepImageUpdatePoliciesUpToDate(s, artifact.Environments[0], artifact, testLog)
+
+	registry := &dummyRegistry{tags: []string{"1.0.0", "1.1.0"}}
+	envs := map[string]*dx.Env{"staging": {Name: "staging", HoldDeploysOnSyncFailure: true}}
+	w := NewImageUpdateWorker(s, registry, 0, nil, 10*time.Minute, envs)
+
+	err = s.SaveLastRollback("staging", "my-app", time.Now())
+	assert.Nil(t, err)
+	policies, _ := s.ImageUpdatePolicies()
+	assert.Nil(t, w.update(policies[0]))
+	policies, _ = s.ImageUpdatePolicies()
+	assert.Equal(t, "1.0.0", policies[0].LastTag, "should not release within the rollback protection window")
+	assert.Equal(t, "1.1.0", policies[0].SkippedTag)
+	assert.Contains(t, policies[0].SkipReason, "rolled back")
+	unprocessed, _ := s.UnprocessedEvents()
+	assert.Equal(t, 1, len(unprocessed))
+
+	err = s.SaveLastRollback("staging", "my-app", time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	err = s.SaveFailingEnvSyncs([]*dx.EnvSync{{Env: "staging", Reason: "HealthCheckFailed"}})
+	assert.Nil(t, err)
+	assert.Nil(t, w.update(policies[0]))
+	policies, _ = s.ImageUpdatePolicies()
+	assert.Equal(t, "1.0.0", policies[0].LastTag, "should not release while the sync holds the deploys")
+	assert.Contains(t, policies[0].SkipReason, "HealthCheckFailed")
+
+	err = s.SaveFailingEnvSyncs([]*dx.EnvSync{})
+	assert.Nil(t, err)
+	assert.Nil(t, w.update(policies[0]))
+	policies, _ = s.ImageUpdatePolicies()
+	assert.Equal(t, "1.1.0", policies[0].LastTag, "should release once the reasons are gone")
+	assert.Equal(t, "", policies[0].SkippedTag)
+	unprocessed, _ = s.UnprocessedEvents()
+	assert.Equal(t, 3, len(unprocessed))
+}
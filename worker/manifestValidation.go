@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"fmt"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/validation"
+	"github.com/sirupsen/logrus"
+)
+
+// manifestValidationPolicy returns the manifest validation policy of the env, nil if its manifests are not validated
+func manifestValidationPolicy(envs map[string]*dx.Env, env string) *dx.ManifestValidation {
+	if e, ok := envs[env]; ok && e != nil {
+		return e.ManifestValidation
+	}
+	return nil
+}
+
+// validateManifests validates the rendered files of the manifest, so invalid manifests fail the event
+// before they are committed to the gitops repo
+func validateManifests(
+	manifestValidator *validation.Validator,
+	manifest *dx.Manifest,
+	files map[string]string,
+	policy *dx.ManifestValidation,
+	log *logrus.Entry,
+) error {
+	if manifestValidator == nil {
+		return fmt.Errorf("%s requires manifest validation, but no manifest validator is configured", manifest.Env)
+	}
+
+	err := manifestValidator.Validate(files, policy)
+	if err != nil {
+		return fmt.Errorf("invalid manifests of %s in %s: %s", manifest.App, manifest.Env, err)
+	}
+	log.Infof("validated %d manifest files of %s", len(files), manifest.App)
+	return nil
+}
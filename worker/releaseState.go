@@ -2,83 +2,127 @@ package worker
 
 import (
 	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gimlet-io/gimletd/dx"
 	"github.com/gimlet-io/gimletd/git/nativeGit"
+	"github.com/gimlet-io/gimletd/store"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
-	"path/filepath"
-	"time"
 )
 
+// ReleaseStateWorker periodically walks the gitops repo for the current release of every app,
+// exports them as metrics and stores them for the API
 type ReleaseStateWorker struct {
 	GitopsRepo string
 	RepoCache  *nativeGit.GitopsRepoCache
-	Releases   *prometheus.GaugeVec
-	Perf       *prometheus.HistogramVec
+	Store      *store.Store
+	// Envs are walked, all envs if empty
+	Envs     []string
+	Interval time.Duration
+	Releases *prometheus.GaugeVec
+	Perf     *prometheus.HistogramVec
 }
 
 func (w *ReleaseStateWorker) Run() {
 	for {
-		t0 := time.Now()
-		repo := w.RepoCache.InstanceForRead()
-		w.Perf.WithLabelValues("releaseState_clone").Observe(time.Since(t0).Seconds())
+		err := w.walk()
+		if err != nil {
+			logrus.Errorf("cannot walk release state: %s", err)
+		}
+		time.Sleep(w.Interval)
+	}
+}
 
-		envs, err := nativeGit.Envs(repo)
+func (w *ReleaseStateWorker) walk() error {
+	t0 := time.Now()
+	envs := w.Envs
+	if len(envs) == 0 {
+		var err error
+		envs, err = w.RepoCache.Envs()
 		if err != nil {
-			logrus.Errorf("cannot get envs: %s", err)
-			time.Sleep(30 * time.Second)
+			return fmt.Errorf("cannot get envs: %s", err)
+		}
+	}
+	w.Perf.WithLabelValues("releaseState_clone").Observe(time.Since(t0).Seconds())
+
+	releaseState := &dx.ReleaseState{
+		Updated:  time.Now().Unix(),
+		Releases: []*dx.AppReleaseState{},
+	}
+	for _, env := range envs {
+		repo, releaseRepo := w.RepoCache.EnvInstanceForRead(env)
+		t1 := time.Now()
+		appReleases, err := nativeGit.Status(repo, "", env, w.Perf)
+		if err != nil {
+			releaseRepo()
+			logrus.Errorf("cannot get status of %s: %s", env, err)
 			continue
 		}
+		w.Perf.WithLabelValues("releaseState_appReleases").Observe(time.Since(t1).Seconds())
+
+		var apps []string
+		for app := range appReleases {
+			apps = append(apps, app)
+		}
+		sort.Strings(apps)
 
-		w.Releases.Reset()
-		for _, env := range envs {
-			t1 := time.Now()
-			appReleases, err := nativeGit.Status(repo, "", env, w.Perf)
-			if err != nil {
-				logrus.Errorf("cannot get status: %s", err)
-				time.Sleep(30 * time.Second)
+		for _, app := range apps {
+			t2 := time.Now()
+			commit, err := lastCommitThatTouchedAFile(repo, filepath.Join(env, app))
+			if err != nil || commit == nil {
+				logrus.Errorf("cannot find last commit of %s/%s: %s", env, app, err)
 				continue
 			}
-			w.Perf.WithLabelValues("releaseState_appReleases").Observe(time.Since(t1).Seconds())
+			w.Perf.WithLabelValues("releaseState_appRelease").Observe(time.Since(t2).Seconds())
 
-			for app, release := range appReleases {
-				t2 := time.Now()
-				commit, err := lastCommitThatTouchedAFile(repo, filepath.Join(env, app))
-				if err != nil {
-					logrus.Errorf("cannot find last commit: %s", err)
-					time.Sleep(30 * time.Second)
-					continue
-				}
-				w.Perf.WithLabelValues("releaseState_appRelease").Observe(time.Since(t2).Seconds())
+			release := appReleases[app]
+			if release == nil { // without a readable release file
+				release = nativeGit.ReleaseFromTrailers(commit)
+			}
+			releaseState.Releases = append(releaseState.Releases, &dx.AppReleaseState{
+				Env:       env,
+				App:       app,
+				Release:   release,
+				GitopsRef: commit.Hash.String(),
+				Created:   commit.Committer.When.Unix(),
+			})
+		}
+		releaseRepo()
+	}
 
-				gitopsRef := fmt.Sprintf("https://github.com/%s/commit/%s", w.GitopsRepo, commit.Hash.String())
-				created := commit.Committer.When
+	w.Releases.Reset()
+	for _, appRelease := range releaseState.Releases {
+		gitopsRef := fmt.Sprintf("https://github.com/%s/commit/%s", w.GitopsRepo, appRelease.GitopsRef)
+		created := time.Unix(appRelease.Created, 0).Format(time.RFC3339)
 
-				if release != nil {
-					w.Releases.WithLabelValues(
-						env,
-						app,
-						release.Version.URL,
-						release.Version.Message,
-						gitopsRef,
-						created.Format(time.RFC3339),
-					).Set(1.0)
-				} else {
-					w.Releases.WithLabelValues(
-						env,
-						app,
-						"",
-						"",
-						gitopsRef,
-						created.Format(time.RFC3339),
-					).Set(1.0)
-				}
-			}
+		if appRelease.Release != nil && appRelease.Release.Version != nil {
+			w.Releases.WithLabelValues(
+				appRelease.Env,
+				appRelease.App,
+				appRelease.Release.Version.URL,
+				appRelease.Release.Version.Message,
+				gitopsRef,
+				created,
+			).Set(1.0)
+		} else {
+			w.Releases.WithLabelValues(
+				appRelease.Env,
+				appRelease.App,
+				"",
+				"",
+				gitopsRef,
+				created,
+			).Set(1.0)
 		}
-		w.Perf.WithLabelValues("releaseState_run").Observe(time.Since(t0).Seconds())
-		time.Sleep(30 * time.Second)
 	}
+	w.Perf.WithLabelValues("releaseState_run").Observe(time.Since(t0).Seconds())
+
+	return w.Store.SaveReleaseState(releaseState)
 }
 
 func lastCommitThatTouchedAFile(repo *git.Repository, path string) (*object.Commit, error) {
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// RemoteCircuit pauses the gitops worker after consecutive failed pushes to the gitops repo,
+// eg. when the deploy key is revoked or the repo is moved, instead of failing every event rapidly.
+// While open, the remote is probed periodically, and processing resumes once the probe succeeds
+type RemoteCircuit struct {
+	threshold     int
+	probeInterval time.Duration
+	probe         func() error
+	openGauge     prometheus.Gauge
+
+	failures  int
+	open      bool
+	lastProbe time.Time
+}
+
+func NewRemoteCircuit(
+	threshold int,
+	probeInterval time.Duration,
+	probe func() error,
+	openGauge prometheus.Gauge,
+) *RemoteCircuit {
+	return &RemoteCircuit{
+		threshold:     threshold,
+		probeInterval: probeInterval,
+		probe:         probe,
+		openGauge:     openGauge,
+	}
+}
+
+// allow tells if events can be processed. If the circuit is open, it probes the remote once the probe interval passed.
+// The recovered return value is true if the probe closed the circuit
+func (c *RemoteCircuit) allow() (allowed bool, recovered bool) {
+	if !c.open {
+		return true, false
+	}
+	if time.Since(c.lastProbe) < c.probeInterval {
+		return false, false
+	}
+
+	c.lastProbe = time.Now()
+	err := c.probe()
+	if err != nil {
+		logrus.Warnf("gitops repo is still unreachable: %s", err)
+		return false, false
+	}
+
+	// half-open: one more failed push opens the circuit again
+	c.open = false
+	c.failures = c.threshold - 1
+	c.openGauge.Set(0)
+	logrus.Info("gitops repo is reachable again, resuming event processing")
+	return true, true
+}
+
+// pushFailed records a failed push. The opened return value is true if the failure opened the circuit
+func (c *RemoteCircuit) pushFailed(err error) (opened bool) {
+	c.failures++
+	if c.open || c.failures < c.threshold {
+		return false
+	}
+
+	c.open = true
+	c.lastProbe = time.Now()
+	c.openGauge.Set(1)
+	logrus.Errorf("pushing to the gitops repo failed %d times in a row, pausing event processing: %s", c.failures, err)
+	return true
+}
+
+// pushSucceeded resets the consecutive failures
+func (c *RemoteCircuit) pushSucceeded() {
+	c.failures = 0
+}
@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_remoteCircuit(t *testing.T) {
+	var probeErr error
+	probes := 0
+	open := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gitops_remote_circuit_open"})
+	circuit := NewRemoteCircuit(2, 0, func() error {
+		probes++
+		return probeErr
+	}, open)
+
+	pushErr := errors.New("Permission denied (publickey)")
+	assert.False(t, circuit.pushFailed(pushErr))
+	circuit.pushSucceeded()
+	assert.False(t, circuit.pushFailed(pushErr), "should only count consecutive failures")
+	assert.True(t, circuit.pushFailed(pushErr), "should open on the threshold")
+	assert.Equal(t, 1.0, testutil.ToFloat64(open))
+
+	probeErr = pushErr
+	allowed, recovered := circuit.allow()
+	assert.False(t, allowed, "should pause while the remote is unreachable")
+	assert.False(t, recovered)
+	assert.Equal(t, 1, probes)
+
+	probeErr = nil
+	allowed, recovered = circuit.allow()
+	assert.True(t, allowed)
+	assert.True(t, recovered)
+	assert.Equal(t, 0.0, testutil.ToFloat64(open))
+
+	assert.True(t, circuit.pushFailed(pushErr), "a failure after recovery should open the circuit again")
+}
+
+func Test_remoteCircuitProbeInterval(t *testing.T) {
+	probes := 0
+	circuit := NewRemoteCircuit(1, time.Hour, func() error {
+		probes++
+		return nil
+	}, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gitops_remote_circuit_open"}))
+
+	circuit.pushFailed(errors.New("repository not found"))
+	allowed, _ := circuit.allow()
+	assert.False(t, allowed)
+	assert.Equal(t, 0, probes, "should not probe before the interval passes")
+}
@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/sirupsen/logrus"
+)
+
+// imageUpdateTrigger is the TriggeredBy of the releases of the image update worker
+const imageUpdateTrigger = "imageUpdate"
+
+// holdsDeploysOnSyncFailure tells if any env holds its auto-deploys while its sync is failing
+func holdsDeploysOnSyncFailure(envs map[string]*dx.Env) bool {
+	for _, e := range envs {
+		if e != nil && e.HoldDeploysOnSyncFailure {
+			return true
+		}
+	}
+	return false
+}
+
+// autoDeploy tells if an event deploys without a human asking for it: by the deploy policies, or by an image update policy.
+// Other releases are explicit, they are never held
+func autoDeploy(event *model.Event) bool {
+	switch event.Type {
+	case model.TypeArtifact, model.TypeReevaluation:
+		return true
+	case model.TypeRelease:
+		var releaseRequest dx.ReleaseRequest
+		if err := json.Unmarshal([]byte(event.Blob), &releaseRequest); err != nil {
+			return false
+		}
+		return releaseRequest.TriggeredBy == imageUpdateTrigger
+	}
+	return false
+}
+
+// heldSync returns the first failing sync of envNames that holds the auto-deploys, nil if none does.
+// Syncs that an admin overrode don't hold
+func heldSync(envs map[string]*dx.Env, syncs []*dx.EnvSync, envNames []string) *dx.EnvSync {
+	for _, env := range envNames {
+		e, ok := envs[env]
+		if !ok || e == nil || !e.HoldDeploysOnSyncFailure {
+			continue
+		}
+		if sync := dx.FailingSync(syncs, env); sync != nil && sync.OverriddenBy == "" {
+			return sync
+		}
+	}
+	return nil
+}
+
+// holdingEnvs returns the envs whose failing sync holds the auto-deploys
+func holdingEnvs(envs map[string]*dx.Env, syncs []*dx.EnvSync) map[string]bool {
+	holding := map[string]bool{}
+	for _, sync := range syncs {
+		if heldSync(envs, syncs, []string{sync.Env}) != nil {
+			holding[sync.Env] = true
+		}
+	}
+	return holding
+}
+
+// failingSyncs returns the failing syncs of the envs, nil if no env holds its deploys on sync failures
+func (w *GitopsWorker) failingSyncs() ([]*dx.EnvSync, error) {
+	if !holdsDeploysOnSyncFailure(w.envs) {
+		return nil, nil
+	}
+	return w.store.FailingEnvSyncs()
+}
+
+// requeueHeldEvents puts the held events back to the queue when an env stopped holding the auto-deploys:
+// its sync recovered, an admin overrode the hold, or GimletD restarted, maybe with a changed env config.
+// The events that are still held are held again in the next round
+func (w *GitopsWorker) requeueHeldEvents(holding map[string]bool) {
+	released := w.holding == nil
+	for env := range w.holding {
+		if !holding[env] {
+			released = true
+		}
+	}
+	w.holding = holding
+	if !released {
+		return
+	}
+
+	requeued, err := w.store.RequeueHeldEvents()
+	if err != nil {
+		logrus.Warnf("could not requeue the held events: %s", err)
+		w.holding = nil // retried in the next round
+		return
+	}
+	if requeued > 0 {
+		logrus.Infof("%d held events are requeued", requeued)
+	}
+}
+
+// holdAutoDeploys takes the auto-deploys to envs with a failing sync out of the queue, and returns the rest of the events.
+// Held events don't take up the fetched batches, so the deploys to the healthy envs, the releases and the rollbacks go on
+func (w *GitopsWorker) holdAutoDeploys(events []*model.Event, syncs []*dx.EnvSync) []*model.Event {
+	if len(syncs) == 0 {
+		return events
+	}
+
+	var rest []*model.Event
+	for _, event := range events {
+		if autoDeploy(event) {
+			if sync := heldSync(w.envs, syncs, deployEnvs(w.store, event, w.envs)); sync != nil {
+				desc := fmt.Sprintf("held while the sync of %s is failing: %s", sync.Env, sync.Reason)
+				if err := w.store.HoldEvent(event.ID, desc); err != nil {
+					logrus.Warnf("could not hold event %s: %s", event.ID, err)
+				} else {
+					logrus.Infof("event %s is %s", event.ID, desc)
+				}
+				continue
+			}
+		}
+		rest = append(rest, event)
+	}
+	return rest
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_heldSync(t *testing.T) {
+	envs := map[string]*dx.Env{
+		"staging":    {Name: "staging"},
+		"production": {Name: "production", HoldDeploysOnSyncFailure: true},
+	}
+	assert.True(t, holdsDeploysOnSyncFailure(envs))
+	assert.False(t, holdsDeploysOnSyncFailure(map[string]*dx.Env{"staging": {Name: "staging"}}))
+
+	syncs := []*dx.EnvSync{
+		{Env: "staging", Reason: "HealthCheckFailed"},
+		{Env: "production", Reason: "ReconciliationFailed"},
+	}
+	assert.Nil(t, heldSync(envs, syncs, []string{"staging"}), "envs that don't hold their deploys should not be held")
+	assert.Equal(t, "production", heldSync(envs, syncs, []string{"staging", "production"}).Env)
+	assert.Nil(t, heldSync(envs, syncs[:1], []string{"production"}), "healthy envs should not be held")
+
+	syncs[1].OverriddenBy = "admin"
+	assert.Nil(t, heldSync(envs, syncs, []string{"production"}), "overridden syncs should not hold")
+}
+
+func Test_holdAutoDeploys(t *testing.T) {
+	s := store.NewTest()
+	envs := map[string]*dx.Env{
+		"production": {Name: "production", HoldDeploysOnSyncFailure: true},
+	}
+	w := &GitopsWorker{store: s, envs: envs}
+
+	for i := 0; i < 11; i++ {
+		event, err := model.ToEvent(dx.Artifact{
+			Version: dx.Version{RepositoryName: "my-app", Branch: "main", Event: *dx.PushPtr()},
+			Environments: []*dx.Manifest{{
+				App:    "my-app",
+				Env:    "production",
+				Deploy: &dx.Deploy{Branch: "main", Event: dx.PushPtr()},
+			}},
+		})
+		assert.Nil(t, err)
+		_, err = s.CreateEvent(event)
+		assert.Nil(t, err)
+	}
+	release := func(triggeredBy string) *model.Event {
+		releaseRequest, _ := json.Marshal(dx.ReleaseRequest{Env: "production", App: "my-app", ArtifactID: "my-app-1", TriggeredBy: triggeredBy})
+		event, err := s.CreateEvent(&model.Event{Type: model.TypeRelease, Blob: string(releaseRequest), GitopsHashes: []string{}})
+		assert.Nil(t, err)
+		return event
+	}
+	imageUpdate := release(imageUpdateTrigger)
+	manual := release("jane")
+
+	syncs := []*dx.EnvSync{{Env: "production", Reason: model.HealthCheckFailed}}
+	w.requeueHeldEvents(holdingEnvs(envs, syncs))
+	var processed []*model.Event
+	for round := 0; round < 3; round++ {
+		events, err := s.UnprocessedEvents()
+		assert.Nil(t, err)
+		for _, event := range w.holdAutoDeploys(events, syncs) {
+			s.MarkEventProcessing(event.ID)
+			processed = append(processed, event)
+		}
+	}
+	assert.Equal(t, 1, len(processed), "held events should not starve the release behind them")
+	assert.Equal(t, manual.ID, processed[0].ID)
+
+	held, err := s.Event(imageUpdate.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, model.StatusHeld, held.Status, "image updates should be held too")
+
+	syncs[0].OverriddenBy = "admin"
+	w.requeueHeldEvents(holdingEnvs(envs, syncs))
+	events, err := s.UnprocessedEvents()
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(events), "overriding the hold should requeue the held events")
+	backlog, _, _ := s.EventBacklog()
+	assert.Equal(t, 12, backlog)
+	assert.Equal(t, len(events), len(w.holdAutoDeploys(events, syncs)))
+}
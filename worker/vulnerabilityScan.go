@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/gimlet-io/gimletd/scanner"
+	"github.com/sirupsen/logrus"
+)
+
+// vulnerabilityPolicy returns the vulnerability scan policy of the env, nil if its deploys are not scanned
+func vulnerabilityPolicy(envs map[string]*dx.Env, env string) *dx.VulnerabilityScan {
+	if e, ok := envs[env]; ok && e != nil {
+		return e.VulnerabilityScan
+	}
+	return nil
+}
+
+// vulnerabilityGate scans the image of the manifest and fails if the report exceeds a threshold of the policy.
+// The report is written to the log, so it is recorded on the event
+func vulnerabilityGate(imageScanner *scanner.Scanner, manifest *dx.Manifest, policy *dx.VulnerabilityScan, log *logrus.Entry) error {
+	if imageScanner == nil {
+		return fmt.Errorf("%s requires a vulnerability scan, but no vulnerability scanner is configured", manifest.Env)
+	}
+	image := manifestImage(manifest)
+	if image == "" {
+		return fmt.Errorf("%s requires a vulnerability scan, but the image of %s is not set in image.repository and image.tag", manifest.Env, manifest.App)
+	}
+
+	report, err := imageScanner.Scan(image)
+	if err != nil {
+		return err
+	}
+	log.Info(report.Summary())
+	for _, v := range report.Vulnerabilities {
+		if _, ok := policy.Thresholds[v.Severity]; ok {
+			log.Warnf("%s %s in %s", v.Severity, v.ID, v.Package)
+		}
+	}
+
+	if exceeded := report.Exceeded(policy.Thresholds); len(exceeded) > 0 {
+		return fmt.Errorf("vulnerability scan of %s exceeds the thresholds of %s: %s", image, manifest.Env, strings.Join(exceeded, ", "))
+	}
+	return nil
+}
+
+// manifestImage returns the image of the manifest from the image.repository and image.tag values
+func manifestImage(manifest *dx.Manifest) string {
+	image, ok := manifest.Values["image"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	repository, _ := image["repository"].(string)
+	if repository == "" {
+		return ""
+	}
+	if tag := fmt.Sprint(image["tag"]); image["tag"] != nil && tag != "" {
+		return repository + ":" + tag
+	}
+	return repository
+}
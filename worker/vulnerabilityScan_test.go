@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/gimlet-io/gimletd/dx"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_manifestImage(t *testing.T) {
+	m := &dx.Manifest{Values: map[string]interface{}{
+		"image": map[string]interface{}{"repository": "ghcr.io/gimlet-io/gimletd", "tag": "v0.10.0"},
+	}}
+	assert.Equal(t, "ghcr.io/gimlet-io/gimletd:v0.10.0", manifestImage(m))
+
+	m = &dx.Manifest{Values: map[string]interface{}{
+		"image": map[string]interface{}{"repository": "nginx"},
+	}}
+	assert.Equal(t, "nginx", manifestImage(m))
+
+	assert.Equal(t, "", manifestImage(&dx.Manifest{}))
+}
+
+func Test_vulnerabilityGate(t *testing.T) {
+	envs := map[string]*dx.Env{
+		"production": {Name: "production", VulnerabilityScan: &dx.VulnerabilityScan{Thresholds: map[string]int{"CRITICAL": 0}}},
+		"staging":    {Name: "staging"},
+	}
+	assert.Nil(t, vulnerabilityPolicy(envs, "staging"))
+	assert.Nil(t, vulnerabilityPolicy(envs, "preview"))
+
+	policy := vulnerabilityPolicy(envs, "production")
+	assert.NotNil(t, policy)
+
+	m := &dx.Manifest{Env: "production", App: "my-app"}
+	err := vulnerabilityGate(nil, m, policy, testLog)
+	assert.NotNil(t, err, "protected envs should not be deployed without a scanner")
+}
@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// EventWatchdog flags events that are stuck in processing,
+// and requeues the ones that the gitops worker abandoned.
+// It also notifies the operators when the unprocessed events pile up, as the worker silently stopped
+type EventWatchdog struct {
+	store                *store.Store
+	threshold            time.Duration
+	stuckEvents          prometheus.Gauge
+	notificationsManager notifications.Manager
+	backlogThreshold     int
+	backlogMaxAge        time.Duration
+	eventBacklog         prometheus.Gauge
+	eventBacklogStuck    prometheus.Gauge
+
+	backlogStuck bool
+}
+
+func NewEventWatchdog(
+	store *store.Store,
+	threshold time.Duration,
+	stuckEvents prometheus.Gauge,
+	notificationsManager notifications.Manager,
+	backlogThreshold int,
+	backlogMaxAge time.Duration,
+	eventBacklog prometheus.Gauge,
+	eventBacklogStuck prometheus.Gauge,
+) *EventWatchdog {
+	return &EventWatchdog{
+		store:                store,
+		threshold:            threshold,
+		stuckEvents:          stuckEvents,
+		notificationsManager: notificationsManager,
+		backlogThreshold:     backlogThreshold,
+		backlogMaxAge:        backlogMaxAge,
+		eventBacklog:         eventBacklog,
+		eventBacklogStuck:    eventBacklogStuck,
+	}
+}
+
+func (w *EventWatchdog) Run() {
+	for {
+		w.check()
+		time.Sleep(30 * time.Second)
+	}
+}
+
+func (w *EventWatchdog) check() {
+	w.checkBacklog()
+
+	stuckEvents, err := w.store.StuckEvents(time.Now().Add(-w.threshold))
+	if err != nil {
+		logrus.Errorf("could not fetch stuck events: %s", err)
+		return
+	}
+	w.stuckEvents.Set(float64(len(stuckEvents)))
+
+	heartbeat, err := w.store.Heartbeat(GitopsWorkerName)
+	if err != nil && err != sql.ErrNoRows {
+		logrus.Errorf("could not load gitops worker heartbeat: %s", err)
+		return
+	}
+	if time.Since(heartbeat) > w.threshold {
+		logrus.Errorf("gitops worker did not report a heartbeat since %s", heartbeat.Format(time.RFC3339))
+	}
+
+	for _, event := range stuckEvents {
+		processingStarted := time.Unix(event.ProcessingStarted, 0)
+		logrus.Errorf("event %s is stuck in processing since %s", event.ID, processingStarted.Format(time.RFC3339))
+
+		// the worker processes events one by one,
+		// if it reported alive after picking up the event, it is not working on it anymore
+		if heartbeat.After(processingStarted) &&
+			time.Since(heartbeat) < heartbeatInterval*3 {
+			err = w.store.RequeueEvent(event.ID)
+			if err != nil {
+				logrus.Errorf("could not requeue event %s: %s", event.ID, err)
+				continue
+			}
+			logrus.Warnf("requeued stuck event %s", event.ID)
+		}
+	}
+}
+
+// checkBacklog notifies once when the unprocessed events exceed the threshold, or the oldest one the age limit,
+// and once more when the backlog is back within limits
+func (w *EventWatchdog) checkBacklog() {
+	size, oldest, err := w.store.EventBacklog()
+	if err != nil {
+		logrus.Errorf("could not fetch the event backlog: %s", err)
+		return
+	}
+	w.eventBacklog.Set(float64(size))
+
+	stuck := size > 0 &&
+		(size > w.backlogThreshold || time.Since(oldest) > w.backlogMaxAge)
+	if stuck {
+		w.eventBacklogStuck.Set(1)
+		logrus.Errorf("%d events are waiting to be processed, the oldest since %s", size, oldest.Format(time.RFC3339))
+	} else {
+		w.eventBacklogStuck.Set(0)
+	}
+
+	if stuck != w.backlogStuck {
+		w.backlogStuck = stuck
+		w.notificationsManager.Broadcast(notifications.NewEventBacklogMessage(stuck, size, oldest))
+	}
+}
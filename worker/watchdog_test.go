@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gimlet-io/gimletd/model"
+	"github.com/gimlet-io/gimletd/notifications"
+	"github.com/gimlet-io/gimletd/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_eventWatchdog(t *testing.T) {
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	event, err := s.CreateEvent(&model.Event{
+		Type:         model.TypeRelease,
+		Blob:         "{}",
+		GitopsHashes: []string{},
+	})
+	assert.Nil(t, err)
+	err = s.MarkEventProcessing(event.ID)
+	assert.Nil(t, err)
+
+	stuckEvents := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_stuck_events"})
+	watchdog := NewEventWatchdog(
+		s,
+		-1*time.Minute,
+		stuckEvents,
+		notifications.NewDummyManager(),
+		100,
+		time.Hour,
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_event_backlog"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_event_backlog_stuck"}),
+	)
+
+	err = s.SaveHeartbeat(GitopsWorkerName, time.Now().Add(-1*time.Hour))
+	assert.Nil(t, err)
+	watchdog.check()
+	assert.Equal(t, 1.0, testutil.ToFloat64(stuckEvents))
+	unprocessed, err := s.UnprocessedEvents()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(unprocessed), "should not requeue while the worker may still work on the event")
+
+	err = s.SaveHeartbeat(GitopsWorkerName, time.Now().Add(1*time.Second))
+	assert.Nil(t, err)
+	watchdog.check()
+	unprocessed, err = s.UnprocessedEvents()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(unprocessed), "should requeue events the worker abandoned")
+}
+
+func Test_eventBacklog(t *testing.T) {
+	s := store.NewTest()
+	defer func() {
+		s.Close()
+	}()
+
+	eventBacklog := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_event_backlog"})
+	eventBacklogStuck := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_event_backlog_stuck"})
+	watchdog := NewEventWatchdog(
+		s,
+		time.Minute,
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_stuck_events"}),
+		notifications.NewDummyManager(),
+		1,
+		time.Hour,
+		eventBacklog,
+		eventBacklogStuck,
+	)
+
+	watchdog.checkBacklog()
+	assert.Equal(t, 0.0, testutil.ToFloat64(eventBacklogStuck), "an empty backlog is not stuck")
+
+	for i := 0; i < 2; i++ {
+		_, err := s.CreateEvent(&model.Event{
+			Type:         model.TypeRelease,
+			Blob:         "{}",
+			GitopsHashes: []string{},
+		})
+		assert.Nil(t, err)
+	}
+	watchdog.checkBacklog()
+	assert.Equal(t, 2.0, testutil.ToFloat64(eventBacklog))
+	assert.Equal(t, 1.0, testutil.ToFloat64(eventBacklogStuck), "should flag the backlog over the threshold")
+	assert.True(t, watchdog.backlogStuck)
+
+	watchdog.backlogThreshold = 10
+	watchdog.checkBacklog()
+	assert.Equal(t, 0.0, testutil.ToFloat64(eventBacklogStuck), "should clear the flag within limits")
+
+	watchdog.backlogMaxAge = -1 * time.Minute
+	watchdog.checkBacklog()
+	assert.Equal(t, 1.0, testutil.ToFloat64(eventBacklogStuck), "should flag the backlog with an old event")
+}